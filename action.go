@@ -0,0 +1,70 @@
+package soap
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+// WithActionResolver derives the action of calls made with an empty action from the request, e.g. with
+// ElementActionResolver. An action passed to Client.Do always wins. The resolved action is sent as SOAPAction
+// and WS-Addressing Action, and applies to the idempotency classification as well.
+func WithActionResolver(resolve func(request any) string) Option {
+	return func(s *settings) error {
+		s.actionResolver = resolve
+		return nil
+	}
+}
+
+// ElementActionResolver returns the resolver of document/literal wrapped services, building the action
+// "{targetNamespace}/{ElementLocalName}" from the name of the request element. If targetNamespace is empty,
+// the namespace of the element is used. Requests are named by their XMLName tag, their type name or, for
+// RawXML, their root element; it resolves to an empty action if the request has no name.
+func ElementActionResolver(targetNamespace string) func(request any) string {
+	return func(request any) string {
+		name := requestElementName(request)
+		if name.Local == "" {
+			return ""
+		}
+		ns := targetNamespace
+		if ns == "" {
+			ns = name.Space
+		}
+		if ns == "" {
+			return name.Local
+		}
+		return strings.TrimSuffix(ns, "/") + "/" + name.Local
+	}
+}
+
+// requestElementName returns the name of the element request is serialized to.
+func requestElementName(request any) xml.Name {
+	if raw, ok := request.(RawXML); ok {
+		d := xml.NewDecoder(bytes.NewReader([]byte(raw)))
+		for {
+			tok, err := d.Token()
+			if err != nil {
+				return xml.Name{}
+			}
+			if start, ok := tok.(xml.StartElement); ok {
+				return start.Name
+			}
+		}
+	}
+	if request == EmptyBody {
+		return xml.Name{}
+	}
+	if name := taggedXMLName(request); name != nil {
+		return *name
+	}
+	t := reflect.TypeOf(request)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return xml.Name{}
+	}
+	return xml.Name{Local: t.Name()}
+}
@@ -0,0 +1,55 @@
+package soap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+)
+
+type getOrder struct {
+	XMLName xml.Name `xml:"http://example.com/orders/ GetOrder"`
+	ID      string   `xml:"ID"`
+}
+
+type unnamedRequest struct {
+	ID string
+}
+
+func TestElementActionResolver(t *testing.T) {
+	tests := []struct {
+		name    string
+		ns      string
+		request any
+		want    string
+	}{
+		{name: "element namespace", request: &getOrder{}, want: "http://example.com/orders/GetOrder"},
+		{name: "target namespace", ns: "urn:orders", request: &getOrder{}, want: "urn:orders/GetOrder"},
+		{name: "type name", ns: "urn:orders", request: unnamedRequest{}, want: "urn:orders/unnamedRequest"},
+		{name: "raw xml", request: RawXML(`<!-- c --><o:Cancel xmlns:o="urn:orders"/>`), want: "urn:orders/Cancel"},
+		{name: "no namespace", request: RawXML(`<Cancel/>`), want: "Cancel"},
+		{name: "no element", request: "text", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ElementActionResolver(tt.ns)(tt.request))
+		})
+	}
+}
+
+func TestActionResolver(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithActionResolver(ElementActionResolver("")), WithAddressing(AddressingOptions{})))
+
+	assert.NoError(t, client.Do(context.Background(), "", &getOrder{ID: "1"}, &quirksResponse{}))
+	assert.NoError(t, client.Do(context.Background(), "urn:explicit", &getOrder{ID: "2"}, &quirksResponse{}))
+
+	if assert.Len(t, *captured, 2) {
+		assert.Equal(t, "http://example.com/orders/GetOrder", (*captured)[0].header.Get("SOAPAction"))
+		assert.Contains(t, (*captured)[0].body, ">http://example.com/orders/GetOrder</")
+		assert.Equal(t, "urn:explicit", (*captured)[1].header.Get("SOAPAction"))
+		assert.Contains(t, (*captured)[1].body, ">urn:explicit</")
+	}
+}
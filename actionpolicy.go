@@ -0,0 +1,88 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+)
+
+var (
+	// ErrActionDenied is returned for calls of an action an action policy rejected. The returned error is an
+	// *ActionDeniedError.
+	ErrActionDenied = errors.New("action denied")
+)
+
+// ActionDeniedError reports the action a policy of WithActionPolicy rejected, with the error of the policy.
+type ActionDeniedError struct {
+	Action   string
+	Endpoint string
+	Err      error
+}
+
+func (e *ActionDeniedError) Error() string {
+	msg := fmt.Sprintf("%s: %q at %s", ErrActionDenied, e.Action, redactURL(e.Endpoint))
+	if e.Err != nil && !errors.Is(e.Err, ErrActionDenied) {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *ActionDeniedError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrActionDenied}
+	}
+	return []error{ErrActionDenied, e.Err}
+}
+
+// ActionPolicy decides whether the action may be called at the endpoint, rejecting it with an error.
+type ActionPolicy func(ctx context.Context, action string, endpoint string) error
+
+// WithActionPolicy checks the action of every attempt of a call with policy before the request is encoded,
+// also of retries, of the calls of batches and of forwarded envelopes. A rejected call fails with an
+// *ActionDeniedError without being sent and is logged at warn level to the logger of WithLogger.
+//
+// Policies add up: a call is made only if all policies set on the client and for the call allow it, so the
+// options of a call cannot lift the policy of the client.
+func WithActionPolicy(policy ActionPolicy) Option {
+	return func(s *settings) error {
+		s.actionPolicies = append(s.actionPolicies[:len(s.actionPolicies):len(s.actionPolicies)], policy)
+		return nil
+	}
+}
+
+// AllowActions returns a policy allowing the actions only, for WithActionPolicy. The actions are compared
+// as given to Client.Do, before any WithSOAPActionFormatter.
+func AllowActions(actions ...string) ActionPolicy {
+	allowed := slices.Clone(actions)
+	return func(_ context.Context, action string, _ string) error {
+		if !slices.Contains(allowed, action) {
+			return ErrActionDenied
+		}
+		return nil
+	}
+}
+
+// checkAction applies the action policies to a call of action at endpoint.
+func (s *settings) checkAction(ctx context.Context, action, endpoint string) error {
+	if denied := s.deniedAction(ctx, action, endpoint); denied != nil {
+		if s.logger != nil {
+			s.logger.LogAttrs(ctx, slog.LevelWarn, "soap action denied", slog.String("action", action),
+				slog.String("endpoint", redactURL(endpoint)), slog.String("error", denied.Error()))
+		}
+		return denied
+	}
+	return nil
+}
+
+// deniedAction returns the error of the first action policy denying a call of action at endpoint, nil if
+// they all allow it.
+func (s *settings) deniedAction(ctx context.Context, action, endpoint string) *ActionDeniedError {
+	for _, policy := range s.actionPolicies {
+		if err := policy(ctx, action, endpoint); err != nil {
+			return &ActionDeniedError{Action: action, Endpoint: endpoint, Err: err}
+		}
+	}
+	return nil
+}
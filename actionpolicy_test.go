@@ -0,0 +1,76 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowActions(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	var logs bytes.Buffer
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithActionPolicy(AllowActions("Read")),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil)))))
+	require.NoError(t, client.Do(context.Background(), "Read", &quirksRequest{}, &quirksResponse{}))
+
+	err := client.Do(context.Background(), "Delete", &quirksRequest{}, &quirksResponse{},
+		WithActionPolicy(func(context.Context, string, string) error { return nil }))
+	assert.ErrorIs(t, err, ErrActionDenied)
+	var denied *ActionDeniedError
+	if assert.ErrorAs(t, err, &denied) {
+		assert.Equal(t, "Delete", denied.Action)
+		assert.Equal(t, srv.URL, denied.Endpoint)
+	}
+	assert.Len(t, *captured, 1)
+	assert.Contains(t, logs.String(), `msg="soap action denied" action=Delete`)
+
+	results := Batch(context.Background(), client, []BatchItem{
+		{Action: "Read", Request: &quirksRequest{}},
+		{Action: "Delete", Request: &quirksRequest{}},
+	})
+	assert.NoError(t, results[0].Err)
+	assert.ErrorIs(t, results[1].Err, ErrActionDenied)
+
+	_, err = client.ForwardEnvelope(context.Background(), "Delete", []byte(infoResponseBody))
+	assert.ErrorIs(t, err, ErrActionDenied)
+	assert.Len(t, *captured, 2)
+}
+
+func TestActionPolicyRetries(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(srv.Close)
+
+	// the policy is consulted for every attempt, e.g. for a quota
+	errQuota := errors.New("quota exceeded")
+	var checks int
+	policy := func(_ context.Context, action, endpoint string) error {
+		checks++
+		if checks > 1 {
+			return errQuota
+		}
+		return nil
+	}
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithActionPolicy(policy), MarkIdempotent("GetInfo"),
+		WithRetry(RetryPolicy{MaxAttempts: 3, Backoff: func(int) time.Duration { return 0 }})))
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, ErrActionDenied)
+	assert.ErrorIs(t, err, errQuota)
+	assert.EqualError(t, err, `action denied: "GetInfo" at `+srv.URL+`: quota exceeded`)
+	assert.Equal(t, 2, checks)
+	assert.Equal(t, int32(1), hits.Load())
+}
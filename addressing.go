@@ -0,0 +1,95 @@
+package soap
+
+import (
+	"context"
+
+	"github.com/m29h/xml"
+
+	"github.com/google/uuid"
+)
+
+// Implements WS-Addressing 1.0 message headers and context-aware header builders.
+// Context-aware builders see the context of the attempt, so they can take the deadline and attempt number into account.
+
+const wsaNS = "http://www.w3.org/2005/08/addressing"
+
+// ContextHeaderBuilder is a HeaderBuilder receiving the context of the attempt. The context carries the
+// deadline of the call and the attempt number, see AttemptFromContext.
+type ContextHeaderBuilder func(ctx context.Context, body any) (any, error)
+
+// WithHeaderBuilder adds a context-aware header builder. It is run after the builders passed to NewClient.
+func WithHeaderBuilder(builder ContextHeaderBuilder) Option {
+	return func(s *settings) error {
+		s.headerBuilders = append(s.headerBuilders[:len(s.headerBuilders):len(s.headerBuilders)], builder)
+		return nil
+	}
+}
+
+type attemptKey struct{}
+
+// contextWithAttempt returns a copy of ctx carrying the attempt number.
+func contextWithAttempt(ctx context.Context, attempt int) context.Context {
+	return context.WithValue(ctx, attemptKey{}, attempt)
+}
+
+// AttemptFromContext returns the number of the attempt, starting at 1, of the call the context was passed to
+// a ContextHeaderBuilder for. It returns 0 outside of a call.
+func AttemptFromContext(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptKey{}).(int)
+	return attempt
+}
+
+// AddressingOptions configures the WS-Addressing headers sent with WithAddressing.
+type AddressingOptions struct {
+	// ReuseMessageID sends the same wsa:MessageID with all attempts of a call, so the server can detect retries
+	// of a message it already processed. Otherwise every attempt gets a new message id.
+	ReuseMessageID bool
+	// ReplyTo is sent as wsa:ReplyTo address if not empty, e.g. the callback endpoint of a service replying
+	// asynchronously, see package async.
+	ReplyTo string
+}
+
+// WithAddressing sends the WS-Addressing headers wsa:To, wsa:Action and wsa:MessageID with every call.
+// The message id is recorded in ResponseInfo.MessageID.
+func WithAddressing(opts AddressingOptions) Option {
+	return func(s *settings) error {
+		s.addressing = &opts
+		return nil
+	}
+}
+
+// WithMessageID sends id as wsa:MessageID with all attempts of the call instead of a generated message id,
+// e.g. to register the correlation of an asynchronous reply before sending. It requires WithAddressing.
+func WithMessageID(id string) Option {
+	return func(s *settings) error {
+		s.messageID = id
+		return nil
+	}
+}
+
+type wsaHeader struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type wsaReplyTo struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2005/08/addressing ReplyTo"`
+	Address string   `xml:"http://www.w3.org/2005/08/addressing Address"`
+}
+
+// addressingHeaders returns the WS-Addressing headers of the request.
+func (r *Request) addressingHeaders() []any {
+	headers := []any{
+		wsaHeader{XMLName: xml.Name{Space: wsaNS, Local: "To"}, Value: r.url},
+		wsaHeader{XMLName: xml.Name{Space: wsaNS, Local: "Action"}, Value: r.action},
+		wsaHeader{XMLName: xml.Name{Space: wsaNS, Local: "MessageID"}, Value: r.messageID},
+	}
+	if r.settings.addressing != nil && r.settings.addressing.ReplyTo != "" {
+		headers = append(headers, wsaReplyTo{Address: r.settings.addressing.ReplyTo})
+	}
+	return headers
+}
+
+func newMessageID() string {
+	return "urn:uuid:" + uuid.New().String()
+}
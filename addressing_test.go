@@ -0,0 +1,108 @@
+package soap
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var messageIDPattern = regexp.MustCompile(`MessageID[^>]*>(urn:uuid:[0-9a-f-]+)<`)
+
+// newAddressingServer fails the first failures requests with 503 and records the message ids of all requests.
+func newAddressingServer(t *testing.T, failures int) (*httptest.Server, *[]string) {
+	t.Helper()
+	var ids []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if m := messageIDPattern.FindSubmatch(body); m != nil {
+			ids = append(ids, string(m[1]))
+		}
+		if len(ids) <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &ids
+}
+
+func TestAddressingMessageID(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   AddressingOptions
+		reused bool
+	}{
+		{name: "fresh per attempt", opts: AddressingOptions{}},
+		{name: "reused on retry", opts: AddressingOptions{ReuseMessageID: true}, reused: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, ids := newAddressingServer(t, 2)
+			client := NewClient(srv.URL)
+			assert.NoError(t, client.SetOptions(WithRetry(fastRetry), MarkIdempotent("GetInfo"), WithAddressing(tt.opts)))
+
+			var info ResponseInfo
+			err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithResponseInfo(&info))
+			assert.NoError(t, err)
+			if assert.Len(t, *ids, 3) {
+				assert.Equal(t, tt.reused, (*ids)[0] == (*ids)[2])
+				assert.Equal(t, (*ids)[2], info.MessageID)
+			}
+		})
+	}
+}
+
+func TestHeaderBuilderContext(t *testing.T) {
+	srv, _ := newAddressingServer(t, 1)
+	client := NewClient(srv.URL)
+
+	var attempts []int
+	var deadlines []time.Time
+	builder := func(ctx context.Context, body any) (any, error) {
+		attempts = append(attempts, AttemptFromContext(ctx))
+		deadline, _ := ctx.Deadline()
+		deadlines = append(deadlines, deadline)
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	err := client.Do(ctx, "GetInfo", &infoRequest{}, &infoResponse{},
+		WithRetry(fastRetry), MarkIdempotent("GetInfo"), WithAddressing(AddressingOptions{}), WithHeaderBuilder(builder))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, attempts)
+	for _, d := range deadlines {
+		assert.True(t, deadline.Equal(d))
+	}
+	assert.Equal(t, 0, AttemptFromContext(ctx))
+}
+
+func TestAddressingReplyTo(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		// the reply is sent later to the ReplyTo address
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(srv.Close)
+
+	var info ResponseInfo
+	resp := &infoResponse{}
+	err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, resp, WithResponseInfo(&info),
+		WithAddressing(AddressingOptions{ReplyTo: "http://client.example.com/callback"}), WithMessageID("urn:uuid:m-1"))
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Items)
+	assert.Equal(t, http.StatusAccepted, info.StatusCode)
+	assert.Equal(t, "urn:uuid:m-1", info.MessageID)
+	assert.Regexp(t, `MessageID[^>]*>urn:uuid:m-1</`, string(body))
+	assert.Regexp(t, `ReplyTo[^>]*><[^>]*Address>http://client.example.com/callback</`, string(body))
+}
@@ -0,0 +1,120 @@
+package soap
+
+import (
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+// Implements a generic element tree for the dynamic parts (xs:any, xs:anyType) of otherwise typed messages.
+
+// AnyElement captures an arbitrary element with its attributes, text and child elements.
+// Namespace declarations are not kept as attributes, names carry the resolved namespace instead and the
+// required declarations are written again when the element is marshalled.
+type AnyElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr
+	Children []AnyElement
+	// Value is the text directly contained in the element, without the text of its children.
+	// Whitespace-only text of elements having children is dropped.
+	Value string
+}
+
+// UnmarshalXML implements xml.Unmarshaler.
+func (e *AnyElement) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*e = AnyElement{XMLName: start.Name}
+	for _, attr := range start.Attr {
+		if _, ok := declaredPrefix(attr); !ok {
+			e.Attrs = append(e.Attrs, attr)
+		}
+	}
+
+	var text strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			var child AnyElement
+			if err := child.UnmarshalXML(d, tok); err != nil {
+				return err
+			}
+			e.Children = append(e.Children, child)
+		case xml.CharData:
+			text.Write(tok)
+		case xml.EndElement:
+			e.Value = text.String()
+			if len(e.Children) > 0 && strings.TrimSpace(e.Value) == "" {
+				e.Value = ""
+			}
+			return nil
+		}
+	}
+}
+
+// MarshalXML implements xml.Marshaler. The text is written before the children.
+func (e AnyElement) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start.Name = e.XMLName
+	start.Attr = e.Attrs
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if e.Value != "" {
+		if err := enc.EncodeToken(xml.CharData(e.Value)); err != nil {
+			return err
+		}
+	}
+	for _, child := range e.Children {
+		if err := enc.EncodeElement(child, xml.StartElement{Name: child.XMLName}); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// FindAll returns all descendants of the element with the local name, in document order.
+func (e *AnyElement) FindAll(name string) []*AnyElement {
+	var found []*AnyElement
+	for i := range e.Children {
+		child := &e.Children[i]
+		if child.XMLName.Local == name {
+			found = append(found, child)
+		}
+		found = append(found, child.FindAll(name)...)
+	}
+	return found
+}
+
+// Child returns the first child element with the local name, or nil.
+func (e *AnyElement) Child(name string) *AnyElement {
+	for i := range e.Children {
+		if e.Children[i].XMLName.Local == name {
+			return &e.Children[i]
+		}
+	}
+	return nil
+}
+
+// Text returns the trimmed text of the element reached by following the first child with each local name
+// in path. It returns the text of e itself for an empty path and "" if there is no such element.
+func (e *AnyElement) Text(path ...string) string {
+	el := e
+	for _, name := range path {
+		if el = el.Child(name); el == nil {
+			return ""
+		}
+	}
+	return strings.TrimSpace(el.Value)
+}
+
+// Attr returns the value of the attribute with the local name, or "".
+func (e *AnyElement) Attr(name string) string {
+	for _, attr := range e.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
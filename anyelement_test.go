@@ -0,0 +1,53 @@
+package soap
+
+import (
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type dynamicResponse struct {
+	XMLName xml.Name     `xml:"urn:test LookupResponse"`
+	ID      string       `xml:"ID"`
+	Extra   []AnyElement `xml:",any"`
+}
+
+const dynamicResponseXML = `<LookupResponse xmlns="urn:test" xmlns:x="urn:ext">
+	<ID>42</ID>
+	<x:Customer kind="vip">
+		<x:Name>Alice</x:Name>
+		<x:Address><x:City> Berlin </x:City></x:Address>
+		<x:Address><x:City>Paris</x:City></x:Address>
+	</x:Customer>
+	<Note>plain</Note>
+</LookupResponse>`
+
+func TestAnyElement(t *testing.T) {
+	var resp dynamicResponse
+	assert.NoError(t, xml.Unmarshal([]byte(dynamicResponseXML), &resp))
+	assert.Equal(t, "42", resp.ID)
+	if !assert.Len(t, resp.Extra, 2) {
+		return
+	}
+
+	customer := resp.Extra[0]
+	assert.Equal(t, xml.Name{Space: "urn:ext", Local: "Customer"}, customer.XMLName)
+	assert.Equal(t, "vip", customer.Attr("kind"))
+	assert.Equal(t, "Alice", customer.Text("Name"))
+	assert.Equal(t, "Berlin", customer.Text("Address", "City"))
+	assert.Equal(t, "", customer.Text("Address", "Zip"))
+	cities := customer.FindAll("City")
+	if assert.Len(t, cities, 2) {
+		assert.Equal(t, "Paris", cities[1].Text())
+	}
+	assert.Equal(t, "plain", resp.Extra[1].Text())
+
+	// the tree survives a round trip
+	out, err := xml.Marshal(resp)
+	assert.NoError(t, err)
+	var again dynamicResponse
+	assert.NoError(t, xml.Unmarshal(out, &again))
+	assert.Equal(t, resp.Extra, again.Extra)
+}
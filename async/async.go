@@ -0,0 +1,250 @@
+// Package async implements the asynchronous request-reply pattern of WS-Addressing for services answering
+// requests later in a separate call: the request carries a wsa:ReplyTo address of a callback endpoint of the
+// client, the service acknowledges it with 202 Accepted and sends the reply to the endpoint with wsa:RelatesTo
+// set to the message id of the request.
+package async
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/m29h/xml"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+const (
+	wsaNS = "http://www.w3.org/2005/08/addressing"
+	// relationshipReply is the default wsa:RelatesTo relationship type.
+	relationshipReply = wsaNS + "/reply"
+
+	defaultMaxCallbackSize = 10 << 20
+)
+
+var (
+	// ErrClosed is returned by calls on a closed Client and by calls pending when it was closed.
+	ErrClosed = errors.New("async: client closed")
+)
+
+// Options configures a Client.
+type Options struct {
+	// ReplyTo is the address of the callback endpoint as reachable by the service, sent as wsa:ReplyTo.
+	ReplyTo string
+	// Unmatched is called with callbacks not relating to a pending call, e.g. replies arriving after the call
+	// gave up. relatesTo is empty if the callback carries no wsa:RelatesTo.
+	Unmatched func(relatesTo string, envelope []byte)
+	// MaxCallbackSize limits the size of callback envelopes. Default is 10 MiB.
+	MaxCallbackSize int64
+}
+
+// Client sends calls answered asynchronously and receives their replies as http.Handler of the callback
+// endpoint. It is safe for concurrent use.
+type Client struct {
+	client *soap.Client
+	opts   Options
+
+	mu      sync.Mutex
+	pending map[string]*Call
+	servers []*http.Server
+	closed  bool
+}
+
+// New returns a Client sending calls with client. Every call gets a new wsa:MessageID and the wsa:ReplyTo of
+// opts, and stays pending until a callback with a wsa:RelatesTo of that message id arrives. The callbacks are
+// received by serving the Client on the ReplyTo address, either mounted on an existing server or with Serve.
+func New(client *soap.Client, opts Options) *Client {
+	if opts.MaxCallbackSize <= 0 {
+		opts.MaxCallbackSize = defaultMaxCallbackSize
+	}
+	return &Client{client: client, opts: opts, pending: map[string]*Call{}}
+}
+
+// Call is a sent request waiting for its reply.
+type Call struct {
+	// MessageID is the wsa:MessageID of the request.
+	MessageID string
+
+	client   *Client
+	response any
+	done     chan struct{}
+	err      error
+}
+
+// Done returns a channel closed once the reply arrived.
+func (c *Call) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait blocks until the reply arrived or ctx is done. The reply is decoded into the response of the call,
+// a fault is returned as *soap.Fault. The call stays pending if ctx is done first.
+func (c *Call) Wait(ctx context.Context) error {
+	select {
+	case <-c.done:
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Cancel stops waiting for the reply, it is passed to Options.Unmatched if it arrives later.
+func (c *Call) Cancel() {
+	c.client.mu.Lock()
+	defer c.client.mu.Unlock()
+	if c.client.pending[c.MessageID] == c {
+		delete(c.client.pending, c.MessageID)
+	}
+}
+
+// complete finishes the call with the decoded reply. The call has to be removed from the pending calls.
+func (c *Call) complete(err error) {
+	c.err = err
+	close(c.done)
+}
+
+// Do sends the request and waits for the reply until ctx is done.
+func (c *Client) Do(ctx context.Context, action string, request any, response any, opts ...soap.Option) error {
+	call, err := c.Send(ctx, action, request, response, opts...)
+	if err != nil {
+		return err
+	}
+	defer call.Cancel()
+	return call.Wait(ctx)
+}
+
+// Send sends the request and returns the call pending until the reply arrives, it is decoded into response.
+// A service answering with the reply right away instead of 202 Accepted completes the call immediately.
+func (c *Client) Send(ctx context.Context, action string, request any, response any, opts ...soap.Option) (*Call, error) {
+	call := &Call{
+		MessageID: "urn:uuid:" + uuid.New().String(),
+		client:    c,
+		response:  response,
+		done:      make(chan struct{}),
+	}
+	// the call is registered before sending, the reply may arrive before the request returned
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	c.pending[call.MessageID] = call
+	c.mu.Unlock()
+
+	var info soap.ResponseInfo
+	opts = append(opts[:len(opts):len(opts)], soap.WithAddressing(soap.AddressingOptions{ReplyTo: c.opts.ReplyTo}),
+		soap.WithMessageID(call.MessageID), soap.WithResponseInfo(&info))
+	err := c.client.Do(ctx, action, request, response, opts...)
+	if err != nil || info.StatusCode != http.StatusAccepted {
+		if !c.take(call) {
+			// the reply arrived while the request was finishing
+			return call, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		call.complete(nil)
+	}
+	return call, nil
+}
+
+// take removes the call from the pending calls and reports whether it was still pending.
+func (c *Client) take(call *Call) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending[call.MessageID] != call {
+		return false
+	}
+	delete(c.pending, call.MessageID)
+	return true
+}
+
+type callbackEnvelope struct {
+	Header struct {
+		RelatesTo []relatesTo `xml:"http://www.w3.org/2005/08/addressing RelatesTo"`
+	} `xml:"Header"`
+}
+
+type relatesTo struct {
+	RelationshipType string `xml:"RelationshipType,attr"`
+	Value            string `xml:",chardata"`
+}
+
+// relatedMessage returns the message id the callback envelope is the reply to.
+func relatedMessage(envelope []byte) (string, error) {
+	var v callbackEnvelope
+	if err := xml.Unmarshal(envelope, &v); err != nil {
+		return "", err
+	}
+	for _, r := range v.Header.RelatesTo {
+		if r.RelationshipType == "" || r.RelationshipType == relationshipReply {
+			return r.Value, nil
+		}
+	}
+	return "", nil
+}
+
+// ServeHTTP receives the callbacks carrying the replies. Every well-formed callback is acknowledged with
+// 202 Accepted, the ones not relating to a pending call are passed to Options.Unmatched.
+func (c *Client) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	envelope, err := io.ReadAll(http.MaxBytesReader(w, r.Body, c.opts.MaxCallbackSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	id, err := relatedMessage(envelope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	call, ok := c.pending[id]
+	delete(c.pending, id)
+	c.mu.Unlock()
+	if ok {
+		call.complete(soap.UnmarshalResponse(envelope, call.response))
+	} else if c.opts.Unmatched != nil {
+		c.opts.Unmatched(id, envelope)
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Serve runs an embedded callback server on l until the Client is closed, it returns http.ErrServerClosed then.
+func (c *Client) Serve(l net.Listener) error {
+	srv := &http.Server{Handler: c}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.servers = append(c.servers, srv)
+	c.mu.Unlock()
+	return srv.Serve(l)
+}
+
+// Close stops the embedded callback servers and fails the pending calls with ErrClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	pending, servers := c.pending, c.servers
+	c.pending, c.servers = map[string]*Call{}, nil
+	c.mu.Unlock()
+
+	for _, call := range pending {
+		call.complete(ErrClosed)
+	}
+	var errs []error
+	for _, srv := range servers {
+		errs = append(errs, srv.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,201 @@
+package async
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+	"github.com/OmerBerkcanMee/gosoap/soaptest"
+)
+
+type echo struct {
+	XMLName xml.Name `xml:"urn:test Echo"`
+	Value   string   `xml:"Value"`
+}
+
+type echoResponse struct {
+	XMLName xml.Name `xml:"urn:test EchoResponse"`
+	Value   string   `xml:"Value"`
+}
+
+var (
+	messageID = regexp.MustCompile(`MessageID[^>]*>([^<]+)<`)
+	replyTo   = regexp.MustCompile(`ReplyTo[^>]*><[^>]*Address[^>]*>([^<]+)<`)
+)
+
+// callback returns the envelope of the reply to the message id carrying body.
+func callback(id, body string) string {
+	return `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:a="` + wsaNS + `"><s:Header>` +
+		`<a:Action>urn:test:EchoResponse</a:Action><a:RelatesTo>` + id + `</a:RelatesTo></s:Header>` +
+		`<s:Body>` + body + `</s:Body></s:Envelope>`
+}
+
+// newAsyncServer acknowledges Echo requests and posts the reply to their ReplyTo address after delay.
+// reply returns the body of the reply and whether to send it.
+func newAsyncServer(t *testing.T, delay time.Duration, reply func(id string) (string, bool)) *soaptest.Server {
+	srv := soaptest.NewServer(t)
+	var wg sync.WaitGroup
+	t.Cleanup(wg.Wait)
+	srv.Handle("urn:test:Echo", func(w http.ResponseWriter, r *http.Request) {
+		reqs := srv.Requests()
+		body := reqs[len(reqs)-1].Body
+		id, addr := messageID.FindSubmatch(body), replyTo.FindSubmatch(body)
+		require.NotNil(t, id)
+		require.NotNil(t, addr)
+		w.WriteHeader(http.StatusAccepted)
+
+		content, ok := reply(string(id[1]))
+		if !ok {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(delay)
+			resp, err := http.Post(string(addr[1]), "text/xml", strings.NewReader(callback(string(id[1]), content)))
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+				assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+			}
+		}()
+	})
+	return srv
+}
+
+// newCallbackEndpoint serves the client as callback endpoint.
+func newCallbackEndpoint(t *testing.T, c *Client) string {
+	endpoint := httptest.NewServer(c)
+	t.Cleanup(endpoint.Close)
+	return endpoint.URL
+}
+
+func TestDo(t *testing.T) {
+	srv := newAsyncServer(t, 10*time.Millisecond, func(id string) (string, bool) {
+		return `<EchoResponse xmlns="urn:test"><Value>hello</Value></EchoResponse>`, true
+	})
+	c := New(soap.NewClient(srv.URL), Options{})
+	c.opts.ReplyTo = newCallbackEndpoint(t, c)
+
+	var resp echoResponse
+	assert.NoError(t, c.Do(context.Background(), "urn:test:Echo", &echo{Value: "hello"}, &resp))
+	assert.Equal(t, "hello", resp.Value)
+	assert.Empty(t, c.pending)
+}
+
+func TestSendConcurrent(t *testing.T) {
+	srv := newAsyncServer(t, 0, func(id string) (string, bool) {
+		return `<EchoResponse xmlns="urn:test"><Value>` + id + `</Value></EchoResponse>`, true
+	})
+	c := New(soap.NewClient(srv.URL), Options{})
+	c.opts.ReplyTo = newCallbackEndpoint(t, c)
+
+	calls := make([]*Call, 5)
+	responses := make([]echoResponse, len(calls))
+	for i := range calls {
+		var err error
+		calls[i], err = c.Send(context.Background(), "urn:test:Echo", &echo{Value: fmt.Sprint(i)}, &responses[i])
+		require.NoError(t, err)
+	}
+	for i, call := range calls {
+		<-call.Done()
+		assert.NoError(t, call.Wait(context.Background()))
+		assert.Equal(t, call.MessageID, responses[i].Value)
+	}
+}
+
+func TestFaultReply(t *testing.T) {
+	srv := newAsyncServer(t, 0, func(id string) (string, bool) {
+		return `<s:Fault><faultcode>s:Server</faultcode><faultstring>out of stock</faultstring></s:Fault>`, true
+	})
+	c := New(soap.NewClient(srv.URL), Options{})
+	c.opts.ReplyTo = newCallbackEndpoint(t, c)
+
+	var fault *soap.Fault
+	err := c.Do(context.Background(), "urn:test:Echo", &echo{}, &echoResponse{})
+	if assert.ErrorAs(t, err, &fault) {
+		assert.Equal(t, "out of stock", fault.String)
+	}
+}
+
+func TestUnmatchedCallback(t *testing.T) {
+	sent := make(chan string, 1)
+	srv := newAsyncServer(t, 0, func(id string) (string, bool) {
+		sent <- id
+		return "", false
+	})
+	unmatched := make(chan string, 1)
+	c := New(soap.NewClient(srv.URL), Options{Unmatched: func(relatesTo string, envelope []byte) {
+		assert.Contains(t, string(envelope), "late")
+		unmatched <- relatesTo
+	}})
+	c.opts.ReplyTo = newCallbackEndpoint(t, c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := c.Do(ctx, "urn:test:Echo", &echo{}, &echoResponse{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// the reply arriving after the call gave up
+	id := <-sent
+	resp, err := http.Post(c.opts.ReplyTo, "text/xml", strings.NewReader(callback(id, `<late/>`)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Equal(t, id, <-unmatched)
+
+	resp, err = http.Post(c.opts.ReplyTo, "text/xml", strings.NewReader(`<not xml`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestImmediateReply(t *testing.T) {
+	srv := soaptest.NewServer(t)
+	srv.Respond("urn:test:Echo", `<EchoResponse xmlns="urn:test"><Value>now</Value></EchoResponse>`)
+	c := New(soap.NewClient(srv.URL), Options{ReplyTo: "http://localhost/unused"})
+
+	var resp echoResponse
+	assert.NoError(t, c.Do(context.Background(), "urn:test:Echo", &echo{}, &resp))
+	assert.Equal(t, "now", resp.Value)
+	assert.True(t, bytes.Contains(srv.Requests()[0].Body, []byte("http://localhost/unused")))
+}
+
+func TestServeAndClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := newAsyncServer(t, 0, func(id string) (string, bool) { return "", false })
+	c := New(soap.NewClient(srv.URL), Options{ReplyTo: "http://" + l.Addr().String()})
+	served := make(chan error, 1)
+	go func() { served <- c.Serve(l) }()
+	// wait for the endpoint to serve
+	require.Eventually(t, func() bool {
+		resp, err := http.Get(c.opts.ReplyTo)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusMethodNotAllowed
+	}, time.Second, time.Millisecond)
+
+	call, err := c.Send(context.Background(), "urn:test:Echo", &echo{}, &echoResponse{})
+	require.NoError(t, err)
+	assert.NoError(t, c.Close())
+	assert.ErrorIs(t, call.Wait(context.Background()), ErrClosed)
+	assert.ErrorIs(t, <-served, http.ErrServerClosed)
+
+	_, err = c.Send(context.Background(), "urn:test:Echo", &echo{}, &echoResponse{})
+	assert.ErrorIs(t, err, ErrClosed)
+}
@@ -0,0 +1,251 @@
+package soap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Implements the spilling of large attachments of multipart responses to an attachment store, so MTOM
+// responses carrying files of gigabytes are not held in memory. The stored content is owned by the
+// Attachments handle of the call and removed by its Close method, or right away if decoding fails.
+
+var (
+	// ErrAttachmentNotFound is returned by an AttachmentStore if it holds no content for a Content-ID.
+	ErrAttachmentNotFound = errors.New("attachment not found")
+)
+
+// AttachmentStore keeps the content of received attachments by their Content-ID.
+type AttachmentStore interface {
+	// Create returns the writer storing the content of the attachment contentID.
+	Create(contentID string) (io.WriteCloser, error)
+	// Open returns the stored content of the attachment contentID.
+	Open(contentID string) (io.ReadCloser, error)
+	// Remove deletes the stored content of the attachment contentID.
+	Remove(contentID string) error
+}
+
+// Attachments is the handle of the attachments of responses spilled to an AttachmentStore, see
+// WithAttachmentStore. Close removes the stored content once the attachments are no longer needed.
+type Attachments struct {
+	store     AttachmentStore
+	threshold int64
+
+	mu  sync.Mutex
+	ids []string
+}
+
+// NewAttachments returns a handle spilling attachments larger than threshold bytes to store. The store
+// should not be shared with other handles, as Content-IDs are only unique within a response.
+func NewAttachments(store AttachmentStore, threshold int64) *Attachments {
+	return &Attachments{store: store, threshold: threshold}
+}
+
+// WithAttachmentStore spills the Attachment values of multipart responses larger than the threshold of
+// attachments to its store. Their Data is nil then, the content is read with Attachment.Open.
+// []byte fields are always read into memory.
+func WithAttachmentStore(attachments *Attachments) Option {
+	return func(s *settings) error {
+		s.attachments = attachments
+		return nil
+	}
+}
+
+// ContentIDs returns the Content-IDs of the stored attachments.
+func (a *Attachments) ContentIDs() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.ids...)
+}
+
+// Close removes the content of all stored attachments.
+func (a *Attachments) Close() error {
+	return a.removeFrom(0)
+}
+
+// mark returns the position to remove the attachments stored afterwards from, see removeFrom.
+func (a *Attachments) mark() int {
+	if a == nil {
+		return 0
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.ids)
+}
+
+// removeFrom removes the attachments stored since mark.
+func (a *Attachments) removeFrom(mark int) error {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	ids := a.ids[mark:]
+	a.ids = a.ids[:mark:mark]
+	a.mu.Unlock()
+	var errs []error
+	for _, id := range ids {
+		if err := a.store.Remove(id); err != nil && !errors.Is(err, ErrAttachmentNotFound) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// receive reads the content of the attachment from r, spilling it to the store if larger than the threshold.
+func (a *Attachments) receive(att *Attachment, r io.Reader) error {
+	if a == nil {
+		data, err := io.ReadAll(r)
+		att.Data, att.Size = data, int64(len(data))
+		return err
+	}
+	head, err := io.ReadAll(io.LimitReader(r, a.threshold+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(head)) <= a.threshold {
+		att.Data, att.Size = head, int64(len(head))
+		return nil
+	}
+
+	w, err := a.store.Create(att.ContentID)
+	if err != nil {
+		return err
+	}
+	// recorded before writing, so the content is removed if reading the part fails
+	a.mu.Lock()
+	a.ids = append(a.ids, att.ContentID)
+	a.mu.Unlock()
+	n, err := io.Copy(w, io.MultiReader(bytes.NewReader(head), r))
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	att.Data = nil
+	att.Size = n
+	att.store = a.store
+	return nil
+}
+
+// Stored reports whether the content of the attachment was spilled to an attachment store, Data is nil then.
+func (a Attachment) Stored() bool {
+	return a.store != nil
+}
+
+// Open returns the content of the attachment, read from the attachment store if it was spilled.
+func (a Attachment) Open() (io.ReadCloser, error) {
+	if a.store != nil {
+		return a.store.Open(a.ContentID)
+	}
+	return io.NopCloser(bytes.NewReader(a.Data)), nil
+}
+
+// MemoryStore is an AttachmentStore holding the content in memory. It is safe for concurrent use.
+type MemoryStore struct {
+	mu      sync.Mutex
+	content map[string][]byte
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{content: map[string][]byte{}}
+}
+
+// Create returns the writer storing the content once closed.
+func (s *MemoryStore) Create(contentID string) (io.WriteCloser, error) {
+	return &memoryWriter{store: s, id: contentID}, nil
+}
+
+// Open returns the stored content.
+func (s *MemoryStore) Open(contentID string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.content[contentID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAttachmentNotFound, contentID)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Remove deletes the stored content.
+func (s *MemoryStore) Remove(contentID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.content, contentID)
+	return nil
+}
+
+type memoryWriter struct {
+	bytes.Buffer
+	store *MemoryStore
+	id    string
+}
+
+func (w *memoryWriter) Close() error {
+	w.store.mu.Lock()
+	defer w.store.mu.Unlock()
+	w.store.content[w.id] = w.Bytes()
+	return nil
+}
+
+// TempFileStore is an AttachmentStore writing the content to temporary files. It is safe for concurrent use.
+type TempFileStore struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]string
+}
+
+// NewTempFileStore returns a TempFileStore creating the files in dir, the default directory for temporary
+// files if empty.
+func NewTempFileStore(dir string) *TempFileStore {
+	return &TempFileStore{dir: dir, files: map[string]string{}}
+}
+
+// Create creates a temporary file for the content.
+func (s *TempFileStore) Create(contentID string) (io.WriteCloser, error) {
+	f, err := os.CreateTemp(s.dir, "soap-attachment-*")
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if previous, ok := s.files[contentID]; ok {
+		_ = os.Remove(previous)
+	}
+	s.files[contentID] = f.Name()
+	return f, nil
+}
+
+// Open opens the file of the content.
+func (s *TempFileStore) Open(contentID string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	name, ok := s.files[contentID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrAttachmentNotFound, contentID)
+	}
+	return os.Open(name)
+}
+
+// Remove deletes the file of the content.
+func (s *TempFileStore) Remove(contentID string) error {
+	s.mu.Lock()
+	name, ok := s.files[contentID]
+	delete(s.files, contentID)
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return os.Remove(name)
+}
+
+// partContentID returns the Content-ID header value without angle brackets.
+func partContentID(header string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(header), "<"), ">")
+}
@@ -0,0 +1,89 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readAttachment returns the content of the attachment.
+func readAttachment(t *testing.T, a Attachment) []byte {
+	t.Helper()
+	r, err := a.Open()
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	return data
+}
+
+func TestAttachmentStore(t *testing.T) {
+	dir := t.TempDir()
+	stores := map[string]AttachmentStore{"memory": NewMemoryStore(), "temp file": NewTempFileStore(dir)}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			srv, _ := newMTOMEchoServer(t)
+			attachments := NewAttachments(store, 100)
+			req := &upload{
+				Small: Attachment{Data: bytes.Repeat([]byte{1}, 40), Mode: AttachAlways},
+				Large: Attachment{Data: bytes.Repeat([]byte{2}, 200), Mode: AttachAlways, ContentID: "large@example"},
+			}
+			resp := &upload{}
+			assert.NoError(t, NewClient(srv.URL).Do(context.Background(), "Upload", req, resp, WithMTOM(),
+				WithAttachmentStore(attachments)))
+
+			assert.False(t, resp.Small.Stored())
+			assert.Equal(t, req.Small.Data, resp.Small.Data)
+			assert.Equal(t, req.Small.Data, readAttachment(t, resp.Small))
+
+			assert.True(t, resp.Large.Stored())
+			assert.Nil(t, resp.Large.Data)
+			assert.Equal(t, int64(200), resp.Large.Size)
+			assert.Equal(t, req.Large.Data, readAttachment(t, resp.Large))
+			assert.Equal(t, []string{"large@example"}, attachments.ContentIDs())
+
+			assert.NoError(t, attachments.Close())
+			_, err := resp.Large.Open()
+			assert.ErrorIs(t, err, ErrAttachmentNotFound)
+			assert.Empty(t, attachments.ContentIDs())
+		})
+	}
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestAttachmentStoreDecodeFailure(t *testing.T) {
+	echo, _ := newMTOMEchoServer(t)
+	// the response breaks off within the attachment
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := http.Post(echo.URL, r.Header.Get("Content-Type"), r.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		_, _ = w.Write(body[:bytes.LastIndexByte(body, 2)-50])
+	}))
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	attachments := NewAttachments(NewTempFileStore(dir), 10)
+	req := &upload{Large: Attachment{Data: bytes.Repeat([]byte{2}, 200), Mode: AttachAlways}}
+	err := NewClient(srv.URL).Do(context.Background(), "Upload", req, &upload{}, WithMTOM(), WithAttachmentStore(attachments))
+	assert.Error(t, err)
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+	assert.Empty(t, attachments.ContentIDs())
+}
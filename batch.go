@@ -0,0 +1,142 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrBatchAborted is the error of the items of a fail-fast batch that were not completed because another
+	// item failed.
+	ErrBatchAborted = errors.New("batch aborted")
+)
+
+// BatchItem is a call of a batch.
+type BatchItem struct {
+	Action  string
+	Request any
+	// NewResponse returns the value the response is decoded into. If nil, the response body is discarded.
+	NewResponse func() any
+	// Options apply to this call only, on top of the options of the client and the batch.
+	Options []Option
+}
+
+// BatchResult is the outcome of a BatchItem.
+type BatchResult struct {
+	// Response is the value returned by NewResponse, with the response decoded into it.
+	Response any
+	Err      error
+	// Attempts is the number of attempts made, zero if the call was never started.
+	Attempts int
+	// Duration is the time the call took including all retries.
+	Duration time.Duration
+}
+
+// BatchOption configures a batch.
+type BatchOption func(*batchSettings)
+
+type batchSettings struct {
+	parallelism int
+	failFast    bool
+	options     []Option
+}
+
+// BatchParallelism sets the maximum number of calls in flight, 8 by default.
+func BatchParallelism(n int) BatchOption {
+	return func(s *batchSettings) {
+		if n > 0 {
+			s.parallelism = n
+		}
+	}
+}
+
+// BatchFailFast stops the batch at the first failed call. The calls in flight are canceled, they and the
+// calls not started yet fail with ErrBatchAborted. Otherwise all calls are made and their errors collected.
+func BatchFailFast() BatchOption {
+	return func(s *batchSettings) {
+		s.failFast = true
+	}
+}
+
+// BatchRetry retries every call of the batch with policy, unless overridden in the options of an item.
+func BatchRetry(policy RetryPolicy) BatchOption {
+	return BatchOptions(WithRetry(policy))
+}
+
+// BatchOptions applies opts to every call of the batch.
+func BatchOptions(opts ...Option) BatchOption {
+	return func(s *batchSettings) {
+		s.options = append(s.options, opts...)
+	}
+}
+
+// Batch makes the calls of items with client, with bounded parallelism. The results are in the order of the
+// items. Once ctx is done, the calls in flight are canceled and the calls not started yet fail with the error
+// of ctx. A rate limiter configured with WithRateLimiter paces the calls across all workers.
+func Batch(ctx context.Context, client *Client, items []BatchItem, opts ...BatchOption) []BatchResult {
+	s := batchSettings{parallelism: 8}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	results := make([]BatchResult, len(items))
+	batchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(s.parallelism, len(items)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = client.batchCall(batchCtx, items[i], s.options)
+				if results[i].Err != nil && s.failFast {
+					cancel()
+				}
+			}
+		}()
+	}
+	dispatched := 0
+dispatch:
+	for ; dispatched < len(items); dispatched++ {
+		select {
+		case next <- dispatched:
+		case <-batchCtx.Done():
+			break dispatch
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	for i := range results {
+		canceled := i >= dispatched || errors.Is(results[i].Err, context.Canceled)
+		switch {
+		case !canceled:
+		case ctx.Err() != nil:
+			results[i].Err = ctx.Err()
+		case batchCtx.Err() != nil:
+			// canceled after another item failed
+			results[i].Err = ErrBatchAborted
+		}
+	}
+	return results
+}
+
+// batchCall makes the call of a batch item.
+func (c *Client) batchCall(ctx context.Context, item BatchItem, batchOpts []Option) BatchResult {
+	var result BatchResult
+	// the body of responses without response value is read, but not decoded
+	response := any(new(RawXML))
+	if item.NewResponse != nil {
+		result.Response = item.NewResponse()
+		response = result.Response
+	}
+	var info ResponseInfo
+	opts := append(append(append([]Option(nil), batchOpts...), item.Options...), WithResponseInfo(&info))
+	result.Err = c.Do(ctx, item.Action, item.Request, response, opts...)
+	result.Attempts = info.Attempt
+	result.Duration = info.Duration
+	return result
+}
@@ -0,0 +1,181 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+)
+
+type batchRequest struct {
+	XMLName xml.Name `xml:"urn:test Square"`
+	N       int      `xml:"N"`
+}
+
+type batchResponse struct {
+	XMLName xml.Name `xml:"urn:test SquareResponse"`
+	N       int      `xml:"N"`
+}
+
+var batchN = regexp.MustCompile(`<[^>]*N>(-?\d+)<`)
+
+// newBatchServer squares the numbers of the requests, with a fault for negative ones. It records the
+// maximum number of concurrent requests.
+func newBatchServer(t *testing.T, delay time.Duration) (*httptest.Server, *atomic.Int32) {
+	var inFlight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for p := peak.Load(); n > p && !peak.CompareAndSwap(p, n); p = peak.Load() {
+		}
+		body, _ := io.ReadAll(r.Body)
+		v, _ := strconv.Atoi(batchN.FindStringSubmatch(string(body))[1])
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		if v < 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = fmt.Fprintf(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>`+
+				`<faultcode>soap:Client</faultcode><faultstring>negative %d</faultstring></soap:Fault></soap:Body></soap:Envelope>`, v)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<SquareResponse xmlns="urn:test"><N>%d</N></SquareResponse></soap:Body></soap:Envelope>`, v*v)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &peak
+}
+
+func batchItems(values ...int) []BatchItem {
+	items := make([]BatchItem, len(values))
+	for i, v := range values {
+		items[i] = BatchItem{Action: "Square", Request: &batchRequest{N: v}, NewResponse: func() any { return &batchResponse{} }}
+	}
+	return items
+}
+
+func TestBatch(t *testing.T) {
+	srv, peak := newBatchServer(t, 5*time.Millisecond)
+	values := make([]int, 30)
+	for i := range values {
+		values[i] = i
+	}
+	values[7] = -7
+
+	results := Batch(context.Background(), NewClient(srv.URL), batchItems(values...), BatchParallelism(3))
+	if !assert.Len(t, results, len(values)) {
+		return
+	}
+	for i, r := range results {
+		if i == 7 {
+			var fault *Fault
+			if assert.ErrorAs(t, r.Err, &fault) {
+				assert.Equal(t, "negative -7", fault.String)
+			}
+			continue
+		}
+		assert.NoError(t, r.Err)
+		assert.Equal(t, i*i, r.Response.(*batchResponse).N)
+		assert.Equal(t, 1, r.Attempts)
+		assert.Greater(t, r.Duration, time.Duration(0))
+	}
+	assert.LessOrEqual(t, peak.Load(), int32(3))
+}
+
+func TestBatchFailFast(t *testing.T) {
+	srv, _ := newBatchServer(t, 20*time.Millisecond)
+	results := Batch(context.Background(), NewClient(srv.URL), batchItems(-1, 2, 3, 4, 5, 6), BatchParallelism(2), BatchFailFast())
+	var fault *Fault
+	assert.ErrorAs(t, results[0].Err, &fault)
+	for _, r := range results[2:] {
+		assert.ErrorIs(t, r.Err, ErrBatchAborted)
+	}
+}
+
+func TestBatchCancel(t *testing.T) {
+	srv, _ := newBatchServer(t, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	results := Batch(ctx, NewClient(srv.URL), batchItems(1, 2, 3, 4, 5), BatchParallelism(2))
+	assert.Less(t, time.Since(start), 5*time.Second)
+	for _, r := range results {
+		assert.ErrorIs(t, r.Err, context.Canceled)
+	}
+	assert.Zero(t, results[4].Attempts)
+}
+
+func TestBatchRetry(t *testing.T) {
+	var mu sync.Mutex
+	calls := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		n := batchN.FindStringSubmatch(string(body))[1]
+		mu.Lock()
+		calls[n]++
+		first := calls[n] == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<SquareResponse xmlns="urn:test"><N>1</N></SquareResponse></soap:Body></soap:Envelope>`)
+	}))
+	t.Cleanup(srv.Close)
+
+	results := Batch(context.Background(), NewClient(srv.URL), batchItems(1, 2),
+		BatchRetry(RetryPolicy{MaxAttempts: 2, Backoff: func(int) time.Duration { return 0 }}), BatchOptions(MarkIdempotent("Square")))
+	for _, r := range results {
+		assert.NoError(t, r.Err)
+		assert.Equal(t, 2, r.Attempts)
+	}
+}
+
+func TestBatchWithoutResponse(t *testing.T) {
+	srv, _ := newBatchServer(t, 0)
+	items := batchItems(2)
+	items[0].NewResponse = nil
+	results := Batch(context.Background(), NewClient(srv.URL), items)
+	assert.NoError(t, results[0].Err)
+	assert.Nil(t, results[0].Response)
+	assert.False(t, errors.Is(results[0].Err, ErrBatchAborted))
+}
+
+// countingLimiter counts the attempts waiting for it.
+type countingLimiter struct {
+	waits atomic.Int32
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	l.waits.Add(1)
+	return ctx.Err()
+}
+
+func (l *countingLimiter) Pause(time.Time) {}
+
+func TestBatchRateLimiter(t *testing.T) {
+	srv, _ := newBatchServer(t, 0)
+	limiter := &countingLimiter{}
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithRateLimiter(limiter)))
+	for _, r := range Batch(context.Background(), client, batchItems(1, 2, 3, 4)) {
+		assert.NoError(t, r.Err)
+	}
+	assert.Equal(t, int32(4), limiter.waits.Load())
+}
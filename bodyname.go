@@ -0,0 +1,104 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the assertion of the name of the response body element.
+
+var (
+	// ErrUnexpectedElement is returned if the response body element does not have the expected name.
+	// The returned error is an *UnexpectedElementError.
+	ErrUnexpectedElement = errors.New("unexpected element")
+)
+
+// UnexpectedElementError reports a response body element, or a response document that is no envelope at all,
+// not matching the expected body element.
+type UnexpectedElementError struct {
+	Expected xml.Name
+	Got      xml.Name
+}
+
+func (e *UnexpectedElementError) Error() string {
+	return fmt.Sprintf("expected %s, got %s", qualifiedName(e.Expected), qualifiedName(e.Got))
+}
+
+func (e *UnexpectedElementError) Unwrap() error {
+	return ErrUnexpectedElement
+}
+
+// qualifiedName renders name as {namespace}local.
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return `{""}` + name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
+
+// ExpectBodyElement makes a call fail with *UnexpectedElementError if the first response body element is not
+// named name. An empty name space matches any namespace. Faults are not affected.
+func ExpectBodyElement(name xml.Name) Option {
+	return func(s *settings) error {
+		s.expectBodyElement = &name
+		return nil
+	}
+}
+
+// AssertBodyElement is ExpectBodyElement with the name taken from the XMLName tag of the response struct.
+// Responses without an XMLName tag are not checked.
+func AssertBodyElement() Option {
+	return func(s *settings) error {
+		s.assertBodyElement = true
+		return nil
+	}
+}
+
+// expectedBodyElement returns the name the first body element of the response must have, or nil.
+func (s *settings) expectedBodyElement(response any) *xml.Name {
+	if s.expectBodyElement != nil {
+		return s.expectBodyElement
+	}
+	if !s.assertBodyElement {
+		return nil
+	}
+	if list, ok := response.([]any); ok {
+		if len(list) == 0 {
+			return nil
+		}
+		response = list[0]
+	}
+	return taggedXMLName(response)
+}
+
+// taggedXMLName returns the name in the XMLName tag of the struct v points to, or nil.
+func taggedXMLName(v any) *xml.Name {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	field, ok := t.FieldByName(xmlName)
+	if !ok || field.Type != reflect.TypeOf(xml.Name{}) {
+		return nil
+	}
+	parts := strings.Fields(strings.Split(field.Tag.Get("xml"), ",")[0])
+	switch len(parts) {
+	case 1:
+		return &xml.Name{Local: parts[0]}
+	case 2:
+		return &xml.Name{Space: parts[0], Local: parts[1]}
+	}
+	return nil
+}
+
+// matchName reports whether got matches the expected name, an empty expected namespace matches any.
+func matchName(expected xml.Name, got xml.Name) bool {
+	return expected.Local == got.Local && (expected.Space == "" || expected.Space == got.Space)
+}
@@ -0,0 +1,62 @@
+package soap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type untaggedResponse struct {
+	Items []string `xml:"Item"`
+}
+
+func TestAssertBodyElement(t *testing.T) {
+	const otherBody = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body><Other xmlns="urn:other"><Item>a</Item></Other></soap:Body>
+</soap:Envelope>`
+	const loginPage = `<html><body><form action="/login"></form></body></html>`
+	const faultBody = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>boom</faultstring></soap:Fault></soap:Body>
+</soap:Envelope>`
+
+	tests := []struct {
+		name     string
+		body     string
+		response any
+		opts     []Option
+		err      string
+	}{
+		{name: "match", body: infoResponseBody, response: &infoResponse{}, opts: []Option{AssertBodyElement()}},
+		{name: "other element", body: otherBody, response: &infoResponse{}, opts: []Option{AssertBodyElement()},
+			err: "expected {urn:test}GetInfoResponse, got {urn:other}Other"},
+		{name: "no envelope", body: loginPage, response: &infoResponse{}, opts: []Option{AssertBodyElement()},
+			err: "endpoint returned an HTML page instead of a SOAP envelope — is the URL the service address?"},
+		{name: "untagged response", body: otherBody, response: &untaggedResponse{}, opts: []Option{AssertBodyElement()}},
+		{name: "explicit", body: otherBody, response: &untaggedResponse{},
+			opts: []Option{ExpectBodyElement(xml.Name{Space: "urn:test", Local: "GetInfoResponse"})},
+			err:  "expected {urn:test}GetInfoResponse, got {urn:other}Other"},
+		{name: "explicit any namespace", body: otherBody, response: &untaggedResponse{},
+			opts: []Option{ExpectBodyElement(xml.Name{Local: "Other"})}},
+		{name: "fault", body: faultBody, response: &infoResponse{}, opts: []Option{AssertBodyElement()},
+			err: "soap fault: soap:Server (boom)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInfoServer(t, "text/xml", tt.body)
+			err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, tt.response, tt.opts...)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+			if tt.name != "fault" {
+				assert.ErrorIs(t, err, ErrUnexpectedElement)
+			}
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package soap
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Implements Exclusive XML Canonicalization without comments (https://www.w3.org/TR/xml-exc-c14n/).
+// It is used to verify signatures over elements of received envelopes, which are not canonical in general.
+
+// Canonicalize returns the exclusive canonical form (without comments) of the document element of data.
+func Canonicalize(data []byte) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+	if doc.Root() == nil {
+		return nil, ErrEnvelopeMisconfigured
+	}
+	return canonicalize(doc.Root()), nil
+}
+
+// canonicalize returns the exclusive canonical form of the subtree rooted at el. Namespaces declared
+// on ancestors of el are taken into account. The namespaces of the inclusive prefixes, "" for the default
+// namespace, are rendered as by inclusive canonicalization, that is also where they are not visibly utilized.
+func canonicalize(el *etree.Element, inclusive ...string) []byte {
+	var buf bytes.Buffer
+	writeCanonical(&buf, el, map[string]string{}, inclusive)
+	return buf.Bytes()
+}
+
+// inclusivePrefixes returns the prefixes of the InclusiveNamespaces PrefixList parameter of the
+// canonicalization method or transform el.
+func inclusivePrefixes(el *etree.Element) []string {
+	ns := childElement(el, canonicalizationExclusiveC14N, "InclusiveNamespaces")
+	if ns == nil {
+		return nil
+	}
+	prefixes := strings.Fields(ns.SelectAttrValue("PrefixList", ""))
+	for i, p := range prefixes {
+		if p == "#default" {
+			prefixes[i] = ""
+		}
+	}
+	return prefixes
+}
+
+func writeCanonical(buf *bytes.Buffer, el *etree.Element, rendered map[string]string, inclusive []string) {
+	// namespaces are rendered where they are visibly utilized by the element name or an attribute
+	used := append([]string{el.Space}, inclusive...)
+	var attrs []etree.Attr
+	for _, a := range el.Attr {
+		if a.Space == "xmlns" || (a.Space == "" && a.Key == "xmlns") {
+			continue
+		}
+		attrs = append(attrs, a)
+		if a.Space != "" {
+			used = append(used, a.Space)
+		}
+	}
+
+	scope := rendered
+	var decls []string
+	for _, prefix := range used {
+		if prefix == "xml" {
+			continue
+		}
+		uri := lookupNamespace(el, prefix)
+		if current, ok := scope[prefix]; ok && current == uri || !ok && uri == "" {
+			continue
+		}
+		if len(decls) == 0 {
+			scope = make(map[string]string, len(rendered)+1)
+			for p, u := range rendered {
+				scope[p] = u
+			}
+		}
+		scope[prefix] = uri
+		decls = append(decls, prefix)
+	}
+	sort.Strings(decls)
+
+	sort.SliceStable(attrs, func(i, j int) bool {
+		ui, uj := attrNamespace(el, attrs[i]), attrNamespace(el, attrs[j])
+		if ui != uj {
+			return ui < uj
+		}
+		return attrs[i].Key < attrs[j].Key
+	})
+
+	buf.WriteString("<" + el.FullTag())
+	for _, prefix := range decls {
+		if prefix == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(" xmlns:" + prefix + `="`)
+		}
+		buf.WriteString(escapeCanonicalAttr(scope[prefix]) + `"`)
+	}
+	for _, a := range attrs {
+		buf.WriteString(" " + a.FullKey() + `="` + escapeCanonicalAttr(a.Value) + `"`)
+	}
+	buf.WriteByte('>')
+
+	for _, token := range el.Child {
+		switch t := token.(type) {
+		case *etree.Element:
+			writeCanonical(buf, t, scope, inclusive)
+		case *etree.CharData:
+			buf.WriteString(escapeCanonicalText(t.Data))
+		case *etree.ProcInst:
+			buf.WriteString("<?" + t.Target)
+			if t.Inst != "" {
+				buf.WriteString(" " + t.Inst)
+			}
+			buf.WriteString("?>")
+		}
+	}
+	buf.WriteString("</" + el.FullTag() + ">")
+}
+
+// lookupNamespace returns the namespace bound to prefix in scope of el, the empty prefix is the default namespace.
+func lookupNamespace(el *etree.Element, prefix string) string {
+	for e := el; e != nil; e = e.Parent() {
+		for _, a := range e.Attr {
+			if prefix == "" && a.Space == "" && a.Key == "xmlns" || prefix != "" && a.Space == "xmlns" && a.Key == prefix {
+				return a.Value
+			}
+		}
+	}
+	return ""
+}
+
+func attrNamespace(el *etree.Element, a etree.Attr) string {
+	switch a.Space {
+	case "":
+		return ""
+	case "xml":
+		return xmlNS
+	}
+	return lookupNamespace(el, a.Space)
+}
+
+var canonicalAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+var canonicalTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+
+func escapeCanonicalAttr(s string) string {
+	return canonicalAttrEscaper.Replace(s)
+}
+
+func escapeCanonicalText(s string) string {
+	return canonicalTextEscaper.Replace(s)
+}
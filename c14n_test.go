@@ -0,0 +1,74 @@
+package soap
+
+import (
+	"testing"
+
+	"github.com/beevik/etree"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{
+			name: "unused namespaces dropped and attributes sorted",
+			in:   `<a:Root xmlns:b="urn:b" xmlns:a="urn:a" z="1" b:y="2" a="3"/>`,
+			out:  `<a:Root xmlns:a="urn:a" xmlns:b="urn:b" a="3" z="1" b:y="2"></a:Root>`,
+		},
+		{
+			name: "namespaces rendered where utilized",
+			in:   `<Root xmlns="urn:d" xmlns:x="urn:x"><Child><x:Leaf>t</x:Leaf></Child></Root>`,
+			out:  `<Root xmlns="urn:d"><Child><x:Leaf xmlns:x="urn:x">t</x:Leaf></Child></Root>`,
+		},
+		{
+			name: "default namespace undeclared",
+			in:   `<Root xmlns="urn:d"><Child xmlns=""/></Root>`,
+			out:  `<Root xmlns="urn:d"><Child xmlns=""></Child></Root>`,
+		},
+		{
+			name: "escaping and comments",
+			in:   "<Root a='&quot;&#9;'><!-- c -->1 &lt; 2 &gt; 0 &amp;<![CDATA[<x>]]></Root>",
+			out:  `<Root a="&quot;&#x9;">1 &lt; 2 &gt; 0 &amp;&lt;x&gt;</Root>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Canonicalize([]byte(tt.in))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.out, string(out))
+		})
+	}
+}
+
+func TestCanonicalizeSubtree(t *testing.T) {
+	doc := etree.NewDocument()
+	assert.NoError(t, doc.ReadFromString(`<s:Envelope xmlns:s="urn:s" xmlns:u="urn:u"><s:Body u:Id="b"><x/></s:Body></s:Envelope>`))
+	body := doc.Root().ChildElements()[0]
+	assert.Equal(t, `<s:Body xmlns:s="urn:s" xmlns:u="urn:u" u:Id="b"><x></x></s:Body>`, string(canonicalize(body)))
+}
+
+func TestCanonicalizeInclusivePrefixes(t *testing.T) {
+	// t is declared on an ancestor and only used in an attribute value
+	doc := etree.NewDocument()
+	assert.NoError(t, doc.ReadFromString(`<s:Envelope xmlns:s="urn:s" xmlns:t="urn:t" xmlns:xsi="urn:xsi" xmlns="urn:d">`+
+		`<s:Body><Item xsi:type="t:Book"><t:Sku>1</t:Sku></Item></s:Body></s:Envelope>`))
+	body := doc.Root().ChildElements()[0]
+
+	assert.Equal(t, `<s:Body xmlns:s="urn:s"><Item xmlns="urn:d" xmlns:xsi="urn:xsi" xsi:type="t:Book">`+
+		`<t:Sku xmlns:t="urn:t">1</t:Sku></Item></s:Body>`, string(canonicalize(body)))
+	assert.Equal(t, `<s:Body xmlns="urn:d" xmlns:s="urn:s" xmlns:t="urn:t"><Item xmlns:xsi="urn:xsi" xsi:type="t:Book">`+
+		`<t:Sku>1</t:Sku></Item></s:Body>`, string(canonicalize(body, "t", "", "undeclared")))
+}
+
+func TestInclusivePrefixes(t *testing.T) {
+	doc := etree.NewDocument()
+	assert.NoError(t, doc.ReadFromString(`<Transform xmlns:ec="http://www.w3.org/2001/10/xml-exc-c14n#">`+
+		`<ec:InclusiveNamespaces PrefixList=" soapenv  #default xsi"/></Transform>`))
+	assert.Equal(t, []string{"soapenv", "", "xsi"}, inclusivePrefixes(doc.Root()))
+
+	assert.Nil(t, inclusivePrefixes(etree.NewElement("Transform")))
+}
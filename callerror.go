@@ -0,0 +1,106 @@
+package soap
+
+import (
+	"errors"
+	"net/http"
+)
+
+// CallError is returned by Client.Do for failed calls. It wraps the error of the call with the context of
+// the last attempt: the fault, the HTTP status and the errors decoding or receiving the response, as far as
+// the attempt got. They are all in the chain of the error, so errors.Is and errors.As find the faults and
+// *HTTPError of fault responses with an error status, and the faults partially decoded from error responses.
+// The message of a CallError is the one of Err.
+type CallError struct {
+	Action string
+	// Endpoint is the URL of the call, with passwords redacted.
+	Endpoint string
+	// Attempts is the number of attempts made, 0 if the call failed before its first attempt.
+	Attempts int
+	// Err is the error the call failed with.
+	Err error
+
+	statusCode int
+	header     http.Header
+	fault      *Fault
+	http       *HTTPError
+	decode     error
+	transport  error
+}
+
+// newCallError returns the error of the call cl failing with err, nil if err is nil.
+func newCallError(cl *call, err error) error {
+	if err == nil {
+		return nil
+	}
+	e := &CallError{Action: cl.action, Endpoint: redactURL(cl.url), Attempts: cl.attempt, Err: err,
+		transport: cl.transportErr}
+	errors.As(err, &e.fault)
+	errors.As(err, &e.http)
+	if r := cl.last; r != nil {
+		e.statusCode, e.header, e.decode = r.StatusCode, r.Header, r.decodeErr
+		if e.fault == nil {
+			e.fault = r.partialFault
+		}
+		if e.http == nil && (r.StatusCode < 200 || r.StatusCode > 299) {
+			e.http = newHTTPError(r.Response, r.attempt, nil)
+		}
+	}
+	if e.transport == nil && e.http != nil {
+		e.transport = e.http.Err
+	}
+	return e
+}
+
+func (e *CallError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns Err followed by the fault, the *HTTPError and the decode and transport errors of the call
+// not in the chain of Err.
+func (e *CallError) Unwrap() []error {
+	errs := []error{e.Err}
+	if e.fault != nil && ExtractFault(e.Err) == nil {
+		errs = append(errs, e.fault)
+	}
+	var httpErr *HTTPError
+	if e.http != nil && !errors.As(e.Err, &httpErr) {
+		errs = append(errs, e.http)
+	}
+	for _, err := range []error{e.decode, e.transport} {
+		if err != nil && !errors.Is(e.Err, err) {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Fault returns the fault the server answered with, possibly partially decoded from an error response, or nil.
+func (e *CallError) Fault() *Fault {
+	return e.fault
+}
+
+// HTTPError returns the error of the HTTP status of a response with a non-2xx status, also if it held a
+// fault, or nil.
+func (e *CallError) HTTPError() *HTTPError {
+	return e.http
+}
+
+// StatusCode returns the HTTP status code of the last response, 0 if none was received.
+func (e *CallError) StatusCode() int {
+	return e.statusCode
+}
+
+// Header returns the HTTP headers of the last response, nil if none was received.
+func (e *CallError) Header() http.Header {
+	return e.header
+}
+
+// DecodeError returns the error decoding the last response, nil if it was decoded.
+func (e *CallError) DecodeError() error {
+	return e.decode
+}
+
+// TransportError returns the error sending the last request or reading its response, nil if there is none.
+func (e *CallError) TransportError() error {
+	return e.transport
+}
@@ -0,0 +1,177 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const callFaultXML = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+	`<faultcode>soap:Server</faultcode><faultstring>Database down</faultstring></soap:Fault></soap:Body></soap:Envelope>`
+
+// newStatusServer answers with the status, content type and body.
+func newStatusServer(t *testing.T, status int, contentType, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Request-Id", "r-1")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCallError(t *testing.T) {
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	tests := []struct {
+		name    string
+		url     string
+		options []Option
+		// message is the message of the error, the one of the error wrapped
+		message   string
+		status    int
+		fault     string
+		http      bool
+		decode    bool
+		transport bool
+		attempts  int
+		// match checks the errors callers looked for before calls returned a *CallError
+		match func(t *testing.T, err error)
+	}{
+		{
+			name: "fault", url: newStatusServer(t, http.StatusInternalServerError, "text/xml", callFaultXML).URL,
+			message: "soap fault: soap:Server (Database down)", status: 500, fault: "soap:Server", http: true, attempts: 1,
+			match: func(t *testing.T, err error) {
+				var fault *Fault
+				assert.ErrorAs(t, err, &fault)
+				assert.Equal(t, "Database down", ExtractFault(err).String)
+			},
+		},
+		{
+			name: "fault with success status", url: newStatusServer(t, http.StatusOK, "text/xml", callFaultXML).URL,
+			message: "soap fault: soap:Server (Database down)", status: 200, fault: "soap:Server", attempts: 1,
+			match: func(t *testing.T, err error) {
+				var httpErr *HTTPError
+				assert.False(t, errors.As(err, &httpErr))
+			},
+		},
+		{
+			name: "http error", url: newStatusServer(t, http.StatusServiceUnavailable, "text/plain", "maintenance").URL,
+			status: 503, http: true, decode: true, attempts: 1,
+			match: func(t *testing.T, err error) {
+				var httpErr *HTTPError
+				if assert.ErrorAs(t, err, &httpErr) {
+					assert.True(t, httpErr.Temporary())
+				}
+				assert.ErrorIs(t, err, ErrGatewayResponse)
+			},
+		},
+		{
+			name: "truncated fault", url: newStatusServer(t, http.StatusInternalServerError, "text/xml", callFaultXML[:200]).URL,
+			status: 500, fault: "soap:Server", http: true, decode: true, attempts: 1,
+			match: func(t *testing.T, err error) {
+				var httpErr *HTTPError
+				assert.ErrorAs(t, err, &httpErr)
+				var syntaxErr *xml.SyntaxError
+				assert.ErrorAs(t, err, &syntaxErr)
+			},
+		},
+		{
+			name: "decode error", url: newStatusServer(t, http.StatusOK, "text/xml", "<soap:Envelope").URL,
+			status: 200, decode: true, attempts: 1,
+			match: func(t *testing.T, err error) {
+				var syntaxErr *xml.SyntaxError
+				assert.ErrorAs(t, err, &syntaxErr)
+			},
+		},
+		{
+			name: "transport error", url: closed.URL, transport: true, attempts: 1,
+			match: func(t *testing.T, err error) {
+				var urlErr *url.Error
+				assert.ErrorAs(t, err, &urlErr)
+			},
+		},
+		{
+			name: "retried", url: newStatusServer(t, http.StatusServiceUnavailable, "text/plain", "maintenance").URL,
+			options: []Option{WithRetry(fastRetry), MarkIdempotent("GetInfo")}, status: 503, http: true, decode: true,
+			attempts: 3,
+			match: func(t *testing.T, err error) {
+				var httpErr *HTTPError
+				if assert.ErrorAs(t, err, &httpErr) {
+					assert.Equal(t, 3, httpErr.Attempt)
+				}
+			},
+		},
+		{
+			name: "before the first attempt", url: "http://example.com/{tenant}/soap",
+			message: "unresolved placeholders in endpoint URL: tenant",
+			match: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrUnresolvedURLVars)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewClient(tt.url).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, tt.options...)
+			var callErr *CallError
+			require.ErrorAs(t, err, &callErr)
+			assert.Equal(t, "GetInfo", callErr.Action)
+			assert.Equal(t, callErr.Err.Error(), err.Error())
+			if tt.message != "" {
+				assert.Equal(t, tt.message, err.Error())
+			}
+			assert.Equal(t, tt.attempts, callErr.Attempts)
+			assert.Equal(t, tt.status, callErr.StatusCode())
+			if tt.status != 0 {
+				assert.Equal(t, "r-1", callErr.Header().Get("X-Request-Id"))
+			}
+			if tt.fault != "" {
+				if assert.NotNil(t, callErr.Fault()) {
+					assert.Equal(t, tt.fault, callErr.Fault().Code)
+				}
+				assert.Same(t, callErr.Fault(), ExtractFault(err))
+			} else {
+				assert.Nil(t, callErr.Fault())
+				assert.Nil(t, ExtractFault(err))
+			}
+			if tt.http {
+				if assert.NotNil(t, callErr.HTTPError()) {
+					assert.Equal(t, tt.status, callErr.HTTPError().StatusCode)
+					assert.Equal(t, tt.url, callErr.HTTPError().URL)
+				}
+				var httpErr *HTTPError
+				require.ErrorAs(t, err, &httpErr)
+				assert.Same(t, callErr.HTTPError(), httpErr)
+			} else {
+				assert.Nil(t, callErr.HTTPError())
+			}
+			assert.Equal(t, tt.decode, callErr.DecodeError() != nil)
+			if callErr.DecodeError() != nil {
+				assert.ErrorIs(t, err, callErr.DecodeError())
+			}
+			assert.Equal(t, tt.transport, callErr.TransportError() != nil)
+			tt.match(t, err)
+		})
+	}
+}
+
+func TestCallErrorRedactsEndpoint(t *testing.T) {
+	srv := newStatusServer(t, http.StatusInternalServerError, "text/xml", callFaultXML)
+	u, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	u.User = url.UserPassword("user", "secret")
+	err = NewClient(u.String()).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	var callErr *CallError
+	require.ErrorAs(t, err, &callErr)
+	assert.NotContains(t, callErr.Endpoint, "secret")
+	assert.NotContains(t, callErr.HTTPError().URL, "secret")
+}
@@ -0,0 +1,228 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrCircuitOpen is returned without sending the request if the circuit breaker of the client is open.
+	ErrCircuitOpen = errors.New("circuit breaker open")
+)
+
+// CircuitBreaker lets attempts through while the service is healthy, see WithCircuitBreaker.
+type CircuitBreaker interface {
+	// Allow is called before every attempt. It returns an error if the attempt must not be made, otherwise
+	// done, which is called with the outcome of the attempt once it finished.
+	Allow() (done func(success bool), err error)
+}
+
+// CircuitState is the state of a circuit breaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets all attempts through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects all attempts.
+	CircuitOpen
+	// CircuitHalfOpen lets probe attempts through to find out whether the service recovered.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// WithCircuitBreaker asks cb before every attempt, including retries, and fails the call with ErrCircuitOpen
+// if it rejects the attempt, before the rate limiter is waited for and the request is encoded. Attempts fail
+// in the sense of the breaker on network errors, timeouts, HTTP 429 and 5xx responses and retryable or
+// throttled faults; those answered by the service otherwise succeed, as do attempts canceled by the caller and
+// requests failing to encode. Share cb between the clients of a service to protect it from all of them.
+//
+// Calls rejected by the breaker are reported to the RetryObserver with RetryReasonCircuitOpen. If cb has a
+// State() CircuitState method, like *ConsecutiveBreaker, ResponseInfo.CircuitState holds its state after the
+// call.
+func WithCircuitBreaker(cb CircuitBreaker) Option {
+	return func(s *settings) error {
+		s.circuitBreaker = cb
+		return nil
+	}
+}
+
+// allowAttempt asks the circuit breaker for the current attempt. The returned function reports the error of
+// the attempt.
+func (s *settings) allowAttempt() (func(err error), error) {
+	if s.circuitBreaker == nil {
+		return func(error) {}, nil
+	}
+	done, err := s.circuitBreaker.Allow()
+	if err != nil {
+		if !errors.Is(err, ErrCircuitOpen) {
+			err = fmt.Errorf("%w: %w", ErrCircuitOpen, err)
+		}
+		return nil, err
+	}
+	return func(err error) { done(!s.serviceFailure(err)) }, nil
+}
+
+// circuitOpen reports whether the circuit breaker is known to reject attempts without asking it for one, which
+// only breakers with a State method tell.
+func (s *settings) circuitOpen() bool {
+	sb, ok := s.circuitBreaker.(interface{ State() CircuitState })
+	return ok && sb.State() == CircuitOpen
+}
+
+// serviceFailure reports whether err, the error of an attempt, points at a service in trouble.
+func (s *settings) serviceFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	if class, ok := s.faultClass(err); ok {
+		return class == FaultRetryable || class == FaultThrottled
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || requestNotSent(err)
+}
+
+// circuitState records the state of the circuit breaker in the statistics of the call.
+func (cl *call) circuitState() {
+	if sb, ok := cl.settings.circuitBreaker.(interface{ State() CircuitState }); ok && cl.info != nil {
+		cl.info.CircuitState = sb.State()
+	}
+}
+
+// ConsecutiveBreaker is a CircuitBreaker opening after a number of consecutive failed attempts. Once open it
+// rejects attempts for ResetTimeout, then lets Probes attempts through half-open. The circuit closes once all
+// of them succeeded and opens again on the first failure.
+type ConsecutiveBreaker struct {
+	// Threshold is the number of consecutive failures opening the circuit.
+	Threshold int
+	// ResetTimeout is the time the circuit stays open.
+	ResetTimeout time.Duration
+	// Probes is the number of attempts let through half-open, 1 if not positive.
+	Probes int
+	// OnStateChange is called on every state transition if not nil, with the breaker locked.
+	OnStateChange func(from, to CircuitState)
+	// Clock is the source of time, the system clock if nil.
+	Clock Clock
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// probes is the number of probes let through, succeeded the number of them that succeeded
+	probes    int
+	succeeded int
+	// generation counts the transitions, outcomes of attempts let through in an earlier state are ignored
+	generation int
+}
+
+// NewConsecutiveBreaker returns a breaker opening after threshold consecutive failures for resetTimeout.
+func NewConsecutiveBreaker(threshold int, resetTimeout time.Duration) *ConsecutiveBreaker {
+	return &ConsecutiveBreaker{Threshold: threshold, ResetTimeout: resetTimeout}
+}
+
+// State returns the current state of the breaker. An open breaker whose reset timeout elapsed is half-open.
+func (b *ConsecutiveBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	return b.state
+}
+
+// Allow lets the attempt through unless the circuit is open or all probes of the half-open circuit are
+// taken.
+func (b *ConsecutiveBreaker) Allow() (func(success bool), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.expire()
+	switch b.state {
+	case CircuitOpen:
+		return nil, ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.probes >= max(b.Probes, 1) {
+			return nil, ErrCircuitOpen
+		}
+		b.probes++
+	}
+	var once sync.Once
+	generation := b.generation
+	return func(success bool) {
+		once.Do(func() { b.done(generation, success) })
+	}, nil
+}
+
+func (b *ConsecutiveBreaker) done(generation int, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+	switch {
+	case b.state == CircuitHalfOpen && !success:
+		b.open()
+	case b.state == CircuitHalfOpen:
+		if b.succeeded++; b.succeeded >= max(b.Probes, 1) {
+			b.failures = 0
+			b.transition(CircuitClosed)
+		}
+	case b.state == CircuitClosed && !success:
+		if b.failures++; b.failures >= b.Threshold {
+			b.open()
+		}
+	case b.state == CircuitClosed:
+		b.failures = 0
+	}
+}
+
+func (b *ConsecutiveBreaker) open() {
+	b.openedAt = b.now()
+	b.transition(CircuitOpen)
+}
+
+// expire turns an open circuit half-open once the reset timeout elapsed.
+func (b *ConsecutiveBreaker) expire() {
+	if b.state == CircuitOpen && b.now().Sub(b.openedAt) >= b.ResetTimeout {
+		b.probes, b.succeeded = 0, 0
+		b.transition(CircuitHalfOpen)
+	}
+}
+
+func (b *ConsecutiveBreaker) transition(to CircuitState) {
+	from := b.state
+	if from == to {
+		return
+	}
+	b.state = to
+	b.generation++
+	if b.OnStateChange != nil {
+		b.OnStateChange(from, to)
+	}
+}
+
+func (b *ConsecutiveBreaker) now() time.Time {
+	if b.Clock == nil {
+		return time.Now()
+	}
+	return b.Clock.Now()
+}
@@ -0,0 +1,164 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	srv, requests := newFlakyServer(t, 2, http.StatusServiceUnavailable)
+	clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var transitions []string
+	cb := NewConsecutiveBreaker(2, time.Minute)
+	cb.Clock = clock
+	cb.OnStateChange = func(from, to CircuitState) { transitions = append(transitions, from.String()+" -> "+to.String()) }
+
+	limiter := &countingLimiter{}
+	observer := &recordingObserver{}
+	var states []CircuitState
+	encodes := 0
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithCircuitBreaker(cb), WithRetry(fastRetry), MarkIdempotent("GetInfo"),
+		WithRateLimiter(limiter), WithRetryObserver(observer),
+		WithMetricsHook(func(_ context.Context, info *ResponseInfo, _ error) { states = append(states, info.CircuitState) }),
+		WithEncoderFactory(func(w io.Writer) SOAPEncoder { encodes++; return xml.NewEncoder(w) })))
+
+	// the third attempt is rejected
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Len(t, *requests, 2)
+	assert.Equal(t, int32(2), limiter.waits.Load())
+	assert.Equal(t, 2, encodes)
+	require.Len(t, observer.giveUps, 1)
+	assert.Equal(t, RetryReasonCircuitOpen, observer.giveUps[0].Reason)
+	assert.Equal(t, []CircuitState{CircuitOpen}, states)
+
+	// fails fast while open
+	err = client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Len(t, *requests, 2)
+	assert.Equal(t, int32(2), limiter.waits.Load())
+	assert.Equal(t, 2, encodes)
+
+	// the probe succeeds once the reset timeout elapsed
+	clock.NewTimer(time.Minute)
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Len(t, *requests, 3)
+	assert.Equal(t, []string{"closed -> open", "open -> half-open", "half-open -> closed"}, transitions)
+	assert.Equal(t, []CircuitState{CircuitOpen, CircuitOpen, CircuitClosed}, states)
+}
+
+func TestCircuitBreakerTerminalFault(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+		`<soap:Fault><faultcode>soap:Client</faultcode><faultstring>bad</faultstring></soap:Fault></soap:Body></soap:Envelope>`)
+	cb := NewConsecutiveBreaker(1, time.Minute)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithCircuitBreaker(cb)))
+	for range 3 {
+		assert.ErrorIs(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}), ErrSoapFault)
+	}
+	assert.Equal(t, CircuitClosed, cb.State())
+}
+
+func TestCircuitBreakerStream(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, busyFault)
+	}))
+	t.Cleanup(srv.Close)
+	cb := NewConsecutiveBreaker(1, time.Minute)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithCircuitBreaker(cb)))
+	skip := func(dec *xml.Decoder, start xml.StartElement) error { return dec.Skip() }
+	assert.ErrorIs(t, client.DoStream(context.Background(), "GetInfo", &infoRequest{}, skip), ErrSoapFault)
+	assert.ErrorIs(t, client.DoStream(context.Background(), "GetInfo", &infoRequest{}, skip), ErrCircuitOpen)
+	assert.Equal(t, 1, requests)
+}
+
+type rejectingBreaker struct{}
+
+func (rejectingBreaker) Allow() (func(bool), error) { return nil, errors.New("budget exhausted") }
+
+func TestCircuitBreakerCustomError(t *testing.T) {
+	client := NewClient("http://localhost")
+	require.NoError(t, client.SetOptions(WithCircuitBreaker(rejectingBreaker{})))
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorContains(t, err, "budget exhausted")
+}
+
+func TestConsecutiveBreakerProbes(t *testing.T) {
+	clock := &manualClock{}
+	cb := &ConsecutiveBreaker{Threshold: 1, ResetTimeout: time.Second, Probes: 2, Clock: clock}
+
+	slow, err := cb.Allow()
+	require.NoError(t, err)
+	done, err := cb.Allow()
+	require.NoError(t, err)
+	done(false)
+	assert.Equal(t, CircuitOpen, cb.State())
+	_, err = cb.Allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+
+	clock.NewTimer(time.Second)
+	assert.Equal(t, CircuitHalfOpen, cb.State())
+	first, err := cb.Allow()
+	require.NoError(t, err)
+	second, err := cb.Allow()
+	require.NoError(t, err)
+	_, err = cb.Allow()
+	assert.ErrorIs(t, err, ErrCircuitOpen, "all probes taken")
+
+	// attempts let through before are ignored
+	slow(true)
+	first(true)
+	assert.Equal(t, CircuitHalfOpen, cb.State())
+	second(false)
+	assert.Equal(t, CircuitOpen, cb.State())
+
+	clock.NewTimer(time.Second)
+	for range 2 {
+		probe, err := cb.Allow()
+		require.NoError(t, err)
+		probe(true)
+		probe(false)
+	}
+	assert.Equal(t, CircuitClosed, cb.State())
+}
+
+func TestServiceFailure(t *testing.T) {
+	var tests = []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{context.DeadlineExceeded, true},
+		{&HTTPError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{&HTTPError{StatusCode: http.StatusNotFound}, false},
+		{&Fault{Code: "soap:Server.Busy"}, true},
+		{&Fault{Code: "soap:Client"}, false},
+		{&net.OpError{Op: "dial", Err: errors.New("refused")}, true},
+		{fmt.Errorf("encoding: %w", ErrInvalidChar), false},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.err), func(t *testing.T) {
+			assert.Equal(t, tt.want, (&settings{}).serviceFailure(tt.err))
+		})
+	}
+}
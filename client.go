@@ -6,8 +6,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"net/http"
+	"sync/atomic"
+	"time"
 )
 
 var (
@@ -21,9 +23,16 @@ var (
 
 // Client is an opaque handle to a SOAP service.
 type Client struct {
-	url     string
-	http    *http.Client
-	headers []HeaderBuilder
+	url      string
+	http     *http.Client
+	headers  []HeaderBuilder
+	settings settings
+	// customHTTP is set if the http.Client was provided by the user
+	customHTTP bool
+	// negotiated is the SOAP version found working with AutoNegotiate, plus one
+	negotiated atomic.Int32
+	pool       poolCounters
+	closed     atomic.Bool
 }
 
 // NewClient creates a new Client that will access a SOAP service.
@@ -39,45 +48,316 @@ func NewClient(url string, soapHeaders ...HeaderBuilder) *Client {
 }
 
 // SettHTTPClient sets a custom http.Client instance to be used for all communications (e.g. for seting timeouts)
+// Transport options like WithH2C have no effect on a custom client. The TLS options fail with ErrTransportOption,
+// the TLS of the custom client has to be configured on its transport.
 func (c *Client) SettHTTPClient(http *http.Client) {
 	c.http = http
+	c.customHTTP = true
+}
+
+// SetOptions applies the options to all subsequent calls made with the client.
+func (c *Client) SetOptions(opts ...Option) error {
+	s, err := c.settings.apply(opts...)
+	if err != nil {
+		return err
+	}
+	if err := c.checkSharedClient(&s); err != nil {
+		return err
+	}
+	previous := c.settings.transport
+	c.settings = s
+	if !s.transport.set || c.customHTTP {
+		return nil
+	}
+	// the transport is kept with its pooled connections unless its settings change
+	built, ok := c.http.Transport.(*http.Transport)
+	owned := ok && built == c.pool.tracked
+	if owned && s.transport.equal(previous) {
+		return nil
+	}
+	c.http = &http.Client{Transport: c.pool.track(s.transport.newTransport())}
+	if owned {
+		built.CloseIdleConnections()
+	}
+	return nil
 }
 
 // Do invokes the SOAP request using its internal parameters.
 // The request argument is serialized to XML, and if the call is successful the received XML
 // is deserialized into the response argument.
 // Any errors that are encountered are returned.
-// If a SOAP fault is detected, then the 'details' property of the SOAP envelope will be appended into the faultDetailType argument.
-func (c *Client) Do(ctx context.Context, action string, request any, response any) error {
+// Failed calls return a *CallError wrapping the error with the context of the call. If a SOAP fault is
+// detected, it is found as *Fault with errors.As or ExtractFault; its detail can be decoded with DecodeDetail.
+// The opts only apply to this call, on top of the options set on the client.
+func (c *Client) Do(ctx context.Context, action string, request any, response any, opts ...Option) error {
+	cl, err := c.newCall(ctx, action, request, response, opts)
+	if err != nil {
+		return &CallError{Action: action, Endpoint: redactURL(c.url), Err: err}
+	}
+	if cl.settings.dedup != nil {
+		return newCallError(cl, c.dedup(ctx, cl, func() error { return c.run(ctx, cl) }))
+	}
+	return newCallError(cl, c.run(ctx, cl))
+}
+
+// run makes the attempts of a call.
+func (c *Client) run(ctx context.Context, cl *call) (err error) {
+	reauthenticated, negotiated := false, false
+	for cl.attempt = 1; ; cl.attempt++ {
+		cl.resetInfo()
+		var done func(error)
+		if done, err = cl.settings.allowAttempt(); err != nil {
+			break
+		}
+		if err = cl.settings.waitLimiter(ctx); err != nil {
+			done(err)
+			break
+		}
+		cl.startTimer()
+		err = cl.stopTimer(c.do(ctx, cl))
+		done(err)
+		retryAfter := cl.settings.throttle(err)
+		if err != nil && !negotiated && cl.settings.autoNegotiate && errors.Is(err, ErrVersionMismatch) {
+			negotiated = true
+			cl.observeAttempt(err, cl.url, 0)
+			cl.settings.version = cl.settings.version.other()
+			continue
+		}
+		if err != nil && !reauthenticated && cl.settings.needsReauthentication(err) {
+			reauthenticated = true
+			if authErr := cl.settings.reauthenticate(ctx); authErr != nil {
+				err = fmt.Errorf("reauthenticating after %w: %w", err, authErr)
+				break
+			}
+			cl.observeAttempt(err, cl.url, 0)
+			continue
+		}
+		if err == nil || cl.settings.retry == nil || cl.attempt >= cl.settings.retry.MaxAttempts {
+			break
+		}
+		// a fault asking to retry later is a throttling fault, regardless of its class
+		if retryAfter == 0 && !cl.settings.retryable(cl.action, err) {
+			break
+		}
+		delay := cl.settings.retry.Backoff(cl.attempt + 1)
+		if retryAfter > 0 {
+			delay = retryAfter
+		}
+		cl.observeAttempt(err, cl.url, delay)
+		if sleepErr := sleep(ctx, cl.settings.timeSource(), delay); sleepErr != nil {
+			break
+		}
+	}
 
-	req := NewRequest(action, c.url, request, response, nil)
-	req.AddHeader(c.headers...)
-	httpReq, err := req.httpRequest()
 	if err != nil {
-		return err
+		cl.observeGiveUp(err, cl.url)
+	}
+	if err == nil && cl.settings.autoNegotiate {
+		c.negotiated.Store(int32(cl.settings.version) + 1)
 	}
+	cl.finish(ctx, err)
+	return err
+}
 
-	httpResp, err := c.http.Do(httpReq.WithContext(ctx))
+// call holds the state of a single logical call across all of its attempts.
+type call struct {
+	action string
+	// url is the endpoint URL with the placeholders resolved
+	url      string
+	request  any
+	response any
+	settings settings
+	// key is the idempotency key shared by all attempts
+	key           string
+	correlationID string
+	// messageID is the WS-Addressing message id if it is shared by all attempts
+	messageID string
+	// info receives the statistics of the current attempt if not nil
+	info    *ResponseInfo
+	attempt int
+	started time.Time
+	// timer records the timings of the current attempt if statistics are collected
+	timer *attemptTimer
+	// flight collects the flight record of the current attempt if not nil
+	flight *flight
+	// last is the response of the current attempt, transportErr the error sending its request, if any
+	last         *Response
+	transportErr error
+}
+
+func (c *Client) newCall(ctx context.Context, action string, request any, response any, opts []Option) (*call, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+	s, err := c.settings.apply(opts...)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer httpResp.Body.Close()
+	if action == "" && s.actionResolver != nil {
+		action = s.actionResolver(request)
+	}
+	endpoint, err := resolveURL(c.url, s.urlVars)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkMethod(request); err != nil {
+		return nil, err
+	}
+	if err := c.checkSharedClient(&s); err != nil {
+		return nil, err
+	}
+	if err := c.checkCallTransport(&s); err != nil {
+		return nil, err
+	}
+	if s.formatTags {
+		if err := errors.Join(ValidateFormats(request), ValidateFormats(response)); err != nil {
+			return nil, err
+		}
+	}
+	if s.requestValidator != nil {
+		if err := s.requestValidator(action, request); err != nil {
+			return nil, err
+		}
+	}
+	if err := beforeEncode(ctx, request); err != nil {
+		return nil, err
+	}
+	cl := &call{
+		action:   action,
+		url:      endpoint,
+		request:  request,
+		response: response,
+		settings: s,
+		attempt:  1,
+		started:  s.timeSource().Now(),
+	}
+	if v := c.negotiated.Load(); v > 0 && s.autoNegotiate {
+		cl.settings.version = Version(v - 1)
+	}
+	if s.instrumented() {
+		cl.info = &ResponseInfo{}
+	}
+	if s.idempotencyKey {
+		cl.key = newIdempotencyKey()
+	}
+	cl.correlationID = s.correlationID(ctx)
+	if s.messageID != "" {
+		cl.messageID = s.messageID
+	} else if s.addressing != nil && s.addressing.ReuseMessageID {
+		cl.messageID = newMessageID()
+	}
+	cl.resetInfo()
+	return cl, nil
+}
 
-	bodyBytes, err := ioutil.ReadAll(httpResp.Body)
+// resetInfo prepares the statistics for the current attempt.
+func (cl *call) resetInfo() {
+	if cl.info != nil {
+		*cl.info = ResponseInfo{Action: cl.action, Endpoint: redactURL(cl.url), Attempt: cl.attempt, CorrelationID: cl.correlationID, Timings: cl.info.Timings}
+	}
+}
+
+// finish reports the statistics of the call once it returned err.
+func (cl *call) finish(ctx context.Context, err error) {
+	if cl.info != nil {
+		cl.info.Duration = cl.settings.timeSource().Now().Sub(cl.started)
+		cl.circuitState()
+	}
+	cl.logCall(ctx, err)
+	if cl.info == nil {
+		return
+	}
+	if cl.settings.info != nil {
+		*cl.settings.info = *cl.info
+	}
+	if cl.settings.metrics != nil {
+		cl.settings.metrics(ctx, cl.info, err)
+	}
+}
+
+// send builds the request of the current attempt and sends it. The caller has to close the response body.
+func (c *Client) send(ctx context.Context, cl *call) (*Request, *http.Response, error) {
+	if err := cl.settings.checkAction(ctx, cl.action, cl.url); err != nil {
+		return nil, nil, err
+	}
+	req := NewRequest(cl.action, cl.url, cl.request, cl.response, nil)
+	req.AddHeader(c.headers...)
+	req.settings = cl.settings
+	req.idempotencyKey = cl.key
+	req.correlationID = cl.correlationID
+	req.ctx = contextWithClock(contextWithAttempt(ctx, cl.attempt), &cl.settings)
+	if cl.settings.addressing != nil {
+		req.messageID = cl.messageID
+		if req.messageID == "" {
+			req.messageID = newMessageID()
+		}
+		if cl.info != nil {
+			cl.info.MessageID = req.messageID
+		}
+	}
+	httpReq, err := req.httpRequest()
 	if err != nil {
-		panic(err)
+		return nil, nil, err
+	}
+	cl.acceptGzip(httpReq)
+	if cl.settings.session != nil {
+		if err := cl.settings.session.addCookies(httpReq, cl.settings.timeSource().Now()); err != nil {
+			return nil, nil, err
+		}
+	}
+	httpReq.Close = cl.settings.transport.connectionPerRequest
+	if err := cl.runSendHooks(ctx, req, httpReq); err != nil {
+		return nil, nil, err
 	}
+	cl.flight.request(httpReq, req.payload)
+	cl.trackUpload(httpReq)
 
-	fmt.Println(string(bodyBytes))
+	httpResp, err := c.roundTrip(ctx, httpReq, cl.timer)
+	if err != nil {
+		cl.transportErr = err
+		return nil, nil, err
+	}
+	cl.trackDownload(httpResp)
+	if cl.settings.session != nil {
+		cl.settings.session.record(httpResp, cl.settings.timeSource().Now())
+	}
+	if cl.info != nil && cl.settings.correlationHeader != "" {
+		cl.info.EchoedCorrelationID = httpResp.Header.Get(cl.settings.correlationHeader)
+	}
+	return req, httpResp, nil
+}
 
-	resp := newResponse(httpResp, req)
-	err = resp.deserialize()
+// do performs a single attempt of a call.
+func (c *Client) do(ctx context.Context, cl *call) (err error) {
+	cl.startFlight()
+	defer func() { cl.flight.end(err) }()
+	cl.last, cl.transportErr = nil, nil
+	req, httpResp, err := c.send(ctx, cl)
 	if err != nil {
 		return err
 	}
-	if resp.Fault() != nil {
-		return resp.Fault()
+	defer httpResp.Body.Close()
+	finishTee, err := cl.teeResponse(ctx, httpResp)
+	if err != nil {
+		return err
 	}
+	defer func() { finishTee(err) }()
+	cl.flight.response(httpResp)
+	// the decoding stops at the next read once ctx is done, even if the body is already buffered
+	httpResp.Body = struct {
+		io.Reader
+		io.Closer
+	}{&ctxReader{ctx: ctx, r: httpResp.Body}, httpResp.Body}
 
-	return nil
+	resp := newResponse(httpResp, req)
+	resp.info = cl.info
+	resp.settings = cl.settings
+	resp.attempt = cl.attempt
+	cl.last = resp
+	if cl.settings.responseVerification != nil && cl.settings.confirmSignatures {
+		if resp.confirmations, err = requestSignatures(req.payload); err != nil {
+			return err
+		}
+	}
+	return resp.decode(ctx, cl.action)
 }
@@ -0,0 +1,112 @@
+package soap
+
+import (
+	"context"
+	"time"
+)
+
+// Implements the clock used for all time-dependent features, so they can be tested deterministically and
+// security timestamps can be corrected for a known skew of the server clock.
+
+// Clock is the source of time of a client.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a timer firing once after d.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer created by a Clock.
+type Timer interface {
+	// C returns the channel receiving the time when the timer fires.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing. It reports whether the timer was active.
+	Stop() bool
+}
+
+// systemClock is the Clock of the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t systemTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+// WithClock sets the clock used for timestamps, retry backoff and statistics. Default is the system clock.
+func WithClock(clock Clock) Option {
+	return func(s *settings) error {
+		s.clock = clock
+		return nil
+	}
+}
+
+// WithServerClockOffset shifts the security timestamps sent to the server by d, to correct for a server
+// clock running d ahead of the local clock. Other uses of the clock are not affected.
+func WithServerClockOffset(d time.Duration) Option {
+	return func(s *settings) error {
+		s.serverClockOffset = d
+		return nil
+	}
+}
+
+// timeSource returns the clock of the settings.
+func (s *settings) timeSource() Clock {
+	if s.clock == nil {
+		return systemClock{}
+	}
+	return s.clock
+}
+
+type clockKey struct{}
+
+// callClock is the clock of a call as carried by the context passed to header builders.
+type callClock struct {
+	clock  Clock
+	offset time.Duration
+}
+
+// contextWithClock returns a copy of ctx carrying the clock and server clock offset of s.
+func contextWithClock(ctx context.Context, s *settings) context.Context {
+	return context.WithValue(ctx, clockKey{}, callClock{clock: s.timeSource(), offset: s.serverClockOffset})
+}
+
+// ClockFromContext returns the clock of the call the context was passed to a ContextHeaderBuilder for.
+// It returns the system clock outside of a call.
+func ClockFromContext(ctx context.Context) Clock {
+	if c, ok := ctx.Value(clockKey{}).(callClock); ok {
+		return c.clock
+	}
+	return systemClock{}
+}
+
+// ServerTime returns the current time of the server clock for the call the context was passed to a
+// ContextHeaderBuilder for, that is the time of the call clock shifted by the server clock offset. Header
+// builders use it for security timestamps.
+func ServerTime(ctx context.Context) time.Time {
+	c, ok := ctx.Value(clockKey{}).(callClock)
+	if !ok {
+		return time.Now()
+	}
+	return c.clock.Now().Add(c.offset)
+}
+
+// serverClockOffset returns the server clock offset of the call the context was passed to a header builder for.
+func serverClockOffset(ctx context.Context) time.Duration {
+	c, _ := ctx.Value(clockKey{}).(callClock)
+	return c.offset
+}
@@ -0,0 +1,86 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// manualClock is a Clock only moved by its timers, which fire immediately.
+type manualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *manualClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	t := make(firedTimer, 1)
+	t <- c.now
+	return t
+}
+
+// firedTimer is a Timer that already fired.
+type firedTimer chan time.Time
+
+func (t firedTimer) C() <-chan time.Time {
+	return t
+}
+
+func (t firedTimer) Stop() bool {
+	return false
+}
+
+func TestClockSecurityTimestamp(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	assert.NoError(t, err)
+	now := time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := &settings{clock: &manualClock{now: now}, serverClockOffset: 90 * time.Second}
+	ctx := contextWithClock(context.Background(), s)
+
+	assert.Equal(t, now, ClockFromContext(ctx).Now())
+	assert.Equal(t, now.Add(90*time.Second), ServerTime(ctx))
+
+	secHeader, err := wsseInfo.ContextHeader()(ctx, &timestamp{})
+	assert.NoError(t, err)
+	assert.Equal(t, "2021-01-01T12:01:30.000Z", pendingTimestamp(t, secHeader).Created)
+	assert.Equal(t, "2021-01-01T12:01:40.000Z", pendingTimestamp(t, secHeader).Expires)
+
+	// the deadline is shifted to the server clock as well
+	deadline := time.Now().Add(time.Hour)
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	wsseInfo.ExpireAtDeadline(true)
+	secHeader, err = wsseInfo.ContextHeader()(ctx, &timestamp{})
+	assert.NoError(t, err)
+	assert.Equal(t, TimestampMilliseconds.Format(deadline.Add(90*time.Second)), pendingTimestamp(t, secHeader).Expires)
+}
+
+func TestClockRetryBackoff(t *testing.T) {
+	srv, requests := newFlakyServer(t, 2, http.StatusServiceUnavailable)
+	clock := &manualClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: func(int) time.Duration { return time.Hour }}
+
+	var info ResponseInfo
+	started := time.Now()
+	err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+		WithClock(clock), WithRetry(policy), MarkIdempotent("GetInfo"), WithResponseInfo(&info))
+	assert.NoError(t, err)
+	assert.Len(t, *requests, 3)
+	assert.Less(t, time.Since(started), time.Minute)
+	// the clock does not move on its own, only the backoff of two hours passed
+	assert.Equal(t, 2*time.Hour, info.Duration)
+	assert.Len(t, info.Timings, 3)
+	assert.Zero(t, info.Timings[0].Total)
+}
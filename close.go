@@ -0,0 +1,30 @@
+package soap
+
+import (
+	"errors"
+)
+
+var (
+	// ErrClientClosed is returned by the calls of a client after Client.Close.
+	ErrClientClosed = errors.New("client closed")
+)
+
+// Close closes the client: subsequent calls, warm-ups and forwarded envelopes fail with ErrClientClosed.
+// The idle connections of the transport the client created for transport options are closed, and so are
+// those returned by calls still in flight once they complete. Close is a no-op for the connections of an
+// http.Client set with SettHTTPClient and of http.DefaultClient, which are not owned by the client.
+// Closing a closed client is safe and returns nil.
+func (c *Client) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	c.drain()
+	return nil
+}
+
+// drain closes the idle connections of a closed client owning its transport.
+func (c *Client) drain() {
+	if c.closed.Load() && !c.customHTTP && c.pool.tracked != nil {
+		c.pool.tracked.CloseIdleConnections()
+	}
+}
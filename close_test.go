@@ -0,0 +1,64 @@
+package soap
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientClose(t *testing.T) {
+	srv, _ := newMethodServer(t, false)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithIdleConnTimeout(time.Minute)))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, 1, client.PoolStats().Idle)
+
+	require.NoError(t, client.Close())
+	assert.Equal(t, 0, client.PoolStats().Open)
+	assert.ErrorIs(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}), ErrClientClosed)
+	assert.ErrorIs(t, client.Warmup(context.Background()), ErrClientClosed)
+	_, err := client.ForwardEnvelope(context.Background(), "GetInfo", []byte(infoResponseBody))
+	assert.ErrorIs(t, err, ErrClientClosed)
+	assert.NoError(t, client.Close())
+}
+
+func TestClientCloseDrains(t *testing.T) {
+	srv, _ := newMethodServer(t, false)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithIdleConnTimeout(time.Minute)))
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.roundTrip(context.Background(), req, nil)
+	require.NoError(t, err)
+
+	// the connection of the call in flight is closed once it completes
+	require.NoError(t, client.Close())
+	assert.Equal(t, PoolStats{Open: 1, Active: 1, Counted: true, Dialed: 1}, client.PoolStats())
+	_, err = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Eventually(t, func() bool { return client.PoolStats().Open == 0 }, time.Second, time.Millisecond)
+}
+
+func TestClientCloseCustomHTTP(t *testing.T) {
+	srv, _ := newMethodServer(t, false)
+	tr := &http.Transport{}
+	t.Cleanup(tr.CloseIdleConnections)
+	client := NewClient(srv.URL)
+	client.SettHTTPClient(&http.Client{Transport: tr})
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+
+	require.NoError(t, client.Close())
+	assert.ErrorIs(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}), ErrClientClosed)
+
+	// the connection of the custom client stays open for its other users
+	other := NewClient(srv.URL)
+	other.SettHTTPClient(&http.Client{Transport: tr})
+	require.NoError(t, other.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, int64(1), other.PoolStats().Reused)
+}
@@ -0,0 +1,285 @@
+// Command gosoap performs ad-hoc SOAP calls and inspects envelopes.
+//
+// Usage:
+//
+//	gosoap call --url URL --action ACTION --body body.xml [--header hdr.xml]... [--sign key.pem,cert.pem]
+//	gosoap wsdl ops URL|FILE
+//	gosoap verify response.xml [--ca ca.pem] [--cert cert.pem] [--at TIME] [--max-skew DURATION]
+//
+// The call command prints the response body content. It exits with 2 if the service answered with a
+// fault and with 1 on any other error.
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/beevik/etree"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+	"github.com/OmerBerkcanMee/gosoap/wsdl"
+)
+
+const (
+	exitOK    = 0
+	exitError = 1
+	exitFault = 2
+)
+
+const usage = `usage:
+  gosoap call --url URL --action ACTION --body body.xml [--header hdr.xml]... [--sign key.pem,cert.pem]
+  gosoap wsdl ops URL|FILE
+  gosoap verify response.xml [--ca ca.pem] [--cert cert.pem] [--at TIME] [--max-skew DURATION]
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command line args and returns the exit code.
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+	var err error
+	code := exitOK
+	switch args[0] {
+	case "call":
+		code, err = runCall(args[1:], stdout, stderr)
+	case "wsdl":
+		err = runWSDL(args[1:], stdout)
+	case "verify":
+		err = runVerify(args[1:], stdout, stderr)
+	default:
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gosoap: %v\n", err)
+		if code == exitOK {
+			code = exitError
+		}
+	}
+	return code
+}
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// parseInterspersed parses the flags of fs allowing them to follow positional arguments, which are returned.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func runCall(args []string, stdout, stderr io.Writer) (int, error) {
+	fs := flag.NewFlagSet("call", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	url := fs.String("url", "", "service endpoint URL")
+	action := fs.String("action", "", "SOAP action")
+	bodyFile := fs.String("body", "", "file with the body content element")
+	sign := fs.String("sign", "", "sign the body with key.pem,cert.pem")
+	timeout := fs.Duration("timeout", 30*time.Second, "timeout of the call")
+	var headerFiles stringList
+	fs.Var(&headerFiles, "header", "file with a header element, may be repeated")
+	if _, err := parseInterspersed(fs, args); err != nil {
+		return exitError, err
+	}
+	if *url == "" || *bodyFile == "" {
+		return exitError, errors.New("call requires --url and --body")
+	}
+
+	body, err := os.ReadFile(*bodyFile)
+	if err != nil {
+		return exitError, err
+	}
+	var headers []any
+	for _, file := range headerFiles {
+		header, err := os.ReadFile(file)
+		if err != nil {
+			return exitError, err
+		}
+		headers = append(headers, soap.RawXML(header))
+	}
+
+	var builders []soap.HeaderBuilder
+	if len(headers) > 0 {
+		builders = append(builders, func(any) (any, error) {
+			return headers, nil
+		})
+	}
+	if *sign != "" {
+		keyFile, certFile, ok := strings.Cut(*sign, ",")
+		if !ok {
+			return exitError, errors.New("--sign expects key.pem,cert.pem")
+		}
+		auth, err := soap.NewWSSEAuthInfo(certFile, keyFile)
+		if err != nil {
+			return exitError, err
+		}
+		builders = append(builders, auth.Header())
+		// the digest is computed over the serialized body, so it has to be canonical already
+		if body, err = soap.Canonicalize(body); err != nil {
+			return exitError, err
+		}
+	}
+
+	client := soap.NewClient(*url, builders...)
+	client.SettHTTPClient(&http.Client{Timeout: *timeout})
+	var resp soap.RawXML
+	err = client.Do(context.Background(), *action, soap.RawXML(body), &resp)
+	var fault *soap.Fault
+	if errors.As(err, &fault) {
+		printFault(stdout, fault)
+		return exitFault, nil
+	}
+	if err != nil {
+		return exitError, err
+	}
+	return exitOK, printXML(stdout, resp)
+}
+
+func printFault(w io.Writer, fault *soap.Fault) {
+	fmt.Fprintln(w, "*** SOAP FAULT ***")
+	fmt.Fprintf(w, "code:   %s\n", fault.Code)
+	fmt.Fprintf(w, "string: %s\n", fault.String)
+	if fault.Actor != "" {
+		fmt.Fprintf(w, "actor:  %s\n", fault.Actor)
+	}
+	if fault.DetailInternal != nil && strings.TrimSpace(fault.DetailInternal.Content) != "" {
+		fmt.Fprintln(w, "detail:")
+		if printXML(w, []byte(fault.DetailInternal.Content)) != nil {
+			fmt.Fprintln(w, strings.TrimSpace(fault.DetailInternal.Content))
+		}
+	}
+}
+
+// printXML writes the indented XML data.
+func printXML(w io.Writer, data []byte) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return err
+	}
+	doc.Indent(2)
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+func runWSDL(args []string, stdout io.Writer) error {
+	if len(args) != 2 || args[0] != "ops" {
+		return errors.New("usage: gosoap wsdl ops URL|FILE")
+	}
+	defs, err := loadWSDL(args[1])
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "BINDING\tOPERATION\tACTION")
+	for _, op := range defs.Operations() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", op.Binding, op.Name, op.Action)
+	}
+	return tw.Flush()
+}
+
+// loadWSDL reads the WSDL document at the http(s) URL with its imports, or the local file.
+func loadWSDL(location string) (*wsdl.Definitions, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		f, err := os.Open(location)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return wsdl.Parse(f)
+	}
+	fetcher := &wsdl.Fetcher{Timeout: 30 * time.Second}
+	return fetcher.Fetch(context.Background(), location)
+}
+
+func runVerify(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	caFile := fs.String("ca", "", "PEM file with the trusted CA certificates")
+	certFile := fs.String("cert", "", "PEM file with the signing certificate, if not included in the envelope")
+	at := fs.String("at", "", "RFC 3339 time to check the certificate and timestamp validity at instead of now")
+	skew := fs.Duration("max-skew", 0, "clock skew of the sender tolerated when checking the timestamp")
+	files, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) != 1 {
+		return errors.New("verify expects a single envelope file")
+	}
+
+	envelope, err := os.ReadFile(files[0])
+	if err != nil {
+		return err
+	}
+	opts := soap.VerifyOptions{MaxClockSkew: *skew}
+	if *caFile != "" {
+		data, err := os.ReadFile(*caFile)
+		if err != nil {
+			return err
+		}
+		opts.Roots = x509.NewCertPool()
+		if !opts.Roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates in %s", *caFile)
+		}
+	}
+	if *at != "" {
+		if opts.CurrentTime, err = time.Parse(time.RFC3339, *at); err != nil {
+			return err
+		}
+	}
+	if *certFile != "" {
+		if opts.Certificate, err = readCertificate(*certFile); err != nil {
+			return err
+		}
+	}
+	if err := soap.VerifySignature(envelope, opts); err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, "signature valid")
+	return nil
+}
+
+func readCertificate(file string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", file)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
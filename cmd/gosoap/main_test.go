@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/OmerBerkcanMee/gosoap/soaptest"
+	"github.com/stretchr/testify/assert"
+)
+
+const echoResponse = `<EchoResponse xmlns="urn:echo"><Text>hi</Text></EchoResponse>`
+
+func runArgs(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCall(t *testing.T) {
+	srv := soaptest.NewServer(t)
+	srv.Respond("urn:Echo", echoResponse)
+
+	code, out, errOut := runArgs("call", "--url", srv.URL, "--action", "urn:Echo",
+		"--body", "testdata/echo.xml", "--header", "testdata/trace.xml")
+	assert.Equal(t, exitOK, code, errOut)
+	assert.Contains(t, out, "<Text>hi</Text>")
+
+	requests := srv.Requests()
+	if assert.Len(t, requests, 1) {
+		assert.Contains(t, string(requests[0].Body), `<tr:Trace xmlns:tr="urn:trace"><tr:Hop>cli</tr:Hop></tr:Trace>`)
+		assert.Contains(t, string(requests[0].Body), `<Echo xmlns="urn:echo">`)
+	}
+}
+
+func TestCallFault(t *testing.T) {
+	srv := soaptest.NewServer(t)
+	srv.Fault("urn:Echo", "soap:Server", "unavailable")
+
+	code, out, _ := runArgs("call", "--url", srv.URL, "--action", "urn:Echo", "--body", "testdata/echo.xml")
+	assert.Equal(t, exitFault, code)
+	assert.Contains(t, out, "*** SOAP FAULT ***")
+	assert.Contains(t, out, "unavailable")
+}
+
+func TestCallMissingFlags(t *testing.T) {
+	code, _, errOut := runArgs("call", "--url", "http://localhost")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, errOut, "--body")
+}
+
+func TestSignAndVerify(t *testing.T) {
+	srv := soaptest.NewServer(t)
+	srv.Respond("urn:Echo", echoResponse)
+
+	code, _, errOut := runArgs("call", "--url", srv.URL, "--action", "urn:Echo", "--body", "testdata/echo.xml",
+		"--sign", "../../testdata/key.pem,../../testdata/cert.pem")
+	assert.Equal(t, exitOK, code, errOut)
+	requests := srv.Requests()
+	if !assert.Len(t, requests, 1) {
+		return
+	}
+
+	dir := t.TempDir()
+	signed := filepath.Join(dir, "signed.xml")
+	assert.NoError(t, os.WriteFile(signed, requests[0].Body, 0o600))
+	code, out, errOut := runArgs("verify", signed, "--cert", "../../testdata/cert.pem")
+	assert.Equal(t, exitOK, code, errOut)
+	assert.Equal(t, "signature valid\n", out)
+
+	// the test certificate has expired, the timestamp of the envelope was created after
+	code, _, errOut = runArgs("verify", signed, "--ca", "../../testdata/cert.pem", "--cert", "../../testdata/cert.pem",
+		"--at", "2021-01-01T00:00:00Z")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, errOut, "invalid timestamp")
+	age := time.Since(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)) + time.Hour
+	code, out, errOut = runArgs("verify", signed, "--ca", "../../testdata/cert.pem", "--cert", "../../testdata/cert.pem",
+		"--at", "2021-01-01T00:00:00Z", "--max-skew", age.String())
+	assert.Equal(t, exitOK, code, errOut)
+	assert.Equal(t, "signature valid\n", out)
+
+	tampered := filepath.Join(dir, "tampered.xml")
+	assert.NoError(t, os.WriteFile(tampered, []byte(strings.Replace(string(requests[0].Body), ">hi<", ">ho<", 1)), 0o600))
+	code, _, errOut = runArgs("verify", tampered, "--cert", "../../testdata/cert.pem")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, errOut, "invalid signature")
+}
+
+func TestWSDLOps(t *testing.T) {
+	wsdlData, err := os.ReadFile("../../wsdl/testdata/stockquote.wsdl")
+	if !assert.NoError(t, err) {
+		return
+	}
+	srv := soaptest.NewServer(t)
+	srv.Handle("", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(wsdlData)
+	})
+
+	code, out, errOut := runArgs("wsdl", "ops", srv.URL+"?wsdl")
+	assert.Equal(t, exitOK, code, errOut)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if assert.Len(t, lines, 4) {
+		assert.Equal(t, []string{"BINDING", "OPERATION", "ACTION"}, strings.Fields(lines[0]))
+		assert.Equal(t, []string{"StockQuoteSoapBinding", "GetLastTradePrice", "http://example.com/GetLastTradePrice"}, strings.Fields(lines[1]))
+		assert.Equal(t, []string{"StockQuoteSoapBinding", "GetHistory"}, strings.Fields(lines[2]))
+	}
+}
+
+func TestUsage(t *testing.T) {
+	code, _, errOut := runArgs("bogus")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, errOut, "usage:")
+}
@@ -0,0 +1,85 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/m29h/xml"
+)
+
+var (
+	// ErrNilCodec is returned if a configured decoder or encoder factory returned nil
+	ErrNilCodec = errors.New("decoder or encoder factory returned nil")
+	// ErrCodecOption is returned for options which need the default encoder or decoder combined with a custom
+	// one: MTOM, packaging and the encoding of gzip and enum options with an encoder which is no *xml.Encoder,
+	// and response verification with a decoder factory.
+	ErrCodecOption = errors.New("option needs the default encoder or decoder")
+)
+
+// SOAPDecoder decodes a SOAP envelope from the stream it was created for.
+// *xml.Decoder is the default implementation.
+type SOAPDecoder interface {
+	Decode(v any) error
+}
+
+// SOAPEncoder encodes a SOAP envelope into the stream it was created for.
+// *xml.Encoder is the default implementation.
+type SOAPEncoder interface {
+	Encode(v any) error
+	Flush() error
+}
+
+// WithDecoderFactory replaces the decoder used to read response envelopes, including the root part of
+// MTOM responses. Element statistics in ResponseInfo are only collected with the default decoder. It cannot
+// be combined with WithResponseVerification, which fails with ErrCodecOption.
+func WithDecoderFactory(factory func(io.Reader) SOAPDecoder) Option {
+	return func(s *settings) error {
+		s.newDecoder = factory
+		return nil
+	}
+}
+
+// WithEncoderFactory replaces the encoder used to write request envelopes.
+// Header builders (including WS-Security signing) still operate on the envelope structs before encoding,
+// so an encoder must not alter signed elements. WithMTOM, WithPackaging, WithGzipBase64 and WithEnumPolicy
+// need an *xml.Encoder, with another encoder the requests fail with ErrCodecOption.
+func WithEncoderFactory(factory func(io.Writer) SOAPEncoder) Option {
+	return func(s *settings) error {
+		s.newEncoder = factory
+		return nil
+	}
+}
+
+func defaultEncoder(w io.Writer) SOAPEncoder {
+	return xml.NewEncoder(w)
+}
+
+// encoder returns the encoder configured in the settings.
+func (s *settings) encoder(w io.Writer) (SOAPEncoder, error) {
+	if s.newEncoder == nil {
+		return defaultEncoder(w), nil
+	}
+	enc := s.newEncoder(w)
+	if enc == nil {
+		return nil, ErrNilCodec
+	}
+	return enc, nil
+}
+
+// checkEncoder fails if enc is no *xml.Encoder and the options for the request for action need one. The
+// options only applying to decoding and the ones set to their defaults are left alone.
+func (s *settings) checkEncoder(enc SOAPEncoder, action string) error {
+	if _, ok := enc.(*xml.Encoder); ok {
+		return nil
+	}
+	switch {
+	case s.packagingOf(action) != 0:
+		return fmt.Errorf("%w: MTOM and packaging options need an *xml.Encoder", ErrCodecOption)
+	case s.gzip != nil && s.gzip.threshold != defaultGzipConfig.threshold:
+		return fmt.Errorf("%w: the threshold of WithGzipBase64 needs an *xml.Encoder", ErrCodecOption)
+	case s.enums != nil && s.enums.encode != EnumStrict:
+		return fmt.Errorf("%w: the encode policy of WithEnumPolicy needs an *xml.Encoder", ErrCodecOption)
+	}
+	return nil
+}
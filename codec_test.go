@@ -0,0 +1,106 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"io"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// prologEncoder post-processes the envelope by prepending an XML declaration.
+type prologEncoder struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (e *prologEncoder) Encode(v any) error {
+	e.buf.WriteString(xml.Header)
+	return xml.NewEncoder(&e.buf).Encode(v)
+}
+
+func (e *prologEncoder) Flush() error {
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+func TestDecoderFactory(t *testing.T) {
+	// the server omits the namespace on the response element
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><GetInfoResponse><Item>a</Item></GetInfoResponse></soap:Body></soap:Envelope>`)
+	client := NewClient(srv.URL)
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.Error(t, err)
+
+	assert.NoError(t, client.SetOptions(WithDecoderFactory(func(r io.Reader) SOAPDecoder {
+		d := xml.NewDecoder(r)
+		d.DefaultSpace = "urn:test"
+		return d
+	})))
+	resp := &infoResponse{}
+	err = client.Do(context.Background(), "GetInfo", &infoRequest{}, resp)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, resp.Items)
+}
+
+func TestEncoderFactory(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithEncoderFactory(func(w io.Writer) SOAPEncoder {
+		return &prologEncoder{w: w}
+	})))
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &quirksResponse{})
+	assert.NoError(t, err)
+	assert.Equal(t, xml.Header+`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><_:GetInfo xmlns:_="urn:test"></_:GetInfo></soapenv:Body></soapenv:Envelope>`, (*captured)[0].body)
+}
+
+func TestNilCodecFactory(t *testing.T) {
+	srv, _ := newCaptureServer(t)
+	client := NewClient(srv.URL)
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &quirksResponse{},
+		WithEncoderFactory(func(w io.Writer) SOAPEncoder { return nil }))
+	assert.ErrorIs(t, err, ErrNilCodec)
+
+	err = client.Do(context.Background(), "GetInfo", &infoRequest{}, &quirksResponse{},
+		WithDecoderFactory(func(r io.Reader) SOAPDecoder { return nil }))
+	assert.ErrorIs(t, err, ErrNilCodec)
+}
+
+// wrappingEncoder encodes with an *xml.Encoder of its own, which the options registered per encoder do not reach.
+type wrappingEncoder struct {
+	*xml.Encoder
+}
+
+func TestCodecOptions(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithEncoderFactory(func(w io.Writer) SOAPEncoder {
+		return wrappingEncoder{xml.NewEncoder(w)}
+	})))
+
+	req := &upload{Large: Attachment{Data: bytes.Repeat([]byte{2}, 200), Mode: AttachAlways}}
+	err := client.Do(context.Background(), "Upload", req, &quirksResponse{}, WithMTOM())
+	assert.ErrorIs(t, err, ErrCodecOption)
+	err = client.Do(context.Background(), "Upload", req, &quirksResponse{}, WithPackaging(PackagePlain, "Upload"))
+	assert.ErrorIs(t, err, ErrCodecOption)
+	err = client.Do(context.Background(), "GetInfo", &infoRequest{}, &quirksResponse{},
+		WithEnumPolicy(EnumPassThrough, EnumStrict))
+	assert.ErrorIs(t, err, ErrCodecOption)
+	assert.Empty(t, *captured)
+
+	// options only applying to the decoding are fine
+	err = client.Do(context.Background(), "GetInfo", &infoRequest{}, &quirksResponse{},
+		WithEnumPolicy(EnumStrict, EnumPassThrough))
+	assert.NoError(t, err)
+
+	err = client.SetOptions(WithDecoderFactory(func(r io.Reader) SOAPDecoder { return xml.NewDecoder(r) }),
+		WithResponseVerification(VerifyOptions{Roots: x509.NewCertPool()}))
+	assert.ErrorIs(t, err, ErrCodecOption)
+}
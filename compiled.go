@@ -0,0 +1,797 @@
+package soap
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+// Implements decoders compiled for a response type. The field lookup tables of the type are built once, the
+// tokens of envelopes of the common shape are then matched against them directly instead of through the
+// reflection-driven decoding of the xml package. Everything else is left to the regular decoding.
+
+var (
+	// ErrNotCompilable is returned by CompileDecoder for a type using features compiled decoders do not
+	// implement. The returned error is a *CompileError.
+	ErrNotCompilable = errors.New("type not compilable")
+)
+
+// CompileError reports the field of a type a decoder cannot be compiled for.
+type CompileError struct {
+	Type   string
+	Field  string
+	Reason string
+}
+
+func (e *CompileError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s: %s", ErrNotCompilable, e.Type, e.Reason)
+	}
+	return fmt.Sprintf("%s: field %s.%s: %s", ErrNotCompilable, e.Type, e.Field, e.Reason)
+}
+
+func (e *CompileError) Unwrap() error {
+	return ErrNotCompilable
+}
+
+// CompiledDecoder decodes responses of type T, see CompileDecoder. It is safe for concurrent use.
+type CompiledDecoder[T any] struct {
+	plan *structPlan
+}
+
+// CompileDecoder builds the decoder of responses of the struct type T. It supports fields of the kinds string,
+// bool, integers, floats, []byte and xml.Name, types implementing encoding.TextUnmarshaler such as time.Time,
+// and structs, pointers and slices of those, with element, attr, chardata and omitempty tags. Types with
+// embedded structs, "a>b" paths, innerxml, any, comment or interface fields and types implementing
+// xml.Unmarshaler, e.g. Attachment, Enum and GzipBase64, are not compilable.
+//
+// The decoder handles envelopes of the common shape: an Envelope of the SOAP version with an empty or no
+// Header and a Body holding the single response element. Other envelopes, faults among them, and input the
+// decoder fails on are decoded the regular way, so the result is always the one of UnmarshalResponse.
+func CompileDecoder[T any]() (*CompiledDecoder[T], error) {
+	c := &compiler{plans: make(map[reflect.Type]*structPlan)}
+	typ := reflect.TypeFor[T]()
+	if typ.Kind() != reflect.Struct {
+		return nil, &CompileError{Type: typ.String(), Reason: "not a struct"}
+	}
+	if err := checkUnmarshaler(typ); err != nil {
+		return nil, &CompileError{Type: typ.String(), Reason: err.Error()}
+	}
+	plan, err := c.compileStruct(typ)
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledDecoder[T]{plan: plan}, nil
+}
+
+// WithCompiledDecoder decodes responses of type *T with the compiled decoder, e.g. for the hot operation of a
+// client. The responses of other types and the calls with options changing the decoding, such as WithDecoder,
+// WithElementNameMapper, ContinueOnFieldErrors or an expected body element, are decoded as usual.
+func WithCompiledDecoder[T any](dec *CompiledDecoder[T]) Option {
+	return func(s *settings) error {
+		s.compiled = dec
+		return nil
+	}
+}
+
+// UnmarshalResponse decodes the serialized SOAP envelope data into the response like the UnmarshalResponse
+// function.
+func (c *CompiledDecoder[T]) UnmarshalResponse(data []byte, response *T) error {
+	if c.decode(data, SOAP11, nil, response) {
+		return nil
+	}
+	return UnmarshalResponse(data, response)
+}
+
+// compiledDecoder is the CompiledDecoder of any type.
+type compiledDecoder interface {
+	// decode decodes the envelope data into body, reporting false if it is to be decoded the regular way
+	decode(data []byte, version Version, entities map[string]string, body any) bool
+}
+
+func (c *CompiledDecoder[T]) decode(data []byte, version Version, entities map[string]string, body any) bool {
+	response, ok := body.(*T)
+	if !ok || response == nil {
+		return false
+	}
+	data, err := trimPrologBytes(data)
+	if err != nil {
+		return false
+	}
+	// a failed attempt leaves the response to the regular decoding untouched
+	v := *response
+	d := &compiledState{scan: scanner{data: data, entities: entities}}
+	d.bindings, d.open, d.text = d.bindingsBuf[:0], d.openBuf[:0], d.textBuf[:0]
+	if !d.envelope(version, c.plan, reflect.ValueOf(&v).Elem()) {
+		return false
+	}
+	*response = v
+	return true
+}
+
+var textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+// valueKind is how a value is decoded.
+type valueKind int
+
+const (
+	kindString valueKind = iota
+	kindBool
+	kindInt
+	kindUint
+	kindFloat
+	kindBytes
+	kindName
+	kindText
+	kindStruct
+	kindSlice
+)
+
+// valuePlan is the decoding of a value.
+type valuePlan struct {
+	kind valueKind
+	// ptr is set if the value is a pointer allocated when decoded, the other fields are of the element type
+	ptr bool
+	typ reflect.Type
+	// addrText is set for a kindText value whose UnmarshalText has a pointer receiver
+	addrText bool
+	// elem is the plan of the elements of a slice
+	elem *valuePlan
+	// fields is the plan of a struct
+	fields *structPlan
+}
+
+// fieldPlan is the decoding of the element or attribute of a struct field.
+type fieldPlan struct {
+	index int
+	name  string
+	ns    string
+	value *valuePlan
+}
+
+// structPlan is the decoding of a struct, the lookup tables of the xml package.
+type structPlan struct {
+	// name and space are the name of the XMLName tag, empty to match all
+	name, space string
+	// nameIndex is the index of the XMLName field receiving the element name, -1 if none
+	nameIndex int
+	attrs     []fieldPlan
+	elements  []fieldPlan
+	// charData is the index of the chardata field, -1 if none
+	charData     int
+	charDataPlan *valuePlan
+}
+
+type compiler struct {
+	plans map[reflect.Type]*structPlan
+}
+
+func checkUnmarshaler(typ reflect.Type) error {
+	for _, t := range []reflect.Type{typ, reflect.PointerTo(typ)} {
+		if t.Implements(reflect.TypeFor[xml.Unmarshaler]()) {
+			return errors.New("implements xml.Unmarshaler")
+		}
+		if t.Implements(reflect.TypeFor[xml.UnmarshalerAttr]()) {
+			return errors.New("implements xml.UnmarshalerAttr")
+		}
+	}
+	return nil
+}
+
+// compileStruct returns the plan of the struct type typ. The plans of recursive types refer to themselves.
+func (c *compiler) compileStruct(typ reflect.Type) (*structPlan, error) {
+	if plan, ok := c.plans[typ]; ok {
+		return plan, nil
+	}
+	plan := &structPlan{nameIndex: -1, charData: -1}
+	c.plans[typ] = plan
+	fail := func(f reflect.StructField, reason string) error {
+		return &CompileError{Type: typ.String(), Field: f.Name, Reason: reason}
+	}
+	for i := range typ.NumField() {
+		f := typ.Field(i)
+		tag := f.Tag.Get("xml")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous {
+			return nil, fail(f, "embedded fields are not supported")
+		}
+		ns, tag, hasNS := strings.Cut(tag, " ")
+		if !hasNS {
+			ns, tag = "", ns
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		mode, omitEmpty := "", false
+		for _, flag := range strings.Split(flags, ",") {
+			switch flag {
+			case "attr", "chardata", "cdata", "innerxml", "comment", "any":
+				if mode != "" {
+					return nil, fail(f, "invalid tag "+f.Tag.Get("xml"))
+				}
+				mode = flag
+			case "omitempty":
+				omitEmpty = true
+			}
+		}
+		switch {
+		case mode == "innerxml" || mode == "comment" || mode == "any":
+			return nil, fail(f, "the "+mode+" flag is not supported")
+		case mode != "" && (f.Name == xmlName || name != "" && mode != "attr"),
+			omitEmpty && (mode == "chardata" || mode == "cdata"):
+			return nil, fail(f, "invalid tag "+f.Tag.Get("xml"))
+		}
+		if ns != "" && name == "" {
+			return nil, fail(f, "namespace without name")
+		}
+		if strings.Contains(name, ">") {
+			return nil, fail(f, "paths are not supported")
+		}
+		if f.Name == xmlName {
+			plan.name, plan.space = name, ns
+			if f.Type == reflect.TypeFor[xml.Name]() {
+				plan.nameIndex = i
+			}
+			continue
+		}
+		if mode == "chardata" || mode == "cdata" {
+			if plan.charData >= 0 {
+				continue
+			}
+			value, err := c.compileCharData(f.Type)
+			if err != nil {
+				return nil, fail(f, err.Error())
+			}
+			plan.charData, plan.charDataPlan = i, value
+			continue
+		}
+		if name == "" {
+			if xmlname := taggedXMLName(reflect.Zero(f.Type).Interface()); xmlname != nil && xmlname.Local != "" {
+				name, ns = xmlname.Local, xmlname.Space
+			} else {
+				name = f.Name
+			}
+		} else if xmlname := taggedXMLName(reflect.Zero(f.Type).Interface()); mode == "" && xmlname != nil &&
+			xmlname.Local != "" && xmlname.Local != name {
+			return nil, fail(f, "name "+name+" conflicts with the XMLName "+xmlname.Local)
+		}
+		field := fieldPlan{index: i, name: name, ns: ns}
+		list := &plan.elements
+		var err error
+		if mode == "attr" {
+			list = &plan.attrs
+			field.value, err = c.compileAttr(f.Type)
+		} else {
+			field.value, err = c.compileValue(f.Type)
+		}
+		if err != nil {
+			return nil, fail(f, err.Error())
+		}
+		for _, other := range *list {
+			if other.name == field.name && (other.ns == "" || field.ns == "" || other.ns == field.ns) {
+				return nil, fail(f, "conflicts with field "+typ.Field(other.index).Name)
+			}
+		}
+		*list = append(*list, field)
+	}
+	return plan, nil
+}
+
+// deref returns the type of a pointer to be allocated.
+func deref(typ reflect.Type) (reflect.Type, bool, error) {
+	if typ.Kind() != reflect.Pointer {
+		return typ, false, nil
+	}
+	if typ.Elem().Kind() == reflect.Pointer {
+		return nil, false, errors.New("pointers to pointers are not supported")
+	}
+	return typ.Elem(), true, nil
+}
+
+// textPlan returns the plan of a type implementing encoding.TextUnmarshaler, nil if it does not.
+func textPlan(typ reflect.Type, ptr bool) *valuePlan {
+	switch {
+	case typ.Implements(textUnmarshalerType):
+		return &valuePlan{kind: kindText, ptr: ptr, typ: typ}
+	case reflect.PointerTo(typ).Implements(textUnmarshalerType):
+		return &valuePlan{kind: kindText, ptr: ptr, typ: typ, addrText: true}
+	}
+	return nil
+}
+
+// scalarPlan returns the plan of the values copyValue of the xml package decodes, nil for other types.
+func scalarPlan(typ reflect.Type, ptr bool) *valuePlan {
+	plan := &valuePlan{ptr: ptr, typ: typ}
+	switch typ.Kind() {
+	case reflect.String:
+		plan.kind = kindString
+	case reflect.Bool:
+		plan.kind = kindBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		plan.kind = kindInt
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		plan.kind = kindUint
+	case reflect.Float32, reflect.Float64:
+		plan.kind = kindFloat
+	case reflect.Slice:
+		if typ.Elem().Kind() != reflect.Uint8 {
+			return nil
+		}
+		plan.kind = kindBytes
+	default:
+		return nil
+	}
+	return plan
+}
+
+// compileValue returns the plan of the value of an element.
+func (c *compiler) compileValue(typ reflect.Type) (*valuePlan, error) {
+	typ, ptr, err := deref(typ)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUnmarshaler(typ); err != nil {
+		return nil, err
+	}
+	if plan := textPlan(typ, ptr); plan != nil {
+		return plan, nil
+	}
+	if plan := scalarPlan(typ, ptr); plan != nil {
+		return plan, nil
+	}
+	switch {
+	case typ == reflect.TypeFor[xml.Name]():
+		return &valuePlan{kind: kindName, ptr: ptr, typ: typ}, nil
+	case typ.Kind() == reflect.Struct:
+		fields, err := c.compileStruct(typ)
+		if err != nil {
+			return nil, err
+		}
+		return &valuePlan{kind: kindStruct, ptr: ptr, typ: typ, fields: fields}, nil
+	case typ.Kind() == reflect.Slice:
+		elem, err := c.compileValue(typ.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &valuePlan{kind: kindSlice, ptr: ptr, typ: typ, elem: elem}, nil
+	}
+	return nil, fmt.Errorf("%s values are not supported", typ)
+}
+
+// compileAttr returns the plan of the value of an attribute.
+func (c *compiler) compileAttr(typ reflect.Type) (*valuePlan, error) {
+	typ, ptr, err := deref(typ)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkUnmarshaler(typ); err != nil {
+		return nil, err
+	}
+	if plan := textPlan(typ, ptr); plan != nil {
+		return plan, nil
+	}
+	if plan := scalarPlan(typ, ptr); plan != nil {
+		return plan, nil
+	}
+	return nil, fmt.Errorf("%s attributes are not supported", typ)
+}
+
+// compileCharData returns the plan of the character data of a struct.
+func (c *compiler) compileCharData(typ reflect.Type) (*valuePlan, error) {
+	if typ.Kind() != reflect.Pointer {
+		if plan := textPlan(typ, false); plan != nil {
+			return plan, nil
+		}
+	}
+	elem, ptr, err := deref(typ)
+	if err != nil {
+		return nil, err
+	}
+	if plan := scalarPlan(elem, ptr); plan != nil && textPlan(typ, false) == nil {
+		return plan, nil
+	}
+	return nil, fmt.Errorf("%s character data is not supported", typ)
+}
+
+// maxDepth is the nesting limit of the xml package.
+var maxDepth = func() int {
+	if runtime.GOARCH == "wasm" {
+		return 5000
+	}
+	return 10000
+}()
+
+var errCompiledDepth = errors.New("exceeded max depth")
+
+type nsBinding struct {
+	prefix, uri string
+}
+
+type openElement struct {
+	name xml.Name
+	// bindings is the number of namespace bindings outside of the element
+	bindings int
+}
+
+// compiledState is the state of decoding an envelope. It resolves the namespaces of the raw tokens and checks
+// the nesting of the elements, as Decoder.Token does.
+type compiledState struct {
+	scan     scanner
+	bindings []nsBinding
+	open     []openElement
+	// text holds the character data of the elements being decoded
+	text []byte
+	// the initial storage of the slices, large enough for small responses
+	bindingsBuf [4]nsBinding
+	openBuf     [8]openElement
+	textBuf     [64]byte
+}
+
+// tokenKind is the kind of a token of interest to decoding.
+type tokenKind int
+
+const (
+	tokenOther tokenKind = iota
+	tokenStart
+	tokenEnd
+	tokenCharData
+)
+
+// compiledToken is a token returned by value, sparing the allocation of boxing it in an xml.Token.
+type compiledToken struct {
+	kind     tokenKind
+	start    xml.StartElement
+	end      xml.Name
+	charData xml.CharData
+}
+
+func (d *compiledState) token() (compiledToken, error) {
+	tok, err := d.scan.rawToken()
+	if err != nil {
+		return compiledToken{}, err
+	}
+	switch tok.kind {
+	case tokenStart:
+		t := &tok.start
+		d.open = append(d.open, openElement{name: t.Name, bindings: len(d.bindings)})
+		for _, a := range t.Attr {
+			switch {
+			case a.Name.Space == "xmlns":
+				d.bindings = append(d.bindings, nsBinding{prefix: a.Name.Local, uri: a.Value})
+			case a.Name.Space == "" && a.Name.Local == "xmlns":
+				d.bindings = append(d.bindings, nsBinding{uri: a.Value})
+			}
+		}
+		d.translate(&t.Name, true)
+		for i := range t.Attr {
+			d.translate(&t.Attr[i].Name, false)
+		}
+	case tokenEnd:
+		if len(d.open) == 0 {
+			return compiledToken{}, errors.New("unexpected end element")
+		}
+		top := d.open[len(d.open)-1]
+		if top.name != tok.end {
+			return compiledToken{}, errors.New("element closed by another")
+		}
+		d.open = d.open[:len(d.open)-1]
+		d.bindings = d.bindings[:top.bindings]
+	}
+	return tok, nil
+}
+
+// translate resolves the namespace prefix of n like the xml package.
+func (d *compiledState) translate(n *xml.Name, isElementName bool) {
+	switch {
+	case n.Space == "xmlns":
+		return
+	case n.Space == "" && !isElementName:
+		return
+	case n.Space == "xml":
+		n.Space = xmlNS
+	case n.Space == "" && n.Local == "xmlns":
+		return
+	}
+	for i := len(d.bindings) - 1; i >= 0; i-- {
+		if d.bindings[i].prefix == n.Space {
+			n.Space = d.bindings[i].uri
+			return
+		}
+	}
+}
+
+// skip consumes the tokens up to the end of the element started last.
+func (d *compiledState) skip() error {
+	depth := 0
+	for {
+		tok, err := d.token()
+		if err != nil {
+			return err
+		}
+		switch tok.kind {
+		case tokenStart:
+			depth++
+		case tokenEnd:
+			if depth == 0 {
+				return nil
+			}
+			depth--
+		}
+	}
+}
+
+// envelope decodes an envelope of the common shape into v, reporting false for any other input.
+func (d *compiledState) envelope(version Version, plan *structPlan, v reflect.Value) bool {
+	ns := version.namespace()
+	start, ok := d.rootElement()
+	if !ok || start.Name.Space != ns || start.Name.Local != "Envelope" {
+		return false
+	}
+	decoded := false
+	for {
+		tok, err := d.token()
+		if err != nil {
+			return false
+		}
+		switch tok.kind {
+		case tokenStart:
+			switch {
+			case tok.start.Name.Space == ns && tok.start.Name.Local == "Header":
+				if !d.emptyElement() {
+					return false
+				}
+			case tok.start.Name.Space == ns && tok.start.Name.Local == "Body" && !decoded:
+				if !d.body(ns, plan, v) {
+					return false
+				}
+				decoded = true
+			default:
+				return false
+			}
+		case tokenEnd:
+			return decoded
+		}
+	}
+}
+
+func (d *compiledState) rootElement() (xml.StartElement, bool) {
+	for {
+		tok, err := d.token()
+		if err != nil {
+			return xml.StartElement{}, false
+		}
+		if tok.kind == tokenStart {
+			return tok.start, true
+		}
+	}
+}
+
+// emptyElement consumes the element started last, reporting whether it has no child elements.
+func (d *compiledState) emptyElement() bool {
+	for {
+		tok, err := d.token()
+		if err != nil {
+			return false
+		}
+		switch tok.kind {
+		case tokenStart:
+			return false
+		case tokenEnd:
+			return true
+		}
+	}
+}
+
+// body decodes the single element of the body into v.
+func (d *compiledState) body(ns string, plan *structPlan, v reflect.Value) bool {
+	decoded := false
+	for {
+		tok, err := d.token()
+		if err != nil {
+			return false
+		}
+		switch tok.kind {
+		case tokenStart:
+			if decoded || (tok.start.Name.Space == ns && tok.start.Name.Local == "Fault") {
+				return false
+			}
+			if err := d.decodeStruct(v, plan, tok.start, 0); err != nil {
+				return false
+			}
+			decoded = true
+		case tokenEnd:
+			return decoded
+		}
+	}
+}
+
+// decodeValue decodes the element start into v, following unmarshal of the xml package.
+func (d *compiledState) decodeValue(v reflect.Value, plan *valuePlan, start xml.StartElement, depth int) error {
+	if depth >= maxDepth {
+		return errCompiledDepth
+	}
+	if plan.ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(plan.typ))
+		}
+		v = v.Elem()
+	}
+	switch plan.kind {
+	case kindStruct:
+		return d.decodeStruct(v, plan.fields, start, depth)
+	case kindSlice:
+		n := v.Len()
+		v.Grow(1)
+		v.SetLen(n + 1)
+		if err := d.decodeValue(v.Index(n), plan.elem, start, depth+1); err != nil {
+			v.SetLen(n)
+			return err
+		}
+		return nil
+	case kindName:
+		*v.Addr().Interface().(*xml.Name) = start.Name
+		return d.skip()
+	}
+	mark := len(d.text)
+	defer func() { d.text = d.text[:mark] }()
+	if err := d.charData(); err != nil {
+		return err
+	}
+	return setText(v, plan, d.textSince(mark))
+}
+
+// textSince returns the character data appended to d.text since mark, nil if none like the xml package.
+func (d *compiledState) textSince(mark int) []byte {
+	if len(d.text) == mark {
+		return nil
+	}
+	return d.text[mark:]
+}
+
+// charData appends the character data of the element started last to d.text, skipping its child elements.
+func (d *compiledState) charData() error {
+	for {
+		tok, err := d.token()
+		if err != nil {
+			return err
+		}
+		switch tok.kind {
+		case tokenStart:
+			if err := d.skip(); err != nil {
+				return err
+			}
+		case tokenCharData:
+			d.text = append(d.text, tok.charData...)
+		case tokenEnd:
+			return nil
+		}
+	}
+}
+
+func (d *compiledState) decodeStruct(v reflect.Value, plan *structPlan, start xml.StartElement, depth int) error {
+	if plan.name != "" && plan.name != start.Name.Local {
+		return errors.New("unexpected element " + start.Name.Local)
+	}
+	if plan.space != "" && plan.space != start.Name.Space {
+		return errors.New("unexpected namespace " + start.Name.Space)
+	}
+	if plan.nameIndex >= 0 {
+		*v.Field(plan.nameIndex).Addr().Interface().(*xml.Name) = start.Name
+	}
+	for _, a := range start.Attr {
+		for i := range plan.attrs {
+			f := &plan.attrs[i]
+			if a.Name.Local == f.name && (f.ns == "" || f.ns == a.Name.Space) {
+				if err := setText(v.Field(f.index), f.value, []byte(a.Value)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	mark := len(d.text)
+	defer func() { d.text = d.text[:mark] }()
+tokens:
+	for {
+		tok, err := d.token()
+		if err != nil {
+			return err
+		}
+		switch tok.kind {
+		case tokenStart:
+			for i := range plan.elements {
+				f := &plan.elements[i]
+				if (f.ns == "" || f.ns == tok.start.Name.Space) && f.name == tok.start.Name.Local {
+					if err := d.decodeValue(v.Field(f.index), f.value, tok.start, depth+1); err != nil {
+						return err
+					}
+					continue tokens
+				}
+			}
+			if err := d.skip(); err != nil {
+				return err
+			}
+		case tokenCharData:
+			if plan.charData >= 0 {
+				d.text = append(d.text, tok.charData...)
+			}
+		case tokenEnd:
+			break tokens
+		}
+	}
+	if plan.charData < 0 {
+		return nil
+	}
+	return setText(v.Field(plan.charData), plan.charDataPlan, d.textSince(mark))
+}
+
+// setText sets v to the text src like copyValue of the xml package, or with UnmarshalText.
+func setText(v reflect.Value, plan *valuePlan, src []byte) error {
+	if plan.ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(plan.typ))
+		}
+		v = v.Elem()
+	}
+	switch plan.kind {
+	case kindText:
+		// the text is the unmarshaler's to keep
+		src = bytes.Clone(src)
+		if plan.addrText {
+			return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText(src)
+		}
+		return v.Interface().(encoding.TextUnmarshaler).UnmarshalText(src)
+	case kindString:
+		v.SetString(string(src))
+	case kindBytes:
+		v.SetBytes(append([]byte{}, src...))
+	case kindInt:
+		if len(src) == 0 {
+			v.SetInt(0)
+			return nil
+		}
+		i, err := strconv.ParseInt(string(bytes.TrimSpace(src)), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case kindUint:
+		if len(src) == 0 {
+			v.SetUint(0)
+			return nil
+		}
+		u, err := strconv.ParseUint(string(bytes.TrimSpace(src)), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case kindFloat:
+		if len(src) == 0 {
+			v.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(string(bytes.TrimSpace(src)), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case kindBool:
+		if len(src) == 0 {
+			v.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(string(bytes.TrimSpace(src)))
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package soap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tickerResponse struct {
+	XMLName xml.Name  `xml:"urn:quotes GetQuoteResponse"`
+	Symbol  string    `xml:"Symbol"`
+	Price   float64   `xml:"urn:quotes Price"`
+	Volume  int64     `xml:"Volume,omitempty"`
+	Open    bool      `xml:"open,attr"`
+	Updated time.Time `xml:"Updated"`
+	Limits  *struct {
+		Low  float32 `xml:"low,attr"`
+		High float32 `xml:"high,attr"`
+	} `xml:"Limits"`
+	Tags  []string `xml:"Tag"`
+	Trade []struct {
+		ID     uint16 `xml:"id,attr"`
+		Amount string `xml:",chardata"`
+	} `xml:"Trade"`
+	Raw  []byte   `xml:"Raw"`
+	Kind xml.Name `xml:"Kind"`
+}
+
+var tickerEnvelopes = []string{
+	`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<GetQuoteResponse xmlns="urn:quotes" open="true"><Symbol>ACME</Symbol><Price>12.5</Price><Volume>100</Volume>` +
+		`</GetQuoteResponse></soap:Body></soap:Envelope>`,
+	"\ufeff  <?xml version=\"1.0\"?>\n<s:Envelope xmlns:s=\"http://schemas.xmlsoap.org/soap/envelope/\" xmlns:q=\"urn:quotes\">" +
+		`<s:Header/><s:Body><q:GetQuoteResponse open="0"><q:Symbol>A&amp;B<!-- c --><![CDATA[<x>]]></q:Symbol>` +
+		`<q:Updated>2026-10-14T08:00:00Z</q:Updated><q:Limits low="1.5" high="2"/><q:Tag>a</q:Tag><q:Tag/>` +
+		`<q:Trade id="7"> 30 </q:Trade><q:Trade id="8"><q:Skipped>x</q:Skipped>40</q:Trade><Raw>AQI=</Raw>` +
+		`<q:Kind xmlns:q="urn:kinds"/><q:Price xmlns:q="urn:other">1</q:Price><Unknown><Price>2</Price></Unknown>` +
+		`</q:GetQuoteResponse></s:Body></s:Envelope>`,
+	`<?xml version='1.0' encoding="UTF-8" standalone="yes"?><!-- first --><soap:Envelope ` +
+		`xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body ><GetQuoteResponse xmlns='urn:quotes'` +
+		"\topen='true' ><Symbol>&#65;&#x42;&lt;&gt;&apos;&quot;\u00e9</Symbol><Tag>&amp;</Tag ></GetQuoteResponse>" +
+		`</soap:Body></soap:Envelope> trailing`,
+	// decoded the regular way
+	`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header><Trace xmlns="urn:t"/></soap:Header>` +
+		`<soap:Body><GetQuoteResponse xmlns="urn:quotes"><Symbol>ACME</Symbol></GetQuoteResponse></soap:Body></soap:Envelope>`,
+	`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+		`<faultcode>soap:Server</faultcode><faultstring>down</faultstring></soap:Fault></soap:Body></soap:Envelope>`,
+	`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<GetQuoteResponse xmlns="urn:quotes"><Price>high</Price></GetQuoteResponse></soap:Body></soap:Envelope>`,
+	`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<GetQuoteResponse xmlns="urn:quotes"><Symbol>ACME</Price></GetQuoteResponse></soap:Body></soap:Envelope>`,
+	`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<Other xmlns="urn:quotes"/></soap:Body></soap:Envelope>`,
+}
+
+// requireSameDecoding checks that the compiled decoder decodes data like UnmarshalResponse.
+func requireSameDecoding(t *testing.T, dec *CompiledDecoder[tickerResponse], data []byte) {
+	t.Helper()
+	var want, got tickerResponse
+	wantErr := UnmarshalResponse(data, &want)
+	gotErr := dec.UnmarshalResponse(data, &got)
+	require.Equal(t, wantErr, gotErr)
+	require.Equal(t, want, got)
+}
+
+func TestCompiledDecoder(t *testing.T) {
+	dec, err := CompileDecoder[tickerResponse]()
+	require.NoError(t, err)
+	for _, envelope := range tickerEnvelopes {
+		requireSameDecoding(t, dec, []byte(envelope))
+	}
+
+	resp := &tickerResponse{}
+	require.True(t, dec.decode([]byte(tickerEnvelopes[1]), SOAP11, nil, resp))
+	assert.Equal(t, "A&B<x>", resp.Symbol)
+	assert.Equal(t, 0.0, resp.Price)
+	assert.Equal(t, []string{"a", ""}, resp.Tags)
+	if assert.Len(t, resp.Trade, 2) {
+		assert.Equal(t, " 30 ", resp.Trade[0].Amount)
+		assert.Equal(t, uint16(8), resp.Trade[1].ID)
+	}
+	assert.Equal(t, xml.Name{Space: "urn:kinds", Local: "Kind"}, resp.Kind)
+	assert.Equal(t, []byte("AQI="), resp.Raw)
+
+	resp = &tickerResponse{}
+	require.True(t, dec.decode([]byte(tickerEnvelopes[2]), SOAP11, nil, resp))
+	assert.Equal(t, "AB<>'\"\u00e9", resp.Symbol)
+	assert.True(t, resp.Open)
+	for _, envelope := range tickerEnvelopes[3:] {
+		assert.False(t, dec.decode([]byte(envelope), SOAP11, nil, &tickerResponse{}), envelope)
+	}
+}
+
+func TestCompileDecoderNotCompilable(t *testing.T) {
+	tests := []struct {
+		name    string
+		compile func() error
+	}{
+		{name: "not a struct", compile: func() error { _, err := CompileDecoder[[]string](); return err }},
+		{name: "unmarshaler", compile: func() error {
+			_, err := CompileDecoder[struct{ File Attachment }]()
+			return err
+		}},
+		{name: "innerxml", compile: func() error {
+			_, err := CompileDecoder[struct {
+				Inner string `xml:",innerxml"`
+			}]()
+			return err
+		}},
+		{name: "path", compile: func() error {
+			_, err := CompileDecoder[struct {
+				Value string `xml:"a>b"`
+			}]()
+			return err
+		}},
+		{name: "interface", compile: func() error { _, err := CompileDecoder[struct{ Value any }](); return err }},
+		{name: "conflict", compile: func() error {
+			_, err := CompileDecoder[struct {
+				A string `xml:"urn:a Value"`
+				B string `xml:"Value"`
+			}]()
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.compile()
+			var compileErr *CompileError
+			assert.ErrorAs(t, err, &compileErr)
+			assert.ErrorIs(t, err, ErrNotCompilable)
+		})
+	}
+}
+
+func TestWithCompiledDecoder(t *testing.T) {
+	dec, err := CompileDecoder[tickerResponse]()
+	require.NoError(t, err)
+	srv := newInfoServer(t, "text/xml", tickerEnvelopes[1])
+	resp := &tickerResponse{}
+	info := &ResponseInfo{}
+	require.NoError(t, NewClient(srv.URL).Do(context.Background(), "GetQuote", &infoRequest{}, resp,
+		WithCompiledDecoder(dec), WithResponseInfo(info)))
+	assert.Equal(t, "A&B<x>", resp.Symbol)
+	assert.Positive(t, info.Elements)
+
+	srv = newInfoServer(t, "text/xml", tickerEnvelopes[4])
+	err = NewClient(srv.URL).Do(context.Background(), "GetQuote", &infoRequest{}, &tickerResponse{}, WithCompiledDecoder(dec))
+	var fault *Fault
+	if assert.ErrorAs(t, err, &fault) {
+		assert.Equal(t, "down", fault.String)
+	}
+}
+
+func FuzzCompiledDecoder(f *testing.F) {
+	for _, envelope := range tickerEnvelopes {
+		f.Add([]byte(envelope))
+	}
+	dec, err := CompileDecoder[tickerResponse]()
+	require.NoError(f, err)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var want tickerResponse
+		wantErr := UnmarshalResponse(data, &want)
+		var got tickerResponse
+		if !dec.decode(data, SOAP11, nil, &got) {
+			return
+		}
+		require.NoError(t, wantErr)
+		require.Equal(t, want, got)
+	})
+}
+
+var smallTicker = []byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+	`<GetQuoteResponse xmlns="urn:quotes"><Symbol>ACME</Symbol><Price>12.5</Price><Volume>100</Volume>` +
+	`</GetQuoteResponse></soap:Body></soap:Envelope>`)
+
+func BenchmarkUnmarshalResponse(b *testing.B) {
+	dec, err := CompileDecoder[tickerResponse]()
+	require.NoError(b, err)
+	b.Run("regular", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var resp tickerResponse
+			if err := UnmarshalResponse(smallTicker, &resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("compiled", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var resp tickerResponse
+			if err := dec.UnmarshalResponse(smallTicker, &resp); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
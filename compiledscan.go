@@ -0,0 +1,357 @@
+package soap
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/m29h/xml"
+)
+
+// errUnsupportedMarkup reports markup the scanner leaves to the xml package, such as directives, processing
+// instructions, carriage returns and names beyond ASCII. The envelope is then decoded the regular way.
+var errUnsupportedMarkup = errors.New("markup not supported by the compiled decoder")
+
+// scanner returns the raw tokens of data like Decoder.RawToken of the xml package in strict mode, for the subset
+// of XML that responses commonly consist of. It reports an error for anything the xml package would
+// reject as well as for anything outside the subset.
+type scanner struct {
+	data     []byte
+	pos      int
+	entities map[string]string
+	// buf holds character data with references replaced
+	buf []byte
+	// toClose is the name of the self-closing element returned last, pending its end element
+	toClose   xml.Name
+	needClose bool
+}
+
+func (s *scanner) rawToken() (compiledToken, error) {
+	if s.needClose {
+		s.needClose = false
+		return compiledToken{kind: tokenEnd, end: s.toClose}, nil
+	}
+	if s.pos >= len(s.data) {
+		return compiledToken{}, errors.New("unexpected EOF")
+	}
+	if s.data[s.pos] != '<' {
+		text, err := s.text(-1)
+		if err != nil {
+			return compiledToken{}, err
+		}
+		return compiledToken{kind: tokenCharData, charData: text}, nil
+	}
+	s.pos++
+	switch s.peek() {
+	case '/':
+		s.pos++
+		name, err := s.nsname()
+		if err != nil {
+			return compiledToken{}, err
+		}
+		s.space()
+		if s.peek() != '>' {
+			return compiledToken{}, errors.New("invalid characters between </" + name.Local + " and >")
+		}
+		s.pos++
+		return compiledToken{kind: tokenEnd, end: name}, nil
+	case '!':
+		return s.markup()
+	case '?':
+		return s.procInst()
+	}
+	name, err := s.nsname()
+	if err != nil {
+		return compiledToken{}, err
+	}
+	attr := []xml.Attr{}
+	for {
+		s.space()
+		switch s.peek() {
+		case '/':
+			s.pos++
+			if s.peek() != '>' {
+				return compiledToken{}, errors.New("expected /> in element")
+			}
+			s.pos++
+			s.needClose, s.toClose = true, name
+			return compiledToken{kind: tokenStart, start: xml.StartElement{Name: name, Attr: attr}}, nil
+		case '>':
+			s.pos++
+			return compiledToken{kind: tokenStart, start: xml.StartElement{Name: name, Attr: attr}}, nil
+		}
+		a := xml.Attr{}
+		if a.Name, err = s.nsname(); err != nil {
+			return compiledToken{}, err
+		}
+		s.space()
+		if s.peek() != '=' {
+			return compiledToken{}, errors.New("attribute name without = in element")
+		}
+		s.pos++
+		s.space()
+		quote := s.peek()
+		if quote != '"' && quote != '\'' {
+			return compiledToken{}, errors.New("unquoted or missing attribute value in element")
+		}
+		s.pos++
+		value, err := s.text(int(quote))
+		if err != nil {
+			return compiledToken{}, err
+		}
+		a.Value = string(value)
+		attr = append(attr, a)
+	}
+}
+
+// markup scans a comment or a CDATA section, following <.
+func (s *scanner) markup() (compiledToken, error) {
+	rest := s.data[s.pos:]
+	switch {
+	case bytes.HasPrefix(rest, []byte("!--")):
+		// the first -- ends the comment, which has to be followed by >
+		end := bytes.Index(rest[3:], []byte("--"))
+		if end < 0 || 3+end+2 >= len(rest) {
+			return compiledToken{}, errors.New("unexpected EOF")
+		}
+		if rest[3+end+2] != '>' {
+			return compiledToken{}, errors.New(`invalid sequence "--" not allowed in comments`)
+		}
+		s.pos += 3 + end + 3
+		return compiledToken{}, nil
+	case bytes.HasPrefix(rest, []byte("![CDATA[")):
+		end := bytes.Index(rest[8:], []byte("]]>"))
+		if end < 0 {
+			return compiledToken{}, errors.New("unexpected EOF in CDATA section")
+		}
+		text := rest[8 : 8+end]
+		if bytes.IndexByte(text, '\r') >= 0 {
+			return compiledToken{}, errUnsupportedMarkup
+		}
+		if err := checkCharacters(text); err != nil {
+			return compiledToken{}, err
+		}
+		s.pos += 8 + end + 3
+		return compiledToken{kind: tokenCharData, charData: text}, nil
+	}
+	return compiledToken{}, errUnsupportedMarkup
+}
+
+// procInst scans a processing instruction, following <. The XML declaration is supported in its common forms,
+// declaring version 1.0 and UTF-8 only.
+func (s *scanner) procInst() (compiledToken, error) {
+	s.pos++
+	target, err := s.name()
+	if err != nil {
+		return compiledToken{}, err
+	}
+	s.space()
+	end := bytes.Index(s.data[s.pos:], []byte("?>"))
+	if end < 0 {
+		return compiledToken{}, errors.New("unexpected EOF")
+	}
+	content := s.data[s.pos : s.pos+end]
+	s.pos += end + 2
+	if string(target) != "xml" {
+		return compiledToken{}, nil
+	}
+	for _, param := range bytes.Fields(content) {
+		key, value, ok := bytes.Cut(param, []byte("="))
+		if !ok || len(value) < 2 || value[0] != '"' && value[0] != '\'' || value[len(value)-1] != value[0] {
+			return compiledToken{}, errUnsupportedMarkup
+		}
+		value = value[1 : len(value)-1]
+		switch string(key) {
+		case "version":
+			ok = string(value) == "1.0"
+		case "encoding":
+			ok = bytes.EqualFold(value, []byte("utf-8"))
+		case "standalone":
+			ok = string(value) == "yes" || string(value) == "no"
+		default:
+			ok = false
+		}
+		if !ok {
+			return compiledToken{}, errUnsupportedMarkup
+		}
+	}
+	return compiledToken{}, nil
+}
+
+func (s *scanner) peek() byte {
+	if s.pos < len(s.data) {
+		return s.data[s.pos]
+	}
+	return 0
+}
+
+func (s *scanner) space() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\n', '\t':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// name scans a name of ASCII characters.
+func (s *scanner) name() ([]byte, error) {
+	start := s.pos
+	for s.pos < len(s.data) && isNameByte(s.data[s.pos]) {
+		s.pos++
+	}
+	if s.pos < len(s.data) && s.data[s.pos] >= utf8.RuneSelf {
+		return nil, errUnsupportedMarkup
+	}
+	name := s.data[start:s.pos]
+	if len(name) == 0 || !isNameStart(name[0]) {
+		return nil, errors.New("invalid XML name")
+	}
+	return name, nil
+}
+
+// nsname scans a name with the prefix before the colon as the name space, as nsname of the xml package does.
+func (s *scanner) nsname() (xml.Name, error) {
+	b, err := s.name()
+	if err != nil {
+		return xml.Name{}, err
+	}
+	switch i := bytes.IndexByte(b, ':'); {
+	case bytes.Count(b, []byte(":")) > 1:
+		return xml.Name{}, errors.New("invalid XML name")
+	case i <= 0 || i == len(b)-1:
+		return xml.Name{Local: string(b)}, nil
+	default:
+		return xml.Name{Space: string(b[:i]), Local: string(b[i+1:])}, nil
+	}
+}
+
+// text scans character data up to < or, if quote is not -1, the closing quote, replacing the references.
+// The result is valid up to the next call.
+func (s *scanner) text(quote int) ([]byte, error) {
+	start, replaced := s.pos, false
+	s.buf = s.buf[:0]
+	for s.pos < len(s.data) {
+		b := s.data[s.pos]
+		switch {
+		case b == '<':
+			if quote >= 0 {
+				return nil, errors.New("unescaped < inside quoted string")
+			}
+		case int(b) == quote:
+		case b == '&':
+			s.buf = append(s.buf, s.data[start:s.pos]...)
+			if err := s.reference(); err != nil {
+				return nil, err
+			}
+			start, replaced = s.pos, true
+			continue
+		case b == '\r':
+			return nil, errUnsupportedMarkup
+		case b == '>' && s.pos-start >= 2 && s.data[s.pos-1] == ']' && s.data[s.pos-2] == ']':
+			return nil, errors.New("unescaped ]]> not in CDATA section")
+		default:
+			s.pos++
+			continue
+		}
+		break
+	}
+	text := s.data[start:s.pos]
+	if quote >= 0 {
+		if s.pos >= len(s.data) {
+			return nil, errors.New("unexpected EOF")
+		}
+		s.pos++
+	}
+	if replaced {
+		s.buf = append(s.buf, text...)
+		text = s.buf
+	}
+	if err := checkCharacters(text); err != nil {
+		return nil, err
+	}
+	return text, nil
+}
+
+// reference appends the replacement of the character or entity reference at & to buf.
+func (s *scanner) reference() error {
+	s.pos++
+	end := bytes.IndexByte(s.data[s.pos:], ';')
+	if end < 0 {
+		return errors.New("invalid character entity")
+	}
+	ref := s.data[s.pos : s.pos+end]
+	s.pos += end + 1
+	if len(ref) > 0 && ref[0] == '#' {
+		digits, base := ref[1:], 10
+		if len(digits) > 0 && digits[0] == 'x' {
+			digits, base = digits[1:], 16
+		}
+		n, err := strconv.ParseUint(string(digits), base, 64)
+		if err != nil || len(digits) == 0 || digits[0] == '+' || n > unicode.MaxRune {
+			return errors.New("invalid character entity")
+		}
+		s.buf = utf8.AppendRune(s.buf, rune(n))
+		return nil
+	}
+	if len(ref) == 0 {
+		return errors.New("invalid character entity")
+	}
+	for i, b := range ref {
+		if !isNameByte(b) || (i == 0 && !isNameStart(b)) {
+			return errUnsupportedMarkup
+		}
+	}
+	switch string(ref) {
+	case "lt":
+		s.buf = append(s.buf, '<')
+	case "gt":
+		s.buf = append(s.buf, '>')
+	case "amp":
+		s.buf = append(s.buf, '&')
+	case "apos":
+		s.buf = append(s.buf, '\'')
+	case "quot":
+		s.buf = append(s.buf, '"')
+	default:
+		text, ok := s.entities[string(ref)]
+		if !ok {
+			return errors.New("invalid character entity")
+		}
+		s.buf = append(s.buf, text...)
+	}
+	return nil
+}
+
+func isNameByte(b byte) bool {
+	return 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || '0' <= b && b <= '9' ||
+		b == '_' || b == ':' || b == '.' || b == '-'
+}
+
+func isNameStart(b byte) bool {
+	return 'A' <= b && b <= 'Z' || 'a' <= b && b <= 'z' || b == '_' || b == ':'
+}
+
+// checkCharacters reports text which is not UTF-8 or has characters outside of the XML character range.
+func checkCharacters(text []byte) error {
+	for i := 0; i < len(text); {
+		b := text[i]
+		if b >= 0x20 && b < utf8.RuneSelf || b == '\t' || b == '\n' || b == '\r' {
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRune(text[i:])
+		if r == utf8.RuneError && size == 1 {
+			return errors.New("invalid UTF-8")
+		}
+		if !(r >= 0x20 && r <= 0xD7FF || r >= 0xE000 && r <= 0xFFFD || r >= 0x10000 && r <= 0x10FFFF) {
+			return errors.New("illegal character")
+		}
+		i += size
+	}
+	return nil
+}
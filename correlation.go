@@ -0,0 +1,60 @@
+package soap
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Implements correlation IDs making calls traceable end-to-end.
+// An ID found in the context (e.g. taken from an incoming HTTP request) is reused, otherwise one is generated.
+
+type correlationIDKey struct{}
+
+// ContextWithCorrelationID returns a copy of ctx carrying the correlation id. Calls made with this context
+// send id instead of generating a new one.
+func ContextWithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationIDFromContext returns the correlation id stored in ctx by ContextWithCorrelationID.
+func CorrelationIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(correlationIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// WithCorrelationID sends a correlation id as HTTP header headerName with every call. The id is taken from
+// the context if present, otherwise it is created by gen. A nil gen creates random UUIDs.
+// If the server echoes the header, its value is recorded in ResponseInfo.EchoedCorrelationID.
+func WithCorrelationID(headerName string, gen func(ctx context.Context) string) Option {
+	return func(s *settings) error {
+		if gen == nil {
+			gen = func(context.Context) string {
+				return uuid.New().String()
+			}
+		}
+		s.correlationHeader = headerName
+		s.correlationGen = gen
+		return nil
+	}
+}
+
+// WithCorrelationSOAPHeader additionally sends the correlation id configured with WithCorrelationID as the
+// SOAP header element returned by build.
+func WithCorrelationSOAPHeader(build func(id string) any) Option {
+	return func(s *settings) error {
+		s.correlationSOAPHeader = build
+		return nil
+	}
+}
+
+// correlationID returns the id to use for a call made with ctx or "" if correlation ids are disabled.
+func (s *settings) correlationID(ctx context.Context) string {
+	if s.correlationGen == nil {
+		return ""
+	}
+	if id, ok := CorrelationIDFromContext(ctx); ok {
+		return id
+	}
+	return s.correlationGen(ctx)
+}
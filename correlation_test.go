@@ -0,0 +1,91 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type correlationHeader struct {
+	XMLName xml.Name `xml:"urn:test CorrelationID"`
+	Value   string   `xml:",chardata"`
+}
+
+func newEchoServer(t *testing.T, header string) (*httptest.Server, *[]capturedRequest) {
+	t.Helper()
+	var captured []capturedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		captured = append(captured, capturedRequest{header: r.Header.Clone(), body: string(b)})
+		w.Header().Set(header, r.Header.Get(header))
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &captured
+}
+
+func TestCorrelationID(t *testing.T) {
+	srv, captured := newEchoServer(t, "X-Request-ID")
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(
+		WithCorrelationID("X-Request-ID", nil),
+		WithCorrelationSOAPHeader(func(id string) any { return correlationHeader{Value: id} }),
+	))
+
+	var info ResponseInfo
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithResponseInfo(&info))
+	assert.NoError(t, err)
+	id := (*captured)[0].header.Get("X-Request-ID")
+	assert.Len(t, id, 36)
+	assert.Contains(t, (*captured)[0].body, `<_:CorrelationID xmlns:_="urn:test">`+id+`</_:CorrelationID>`)
+	assert.Equal(t, id, info.CorrelationID)
+	assert.Equal(t, id, info.EchoedCorrelationID)
+
+	// an id from the context is passed on
+	ctx := ContextWithCorrelationID(context.Background(), "incoming-42")
+	err = client.Do(ctx, "GetInfo", &infoRequest{}, &infoResponse{}, WithResponseInfo(&info))
+	assert.NoError(t, err)
+	assert.Equal(t, "incoming-42", (*captured)[1].header.Get("X-Request-ID"))
+	assert.Equal(t, "incoming-42", info.CorrelationID)
+}
+
+func TestCorrelationIDGenerator(t *testing.T) {
+	srv, captured := newEchoServer(t, "X-Correlation")
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithCorrelationID("X-Correlation", func(ctx context.Context) string {
+		return "generated"
+	})))
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.NoError(t, err)
+	assert.Equal(t, "generated", (*captured)[0].header.Get("X-Correlation"))
+	assert.False(t, strings.Contains((*captured)[0].body, "CorrelationID"))
+
+	_, ok := CorrelationIDFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func TestCorrelationIDLogged(t *testing.T) {
+	srv, _ := newEchoServer(t, "X-Request-ID")
+	client := NewClient(srv.URL)
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	assert.NoError(t, client.SetOptions(WithCorrelationID("X-Request-ID", nil), WithLogger(logger)))
+
+	ctx := ContextWithCorrelationID(context.Background(), "abc")
+	err := client.Do(ctx, "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "action=GetInfo")
+	assert.Contains(t, buf.String(), "correlation_id=abc")
+	assert.Contains(t, buf.String(), "status=200")
+}
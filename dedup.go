@@ -0,0 +1,277 @@
+package soap
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the deduplication of identical calls made within a short window, e.g. the two calls of a form
+// submitted twice by a web frontend.
+
+var (
+	// ErrDuplicateRequest is returned for a call identical to one in flight or completed within the window
+	// of WithDedupWindow, if its action is deduplicated with DedupReject. The returned error is a
+	// *DuplicateRequestError.
+	ErrDuplicateRequest = errors.New("duplicate request")
+)
+
+// DuplicateRequestError reports a call rejected as duplicate of an earlier call.
+type DuplicateRequestError struct {
+	Action string
+	// InFlight is set if the earlier call had not completed yet.
+	InFlight bool
+}
+
+func (e *DuplicateRequestError) Error() string {
+	state := "completed"
+	if e.InFlight {
+		state = "in flight"
+	}
+	return fmt.Sprintf("%s: identical call of %s %s", ErrDuplicateRequest, e.Action, state)
+}
+
+func (e *DuplicateRequestError) Unwrap() error {
+	return ErrDuplicateRequest
+}
+
+// DedupMode selects how the duplicates of the calls of an action are handled, see WithDedupWindow.
+type DedupMode int
+
+const (
+	// DedupShare waits for the earlier call and returns its result, its response copied into the response of
+	// the duplicate. It is the default.
+	DedupShare DedupMode = iota + 1
+	// DedupReject fails the duplicate with *DuplicateRequestError.
+	DedupReject
+	// DedupOff makes every call.
+	DedupOff
+)
+
+// WithDedupWindow detects calls identical to a call in flight or to a call that completed successfully less
+// than d ago, and handles them as WithDedupMode says instead of sending them. Calls are identical if keyFn
+// returns the same key for them, DedupKey by default; an empty key makes the call. Set it on the client, the
+// calls of a client are only compared with one another.
+//
+// Calls are never identified across credentials: the keys are scoped by the endpoint, by the session of
+// WithSessionStore and by the SOAP headers built for the call, the certificate standing for the headers signed
+// with WSSEAuthInfo. The header builders are therefore called once more per call, unless the call is denied by
+// an action policy or rejected by an open circuit breaker. TLS client certificates cannot differ between the
+// calls of a client, passed to a single call they fail it with ErrTransportOption. Headers changing with every
+// call, such as nonces, let all calls through. Credentials added to the HTTP request by send hooks are not known
+// before the call is made, a client adding credentials per call that way has to put them into the key with keyFn.
+//
+// A shared response is a shallow copy, slices and maps are shared with the response of the earlier call.
+// Responses of different types are not shared, the duplicate fails with *DuplicateRequestError. Failed calls
+// share their error with the duplicates waiting for them and are forgotten once completed, so a repeated call
+// is made.
+func WithDedupWindow(d time.Duration, keyFn func(action string, request any) string) Option {
+	return func(s *settings) error {
+		if d < 0 {
+			return fmt.Errorf("negative dedup window %s", d)
+		}
+		if keyFn == nil {
+			keyFn = DedupKey
+		}
+		s.dedup = &dedupGuard{window: d, key: keyFn, calls: make(map[string]*dedupCall)}
+		return nil
+	}
+}
+
+// WithDedupMode handles the duplicates of the calls of the actions with mode, or of all actions not given a
+// mode without actions. It only applies together with WithDedupWindow.
+func WithDedupMode(mode DedupMode, actions ...string) Option {
+	return func(s *settings) error {
+		if mode != DedupShare && mode != DedupReject && mode != DedupOff {
+			return fmt.Errorf("unknown dedup mode %d", mode)
+		}
+		if len(actions) == 0 {
+			s.defaultDedupMode = mode
+			return nil
+		}
+		modes := make(map[string]DedupMode, len(s.dedupModes)+len(actions))
+		for a, m := range s.dedupModes {
+			modes[a] = m
+		}
+		for _, a := range actions {
+			modes[a] = mode
+		}
+		s.dedupModes = modes
+		return nil
+	}
+}
+
+// DedupKey returns the default key of WithDedupWindow, a hash of the action and of the request serialized to
+// XML. It returns "" for requests that cannot be serialized.
+func DedupKey(action string, request any) string {
+	body, err := xml.Marshal(request)
+	if err != nil {
+		return ""
+	}
+	h := sha256.New()
+	_ = json.NewEncoder(h).Encode(action)
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// dedupModeOf returns the mode for the duplicates of the calls of action.
+func (s *settings) dedupModeOf(action string) DedupMode {
+	if m, ok := s.dedupModes[action]; ok {
+		return m
+	}
+	if s.defaultDedupMode != 0 {
+		return s.defaultDedupMode
+	}
+	return DedupShare
+}
+
+// dedupGuard tracks the calls of a client for WithDedupWindow.
+type dedupGuard struct {
+	window time.Duration
+	key    func(action string, request any) string
+
+	mu    sync.Mutex
+	calls map[string]*dedupCall
+}
+
+// dedupCall is a call in flight or completed within the window.
+type dedupCall struct {
+	done chan struct{}
+	// completed is the time the call completed, zero while it is in flight
+	completed time.Time
+	err       error
+	// response is a copy of the response taken once the call completed
+	response reflect.Value
+}
+
+// dedup makes the call with run unless it is a duplicate.
+func (c *Client) dedup(ctx context.Context, cl *call, run func() error) error {
+	g := cl.settings.dedup
+	mode := cl.settings.dedupModeOf(cl.action)
+	// calls denied or rejected by the breaker fail without sending and are not worth building the key for
+	if mode == DedupOff || cl.settings.deniedAction(ctx, cl.action, cl.url) != nil || cl.settings.circuitOpen() {
+		return run()
+	}
+	key, err := c.dedupKey(ctx, cl)
+	if err != nil || key == "" {
+		return run()
+	}
+
+	clock := cl.settings.timeSource()
+	g.mu.Lock()
+	g.prune(clock.Now())
+	if earlier, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		return earlier.share(ctx, cl, mode)
+	}
+	current := &dedupCall{done: make(chan struct{})}
+	g.calls[key] = current
+	g.mu.Unlock()
+
+	err = run()
+	if err == nil {
+		if v := reflect.ValueOf(cl.response); v.Kind() == reflect.Pointer && !v.IsNil() {
+			current.response = reflect.New(v.Elem().Type())
+			current.response.Elem().Set(v.Elem())
+		}
+	}
+	g.mu.Lock()
+	current.completed, current.err = clock.Now(), err
+	if err != nil && g.calls[key] == current {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	close(current.done)
+	return err
+}
+
+// share returns the result of the earlier call to its duplicate, see WithDedupWindow.
+func (d *dedupCall) share(ctx context.Context, cl *call, mode DedupMode) error {
+	select {
+	case <-d.done:
+	default:
+		if mode == DedupReject {
+			return &DuplicateRequestError{Action: cl.action, InFlight: true}
+		}
+		select {
+		case <-d.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if mode == DedupReject {
+		return &DuplicateRequestError{Action: cl.action}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if cl.response == nil {
+		return nil
+	}
+	dst := reflect.ValueOf(cl.response)
+	if !d.response.IsValid() || dst.Type() != d.response.Type() || dst.IsNil() {
+		return &DuplicateRequestError{Action: cl.action}
+	}
+	dst.Elem().Set(d.response.Elem())
+	return nil
+}
+
+// prune forgets the calls completed a window ago.
+func (g *dedupGuard) prune(now time.Time) {
+	for key, d := range g.calls {
+		if !d.completed.IsZero() && now.Sub(d.completed) >= g.window {
+			delete(g.calls, key)
+		}
+	}
+}
+
+// dedupKey returns the key of the call scoped by its endpoint and credentials, "" if the call is not to be
+// deduplicated.
+func (c *Client) dedupKey(ctx context.Context, cl *call) (string, error) {
+	key := cl.settings.dedup.key(cl.action, cl.request)
+	if key == "" {
+		return "", nil
+	}
+	envelope, err := cl.settings.buildEnvelope(contextWithClock(contextWithAttempt(ctx, 1), &cl.settings),
+		cl.request, c.headers)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	enc := json.NewEncoder(h)
+	_ = enc.Encode(cl.url)
+	_ = enc.Encode(key)
+	// the session of the call stands for its cookies
+	_ = enc.Encode(fmt.Sprintf("%p", cl.settings.session))
+	if envelope.Header != nil {
+		for _, hdr := range flattenHeaders(nil, envelope.Header.Headers) {
+			var data []byte
+			switch v := hdr.(type) {
+			case nil:
+				continue
+			case *pendingSecurity:
+				data = []byte("security")
+				for _, der := range v.config.Certificate.Certificate {
+					data = append(data, der...)
+				}
+			case RawHeader:
+				data = v.XML
+			default:
+				if data, err = xml.Marshal(v); err != nil {
+					return "", err
+				}
+			}
+			// quoted, so the headers cannot run into each other
+			_ = enc.Encode(data)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,223 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDedupServer returns a server answering with infoResponseBody after the block channel is closed, and
+// the number of requests it received. The requests are announced on arrived.
+func newDedupServer(t *testing.T, block chan struct{}) (*httptest.Server, *atomic.Int32, chan struct{}) {
+	t.Helper()
+	var hits atomic.Int32
+	arrived := make(chan struct{}, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		arrived <- struct{}{}
+		<-block
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits, arrived
+}
+
+func TestDedupShare(t *testing.T) {
+	block := make(chan struct{})
+	srv, hits, arrived := newDedupServer(t, block)
+	clock := &manualClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithDedupWindow(time.Second, nil), WithClock(clock)))
+
+	var wg sync.WaitGroup
+	responses := make([]*infoResponse, 3)
+	errs := make([]error, 3)
+	call := func(i int) {
+		defer wg.Done()
+		responses[i] = &infoResponse{}
+		errs[i] = client.Do(context.Background(), "GetInfo", &infoRequest{}, responses[i])
+	}
+	wg.Add(1)
+	go call(0)
+	<-arrived
+	wg.Add(2)
+	go call(1)
+	go call(2)
+	time.Sleep(10 * time.Millisecond)
+	close(block)
+	wg.Wait()
+	for i := range responses {
+		require.NoError(t, errs[i])
+		assert.Equal(t, []string{"a", "b"}, responses[i].Items)
+	}
+	assert.Equal(t, int32(1), hits.Load())
+
+	// completed calls are shared within the window
+	clock.NewTimer(999 * time.Millisecond)
+	resp := &infoResponse{}
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, resp))
+	assert.Equal(t, []string{"a", "b"}, resp.Items)
+	assert.Equal(t, int32(1), hits.Load())
+
+	clock.NewTimer(time.Millisecond)
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, int32(2), hits.Load())
+
+	// responses of another type are not shared
+	var other struct {
+		Items []string `xml:"urn:test GetInfoResponse>Item"`
+	}
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &other)
+	assert.ErrorIs(t, err, ErrDuplicateRequest)
+}
+
+func TestDedupModes(t *testing.T) {
+	block := make(chan struct{})
+	close(block)
+	srv, hits, _ := newDedupServer(t, block)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithDedupWindow(time.Minute, nil), WithDedupMode(DedupReject, "GetInfo")))
+
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, ErrDuplicateRequest)
+	assert.EqualError(t, err, "duplicate request: identical call of GetInfo completed")
+	assert.Equal(t, int32(1), hits.Load())
+
+	// other actions are shared, the action is part of the key
+	require.NoError(t, client.Do(context.Background(), "GetInfoV2", &infoRequest{}, &infoResponse{}))
+	require.NoError(t, client.Do(context.Background(), "GetInfoV2", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, int32(2), hits.Load())
+
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+		WithDedupMode(DedupOff, "GetInfo")))
+	assert.Equal(t, int32(3), hits.Load())
+
+	// an empty key makes the call
+	require.NoError(t, client.SetOptions(WithDedupWindow(time.Minute, func(string, any) string { return "" })))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, int32(5), hits.Load())
+
+	assert.Error(t, client.SetOptions(WithDedupMode(DedupMode(9))))
+	assert.Error(t, client.SetOptions(WithDedupWindow(-time.Second, nil)))
+}
+
+func TestDedupRejectInFlight(t *testing.T) {
+	block := make(chan struct{})
+	srv, hits, arrived := newDedupServer(t, block)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithDedupWindow(0, nil), WithDedupMode(DedupReject)))
+
+	done := make(chan error)
+	go func() { done <- client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}) }()
+	<-arrived
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	var dup *DuplicateRequestError
+	if assert.ErrorAs(t, err, &dup) {
+		assert.Equal(t, &DuplicateRequestError{Action: "GetInfo", InFlight: true}, dup)
+	}
+	close(block)
+	require.NoError(t, <-done)
+
+	// without window completed calls are not remembered
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+type tokenKey struct{}
+
+func TestDedupCredentials(t *testing.T) {
+	block := make(chan struct{})
+	close(block)
+	srv, hits, _ := newDedupServer(t, block)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithDedupWindow(time.Minute, nil),
+		WithHeaderBuilder(func(ctx context.Context, body any) (any, error) {
+			return RawHeader{XML: []byte(`<Token xmlns="urn:auth">` + ctx.Value(tokenKey{}).(string) + `</Token>`)}, nil
+		})))
+
+	alice := context.WithValue(context.Background(), tokenKey{}, "alice")
+	bob := context.WithValue(context.Background(), tokenKey{}, "bob")
+	require.NoError(t, client.Do(alice, "GetInfo", &infoRequest{}, &infoResponse{}))
+	require.NoError(t, client.Do(bob, "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, int32(2), hits.Load())
+	require.NoError(t, client.Do(alice, "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, int32(2), hits.Load())
+
+	// the signing certificate stands for the signed Security header
+	cfg := securityConfig(t)
+	signed := WithHeaderBuilder(func(context.Context, any) (any, error) { return &pendingSecurity{config: cfg}, nil })
+	require.NoError(t, client.Do(alice, "GetInfo", &infoRequest{}, &infoResponse{}, signed))
+	assert.Equal(t, int32(3), hits.Load())
+	require.NoError(t, client.Do(alice, "GetInfo", &infoRequest{}, &infoResponse{}, signed))
+	assert.Equal(t, int32(3), hits.Load())
+
+	// the calls of another client are not compared
+	other := NewClient(srv.URL + "/other")
+	require.NoError(t, other.SetOptions(WithDedupWindow(time.Minute, nil)))
+	require.NoError(t, other.Do(alice, "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, int32(4), hits.Load())
+}
+
+func TestDedupFailedCall(t *testing.T) {
+	srv, requests := newFlakyServer(t, 1, http.StatusServiceUnavailable)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithDedupWindow(time.Minute, nil)))
+
+	assert.Error(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Len(t, *requests, 2)
+}
+
+func TestDedupSessions(t *testing.T) {
+	block := make(chan struct{})
+	close(block)
+	srv, hits, _ := newDedupServer(t, block)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithDedupWindow(time.Minute, nil)))
+
+	session := WithSessionStore(NewFileSessionStore(filepath.Join(t.TempDir(), "session.json")))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, session))
+	assert.Equal(t, int32(2), hits.Load())
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, session))
+	assert.Equal(t, int32(2), hits.Load())
+}
+
+func TestDedupRejectedCalls(t *testing.T) {
+	block := make(chan struct{})
+	close(block)
+	srv, hits, _ := newDedupServer(t, block)
+	var built atomic.Int32
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithDedupWindow(time.Minute, nil),
+		WithHeaderBuilder(func(context.Context, any) (any, error) {
+			built.Add(1)
+			return nil, nil
+		})))
+
+	// the headers are neither built for the key nor for the request
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+		WithActionPolicy(AllowActions("Other")))
+	assert.ErrorIs(t, err, ErrActionDenied)
+
+	breaker := &ConsecutiveBreaker{Threshold: 1, ResetTimeout: time.Minute}
+	done, err := breaker.Allow()
+	require.NoError(t, err)
+	done(false)
+	err = client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithCircuitBreaker(breaker))
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Zero(t, built.Load())
+	assert.Zero(t, hits.Load())
+}
@@ -0,0 +1,158 @@
+package soap
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// Implements the digest headers of MIME parts, Content-MD5 of RFC 1864 and Content-Digest of RFC 9530, for
+// services checking the integrity of every part of a multipart message.
+
+var (
+	// ErrDigestMismatch is returned if the content of a received MIME part does not match its digest header.
+	// The returned error is a *DigestMismatchError.
+	ErrDigestMismatch = errors.New("MIME part digest mismatch")
+)
+
+// DigestMismatchError reports a MIME part whose content does not match its digest header.
+type DigestMismatchError struct {
+	// ContentID is the Content-ID of the part without angle brackets.
+	ContentID string
+	// Header is the digest header, Content-MD5 or Content-Digest.
+	Header string
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("%s: %s of part %s", ErrDigestMismatch, e.Header, e.ContentID)
+}
+
+func (e *DigestMismatchError) Unwrap() error {
+	return ErrDigestMismatch
+}
+
+// DigestAlgorithm is a digest sent along with the MIME parts of MTOM requests.
+type DigestAlgorithm int
+
+const (
+	// DigestMD5 sends the Content-MD5 header.
+	DigestMD5 DigestAlgorithm = iota + 1
+	// DigestSHA256 sends the Content-Digest header with the sha-256 digest.
+	DigestSHA256
+)
+
+// WithAttachmentDigests adds the digest headers of the algorithms to every MIME part of MTOM requests, and
+// verifies the Content-MD5 and Content-Digest headers of the MIME parts of multipart responses. Received parts
+// are hashed as they are read, so spilling them to an attachment store still does not hold them in memory;
+// a part not matching a digest fails the call with a *DigestMismatchError. Content-Digest values of other
+// algorithms than sha-256 and md5 are ignored. Without algorithms, the digests are only verified.
+func WithAttachmentDigests(algorithms ...DigestAlgorithm) Option {
+	return func(s *settings) error {
+		for _, alg := range algorithms {
+			if alg != DigestMD5 && alg != DigestSHA256 {
+				return fmt.Errorf("unknown digest algorithm %d", alg)
+			}
+		}
+		s.digests = &digestConfig{algorithms: algorithms}
+		return nil
+	}
+}
+
+type digestConfig struct {
+	algorithms []DigestAlgorithm
+}
+
+// setHeaders sets the digest headers of the part content data.
+func (c *digestConfig) setHeaders(header textproto.MIMEHeader, data []byte) {
+	if c == nil {
+		return
+	}
+	for _, alg := range c.algorithms {
+		switch alg {
+		case DigestMD5:
+			sum := md5.Sum(data)
+			header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		case DigestSHA256:
+			sum := sha256.Sum256(data)
+			header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		}
+	}
+}
+
+// verify returns r checking the content of the part with header against its digest headers once read to the
+// end, r itself if there is nothing to check.
+func (c *digestConfig) verify(header textproto.MIMEHeader, r io.Reader) io.Reader {
+	if c == nil {
+		return r
+	}
+	d := &digestReader{r: r, contentID: partContentID(header.Get("Content-ID"))}
+	if v := header.Get("Content-MD5"); v != "" {
+		d.add("Content-MD5", md5.New(), v)
+	}
+	if v := header.Get("Content-Digest"); v != "" {
+		for _, member := range strings.Split(v, ",") {
+			alg, value, _ := strings.Cut(strings.TrimSpace(member), "=")
+			// byte sequences are enclosed in colons, anything else fails to match
+			value = strings.TrimSpace(value)
+			if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+				value = ""
+			} else {
+				value = value[1 : len(value)-1]
+			}
+			switch strings.ToLower(strings.TrimSpace(alg)) {
+			case "sha-256":
+				d.add("Content-Digest", sha256.New(), value)
+			case "md5":
+				d.add("Content-Digest", md5.New(), value)
+			}
+		}
+	}
+	if len(d.checks) == 0 {
+		return r
+	}
+	return d
+}
+
+// digestReader hashes the content read, failing at its end if it does not match a digest.
+type digestReader struct {
+	r         io.Reader
+	contentID string
+	checks    []digestCheck
+}
+
+type digestCheck struct {
+	header string
+	hash   hash.Hash
+	// want is the digest of the header, nil if it is no valid base64
+	want []byte
+}
+
+func (d *digestReader) add(header string, h hash.Hash, value string) {
+	want, err := base64.StdEncoding.DecodeString(value)
+	if err != nil || len(want) == 0 {
+		want = nil
+	}
+	d.checks = append(d.checks, digestCheck{header: header, hash: h, want: want})
+}
+
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	for _, c := range d.checks {
+		c.hash.Write(p[:n])
+	}
+	if err == io.EOF {
+		for _, c := range d.checks {
+			if !bytes.Equal(c.hash.Sum(nil), c.want) {
+				return n, &DigestMismatchError{ContentID: d.contentID, Header: c.header}
+			}
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,120 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTamperingServer forwards requests to the echo server and returns its response with the attachment
+// content of 2 bytes changed.
+func newTamperingServer(t *testing.T) (*httptest.Server, *[]textproto.MIMEHeader) {
+	t.Helper()
+	echo, _ := newMTOMEchoServer(t)
+	var headers []textproto.MIMEHeader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := http.Post(echo.URL, r.Header.Get("Content-Type"), r.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		headers = nil
+		_, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for part, err := mr.NextPart(); err == nil; part, err = mr.NextPart() {
+			headers = append(headers, part.Header)
+		}
+		w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+		_, _ = w.Write(bytes.ReplaceAll(body, []byte{2, 2}, []byte{2, 3}))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &headers
+}
+
+func TestAttachmentDigests(t *testing.T) {
+	srv, parts := newMTOMEchoServer(t)
+	data := bytes.Repeat([]byte{2}, 200)
+	req := &upload{Large: Attachment{Data: data, Mode: AttachAlways, ContentID: "large@example"}}
+	resp := &upload{}
+	attachments := NewAttachments(NewMemoryStore(), 10)
+	require.NoError(t, NewClient(srv.URL).Do(context.Background(), "Upload", req, resp, WithMTOM(),
+		WithAttachmentDigests(DigestMD5, DigestSHA256), WithAttachmentStore(attachments)))
+	assert.Len(t, *parts, 2)
+	assert.Equal(t, data, readAttachment(t, resp.Large))
+	require.NoError(t, attachments.Close())
+
+	tampering, headers := newTamperingServer(t)
+	tests := []struct {
+		name    string
+		digests []DigestAlgorithm
+		header  string
+	}{
+		{name: "md5", digests: []DigestAlgorithm{DigestMD5}, header: "Content-MD5"},
+		{name: "sha-256", digests: []DigestAlgorithm{DigestSHA256}, header: "Content-Digest"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attachments := NewAttachments(NewMemoryStore(), 10)
+			err := NewClient(tampering.URL).Do(context.Background(), "Upload", req, &upload{}, WithMTOM(),
+				WithAttachmentDigests(tt.digests...), WithAttachmentStore(attachments))
+			var mismatch *DigestMismatchError
+			if assert.ErrorAs(t, err, &mismatch) {
+				assert.Equal(t, &DigestMismatchError{ContentID: "large@example", Header: tt.header}, mismatch)
+			}
+			assert.ErrorIs(t, err, ErrDigestMismatch)
+			assert.Empty(t, attachments.ContentIDs())
+
+			require.Len(t, *headers, 2)
+			md5Sum, shaSum := md5.Sum(data), sha256.Sum256(data)
+			want := map[string]string{
+				"Content-MD5":    base64.StdEncoding.EncodeToString(md5Sum[:]),
+				"Content-Digest": "sha-256=:" + base64.StdEncoding.EncodeToString(shaSum[:]) + ":",
+			}
+			assert.Equal(t, want[tt.header], (*headers)[1].Get(tt.header))
+			assert.NotEmpty(t, (*headers)[0].Get(tt.header))
+		})
+	}
+
+	// the digests are only verified with the option
+	assert.NoError(t, NewClient(tampering.URL).Do(context.Background(), "Upload", req, &upload{}, WithMTOM()))
+}
+
+func TestDigestVerify(t *testing.T) {
+	sum := sha256.Sum256([]byte("content"))
+	digest := base64.StdEncoding.EncodeToString(sum[:])
+	tests := []struct {
+		name   string
+		header string
+		err    bool
+	}{
+		{name: "match", header: "sha-512=:AAAA:, sha-256=:" + digest + ":"},
+		{name: "unknown algorithm", header: "sha-512=:AAAA:"},
+		{name: "mismatch", header: "sha-256=:" + base64.StdEncoding.EncodeToString(make([]byte, 32)) + ":", err: true},
+		{name: "malformed", header: "sha-256=" + digest, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := textproto.MIMEHeader{"Content-Id": {"<a@example>"}, "Content-Digest": {tt.header}}
+			_, err := io.ReadAll((&digestConfig{}).verify(header, bytes.NewReader([]byte("content"))))
+			if tt.err {
+				assert.Equal(t, &DigestMismatchError{ContentID: "a@example", Header: "Content-Digest"}, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+	assert.Error(t, NewClient("http://localhost").SetOptions(WithAttachmentDigests(DigestAlgorithm(7))))
+}
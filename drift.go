@@ -0,0 +1,220 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the detection of elements added to responses by the server over time.
+
+// DriftStore persists the element paths known per action. Only the paths ending in a leaf element are stored,
+// they imply the paths of their ancestors.
+type DriftStore interface {
+	// Load returns the known paths of action, none if it was never saved.
+	Load(action string) ([]string, error)
+	// Save stores the known paths of action, replacing the saved ones.
+	Save(action string, paths []string) error
+}
+
+// DriftDetector records the element paths of the response bodies of every action and reports the paths not
+// seen before. Paths are the slash separated local names of the elements starting at the body content
+// element, e.g. "GetOrderResponse/Order/Discount". The first response of an action without known paths
+// records them without reporting. Faults are not recorded.
+type DriftDetector struct {
+	store   DriftStore
+	onDrift func(action string, paths []string)
+
+	mu      sync.Mutex
+	actions map[string]*pathTrie
+}
+
+// NewDriftDetector returns a detector calling onDrift with the new paths of an action. The known paths are
+// loaded from and saved to store, which may be nil to keep them in memory only.
+func NewDriftDetector(store DriftStore, onDrift func(action string, paths []string)) *DriftDetector {
+	return &DriftDetector{store: store, onDrift: onDrift, actions: map[string]*pathTrie{}}
+}
+
+// WithDriftDetector records the element paths of the responses with d. The paths are collected from the copy
+// of the envelope kept by the default decoder after decoding, the decoding itself is not affected. Responses
+// decoded by custom decoders are not recorded.
+func WithDriftDetector(d *DriftDetector) Option {
+	return func(s *settings) error {
+		s.drift = d
+		return nil
+	}
+}
+
+// pathTrie holds the known element paths, every node is an element below its parent.
+type pathTrie struct {
+	children map[string]*pathTrie
+}
+
+// add inserts path into the trie.
+func (t *pathTrie) add(path []string) {
+	for _, name := range path {
+		child := t.children[name]
+		if child == nil {
+			if t.children == nil {
+				t.children = map[string]*pathTrie{}
+			}
+			child = &pathTrie{}
+			t.children[name] = child
+		}
+		t = child
+	}
+}
+
+// paths returns the paths of the trie ending in a leaf in order, they imply the ones leading to them.
+func (t *pathTrie) paths(prefix string, out []string) []string {
+	names := make([]string, 0, len(t.children))
+	for name := range t.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := prefix + name
+		if child := t.children[name]; len(child.children) > 0 {
+			out = child.paths(path+"/", out)
+		} else {
+			out = append(out, path)
+		}
+	}
+	return out
+}
+
+// trie returns the known paths of action, loading them from the store once.
+func (d *DriftDetector) trie(action string) *pathTrie {
+	t, ok := d.actions[action]
+	if ok {
+		return t
+	}
+	t = &pathTrie{}
+	if d.store != nil {
+		if paths, err := d.store.Load(action); err == nil {
+			for _, p := range paths {
+				t.add(strings.Split(p, "/"))
+			}
+		}
+	}
+	d.actions[action] = t
+	return t
+}
+
+// observe records the paths of the body elements of the envelope data received for action.
+func (d *DriftDetector) observe(action string, data []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	t := d.trie(action)
+	baseline := len(t.children) == 0
+
+	var added []string
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	// nodes holds the trie node of every open element below the body, stack their names
+	var nodes []*pathTrie
+	var stack []string
+	depth := 0
+	inBody := false
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				inBody = tok.Name.Local == "Body"
+			}
+			if depth < 3 || !inBody {
+				continue
+			}
+			parent := t
+			if len(nodes) > 0 {
+				parent = nodes[len(nodes)-1]
+			}
+			stack = append(stack, tok.Name.Local)
+			child := parent.children[tok.Name.Local]
+			if child == nil {
+				if parent.children == nil {
+					parent.children = map[string]*pathTrie{}
+				}
+				child = &pathTrie{}
+				parent.children[tok.Name.Local] = child
+				added = append(added, strings.Join(stack, "/"))
+			}
+			nodes = append(nodes, child)
+		case xml.EndElement:
+			if depth >= 3 && inBody {
+				nodes, stack = nodes[:len(nodes)-1], stack[:len(stack)-1]
+			}
+			depth--
+		}
+	}
+	if len(added) == 0 {
+		return
+	}
+	if d.store != nil {
+		_ = d.store.Save(action, t.paths("", nil))
+	}
+	if !baseline && d.onDrift != nil {
+		d.onDrift(action, added)
+	}
+}
+
+// FileDriftStore is a DriftStore keeping the paths of all actions in a JSON file.
+type FileDriftStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileDriftStore returns a store using the JSON file at path, created on the first save.
+func NewFileDriftStore(path string) *FileDriftStore {
+	return &FileDriftStore{path: path}
+}
+
+func (s *FileDriftStore) read() (map[string][]string, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string][]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	actions := map[string][]string{}
+	if err := json.Unmarshal(data, &actions); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
+
+func (s *FileDriftStore) Load(action string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	actions, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return actions[action], nil
+}
+
+func (s *FileDriftStore) Save(action string, paths []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	actions, err := s.read()
+	if err != nil {
+		return err
+	}
+	actions[action] = paths
+	data, err := json.MarshalIndent(actions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o600)
+}
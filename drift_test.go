@@ -0,0 +1,66 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDriftDetector(t *testing.T) {
+	bodies := []string{
+		infoResponseBody,
+		// known paths in another order
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<GetInfoResponse xmlns="urn:test"><Item>c</Item></GetInfoResponse></soap:Body></soap:Envelope>`,
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header><Trace/></soap:Header><soap:Body>` +
+			`<GetInfoResponse xmlns="urn:test"><Item>c</Item><Total><Amount>1</Amount></Total><Extra/></GetInfoResponse>` +
+			`</soap:Body></soap:Envelope>`,
+	}
+	var next int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(bodies[next]))
+		next++
+	}))
+	t.Cleanup(srv.Close)
+
+	store := NewFileDriftStore(filepath.Join(t.TempDir(), "paths.json"))
+	var reported [][]string
+	detector := NewDriftDetector(store, func(action string, paths []string) {
+		assert.Equal(t, "GetInfo", action)
+		reported = append(reported, paths)
+	})
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithDriftDetector(detector)))
+
+	var responses []*infoResponse
+	for range bodies {
+		resp := &infoResponse{}
+		require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, resp))
+		responses = append(responses, resp)
+	}
+	// the first response is the baseline, headers are not recorded
+	assert.Equal(t, [][]string{{"GetInfoResponse/Total", "GetInfoResponse/Total/Amount", "GetInfoResponse/Extra"}}, reported)
+	// decoding is not affected
+	assert.Equal(t, []string{"a", "b"}, responses[0].Items)
+	assert.Equal(t, []string{"c"}, responses[2].Items)
+
+	paths, err := store.Load("GetInfo")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GetInfoResponse/Extra", "GetInfoResponse/Item", "GetInfoResponse/Total/Amount"}, paths)
+
+	// a new detector continues from the stored paths
+	reported = nil
+	restarted := NewDriftDetector(store, func(action string, paths []string) {
+		reported = append(reported, paths)
+	})
+	restarted.observe("GetInfo", []byte(bodies[2]))
+	restarted.observe("GetInfo", []byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+		`<GetInfoResponse xmlns="urn:test"><Item><Code>x</Code></Item></GetInfoResponse></soap:Body></soap:Envelope>`))
+	assert.Equal(t, [][]string{{"GetInfoResponse/Item/Code"}}, reported)
+}
@@ -0,0 +1,159 @@
+package soap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the policy for top-level headers of the same name, e.g. a wsa:MessageID or a wsse:Security header
+// built by both a client-level builder and one of the call. It applies to the headers of the envelope once all
+// builders ran, before they are ordered.
+
+var (
+	// ErrDuplicateHeader is returned with DuplicatesError if two headers of a request have the same name.
+	ErrDuplicateHeader = errors.New("duplicate header")
+)
+
+// DuplicateHeaderError reports the headers of the same name of a request.
+type DuplicateHeaderError struct {
+	Name xml.Name
+	// Actor is the actor or role of a duplicate wsse:Security header.
+	Actor string
+}
+
+func (e *DuplicateHeaderError) Error() string {
+	msg := fmt.Sprintf("%s: {%s}%s", ErrDuplicateHeader, e.Name.Space, e.Name.Local)
+	if e.Actor != "" {
+		msg += " for actor " + e.Actor
+	}
+	return msg
+}
+
+func (e *DuplicateHeaderError) Unwrap() error {
+	return ErrDuplicateHeader
+}
+
+// DuplicateHeaderPolicy is how a request handles top-level headers of the same name. wsse:Security headers are
+// only the same if they are targeted at the same actor or role as well.
+//
+// The signed Security header of WSSEAuthInfo is not a duplicate of an unsigned one of its actor under either
+// policy but DuplicatesAllow: the signature is inserted into the unsigned header, as ApplySecurity does, and the
+// envelope carries a single Security header for the actor.
+type DuplicateHeaderPolicy int
+
+const (
+	// DuplicatesReplace keeps the header built last in place of the one built first. It is the default.
+	DuplicatesReplace DuplicateHeaderPolicy = iota
+	// DuplicatesError fails the request with a *DuplicateHeaderError.
+	DuplicatesError
+	// DuplicatesAllow sends all headers as built.
+	DuplicatesAllow
+)
+
+// WithDuplicateHeaders sets the policy for top-level headers of the same name.
+func WithDuplicateHeaders(policy DuplicateHeaderPolicy) Option {
+	return func(s *settings) error {
+		if policy < DuplicatesReplace || policy > DuplicatesAllow {
+			return fmt.Errorf("invalid duplicate header policy %d", policy)
+		}
+		s.duplicateHeaders = policy
+		return nil
+	}
+}
+
+var securityName = xml.Name{Space: wsseNS, Local: "Security"}
+
+type headerKey struct {
+	name  xml.Name
+	actor string
+}
+
+// dedupHeaders applies the policy to the headers. The placeholder of a signed Security header merged into
+// another Security header stays among the headers, serialized as nothing, for the request to sign it.
+func (h *Header) dedupHeaders(policy DuplicateHeaderPolicy) error {
+	if policy == DuplicatesAllow {
+		return nil
+	}
+	headers := flattenHeaders(nil, h.Headers)
+	out := make([]any, 0, len(headers))
+	index := make(map[headerKey]int, len(headers))
+	for _, hdr := range headers {
+		key, err := keyOf(hdr)
+		if err != nil {
+			return err
+		}
+		i, seen := index[key]
+		if !seen {
+			index[key] = len(out)
+			out = append(out, hdr)
+			continue
+		}
+		sig, signed := hdr.(*pendingSecurity)
+		prev, prevSigned := out[i].(*pendingSecurity)
+		switch {
+		case signed && !prevSigned:
+			sig.merged = true
+			out = append(out, sig)
+		case prevSigned && !signed:
+			prev.merged = true
+			out[i] = hdr
+			out = append(out, prev)
+		case policy == DuplicatesError:
+			return &DuplicateHeaderError{Name: key.name, Actor: key.actor}
+		default:
+			out[i] = hdr
+		}
+	}
+	h.Headers = out
+	return nil
+}
+
+// keyOf returns the name of the header, and the actor or role of a Security header.
+func keyOf(hdr any) (headerKey, error) {
+	switch v := hdr.(type) {
+	case *pendingSecurity:
+		return headerKey{name: securityName, actor: v.config.Header.Actor}, nil
+	case unsignedSecurity:
+		return headerKey{name: securityName, actor: v.Actor + v.Role}, nil
+	case *unsignedSecurity:
+		return headerKey{name: securityName, actor: v.Actor + v.Role}, nil
+	}
+	if name := taggedXMLName(hdr); name != nil && *name != securityName {
+		return headerKey{name: *name}, nil
+	}
+	data, ok := hdr.(RawHeader)
+	if ok && data.XMLName.Local != "" && data.XMLName != securityName {
+		return headerKey{name: data.XMLName}, nil
+	}
+	if !ok {
+		enc, err := xml.Marshal(hdr)
+		if err != nil {
+			return headerKey{}, err
+		}
+		data.XML = enc
+	}
+	d := xml.NewDecoder(bytes.NewReader(data.XML))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return headerKey{}, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		key := headerKey{name: start.Name}
+		if start.Name == securityName {
+			for _, attr := range start.Attr {
+				if (attr.Name.Space == soapEnvNS && attr.Name.Local == "actor") ||
+					(attr.Name.Space == soap12EnvNS && attr.Name.Local == "role") {
+					key.actor = attr.Value
+				}
+			}
+		}
+		return key, nil
+	}
+}
@@ -0,0 +1,127 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type usernameToken struct {
+	XMLName  xml.Name `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd UsernameToken"`
+	Username string   `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd Username"`
+}
+
+func TestDuplicateHeadersClient(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy DuplicateHeaderPolicy
+		routes string
+		err    error
+	}{
+		{name: "replace", policy: DuplicatesReplace, routes: `hop="2"`},
+		{name: "error", policy: DuplicatesError, err: ErrDuplicateHeader},
+		{name: "allow", policy: DuplicatesAllow, routes: `hop="1"` + `hop="2"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, captured := newCaptureServer(t)
+			client := NewClient(srv.URL, func(any) (any, error) { return routeHeader{Hop: 1}, nil })
+			require.NoError(t, client.SetOptions(WithDuplicateHeaders(tt.policy)))
+			err := client.Do(context.Background(), "Read", &quirksRequest{}, &quirksResponse{},
+				WithHeaderBuilder(func(context.Context, any) (any, error) { return routeHeader{Hop: 2}, nil }))
+			if tt.err != nil {
+				var dup *DuplicateHeaderError
+				if assert.ErrorAs(t, err, &dup) {
+					assert.Equal(t, xml.Name{Space: "urn:gateway", Local: "Route"}, dup.Name)
+				}
+				assert.ErrorIs(t, err, tt.err)
+				assert.Empty(t, *captured)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, *captured, 1)
+			var routes string
+			for _, hop := range []string{`hop="1"`, `hop="2"`} {
+				if strings.Contains((*captured)[0].body, hop) {
+					routes += hop
+				}
+			}
+			assert.Equal(t, tt.routes, routes)
+		})
+	}
+}
+
+func TestDuplicateSecurityHeaders(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	require.NoError(t, err)
+	pair, err := tls.LoadX509KeyPair(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	require.NoError(t, err)
+
+	token := func(name string) HeaderBuilder {
+		return SecurityHeader(SecurityHeaderOptions{}, usernameToken{Username: name})
+	}
+	tests := []struct {
+		name    string
+		headers []any
+		policy  DuplicateHeaderPolicy
+		// security is the number of Security headers sent
+		security int
+		// users are the usernames sent
+		users  []string
+		signed bool
+		err    error
+	}{
+		{name: "token and signature", headers: []any{token("alice"), wsseInfo.Header()},
+			security: 1, users: []string{"alice"}, signed: true},
+		{name: "signature and token", headers: []any{wsseInfo.Header(), token("alice")},
+			security: 1, users: []string{"alice"}, signed: true},
+		{name: "token and signature with error policy", headers: []any{token("alice"), wsseInfo.Header()},
+			policy: DuplicatesError, security: 1, users: []string{"alice"}, signed: true},
+		{name: "user header replaces token", headers: []any{token("alice"), wsseInfo.Header(), token("bob")},
+			security: 1, users: []string{"bob"}, signed: true},
+		{name: "user header is duplicate of token", headers: []any{token("alice"), token("bob")},
+			policy: DuplicatesError, err: ErrDuplicateHeader},
+		{name: "other actor", headers: []any{token("alice"), wsseInfo.Header(),
+			SecurityHeader(SecurityHeaderOptions{Actor: "urn:gateway"}, usernameToken{Username: "bob"})},
+			policy: DuplicatesError, security: 2, users: []string{"alice", "bob"}, signed: true},
+		{name: "allow", headers: []any{token("alice"), wsseInfo.Header(), token("bob")},
+			policy: DuplicatesAllow, security: 3, users: []string{"alice", "bob"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			_, err := WriteEnvelope(&buf, &infoRequest{}, tt.headers, WithDuplicateHeaders(tt.policy))
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			sent := buf.String()
+			assert.Equal(t, tt.security, strings.Count(sent, ":Security "), sent)
+			var users []string
+			for _, user := range []string{"alice", "bob"} {
+				if strings.Contains(sent, ">"+user+"<") {
+					users = append(users, user)
+				}
+			}
+			assert.Equal(t, tt.users, users)
+			if tt.signed {
+				assert.NoError(t, VerifySignature(buf.Bytes(), VerifyOptions{Certificate: cert}))
+			}
+		})
+	}
+}
+
+func TestWithDuplicateHeadersInvalid(t *testing.T) {
+	_, err := settings{}.apply(WithDuplicateHeaders(DuplicateHeaderPolicy(7)))
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the decoding of responses into nested maps for callers without response types, e.g. tools
+// exploring a service. Elements become maps keyed by the names of their children and attributes, repeated
+// children become slices and elements with only text become strings.
+
+const (
+	// DynamicAttrPrefix prefixes the keys of attributes in the maps returned by DoDynamic.
+	DynamicAttrPrefix = "@"
+	// DynamicTextKey is the key of the text of elements that also carry attributes.
+	DynamicTextKey = "#text"
+)
+
+// WithDynamicNamespaces keeps the namespaces in the keys of the maps returned by DoDynamic, written as
+// "{namespace}local". By default the keys are the local names.
+func WithDynamicNamespaces() Option {
+	return func(s *settings) error {
+		s.dynamicNamespaces = true
+		return nil
+	}
+}
+
+// DoDynamic sends requestXML as body element and returns the response body as nested maps keyed by the
+// element names. The values are strings for elements with only text, maps for elements with children or
+// attributes (keyed with DynamicAttrPrefix, their text with DynamicTextKey) and []any for repeated children.
+// Elements mixing text and child elements are returned as their inner XML string.
+// A SOAP fault is returned as error like with Do.
+func (c *Client) DoDynamic(ctx context.Context, action string, requestXML []byte, opts ...Option) (map[string]any, error) {
+	s, err := c.settings.apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+	var raw RawXML
+	if err := c.Do(ctx, action, RawXML(requestXML), &raw, opts...); err != nil {
+		return nil, err
+	}
+	return dynamicMap(raw, s.dynamicNamespaces)
+}
+
+// dynamicMap converts the serialized element raw into a map holding its value keyed by its name.
+func dynamicMap(raw []byte, namespaces bool) (map[string]any, error) {
+	m := map[string]any{}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return m, nil
+	}
+	d := xml.NewDecoder(bytes.NewReader(raw))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			v, err := dynamicValue(d, raw, start, namespaces)
+			if err != nil {
+				return nil, err
+			}
+			m[dynamicKey(start.Name, namespaces)] = v
+			return m, nil
+		}
+	}
+}
+
+// dynamicValue returns the value of the element start, consuming it from d reading raw.
+func dynamicValue(d *xml.Decoder, raw []byte, start xml.StartElement, namespaces bool) (any, error) {
+	m := map[string]any{}
+	attrs := 0
+	for _, attr := range start.Attr {
+		if _, ok := declaredPrefix(attr); ok {
+			continue
+		}
+		m[DynamicAttrPrefix+dynamicKey(attr.Name, namespaces)] = attr.Value
+		attrs++
+	}
+
+	contentStart := d.InputOffset()
+	var text strings.Builder
+	hasChildren, hasText := false, false
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			child, err := dynamicValue(d, raw, tok, namespaces)
+			if err != nil {
+				return nil, err
+			}
+			hasChildren = true
+			addDynamic(m, dynamicKey(tok.Name, namespaces), child)
+		case xml.CharData:
+			text.Write(tok)
+			hasText = hasText || len(bytes.TrimSpace(tok)) > 0
+		case xml.EndElement:
+			switch {
+			case hasChildren && hasText:
+				// mixed content has no map form
+				inner := string(raw[contentStart:offset])
+				if attrs == 0 {
+					return inner, nil
+				}
+				for k := range m {
+					if !strings.HasPrefix(k, DynamicAttrPrefix) {
+						delete(m, k)
+					}
+				}
+				m[DynamicTextKey] = inner
+			case hasChildren:
+			case attrs == 0:
+				return text.String(), nil
+			case text.Len() > 0:
+				m[DynamicTextKey] = text.String()
+			}
+			return m, nil
+		}
+	}
+}
+
+// addDynamic adds the value of a child to m, turning repeated children into a slice.
+func addDynamic(m map[string]any, key string, v any) {
+	existing, ok := m[key]
+	if !ok {
+		m[key] = v
+		return
+	}
+	if list, ok := existing.([]any); ok {
+		m[key] = append(list, v)
+		return
+	}
+	m[key] = []any{existing, v}
+}
+
+func dynamicKey(name xml.Name, namespaces bool) string {
+	if !namespaces || name.Space == "" {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
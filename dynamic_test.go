@@ -0,0 +1,71 @@
+package soap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const dynamicResponseBody = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+	`<o:GetOrdersResponse xmlns:o="urn:orders" xmlns:x="urn:ext" count="2">` +
+	`<o:Order id="1"><o:Sku>978-0</o:Sku><o:Amount>2</o:Amount></o:Order>` +
+	`<o:Order id="2"><o:Sku>978-1</o:Sku><o:Note x:lang="en">gift</o:Note></o:Order>` +
+	`<o:Remark>see <o:b>terms</o:b> below</o:Remark>` +
+	`<o:Empty/>` +
+	`</o:GetOrdersResponse></soap:Body></soap:Envelope>`
+
+func TestDoDynamic(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		want    map[string]any
+	}{
+		{
+			name: "stripped namespaces",
+			want: map[string]any{"GetOrdersResponse": map[string]any{
+				"@count": "2",
+				"Order": []any{
+					map[string]any{"@id": "1", "Sku": "978-0", "Amount": "2"},
+					map[string]any{"@id": "2", "Sku": "978-1", "Note": map[string]any{"@lang": "en", "#text": "gift"}},
+				},
+				"Remark": `see <o:b>terms</o:b> below`,
+				"Empty":  "",
+			}},
+		},
+		{
+			name:    "preserved namespaces",
+			options: []Option{WithDynamicNamespaces()},
+			want: map[string]any{"{urn:orders}GetOrdersResponse": map[string]any{
+				"@count": "2",
+				"{urn:orders}Order": []any{
+					map[string]any{"@id": "1", "{urn:orders}Sku": "978-0", "{urn:orders}Amount": "2"},
+					map[string]any{"@id": "2", "{urn:orders}Sku": "978-1",
+						"{urn:orders}Note": map[string]any{"@{urn:ext}lang": "en", "#text": "gift"}},
+				},
+				"{urn:orders}Remark": `see <o:b>terms</o:b> below`,
+				"{urn:orders}Empty":  "",
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInfoServer(t, "text/xml", dynamicResponseBody)
+			got, err := NewClient(srv.URL).DoDynamic(context.Background(), "GetOrders",
+				[]byte(`<GetOrders xmlns="urn:orders"/>`), tt.options...)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDoDynamicFault(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+		`<soap:Fault><faultcode>soap:Client</faultcode><faultstring>unknown order</faultstring></soap:Fault>`+
+		`</soap:Body></soap:Envelope>`)
+	_, err := NewClient(srv.URL).DoDynamic(context.Background(), "GetOrders", []byte(`<GetOrders xmlns="urn:orders"/>`))
+	var fault *Fault
+	if assert.ErrorAs(t, err, &fault) {
+		assert.Equal(t, "unknown order", fault.String)
+	}
+}
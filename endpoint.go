@@ -0,0 +1,157 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the detection of WSDL documents and HTML pages answering a call, the usual result of configuring
+// the ?wsdl URL or the landing page of a service instead of its address.
+
+// wsdlSniffLimit is the maximum number of bytes of a WSDL document read to find the service addresses.
+const wsdlSniffLimit = 4 << 20
+
+var (
+	// ErrWrongEndpoint is returned if the endpoint answered with a WSDL document or an HTML page instead of a
+	// SOAP envelope. The returned error is a *WrongEndpointError.
+	ErrWrongEndpoint = errors.New("endpoint is not a SOAP service address")
+)
+
+// WrongEndpointError is returned if the endpoint answered with a WSDL document, or with an HTML page and a 2xx
+// status that failed to decode. HTML error pages are reported as *GatewayError.
+type WrongEndpointError struct {
+	// Document is "WSDL" or "HTML".
+	Document string
+	// Locations holds the service addresses found in the soap:address elements of a WSDL document.
+	Locations []string
+	// Gateway is the error for the HTML page, nil for a WSDL document.
+	Gateway *GatewayError
+	// HTTPError is the error for the status of a WSDL response, nil for a 2xx status.
+	HTTPError *HTTPError
+
+	// err is the error decoding the HTML page
+	err error
+}
+
+func (e *WrongEndpointError) Error() string {
+	if e.Document == "HTML" {
+		return "endpoint returned an HTML page instead of a SOAP envelope — is the URL the service address?"
+	}
+	if len(e.Locations) == 0 {
+		return "endpoint returned a WSDL document — did you mean the service address instead of the WSDL URL?"
+	}
+	return "endpoint returned a WSDL document — did you mean the service address " + strings.Join(e.Locations, " or ") + "?"
+}
+
+func (e *WrongEndpointError) Unwrap() []error {
+	errs := []error{ErrWrongEndpoint}
+	if e.Gateway != nil {
+		errs = append(errs, e.Gateway)
+	}
+	if e.HTTPError != nil {
+		errs = append(errs, e.HTTPError)
+	}
+	if e.err != nil {
+		errs = append(errs, e.err)
+	}
+	return errs
+}
+
+var (
+	wsdlNamespaces    = []string{"http://schemas.xmlsoap.org/wsdl/", "http://www.w3.org/ns/wsdl"}
+	soapAddressSpaces = []string{"http://schemas.xmlsoap.org/wsdl/soap/", "http://schemas.xmlsoap.org/wsdl/soap12/"}
+)
+
+// wrongEndpoint returns the error for the body r of the response of attempt as returned by sniffBody, if it
+// is a WSDL document. Only the beginning of other bodies is peeked at, nothing is consumed.
+func wrongEndpoint(r io.Reader, httpResp *http.Response, attempt int) error {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		return nil
+	}
+	head, _ := peekHead(br, sniffLen, func(head []byte) bool { return rootElement(head).Local != "" })
+	if root := rootElement(head); !isWSDL(root) {
+		return nil
+	}
+	e := &WrongEndpointError{Document: "WSDL", Locations: wsdlLocations(io.LimitReader(br, wsdlSniffLimit))}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		e.HTTPError = newHTTPError(httpResp, attempt, nil)
+	}
+	return e
+}
+
+// rootElement returns the name of the first element in head, empty if there is none.
+func rootElement(head []byte) xml.Name {
+	d := xml.NewDecoder(bytes.NewReader(head))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return xml.Name{}
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name
+		}
+	}
+}
+
+func isWSDL(name xml.Name) bool {
+	for _, ns := range wsdlNamespaces {
+		if name.Space == ns && (name.Local == "definitions" || name.Local == "description") {
+			return true
+		}
+	}
+	return false
+}
+
+// wsdlLocations returns the locations of the soap:address elements of the WSDL document read from r.
+func wsdlLocations(r io.Reader) []string {
+	var locations []string
+	d := xml.NewDecoder(r)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return locations
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == "endpoint" && start.Name.Space == wsdlNamespaces[1] {
+			// WSDL 2.0 puts the address on the endpoint
+			locations = appendLocation(locations, attrValue(start, "address"))
+			continue
+		}
+		for _, ns := range soapAddressSpaces {
+			if start.Name.Space == ns && start.Name.Local == "address" {
+				locations = appendLocation(locations, attrValue(start, "location"))
+			}
+		}
+	}
+}
+
+func appendLocation(locations []string, location string) []string {
+	if location == "" {
+		return locations
+	}
+	for _, l := range locations {
+		if l == location {
+			return locations
+		}
+	}
+	return append(locations, location)
+}
+
+func attrValue(start xml.StartElement, local string) string {
+	for _, a := range start.Attr {
+		if a.Name.Space == "" && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
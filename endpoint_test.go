@@ -0,0 +1,97 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const endpointWSDL = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- generated -->
+<wsdl:definitions xmlns:wsdl="http://schemas.xmlsoap.org/wsdl/" xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/"
+	xmlns:soap12="http://schemas.xmlsoap.org/wsdl/soap12/" name="OrderService">
+	<wsdl:service name="OrderService">
+		<wsdl:port name="OrderPort" binding="OrderBinding"><soap:address location="https://example.com/OrderService"/></wsdl:port>
+		<wsdl:port name="OrderPort12" binding="OrderBinding12"><soap12:address location="https://example.com/OrderService"/></wsdl:port>
+		<wsdl:port name="OrderPortV2" binding="OrderBinding"><soap:address location="https://example.com/v2/OrderService"/></wsdl:port>
+	</wsdl:service>
+</wsdl:definitions>`
+
+func TestWrongEndpoint(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		document    string
+		locations   []string
+		gateway     bool
+		httpErr     bool
+		message     string
+	}{
+		{
+			name:        "wsdl",
+			status:      http.StatusOK,
+			contentType: "text/xml",
+			body:        endpointWSDL,
+			document:    "WSDL",
+			locations:   []string{"https://example.com/OrderService", "https://example.com/v2/OrderService"},
+			message: "endpoint returned a WSDL document — did you mean the service address " +
+				"https://example.com/OrderService or https://example.com/v2/OrderService?",
+		},
+		{
+			name:        "wsdl 2.0 with error status",
+			status:      http.StatusMethodNotAllowed,
+			contentType: "application/wsdl+xml",
+			body: `<description xmlns="http://www.w3.org/ns/wsdl"><service name="S" interface="I">` +
+				`<endpoint name="E" binding="B" address="https://example.com/svc"/></service></description>`,
+			document:  "WSDL",
+			locations: []string{"https://example.com/svc"},
+			httpErr:   true,
+		},
+		{
+			name:        "wsdl without address",
+			status:      http.StatusOK,
+			contentType: "text/xml",
+			body:        `<definitions xmlns="http://schemas.xmlsoap.org/wsdl/"/>`,
+			document:    "WSDL",
+			message:     "endpoint returned a WSDL document — did you mean the service address instead of the WSDL URL?",
+		},
+		{
+			name:        "landing page",
+			status:      http.StatusOK,
+			contentType: "text/html",
+			body:        "<html><head><title>OrderService</title></head><body>Hello</body></html>",
+			document:    "HTML",
+			gateway:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			t.Cleanup(srv.Close)
+
+			err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+			assert.ErrorIs(t, err, ErrWrongEndpoint)
+			var endpointErr *WrongEndpointError
+			require.ErrorAs(t, err, &endpointErr)
+			assert.Equal(t, tt.document, endpointErr.Document)
+			assert.Equal(t, tt.locations, endpointErr.Locations)
+			assert.Equal(t, tt.gateway, endpointErr.Gateway != nil)
+			var httpErr *HTTPError
+			assert.Equal(t, tt.httpErr, errors.As(err, &httpErr))
+			if tt.message != "" {
+				assert.EqualError(t, err, tt.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+
+	"github.com/m29h/xml"
+)
+
+// HTMLEntities maps the entity names of HTML 4 like nbsp and eacute to their text, for WithEntityMap.
+var HTMLEntities = xml.HTMLEntity
+
+// predefinedEntities are the entities of XML itself, known to every decoder.
+var predefinedEntities = map[string]bool{"lt": true, "gt": true, "amp": true, "apos": true, "quot": true}
+
+// maxEntityName is the longest entity name replaced by WithUnknownEntityReplacement.
+const maxEntityName = 64
+
+// WithEntityMap makes the decoding of responses accept the named entities of entities in text and attribute
+// values, which are replaced with their text, e.g. HTMLEntities for &nbsp; and &eacute; sent by services
+// rendering their responses with HTML tooling. Other entities except the predefined ones of XML fail the
+// decoding, unless WithUnknownEntityReplacement is set. Setting the option again replaces the map.
+// Elements decoded as raw XML with innerxml keep the entities as received.
+func WithEntityMap(entities map[string]string) Option {
+	return func(s *settings) error {
+		s.entities = entities
+		return nil
+	}
+}
+
+// WithUnknownEntityReplacement replaces the named entities in responses that are neither predefined by XML
+// nor part of WithEntityMap with U+FFFD, instead of failing the decoding. CDATA sections and comments are left
+// alone.
+func WithUnknownEntityReplacement() Option {
+	return func(s *settings) error {
+		s.replaceUnknownEntities = true
+		return nil
+	}
+}
+
+// replaceEntities returns rd with the unknown entities replaced if WithUnknownEntityReplacement is set.
+func (s *settings) replaceEntities(rd io.Reader) io.Reader {
+	if !s.replaceUnknownEntities {
+		return rd
+	}
+	return &entityReader{r: bufio.NewReader(rd), known: s.entities}
+}
+
+// entityReader replaces the references to unknown named entities with the character reference of U+FFFD.
+type entityReader struct {
+	r     *bufio.Reader
+	known map[string]string
+	out   []byte
+	// end terminates the CDATA section or comment being copied, nil outside of one
+	end []byte
+	err error
+}
+
+var (
+	cdataStart   = []byte("![CDATA[")
+	commentStart = []byte("!--")
+	replacement  = []byte("&#xFFFD;")
+)
+
+func (e *entityReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+		e.fill()
+	}
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// fill moves the next chunk of input to out.
+func (e *entityReader) fill() {
+	e.out = e.out[:0]
+	for len(e.out) < 4096 {
+		b, err := e.r.ReadByte()
+		if err != nil {
+			e.err = err
+			return
+		}
+		e.out = append(e.out, b)
+		switch {
+		case e.end != nil:
+			if b == e.end[0] && e.consume(e.end[1:]) {
+				e.out = append(e.out, e.end[1:]...)
+				e.end = nil
+			}
+		case b == '<':
+			if e.consume(cdataStart) {
+				e.out = append(e.out, cdataStart...)
+				e.end = []byte("]]>")
+			} else if e.consume(commentStart) {
+				e.out = append(e.out, commentStart...)
+				e.end = []byte("-->")
+			}
+		case b == '&':
+			peek, _ := e.r.Peek(maxEntityName + 1)
+			i := bytes.IndexByte(peek, ';')
+			if i > 0 && e.unknown(peek[:i]) {
+				_, _ = e.r.Discard(i + 1)
+				e.out = append(e.out[:len(e.out)-1], replacement...)
+			}
+		}
+	}
+}
+
+// consume reads prefix if the input continues with it.
+func (e *entityReader) consume(prefix []byte) bool {
+	peek, _ := e.r.Peek(len(prefix))
+	if !bytes.Equal(peek, prefix) {
+		return false
+	}
+	_, _ = e.r.Discard(len(prefix))
+	return true
+}
+
+// unknown reports whether name is the name of an entity neither predefined nor in the map. Character
+// references and malformed names are left to the decoder.
+func (e *entityReader) unknown(name []byte) bool {
+	if !isEntityName(name) || predefinedEntities[string(name)] {
+		return false
+	}
+	_, ok := e.known[string(name)]
+	return !ok
+}
+
+func isEntityName(name []byte) bool {
+	for i, c := range name {
+		letter := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || c == '_' || c == ':' || c >= 0x80
+		if !letter && (i == 0 || !('0' <= c && c <= '9' || c == '-' || c == '.')) {
+			return false
+		}
+	}
+	return len(name) > 0
+}
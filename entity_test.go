@@ -0,0 +1,94 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEntityMap(t *testing.T) {
+	var tests = []struct {
+		fixture string
+		opts    []Option
+		items   []string
+		err     bool
+	}{
+		{fixture: "html.xml", err: true},
+		{fixture: "html.xml", opts: []Option{WithEntityMap(HTMLEntities)}, items: []string{"Café René", "a&b"}},
+		{fixture: "html.xml", opts: []Option{WithUnknownEntityReplacement()}, items: []string{"Caf��Ren�", "a&b"}},
+		{fixture: "unknown.xml", opts: []Option{WithEntityMap(HTMLEntities)}, err: true},
+		{fixture: "unknown.xml", opts: []Option{WithEntityMap(HTMLEntities), WithUnknownEntityReplacement()},
+			items: []string{"x �y", "&foo;", "é<"}},
+		{fixture: "unknown.xml", opts: []Option{WithEntityMap(map[string]string{"foo": "F"}), WithUnknownEntityReplacement()},
+			items: []string{"x�Fy", "&foo;", "é<"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			data, err := os.ReadFile("./testdata/entities/" + tt.fixture)
+			require.NoError(t, err)
+			srv := newInfoServer(t, "text/xml; charset=utf-8", string(data))
+			client := NewClient(srv.URL)
+			require.NoError(t, client.SetOptions(tt.opts...))
+
+			resp := &infoResponse{}
+			err = client.Do(context.Background(), "GetInfo", &infoRequest{}, resp)
+			if tt.err {
+				var syntaxErr *xml.SyntaxError
+				assert.ErrorAs(t, err, &syntaxErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.items, resp.Items)
+		})
+	}
+}
+
+func TestEntityMapStream(t *testing.T) {
+	data, err := os.ReadFile("./testdata/entities/unknown.xml")
+	require.NoError(t, err)
+	srv := newInfoServer(t, "text/xml", string(data))
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithEntityMap(HTMLEntities), WithUnknownEntityReplacement()))
+
+	var items []string
+	err = client.DoStream(context.Background(), "GetInfo", &infoRequest{}, func(dec *xml.Decoder, start xml.StartElement) error {
+		var resp infoResponse
+		if err := dec.DecodeElement(&resp, &start); err != nil {
+			return err
+		}
+		items = resp.Items
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"x �y", "&foo;", "é<"}, items)
+}
+
+func TestEntityReader(t *testing.T) {
+	var tests = []struct {
+		in, want string
+	}{
+		{`a&foo;b`, `a&#xFFFD;b`},
+		{`&amp;&lt;&#65;&#x41;`, `&amp;&lt;&#65;&#x41;`},
+		{`&nbsp;&known;`, `&#xFFFD;&known;`},
+		{`<a b="&x;">`, `<a b="&#xFFFD;">`},
+		{`<![CDATA[&x;]]]>&x;`, `<![CDATA[&x;]]]>&#xFFFD;`},
+		{`<!-- &x; -->&x;`, `<!-- &x; -->&#xFFFD;`},
+		{`& x; &1x; &x`, `& x; &1x; &x`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			s := settings{entities: map[string]string{"known": "k"}, replaceUnknownEntities: true}
+			// one byte reads split every reference
+			out, err := io.ReadAll(s.replaceEntities(iotest.OneByteReader(bytes.NewReader([]byte(tt.in)))))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(out))
+		})
+	}
+}
@@ -0,0 +1,223 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/m29h/xml"
+)
+
+// Implements string enumerations of the schema checked against their allowed values when coded, so values a
+// service rejects with an unhelpful fault are caught by the client.
+
+var (
+	// ErrInvalidEnum is returned for an Enum value not among the values of its enumeration. The returned error
+	// is a *EnumValueError.
+	ErrInvalidEnum = errors.New("value not in enumeration")
+)
+
+// EnumValueError reports a value not among the values of its enumeration.
+type EnumValueError struct {
+	// Field is the path of the struct field holding the value, e.g. "Order.Items[1].Status", empty when the
+	// value was coded.
+	Field string
+	// Type is the Go type of the enumeration.
+	Type  string
+	Value string
+}
+
+func (e *EnumValueError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %q is no %s", ErrInvalidEnum, e.Value, e.Type)
+	}
+	return fmt.Sprintf("%s: field %s: %q is no %s", ErrInvalidEnum, e.Field, e.Value, e.Type)
+}
+
+func (e *EnumValueError) Unwrap() error {
+	return ErrInvalidEnum
+}
+
+// Enumeration is implemented by the string types of schema enumerations listing their allowed values, e.g.
+// as generated from the schema:
+//
+//	type Status string
+//
+//	func (Status) Values() []Status { return []Status{"OPEN", "CLOSED"} }
+type Enumeration[T any] interface {
+	~string
+	Values() []T
+}
+
+// Enum is a value of the enumeration T, as element content or attribute value. By default a value not among
+// T.Values() fails to encode and to decode, see WithEnumPolicy. The zero value is invalid unless T has an empty
+// value, optional elements are pointers.
+type Enum[T Enumeration[T]] struct {
+	Value T
+	// Unknown is set if the value decoded is not among the values of T, with EnumPassThrough for decoding.
+	Unknown bool
+}
+
+// NewEnum returns the Enum holding v.
+func NewEnum[T Enumeration[T]](v T) Enum[T] {
+	return Enum[T]{Value: v}
+}
+
+// IsValid reports whether the value is among the values of T.
+func (e Enum[T]) IsValid() bool {
+	return slices.Contains(e.Value.Values(), e.Value)
+}
+
+func (e Enum[T]) String() string {
+	return string(e.Value)
+}
+
+// enumValue returns the value and whether it is valid, for ValidateEnums.
+func (e Enum[T]) enumValue() (string, string, bool) {
+	return string(e.Value), reflect.TypeFor[T]().String(), e.IsValid()
+}
+
+func (e Enum[T]) invalid() error {
+	return &EnumValueError{Type: reflect.TypeFor[T]().String(), Value: string(e.Value)}
+}
+
+// MarshalXML writes the value, failing for one not among the values of T unless the encoder passes them
+// through.
+func (e Enum[T]) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if !e.IsValid() && enumPolicyOf(enc).encode == EnumStrict {
+		return e.invalid()
+	}
+	return enc.EncodeElement(string(e.Value), start)
+}
+
+// UnmarshalXML reads the value. A value not among the values of T fails, unless the decoder passes them
+// through, in which case Unknown is set.
+func (e *Enum[T]) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var s string
+	if err := d.DecodeElement(&s, &start); err != nil {
+		return err
+	}
+	return e.set(s, enumPolicyOf(d).decode)
+}
+
+// MarshalXMLAttr writes the value as attribute. Attributes are always checked with the default policies, as
+// the encoder is unknown.
+func (e Enum[T]) MarshalXMLAttr(name xml.Name) (xml.Attr, error) {
+	if !e.IsValid() {
+		return xml.Attr{}, e.invalid()
+	}
+	return xml.Attr{Name: name, Value: string(e.Value)}, nil
+}
+
+// UnmarshalXMLAttr reads the value of an attribute, with the default policy.
+func (e *Enum[T]) UnmarshalXMLAttr(attr xml.Attr) error {
+	return e.set(attr.Value, EnumStrict)
+}
+
+func (e *Enum[T]) set(s string, policy EnumPolicy) error {
+	e.Value = T(s)
+	e.Unknown = !e.IsValid()
+	if e.Unknown && policy == EnumStrict {
+		return e.invalid()
+	}
+	return nil
+}
+
+// EnumPolicy is the handling of Enum values not among the values of their enumeration.
+type EnumPolicy int
+
+const (
+	// EnumStrict fails the coding of the value.
+	EnumStrict EnumPolicy = iota
+	// EnumPassThrough codes the value anyway. Decoded values are marked Unknown.
+	EnumPassThrough
+)
+
+// WithEnumPolicy sets the handling of Enum element values not among the values of their enumeration when
+// requests are encoded and when responses are decoded. Both are EnumStrict by default; EnumPassThrough for
+// decode lets the client read values added to the schema of the service later.
+func WithEnumPolicy(encode, decode EnumPolicy) Option {
+	return func(s *settings) error {
+		s.enums = &enumConfig{encode: encode, decode: decode}
+		return nil
+	}
+}
+
+type enumConfig struct {
+	encode, decode EnumPolicy
+}
+
+// enumPolicies maps the encoders and decoders of calls configured with WithEnumPolicy to their configuration,
+// as MarshalXML and UnmarshalXML only get to see the encoder or decoder.
+var enumPolicies sync.Map
+
+// registerEnums makes the configuration apply to the values coded with coder until the returned function is
+// called.
+func registerEnums(coder any, config *enumConfig) func() {
+	if config == nil {
+		return func() {}
+	}
+	enumPolicies.Store(coder, *config)
+	return func() { enumPolicies.Delete(coder) }
+}
+
+func enumPolicyOf(coder any) enumConfig {
+	if config, ok := enumPolicies.Load(coder); ok {
+		return config.(enumConfig)
+	}
+	return enumConfig{}
+}
+
+// ValidateEnums checks the Enum values reachable from v, through struct fields, pointers, interfaces, slices,
+// arrays and maps, before v is encoded. The error joins an *EnumValueError for every invalid value.
+func ValidateEnums(v any) error {
+	var errs []error
+	validateEnums(reflect.ValueOf(v), "", &errs)
+	return errors.Join(errs...)
+}
+
+type enumValuer interface {
+	enumValue() (value, typ string, valid bool)
+}
+
+func validateEnums(v reflect.Value, path string, errs *[]error) {
+	if !v.IsValid() || (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return
+	}
+	if v.CanInterface() {
+		if e, ok := v.Interface().(enumValuer); ok {
+			if value, typ, valid := e.enumValue(); !valid {
+				*errs = append(*errs, &EnumValueError{Field: path, Type: typ, Value: value})
+			}
+			return
+		}
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		validateEnums(v.Elem(), path, errs)
+	case reflect.Struct:
+		if path == "" {
+			path = v.Type().Name()
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Type().Field(i); f.IsExported() {
+				validateEnums(v.Field(i), path+"."+f.Name, errs)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return
+		}
+		for i := 0; i < v.Len(); i++ {
+			validateEnums(v.Index(i), path+"["+strconv.Itoa(i)+"]", errs)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			validateEnums(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), errs)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package soap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderStatus string
+
+func (orderStatus) Values() []orderStatus { return []orderStatus{"OPEN", "CLOSED"} }
+
+type statusRequest struct {
+	XMLName xml.Name           `xml:"urn:test SetStatus"`
+	Status  Enum[orderStatus]  `xml:"Status"`
+	Next    *Enum[orderStatus] `xml:"Next,omitempty"`
+	Kind    Enum[orderStatus]  `xml:"kind,attr"`
+}
+
+type statusResponse struct {
+	XMLName xml.Name          `xml:"urn:test SetStatusResponse"`
+	Status  Enum[orderStatus] `xml:"Status"`
+}
+
+func statusResponseBody(status string) string {
+	return `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<SetStatusResponse xmlns="urn:test"><Status>` + status + `</Status></SetStatusResponse></soap:Body></soap:Envelope>`
+}
+
+func TestEnum(t *testing.T) {
+	assert.True(t, NewEnum[orderStatus]("OPEN").IsValid())
+	assert.False(t, NewEnum[orderStatus]("open").IsValid())
+	assert.False(t, Enum[orderStatus]{}.IsValid())
+	assert.Equal(t, "CLOSED", NewEnum[orderStatus]("CLOSED").String())
+
+	data, err := xml.Marshal(statusRequest{Status: NewEnum[orderStatus]("OPEN"), Kind: NewEnum[orderStatus]("CLOSED")})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), ` kind="CLOSED"><Status>OPEN</Status>`)
+	_, err = xml.Marshal(statusRequest{Status: NewEnum[orderStatus]("DRAFT"), Kind: NewEnum[orderStatus]("CLOSED")})
+	var enumErr *EnumValueError
+	if assert.ErrorAs(t, err, &enumErr) {
+		assert.Equal(t, &EnumValueError{Type: "soap.orderStatus", Value: "DRAFT"}, enumErr)
+	}
+	_, err = xml.Marshal(statusRequest{Status: NewEnum[orderStatus]("OPEN"), Kind: NewEnum[orderStatus]("x")})
+	assert.ErrorIs(t, err, ErrInvalidEnum)
+
+	var req statusRequest
+	require.NoError(t, xml.Unmarshal([]byte(`<SetStatus xmlns="urn:test" kind="OPEN"><Status>CLOSED</Status></SetStatus>`), &req))
+	assert.Equal(t, NewEnum[orderStatus]("CLOSED"), req.Status)
+	assert.Equal(t, NewEnum[orderStatus]("OPEN"), req.Kind)
+	assert.ErrorIs(t, xml.Unmarshal([]byte(`<SetStatus xmlns="urn:test"><Status>DRAFT</Status></SetStatus>`), &req), ErrInvalidEnum)
+}
+
+func TestWithEnumPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Option
+		status string
+		// encodeErr and decodeErr report whether the request fails to encode and the response to decode
+		encodeErr, decodeErr bool
+	}{
+		{name: "valid", status: "OPEN"},
+		{name: "strict", status: "DRAFT", encodeErr: true},
+		{name: "strict decode", opts: []Option{WithEnumPolicy(EnumPassThrough, EnumStrict)}, status: "DRAFT", decodeErr: true},
+		{name: "pass through", opts: []Option{WithEnumPolicy(EnumPassThrough, EnumPassThrough)}, status: "DRAFT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInfoServer(t, "text/xml", statusResponseBody(tt.status))
+			resp := &statusResponse{}
+			err := NewClient(srv.URL).Do(context.Background(), "SetStatus",
+				&statusRequest{Status: NewEnum(orderStatus(tt.status)), Kind: NewEnum[orderStatus]("OPEN")}, resp, tt.opts...)
+			if tt.encodeErr || tt.decodeErr {
+				assert.ErrorIs(t, err, ErrInvalidEnum)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, orderStatus(tt.status), resp.Status.Value)
+			assert.Equal(t, tt.status == "DRAFT", resp.Status.Unknown)
+		})
+	}
+}
+
+func TestValidateEnums(t *testing.T) {
+	type line struct {
+		Status Enum[orderStatus]
+	}
+	type order struct {
+		Status   Enum[orderStatus]
+		Previous *Enum[orderStatus]
+		Lines    []line
+		ByID     map[string]Enum[orderStatus]
+		Other    any
+	}
+	assert.NoError(t, ValidateEnums(nil))
+	assert.NoError(t, ValidateEnums(&order{Status: NewEnum[orderStatus]("OPEN"), Other: "x"}))
+
+	draft := NewEnum[orderStatus]("DRAFT")
+	err := ValidateEnums(&order{
+		Status:   NewEnum[orderStatus]("OPEN"),
+		Previous: &draft,
+		Lines:    []line{{Status: NewEnum[orderStatus]("CLOSED")}, {}},
+		ByID:     map[string]Enum[orderStatus]{"a": draft},
+		Other:    line{Status: draft},
+	})
+	require.Error(t, err)
+	var fields []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		fields = append(fields, e.(*EnumValueError).Field)
+	}
+	assert.Equal(t, []string{"order.Previous", "order.Lines[1].Status", "order.ByID[a]", "order.Other.Status"}, fields)
+	assert.ErrorIs(t, err, ErrInvalidEnum)
+	assert.Contains(t, err.Error(), `field order.Previous: "DRAFT" is no soap.orderStatus`)
+}
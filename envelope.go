@@ -3,6 +3,7 @@ package soap
 import (
 	"errors"
 	"fmt"
+	"slices"
 
 	"github.com/m29h/xml"
 )
@@ -16,6 +17,12 @@ var (
 	ErrEnvelopeMisconfigured = errors.New("envelope content or fault pointer empty")
 )
 
+// EmptyBody is the content of envelopes with an empty Body element, e.g. of operations only carrying headers.
+// As response it accepts an empty body, or a fault. Unlike EmptyBody, nil content is a misconfiguration.
+var EmptyBody = &emptyBody{}
+
+type emptyBody struct{}
+
 // Envelope is a SOAP envelope.
 type Envelope struct {
 	// XMLName is the serialized name of this object.
@@ -23,6 +30,9 @@ type Envelope struct {
 
 	Header *Header
 	Body   *Body
+
+	// version is the SOAP version the envelope is encoded in and expected to be decoded from
+	version Version
 }
 
 // HeaderBuilder is a function that takes a interface to the body and
@@ -40,12 +50,15 @@ func NewEnvelope(content interface{}) *Envelope {
 	switch v := content.(type) {
 	case []any: // content array with multiple elements
 		return &Envelope{Body: &Body{Content: v}}
+	case *emptyBody:
+		return &Envelope{Body: &Body{Content: []any{}}}
 	}
 	//single element body content
 	return &Envelope{Body: &Body{Content: []any{content}}}
 }
 
 // AddHeaders adds additional headers to be serialized to the resulting SOAP envelope.
+// RawHeader elements are written unchanged.
 func (e *Envelope) AddHeaders(elems ...any) {
 	if e.Header == nil {
 		e.Header = &Header{}
@@ -60,6 +73,12 @@ type Header struct {
 	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Header"`
 	// Headers is an array of envelope headers to send.
 	Headers []interface{} `xml:",omitempty"`
+	// Raw holds the header elements of a decoded envelope.
+	Raw []RawHeader `xml:"-"`
+
+	// scope holds the namespace declarations of the enclosing Envelope element while decoding
+	scope   []xml.Attr
+	version Version
 }
 
 // Body is a SOAP envelope body.
@@ -73,6 +92,17 @@ type Body struct {
 	Fault *Fault `xml:",omitempty"`
 	// Body is a SOAP request or response body.
 	Content []interface{} `xml:",omitempty"`
+
+	version       Version
+	lenientFaults bool
+	// languages are the preferred languages of the fault string, see WithPreferredLanguages
+	languages []string
+	// expect is the name the first body element must have if not nil
+	expect *xml.Name
+	// strictFaults clears the content once a fault is found, see WithStrictFaultBody
+	strictFaults bool
+	// partial is set if the body held content along with the fault
+	partial bool
 }
 
 // UnmarshalXML is an overridden deserialization routine used to decode a SOAP envelope body.
@@ -87,9 +117,13 @@ func (b *Body) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 			return ErrEnvelopeMisconfigured
 		}
 	}
-	b.Fault = NewFault()
+	// the fault stays in place if no content element is found, except for bodies expected to be empty
+	if len(b.Content) > 0 {
+		b.Fault = NewFault()
+	}
 
 	elementDone := make([]bool, len(b.Content))
+	first, faulted := true, false
 tokens:
 	for {
 		token, err := d.Token()
@@ -103,17 +137,16 @@ tokens:
 		case xml.StartElement:
 			// If the start element is a fault decode it as a fault, otherwise parse it as content.
 			var err error
-			if elem.Name.Space == soapEnvNS && elem.Name.Local == "Fault" {
-				err = d.DecodeElement(b.Fault, &elem)
-				if err != nil {
+			if elem.Name.Space == b.version.namespace() && elem.Name.Local == "Fault" {
+				if err := b.decodeFault(d, elem, false); err != nil {
 					return err
 				}
-				// Clear the content if we have a fault
-				if b.Fault.DetailInternal.Content == "" {
-					b.Fault.DetailInternal = nil
-				}
-				b.Content = nil
+				faulted = true
 			} else {
+				if first && b.expect != nil && !matchName(*b.expect, elem.Name) {
+					return &UnexpectedElementError{Expected: *b.expect, Got: elem.Name}
+				}
+				first = false
 				for i := range b.Content {
 					if elementDone[i] {
 						continue
@@ -123,10 +156,19 @@ tokens:
 						continue
 					} else {
 						elementDone[i] = true
-						b.Fault = nil
+						if !faulted {
+							b.Fault = nil
+						}
 						continue tokens
 					}
 				}
+				if b.lenientFaults && elem.Name.Local == "Fault" {
+					if err := b.decodeFault(d, elem, true); err != nil {
+						return err
+					}
+					faulted = true
+					continue tokens
+				}
 				if err != nil {
 					return err
 				}
@@ -134,7 +176,52 @@ tokens:
 			}
 		case xml.EndElement:
 			// We expect the Body to have a single entry, so once we encounter the end element we're done.
+			b.partial = faulted && !b.strictFaults && slices.Contains(elementDone, true)
+			if faulted && !b.partial {
+				b.Content = nil
+			}
 			return nil
 		}
 	}
 }
+
+// decodeFault decodes the fault element start and clears the content. A non-conformant fault is decoded
+// regardless of its namespace.
+func (b *Body) decodeFault(d *xml.Decoder, start xml.StartElement, nonConformant bool) error {
+	if b.Fault == nil {
+		b.Fault = NewFault()
+	}
+	var err error
+	switch {
+	case b.version == SOAP12:
+		err = b.Fault.unmarshalSOAP12(d, start, b.languages)
+	default:
+		// the fields of Fault without the namespaced XMLName, which a non-conformant fault lacks
+		var f struct {
+			Code           string       `xml:"faultcode"`
+			String         []faultText  `xml:"faultstring"`
+			Actor          string       `xml:"faultactor"`
+			DetailInternal *faultDetail `xml:"detail"`
+		}
+		// the fields decoded before an error are kept for the error of the call
+		err = d.DecodeElement(&f, &start)
+		b.Fault.XMLName = start.Name
+		b.Fault.Code, b.Fault.Actor = f.Code, f.Actor
+		b.Fault.setReasons(f.String, b.languages)
+		if f.DetailInternal != nil {
+			b.Fault.DetailInternal = f.DetailInternal
+		}
+	}
+	if err != nil {
+		return err
+	}
+	b.Fault.NonConformant = nonConformant
+	if b.Fault.DetailInternal.Content == "" {
+		b.Fault.DetailInternal = nil
+	}
+	if b.strictFaults {
+		// Clear the content if we have a fault
+		b.Content = nil
+	}
+	return nil
+}
@@ -2,10 +2,12 @@ package soap
 
 import (
 	"bytes"
+	"context"
 	"reflect"
 	"testing"
 
 	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
 )
 
 var envelopeName = xml.Name{
@@ -283,3 +285,41 @@ func TestEnvelopeDecode(t *testing.T) {
 		}
 	}
 }
+
+type heartbeatHeader struct {
+	XMLName xml.Name `xml:"urn:test Heartbeat"`
+	Node    string   `xml:"Node"`
+}
+
+func TestEmptyBody(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL, func(any) (any, error) { return &heartbeatHeader{Node: "n1"}, nil })
+	err := client.Do(context.Background(), "Heartbeat", EmptyBody, &quirksResponse{})
+	assert.NoError(t, err)
+	if assert.Len(t, *captured, 1) {
+		assert.Contains(t, (*captured)[0].body, `<_:Node>n1</_:Node></_:Heartbeat></soapenv:Header><soapenv:Body></soapenv:Body>`)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		err  error
+	}{
+		{name: "empty", body: `<soap:Body/>`},
+		{name: "whitespace", body: `<soap:Body>
+		</soap:Body>`},
+		{name: "fault", body: `<soap:Body><soap:Fault><faultcode>soap:Server</faultcode></soap:Fault></soap:Body>`, err: ErrSoapFault},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := UnmarshalResponse([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">`+tt.body+`</soap:Envelope>`), EmptyBody)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+
+	empty := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body/></soap:Envelope>`)
+	assert.NoError(t, NewClient(empty.URL).Do(context.Background(), "Heartbeat", EmptyBody, EmptyBody, AssertBodyElement()))
+
+	err = UnmarshalResponse([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body/></soap:Envelope>`), nil)
+	assert.ErrorIs(t, err, ErrEnvelopeMisconfigured)
+}
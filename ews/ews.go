@@ -0,0 +1,137 @@
+// Package ews provides the SOAP headers of Exchange Web Services: the requested schema version, impersonation,
+// the mailbox culture and the time zone context of requests, and the server version info of responses. It is
+// built on the public API of the soap package only, as an example of supporting the headers of a service.
+package ews
+
+import (
+	"errors"
+
+	"github.com/m29h/xml"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+const (
+	// TypesNamespace is the namespace of the EWS types, including the headers.
+	TypesNamespace = "http://schemas.microsoft.com/exchange/services/2006/types"
+	// MessagesNamespace is the namespace of the EWS request and response messages.
+	MessagesNamespace = "http://schemas.microsoft.com/exchange/services/2006/messages"
+)
+
+var (
+	// ErrNoServerVersion is returned by ServerVersion if the response has no ServerVersionInfo header.
+	ErrNoServerVersion = errors.New("ews: no ServerVersionInfo header")
+)
+
+// Version is a schema version of EWS requested with RequestServerVersion.
+type Version string
+
+// The schema versions of EWS.
+const (
+	Exchange2007    Version = "Exchange2007"
+	Exchange2007SP1 Version = "Exchange2007_SP1"
+	Exchange2010    Version = "Exchange2010"
+	Exchange2010SP1 Version = "Exchange2010_SP1"
+	Exchange2010SP2 Version = "Exchange2010_SP2"
+	Exchange2013    Version = "Exchange2013"
+	Exchange2013SP1 Version = "Exchange2013_SP1"
+	Exchange2016    Version = "Exchange2016"
+	V20170711       Version = "V2017_07_11"
+)
+
+// RequestServerVersionHeader is the t:RequestServerVersion header.
+type RequestServerVersionHeader struct {
+	XMLName xml.Name `xml:"http://schemas.microsoft.com/exchange/services/2006/types RequestServerVersion"`
+	Version Version  `xml:"Version,attr"`
+}
+
+// RequestServerVersion returns the builder of the RequestServerVersion header asking for the schema version.
+// EWS answers requests without it with the Exchange 2007 SP1 schema.
+func RequestServerVersion(version Version) soap.HeaderBuilder {
+	return func(any) (any, error) {
+		return &RequestServerVersionHeader{Version: version}, nil
+	}
+}
+
+// ConnectingSID identifies the account impersonated with ExchangeImpersonation. Exactly one of the fields is
+// to be set.
+type ConnectingSID struct {
+	PrincipalName      string `xml:"http://schemas.microsoft.com/exchange/services/2006/types PrincipalName,omitempty"`
+	SID                string `xml:"http://schemas.microsoft.com/exchange/services/2006/types SID,omitempty"`
+	PrimarySmtpAddress string `xml:"http://schemas.microsoft.com/exchange/services/2006/types PrimarySmtpAddress,omitempty"`
+	SmtpAddress        string `xml:"http://schemas.microsoft.com/exchange/services/2006/types SmtpAddress,omitempty"`
+}
+
+// ExchangeImpersonationHeader is the t:ExchangeImpersonation header.
+type ExchangeImpersonationHeader struct {
+	XMLName       xml.Name      `xml:"http://schemas.microsoft.com/exchange/services/2006/types ExchangeImpersonation"`
+	ConnectingSID ConnectingSID `xml:"http://schemas.microsoft.com/exchange/services/2006/types ConnectingSID"`
+}
+
+// ExchangeImpersonation returns the builder of the ExchangeImpersonation header, making the request on behalf
+// of the account sid. The credentials of the client need the ApplicationImpersonation role.
+func ExchangeImpersonation(sid ConnectingSID) soap.HeaderBuilder {
+	return func(any) (any, error) {
+		return &ExchangeImpersonationHeader{ConnectingSID: sid}, nil
+	}
+}
+
+// MailboxCultureHeader is the t:MailboxCulture header.
+type MailboxCultureHeader struct {
+	XMLName xml.Name `xml:"http://schemas.microsoft.com/exchange/services/2006/types MailboxCulture"`
+	Culture string   `xml:",chardata"`
+}
+
+// MailboxCulture returns the builder of the MailboxCulture header, the culture of the mailbox, e.g. "en-US",
+// used for the names of folders created by the server.
+func MailboxCulture(culture string) soap.HeaderBuilder {
+	return func(any) (any, error) {
+		return &MailboxCultureHeader{Culture: culture}, nil
+	}
+}
+
+// TimeZoneDefinition names a time zone of the server.
+type TimeZoneDefinition struct {
+	ID string `xml:"Id,attr"`
+}
+
+// TimeZoneContextHeader is the t:TimeZoneContext header.
+type TimeZoneContextHeader struct {
+	XMLName            xml.Name           `xml:"http://schemas.microsoft.com/exchange/services/2006/types TimeZoneContext"`
+	TimeZoneDefinition TimeZoneDefinition `xml:"http://schemas.microsoft.com/exchange/services/2006/types TimeZoneDefinition"`
+}
+
+// TimeZoneContext returns the builder of the TimeZoneContext header with the Windows time zone id, e.g.
+// "W. Europe Standard Time", which the server converts the times of the response into.
+func TimeZoneContext(id string) soap.HeaderBuilder {
+	return func(any) (any, error) {
+		return &TimeZoneContextHeader{TimeZoneDefinition: TimeZoneDefinition{ID: id}}, nil
+	}
+}
+
+// ServerVersionInfo is the t:ServerVersionInfo header of responses, the version of the Exchange server which
+// processed the request and the schema version of the response.
+type ServerVersionInfo struct {
+	XMLName          xml.Name `xml:"http://schemas.microsoft.com/exchange/services/2006/types ServerVersionInfo"`
+	MajorVersion     int      `xml:"MajorVersion,attr"`
+	MinorVersion     int      `xml:"MinorVersion,attr"`
+	MajorBuildNumber int      `xml:"MajorBuildNumber,attr"`
+	MinorBuildNumber int      `xml:"MinorBuildNumber,attr"`
+	// Version is the schema version, sent by Exchange 2010 and later.
+	Version Version `xml:"Version,attr"`
+}
+
+// ServerVersion returns the ServerVersionInfo among the response headers, e.g. the SOAPHeaders of the
+// soap.ResponseInfo of a call. It fails with ErrNoServerVersion if there is none.
+func ServerVersion(headers []soap.RawHeader) (*ServerVersionInfo, error) {
+	for _, h := range headers {
+		if h.XMLName.Space == TypesNamespace && h.XMLName.Local == "ServerVersionInfo" {
+			info := &ServerVersionInfo{}
+			if err := h.Decode(info); err != nil {
+				return nil, err
+			}
+			return info, nil
+		}
+	}
+	return nil, ErrNoServerVersion
+}
@@ -0,0 +1,95 @@
+package ews
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+	"github.com/OmerBerkcanMee/gosoap/soaptest"
+)
+
+type getFolder struct {
+	XMLName     xml.Name `xml:"http://schemas.microsoft.com/exchange/services/2006/messages GetFolder"`
+	FolderShape struct {
+		BaseShape string `xml:"http://schemas.microsoft.com/exchange/services/2006/types BaseShape"`
+	} `xml:"http://schemas.microsoft.com/exchange/services/2006/messages FolderShape"`
+	FolderIds struct {
+		DistinguishedFolderID struct {
+			ID string `xml:"Id,attr"`
+		} `xml:"http://schemas.microsoft.com/exchange/services/2006/types DistinguishedFolderId"`
+	} `xml:"http://schemas.microsoft.com/exchange/services/2006/messages FolderIds"`
+}
+
+type getFolderResponse struct {
+	XMLName xml.Name `xml:"http://schemas.microsoft.com/exchange/services/2006/messages GetFolderResponse"`
+	Message struct {
+		ResponseClass string `xml:"ResponseClass,attr"`
+		ResponseCode  string `xml:"ResponseCode"`
+		Folder        struct {
+			DisplayName string `xml:"DisplayName"`
+			TotalCount  int    `xml:"TotalCount"`
+			UnreadCount int    `xml:"UnreadCount"`
+		} `xml:"Folders>Folder"`
+	} `xml:"ResponseMessages>GetFolderResponseMessage"`
+}
+
+func inbox() *getFolder {
+	req := &getFolder{}
+	req.FolderShape.BaseShape = "Default"
+	req.FolderIds.DistinguishedFolderID.ID = "inbox"
+	return req
+}
+
+func TestHeaders(t *testing.T) {
+	srv := soaptest.NewServer(t)
+	require.NoError(t, srv.LoadFixtures("testdata"))
+
+	tests := []struct {
+		name    string
+		headers []soap.HeaderBuilder
+		folder  string
+	}{
+		{name: "server version", headers: []soap.HeaderBuilder{RequestServerVersion(Exchange2013SP1)}, folder: "Inbox"},
+		{
+			name: "impersonation",
+			headers: []soap.HeaderBuilder{
+				RequestServerVersion(Exchange2013SP1),
+				ExchangeImpersonation(ConnectingSID{PrimarySmtpAddress: "alex@contoso.example"}),
+				MailboxCulture("de-DE"),
+				TimeZoneContext("W. Europe Standard Time"),
+			},
+			folder: "Posteingang",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := soap.NewClient(srv.URL, tt.headers...)
+			resp := &getFolderResponse{}
+			info := &soap.ResponseInfo{}
+			require.NoError(t, client.Do(context.Background(), MessagesNamespace+"/GetFolder", inbox(), resp,
+				soap.WithResponseInfo(info)))
+			assert.Equal(t, "NoError", resp.Message.ResponseCode)
+			assert.Equal(t, tt.folder, resp.Message.Folder.DisplayName)
+
+			version, err := ServerVersion(info.SOAPHeaders)
+			require.NoError(t, err)
+			assert.Equal(t, &ServerVersionInfo{
+				XMLName:          xml.Name{Space: TypesNamespace, Local: "ServerVersionInfo"},
+				MajorVersion:     15,
+				MinorVersion:     20,
+				MajorBuildNumber: 5452,
+				MinorBuildNumber: 22,
+				Version:          "V2018_01_08",
+			}, version)
+		})
+	}
+}
+
+func TestServerVersionMissing(t *testing.T) {
+	_, err := ServerVersion([]soap.RawHeader{{XMLName: xml.Name{Space: "urn:other", Local: "ServerVersionInfo"}}})
+	assert.ErrorIs(t, err, ErrNoServerVersion)
+}
@@ -3,7 +3,10 @@ package soap
 import (
 	"errors"
 	"fmt"
+	"io"
+	"reflect"
 	"strings"
+	"time"
 
 	"github.com/m29h/xml"
 )
@@ -11,6 +14,10 @@ import (
 var (
 	// a fault body element was received
 	ErrSoapFault = errors.New("soap fault")
+	// ErrNoFaultDetail is returned by DecodeDetail if the error is no fault or the fault has no detail.
+	ErrNoFaultDetail = errors.New("no fault detail")
+	// ErrInvalidDetailTarget is returned by DecodeDetail if the value to decode into is not a non-nil pointer.
+	ErrInvalidDetailTarget = errors.New("fault detail target must be a non-nil pointer")
 )
 
 // Fault is a SOAP fault code.
@@ -21,6 +28,17 @@ type Fault struct {
 	Code   string `xml:"faultcode,omitempty"`
 	String string `xml:"faultstring,omitempty"`
 	Actor  string `xml:"faultactor,omitempty"`
+	// Subcode is the first subcode of a SOAP 1.2 fault.
+	Subcode string `xml:"-"`
+	// Lang is the xml:lang of String, empty if the server did not name its language.
+	Lang string `xml:"-"`
+	// Reasons are the fault strings of all languages of a received fault, see WithPreferredLanguages.
+	Reasons []FaultReason `xml:"-"`
+	// NonConformant is set if the fault was only detected with LenientFaults, as its element was not in the
+	// envelope namespace.
+	NonConformant bool `xml:"-"`
+	// RetryAfter is the time the server asked to wait before the next call, as extracted with WithRetryAfter.
+	RetryAfter time.Duration `xml:"-"`
 
 	// DetailInternal is a handle to the internal fault detail type. Do not directly access;
 	// this is made public only to allow for XML deserialization.
@@ -28,6 +46,25 @@ type Fault struct {
 	DetailInternal *faultDetail `xml:"detail,omitempty"`
 }
 
+// LenientFaults detects a Fault element in the response body regardless of its namespace, if it does not match
+// the response type. Such faults are returned with NonConformant set. It does not apply to DoStream.
+func LenientFaults() Option {
+	return func(s *settings) error {
+		s.lenientFaults = true
+		return nil
+	}
+}
+
+// WithStrictFaultBody takes a body with a fault as fault only, as before bodies holding response content next
+// to the fault were decoded as PartialResponseError: content after the fault fails the decoding and content
+// before it is decoded but not reported.
+func WithStrictFaultBody() Option {
+	return func(s *settings) error {
+		s.strictFaults = true
+		return nil
+	}
+}
+
 // NewFault returns a new XML fault struct
 func NewFault() *Fault {
 	return &Fault{DetailInternal: &faultDetail{}}
@@ -50,6 +87,60 @@ func (f *Fault) Unwrap() error {
 	return ErrSoapFault
 }
 
+// Detail returns the content of the detail element as raw XML, empty if the fault has no detail.
+// Namespace prefixes declared outside the detail element are not declared within the returned XML.
+func (f *Fault) Detail() string {
+	if f.DetailInternal == nil {
+		return ""
+	}
+	return f.DetailInternal.Content
+}
+
+// DecodeDetail decodes the first element of the detail into v, which must be a non-nil pointer, e.g. to the
+// type of the faults documented for the operation. The element has to match the XMLName of v if it has one.
+// Namespace prefixes declared outside the detail element are unknown, as with Detail.
+func (f *Fault) DecodeDetail(v any) error {
+	if err := checkDetailTarget(v); err != nil {
+		return err
+	}
+	if strings.TrimSpace(f.Detail()) == "" {
+		return ErrNoFaultDetail
+	}
+	dec := xml.NewDecoder(strings.NewReader(f.Detail()))
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return ErrNoFaultDetail
+		}
+		if err != nil {
+			return err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			return dec.DecodeElement(v, &start)
+		}
+	}
+}
+
+// DecodeDetail decodes the detail of the fault err holds into v, see Fault.DecodeDetail. It returns
+// ErrNoFaultDetail if err is no fault.
+func DecodeDetail(err error, v any) error {
+	var fault *Fault
+	if !errors.As(err, &fault) {
+		if err := checkDetailTarget(v); err != nil {
+			return err
+		}
+		return ErrNoFaultDetail
+	}
+	return fault.DecodeDetail(v)
+}
+
+func checkDetailTarget(v any) error {
+	if rv := reflect.ValueOf(v); rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("%w, got %T", ErrInvalidDetailTarget, v)
+	}
+	return nil
+}
+
 // faultDetail is an implementation detail of how we parse out the optional detail element of the XML fault.
 type faultDetail struct {
 	Content string `xml:",innerxml"`
@@ -69,3 +160,35 @@ func (f *faultDetail) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error
 	f.Content = fd.Content
 	return nil
 }
+
+// fault12 is the layout of a SOAP 1.2 fault.
+type fault12 struct {
+	Code struct {
+		Value   string `xml:"Value"`
+		Subcode struct {
+			Value string `xml:"Value"`
+		} `xml:"Subcode"`
+	} `xml:"Code"`
+	Reason struct {
+		Text []faultText `xml:"Text"`
+	} `xml:"Reason"`
+	Role   string       `xml:"Role"`
+	Detail *faultDetail `xml:"Detail"`
+}
+
+// unmarshalSOAP12 decodes a SOAP 1.2 fault into the SOAP 1.1 fields of f. The reason text of the preferred
+// languages becomes the fault string and the role the fault actor.
+func (f *Fault) unmarshalSOAP12(d *xml.Decoder, start xml.StartElement, languages []string) error {
+	var v fault12
+	// the fields decoded before an error are kept for the error of the call
+	err := d.DecodeElement(&v, &start)
+	f.XMLName = start.Name
+	f.Code = v.Code.Value
+	f.Subcode = v.Code.Subcode.Value
+	f.setReasons(v.Reason.Text, languages)
+	f.Actor = v.Role
+	if v.Detail != nil {
+		f.DetailInternal = v.Detail
+	}
+	return err
+}
@@ -2,10 +2,15 @@ package soap
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
 )
 
 var faultName = xml.Name{
@@ -210,3 +215,95 @@ func TestFaultDecode(t *testing.T) {
 		}
 	}
 }
+
+func TestLenientFaults(t *testing.T) {
+	const envelope = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>%s</soap:Body></soap:Envelope>`
+	tests := []struct {
+		name          string
+		fault         string
+		lenient       bool
+		nonConformant bool
+	}{
+		{
+			name:          "no namespace",
+			fault:         `<Fault><faultcode>Server</faultcode><faultstring>boom</faultstring></Fault>`,
+			lenient:       true,
+			nonConformant: true,
+		},
+		{
+			name:          "undeclared prefix",
+			fault:         `<SOAP-ENV:Fault><faultcode>Server</faultcode><faultstring>boom</faultstring><detail><Info>x</Info></detail></SOAP-ENV:Fault>`,
+			lenient:       true,
+			nonConformant: true,
+		},
+		{
+			name:    "conformant",
+			fault:   `<soap:Fault><faultcode>Server</faultcode><faultstring>boom</faultstring></soap:Fault>`,
+			lenient: true,
+		},
+		{
+			name:  "strict",
+			fault: `<Fault><faultcode>Server</faultcode><faultstring>boom</faultstring></Fault>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInfoServer(t, "text/xml", fmt.Sprintf(envelope, tt.fault))
+			var opts []Option
+			if tt.lenient {
+				opts = append(opts, LenientFaults())
+			}
+			err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, opts...)
+			var fault *Fault
+			if !tt.lenient {
+				assert.False(t, errors.As(err, &fault))
+				return
+			}
+			if assert.ErrorAs(t, err, &fault) {
+				assert.Equal(t, "Server", fault.Code)
+				assert.Equal(t, "boom", fault.String)
+				assert.Equal(t, tt.nonConformant, fault.NonConformant)
+			}
+		})
+	}
+}
+
+func TestFaultDetail(t *testing.T) {
+	assert.Equal(t, "", (&Fault{}).Detail())
+	assert.Equal(t, "<Reason>x</Reason>", (&Fault{DetailInternal: &faultDetail{Content: "<Reason>x</Reason>"}}).Detail())
+}
+
+type orderFault struct {
+	XMLName xml.Name `xml:"urn:err OrderFault"`
+	Code    string   `xml:"Code"`
+	Order   int      `xml:"Order"`
+}
+
+func TestDecodeDetail(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>`+
+		`<faultcode>soap:Server</faultcode><faultstring>failed</faultstring>`+
+		`<detail><!-- order --><e:OrderFault xmlns:e="urn:err"><e:Code>E1</e:Code><e:Order>42</e:Order></e:OrderFault></detail>`+
+		`</soap:Fault></soap:Body></soap:Envelope>`)
+	// the detail is kept on the fault, there is no detail type to pass to Do
+	err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, ErrSoapFault)
+
+	var detail orderFault
+	if assert.NoError(t, DecodeDetail(err, &detail)) {
+		assert.Equal(t, "E1", detail.Code)
+		assert.Equal(t, 42, detail.Order)
+	}
+	var other struct {
+		XMLName xml.Name `xml:"urn:err QuotaFault"`
+	}
+	assert.Error(t, DecodeDetail(err, &other))
+
+	assert.ErrorIs(t, DecodeDetail(err, detail), ErrInvalidDetailTarget)
+	assert.ErrorIs(t, DecodeDetail(err, nil), ErrInvalidDetailTarget)
+	assert.ErrorIs(t, DecodeDetail(err, (*orderFault)(nil)), ErrInvalidDetailTarget)
+	assert.ErrorIs(t, DecodeDetail(errors.New("timeout"), orderFault{}), ErrInvalidDetailTarget)
+	assert.ErrorIs(t, DecodeDetail(errors.New("timeout"), &detail), ErrNoFaultDetail)
+	assert.ErrorIs(t, (&Fault{}).DecodeDetail(&detail), ErrNoFaultDetail)
+	assert.ErrorIs(t, (&Fault{DetailInternal: &faultDetail{Content: " <!-- none --> "}}).DecodeDetail(&detail), ErrNoFaultDetail)
+}
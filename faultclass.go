@@ -0,0 +1,132 @@
+package soap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// FaultClass is the category of a SOAP fault, deciding how a failed call is handled.
+type FaultClass int
+
+const (
+	// FaultTerminal faults are returned to the caller as is.
+	FaultTerminal FaultClass = iota
+	// FaultRetryable faults are retried with the retry policy for idempotent actions only, as the server may
+	// have processed the request before failing, e.g. with a timeout.
+	FaultRetryable
+	// FaultThrottled faults signal an overloaded server rejecting the request before processing it. They are
+	// retried with the backoff of the retry policy, even for actions not marked idempotent.
+	FaultThrottled
+	// FaultAuthRequired faults are retried once after reauthenticating, see WithReauthenticate.
+	FaultAuthRequired
+)
+
+func (c FaultClass) String() string {
+	switch c {
+	case FaultTerminal:
+		return "terminal"
+	case FaultRetryable:
+		return "retryable"
+	case FaultThrottled:
+		return "throttled"
+	case FaultAuthRequired:
+		return "auth required"
+	}
+	return fmt.Sprintf("FaultClass(%d)", int(c))
+}
+
+// FaultClassifier categorizes a fault.
+type FaultClassifier func(f *Fault) FaultClass
+
+// WithFaultClassifier replaces DefaultFaultClassifier for the classification of faults.
+func WithFaultClassifier(classifier FaultClassifier) Option {
+	return func(s *settings) error {
+		s.faultClassifier = classifier
+		return nil
+	}
+}
+
+// WithReauthenticate calls reauthenticate when a call failed with a FaultAuthRequired fault, e.g. to renew
+// the credentials used by the header builders, and repeats the call once.
+func WithReauthenticate(reauthenticate func(ctx context.Context) error) Option {
+	return func(s *settings) error {
+		s.reauthenticate = reauthenticate
+		return nil
+	}
+}
+
+// DefaultFaultClassifier classifies the standard SOAP 1.1 and 1.2 fault codes and the WS-Security fault codes.
+// Codes are matched by their local name, the subcodes of SOAP 1.1 dotted fault codes like Server.Busy are
+// taken into account.
+//
+//   - Server.Busy and Server.Throttled are throttled
+//   - Server.Timeout, Server.Unavailable and wsse:MessageExpired are retryable
+//   - wsse:FailedAuthentication, wsse:InvalidSecurityToken and wsse:SecurityTokenUnavailable require authentication
+//   - all other faults are terminal
+func DefaultFaultClassifier(f *Fault) FaultClass {
+	code := f.Code
+	if i := strings.LastIndexByte(code, ':'); i >= 0 {
+		code = code[i+1:]
+	}
+	switch code {
+	case "FailedAuthentication", "InvalidSecurityToken", "SecurityTokenUnavailable":
+		return FaultAuthRequired
+	case "MessageExpired":
+		return FaultRetryable
+	}
+
+	codes := strings.Split(code, ".")
+	if codes[0] != "Server" && codes[0] != "Receiver" {
+		return FaultTerminal
+	}
+	for _, sub := range codes[1:] {
+		switch sub {
+		case "Busy", "Throttled":
+			return FaultThrottled
+		case "Timeout", "Unavailable":
+			return FaultRetryable
+		}
+	}
+	return FaultTerminal
+}
+
+// FaultHTTPStatus maps a fault to the HTTP status code best describing it, e.g. for a gateway translating
+// faults. Client and sender faults map to 400 Bad Request, the other faults by their DefaultFaultClassifier class.
+func FaultHTTPStatus(f *Fault) int {
+	switch DefaultFaultClassifier(f) {
+	case FaultAuthRequired:
+		return http.StatusUnauthorized
+	case FaultThrottled:
+		return http.StatusTooManyRequests
+	case FaultRetryable:
+		return http.StatusServiceUnavailable
+	}
+	code := f.Code
+	if i := strings.LastIndexByte(code, ':'); i >= 0 {
+		code = code[i+1:]
+	}
+	if code, _, _ := strings.Cut(code, "."); code == "Client" || code == "Sender" {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// faultClass returns the class of the fault in err, ok is false if err is not a fault.
+func (s *settings) faultClass(err error) (class FaultClass, ok bool) {
+	fault := ExtractFault(err)
+	if fault == nil {
+		return FaultTerminal, false
+	}
+	if s.faultClassifier != nil {
+		return s.faultClassifier(fault), true
+	}
+	return DefaultFaultClassifier(fault), true
+}
+
+// needsReauthentication reports whether the call failing with err is to be repeated after reauthenticating.
+func (s *settings) needsReauthentication(err error) bool {
+	class, ok := s.faultClass(err)
+	return ok && class == FaultAuthRequired && s.reauthenticate != nil
+}
@@ -0,0 +1,154 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultFaultClassifier(t *testing.T) {
+	tests := []struct {
+		code   string
+		class  FaultClass
+		status int
+	}{
+		{code: "soap:Server", class: FaultTerminal, status: http.StatusInternalServerError},
+		{code: "soap:Client", class: FaultTerminal, status: http.StatusBadRequest},
+		{code: "env:Sender", class: FaultTerminal, status: http.StatusBadRequest},
+		{code: "soap:Server.Busy", class: FaultThrottled, status: http.StatusTooManyRequests},
+		{code: "Server.Database.Timeout", class: FaultRetryable, status: http.StatusServiceUnavailable},
+		{code: "env:Receiver", class: FaultTerminal, status: http.StatusInternalServerError},
+		{code: "wsse:FailedAuthentication", class: FaultAuthRequired, status: http.StatusUnauthorized},
+		{code: "wsse:InvalidSecurityToken", class: FaultAuthRequired, status: http.StatusUnauthorized},
+		{code: "wsu:MessageExpired", class: FaultRetryable, status: http.StatusServiceUnavailable},
+		{code: "wsse:FailedCheck", class: FaultTerminal, status: http.StatusInternalServerError},
+		{code: "soap:MustUnderstand", class: FaultTerminal, status: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		f := &Fault{Code: tt.code}
+		assert.Equal(t, tt.class, DefaultFaultClassifier(f), tt.code)
+		assert.Equal(t, tt.status, FaultHTTPStatus(f), tt.code)
+	}
+}
+
+// newFaultServer answers the first len(codes) requests with faults of the codes.
+func newFaultServer(t *testing.T, codes ...string) (*httptest.Server, *int) {
+	t.Helper()
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "text/xml")
+		if calls <= len(codes) {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+				`<soap:Fault><faultcode>%s</faultcode><faultstring>failed</faultstring></soap:Fault></soap:Body></soap:Envelope>`, codes[calls-1])
+			return
+		}
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetryThrottledFault(t *testing.T) {
+	srv, calls := newFaultServer(t, "soap:Server.Busy")
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithRetry(fastRetry)))
+
+	err := client.Do(context.Background(), "CreateOrder", &infoRequest{}, &infoResponse{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, *calls)
+}
+
+func TestRetryTerminalFault(t *testing.T) {
+	srv, calls := newFaultServer(t, "soap:Server")
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithRetry(fastRetry), MarkIdempotent("GetInfo")))
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	var fault *Fault
+	assert.True(t, errors.As(err, &fault))
+	assert.Equal(t, 1, *calls)
+}
+
+func TestCustomFaultClassifier(t *testing.T) {
+	srv, calls := newFaultServer(t, "app:Deadlock")
+	client := NewClient(srv.URL)
+	classifier := func(f *Fault) FaultClass {
+		if f.Code == "app:Deadlock" {
+			return FaultRetryable
+		}
+		return DefaultFaultClassifier(f)
+	}
+	assert.NoError(t, client.SetOptions(WithRetry(fastRetry), WithFaultClassifier(classifier), MarkIdempotent("GetOrder")))
+
+	assert.NoError(t, client.Do(context.Background(), "GetOrder", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, 2, *calls)
+}
+
+func TestRetryableFaultNotIdempotent(t *testing.T) {
+	// the server may have placed the order before timing out
+	for _, code := range []string{"soap:Server.Timeout", "soap:Server.Unavailable", "wsse:MessageExpired"} {
+		srv, calls := newFaultServer(t, code)
+		client := NewClient(srv.URL)
+		assert.NoError(t, client.SetOptions(WithRetry(fastRetry)))
+		err := client.Do(context.Background(), "CreateOrder", &infoRequest{}, &infoResponse{})
+		assert.Equal(t, code, ExtractFault(err).Code)
+		assert.Equal(t, 1, *calls, code)
+
+		srv, calls = newFaultServer(t, code)
+		client = NewClient(srv.URL)
+		assert.NoError(t, client.SetOptions(WithRetry(fastRetry), MarkIdempotent("GetInfo")))
+		assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+		assert.Equal(t, 2, *calls, code)
+	}
+}
+
+func TestReauthenticate(t *testing.T) {
+	srv, calls := newFaultServer(t, "wsse:FailedAuthentication")
+	client := NewClient(srv.URL)
+	reauths := 0
+	assert.NoError(t, client.SetOptions(WithReauthenticate(func(ctx context.Context) error {
+		reauths++
+		return nil
+	})))
+
+	assert.NoError(t, client.Do(context.Background(), "CreateOrder", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, 1, reauths)
+	assert.Equal(t, 2, *calls)
+}
+
+func TestReauthenticateOnce(t *testing.T) {
+	srv, calls := newFaultServer(t, "wsse:FailedAuthentication", "wsse:FailedAuthentication")
+	client := NewClient(srv.URL)
+	reauths := 0
+	assert.NoError(t, client.SetOptions(WithReauthenticate(func(ctx context.Context) error {
+		reauths++
+		return nil
+	})))
+
+	err := client.Do(context.Background(), "CreateOrder", &infoRequest{}, &infoResponse{})
+	var fault *Fault
+	assert.True(t, errors.As(err, &fault))
+	assert.Equal(t, 1, reauths)
+	assert.Equal(t, 2, *calls)
+}
+
+func TestReauthenticateFailure(t *testing.T) {
+	srv, calls := newFaultServer(t, "wsse:FailedAuthentication")
+	client := NewClient(srv.URL)
+	errLogin := errors.New("login failed")
+	assert.NoError(t, client.SetOptions(WithReauthenticate(func(ctx context.Context) error {
+		return errLogin
+	})))
+
+	err := client.Do(context.Background(), "CreateOrder", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, errLogin)
+	assert.ErrorIs(t, err, ErrSoapFault)
+	assert.Equal(t, 1, *calls)
+}
@@ -0,0 +1,82 @@
+package soap
+
+import (
+	"strings"
+)
+
+// FaultCode is a standard fault code of SOAP 1.1 and its SOAP 1.2 counterpart. The codes are errors.Is targets
+// for faults, e.g. errors.Is(err, FaultClientError) holds for faults with the code soap:Client, Client.Auth
+// or env:Sender. Codes are compared by their local name, the namespace prefix is ignored.
+type FaultCode struct {
+	soap11 string
+	soap12 string
+}
+
+var (
+	// FaultVersionMismatchError matches VersionMismatch faults.
+	FaultVersionMismatchError = &FaultCode{soap11: "VersionMismatch", soap12: "VersionMismatch"}
+	// FaultMustUnderstandError matches MustUnderstand faults.
+	FaultMustUnderstandError = &FaultCode{soap11: "MustUnderstand", soap12: "MustUnderstand"}
+	// FaultClientError matches Client faults of SOAP 1.1 and Sender faults of SOAP 1.2.
+	FaultClientError = &FaultCode{soap11: "Client", soap12: "Sender"}
+	// FaultServerError matches Server faults of SOAP 1.1 and Receiver faults of SOAP 1.2.
+	FaultServerError = &FaultCode{soap11: "Server", soap12: "Receiver"}
+	// FaultDataEncodingUnknownError matches DataEncodingUnknown faults.
+	FaultDataEncodingUnknownError = &FaultCode{soap11: "DataEncodingUnknown", soap12: "DataEncodingUnknown"}
+
+	faultCodes = []*FaultCode{FaultVersionMismatchError, FaultMustUnderstandError, FaultClientError,
+		FaultServerError, FaultDataEncodingUnknownError}
+)
+
+func (c *FaultCode) Error() string {
+	return "soap fault " + c.soap11
+}
+
+// Name returns the unqualified name of the code in version v.
+func (c *FaultCode) Name(v Version) string {
+	if v == SOAP12 {
+		return c.soap12
+	}
+	return c.soap11
+}
+
+// matches reports whether the fault code is c, in either version. The subcodes of SOAP 1.1 dotted codes like
+// Client.Authentication are ignored.
+func (c *FaultCode) matches(code string) bool {
+	if i := strings.LastIndexByte(code, ':'); i >= 0 {
+		code = code[i+1:]
+	}
+	code, _, _ = strings.Cut(strings.TrimSpace(code), ".")
+	return code == c.soap11 || code == c.soap12
+}
+
+// Is reports whether target is the standard code of the fault, see FaultCode.
+func (f *Fault) Is(target error) bool {
+	c, ok := target.(*FaultCode)
+	return ok && c.matches(f.Code)
+}
+
+// StandardCode returns the standard code of the fault, nil if it has another code. The result can be
+// switched on:
+//
+//	switch fault.StandardCode() {
+//	case soap.FaultClientError:
+//	case soap.FaultServerError:
+//	}
+func (f *Fault) StandardCode() *FaultCode {
+	for _, c := range faultCodes {
+		if c.matches(f.Code) {
+			return c
+		}
+	}
+	return nil
+}
+
+// NewCodeFault returns a fault with the standard code of version v qualified with the soap prefix, e.g.
+// soap:Client or soap:Sender, and reason as fault string. The fault matches code with errors.Is.
+func NewCodeFault(code *FaultCode, v Version, reason string) *Fault {
+	f := NewFault()
+	f.Code = "soap:" + code.Name(v)
+	f.String = reason
+	return f
+}
@@ -0,0 +1,67 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFaultIs(t *testing.T) {
+	var tests = []struct {
+		code string
+		want *FaultCode
+	}{
+		{"soap:Client", FaultClientError},
+		{"Client", FaultClientError},
+		{"SOAP-ENV:Client.Authentication", FaultClientError},
+		{"env:Sender", FaultClientError},
+		{"Sender", FaultClientError},
+		{"soap:Server", FaultServerError},
+		{"s:Receiver", FaultServerError},
+		{"soap:VersionMismatch", FaultVersionMismatchError},
+		{"MustUnderstand", FaultMustUnderstandError},
+		{"env:DataEncodingUnknown", FaultDataEncodingUnknownError},
+		{"tns:Custom", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			fault := &Fault{Code: tt.code}
+			err := fmt.Errorf("call: %w", fault)
+			assert.Equal(t, tt.want, fault.StandardCode())
+			for _, c := range faultCodes {
+				assert.Equal(t, c == tt.want, errors.Is(err, c), c.Error())
+			}
+			assert.ErrorIs(t, err, ErrSoapFault)
+		})
+	}
+}
+
+func TestNewCodeFault(t *testing.T) {
+	f := NewCodeFault(FaultClientError, SOAP11, "bad input")
+	assert.Equal(t, "soap:Client", f.Code)
+	assert.Equal(t, "bad input", f.String)
+	assert.ErrorIs(t, f, FaultClientError)
+
+	f = NewCodeFault(FaultServerError, SOAP12, "down")
+	assert.Equal(t, "soap:Receiver", f.Code)
+	assert.ErrorIs(t, f, FaultServerError)
+	assert.NotErrorIs(t, f, FaultClientError)
+}
+
+func TestFaultIsResponse(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+		`<soap:Fault><faultcode>soap:Client</faultcode><faultstring>bad</faultstring></soap:Fault></soap:Body></soap:Envelope>`)
+	err := NewClient(srv.URL).Do(context.Background(), "Info", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, FaultClientError)
+	assert.NotErrorIs(t, err, FaultServerError)
+
+	// env:Receiver in SOAP 1.2
+	srv12, _ := newVersionedServer(t, SOAP12, "soap12_fault.xml", "soap12_mismatch.xml")
+	err = NewClient(srv12.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithVersion(SOAP12))
+	assert.ErrorIs(t, err, FaultServerError)
+	assert.NotErrorIs(t, err, FaultClientError)
+}
@@ -0,0 +1,142 @@
+// Package faults provides typed fault details of common SOAP stacks: the exception details of Apache Axis and
+// CXF, WCF services including exception details in faults, and SAP. Classify tells them apart, so callers can
+// report the vendor error without decoding the raw detail themselves.
+package faults
+
+import (
+	"strings"
+
+	"github.com/m29h/xml"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+// AxisFault is the detail of Apache Axis 1 faults: the name of the Java exception, the stack trace and the
+// host name of the server, in the namespace http://xml.apache.org/axis/.
+type AxisFault struct {
+	ExceptionName string
+	StackTrace    string
+	Hostname      string
+}
+
+// JavaException is the <Exception> detail of Apache Axis2 faults, the text is the exception with its stack trace.
+type JavaException struct {
+	Text string
+}
+
+// CXFFault is the detail of Apache CXF faults with fault stack traces enabled, in the namespace
+// http://cxf.apache.org/fault.
+type CXFFault struct {
+	StackTrace string
+	// ExceptionType is the class name of the exception, sent by CXF 3 and later.
+	ExceptionType string
+}
+
+// WCFExceptionDetail is the System.ServiceModel.ExceptionDetail of WCF services with
+// IncludeExceptionDetailInFaults enabled.
+type WCFExceptionDetail struct {
+	HelpLink       string              `xml:"HelpLink"`
+	InnerException *WCFExceptionDetail `xml:"InnerException"`
+	Message        string              `xml:"Message"`
+	StackTrace     string              `xml:"StackTrace"`
+	Type           string              `xml:"Type"`
+}
+
+// SAPStandardFault is the <standard> detail (ExchangeFaultData) of the fault messages of SAP PI/PO and ABAP
+// proxies.
+type SAPStandardFault struct {
+	FaultText   string       `xml:"faultText"`
+	FaultURL    string       `xml:"faultUrl"`
+	FaultDetail []SAPLogData `xml:"faultDetail"`
+}
+
+// SAPLogData is an entry of the details of an SAPStandardFault.
+type SAPLogData struct {
+	Severity string `xml:"severity"`
+	Text     string `xml:"text"`
+	URL      string `xml:"url"`
+	ID       string `xml:"id"`
+}
+
+// SAPSystemError is the <SystemError> detail of the SAP XI/PI adapter engine.
+type SAPSystemError struct {
+	Context string `xml:"context"`
+	Code    string `xml:"code"`
+	Text    string `xml:"text"`
+}
+
+// detail holds the top-level elements of the known details. Elements are matched by local name, as the
+// prefixes of the detail content may be declared outside of it.
+type detail struct {
+	// Axis 1
+	ExceptionName *string `xml:"exceptionName"`
+	Hostname      *string `xml:"hostname"`
+	// Axis 1 and CXF
+	StackTrace    *string `xml:"stackTrace"`
+	ExceptionType *string `xml:"exceptionType"`
+	// Axis2
+	Exception *string `xml:"Exception"`
+
+	ExceptionDetail *WCFExceptionDetail `xml:"ExceptionDetail"`
+	Standard        *SAPStandardFault   `xml:"standard"`
+	SystemError     *SAPSystemError     `xml:"SystemError"`
+	// the fault messages of SAP proxies wrap the standard detail in a service-specific element
+	Wrapped []struct {
+		Standard *SAPStandardFault `xml:"standard"`
+	} `xml:",any"`
+}
+
+// Classify decodes the detail of f into the type of the stack it comes from: *AxisFault, *JavaException,
+// *CXFFault, *WCFExceptionDetail, *SAPStandardFault or *SAPSystemError. It reports false if the fault has no
+// detail or none of the known shapes.
+func Classify(f *soap.Fault) (any, bool) {
+	if f == nil || strings.TrimSpace(f.Detail()) == "" {
+		return nil, false
+	}
+	var d detail
+	if err := xml.Unmarshal([]byte("<detail>"+f.Detail()+"</detail>"), &d); err != nil {
+		return nil, false
+	}
+	switch {
+	case d.ExceptionDetail != nil:
+		return d.ExceptionDetail.trim(), true
+	case d.Standard != nil:
+		return d.Standard, true
+	case d.wrappedStandard() != nil:
+		return d.wrappedStandard(), true
+	case d.SystemError != nil:
+		return d.SystemError, true
+	case d.ExceptionName != nil || d.Hostname != nil:
+		return &AxisFault{ExceptionName: value(d.ExceptionName), StackTrace: value(d.StackTrace), Hostname: value(d.Hostname)}, true
+	case d.StackTrace != nil:
+		return &CXFFault{StackTrace: value(d.StackTrace), ExceptionType: value(d.ExceptionType)}, true
+	case d.Exception != nil:
+		return &JavaException{Text: value(d.Exception)}, true
+	}
+	return nil, false
+}
+
+// wrappedStandard returns the SAP standard detail wrapped in a fault message element, nil if there is none.
+func (d *detail) wrappedStandard() *SAPStandardFault {
+	for _, w := range d.Wrapped {
+		if w.Standard != nil {
+			return w.Standard
+		}
+	}
+	return nil
+}
+
+// trim drops the empty inner exceptions, which WCF sends as nil elements.
+func (e *WCFExceptionDetail) trim() *WCFExceptionDetail {
+	if e.InnerException != nil && *e.InnerException.trim() == (WCFExceptionDetail{}) {
+		e.InnerException = nil
+	}
+	return e
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,89 @@
+package faults
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+// loadFault returns the fault of the envelope in testdata.
+func loadFault(t *testing.T, name string) *soap.Fault {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	require.NoError(t, err)
+	var fault *soap.Fault
+	require.ErrorAs(t, soap.UnmarshalResponse(data, &struct{}{}), &fault)
+	return fault
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		file  string
+		check func(t *testing.T, detail any)
+	}{
+		{file: "axis1.xml", check: func(t *testing.T, detail any) {
+			if d, ok := detail.(*AxisFault); assert.True(t, ok) {
+				assert.Equal(t, "java.lang.NullPointerException", d.ExceptionName)
+				assert.Equal(t, "app01.example.com", d.Hostname)
+				assert.Contains(t, d.StackTrace, "OrderService.createOrder")
+			}
+		}},
+		{file: "axis2.xml", check: func(t *testing.T, detail any) {
+			if d, ok := detail.(*JavaException); assert.True(t, ok) {
+				assert.True(t, strings.HasPrefix(d.Text, "org.apache.axis2.AxisFault: Invalid order id"))
+			}
+		}},
+		{file: "cxf.xml", check: func(t *testing.T, detail any) {
+			if d, ok := detail.(*CXFFault); assert.True(t, ok) {
+				assert.Equal(t, "com.example.orders.OrderNotFoundException", d.ExceptionType)
+				assert.Contains(t, d.StackTrace, "OrderServiceImpl.getOrder")
+			}
+		}},
+		{file: "wcf.xml", check: func(t *testing.T, detail any) {
+			if d, ok := detail.(*WCFExceptionDetail); assert.True(t, ok) {
+				assert.Equal(t, "System.NullReferenceException", d.Type)
+				assert.Equal(t, "Object reference not set to an instance of an object.", d.Message)
+				assert.Contains(t, d.StackTrace, "Object[]& outputs")
+				if assert.NotNil(t, d.InnerException) {
+					assert.Equal(t, "System.TimeoutException", d.InnerException.Type)
+					assert.Nil(t, d.InnerException.InnerException)
+				}
+			}
+		}},
+		{file: "sap_standard.xml", check: func(t *testing.T, detail any) {
+			if d, ok := detail.(*SAPStandardFault); assert.True(t, ok) {
+				assert.Equal(t, "Material 4711 does not exist", d.FaultText)
+				assert.Equal(t, []SAPLogData{
+					{Severity: "error", Text: "Material 4711 does not exist", ID: "M3(305)"},
+					{Severity: "info", Text: "Check the material number", ID: "M3(001)"},
+				}, d.FaultDetail)
+			}
+		}},
+		{file: "sap_systemerror.xml", check: func(t *testing.T, detail any) {
+			assert.Equal(t, &SAPSystemError{Context: "XIAdapter", Code: "ADAPTER.JAVA_EXCEPTION",
+				Text: "com.sap.aii.af.service.cpa.CPAObjectNotFoundException: Couldn't retrieve inbound binding"}, detail)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			detail, ok := Classify(loadFault(t, tt.file))
+			assert.True(t, ok)
+			tt.check(t, detail)
+		})
+	}
+}
+
+func TestClassifyUnknown(t *testing.T) {
+	_, ok := Classify(loadFault(t, "unknown.xml"))
+	assert.False(t, ok)
+	_, ok = Classify(&soap.Fault{Code: "soap:Server"})
+	assert.False(t, ok)
+	_, ok = Classify(nil)
+	assert.False(t, ok)
+}
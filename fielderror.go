@@ -0,0 +1,454 @@
+package soap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+// Implements element path tracking for decode errors.
+// The path tracker lexes the bytes the decoder consumes into the stack of open elements, so when decoding a
+// value fails the error can name the element it failed on without keeping the envelope. With
+// ContinueOnFieldErrors the envelope is buffered and decoded again with the failing elements left out, until the
+// remaining response decodes cleanly.
+
+// maxFieldErrors limits the number of decode passes with ContinueOnFieldErrors.
+const maxFieldErrors = 100
+
+// FieldError is a failure to decode the value of a single response element.
+type FieldError struct {
+	// Path is the element path, e.g. Envelope/Body/GetQuoteResponse/Quote[2]/Price.
+	Path string
+	// Value is the character data of the element, if any, cut after 4 KiB.
+	Value string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("decoding %s (value %q): %v", e.Path, e.Value, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// FieldErrors is returned with ContinueOnFieldErrors if some elements failed to decode.
+// All other elements of the response have been decoded.
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return fmt.Sprintf("%d response fields failed to decode: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e FieldErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fe := range e {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// ContinueOnFieldErrors keeps decoding the response if the value of an element cannot be decoded.
+// The failures are returned as FieldErrors while all other fields of the response are populated.
+// This requires buffering the complete response and the default decoder.
+func ContinueOnFieldErrors() Option {
+	return func(s *settings) error {
+		s.continueOnFieldErrors = true
+		return nil
+	}
+}
+
+type pathElem struct {
+	name  string
+	index int
+}
+
+// span is the byte range of an element in the serialized envelope.
+type span struct {
+	start, end int64
+}
+
+// locateFieldError finds the element the decoder stopped at when it failed with err after consuming offset bytes
+// of data. It returns nil if err is not an error decoding a value inside the body content.
+func locateFieldError(data []byte, offset int64, err error) (*FieldError, span) {
+	if !locatable(err) {
+		return nil, span{}
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []pathElem
+	var starts []int64
+	counts := []map[string]int{{}}
+	var text []byte
+	for {
+		tokenStart := d.InputOffset()
+		t, tokenErr := d.Token()
+		if tokenErr != nil {
+			return nil, span{}
+		}
+		switch elem := t.(type) {
+		case xml.StartElement:
+			level := counts[len(counts)-1]
+			level[elem.Name.Local]++
+			stack = append(stack, pathElem{name: elem.Name.Local, index: level[elem.Name.Local]})
+			starts = append(starts, tokenStart)
+			counts = append(counts, map[string]int{})
+			text = text[:0]
+			if d.InputOffset() >= offset {
+				// failed at the start element, e.g. on an attribute.
+				// Envelope/Body/Content is the shortest path of a field, a start element there is the content itself
+				if len(stack) <= 3 {
+					return nil, span{}
+				}
+				fe := &FieldError{Path: formatPath(stack), Err: err}
+				if skipErr := d.Skip(); skipErr != nil {
+					return nil, span{}
+				}
+				return fe, span{start: tokenStart, end: d.InputOffset()}
+			}
+		case xml.EndElement:
+			if d.InputOffset() >= offset {
+				if len(stack) < 3 {
+					return nil, span{}
+				}
+				fe := &FieldError{Path: formatPath(stack), Value: string(text), Err: err}
+				return fe, span{start: starts[len(starts)-1], end: d.InputOffset()}
+			}
+			stack = stack[:len(stack)-1]
+			starts = starts[:len(starts)-1]
+			counts = counts[:len(counts)-1]
+		case xml.CharData:
+			text = append(text, elem...)
+		}
+	}
+}
+
+// locatable reports whether err may be the failure to decode a value rather than of reading the XML.
+func locatable(err error) bool {
+	var syntaxErr *xml.SyntaxError
+	return !errors.As(err, &syntaxErr) && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) &&
+		!errors.Is(err, ErrEnvelopeMisconfigured)
+}
+
+func formatPath(path []pathElem) string {
+	var b strings.Builder
+	for i, e := range path {
+		if i > 0 {
+			b.WriteByte('/')
+		}
+		b.WriteString(e.name)
+		if e.index > 1 {
+			b.WriteString("[" + strconv.Itoa(e.index) + "]")
+		}
+	}
+	return b.String()
+}
+
+// pathDecoder annotates errors decoding a field with the element path, which it tracks from the bytes the
+// decoder reads, as the tokens of a plain decoder cannot be wrapped without breaking innerxml fields.
+type pathDecoder struct {
+	*xml.Decoder
+	path  *pathTracker
+	data  *bytes.Buffer
+	gzip  *gzipConfig
+	enums *enumConfig
+}
+
+// newPathDecoder returns the decoder of rd. If data is not nil, it is reset and keeps a copy of the bytes read.
+func newPathDecoder(rd io.Reader, data *bytes.Buffer) *pathDecoder {
+	if data != nil {
+		data.Reset()
+	}
+	path := &pathTracker{rd: rd, raw: data, levels: []int{0}}
+	path.dec = xml.NewDecoder(path)
+	return &pathDecoder{Decoder: path.dec, path: path, data: data}
+}
+
+func (d *pathDecoder) Decode(v any) error {
+	defer registerGzip(d.Decoder, d.gzip)()
+	defer registerEnums(d.Decoder, d.enums)()
+	if d.data != nil {
+		defer registerRawInput(d.Decoder, d.data)()
+	}
+	err := d.Decoder.Decode(v)
+	d.path.advance(d.InputOffset())
+	if err == nil || !locatable(err) {
+		return err
+	}
+	if fe := d.path.fieldError(err); fe != nil {
+		return fe
+	}
+	return err
+}
+
+// maxFieldValue limits the character data kept for the Value of a FieldError.
+const maxFieldValue = 4 << 10
+
+// pathTracker follows the element path of the bytes read by a decoder. Whenever the decoder reads more, the bytes
+// it consumed so far are lexed into the stack of open elements, so only the bytes read ahead are kept.
+type pathTracker struct {
+	rd  io.Reader
+	dec *xml.Decoder
+	// raw receives a copy of the bytes read if not nil
+	raw *bytes.Buffer
+	// pending are the bytes read but not lexed yet, starting at offset
+	pending []byte
+	offset  int64
+
+	stack []pathElem
+	// siblings holds the number of children by name of the open elements, those of stack[i-1] starting at
+	// levels[i]
+	siblings []pathElem
+	levels   []int
+	// names interns the element names
+	names map[string]string
+	// closed reports whether the innermost element on the stack has ended, it is removed with the next token
+	closed bool
+	// text is the character data following the last start element as read, up to maxFieldValue bytes
+	text []byte
+	// last is the kind of the last token lexed
+	last     tokenKind
+	elements int
+}
+
+func (t *pathTracker) Read(p []byte) (int, error) {
+	t.advance(t.dec.InputOffset())
+	n, err := t.rd.Read(p)
+	t.pending = append(t.pending, p[:n]...)
+	if t.raw != nil {
+		t.raw.Write(p[:n])
+	}
+	return n, err
+}
+
+// advance lexes the complete tokens of the bytes up to offset to.
+func (t *pathTracker) advance(to int64) {
+	data := t.pending[:min(to-t.offset, int64(len(t.pending)))]
+	n := 0
+	for n < len(data) {
+		m := t.token(data[n:])
+		if m == 0 {
+			break
+		}
+		n += m
+	}
+	t.pending = t.pending[:copy(t.pending, t.pending[n:])]
+	t.offset += int64(n)
+}
+
+// token lexes the token at the start of data and returns its length, 0 if data ends before the token.
+func (t *pathTracker) token(data []byte) int {
+	if data[0] != '<' {
+		n := bytes.IndexByte(data, '<')
+		if n < 0 {
+			n = len(data)
+		}
+		t.charData(data[:n])
+		return n
+	}
+	n := markupEnd(data, 0)
+	if n < 0 || len(data) < 2 {
+		return 0
+	}
+	switch data[1] {
+	case '/':
+		t.end()
+	case '?':
+		t.last = tokenOther
+	case '!':
+		if bytes.HasPrefix(data[1:], cdataStart) {
+			t.charData(data[:n])
+		} else {
+			t.last = tokenOther
+		}
+	default:
+		name := data[1:n]
+		if i := bytes.IndexAny(name, " \t\r\n/>"); i >= 0 {
+			name = name[:i]
+		}
+		if i := bytes.LastIndexByte(name, ':'); i >= 0 {
+			name = name[i+1:]
+		}
+		t.start(name, data[n-2] == '/')
+	}
+	return n
+}
+
+func (t *pathTracker) start(name []byte, selfClosing bool) {
+	t.pop()
+	local, ok := t.names[string(name)]
+	if !ok {
+		if t.names == nil {
+			t.names = map[string]string{}
+		}
+		local = string(name)
+		t.names[local] = local
+	}
+	index := 0
+	for i := t.levels[len(t.levels)-1]; i < len(t.siblings) && index == 0; i++ {
+		if t.siblings[i].name == local {
+			t.siblings[i].index++
+			index = t.siblings[i].index
+		}
+	}
+	if index == 0 {
+		index = 1
+		t.siblings = append(t.siblings, pathElem{name: local, index: 1})
+	}
+	t.stack = append(t.stack, pathElem{name: local, index: index})
+	t.levels = append(t.levels, len(t.siblings))
+	t.text = t.text[:0]
+	t.closed = selfClosing
+	t.last = tokenStart
+	t.elements++
+}
+
+func (t *pathTracker) end() {
+	t.pop()
+	t.closed = len(t.stack) > 0
+	t.last = tokenEnd
+}
+
+// pop removes the innermost element from the stack if it has ended.
+func (t *pathTracker) pop() {
+	if !t.closed {
+		return
+	}
+	top := len(t.levels) - 1
+	t.siblings = t.siblings[:t.levels[top]]
+	t.levels = t.levels[:top]
+	t.stack = t.stack[:len(t.stack)-1]
+	t.closed = false
+}
+
+func (t *pathTracker) charData(data []byte) {
+	t.text = append(t.text, data[:min(len(data), maxFieldValue-len(t.text))]...)
+	t.last = tokenOther
+}
+
+// fieldError returns the error decoding the element the decoder stopped at with err, nil if the decoder did not
+// stop at an element inside the body content.
+func (t *pathTracker) fieldError(err error) *FieldError {
+	switch {
+	case t.last == tokenStart && len(t.stack) > 3:
+		// failed at the start element, e.g. on an attribute.
+		// Envelope/Body/Content is the shortest path of a field, a start element there is the content itself
+		return &FieldError{Path: formatPath(t.stack), Err: err}
+	case t.last == tokenEnd && len(t.stack) >= 3:
+		return &FieldError{Path: formatPath(t.stack), Value: t.value(), Err: err}
+	}
+	return nil
+}
+
+// value returns the character data of the innermost element with its references and CDATA sections decoded.
+func (t *pathTracker) value() string {
+	d := xml.NewDecoder(io.MultiReader(strings.NewReader("<v>"), bytes.NewReader(t.text), strings.NewReader("</v>")))
+	d.Entity = t.dec.Entity
+	var b strings.Builder
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			if b.Len() == 0 && err != io.EOF {
+				// cut in a reference, report the data as read
+				return string(t.text)
+			}
+			return b.String()
+		}
+		if data, ok := tok.(xml.CharData); ok {
+			b.Write(data)
+		}
+	}
+}
+
+// decodeTolerant decodes the envelope from data, cutting out elements failing to decode until the rest
+// decodes cleanly.
+func (r *Response) decodeTolerant(data []byte, envelope *Envelope) error {
+	// removed holds the spans cut from data, in the order of their position
+	var removed []span
+	var errs FieldErrors
+	current := data
+	for {
+		dec := xml.NewDecoder(bytes.NewReader(current))
+		dec.Entity = r.settings.entities
+		unregister, unregisterEnums := registerGzip(dec, r.settings.gzip), registerEnums(dec, r.settings.enums)
+		unregisterRaw := registerRawInput(dec, bytes.NewBuffer(current))
+		err := dec.Decode(&envelope)
+		unregister()
+		unregisterEnums()
+		unregisterRaw()
+		if err == nil {
+			break
+		}
+		fe, failed := locateFieldError(data, originalOffset(removed, dec.InputOffset()), err)
+		if fe == nil || len(errs) >= maxFieldErrors {
+			return err
+		}
+		errs = append(errs, fe)
+		removed = insertSpan(removed, failed)
+		current = cutSpans(data, removed)
+
+		// start over from a clean response, a partially decoded one may contain duplicated slice elements
+		*envelope = *r.newEnvelope()
+		if v := reflect.ValueOf(r.body); v.Kind() == reflect.Ptr && !v.IsNil() {
+			v.Elem().Set(reflect.Zero(v.Elem().Type()))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// originalOffset maps offset in the data with the spans removed to the offset in the original data.
+func originalOffset(removed []span, offset int64) int64 {
+	for _, s := range removed {
+		if s.start < offset {
+			offset += s.end - s.start
+		}
+	}
+	return offset
+}
+
+func insertSpan(spans []span, s span) []span {
+	i := 0
+	for i < len(spans) && spans[i].start < s.start {
+		i++
+	}
+	return append(spans[:i], append([]span{s}, spans[i:]...)...)
+}
+
+// cutSpans returns a copy of data without the spans.
+func cutSpans(data []byte, spans []span) []byte {
+	out := make([]byte, 0, len(data))
+	var pos int64
+	for _, s := range spans {
+		out = append(out, data[pos:s.start]...)
+		pos = s.end
+	}
+	return append(out, data[pos:]...)
+}
+
+// countElements counts the start elements in the serialized XML data.
+func countElements(data []byte) int {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	n := 0
+	for {
+		t, err := d.RawToken()
+		if err != nil {
+			return n
+		}
+		if _, ok := t.(xml.StartElement); ok {
+			n++
+		}
+	}
+}
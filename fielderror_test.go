@@ -0,0 +1,143 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type quoteResponse struct {
+	XMLName xml.Name `xml:"urn:test GetQuoteResponse"`
+	Name    string   `xml:"Name"`
+	Quotes  []quote  `xml:"Quote"`
+	Total   int      `xml:"Total"`
+}
+
+type quote struct {
+	Price float64   `xml:"Price"`
+	Date  time.Time `xml:"Date"`
+}
+
+const quoteResponseBody = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+	`<GetQuoteResponse xmlns="urn:test"><Name>ACME</Name>` +
+	`<Quote><Price>1.5</Price><Date>2024-01-02T00:00:00Z</Date></Quote>` +
+	`<Quote><Price>2.5</Price><Date>yesterday</Date></Quote>` +
+	`<Quote><Price>many</Price><Date>2024-01-04T00:00:00Z</Date></Quote>` +
+	`<Total>3</Total></GetQuoteResponse></soap:Body></soap:Envelope>`
+
+func TestFieldErrorPath(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", quoteResponseBody)
+	client := NewClient(srv.URL)
+
+	err := client.Do(context.Background(), "GetQuote", &infoRequest{}, &quoteResponse{})
+	var fe *FieldError
+	assert.True(t, errors.As(err, &fe))
+	assert.Equal(t, "Envelope/Body/GetQuoteResponse/Quote[2]/Date", fe.Path)
+	assert.Equal(t, "yesterday", fe.Value)
+	var parseErr *time.ParseError
+	assert.True(t, errors.As(err, &parseErr))
+}
+
+func TestFieldErrorPathStreamed(t *testing.T) {
+	var b strings.Builder
+	b.WriteString(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<q:GetQuoteResponse xmlns:q="urn:test"><q:Name><![CDATA[AC<ME]]></q:Name>`)
+	for range 200 {
+		b.WriteString(`<q:Quote><!-- a > b --><q:Price>1.5</q:Price><q:Date>2024-01-02T00:00:00Z</q:Date></q:Quote>`)
+	}
+	b.WriteString(`<q:Quote note="x>y"><q:Price/><q:Date>to<![CDATA[mor]]>row &amp; later</q:Date></q:Quote>` +
+		`<q:Total>201</q:Total></q:GetQuoteResponse></soap:Body></soap:Envelope>`)
+	tests := []struct {
+		name string
+		rd   func(string) io.Reader
+	}{
+		{name: "buffered", rd: func(s string) io.Reader { return strings.NewReader(s) }},
+		{name: "one byte reads", rd: func(s string) io.Reader { return iotest.OneByteReader(strings.NewReader(s)) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := newPathDecoder(tt.rd(b.String()), nil)
+			err := dec.Decode(NewEnvelope(&quoteResponse{}))
+			var fe *FieldError
+			require.ErrorAs(t, err, &fe)
+			assert.Equal(t, "Envelope/Body/GetQuoteResponse/Quote[201]/Date", fe.Path)
+			assert.Equal(t, "tomorrow & later", fe.Value)
+			assert.Nil(t, dec.data, "the envelope is not kept")
+			assert.Less(t, len(dec.path.pending), 8<<10)
+		})
+	}
+}
+
+func TestContinueOnFieldErrors(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", quoteResponseBody)
+	client := NewClient(srv.URL)
+
+	resp := &quoteResponse{}
+	err := client.Do(context.Background(), "GetQuote", &infoRequest{}, resp, ContinueOnFieldErrors())
+	var errs FieldErrors
+	assert.True(t, errors.As(err, &errs))
+	if assert.Len(t, errs, 2) {
+		assert.Equal(t, "Envelope/Body/GetQuoteResponse/Quote[2]/Date", errs[0].Path)
+		assert.Equal(t, "Envelope/Body/GetQuoteResponse/Quote[3]/Price", errs[1].Path)
+		assert.Equal(t, "many", errs[1].Value)
+	}
+	var numErr *strconv.NumError
+	assert.True(t, errors.As(err, &numErr))
+
+	assert.Equal(t, "ACME", resp.Name)
+	assert.Equal(t, 3, resp.Total)
+	if assert.Len(t, resp.Quotes, 3) {
+		assert.Equal(t, 2.5, resp.Quotes[1].Price)
+		assert.True(t, resp.Quotes[1].Date.IsZero())
+		assert.Equal(t, 0.0, resp.Quotes[2].Price)
+		assert.Equal(t, 2024, resp.Quotes[2].Date.Year())
+	}
+}
+
+func TestContinueOnFieldErrorsClean(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", infoResponseBody)
+	client := NewClient(srv.URL)
+
+	resp := &infoResponse{}
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, resp, ContinueOnFieldErrors())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, resp.Items)
+}
+
+func TestSyntaxErrorNotFieldError(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><GetInfoResponse xmlns="urn:test"><Item>a</Ite`)
+	client := NewClient(srv.URL)
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, ContinueOnFieldErrors())
+	var fe *FieldError
+	assert.Error(t, err)
+	assert.False(t, errors.As(err, &fe))
+}
+
+func TestFaultDetailDecodeModes(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>`+
+		`<faultcode>soap:Server</faultcode><faultstring>failed</faultstring><detail><Reason>busy</Reason></detail></soap:Fault></soap:Body></soap:Envelope>`)
+	client := NewClient(srv.URL)
+
+	for name, opts := range map[string][]Option{
+		"default":      nil,
+		"info":         {WithResponseInfo(&ResponseInfo{})},
+		"field errors": {ContinueOnFieldErrors()},
+	} {
+		err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, opts...)
+		var fault *Fault
+		if assert.True(t, errors.As(err, &fault), name) {
+			assert.Equal(t, "<Reason>busy</Reason>", fault.DetailInternal.Content, name)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package soap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/m29h/xml"
+)
+
+// redactedValue replaces credentials in flight records.
+const redactedValue = "REDACTED"
+
+// credentialHeaders are the HTTP headers redacted in flight records.
+var credentialHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// credentialElements are the elements with secrets redacted in flight records, matched by local name.
+var credentialElements = map[string]bool{
+	"Password":            true,
+	"BinarySecurityToken": true,
+	"SignatureValue":      true,
+	"DigestValue":         true,
+	"X509Certificate":     true,
+	"Assertion":           true,
+}
+
+// FlightRecord is a snapshot of an attempt kept by WithFlightRecorder.
+type FlightRecord struct {
+	// Time is the start of the attempt.
+	Time     time.Time
+	Action   string
+	Endpoint string
+	Attempt  int
+	// Status is the HTTP status of the response, 0 if none was received.
+	Status   int
+	Request  FlightSnapshot
+	Response FlightSnapshot
+	// Err is the error message of the attempt, empty if it succeeded.
+	Err string
+}
+
+// FlightSnapshot holds the redacted HTTP headers and body of a request or response.
+type FlightSnapshot struct {
+	Header http.Header
+	Body   []byte
+	// Truncated is set if headers or body bytes were dropped to stay within the limit of the record.
+	Truncated bool
+}
+
+// FlightRecords are the records of a flight recorder, the oldest first.
+type FlightRecords []FlightRecord
+
+// WriteTo writes the records to w in a readable text form.
+func (r FlightRecords) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	for _, rec := range r {
+		fmt.Fprintf(&b, "=== %s %s attempt %d to %s\n", rec.Time.Format(time.RFC3339Nano), rec.Action, rec.Attempt, rec.Endpoint)
+		if rec.Status != 0 {
+			fmt.Fprintf(&b, "status: %d\n", rec.Status)
+		}
+		if rec.Err != "" {
+			fmt.Fprintf(&b, "error: %s\n", rec.Err)
+		}
+		rec.Request.write(&b, "request")
+		rec.Response.write(&b, "response")
+	}
+	return b.WriteTo(w)
+}
+
+func (s *FlightSnapshot) write(b *bytes.Buffer, name string) {
+	if s.Header == nil && s.Body == nil {
+		return
+	}
+	fmt.Fprintf(b, "--- %s\n", name)
+	keys := make([]string, 0, len(s.Header))
+	for k := range s.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, v := range s.Header[k] {
+			fmt.Fprintf(b, "%s: %s\n", k, v)
+		}
+	}
+	b.WriteByte('\n')
+	b.Write(s.Body)
+	if s.Truncated {
+		b.WriteString("\n[truncated]")
+	}
+	b.WriteByte('\n')
+}
+
+// WithFlightRecorder keeps redacted snapshots of the last n attempts in memory, to find out what went wrong
+// after the fact. See Client.FlightRecords. Each record keeps at most maxBytesPerEntry bytes of headers, bodies
+// and error message, half of them for the request and half for the error message and the response; the
+// rest is dropped. MTOM attachments sent as MIME parts are not recorded.
+//
+// Endpoint passwords are redacted like the ones logged with WithLogger, as are the credential headers
+// Authorization, Proxy-Authorization, Cookie and Set-Cookie and the content of the credential elements
+// Password, BinarySecurityToken, SignatureValue, DigestValue, X509Certificate and Assertion. Body bytes
+// following XML that cannot be parsed are dropped, as they may hide credentials.
+//
+// The records are kept by the client the option was set on with SetOptions. Setting the option again
+// discards the records.
+func WithFlightRecorder(n int, maxBytesPerEntry int) Option {
+	return func(s *settings) error {
+		if n <= 0 || maxBytesPerEntry <= 0 {
+			return fmt.Errorf("flight recorder of %d records of %d bytes", n, maxBytesPerEntry)
+		}
+		s.flightRecorder = &flightRecorder{records: make([]FlightRecord, 0, n), size: n, maxBytes: maxBytesPerEntry}
+		return nil
+	}
+}
+
+// FlightRecords returns the records of WithFlightRecorder, the oldest first. It returns nil if the option is
+// not set.
+func (c *Client) FlightRecords() FlightRecords {
+	if c.settings.flightRecorder == nil {
+		return nil
+	}
+	return c.settings.flightRecorder.snapshot()
+}
+
+// flightRecorder is a ring buffer of flight records.
+type flightRecorder struct {
+	mu       sync.Mutex
+	records  []FlightRecord
+	next     int
+	size     int
+	maxBytes int
+}
+
+func (f *flightRecorder) add(rec FlightRecord) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.records) < f.size {
+		f.records = append(f.records, rec)
+		return
+	}
+	f.records[f.next] = rec
+	f.next = (f.next + 1) % f.size
+}
+
+func (f *flightRecorder) snapshot() FlightRecords {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	records := make(FlightRecords, 0, len(f.records))
+	records = append(records, f.records[f.next:]...)
+	return append(records, f.records[:f.next]...)
+}
+
+// flight collects the record of the current attempt.
+type flight struct {
+	recorder *flightRecorder
+	record   FlightRecord
+	// requestBudget and responseBudget are the bytes left for the request and the response
+	requestBudget  int
+	responseBudget int
+	body           *captureWriter
+}
+
+// startFlight starts the record of the current attempt if a flight recorder is set.
+func (cl *call) startFlight() {
+	cl.flight = nil
+	f := cl.settings.flightRecorder
+	if f == nil {
+		return
+	}
+	cl.flight = &flight{
+		recorder: f,
+		record: FlightRecord{
+			Time:     cl.settings.timeSource().Now(),
+			Action:   cl.action,
+			Endpoint: redactURL(cl.url),
+			Attempt:  cl.attempt,
+		},
+		requestBudget:  f.maxBytes / 2,
+		responseBudget: f.maxBytes - f.maxBytes/2,
+	}
+}
+
+// request records the HTTP request and its envelope.
+func (f *flight) request(httpReq *http.Request, payload []byte) {
+	if f == nil {
+		return
+	}
+	f.record.Request = snapshot(httpReq.Header, payload, &f.requestBudget)
+}
+
+// response records the HTTP response, whose body is captured while it is read.
+func (f *flight) response(httpResp *http.Response) {
+	if f == nil {
+		return
+	}
+	f.record.Status = httpResp.StatusCode
+	f.record.Response.Header = redactHeader(httpResp.Header, &f.record.Response.Truncated, &f.responseBudget)
+	f.body = &captureWriter{limit: f.responseBudget}
+	body := httpResp.Body
+	httpResp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(body, f.body), body}
+}
+
+// end adds the record of the attempt that returned err.
+func (f *flight) end(err error) {
+	if f == nil {
+		return
+	}
+	if err != nil {
+		msg := err.Error()
+		if len(msg) > f.responseBudget {
+			msg = msg[:f.responseBudget]
+		}
+		f.record.Err = msg
+		f.responseBudget -= len(msg)
+	}
+	if f.body != nil {
+		body, complete := redactBody(f.body.buf, f.responseBudget)
+		f.record.Response.Body = body
+		f.record.Response.Truncated = f.record.Response.Truncated || f.body.dropped || !complete
+	}
+	f.recorder.add(f.record)
+}
+
+// snapshot returns the redacted header and body within budget, which is reduced by the bytes kept.
+func snapshot(header http.Header, body []byte, budget *int) FlightSnapshot {
+	var s FlightSnapshot
+	s.Header = redactHeader(header, &s.Truncated, budget)
+	keep := body
+	if len(keep) > *budget {
+		keep = keep[:*budget]
+	}
+	redacted, complete := redactBody(keep, *budget)
+	s.Body = redacted
+	s.Truncated = s.Truncated || len(keep) < len(body) || !complete
+	*budget -= len(redacted)
+	return s
+}
+
+// redactHeader returns a copy of header with the credentials redacted, dropping the values exceeding budget.
+func redactHeader(header http.Header, truncated *bool, budget *int) http.Header {
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make(http.Header, len(keys))
+	for _, k := range keys {
+		for _, v := range header[k] {
+			if credentialHeaders[http.CanonicalHeaderKey(k)] {
+				v = redactedValue
+			}
+			if len(k)+len(v) > *budget {
+				*truncated = true
+				continue
+			}
+			*budget -= len(k) + len(v)
+			out[k] = append(out[k], v)
+		}
+	}
+	return out
+}
+
+// redactBody returns a copy of the XML in data with the content of credential elements replaced, cut to limit
+// bytes. The bytes following a syntax error are dropped and complete is false. A document cut short is not a
+// syntax error.
+func redactBody(data []byte, limit int) (out []byte, complete bool) {
+	out = make([]byte, 0, min(len(data), limit))
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	var last, secret int64
+	depth := 0
+	for {
+		offset := d.InputOffset()
+		tok, err := d.RawToken()
+		if err != nil {
+			// a document cut short ends in an incomplete token, which is dropped
+			complete = err == io.EOF || d.InputOffset() >= int64(len(data))
+			switch {
+			case depth > 0:
+				out = append(out, data[last:secret]...)
+				out = append(out, redactedValue...)
+			case err == io.EOF:
+				out = append(out, data[last:]...)
+			default:
+				out = append(out, data[last:offset]...)
+			}
+			break
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if depth > 0 {
+				depth++
+			} else if credentialElements[tok.Name.Local] {
+				depth, secret = 1, d.InputOffset()
+			}
+		case xml.EndElement:
+			if depth == 0 {
+				break
+			}
+			// empty elements like <Password/> are kept
+			if depth--; depth == 0 && offset > secret {
+				out = append(out, data[last:secret]...)
+				out = append(out, redactedValue...)
+				last = offset
+			}
+		}
+	}
+	if len(out) > limit {
+		out, complete = out[:limit], false
+	}
+	return out, complete
+}
+
+// captureWriter keeps the first limit bytes written.
+type captureWriter struct {
+	buf     []byte
+	limit   int
+	dropped bool
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	n := min(len(p), w.limit-len(w.buf))
+	w.buf = append(w.buf, p[:n]...)
+	if n < len(p) {
+		w.dropped = true
+	}
+	return len(p), nil
+}
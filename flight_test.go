@@ -0,0 +1,151 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type loginRequest struct {
+	XMLName  xml.Name `xml:"urn:test Login"`
+	User     string   `xml:"User"`
+	Password string   `xml:"Password"`
+}
+
+// recordSize returns the bytes of headers, bodies and error message kept by rec.
+func recordSize(rec FlightRecord) int {
+	n := len(rec.Err) + len(rec.Request.Body) + len(rec.Response.Body)
+	for _, h := range []http.Header{rec.Request.Header, rec.Response.Header} {
+		for k, values := range h {
+			for _, v := range values {
+				n += len(k) + len(v)
+			}
+		}
+	}
+	return n
+}
+
+func TestFlightRecorder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Header().Set("Set-Cookie", "session=secret")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	defer srv.Close()
+	endpoint := strings.Replace(srv.URL, "http://", "http://user:hunter2@", 1)
+	client := NewClient(endpoint)
+	require.NoError(t, client.SetOptions(WithFlightRecorder(2, 4096)))
+	assert.Empty(t, client.FlightRecords())
+
+	for _, action := range []string{"First", "Second", "Third"} {
+		require.NoError(t, client.Do(context.Background(), action, &loginRequest{User: "u", Password: "hunter2"}, &infoResponse{}))
+	}
+	records := client.FlightRecords()
+	require.Len(t, records, 2)
+	assert.Equal(t, "Second", records[0].Action)
+	assert.Equal(t, "Third", records[1].Action)
+
+	rec := records[1]
+	assert.Equal(t, http.StatusOK, rec.Status)
+	assert.Equal(t, 1, rec.Attempt)
+	assert.Empty(t, rec.Err)
+	assert.NotContains(t, rec.Endpoint, "hunter2")
+	assert.Equal(t, []string{"Third"}, rec.Request.Header["Soapaction"])
+	assert.Contains(t, string(rec.Request.Body), ":User>u</_:User>")
+	assert.Contains(t, string(rec.Request.Body), ">REDACTED</")
+	assert.NotContains(t, string(rec.Request.Body), "hunter2")
+	assert.Equal(t, []string{"REDACTED"}, rec.Response.Header["Set-Cookie"])
+	assert.Equal(t, infoResponseBody, string(rec.Response.Body))
+	assert.False(t, rec.Request.Truncated)
+	assert.False(t, rec.Response.Truncated)
+
+	var out bytes.Buffer
+	_, err := records.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), "Second attempt 1 to http://user:xxxxx@")
+	assert.Contains(t, out.String(), "status: 200\n")
+	assert.Contains(t, out.String(), "Set-Cookie: REDACTED\n")
+	assert.NotContains(t, out.String(), "hunter2")
+}
+
+func TestFlightRecorderBounded(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+		`<soap:Fault><faultcode>soap:Server</faultcode><faultstring>`+strings.Repeat("boom ", 100)+`</faultstring>`+
+		`</soap:Fault></soap:Body></soap:Envelope>`)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithFlightRecorder(1, 300)))
+	err := client.Do(context.Background(), "Login", &loginRequest{User: strings.Repeat("u", 500), Password: "hunter2"}, &infoResponse{})
+	require.Error(t, err)
+
+	records := client.FlightRecords()
+	require.Len(t, records, 1)
+	rec := records[0]
+	assert.LessOrEqual(t, recordSize(rec), 300)
+	assert.True(t, rec.Request.Truncated)
+	assert.True(t, rec.Response.Truncated)
+	assert.Contains(t, rec.Err, "boom")
+	assert.NotContains(t, string(rec.Request.Body), "hunter2")
+}
+
+func TestFlightRecorderTransportError(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", infoResponseBody)
+	srv.Close()
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithFlightRecorder(1, 1024)))
+	require.Error(t, client.Do(context.Background(), "Info", &infoRequest{}, &infoResponse{}))
+
+	records := client.FlightRecords()
+	require.Len(t, records, 1)
+	assert.Zero(t, records[0].Status)
+	assert.NotEmpty(t, records[0].Err)
+	assert.NotEmpty(t, records[0].Request.Body)
+	assert.Nil(t, records[0].Response.Body)
+}
+
+func TestFlightRecorderInvalid(t *testing.T) {
+	assert.Error(t, NewClient("http://localhost").SetOptions(WithFlightRecorder(0, 100)))
+	assert.Error(t, NewClient("http://localhost").SetOptions(WithFlightRecorder(1, 0)))
+}
+
+func TestRedactBody(t *testing.T) {
+	var tests = []struct {
+		name     string
+		data     string
+		limit    int
+		want     string
+		complete bool
+	}{
+		{"plain", `<a><b>1</b></a>`, 100, `<a><b>1</b></a>`, true},
+		{"secret", `<a><w:Password t="x">s</w:Password></a>`, 100, `<a><w:Password t="x">REDACTED</w:Password></a>`, true},
+		{"nested", `<Assertion><x>s</x><y/></Assertion>`, 100, `<Assertion>REDACTED</Assertion>`, true},
+		{"empty", `<a><Password/></a>`, 100, `<a><Password/></a>`, true},
+		{"cut in secret", `<a><Password>sec`, 100, `<a><Password>REDACTED`, true},
+		{"cut in tag", `<a><b>1</b><Pass`, 100, `<a><b>1</b>`, true},
+		{"syntax error", `<a>1</a><<Password>s</Password>`, 100, `<a>1</a>`, false},
+		{"limit", `<a><Password>x</Password></a>`, 20, `<a><Password>REDACTE`, false},
+		{"text", `--boundary` + "\r\n" + `<a/>`, 100, `--boundary` + "\r\n" + `<a/>`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, complete := redactBody([]byte(tt.data), tt.limit)
+			assert.Equal(t, tt.want, string(got))
+			assert.Equal(t, tt.complete, complete)
+		})
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	header := http.Header{"Authorization": {"Basic secret"}, "Content-Type": {"text/xml"}, "X-Long": {strings.Repeat("x", 50)}}
+	budget, truncated := 60, false
+	got := redactHeader(header, &truncated, &budget)
+	assert.Equal(t, http.Header{"Authorization": {"REDACTED"}, "Content-Type": {"text/xml"}}, got)
+	assert.True(t, truncated)
+	assert.Equal(t, 60-len("AuthorizationREDACTEDContent-Typetext/xml"), budget)
+}
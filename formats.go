@@ -0,0 +1,657 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Implements the format struct tags of legacy services expecting values in fixed lexical forms, e.g. dates as
+// DD.MM.YYYY, amounts as zero-padded digits or booleans as J and N, so the structs keep plain Go types.
+// The formatted fields are encoded and decoded through shadow types with string fields in their place.
+
+var (
+	// ErrInvalidFormatTag is returned for a format tag with an unknown directive or one not applicable to the
+	// type of its field. The returned error is a *FormatTagError.
+	ErrInvalidFormatTag = errors.New("invalid format tag")
+	// ErrInvalidFormatValue is returned if a value does not fit the format of its field. The returned error is
+	// a *FormatValueError.
+	ErrInvalidFormatValue = errors.New("value does not match its format")
+)
+
+// FormatTagError reports an invalid soap format tag of a struct field.
+type FormatTagError struct {
+	// Type is the Go type of the struct and Field the name of the field.
+	Type  string
+	Field string
+	// Tag is the value of the soap tag, e.g. "format:date=02.01.2006".
+	Tag    string
+	Reason string
+}
+
+func (e *FormatTagError) Error() string {
+	return fmt.Sprintf("%s: field %s.%s: %q: %s", ErrInvalidFormatTag, e.Type, e.Field, e.Tag, e.Reason)
+}
+
+func (e *FormatTagError) Unwrap() error {
+	return ErrInvalidFormatTag
+}
+
+// FormatValueError reports a value not fitting the format of its field, when encoding a request or decoding
+// a response.
+type FormatValueError struct {
+	// Field is the struct field, e.g. "Order.Amount", and Tag its soap tag.
+	Field string
+	Tag   string
+	// Value is the value as received or formatted.
+	Value string
+	Err   error
+}
+
+func (e *FormatValueError) Error() string {
+	msg := fmt.Sprintf("%s: field %s: %q does not match %q", ErrInvalidFormatValue, e.Field, e.Value, e.Tag)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *FormatValueError) Unwrap() []error {
+	if e.Err == nil {
+		return []error{ErrInvalidFormatValue}
+	}
+	return []error{ErrInvalidFormatValue, e.Err}
+}
+
+// WithFormatTags applies the format tags of request and response struct fields, given as soap tag:
+//
+//	Date   time.Time `xml:"Date" soap:"format:date=02.01.2006"`
+//	Amount int64     `xml:"Amount" soap:"format:padint=15"`
+//	Active bool      `xml:"Active" soap:"format:bool=J/N"`
+//
+// The date directive formats a time.Time with the time.Format layout, padint an integer zero-padded to the
+// number of characters including the sign, and bool a bool as the true and the false form. Fields may also be
+// pointers to or slices of these types, empty elements decode to the zero value. The tags of the request and
+// response types are checked by ValidateFormats before a call is attempted. The content of types implementing
+// xml.Marshaler or xml.Unmarshaler and of interface fields is not formatted.
+func WithFormatTags() Option {
+	return func(s *settings) error {
+		s.formatTags = true
+		return nil
+	}
+}
+
+// ValidateFormats checks the format tags of the struct types reachable from the type of v, so invalid tags are
+// found before any value is coded. The error is a *FormatTagError.
+func ValidateFormats(v any) error {
+	if v == nil {
+		return nil
+	}
+	_, err := formatTypeOf(reflect.TypeOf(v))
+	return err
+}
+
+// formatDirective is a parsed format tag.
+type formatDirective struct {
+	tag    string
+	kind   string
+	layout string
+	width  int
+	yes    string
+	no     string
+}
+
+// parseFormat parses the soap tag of a field of type t.
+func parseFormat(tag string, t reflect.Type) (*formatDirective, string) {
+	spec, ok := strings.CutPrefix(tag, "format:")
+	if !ok {
+		return nil, "unknown directive"
+	}
+	kind, arg, _ := strings.Cut(spec, "=")
+	d := &formatDirective{tag: tag, kind: kind}
+	switch kind {
+	case "date":
+		if arg == "" {
+			return nil, "missing layout"
+		}
+		d.layout = arg
+	case "padint":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return nil, "width must be a positive number"
+		}
+		d.width = n
+	case "bool":
+		yes, no, ok := strings.Cut(arg, "/")
+		if !ok || yes == "" || no == "" || yes == no || strings.Contains(no, "/") {
+			return nil, "expected the true and the false form separated by /"
+		}
+		d.yes, d.no = yes, no
+	default:
+		return nil, "unknown directive " + kind
+	}
+	if !d.applies(formatElem(t)) {
+		return nil, "not applicable to " + t.String()
+	}
+	return d, ""
+}
+
+// formatElem returns the type formatted for a field of type t, a pointer to or a slice of it.
+func formatElem(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		return t.Elem()
+	}
+	return t
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (d *formatDirective) applies(t reflect.Type) bool {
+	switch d.kind {
+	case "date":
+		return t == timeType
+	case "padint":
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return true
+		}
+	case "bool":
+		return t.Kind() == reflect.Bool
+	}
+	return false
+}
+
+// format returns the text of v.
+func (d *formatDirective) format(v reflect.Value) (string, error) {
+	switch d.kind {
+	case "date":
+		return v.Interface().(time.Time).Format(d.layout), nil
+	case "padint":
+		var s string
+		if v.CanInt() {
+			s = fmt.Sprintf("%0*d", d.width, v.Int())
+		} else {
+			s = fmt.Sprintf("%0*d", d.width, v.Uint())
+		}
+		if len(s) > d.width {
+			return s, fmt.Errorf("longer than %d characters", d.width)
+		}
+		return s, nil
+	}
+	if v.Bool() {
+		return d.yes, nil
+	}
+	return d.no, nil
+}
+
+// parse sets v to the value of text, the zero value if text is empty.
+func (d *formatDirective) parse(text string, v reflect.Value) error {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch d.kind {
+	case "date":
+		t, err := time.Parse(d.layout, text)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+	case "padint":
+		if v.CanInt() {
+			n, err := strconv.ParseInt(text, 10, 64)
+			if err == nil && v.OverflowInt(n) {
+				err = strconv.ErrRange
+			}
+			if err != nil {
+				return err
+			}
+			v.SetInt(n)
+			return nil
+		}
+		n, err := strconv.ParseUint(text, 10, 64)
+		if err == nil && v.OverflowUint(n) {
+			err = strconv.ErrRange
+		}
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case "bool":
+		switch text {
+		case d.yes:
+			v.SetBool(true)
+		case d.no:
+			v.SetBool(false)
+		default:
+			return fmt.Errorf("expected %s or %s", d.yes, d.no)
+		}
+	}
+	return nil
+}
+
+// formatType is the shadow type of a type containing formatted fields, the type itself if it contains none.
+type formatType struct {
+	shadow reflect.Type
+	// fields maps the fields of a shadow struct to the fields of the original struct, fields of embedded
+	// structs are flattened into the shadow struct
+	fields []formatField
+}
+
+type formatField struct {
+	// index is the index of the original field
+	index []int
+	name  string
+	// format is the directive of a formatted field, whose shadow field is a string, *string or []string
+	format    *formatDirective
+	omitempty bool
+}
+
+// formatTypes caches the *formatType of all types built successfully.
+var formatTypes sync.Map
+
+// formatMu serializes building the shadow types.
+var formatMu sync.Mutex
+
+var stringType = reflect.TypeOf("")
+
+// formatTypeOf returns the shadow type of t.
+func formatTypeOf(t reflect.Type) (*formatType, error) {
+	if ft, ok := formatTypes.Load(t); ok {
+		return ft.(*formatType), nil
+	}
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	b := &formatBuilder{done: map[reflect.Type]*formatType{}, building: map[reflect.Type]bool{},
+		assumed: map[reflect.Type]bool{}}
+	ft, err := b.build(t)
+	if err != nil {
+		return nil, err
+	}
+	for t, ft := range b.done {
+		formatTypes.Store(t, ft)
+	}
+	return ft, nil
+}
+
+// formatBuilder builds the shadow types reachable from a type. Types referring to themselves are assumed to
+// contain no formatted fields while they are built, which fails if they turn out to contain some.
+type formatBuilder struct {
+	done     map[reflect.Type]*formatType
+	building map[reflect.Type]bool
+	assumed  map[reflect.Type]bool
+}
+
+func (b *formatBuilder) build(t reflect.Type) (*formatType, error) {
+	if ft, ok := formatTypes.Load(t); ok {
+		return ft.(*formatType), nil
+	}
+	if ft, ok := b.done[t]; ok {
+		return ft, nil
+	}
+	if b.building[t] {
+		b.assumed[t] = true
+		return &formatType{shadow: t}, nil
+	}
+	b.building[t] = true
+	defer delete(b.building, t)
+
+	ft := &formatType{shadow: t}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		elem, err := b.build(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case elem.shadow == t.Elem():
+		case t.Kind() == reflect.Ptr:
+			ft.shadow = reflect.PointerTo(elem.shadow)
+		case t.Kind() == reflect.Slice:
+			ft.shadow = reflect.SliceOf(elem.shadow)
+		default:
+			ft.shadow = reflect.ArrayOf(t.Len(), elem.shadow)
+		}
+	case reflect.Struct:
+		if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) ||
+			reflect.PointerTo(t).Implements(unmarshalerType) {
+			break
+		}
+		var err error
+		if ft, err = b.buildStruct(t); err != nil {
+			return nil, err
+		}
+	}
+	if ft.shadow != t && b.assumed[t] {
+		return nil, &FormatTagError{Type: t.String(), Reason: "recursive types are not supported"}
+	}
+	b.done[t] = ft
+	return ft, nil
+}
+
+// buildStruct builds the shadow type of the struct type t.
+func (b *formatBuilder) buildStruct(t reflect.Type) (*formatType, error) {
+	ft := &formatType{shadow: t}
+	var fields []reflect.StructField
+	depths := map[string]int{}
+	changed := false
+	// blocker is the reason t cannot be shadowed if it has formatted fields
+	blocker := ""
+	var add func(st reflect.Type, index []int) error
+	add = func(st reflect.Type, index []int) error {
+		for i := 0; i < st.NumField(); i++ {
+			f := st.Field(i)
+			idx := append(append([]int(nil), index...), i)
+			tag := f.Tag.Get("xml")
+			if tag == "-" {
+				continue
+			}
+			if f.Anonymous && tag == "" && formatElem(f.Type).Kind() == reflect.Struct {
+				if f.Type.Kind() == reflect.Struct {
+					if err := add(f.Type, idx); err != nil {
+						return err
+					}
+					continue
+				}
+				embedded, err := b.build(f.Type)
+				if err != nil {
+					return err
+				}
+				if embedded.shadow != f.Type {
+					return &FormatTagError{Type: t.String(), Field: f.Name,
+						Reason: "formatted fields of embedded pointers are not supported"}
+				}
+				if blocker == "" {
+					blocker = "embedded pointer " + f.Name + " cannot be copied"
+				}
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if depth, ok := depths[f.Name]; ok && depth <= len(index) {
+				continue
+			}
+			field := formatField{index: idx, name: f.Name}
+			shadowType := f.Type
+			if st, ok := f.Tag.Lookup("soap"); ok {
+				d, reason := parseFormat(st, f.Type)
+				if d == nil {
+					return &FormatTagError{Type: t.String(), Field: f.Name, Tag: st, Reason: reason}
+				}
+				field.format = d
+				_, flags, _ := strings.Cut(tag, ",")
+				field.omitempty = strings.Contains(flags, "omitempty")
+				switch f.Type.Kind() {
+				case reflect.Ptr:
+					shadowType = reflect.PointerTo(stringType)
+				case reflect.Slice:
+					shadowType = reflect.SliceOf(stringType)
+				default:
+					shadowType = stringType
+				}
+				changed = true
+			} else {
+				sub, err := b.build(f.Type)
+				if err != nil {
+					return err
+				}
+				shadowType = sub.shadow
+				changed = changed || shadowType != f.Type
+			}
+			sf := reflect.StructField{Name: f.Name, Type: shadowType, Tag: f.Tag}
+			if depth, ok := depths[f.Name]; ok && depth > len(index) {
+				// the field hides the one of an embedded struct
+				for j := range fields {
+					if fields[j].Name == f.Name {
+						fields[j], ft.fields[j] = sf, field
+					}
+				}
+				depths[f.Name] = len(index)
+				continue
+			}
+			depths[f.Name] = len(index)
+			fields = append(fields, sf)
+			ft.fields = append(ft.fields, field)
+		}
+		return nil
+	}
+	if err := add(t, nil); err != nil {
+		return nil, err
+	}
+	if !changed {
+		return &formatType{shadow: t}, nil
+	}
+	if blocker != "" {
+		return nil, &FormatTagError{Type: t.String(), Reason: blocker}
+	}
+	ft.shadow = reflect.StructOf(fields)
+	return ft, nil
+}
+
+// formatValue returns v converted to its shadow type, v itself if the type contains no formatted fields.
+func formatValue(v reflect.Value) (reflect.Value, error) {
+	ft, err := formatTypeOf(v.Type())
+	if err != nil || ft.shadow == v.Type() {
+		return v, err
+	}
+	out := reflect.New(ft.shadow).Elem()
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return out, nil
+		}
+		elem, err := formatValue(v.Elem())
+		if err != nil {
+			return out, err
+		}
+		out.Set(reflect.New(ft.shadow.Elem()))
+		out.Elem().Set(elem)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice {
+			if v.IsNil() {
+				return out, nil
+			}
+			out.Set(reflect.MakeSlice(ft.shadow, v.Len(), v.Len()))
+		}
+		for i := 0; i < v.Len(); i++ {
+			elem, err := formatValue(v.Index(i))
+			if err != nil {
+				return out, err
+			}
+			out.Index(i).Set(elem)
+		}
+	case reflect.Struct:
+		for i, f := range ft.fields {
+			src, dst := v.FieldByIndex(f.index), out.Field(i)
+			if f.format == nil {
+				elem, err := formatValue(src)
+				if err != nil {
+					return out, err
+				}
+				dst.Set(elem)
+				continue
+			}
+			if err := f.formatField(v.Type(), src, dst); err != nil {
+				return out, err
+			}
+		}
+	}
+	return out, nil
+}
+
+// formatField sets the shadow field dst to the text of the field src of the struct type t.
+func (f *formatField) formatField(t reflect.Type, src, dst reflect.Value) error {
+	text := func(v reflect.Value) (string, error) {
+		s, err := f.format.format(v)
+		if err != nil {
+			return "", &FormatValueError{Field: t.Name() + "." + f.name, Tag: f.format.tag, Value: s, Err: err}
+		}
+		return s, nil
+	}
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return nil
+		}
+		s, err := text(src.Elem())
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(&s))
+	case reflect.Slice:
+		if src.IsNil() {
+			return nil
+		}
+		texts := make([]string, src.Len())
+		for i := range texts {
+			s, err := text(src.Index(i))
+			if err != nil {
+				return err
+			}
+			texts[i] = s
+		}
+		dst.Set(reflect.ValueOf(texts))
+	default:
+		// keep omitting the zero values omitted without format, structs like time.Time are never omitted
+		if f.omitempty && src.Kind() != reflect.Struct && src.IsZero() {
+			return nil
+		}
+		s, err := text(src)
+		if err != nil {
+			return err
+		}
+		dst.SetString(s)
+	}
+	return nil
+}
+
+// unformatValue sets the settable value dst to the shadow value v converted back to the type of dst.
+func unformatValue(v, dst reflect.Value) error {
+	ft, err := formatTypeOf(dst.Type())
+	if err != nil {
+		return err
+	}
+	if ft.shadow == dst.Type() {
+		dst.Set(v)
+		return nil
+	}
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return unformatValue(v.Elem(), dst.Elem())
+	case reflect.Slice, reflect.Array:
+		if dst.Kind() == reflect.Slice {
+			if v.IsNil() {
+				dst.Set(reflect.Zero(dst.Type()))
+				return nil
+			}
+			dst.Set(reflect.MakeSlice(dst.Type(), v.Len(), v.Len()))
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := unformatValue(v.Index(i), dst.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		for i, f := range ft.fields {
+			target := dst.FieldByIndex(f.index)
+			if f.format == nil {
+				if err := unformatValue(v.Field(i), target); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := f.parseField(dst.Type(), v.Field(i), target); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseField sets the field dst of the struct type t to the value of the shadow field v.
+func (f *formatField) parseField(t reflect.Type, v, dst reflect.Value) error {
+	parse := func(text string, dst reflect.Value) error {
+		if err := f.format.parse(text, dst); err != nil {
+			return &FormatValueError{Field: t.Name() + "." + f.name, Tag: f.format.tag, Value: text, Err: err}
+		}
+		return nil
+	}
+	switch dst.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		elem := reflect.New(dst.Type().Elem())
+		if err := parse(v.Elem().String(), elem.Elem()); err != nil {
+			return err
+		}
+		dst.Set(elem)
+	case reflect.Slice:
+		if v.IsNil() {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		values := reflect.MakeSlice(dst.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := parse(v.Index(i).String(), values.Index(i)); err != nil {
+				return err
+			}
+		}
+		dst.Set(values)
+	default:
+		return parse(v.String(), dst)
+	}
+	return nil
+}
+
+// formatBody returns the request body v with the formatted fields converted, v itself if it has none.
+func formatBody(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	rv := reflect.ValueOf(v)
+	out, err := formatValue(rv)
+	if err != nil || out.Type() == rv.Type() {
+		return v, err
+	}
+	return out.Interface(), nil
+}
+
+// formatTarget returns the shadow value to decode the response body into, nil if the body has no formatted
+// fields or formats are not applied.
+func (r *Response) formatTarget() any {
+	v := reflect.ValueOf(r.body)
+	if !r.settings.formatTags || v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil
+	}
+	ft, err := formatTypeOf(v.Type())
+	if err != nil || ft.shadow == v.Type() {
+		return nil
+	}
+	shadow, err := formatValue(v)
+	if err != nil {
+		// the values the response was prefilled with do not fit, decode into an empty one
+		shadow = reflect.New(ft.shadow.Elem())
+	}
+	return shadow.Interface()
+}
+
+// unformat converts the decoded shadow value back into the response body.
+func (r *Response) unformat(shadow any) error {
+	return unformatValue(reflect.ValueOf(shadow).Elem(), reflect.ValueOf(r.body).Elem())
+}
@@ -0,0 +1,174 @@
+package soap
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type formatAudit struct {
+	Changed time.Time `xml:"Changed" soap:"format:date=02.01.2006 15:04"`
+}
+
+type formatLine struct {
+	Qty    uint16 `xml:"Qty" soap:"format:padint=4"`
+	Note   string `xml:"Note,omitempty"`
+	Rebate *bool  `xml:"Rebate,omitempty" soap:"format:bool=J/N"`
+}
+
+type formatBooking struct {
+	XMLName xml.Name `xml:"urn:host Booking"`
+	formatAudit
+	Date     time.Time    `xml:"Date" soap:"format:date=02.01.2006"`
+	Amount   int64        `xml:"Amount" soap:"format:padint=15"`
+	Fee      int64        `xml:"Fee,omitempty" soap:"format:padint=5"`
+	Active   bool         `xml:"Active" soap:"format:bool=J/N"`
+	Due      *time.Time   `xml:"Due,omitempty" soap:"format:date=20060102"`
+	Holidays []time.Time  `xml:"Holiday" soap:"format:date=0201"`
+	Lines    []formatLine `xml:"Line"`
+}
+
+type formatQuery struct {
+	XMLName xml.Name `xml:"urn:host Query"`
+	Active  bool     `xml:"Active" soap:"format:bool=Y/N"`
+}
+
+func TestFormatTagsRequest(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithFormatTags()))
+
+	rebate := true
+	req := &formatBooking{
+		formatAudit: formatAudit{Changed: time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC)},
+		Date:        time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC),
+		Amount:      -12345,
+		Active:      true,
+		Holidays:    []time.Time{time.Date(2026, 12, 25, 0, 0, 0, 0, time.UTC)},
+		Lines:       []formatLine{{Qty: 7, Rebate: &rebate}, {Qty: 12, Note: "n"}},
+	}
+	require.NoError(t, client.Do(context.Background(), "Book", req, &quirksResponse{}))
+	require.NoError(t, client.Do(context.Background(), "Book", &formatQuery{Active: true}, &quirksResponse{}))
+
+	require.Len(t, *captured, 2)
+	assert.Contains(t, (*captured)[0].body, `<_:Booking xmlns:_="urn:host"><_:Changed>14.10.2026 09:30</_:Changed>`+
+		`<_:Date>01.03.2026</_:Date><_:Amount>-00000000012345</_:Amount><_:Active>J</_:Active><_:Holiday>2512</_:Holiday>`+
+		`<_:Line><_:Qty>0007</_:Qty><_:Rebate>J</_:Rebate></_:Line><_:Line><_:Qty>0012</_:Qty><_:Note>n</_:Note></_:Line>`+
+		`</_:Booking>`)
+	assert.Contains(t, (*captured)[1].body, `<_:Query xmlns:_="urn:host"><_:Active>Y</_:Active></_:Query>`)
+	// the request itself is not changed
+	assert.Equal(t, int64(-12345), req.Amount)
+}
+
+func TestFormatTagsResponse(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+		`<Booking xmlns="urn:host"><Changed>14.10.2026 09:30</Changed><Date>01.03.2026</Date>`+
+		`<Amount>000000000012345</Amount><Fee></Fee><Active>N</Active><Due>20261231</Due>`+
+		`<Holiday>2512</Holiday><Holiday>0101</Holiday><Line><Qty>00007</Qty><Rebate>J</Rebate></Line></Booking>`+
+		`</soap:Body></soap:Envelope>`)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithFormatTags()))
+
+	resp := &formatBooking{Active: true, Fee: 3}
+	require.NoError(t, client.Do(context.Background(), "Book", &formatQuery{}, resp))
+	assert.Equal(t, time.Date(2026, 10, 14, 9, 30, 0, 0, time.UTC), resp.Changed)
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), resp.Date)
+	assert.Equal(t, int64(12345), resp.Amount)
+	assert.Zero(t, resp.Fee)
+	assert.False(t, resp.Active)
+	if assert.NotNil(t, resp.Due) {
+		assert.Equal(t, time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), *resp.Due)
+	}
+	assert.Len(t, resp.Holidays, 2)
+	if assert.Len(t, resp.Lines, 1) {
+		assert.Equal(t, uint16(7), resp.Lines[0].Qty)
+		assert.True(t, *resp.Lines[0].Rebate)
+	}
+}
+
+func TestFormatTagsInvalidValues(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+		`<Booking xmlns="urn:host"><Active>X</Active></Booking></soap:Body></soap:Envelope>`)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithFormatTags()))
+
+	err := client.Do(context.Background(), "Book", &formatQuery{}, &formatBooking{})
+	require.ErrorIs(t, err, ErrInvalidFormatValue)
+	var valueErr *FormatValueError
+	require.ErrorAs(t, err, &valueErr)
+	assert.Equal(t, "formatBooking.Active", valueErr.Field)
+	assert.Equal(t, "X", valueErr.Value)
+
+	err = client.Do(context.Background(), "Book", &formatBooking{Lines: []formatLine{{Qty: 12345}}}, &quirksResponse{})
+	require.ErrorAs(t, err, &valueErr)
+	assert.Equal(t, "formatLine.Qty", valueErr.Field)
+	assert.Equal(t, "12345", valueErr.Value)
+}
+
+func TestValidateFormats(t *testing.T) {
+	type node struct {
+		Date     time.Time `soap:"format:date=2006"`
+		Children []node
+	}
+	var tests = []struct {
+		name string
+		v    any
+		err  string
+	}{
+		{"valid", &formatBooking{}, ""},
+		{"no tags", &quirksResponse{}, ""},
+		{"unknown directive", &struct {
+			N int `soap:"format:decimal=2"`
+		}{}, "unknown directive decimal"},
+		{"not a format", &struct {
+			N int `soap:"padint=2"`
+		}{}, "unknown directive"},
+		{"width", &struct {
+			N int `soap:"format:padint=0"`
+		}{}, "width must be a positive number"},
+		{"bool forms", &struct {
+			B bool `soap:"format:bool=J"`
+		}{}, "separated by /"},
+		{"wrong type", &struct {
+			S string `soap:"format:date=02.01.2006"`
+		}{}, "not applicable to string"},
+		{"nested", &struct {
+			Lines []struct {
+				B *int `soap:"format:bool=J/N"`
+			}
+		}{}, "not applicable to *int"},
+		{"recursive", &node{}, "recursive types are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFormats(tt.v)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrInvalidFormatTag)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestFormatTagsValidatedBeforeCall(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithFormatTags()))
+
+	err := client.Do(context.Background(), "Book", &struct {
+		XMLName xml.Name `xml:"Book"`
+		N       int      `soap:"format:padint"`
+	}{}, &quirksResponse{})
+	var tagErr *FormatTagError
+	require.ErrorAs(t, err, &tagErr)
+	assert.Equal(t, "N", tagErr.Field)
+	assert.Equal(t, "format:padint", tagErr.Tag)
+	assert.Empty(t, *captured)
+}
@@ -0,0 +1,315 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/m29h/xml"
+)
+
+// Implements forwarding serialized envelopes, e.g. by a SOAP-aware proxy. Only the headers are added to the
+// envelope, the other bytes are sent as received, so signatures over the body stay valid.
+
+var (
+	// ErrUndeclaredPrefix is returned by ForwardEnvelope if an injected header uses a namespace prefix declared
+	// neither by the header nor by the envelope.
+	ErrUndeclaredPrefix = errors.New("undeclared namespace prefix")
+)
+
+// ForwardResult is the response to an envelope sent with Client.ForwardEnvelope.
+type ForwardResult struct {
+	StatusCode int
+	Header     http.Header
+	// Envelope is the response body as received.
+	Envelope []byte
+	// Fault is the fault in the body of the response, nil if it has none or the response is no envelope.
+	Fault *Fault
+}
+
+// ForwardEnvelope sends the serialized envelope with the headers built by inject added as its first headers,
+// and returns the response as received. The envelope is parsed only to find its Header element, which is
+// added if missing; all other bytes are sent unchanged. The builders are called with the Body element as
+// RawXML. Headers of a WSSEAuthInfo are signed once inserted, which adds a wsu:Id to the start tag of the body
+// if it has none.
+//
+// Namespace prefixes the injected headers declare for another namespace than the envelope binds them to in
+// the Header element are renamed within the injected headers; prefixes they use without declaring them must
+// be declared by the envelope. The SOAP version is the one of the envelope.
+//
+// A fault in the response is returned in ForwardResult.Fault, not as error, whatever the status code. Of the
+// client options only the transport, the URL variables, the action format and the action query apply.
+func (c *Client) ForwardEnvelope(ctx context.Context, action string, envelope []byte, inject ...HeaderBuilder) (*ForwardResult, error) {
+	endpoint, err := resolveURL(c.url, c.settings.urlVars)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.settings.checkAction(ctx, action, endpoint); err != nil {
+		return nil, err
+	}
+	layout, err := scanEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+	if layout.body == nil {
+		return nil, ErrEnvelopeMisconfigured
+	}
+	scope := layout.envelope.scope
+	if layout.header != nil {
+		scope = layout.header.scope
+	}
+	var headers []any
+	for _, h := range inject {
+		header, err := h(RawXML(envelope[layout.body.start:layout.body.end]))
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, header)
+	}
+	var injected bytes.Buffer
+	var signatures []*pendingSecurity
+	for _, header := range flattenHeaders(nil, headers) {
+		var data []byte
+		switch v := header.(type) {
+		case nil:
+			continue
+		case RawHeader:
+			data = v.XML
+		case *pendingSecurity:
+			v.inRequest = true
+			signatures = append(signatures, v)
+		}
+		if data == nil {
+			if data, err = xml.Marshal(header); err != nil {
+				return nil, err
+			}
+		}
+		if data, err = resolvePrefixes(data, scope); err != nil {
+			return nil, err
+		}
+		injected.Write(data)
+	}
+	payload := envelope
+	if injected.Len() > 0 {
+		payload = applyEdits(envelope, []edit{layout.insertHeaders(injected.String())})
+	}
+	for _, sig := range signatures {
+		if payload, err = ApplySecurity(payload, sig.config); err != nil {
+			return nil, err
+		}
+	}
+
+	httpReq, err := c.forwardRequest(endpoint, action, layout.envelope.name.Space == soap12EnvNS, payload)
+	if err != nil {
+		return nil, err
+	}
+	httpResp, err := c.roundTrip(ctx, httpReq, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &ForwardResult{
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header,
+		Envelope:   data,
+		Fault:      forwardedFault(data),
+	}, nil
+}
+
+// forwardRequest returns the HTTP request posting the envelope payload to endpoint, the resolved URL of the
+// client.
+func (c *Client) forwardRequest(endpoint, action string, soap12 bool, payload []byte) (*http.Request, error) {
+	action = c.settings.formatAction(action)
+	endpoint, err := c.settings.withActionQuery(endpoint, action)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	c.settings.overrideHost(httpReq)
+	if soap12 {
+		httpReq.Header.Add("Content-Type", mime.FormatMediaType("application/soap+xml", map[string]string{"charset": "utf-8", "action": action}))
+	} else {
+		httpReq.Header.Add("Content-Type", "text/xml; charset=\"utf-8\"")
+		httpReq.Header.Add("SOAPAction", action)
+	}
+	return httpReq, nil
+}
+
+// forwardedFault returns the fault in the body of the response envelope data, nil if there is none.
+func forwardedFault(data []byte) *Fault {
+	layout, err := scanEnvelope(data)
+	if err != nil || layout.body == nil {
+		return nil
+	}
+	envelope := NewEnvelope(&RawXML{})
+	if layout.envelope.name.Space == soap12EnvNS {
+		envelope.version = SOAP12
+	}
+	if err := xml.Unmarshal(data, envelope); err != nil {
+		return nil
+	}
+	if f := envelope.Body.Fault; f != nil && f.XMLName.Local != "" {
+		return f
+	}
+	return nil
+}
+
+// resolvePrefixes returns the serialized header with the prefixes it declares for another namespace than
+// scope binds them to renamed. It fails with ErrUndeclaredPrefix if the header uses a prefix declared neither
+// by itself nor by scope.
+func resolvePrefixes(header []byte, scope map[string]string) ([]byte, error) {
+	// the prefixes of the header, which the new ones must not collide with either
+	used := map[string]bool{}
+	d := xml.NewDecoder(bytes.NewReader(header))
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := tok.(xml.StartElement); ok {
+			used[t.Name.Space] = true
+			for _, a := range t.Attr {
+				used[a.Name.Space] = true
+				if a.Name.Space == "xmlns" {
+					used[a.Name.Local] = true
+				}
+			}
+		}
+	}
+
+	type level struct {
+		// declared holds the prefixes declared by the header in scope, renamed their new names
+		declared map[string]bool
+		renamed  map[string]string
+	}
+	var stack []level
+	var out bytes.Buffer
+	changed := false
+	d = xml.NewDecoder(bytes.NewReader(header))
+	for {
+		offset := int(d.InputOffset())
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		end := int(d.InputOffset())
+		switch t := tok.(type) {
+		case xml.StartElement:
+			cur := level{declared: map[string]bool{}, renamed: map[string]string{}}
+			if len(stack) > 0 {
+				for p := range stack[len(stack)-1].declared {
+					cur.declared[p] = true
+				}
+				for p, n := range stack[len(stack)-1].renamed {
+					cur.renamed[p] = n
+				}
+			}
+			for _, a := range t.Attr {
+				if a.Name.Space != "xmlns" {
+					continue
+				}
+				prefix := a.Name.Local
+				cur.declared[prefix] = true
+				delete(cur.renamed, prefix)
+				if ns := scope[prefix]; ns != "" && ns != a.Value {
+					name := freshPrefix(prefix, scope, used)
+					used[name] = true
+					cur.renamed[prefix] = name
+					changed = true
+				}
+			}
+			for _, prefix := range append([]string{t.Name.Space}, attrPrefixes(t.Attr)...) {
+				if prefix != "" && prefix != "xml" && !cur.declared[prefix] && scope[prefix] == "" {
+					return nil, fmt.Errorf("%w %s in header %s", ErrUndeclaredPrefix, prefix, t.Name.Local)
+				}
+			}
+			stack = append(stack, cur)
+			out.WriteByte('<')
+			out.WriteString(renamedName(t.Name, cur.renamed))
+			for _, a := range t.Attr {
+				name := a.Name
+				if name.Space == "xmlns" {
+					if n, ok := cur.renamed[name.Local]; ok {
+						name.Local = n
+					}
+				}
+				out.WriteString(" " + renamedName(name, cur.renamed) + `="`)
+				if err := xml.EscapeText(&out, []byte(a.Value)); err != nil {
+					return nil, err
+				}
+				out.WriteByte('"')
+			}
+			if end >= 2 && header[end-2] == '/' {
+				out.WriteString("/>")
+			} else {
+				out.WriteByte('>')
+			}
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, errors.New("unbalanced header element")
+			}
+			// the end of a self-closing element has no bytes of its own
+			if end > offset {
+				out.WriteString("</" + renamedName(t.Name, stack[len(stack)-1].renamed) + ">")
+			}
+			stack = stack[:len(stack)-1]
+		default:
+			out.Write(header[offset:end])
+		}
+	}
+	if !changed {
+		return header, nil
+	}
+	return out.Bytes(), nil
+}
+
+// attrPrefixes returns the prefixes of the attributes apart from namespace declarations.
+func attrPrefixes(attrs []xml.Attr) []string {
+	var prefixes []string
+	for _, a := range attrs {
+		if a.Name.Space != "xmlns" {
+			prefixes = append(prefixes, a.Name.Space)
+		}
+	}
+	return prefixes
+}
+
+// renamedName returns the name as written with its prefix renamed.
+func renamedName(name xml.Name, renamed map[string]string) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	prefix := name.Space
+	if n, ok := renamed[prefix]; ok && prefix != "xmlns" {
+		prefix = n
+	}
+	return prefix + ":" + name.Local
+}
+
+// freshPrefix returns prefix with the lowest number appended bound neither in scope nor used.
+func freshPrefix(prefix string, scope map[string]string, used map[string]bool) string {
+	for n := 1; ; n++ {
+		name := prefix + strconv.Itoa(n)
+		if scope[name] == "" && !used[name] {
+			return name
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package soap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type routeHeader struct {
+	XMLName xml.Name `xml:"urn:gateway Route"`
+	Hop     int      `xml:"hop,attr"`
+}
+
+func rawHeader(data string) HeaderBuilder {
+	return func(any) (any, error) { return RawHeader{XML: []byte(data)}, nil }
+}
+
+func TestForwardEnvelope(t *testing.T) {
+	const body = "<s:Body>\n  <o:Order xmlns:o='urn:orders' >&#65;<o:Item  n = '1'/><!-- keep --></o:Order>\n</s:Body>"
+	tests := []struct {
+		name     string
+		envelope string
+		inject   []HeaderBuilder
+		want     string
+	}{
+		{
+			name:     "header merged",
+			envelope: `<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Header><t:Trace xmlns:t="urn:test">t-1</t:Trace></s:Header>` + body + `</s:Envelope>`,
+			inject:   []HeaderBuilder{func(any) (any, error) { return routeHeader{Hop: 1}, nil }},
+			want: `<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Header><_:Route xmlns:_="urn:gateway" hop="1"></_:Route>` +
+				`<t:Trace xmlns:t="urn:test">t-1</t:Trace></s:Header>` + body + `</s:Envelope>`,
+		},
+		{
+			name:     "header added",
+			envelope: `<s:Envelope xmlns:s="` + soapEnvNS + `">` + body + `</s:Envelope>`,
+			inject:   []HeaderBuilder{rawHeader(`<g:Route xmlns:g="urn:gateway"/>`), func(any) (any, error) { return nil, nil }},
+			want:     `<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Header><g:Route xmlns:g="urn:gateway"/></s:Header>` + body + `</s:Envelope>`,
+		},
+		{
+			name:     "self-closing header",
+			envelope: `<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Header/>` + body + `</s:Envelope>`,
+			inject:   []HeaderBuilder{rawHeader(`<s:Route xmlns:g="urn:gateway" s:mustUnderstand="1"/>`)},
+			want: `<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Header><s:Route xmlns:g="urn:gateway" s:mustUnderstand="1"/></s:Header>` +
+				body + `</s:Envelope>`,
+		},
+		{
+			name: "prefix collision",
+			envelope: `<s:Envelope xmlns:s="` + soapEnvNS + `" xmlns:g="urn:orders" xmlns:g1="urn:other"><s:Header/>` +
+				body + `</s:Envelope>`,
+			inject: []HeaderBuilder{rawHeader(`<g:Route xmlns:g="urn:gateway" g:hop="1"><!-- next --><g:Next>a&amp;b</g:Next>` +
+				`<g:Back xmlns:g="urn:orders"/><s:Via/></g:Route>`)},
+			want: `<s:Envelope xmlns:s="` + soapEnvNS + `" xmlns:g="urn:orders" xmlns:g1="urn:other"><s:Header>` +
+				`<g2:Route xmlns:g2="urn:gateway" g2:hop="1"><!-- next --><g2:Next>a&amp;b</g2:Next><g:Back xmlns:g="urn:orders"/><s:Via/></g2:Route>` +
+				`</s:Header>` + body + `</s:Envelope>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, captured := newCaptureServer(t)
+			result, err := NewClient(srv.URL).ForwardEnvelope(context.Background(), "urn:PlaceOrder", []byte(tt.envelope), tt.inject...)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, result.StatusCode)
+			assert.Nil(t, result.Fault)
+			assert.Equal(t, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><Resp/></soap:Body></soap:Envelope>`,
+				string(result.Envelope))
+			require.Len(t, *captured, 1)
+			assert.Equal(t, tt.want, (*captured)[0].body)
+			assert.Equal(t, "urn:PlaceOrder", (*captured)[0].header.Get("SOAPAction"))
+		})
+	}
+}
+
+func TestForwardEnvelopeSigned(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	require.NoError(t, err)
+	const body = `<s:Body xmlns:u="` + wsuNS + `" u:Id="b-1"> <Order xmlns="urn:orders"/> </s:Body>`
+	envelope := `<s:Envelope xmlns:s="` + soap12EnvNS + `">` + body + `</s:Envelope>`
+	srv, captured := newCaptureServer(t)
+	_, err = NewClient(srv.URL).ForwardEnvelope(context.Background(), "urn:PlaceOrder", []byte(envelope), wsseInfo.Header())
+	require.NoError(t, err)
+	require.Len(t, *captured, 1)
+	sent := (*captured)[0]
+	assert.Contains(t, sent.body, `</s:Header>`+body+`</s:Envelope>`)
+	pair, err := tls.LoadX509KeyPair(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	require.NoError(t, err)
+	assert.NoError(t, VerifySignature([]byte(sent.body), VerifyOptions{Certificate: cert}))
+	assert.Equal(t, `application/soap+xml; action="urn:PlaceOrder"; charset=utf-8`, sent.header.Get("Content-Type"))
+}
+
+func TestForwardEnvelopeFault(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>`+
+			`<faultcode>soap:Server</faultcode><faultstring>failed</faultstring><detail><Reason>busy</Reason></detail>`+
+			`</soap:Fault></soap:Body></soap:Envelope>`)
+	}))
+	t.Cleanup(srv.Close)
+	envelope := `<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Body><Order xmlns="urn:orders"/></s:Body></s:Envelope>`
+	result, err := NewClient(srv.URL).ForwardEnvelope(context.Background(), "PlaceOrder", []byte(envelope))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, result.StatusCode)
+	require.NotNil(t, result.Fault)
+	assert.Equal(t, "failed", result.Fault.String)
+	assert.Equal(t, "<Reason>busy</Reason>", result.Fault.Detail())
+	assert.True(t, strings.HasPrefix(string(result.Envelope), "<soap:Envelope"))
+}
+
+func TestForwardEnvelopeErrors(t *testing.T) {
+	client := NewClient("http://localhost:0")
+	_, err := client.ForwardEnvelope(context.Background(), "PlaceOrder", []byte(`<Order xmlns="urn:orders"/>`))
+	assert.ErrorIs(t, err, ErrEnvelopeMisconfigured)
+	_, err = client.ForwardEnvelope(context.Background(), "PlaceOrder", []byte(`<s:Envelope xmlns:s="`+soapEnvNS+`"><s:Header/></s:Envelope>`))
+	assert.ErrorIs(t, err, ErrEnvelopeMisconfigured)
+
+	envelope := []byte(`<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Body/></s:Envelope>`)
+	_, err = client.ForwardEnvelope(context.Background(), "PlaceOrder", envelope, rawHeader(`<g:Route/>`))
+	assert.ErrorIs(t, err, ErrUndeclaredPrefix)
+	_, err = client.ForwardEnvelope(context.Background(), "PlaceOrder", envelope, rawHeader(`<Route xmlns="urn:gateway" g:hop="1"/>`))
+	assert.ErrorIs(t, err, ErrUndeclaredPrefix)
+}
+
+func TestForwardEnvelopeURLVars(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+
+	var endpoints []string
+	client := NewClient(srv.URL + "/services/{tenant}/Svc")
+	require.NoError(t, client.SetOptions(WithURLVars(map[string]string{"tenant": "acme"}),
+		WithActionPolicy(func(ctx context.Context, action, endpoint string) error {
+			endpoints = append(endpoints, endpoint)
+			return nil
+		})))
+	envelope := []byte(`<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Body/></s:Envelope>`)
+	_, err := client.ForwardEnvelope(context.Background(), "PlaceOrder", envelope)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/services/acme/Svc"}, paths)
+	assert.Equal(t, []string{srv.URL + "/services/acme/Svc"}, endpoints)
+
+	_, err = NewClient(srv.URL+"/services/{tenant}/Svc").ForwardEnvelope(context.Background(), "PlaceOrder", envelope)
+	assert.ErrorIs(t, err, ErrUnresolvedURLVars)
+}
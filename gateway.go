@@ -0,0 +1,136 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Implements the detection of HTML, JSON and plain text responses of proxies and gateways in front of the
+// service, which would otherwise surface as XML syntax errors.
+
+// sniffLen is the number of bytes inspected to tell XML from other content, they make up the body preview of
+// a GatewayError
+const sniffLen = 512
+
+var (
+	// ErrGatewayResponse is returned if the response body is not XML, e.g. the HTML error page of a proxy.
+	// The returned error is a *GatewayError.
+	ErrGatewayResponse = errors.New("response is not XML")
+)
+
+// GatewayError is returned if the response body is not XML at all, typically the error page of a proxy or
+// gateway. For an error status it wraps the *HTTPError of the response.
+type GatewayError struct {
+	StatusCode  int
+	ContentType string
+	// Body is the beginning of the response body, truncated to 512 bytes.
+	Body string
+	// HTTPError is the error for the status of the response, nil for a 2xx status.
+	HTTPError *HTTPError
+
+	// markup is set if the body is an HTML document
+	markup bool
+}
+
+func (e *GatewayError) Error() string {
+	return fmt.Sprintf("%s: status %d, content type %q: %q", ErrGatewayResponse, e.StatusCode, e.ContentType, e.Body)
+}
+
+// Is reports ErrGatewayResponse as matching, in addition to the wrapped HTTPError.
+func (e *GatewayError) Is(target error) bool {
+	return target == ErrGatewayResponse
+}
+
+func (e *GatewayError) Unwrap() error {
+	if e.HTTPError == nil {
+		return nil
+	}
+	return e.HTTPError
+}
+
+// sniffBody peeks at the beginning of the body r of the response of attempt, no bytes are consumed. It returns
+// a reader yielding all of r and, if the body does not look like XML, the *GatewayError to report. Multipart
+// bodies are not inspected.
+//
+// Bodies not starting with markup are reported right away. An HTML document may still be well-formed XML, its
+// error is only reported if decoding it fails for another reason than an unexpected body element.
+func sniffBody(r io.Reader, httpResp *http.Response, attempt int) (io.Reader, *GatewayError, error) {
+	if strings.HasPrefix(strings.ToLower(httpResp.Header.Get("Content-Type")), "multipart/") {
+		return r, nil, nil
+	}
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, err := peekHead(br, sniffLen, func(head []byte) bool {
+		return len(bytes.TrimLeft(bytes.TrimPrefix(head, bomUTF8), " \t\r\n")) >= len("<!doctype html")
+	})
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+	markup, ok := sniffXML(head)
+	if ok {
+		return br, nil, nil
+	}
+	gwErr := &GatewayError{
+		StatusCode:  httpResp.StatusCode,
+		ContentType: httpResp.Header.Get("Content-Type"),
+		Body:        strings.ToValidUTF8(string(head), ""),
+		markup:      markup,
+	}
+	if httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		gwErr.HTTPError = newHTTPError(httpResp, attempt, nil)
+	}
+	return br, gwErr, nil
+}
+
+// decodeError returns the error to report for the decoding of a body sniffed as gwErr that failed with err.
+// An HTML page with a 2xx status is reported as *WrongEndpointError.
+func (gwErr *GatewayError) decodeError(err error) error {
+	if gwErr == nil || err == nil {
+		return err
+	}
+	if gwErr.markup && gwErr.HTTPError == nil {
+		return &WrongEndpointError{Document: "HTML", Gateway: gwErr, err: err}
+	}
+	if errors.Is(err, ErrUnexpectedElement) {
+		return err
+	}
+	return gwErr
+}
+
+// peekHead returns the first n bytes of br, or fewer once enough reports that they suffice, so the head of a
+// short body not ending yet, e.g. of a server keeping the connection open, is not waited for.
+func peekHead(br *bufio.Reader, n int, enough func(head []byte) bool) ([]byte, error) {
+	size := 1
+	for {
+		if _, err := br.Peek(size); err != nil {
+			head, _ := br.Peek(br.Buffered())
+			return head, err
+		}
+		head, _ := br.Peek(min(n, br.Buffered()))
+		if len(head) >= n || enough(head) {
+			return head, nil
+		}
+		size = len(head) + 1
+	}
+}
+
+// sniffXML reports whether head, the beginning of a body, is an XML document, and whether it starts with
+// markup. Empty and whitespace-only heads are left to the XML decoder, as is everything starting with markup
+// other than an HTML document.
+func sniffXML(head []byte) (markup bool, ok bool) {
+	head = bytes.TrimPrefix(head, bomUTF8)
+	head = bytes.TrimLeft(head, " \t\r\n")
+	if len(head) == 0 || bytes.HasPrefix(head, bomUTF16BE) || bytes.HasPrefix(head, bomUTF16LE) {
+		return false, true
+	}
+	if head[0] != '<' {
+		return false, false
+	}
+	lower := bytes.ToLower(head[:min(len(head), len("<!doctype html"))])
+	html := bytes.HasPrefix(lower, []byte("<!doctype html")) || bytes.HasPrefix(lower, []byte("<html"))
+	return true, !html
+}
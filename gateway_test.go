@@ -0,0 +1,87 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGatewayError(t *testing.T) {
+	longComment := "<!--" + strings.Repeat("x", 2*sniffLen) + "-->\n"
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		body        string
+		preview     string
+		httpErr     bool
+	}{
+		{
+			name:        "html error page",
+			status:      http.StatusServiceUnavailable,
+			contentType: "text/html",
+			body:        "\n<!DOCTYPE html><html><body><h1>503 Service Unavailable</h1><br></body></html>",
+			preview:     "\n<!DOCTYPE html><html><body><h1>503 Service Unavailable</h1><br></body></html>",
+			httpErr:     true,
+		},
+		{
+			name:        "json",
+			status:      http.StatusBadGateway,
+			contentType: "application/json",
+			body:        `{"message": "upstream timed out"}`,
+			preview:     `{"message": "upstream timed out"}`,
+			httpErr:     true,
+		},
+		{
+			name:        "plain text labeled as xml",
+			status:      http.StatusOK,
+			contentType: "text/xml",
+			body:        "Access denied",
+			preview:     "Access denied",
+		},
+		{
+			name:        "truncated preview",
+			status:      http.StatusOK,
+			contentType: "text/plain",
+			// the preview ends within the last character
+			body:    "a" + strings.Repeat("ä", sniffLen),
+			preview: "a" + strings.Repeat("ä", sniffLen/2-1),
+		},
+		{name: "xml after long comment", status: http.StatusOK, contentType: "text/xml", body: `<?xml version="1.0"?>` + longComment + infoResponseBody[len(`<?xml version="1.0"?>`):]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			t.Cleanup(srv.Close)
+
+			resp := &infoResponse{}
+			err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, resp)
+			if tt.preview == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"a", "b"}, resp.Items)
+				return
+			}
+			var gwErr *GatewayError
+			if assert.ErrorAs(t, err, &gwErr) {
+				assert.ErrorIs(t, err, ErrGatewayResponse)
+				assert.Equal(t, tt.status, gwErr.StatusCode)
+				assert.Equal(t, tt.contentType, gwErr.ContentType)
+				assert.Equal(t, tt.preview, gwErr.Body)
+			}
+			var httpErr *HTTPError
+			assert.Equal(t, tt.httpErr, errors.As(err, &httpErr))
+			if tt.httpErr {
+				assert.Equal(t, tt.status, httpErr.StatusCode)
+			}
+		})
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/OmerBerkcanMee/gosoap
 
-go 1.21.4
+go 1.24
 
 require (
 	github.com/beevik/etree v1.4.0
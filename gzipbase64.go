@@ -0,0 +1,158 @@
+package soap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the convention of legacy services to send large string fields gzip-compressed and base64
+// encoded. The size limit of decompressed values protects against zip bombs in responses.
+
+// DefaultGzipMaxSize is the maximum size of a decompressed GzipBase64 value if none is configured.
+const DefaultGzipMaxSize = 16 << 20
+
+var (
+	// ErrInvalidGzipBase64 is returned if a GzipBase64 value is not valid base64 or not valid gzip data.
+	ErrInvalidGzipBase64 = errors.New("invalid gzip+base64 value")
+	// ErrDecompressedTooLarge is returned if a decompressed GzipBase64 value exceeds the maximum size.
+	ErrDecompressedTooLarge = errors.New("decompressed value exceeds the maximum size")
+)
+
+// GzipBase64 is binary content encoded as gzip-compressed, base64 encoded element content. Values without
+// the gzip header are decoded as plain base64, so values sent below the compression threshold are read as well.
+type GzipBase64 []byte
+
+// GzipBase64String is a GzipBase64 holding text.
+type GzipBase64String string
+
+// WithGzipBase64 configures GzipBase64 and GzipBase64String values. Values shorter than threshold bytes are
+// sent base64 encoded without compression, all values are compressed if 0. Decompressed values of responses
+// larger than maxSize bytes fail to decode, DefaultGzipMaxSize applies if maxSize is 0.
+func WithGzipBase64(threshold int, maxSize int64) Option {
+	return func(s *settings) error {
+		if maxSize <= 0 {
+			maxSize = DefaultGzipMaxSize
+		}
+		s.gzip = &gzipConfig{threshold: threshold, maxSize: maxSize}
+		return nil
+	}
+}
+
+type gzipConfig struct {
+	threshold int
+	maxSize   int64
+}
+
+var defaultGzipConfig = gzipConfig{maxSize: DefaultGzipMaxSize}
+
+// gzipConfigs maps the encoders and decoders of calls configured with WithGzipBase64 to their configuration,
+// as MarshalXML and UnmarshalXML only get to see the encoder or decoder.
+var gzipConfigs sync.Map
+
+// registerGzip makes the configuration apply to the values coded with coder until the returned function is called.
+func registerGzip(coder any, config *gzipConfig) func() {
+	if config == nil {
+		return func() {}
+	}
+	gzipConfigs.Store(coder, *config)
+	return func() { gzipConfigs.Delete(coder) }
+}
+
+func gzipConfigOf(coder any) gzipConfig {
+	if config, ok := gzipConfigs.Load(coder); ok {
+		return config.(gzipConfig)
+	}
+	return defaultGzipConfig
+}
+
+// MarshalXML writes the value compressed and base64 encoded.
+func (g GzipBase64) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	text, err := encodeGzipBase64(g, gzipConfigOf(e).threshold)
+	if err != nil {
+		return err
+	}
+	return e.EncodeElement(text, start)
+}
+
+// UnmarshalXML reads a base64 encoded value, decompressing it if gzip-compressed.
+func (g *GzipBase64) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	data, err := decodeGzipBase64(d, start)
+	if err != nil {
+		return err
+	}
+	*g = data
+	return nil
+}
+
+// MarshalXML writes the value compressed and base64 encoded.
+func (g GzipBase64String) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return GzipBase64(g).MarshalXML(e, start)
+}
+
+// UnmarshalXML reads a base64 encoded value, decompressing it if gzip-compressed.
+func (g *GzipBase64String) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	data, err := decodeGzipBase64(d, start)
+	if err != nil {
+		return err
+	}
+	*g = GzipBase64String(data)
+	return nil
+}
+
+func encodeGzipBase64(data []byte, threshold int) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	if len(data) < threshold {
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decodeGzipBase64 decodes the element start from d. Errors name the element.
+func decodeGzipBase64(d *xml.Decoder, start xml.StartElement) ([]byte, error) {
+	var text string
+	if err := d.DecodeElement(&text, &start); err != nil {
+		return nil, err
+	}
+	text = strings.Join(strings.Fields(text), "")
+	if text == "" {
+		return nil, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s: %v", ErrInvalidGzipBase64, start.Name.Local, err)
+	}
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s: %v", ErrInvalidGzipBase64, start.Name.Local, err)
+	}
+	maxSize := gzipConfigOf(d).maxSize
+	data, err = io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w in %s: %v", ErrInvalidGzipBase64, start.Name.Local, err)
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w of %d bytes in %s", ErrDecompressedTooLarge, maxSize, start.Name.Local)
+	}
+	return data, nil
+}
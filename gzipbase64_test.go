@@ -0,0 +1,97 @@
+package soap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type gzipDocument struct {
+	XMLName xml.Name         `xml:"urn:test Document"`
+	Content GzipBase64       `xml:"Content"`
+	Note    GzipBase64String `xml:"Note"`
+}
+
+// gzipBase64 returns data gzip-compressed and base64 encoded.
+func gzipBase64(t *testing.T, data []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	_, err := w.Write(data)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestGzipBase64Request(t *testing.T) {
+	note := strings.Repeat("long note ", 100)
+	req := NewRequest("Store", "", &gzipDocument{Content: GzipBase64("pdf"), Note: GzipBase64String(note)}, nil, nil)
+	var err error
+	req.settings, err = settings{}.apply(WithGzipBase64(10, 0))
+	assert.NoError(t, err)
+	data, err := req.serialize()
+	assert.NoError(t, err)
+
+	// the short content is below the threshold
+	assert.Contains(t, string(data), ">"+base64.StdEncoding.EncodeToString([]byte("pdf"))+"</")
+	assert.NotContains(t, string(data), base64.StdEncoding.EncodeToString([]byte(note)))
+
+	decoded := &gzipDocument{}
+	assert.NoError(t, UnmarshalResponse(data, decoded))
+	assert.Equal(t, GzipBase64("pdf"), decoded.Content)
+	assert.Equal(t, GzipBase64String(note), decoded.Note)
+}
+
+func TestGzipBase64Response(t *testing.T) {
+	large := gzipBase64(t, bytes.Repeat([]byte("a"), 4096))
+	compressed, _ := base64.StdEncoding.DecodeString(large)
+	truncated := base64.StdEncoding.EncodeToString(compressed[:len(compressed)-4])
+	tests := []struct {
+		name    string
+		content string
+		options []Option
+		want    GzipBase64
+		err     error
+	}{
+		{name: "compressed", content: gzipBase64(t, []byte("report")), want: GzipBase64("report")},
+		{name: "wrapped lines", content: "H4sIAAAAAAACAytK\n  LcgvKgEAhHcvxAYAAAA=", want: GzipBase64("report")},
+		{name: "uncompressed", content: base64.StdEncoding.EncodeToString([]byte("pdf")), want: GzipBase64("pdf")},
+		{name: "empty"},
+		{name: "invalid base64", content: "not base64!", err: ErrInvalidGzipBase64},
+		{name: "corrupt gzip", content: truncated, err: ErrInvalidGzipBase64},
+		{name: "within limit", content: large, options: []Option{WithGzipBase64(0, 4096)}, want: bytes.Repeat([]byte("a"), 4096)},
+		{name: "too large", content: large, options: []Option{WithGzipBase64(0, 4095)}, err: ErrDecompressedTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+				`<Document xmlns="urn:test"><Content>`+tt.content+`</Content></Document></soap:Body></soap:Envelope>`)
+			doc := &gzipDocument{}
+			err := NewClient(srv.URL).Do(context.Background(), "Load", &infoRequest{}, doc, tt.options...)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				var fe *FieldError
+				if assert.ErrorAs(t, err, &fe) {
+					assert.Equal(t, "Envelope/Body/Document/Content", fe.Path)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, doc.Content)
+		})
+	}
+}
+
+func TestGzipBase64ErrorNamesField(t *testing.T) {
+	doc := &gzipDocument{}
+	err := xml.Unmarshal([]byte(`<Document xmlns="urn:test"><Note>%%%</Note></Document>`), doc)
+	assert.ErrorIs(t, err, ErrInvalidGzipBase64)
+	assert.Contains(t, err.Error(), "in Note")
+}
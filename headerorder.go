@@ -0,0 +1,90 @@
+package soap
+
+import (
+	"bytes"
+	"slices"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the ordering of the top-level headers of requests. By default the headers are written in the
+// order they are built: the builders of the request, those of WithHeaderBuilder, then the WS-Addressing,
+// idempotency and correlation headers.
+
+// WithHeaderOrder writes the headers named names first, in the order of names, followed by the other headers
+// in the default order. An empty local name matches all headers of the namespace.
+func WithHeaderOrder(names ...xml.Name) Option {
+	rank := func(name xml.Name) int {
+		for i, n := range names {
+			if n.Space == name.Space && (n.Local == "" || n.Local == name.Local) {
+				return i
+			}
+		}
+		return len(names)
+	}
+	return WithHeaderComparator(func(a, b xml.Name) int {
+		return rank(a) - rank(b)
+	})
+}
+
+// WithHeaderComparator orders the headers by cmp, which returns a negative number if the header named a is
+// written before b and zero to keep their default order.
+func WithHeaderComparator(cmp func(a, b xml.Name) int) Option {
+	return func(s *settings) error {
+		s.headerOrder = cmp
+		return nil
+	}
+}
+
+// sortHeaders orders the headers by cmp.
+func (h *Header) sortHeaders(cmp func(a, b xml.Name) int) error {
+	type named struct {
+		name   xml.Name
+		header any
+	}
+	headers := flattenHeaders(nil, h.Headers)
+	list := make([]named, 0, len(headers))
+	for _, hdr := range headers {
+		name, err := headerName(hdr)
+		if err != nil {
+			return err
+		}
+		list = append(list, named{name: name, header: hdr})
+	}
+	slices.SortStableFunc(list, func(a, b named) int {
+		return cmp(a.name, b.name)
+	})
+	h.Headers = h.Headers[:0]
+	for _, n := range list {
+		h.Headers = append(h.Headers, n.header)
+	}
+	return nil
+}
+
+// headerName returns the name of the element of the header.
+func headerName(hdr any) (xml.Name, error) {
+	if _, ok := hdr.(*pendingSecurity); ok {
+		return securityName, nil
+	}
+	data, ok := hdr.(RawHeader)
+	if ok && data.XMLName.Local != "" {
+		return data.XMLName, nil
+	}
+	if !ok {
+		enc, err := xml.Marshal(hdr)
+		if err != nil {
+			return xml.Name{}, err
+		}
+		data.XML = enc
+	}
+	d := xml.NewDecoder(bytes.NewReader(data.XML))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return xml.Name{}, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name, nil
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package soap
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+)
+
+// headerOrder returns the local names of the top-level headers of the envelope.
+func headerOrder(t *testing.T, envelope []byte) []string {
+	t.Helper()
+	doc := etree.NewDocument()
+	assert.NoError(t, doc.ReadFromBytes(envelope))
+	var names []string
+	for _, h := range doc.FindElements("/Envelope/Header/*") {
+		names = append(names, h.Tag)
+	}
+	return names
+}
+
+func TestHeaderOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		want    []string
+	}{
+		{name: "default", want: []string{"Trace", "Security", "Route", "Hop"}},
+		{
+			name:    "explicit list",
+			options: []Option{WithHeaderOrder(xml.Name{Space: wsseNS, Local: "Security"}, xml.Name{Space: "urn:gateway"})},
+			want:    []string{"Security", "Route", "Hop", "Trace"},
+		},
+		{
+			name: "comparator",
+			options: []Option{WithHeaderComparator(func(a, b xml.Name) int {
+				return strings.Compare(a.Local, b.Local)
+			})},
+			want: []string{"Hop", "Route", "Security", "Trace"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := NewRequest("Order", "http://localhost", &infoRequest{}, nil, nil)
+			req.AddHeader(
+				func(any) (any, error) { return &signedTraceHeader{Value: "t-1"}, nil },
+				SecurityHeader(SecurityHeaderOptions{}, &idempotencyHeader{Value: "k"}),
+				func(any) (any, error) {
+					return []any{RawXML(`<g:Route xmlns:g="urn:gateway">r</g:Route>`), RawXML(`<g:Hop xmlns:g="urn:gateway">h</g:Hop>`)}, nil
+				},
+			)
+			var err error
+			req.settings, err = settings{}.apply(tt.options...)
+			assert.NoError(t, err)
+			data, err := req.serialize()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, headerOrder(t, data))
+		})
+	}
+}
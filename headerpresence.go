@@ -0,0 +1,47 @@
+package soap
+
+import (
+	"fmt"
+)
+
+// HeaderPresence is whether the envelopes of requests carry a Header element without headers.
+type HeaderPresence int
+
+const (
+	// HeaderAuto writes the Header element if headers were added to the envelope, as AddHeaders does. It is
+	// the default.
+	HeaderAuto HeaderPresence = iota
+	// HeaderAlways writes the Header element, empty if the request has no headers.
+	HeaderAlways
+	// HeaderNever leaves out the Header element if it has no headers, e.g. if the header builders only
+	// returned nil. Headers are written regardless.
+	HeaderNever
+)
+
+// WithHeaderPresence sets whether the envelopes of requests carry an empty Header element, for servers
+// rejecting it or requiring it. The form of the empty element is the one of WithEmptyElements.
+func WithHeaderPresence(presence HeaderPresence) Option {
+	return func(s *settings) error {
+		if presence < HeaderAuto || presence > HeaderNever {
+			return fmt.Errorf("invalid header presence %d", presence)
+		}
+		s.headerPresence = presence
+		return nil
+	}
+}
+
+// withHeaderPresence returns the envelope to encode for envelope, with or without Header as presence demands.
+// The envelope itself is left unchanged.
+func withHeaderPresence(envelope *Envelope, presence HeaderPresence) *Envelope {
+	switch {
+	case presence == HeaderAlways && envelope.Header == nil:
+		e := *envelope
+		e.Header = &Header{}
+		return &e
+	case presence == HeaderNever && envelope.Header != nil && len(flattenHeaders(nil, envelope.Header.Headers)) == 0:
+		e := *envelope
+		e.Header = nil
+		return &e
+	}
+	return envelope
+}
@@ -0,0 +1,55 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeaderPresence(t *testing.T) {
+	const (
+		envelope = `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">%s<soapenv:Body>` +
+			`<_:GetInfo xmlns:_="urn:test"></_:GetInfo></soapenv:Body></soapenv:Envelope>`
+		empty = `<soapenv:Header></soapenv:Header>`
+		route = `<soapenv:Header><_:Route xmlns:_="urn:gateway" hop="1"></_:Route></soapenv:Header>`
+	)
+	tests := []struct {
+		name     string
+		presence HeaderPresence
+		headers  []any
+		header   string
+	}{
+		{name: "auto without headers", presence: HeaderAuto},
+		{name: "auto with nil header", presence: HeaderAuto, headers: []any{nil}, header: empty},
+		{name: "auto with header", presence: HeaderAuto, headers: []any{routeHeader{Hop: 1}}, header: route},
+		{name: "always without headers", presence: HeaderAlways, header: empty},
+		{name: "always with nil header", presence: HeaderAlways, headers: []any{nil}, header: empty},
+		{name: "always with header", presence: HeaderAlways, headers: []any{routeHeader{Hop: 1}}, header: route},
+		{name: "never without headers", presence: HeaderNever},
+		{name: "never with nil header", presence: HeaderNever, headers: []any{nil}},
+		{name: "never with header", presence: HeaderNever, headers: []any{routeHeader{Hop: 1}}, header: route},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			_, err := WriteEnvelope(&buf, &infoRequest{}, tt.headers, WithHeaderPresence(tt.presence))
+			require.NoError(t, err)
+			assert.Equal(t, strings.Replace(envelope, "%s", tt.header, 1), buf.String())
+		})
+	}
+}
+
+func TestHeaderPresenceClient(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithHeaderPresence(HeaderAlways)))
+	require.NoError(t, client.Do(context.Background(), "Read", &quirksRequest{}, &quirksResponse{}))
+	require.Len(t, *captured, 1)
+	assert.Contains(t, string((*captured)[0].body), `<soapenv:Header></soapenv:Header>`)
+
+	assert.Error(t, client.SetOptions(WithHeaderPresence(HeaderNever+1)))
+}
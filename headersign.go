@@ -0,0 +1,95 @@
+package soap
+
+import (
+	"slices"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the options of the signing of the SOAP headers besides the body and the timestamp. The headers
+// are only known once the envelope is encoded, so the signing builder returns a placeholder which is completed
+// by ApplySecurity on the encoded envelope. Every signed header gets a wsu:Id, an id set by the caller or
+// another signer is kept.
+
+// SignatureLayout selects the position of the ds:Signature within the wsse:Security header.
+type SignatureLayout int
+
+const (
+	// SignatureFirst places the Signature before the token and the timestamp. This is the default.
+	SignatureFirst SignatureLayout = iota
+	// SignatureLast places the Signature after the token and the timestamp, as expected by validators
+	// processing the header in order.
+	SignatureLast
+)
+
+// SecurityElement identifies an element of the signed wsse:Security header, see SigningOptions.Order.
+type SecurityElement int
+
+const (
+	// SecuritySignature is the ds:Signature.
+	SecuritySignature SecurityElement = iota
+	// SecurityToken is the wsse:BinarySecurityToken, if included.
+	SecurityToken
+	// SecurityTimestamp is the wsu:Timestamp.
+	SecurityTimestamp
+)
+
+// SigningOptions configures the elements signed by a WSSEAuthInfo and the layout of its Security header.
+type SigningOptions struct {
+	// SignHeaders signs all headers of the envelope besides the Security headers, in addition to the body and
+	// the timestamp.
+	SignHeaders bool
+	// ExcludeHeaders are the headers not signed with SignHeaders, e.g. headers rewritten by a gateway.
+	// An empty local name matches all headers of the namespace.
+	ExcludeHeaders []xml.Name
+	// BinarySecurityToken includes the signing certificate as wsse:BinarySecurityToken referenced by the
+	// key info of the signature.
+	BinarySecurityToken bool
+	// TokenHeader places the BinarySecurityToken in a Security header of its own instead of the one of the
+	// signature. Its actor has to differ from the one of the signed header, see SetSecurityHeader.
+	TokenHeader *SecurityHeaderOptions
+	// Layout selects the position of the Signature within the Security header.
+	Layout SignatureLayout
+	// Order is the explicit order of the elements of the Security header, it takes precedence over Layout.
+	// Elements not listed follow in the order of Layout.
+	Order []SecurityElement
+	// TimestampPrecision is the precision of the times of the wsu:Timestamp, milliseconds by default.
+	TimestampPrecision TimestampPrecision
+}
+
+// order returns the order of the elements of the Security header.
+func (o SigningOptions) order() []SecurityElement {
+	order := []SecurityElement{SecuritySignature, SecurityToken, SecurityTimestamp}
+	if o.Layout == SignatureLast {
+		order = []SecurityElement{SecurityToken, SecurityTimestamp, SecuritySignature}
+	}
+	if len(o.Order) == 0 {
+		return order
+	}
+	explicit := make([]SecurityElement, 0, len(order))
+	for _, el := range append(o.Order[:len(o.Order):len(o.Order)], order...) {
+		if !slices.Contains(explicit, el) {
+			explicit = append(explicit, el)
+		}
+	}
+	return explicit
+}
+
+// SetSigning sets the elements signed and the layout of the signed wsse:Security header. By default only the
+// body and the timestamp are signed and the header carries no token.
+func (w *WSSEAuthInfo) SetSigning(opts SigningOptions) {
+	w.signing = opts
+}
+
+// excludes reports whether the header named name is excluded from signing.
+func (o SigningOptions) excludes(name xml.Name) bool {
+	if name.Space == wsseNS && name.Local == "Security" {
+		return true
+	}
+	for _, x := range o.ExcludeHeaders {
+		if x.Space == name.Space && (x.Local == "" || x.Local == name.Local) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,143 @@
+package soap
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+)
+
+type signedTraceHeader struct {
+	XMLName xml.Name `xml:"urn:test Trace"`
+	Value   string   `xml:",chardata"`
+}
+
+// securityLayout returns the local names of the children of the Security headers, keyed by their actor.
+func securityLayout(t *testing.T, envelope []byte) map[string][]string {
+	t.Helper()
+	doc := etree.NewDocument()
+	assert.NoError(t, doc.ReadFromBytes(envelope))
+	layout := map[string][]string{}
+	for _, sec := range doc.FindElements("//Security") {
+		actor := sec.SelectAttrValue("actor", "")
+		for _, child := range sec.ChildElements() {
+			layout[actor] = append(layout[actor], child.Tag)
+		}
+	}
+	return layout
+}
+
+func TestSignHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		signing SigningOptions
+		layout  map[string][]string
+		signed  []string
+	}{
+		{
+			name:    "body only",
+			signing: SigningOptions{},
+			layout:  map[string][]string{"": {"Signature", "Timestamp"}},
+		},
+		{
+			name:    "all headers",
+			signing: SigningOptions{SignHeaders: true, BinarySecurityToken: true},
+			layout:  map[string][]string{"": {"Signature", "BinarySecurityToken", "Timestamp"}},
+			signed:  []string{"Trace", "Route"},
+		},
+		{
+			name: "excluded header",
+			signing: SigningOptions{SignHeaders: true, BinarySecurityToken: true, Layout: SignatureLast,
+				ExcludeHeaders: []xml.Name{{Space: "urn:gateway", Local: "Route"}}},
+			layout: map[string][]string{"": {"BinarySecurityToken", "Timestamp", "Signature"}},
+			signed: []string{"Trace"},
+		},
+		{
+			name: "excluded namespace",
+			signing: SigningOptions{SignHeaders: true, ExcludeHeaders: []xml.Name{{Space: "urn:gateway"}},
+				Layout: SignatureLast},
+			layout: map[string][]string{"": {"Timestamp", "Signature"}},
+			signed: []string{"Trace"},
+		},
+		{
+			name: "separate token header",
+			signing: SigningOptions{SignHeaders: true, BinarySecurityToken: true,
+				TokenHeader: &SecurityHeaderOptions{Actor: "urn:token"}},
+			layout: map[string][]string{"urn:token": {"BinarySecurityToken"}, "": {"Signature", "Timestamp"}},
+			signed: []string{"Trace", "Route"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+			assert.NoError(t, err)
+			wsseInfo.SetSigning(tt.signing)
+
+			req := NewRequest("Sign", "http://localhost", &infoRequest{}, nil, nil)
+			req.AddHeader(wsseInfo.Header(), func(any) (any, error) { return &signedTraceHeader{Value: "t-1"}, nil })
+			req.settings, err = settings{}.apply(WithHeaderBuilder(func(ctx context.Context, body any) (any, error) {
+				return RawXML(`<Route xmlns="urn:gateway">backend-1</Route>`), nil
+			}))
+			assert.NoError(t, err)
+			data, err := req.serialize()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.layout, securityLayout(t, data))
+
+			doc := etree.NewDocument()
+			assert.NoError(t, doc.ReadFromBytes(data))
+			refs := map[string]bool{}
+			for _, ref := range doc.FindElements("//SignedInfo/Reference") {
+				refs[ref.SelectAttrValue("URI", "")] = true
+			}
+			assert.Len(t, refs, 2+len(tt.signed))
+			for _, name := range []string{"Trace", "Route"} {
+				el := doc.FindElement("//Header/" + name)
+				if !assert.NotNil(t, el, name) {
+					continue
+				}
+				id := el.SelectAttrValue("Id", "")
+				assert.Equal(t, slices.Contains(tt.signed, name), id != "" && refs["#"+id], name)
+			}
+
+			opts := VerifyOptions{}
+			if !tt.signing.BinarySecurityToken {
+				_, opts.Certificate = signedEnvelope(t, &infoRequest{})
+			}
+			assert.NoError(t, VerifySignature(data, opts))
+		})
+	}
+}
+
+func TestSignHeadersKeepsID(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	assert.NoError(t, err)
+	wsseInfo.SetSigning(SigningOptions{SignHeaders: true, BinarySecurityToken: true})
+
+	req := NewRequest("Sign", "http://localhost", &infoRequest{}, nil, nil)
+	req.AddHeader(wsseInfo.Header(), func(any) (any, error) {
+		return RawXML(`<t:Trace xmlns:t="urn:test" xmlns:u="` + wsuNS + `" u:Id="trace">t-1</t:Trace>`), nil
+	})
+	data, err := req.serialize()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `u:Id="trace"`)
+	assert.Contains(t, string(data), `URI="#trace"`)
+	assert.NoError(t, VerifySignature(data, VerifyOptions{}))
+
+	// the signed header is altered after signing
+	tampered := []byte(strings.Replace(string(data), "t-1", "t-2", 1))
+	assert.ErrorIs(t, VerifySignature(tampered, VerifyOptions{}), ErrInvalidSignature)
+}
+
+func TestHeaderSignatureOutsideRequest(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	assert.NoError(t, err)
+	wsseInfo.SetSigning(SigningOptions{SignHeaders: true})
+	header, err := wsseInfo.Header()(&infoRequest{})
+	assert.NoError(t, err)
+	_, err = xml.Marshal(header)
+	assert.ErrorIs(t, err, errUnsignedHeaders)
+}
@@ -0,0 +1,426 @@
+package soap
+
+import (
+	"bytes"
+	"maps"
+	"strconv"
+	"strings"
+)
+
+// Implements the hoisting of namespace declarations in the body of requests. The encoder declares the
+// namespace of an element or attribute on the element itself unless an ancestor element was written with it,
+// so the declarations are repeated on the siblings of large requests mixing namespaces. Hoisting declares
+// each namespace once on the body element and rewrites the names below it to the prefix declared there. The
+// tags not renamed are kept as they are.
+
+// WithPrefixHoisting declares each namespace of the requests once on the element of the body carrying the
+// request, instead of on every element using it. The envelope has the same meaning, but is smaller for
+// requests repeating namespaces differing from the one of the request element. Namespaces whose prefixes
+// could be referenced by attribute values or text, like the QNames of xsi:type, keep their declarations, as
+// do default namespaces. Hoisting applies to the body only and before the envelope is signed.
+func WithPrefixHoisting() Option {
+	return func(s *settings) error {
+		s.hoistPrefixes = true
+		return nil
+	}
+}
+
+// hoistTag is an element tag of a document scanned by hoistPrefixes.
+type hoistTag struct {
+	// start and end are the span of the tag in the document
+	start, end int
+	// closing is set for end tags, selfClosing for empty element tags
+	closing, selfClosing bool
+	name                 string
+	attrs                []hoistAttr
+}
+
+// hoistAttr is an attribute of a hoistTag, with its value as written.
+type hoistAttr struct {
+	name, value string
+	quote       byte
+}
+
+// declaration returns the prefix declared by the attribute, ok if it is a prefixed namespace declaration.
+func (a hoistAttr) declaration() (prefix string, ok bool) {
+	prefix, ok = strings.CutPrefix(a.name, "xmlns:")
+	return prefix, ok && prefix != "" && prefix != "xml" && prefix != "xmlns"
+}
+
+// String returns the tag as written by hoistPrefixes.
+func (t *hoistTag) String() string {
+	var sb strings.Builder
+	sb.WriteByte('<')
+	if t.closing {
+		sb.WriteByte('/')
+	}
+	sb.WriteString(t.name)
+	for _, a := range t.attrs {
+		sb.WriteByte(' ')
+		sb.WriteString(a.name)
+		sb.WriteByte('=')
+		sb.WriteByte(a.quote)
+		sb.WriteString(a.value)
+		sb.WriteByte(a.quote)
+	}
+	if t.selfClosing {
+		sb.WriteByte('/')
+	}
+	sb.WriteByte('>')
+	return sb.String()
+}
+
+// parseTag parses the element tag, ok is false if it is malformed.
+func parseTag(tag []byte, start int) (t hoistTag, ok bool) {
+	t.start, t.end = start, start+len(tag)
+	inner := tag[1 : len(tag)-1]
+	if len(inner) > 0 && inner[0] == '/' {
+		t.closing = true
+		t.name = string(bytes.TrimSpace(inner[1:]))
+		return t, t.name != ""
+	}
+	if rest, found := bytes.CutSuffix(inner, []byte("/")); found {
+		t.selfClosing, inner = true, rest
+	}
+	i := bytes.IndexAny(inner, " \t\r\n")
+	if i < 0 {
+		t.name = string(inner)
+		return t, t.name != ""
+	}
+	t.name = string(inner[:i])
+	rest := inner[i:]
+	for {
+		rest = bytes.TrimLeft(rest, " \t\r\n")
+		if len(rest) == 0 {
+			return t, t.name != ""
+		}
+		eq := bytes.IndexByte(rest, '=')
+		if eq <= 0 {
+			return t, false
+		}
+		name := string(bytes.TrimSpace(rest[:eq]))
+		rest = bytes.TrimLeft(rest[eq+1:], " \t\r\n")
+		if len(rest) == 0 || (rest[0] != '"' && rest[0] != '\'') {
+			return t, false
+		}
+		end := bytes.IndexByte(rest[1:], rest[0])
+		if end < 0 {
+			return t, false
+		}
+		t.attrs = append(t.attrs, hoistAttr{name: name, value: string(rest[1 : 1+end]), quote: rest[0]})
+		rest = rest[end+2:]
+	}
+}
+
+// scanTags returns the element tags of the document b, ok is false if it is malformed.
+func scanTags(b []byte) (tags []hoistTag, ok bool) {
+	for i := 0; i < len(b); {
+		if b[i] != '<' {
+			i++
+			continue
+		}
+		end := markupEnd(b, i)
+		if end < 0 {
+			return nil, false
+		}
+		if c := b[i+1]; c != '!' && c != '?' {
+			t, ok := parseTag(b[i:end], i)
+			if !ok {
+				return nil, false
+			}
+			tags = append(tags, t)
+		}
+		i = end
+	}
+	return tags, true
+}
+
+// hoistPrefixes rewrites the serialized envelope b with the namespace declarations of each body element
+// hoisted to it, see WithPrefixHoisting. Malformed documents are returned as they are.
+func hoistPrefixes(b []byte) []byte {
+	tags, ok := scanTags(b)
+	if !ok {
+		return b
+	}
+	// envelope holds the declarations of the envelope element, ancestors the ones in scope of the body elements
+	envelope, ancestors := map[string]string{}, map[string]string{}
+	var changed []*hoistTag
+	depth, inBody := 0, false
+	for i := 0; i < len(tags); i++ {
+		t := &tags[i]
+		switch {
+		case t.closing:
+			depth--
+			inBody = inBody && depth > 1
+			continue
+		case depth < 2:
+			if depth == 1 {
+				ancestors = maps.Clone(envelope)
+			}
+			for _, a := range t.attrs {
+				if prefix, ok := a.declaration(); ok {
+					envelope[prefix] = a.value
+					ancestors[prefix] = a.value
+				}
+			}
+			inBody = depth == 1 && localName(t.name) == "Body"
+		case inBody:
+			end := subtreeEnd(tags, i)
+			if end < 0 {
+				return b
+			}
+			changed = append(changed, hoistSubtree(b, tags[i:end+1], ancestors)...)
+			i = end
+			continue
+		}
+		if !t.selfClosing {
+			depth++
+		}
+	}
+	if len(changed) == 0 {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	pos := 0
+	for _, t := range changed {
+		out = append(out, b[pos:t.start]...)
+		out = append(out, t.String()...)
+		pos = t.end
+	}
+	return append(out, b[pos:]...)
+}
+
+// subtreeEnd returns the index of the end tag of the element tags[start], -1 if it is missing.
+func subtreeEnd(tags []hoistTag, start int) int {
+	depth := 0
+	for i := start; i < len(tags); i++ {
+		switch {
+		case tags[i].closing:
+			depth--
+		case !tags[i].selfClosing:
+			depth++
+		}
+		if depth == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// hoistSubtree hoists the namespace declarations of the elements tags, a body element with its content, to
+// the body element, and returns the tags changed in place. ancestors are the declarations in scope of the
+// body element.
+func hoistSubtree(b []byte, tags []hoistTag, ancestors map[string]string) []*hoistTag {
+	// the names are resolved with the declarations as written
+	type scope struct {
+		prefix, uri string
+	}
+	var scopes []scope
+	resolve := func(qname string) string {
+		prefix, _, ok := strings.Cut(qname, ":")
+		if !ok || prefix == "xml" {
+			return ""
+		}
+		for i := len(scopes) - 1; i >= 0; i-- {
+			if scopes[i].prefix == prefix {
+				return scopes[i].uri
+			}
+		}
+		return ancestors[prefix]
+	}
+	// bindings are the namespaces declared per prefix, prefixes the prefixes declared per namespace, in order
+	bindings := map[string]map[string]bool{}
+	prefixes := map[string][]string{}
+	var uris []string
+	// declared counts the declarations per namespace below the body element
+	declared := map[string]int{}
+	rootPrefix := map[string]string{}
+	referenced := map[string]bool{}
+	// used are the prefixes of the names, unbound the ones used without being declared
+	used, unbound := map[string]bool{}, map[string]bool{}
+	// names holds the namespaces of the name of each tag followed by the ones of its attributes
+	names := make([][]string, len(tags))
+	var open []int
+	for i := range tags {
+		t := &tags[i]
+		if i > 0 {
+			addReferences(referenced, b[tags[i-1].end:t.start])
+		}
+		if t.closing {
+			start := open[len(open)-1]
+			open = open[:len(open)-1]
+			names[i] = names[start][:1]
+			scopes = scopes[:len(scopes)-countDeclarations(&tags[start])]
+			continue
+		}
+		for _, a := range t.attrs {
+			prefix, ok := a.declaration()
+			if !ok {
+				addReferences(referenced, []byte(a.value))
+				continue
+			}
+			scopes = append(scopes, scope{prefix, a.value})
+			if bindings[prefix] == nil {
+				bindings[prefix] = map[string]bool{}
+			}
+			bindings[prefix][a.value] = true
+			if len(prefixes[a.value]) == 0 {
+				uris = append(uris, a.value)
+			}
+			prefixes[a.value] = append(prefixes[a.value], prefix)
+			if i == 0 {
+				if _, ok := rootPrefix[a.value]; !ok {
+					rootPrefix[a.value] = prefix
+				}
+			} else {
+				declared[a.value]++
+			}
+		}
+		resolveUsed := func(qname string) string {
+			uri := resolve(qname)
+			if prefix, _, ok := strings.Cut(qname, ":"); ok {
+				used[prefix] = true
+				unbound[prefix] = unbound[prefix] || uri == ""
+			}
+			return uri
+		}
+		names[i] = append(names[i], resolveUsed(t.name))
+		for _, a := range t.attrs {
+			if _, ok := a.declaration(); ok || a.name == "xmlns" || strings.HasPrefix(a.name, "xmlns:") {
+				names[i] = append(names[i], "")
+			} else {
+				names[i] = append(names[i], resolveUsed(a.name))
+			}
+		}
+		if t.selfClosing {
+			scopes = scopes[:len(scopes)-countDeclarations(t)]
+		} else {
+			open = append(open, i)
+		}
+	}
+
+	// hoisted is the prefix chosen per namespace hoisted
+	hoisted := map[string]string{}
+	chosen := map[string]bool{}
+	clean := func(prefix, uri string) bool {
+		if chosen[prefix] || unbound[prefix] || (ancestors[prefix] != "" && ancestors[prefix] != uri) {
+			return false
+		}
+		for bound := range bindings[prefix] {
+			if bound != uri {
+				return false
+			}
+		}
+		return true
+	}
+	for _, uri := range uris {
+		if uri == "" || declared[uri] == 0 || len(prefixes[uri]) < 2 {
+			continue
+		}
+		candidates := prefixes[uri]
+		if p, ok := rootPrefix[uri]; ok {
+			candidates = []string{p}
+		}
+		prefix := ""
+		for _, p := range candidates {
+			if clean(p, uri) {
+				prefix = p
+				break
+			}
+		}
+		if _, ok := rootPrefix[uri]; prefix == "" && !ok {
+			for n := 1; prefix == ""; n++ {
+				if p := "ns" + strconv.Itoa(n); bindings[p] == nil && !used[p] && ancestors[p] == "" && !chosen[p] {
+					prefix = p
+				}
+			}
+		}
+		if prefix == "" || referencedOtherThan(referenced, prefixes[uri], prefix) {
+			continue
+		}
+		hoisted[uri] = prefix
+		chosen[prefix] = true
+	}
+	if len(hoisted) == 0 {
+		return nil
+	}
+
+	rename := func(qname, uri string) string {
+		prefix, ok := hoisted[uri]
+		if !ok {
+			return qname
+		}
+		_, local, _ := strings.Cut(qname, ":")
+		return prefix + ":" + local
+	}
+	var changed []*hoistTag
+	for i := range tags {
+		t := &tags[i]
+		before := t.String()
+		t.name = rename(t.name, names[i][0])
+		if !t.closing {
+			attrs := t.attrs[:0]
+			for j, a := range t.attrs {
+				if prefix, ok := a.declaration(); ok {
+					if p, ok := hoisted[a.value]; ok && (i > 0 || p != prefix) {
+						continue
+					}
+				} else {
+					a.name = rename(a.name, names[i][j+1])
+				}
+				attrs = append(attrs, a)
+			}
+			t.attrs = attrs
+		}
+		if i == 0 {
+			for _, uri := range uris {
+				if p, ok := hoisted[uri]; ok && rootPrefix[uri] != p {
+					t.attrs = append(t.attrs, hoistAttr{name: "xmlns:" + p, value: uri, quote: '"'})
+				}
+			}
+		}
+		if t.String() != before {
+			changed = append(changed, t)
+		}
+	}
+	return changed
+}
+
+// countDeclarations returns the number of prefixed namespace declarations of the tag.
+func countDeclarations(t *hoistTag) int {
+	n := 0
+	for _, a := range t.attrs {
+		if _, ok := a.declaration(); ok {
+			n++
+		}
+	}
+	return n
+}
+
+// addReferences adds the prefixes of the words of text looking like QNames to referenced.
+func addReferences(referenced map[string]bool, text []byte) {
+	for _, word := range bytes.Fields(text) {
+		if i := bytes.IndexByte(word, ':'); i > 0 {
+			referenced[string(word[:i])] = true
+		}
+	}
+}
+
+// referencedOtherThan reports whether one of the prefixes other than prefix is referenced.
+func referencedOtherThan(referenced map[string]bool, prefixes []string, prefix string) bool {
+	for _, p := range prefixes {
+		if p != prefix && referenced[p] {
+			return true
+		}
+	}
+	return false
+}
+
+// localName returns the local part of the qualified name.
+func localName(qname string) string {
+	_, local, ok := strings.Cut(qname, ":")
+	if !ok {
+		return qname
+	}
+	return local
+}
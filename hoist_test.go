@@ -0,0 +1,174 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type hoistItem struct {
+	XMLName xml.Name `xml:"urn:test Item"`
+	Code    string   `xml:"urn:other Code,attr"`
+	Name    string   `xml:"urn:test Name"`
+	Ref     string   `xml:"urn:other Ref,omitempty"`
+}
+
+type hoistRequest struct {
+	XMLName xml.Name    `xml:"urn:test Put"`
+	Items   []hoistItem `xml:"Item"`
+	Plain   string      `xml:"urn:test Plain"`
+}
+
+// hoistEnvelopes are envelopes as written by the encoder, the first one holding the request of hoistedRequest.
+var hoistEnvelopes = []string{
+	`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><_:Put xmlns:_="urn:test">` +
+		`<_:Item xmlns:__1="urn:other" __1:Code="x"><_:Name>a</_:Name><__1:Ref>r</__1:Ref></_:Item>` +
+		`<_:Item xmlns:__2="urn:other" __2:Code="y"><_:Name>b</_:Name></_:Item><_:Plain>p</_:Plain></_:Put>` +
+		`</soap:Body></soap:Envelope>`,
+	`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><Put xmlns="urn:test">` +
+		`<a:Item xmlns:a="urn:other"/><b:Item xmlns:b="urn:other"><a:Item xmlns:a="urn:third"/></b:Item></Put>` +
+		`</soap:Body></soap:Envelope>`,
+	`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><Put xmlns="urn:test">` +
+		`<a:Item xmlns:a="urn:other"/><b:Item xmlns:b="urn:other" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ` +
+		`xsi:type="b:Kind"/><c:Item xmlns:c="urn:third"/><c:Item xmlns:c="urn:third"/></Put></soap:Body></soap:Envelope>`,
+}
+
+var hoistedRequest = &hoistRequest{
+	Items: []hoistItem{{Code: "x", Name: "a", Ref: "r"}, {Code: "y", Name: "b"}},
+	Plain: "p",
+}
+
+func TestHoistPrefixes(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{hoistEnvelopes[0], `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<_:Put xmlns:_="urn:test" xmlns:__1="urn:other"><_:Item __1:Code="x"><_:Name>a</_:Name><__1:Ref>r</__1:Ref>` +
+			`</_:Item><_:Item __1:Code="y"><_:Name>b</_:Name></_:Item><_:Plain>p</_:Plain></_:Put></soap:Body></soap:Envelope>`},
+		// the prefix a is bound to another namespace below, so b is used
+		{hoistEnvelopes[1], `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<Put xmlns="urn:test" xmlns:b="urn:other"><b:Item/><b:Item><a:Item xmlns:a="urn:third"/></b:Item></Put>` +
+			`</soap:Body></soap:Envelope>`},
+		// the prefix b is referenced by a QName, so urn:other keeps its declarations
+		{hoistEnvelopes[2], `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<Put xmlns="urn:test" xmlns:c="urn:third"><a:Item xmlns:a="urn:other"/><b:Item xmlns:b="urn:other" ` +
+			`xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="b:Kind"/><c:Item/><c:Item/></Put>` +
+			`</soap:Body></soap:Envelope>`},
+		// the prefix a is bound to another namespace by the envelope and b below, so a prefix is generated
+		{`<e:Envelope xmlns:e="urn:env" xmlns:a="urn:x"><e:Body><r><a:i xmlns:a="urn:y"/><b:i xmlns:b="urn:y">` +
+			`<b:j xmlns:b="urn:z"/></b:i></r></e:Body></e:Envelope>`,
+			`<e:Envelope xmlns:e="urn:env" xmlns:a="urn:x"><e:Body><r xmlns:ns1="urn:y"><ns1:i/><ns1:i>` +
+				`<b:j xmlns:b="urn:z"/></ns1:i></r></e:Body></e:Envelope>`},
+		// headers are not hoisted
+		{`<e:Envelope xmlns:e="urn:env"><e:Header><h><a:i xmlns:a="urn:y"/><a:i xmlns:a="urn:y"/></h></e:Header>` +
+			`<e:Body/></e:Envelope>`, ``},
+		{`<e:Envelope xmlns:e="urn:env"><e:Body><r><a:i xmlns:a="urn:y"></r></e:Body></e:Envelope>`, ``},
+	}
+	for i, tt := range tests {
+		want := tt.out
+		if want == "" {
+			want = tt.in
+		}
+		if res := string(hoistPrefixes([]byte(tt.in))); res != want {
+			t.Errorf("#%d: mismatch\nhave: `%s`\nwant: `%s`", i, res, want)
+		}
+	}
+}
+
+func TestPrefixHoisting(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.Do(context.Background(), "Put", hoistedRequest, &quirksResponse{}))
+	require.NoError(t, client.Do(context.Background(), "Put", hoistedRequest, &quirksResponse{}, WithPrefixHoisting()))
+
+	// the hoisted request decodes as the one not hoisted
+	require.Len(t, *captured, 2)
+	plain, hoisted := (*captured)[0].body, (*captured)[1].body
+	assert.Equal(t, 2, strings.Count(plain, `"urn:other"`))
+	assert.Equal(t, 1, strings.Count(hoisted, `"urn:other"`))
+	var want, got hoistRequest
+	require.NoError(t, UnmarshalResponse([]byte(plain), &want))
+	require.NoError(t, UnmarshalResponse([]byte(hoisted), &got))
+	assert.Equal(t, want, got)
+	assert.Equal(t, "r", got.Items[0].Ref)
+
+	// the envelope is signed after hoisting
+	cfg := securityConfig(t)
+	require.NoError(t, client.Do(context.Background(), "Put", hoistedRequest, &quirksResponse{}, WithPrefixHoisting(),
+		WithHeaderBuilder(func(context.Context, any) (any, error) { return &pendingSecurity{config: cfg}, nil })))
+	signed := (*captured)[2].body
+	assert.Equal(t, 1, strings.Count(signed, `"urn:other"`))
+	assert.NoError(t, VerifySignature([]byte(signed), VerifyOptions{CurrentTime: testSigningTime}))
+}
+
+// decodedEnvelope decodes the envelope with a new value of the type content points to and returns it re-encoded.
+func decodedEnvelope(t *testing.T, envelope []byte, content any) string {
+	t.Helper()
+	var fresh any
+	if content != nil {
+		fresh = reflect.New(reflect.TypeOf(content).Elem()).Interface()
+	}
+	val := NewEnvelope(fresh)
+	require.NoError(t, xml.NewDecoder(bytes.NewReader(envelope)).Decode(val))
+	out, err := xml.Marshal(val)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestPrefixHoistingEnvelopeCases(t *testing.T) {
+	// the envelopes the encode cases expect and the ones the decode cases decode decode as well hoisted
+	for i, tt := range envelopeEncodeTests {
+		want := decodedEnvelope(t, []byte(tt.res), tt.contentPtr)
+		assert.Equal(t, want, decodedEnvelope(t, hoistPrefixes([]byte(tt.res)), tt.contentPtr), "encode #%d", i)
+	}
+	for i, tt := range envelopeDecodeTests {
+		if tt.err != nil {
+			continue
+		}
+		want := decodedEnvelope(t, []byte(tt.in), tt.contentPtr)
+		assert.Equal(t, want, decodedEnvelope(t, hoistPrefixes([]byte(tt.in)), tt.contentPtr), "decode #%d", i)
+	}
+
+	// the requests of the encode cases sent hoisted decode as the ones sent as encoded
+	srv, captured := newCaptureServer(t)
+	for i, tt := range envelopeEncodeTests {
+		headers := make([]any, len(tt.headers))
+		for j := range tt.headers {
+			headers[j] = &tt.headers[j]
+		}
+		client := NewClient(srv.URL, func(any) (any, error) { return headers, nil })
+		require.NoError(t, client.Do(context.Background(), "Example", tt.contentPtr, &quirksResponse{}))
+		require.NoError(t, client.Do(context.Background(), "Example", tt.contentPtr, &quirksResponse{},
+			WithPrefixHoisting()))
+		plain, hoisted := (*captured)[2*i].body, (*captured)[2*i+1].body
+		assert.Equal(t, decodedEnvelope(t, []byte(plain), tt.contentPtr),
+			decodedEnvelope(t, []byte(hoisted), tt.contentPtr), "client #%d", i)
+	}
+}
+
+func FuzzPrefixHoisting(f *testing.F) {
+	for _, envelope := range hoistEnvelopes {
+		f.Add([]byte(envelope))
+	}
+	for _, tt := range envelopeEncodeTests {
+		f.Add([]byte(tt.res))
+	}
+	for _, tt := range envelopeDecodeTests {
+		f.Add([]byte(tt.in))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var want AnyElement
+		if UnmarshalResponse(data, &want) != nil {
+			return
+		}
+		var got AnyElement
+		require.NoError(t, UnmarshalResponse(hoistPrefixes(data), &got))
+		require.Equal(t, want, got)
+	})
+}
@@ -0,0 +1,67 @@
+package soap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// OutgoingRequest is the final form of a request attempt, after all header builders and signing ran.
+// The standard transport headers added by net/http (e.g. Content-Length, User-Agent) are not included.
+type OutgoingRequest struct {
+	Action  string
+	Attempt int
+	Method  string
+	URL     string
+	// Header holds a copy of the HTTP headers of the request.
+	Header http.Header
+	// Body holds the request body exactly as sent: the envelope, or the multipart message carrying it with its
+	// attachments, encoded by the codec of WithCodec. It must not be modified.
+	Body []byte
+	// Envelope holds the serialized and signed envelope. It must not be modified.
+	Envelope []byte
+}
+
+// SendHook is called for every attempt right before the request is sent. Returning an error
+// prevents the request from being sent and fails the call with that error.
+type SendHook func(ctx context.Context, req *OutgoingRequest) error
+
+// WithSendHook adds a hook called before each attempt goes on the wire, e.g. to archive signed envelopes.
+// Hooks are called in the order they were added.
+func WithSendHook(hook SendHook) Option {
+	return func(s *settings) error {
+		s.sendHooks = append(s.sendHooks[:len(s.sendHooks):len(s.sendHooks)], hook)
+		return nil
+	}
+}
+
+// WithRequestValidator checks the request of every call before anything is sent, e.g. for missing required
+// elements. An error returned by validate fails the call as is, without any attempt.
+func WithRequestValidator(validate func(action string, request any) error) Option {
+	return func(s *settings) error {
+		s.requestValidator = validate
+		return nil
+	}
+}
+
+// runSendHooks passes the attempt to all configured send hooks.
+func (cl *call) runSendHooks(ctx context.Context, req *Request, httpReq *http.Request) error {
+	if len(cl.settings.sendHooks) == 0 {
+		return nil
+	}
+	out := &OutgoingRequest{
+		Action:   cl.action,
+		Attempt:  cl.attempt,
+		Method:   httpReq.Method,
+		URL:      httpReq.URL.String(),
+		Header:   httpReq.Header.Clone(),
+		Body:     req.message,
+		Envelope: req.payload,
+	}
+	for _, hook := range cl.settings.sendHooks {
+		if err := hook(ctx, out); err != nil {
+			return fmt.Errorf("send hook: %w", err)
+		}
+	}
+	return nil
+}
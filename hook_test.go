@@ -0,0 +1,124 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type signedRequest struct {
+	infoRequest
+	WsuID string `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Id,attr"`
+}
+
+func TestSendHookSeesWireBytes(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.NoError(t, err)
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL, wsseInfo.Header())
+
+	var sent []*OutgoingRequest
+	assert.NoError(t, client.SetOptions(WithSendHook(func(ctx context.Context, req *OutgoingRequest) error {
+		sent = append(sent, req)
+		return nil
+	})))
+
+	err = client.Do(context.Background(), "GetInfo", &signedRequest{}, &quirksResponse{})
+	assert.NoError(t, err)
+	if assert.Len(t, sent, 1) {
+		assert.Equal(t, (*captured)[0].body, string(sent[0].Body))
+		assert.Contains(t, string(sent[0].Body), "SignatureValue")
+		assert.Equal(t, "GetInfo", sent[0].Header.Get("SOAPAction"))
+		assert.Equal(t, http.MethodPost, sent[0].Method)
+		assert.Equal(t, srv.URL, sent[0].URL)
+	}
+}
+
+func TestSendHookSeesMultipartBody(t *testing.T) {
+	var received []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+	client := NewClient(srv.URL)
+
+	var sent []*OutgoingRequest
+	hook := WithSendHook(func(ctx context.Context, req *OutgoingRequest) error {
+		sent = append(sent, req)
+		return nil
+	})
+	req := &upload{Large: Attachment{Data: bytes.Repeat([]byte{2}, 500)}}
+	require.NoError(t, client.Do(context.Background(), "Upload", req, &infoResponse{}, WithMTOM(), hook))
+	require.Len(t, sent, 1)
+	assert.Equal(t, received, sent[0].Body)
+	assert.True(t, strings.HasPrefix(sent[0].Header.Get("Content-Type"), "multipart/related"))
+	assert.True(t, bytes.Contains(sent[0].Body, bytes.Repeat([]byte{2}, 500)))
+	assert.True(t, bytes.HasPrefix(sent[0].Envelope, []byte("<")))
+	assert.True(t, bytes.Contains(sent[0].Body, sent[0].Envelope))
+}
+
+func TestSendHookPerAttempt(t *testing.T) {
+	srv, requests := newFlakyServer(t, 1, http.StatusServiceUnavailable)
+	client := NewClient(srv.URL)
+
+	var attempts []int
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+		WithRetry(fastRetry),
+		MarkIdempotent("GetInfo"),
+		WithSendHook(func(ctx context.Context, req *OutgoingRequest) error {
+			attempts = append(attempts, req.Attempt)
+			return nil
+		}))
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, attempts)
+	assert.Len(t, *requests, 2)
+}
+
+func TestSendHookVeto(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+
+	archiveFailed := errors.New("archive unavailable")
+	var second bool
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &quirksResponse{},
+		WithSendHook(func(ctx context.Context, req *OutgoingRequest) error {
+			return archiveFailed
+		}),
+		WithSendHook(func(ctx context.Context, req *OutgoingRequest) error {
+			second = true
+			return nil
+		}))
+	assert.ErrorIs(t, err, archiveFailed)
+	assert.False(t, second)
+	assert.Empty(t, *captured)
+}
+
+func TestRequestValidator(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+
+	invalid := errors.New("invalid request")
+	var validated []string
+	assert.NoError(t, client.SetOptions(WithRequestValidator(func(action string, request any) error {
+		validated = append(validated, action)
+		if _, ok := request.(*infoRequest); ok {
+			return invalid
+		}
+		return nil
+	})))
+	assert.ErrorIs(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &quirksResponse{}), invalid)
+	assert.Empty(t, *captured)
+	assert.NoError(t, client.Do(context.Background(), "Read", &quirksRequest{}, &quirksResponse{}))
+	assert.Len(t, *captured, 1)
+	assert.Equal(t, []string{"GetInfo", "Read"}, validated)
+}
@@ -0,0 +1,211 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	// ErrFieldHook is returned if a BeforeEncode or AfterDecode method of a request or response value failed.
+	// The returned error is a *FieldHookError.
+	ErrFieldHook = errors.New("field hook failed")
+)
+
+// BeforeEncoder is implemented by request types, or the types of their fields, transforming their values
+// before they are encoded, e.g. to encode a field the way the service expects it.
+type BeforeEncoder interface {
+	BeforeEncode(ctx context.Context) error
+}
+
+// AfterDecoder is implemented by response types, or the types of their fields, transforming their values
+// after they were decoded, e.g. to decode a field the service sends obfuscated.
+type AfterDecoder interface {
+	AfterDecode(ctx context.Context) error
+}
+
+// FieldHookError reports the failure of the BeforeEncode or AfterDecode method of a value.
+type FieldHookError struct {
+	// Hook is the name of the method, BeforeEncode or AfterDecode.
+	Hook string
+	// Path is the path of the value, starting with the name of the request or response type, e.g.
+	// "GetQuoteResponse.Quotes[2].Price" or "GetRatesResponse.Rates[EUR]".
+	Path string
+	Err  error
+}
+
+func (e *FieldHookError) Error() string {
+	return fmt.Sprintf("%s of %s: %v", e.Hook, e.Path, e.Err)
+}
+
+func (e *FieldHookError) Unwrap() []error {
+	return []error{ErrFieldHook, e.Err}
+}
+
+var (
+	beforeEncoderType = reflect.TypeOf((*BeforeEncoder)(nil)).Elem()
+	afterDecoderType  = reflect.TypeOf((*AfterDecoder)(nil)).Elem()
+)
+
+// beforeEncode calls the BeforeEncode methods of the request and its fields, see runFieldHooks. The request is
+// modified in place, so this is done once per call and not for every attempt.
+func beforeEncode(ctx context.Context, request any) error {
+	return runFieldHooks(request, beforeEncoderType, "BeforeEncode", func(h any) error {
+		return h.(BeforeEncoder).BeforeEncode(ctx)
+	})
+}
+
+// afterDecode calls the AfterDecode methods of the decoded response and its fields, see runFieldHooks.
+func afterDecode(ctx context.Context, response any) error {
+	return runFieldHooks(response, afterDecoderType, "AfterDecode", func(h any) error {
+		return h.(AfterDecoder).AfterDecode(ctx)
+	})
+}
+
+// runFieldHooks calls hook for every value of v implementing the hook interface, found by following the
+// pointers, interfaces, exported struct fields, slices, arrays and maps. The values are visited depth-first,
+// the fields of a value before the value itself, and the first error stops the walk. Methods with pointer
+// receivers are called on map values through a copy stored back into the map.
+func runFieldHooks(v any, iface reflect.Type, name string, hook func(any) error) error {
+	if v == nil || !hasHooks(reflect.TypeOf(v), iface) {
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	t := rv.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	w := hookWalker{iface: iface, name: name, hook: hook, visited: map[uintptr]bool{}}
+	return w.walk(rv, t.Name())
+}
+
+type hookWalker struct {
+	iface reflect.Type
+	name  string
+	hook  func(any) error
+	// visited holds the pointers followed, to visit shared values once and stop at cycles
+	visited map[uintptr]bool
+}
+
+func (w *hookWalker) walk(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || w.visited[v.Pointer()] {
+			return nil
+		}
+		w.visited[v.Pointer()] = true
+		return w.walk(v.Elem(), path)
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		elem := v.Elem()
+		if elem.Kind() != reflect.Ptr {
+			// the value held is not addressable, the hooks modify a copy stored back
+			copied := reflect.New(elem.Type()).Elem()
+			copied.Set(elem)
+			if err := w.walk(copied, path); err != nil {
+				return err
+			}
+			if v.CanSet() {
+				v.Set(copied)
+			}
+			return nil
+		}
+		return w.walk(elem, path)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if err := w.walk(v.Field(i), path+"."+v.Type().Field(i).Name); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if !hasHooks(v.Type().Elem(), w.iface) {
+			break
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := w.walk(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if !hasHooks(v.Type().Elem(), w.iface) {
+			break
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			elem := reflect.New(iter.Value().Type()).Elem()
+			elem.Set(iter.Value())
+			if err := w.walk(elem, fmt.Sprintf("%s[%v]", path, iter.Key())); err != nil {
+				return err
+			}
+			if iter.Value().Kind() != reflect.Ptr {
+				v.SetMapIndex(iter.Key(), elem)
+			}
+		}
+	}
+	return w.call(v, path)
+}
+
+// call calls the hook of v, addressed if its method has a pointer receiver.
+func (w *hookWalker) call(v reflect.Value, path string) error {
+	var h any
+	switch {
+	case v.Kind() != reflect.Ptr && v.CanAddr() && v.Addr().Type().Implements(w.iface):
+		h = v.Addr().Interface()
+	case v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface && v.Type().Implements(w.iface) && v.CanInterface():
+		h = v.Interface()
+	default:
+		return nil
+	}
+	if err := w.hook(h); err != nil {
+		return &FieldHookError{Hook: w.name, Path: path, Err: err}
+	}
+	return nil
+}
+
+type hookKey struct {
+	t, iface reflect.Type
+}
+
+// hookTypes caches the results of hasHooks
+var hookTypes sync.Map
+
+// hasHooks reports whether values of t may hold values implementing iface. Interfaces may hold anything.
+func hasHooks(t reflect.Type, iface reflect.Type) bool {
+	key := hookKey{t, iface}
+	if has, ok := hookTypes.Load(key); ok {
+		return has.(bool)
+	}
+	has := typeHasHooks(t, iface, map[reflect.Type]bool{})
+	hookTypes.Store(key, has)
+	return has
+}
+
+func typeHasHooks(t reflect.Type, iface reflect.Type, seen map[reflect.Type]bool) bool {
+	if t.Implements(iface) || reflect.PointerTo(t).Implements(iface) {
+		return true
+	}
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return typeHasHooks(t.Elem(), iface, seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() && typeHasHooks(t.Field(i).Type, iface, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
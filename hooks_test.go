@@ -0,0 +1,147 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errObfuscated = errors.New("not obfuscated")
+
+// reversed is a string the service sends reversed, with a trailing ~.
+type reversed string
+
+func (r *reversed) AfterDecode(context.Context) error {
+	s, ok := strings.CutSuffix(string(*r), "~")
+	if !ok {
+		return errObfuscated
+	}
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	*r = reversed(runes)
+	return nil
+}
+
+func (r *reversed) BeforeEncode(ctx context.Context) error {
+	runes := []rune(string(*r))
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	*r = reversed(string(runes) + "~")
+	return nil
+}
+
+type secretItem struct {
+	Value reversed `xml:"Value"`
+}
+
+type secretsResponse struct {
+	XMLName xml.Name     `xml:"urn:test GetSecretsResponse"`
+	Secret  reversed     `xml:"Secret"`
+	Extra   *reversed    `xml:"Extra"`
+	Items   []secretItem `xml:"Item"`
+	// Summary is set by the hook of the response, called after the fields were decoded
+	Summary string `xml:"-"`
+}
+
+func (r *secretsResponse) AfterDecode(context.Context) error {
+	values := []string{string(r.Secret)}
+	for _, item := range r.Items {
+		values = append(values, string(item.Value))
+	}
+	r.Summary = strings.Join(values, ",")
+	return nil
+}
+
+type secretsRequest struct {
+	XMLName xml.Name     `xml:"urn:test GetSecrets"`
+	Secret  reversed     `xml:"Secret"`
+	Items   []secretItem `xml:"Item"`
+}
+
+func secretsEnvelope(items ...string) string {
+	body := `<GetSecretsResponse xmlns="urn:test"><Secret>cba~</Secret><Extra>zy~</Extra>`
+	for _, item := range items {
+		body += `<Item><Value>` + item + `</Value></Item>`
+	}
+	return `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` + body +
+		`</GetSecretsResponse></soap:Body></soap:Envelope>`
+}
+
+func TestAfterDecode(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", secretsEnvelope("1~", "32~"))
+	resp := &secretsResponse{}
+	require.NoError(t, NewClient(srv.URL).Do(context.Background(), "GetSecrets", &infoRequest{}, resp))
+	assert.Equal(t, reversed("abc"), resp.Secret)
+	require.NotNil(t, resp.Extra)
+	assert.Equal(t, reversed("yz"), *resp.Extra)
+	assert.Equal(t, []secretItem{{"1"}, {"23"}}, resp.Items)
+	assert.Equal(t, "abc,1,23", resp.Summary)
+}
+
+func TestAfterDecodeError(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", secretsEnvelope("1~", "plain"))
+	err := NewClient(srv.URL).Do(context.Background(), "GetSecrets", &infoRequest{}, &secretsResponse{})
+	var hookErr *FieldHookError
+	require.ErrorAs(t, err, &hookErr)
+	assert.Equal(t, "AfterDecode", hookErr.Hook)
+	assert.Equal(t, "secretsResponse.Items[1].Value", hookErr.Path)
+	assert.ErrorIs(t, err, ErrFieldHook)
+	assert.ErrorIs(t, err, errObfuscated)
+}
+
+func TestBeforeEncode(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	req := &secretsRequest{Secret: "abc", Items: []secretItem{{"12"}}}
+	require.NoError(t, NewClient(srv.URL).Do(context.Background(), "GetSecrets", req, &quirksResponse{}))
+	require.Len(t, *captured, 1)
+	assert.Contains(t, (*captured)[0].body, `Secret>cba~</`)
+	assert.Contains(t, (*captured)[0].body, `Value>21~</`)
+}
+
+func TestFieldHooksContainers(t *testing.T) {
+	type holder struct {
+		ByKey   map[string]reversed
+		ByPtr   map[string]*reversed
+		Any     any
+		Array   [2]reversed
+		Nested  **secretItem
+		private reversed
+	}
+	p := reversed("b~")
+	item := &secretItem{Value: "c~"}
+	h := &holder{
+		ByKey:   map[string]reversed{"k": "ed~"},
+		ByPtr:   map[string]*reversed{"p": &p},
+		Any:     secretItem{Value: "f~"},
+		Array:   [2]reversed{"g~", "h~"},
+		Nested:  &item,
+		private: "i",
+	}
+	require.NoError(t, afterDecode(context.Background(), h))
+	assert.Equal(t, reversed("de"), h.ByKey["k"])
+	assert.Equal(t, reversed("b"), p)
+	assert.Equal(t, secretItem{Value: "f"}, h.Any)
+	assert.Equal(t, [2]reversed{"g", "h"}, h.Array)
+	assert.Equal(t, reversed("c"), item.Value)
+	assert.Equal(t, reversed("i"), h.private)
+
+	h.ByKey = map[string]reversed{"x": "plain"}
+	var hookErr *FieldHookError
+	require.ErrorAs(t, afterDecode(context.Background(), h), &hookErr)
+	assert.Equal(t, "holder.ByKey[x]", hookErr.Path)
+}
+
+func TestFieldHooksNone(t *testing.T) {
+	assert.False(t, hasHooks(reflect.TypeOf(&infoResponse{}), afterDecoderType))
+	assert.True(t, hasHooks(reflect.TypeOf(&secretsResponse{}), afterDecoderType))
+	assert.NoError(t, afterDecode(context.Background(), nil))
+}
@@ -0,0 +1,100 @@
+package soap
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/m29h/xml"
+)
+
+// ResponseInfo contains statistics and metadata about a single call.
+type ResponseInfo struct {
+	// Action is the SOAP action of the call.
+	Action string
+	// Endpoint is the URL the call was sent to, with the placeholders resolved and passwords redacted.
+	Endpoint string
+	// Attempt is the number of the attempt the statistics belong to, starting at 1.
+	Attempt int
+	// CorrelationID is the correlation id sent with the call, if enabled with WithCorrelationID.
+	CorrelationID string
+	// EchoedCorrelationID is the correlation id returned by the server in the correlation header.
+	EchoedCorrelationID string
+	// MessageID is the WS-Addressing message id of the attempt, if enabled with WithAddressing.
+	MessageID string
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Header holds the HTTP headers of the response.
+	Header http.Header
+	// BytesRead is the number of (transfer-decoded) response body bytes read.
+	BytesRead int64
+	// Elements is the number of XML start elements decoded from the response envelope.
+	Elements int
+	// InvalidCharacters is the number of characters not allowed in XML replaced with U+FFFD, if enabled with
+	// WithInvalidCharacterReplacement.
+	InvalidCharacters int
+	// TrailingData holds the data following the envelope of an XML response, such as debug output of the
+	// server, if it is more than whitespace. It is read up to 64 KiB for bodies of known length and otherwise
+	// ignored.
+	TrailingData []byte
+	// Attachments is the number of MIME attachments received in a multipart response.
+	Attachments int
+	// SOAPHeaders holds the header elements of the response envelope.
+	SOAPHeaders []RawHeader
+	// NotUnderstood holds the response headers marked mustUnderstand that are not understood, if enabled with
+	// CheckMustUnderstand.
+	NotUnderstood []RawHeader
+	// Timings holds the timings of all attempts of the call so far, the last one belongs to this attempt.
+	Timings []Timings
+	// Duration is the time the call took in total, including the backoff between attempts.
+	Duration time.Duration
+	// CircuitState is the state of the circuit breaker after the call, if it reports it, see WithCircuitBreaker.
+	CircuitState CircuitState
+}
+
+// MetricsHook is called once per call after the response was handled, with err being the result of the call.
+type MetricsHook func(ctx context.Context, info *ResponseInfo, err error)
+
+// WithResponseInfo stores the statistics of the call into info once the call returns.
+// It is meant to be passed to Client.Do for a single call.
+func WithResponseInfo(info *ResponseInfo) Option {
+	return func(s *settings) error {
+		s.info = info
+		return nil
+	}
+}
+
+// WithMetricsHook installs a hook receiving the ResponseInfo of every call.
+func WithMetricsHook(hook MetricsHook) Option {
+	return func(s *settings) error {
+		s.metrics = hook
+		return nil
+	}
+}
+
+// countingReader counts the bytes read from the wrapped reader.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingTokenReader counts the start elements passed through from the wrapped token reader.
+type countingTokenReader struct {
+	t        xml.TokenReader
+	elements int
+}
+
+func (c *countingTokenReader) Token() (xml.Token, error) {
+	t, err := c.t.Token()
+	if _, ok := t.(xml.StartElement); ok {
+		c.elements++
+	}
+	return t, err
+}
@@ -0,0 +1,100 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type infoRequest struct {
+	XMLName xml.Name `xml:"urn:test GetInfo"`
+}
+
+type infoResponse struct {
+	XMLName xml.Name `xml:"urn:test GetInfoResponse"`
+	Items   []string `xml:"Item"`
+}
+
+const infoResponseBody = `<?xml version="1.0"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Body>
+		<GetInfoResponse xmlns="urn:test"><Item>a</Item><Item>b</Item></GetInfoResponse>
+	</soap:Body>
+</soap:Envelope>`
+
+func newInfoServer(t *testing.T, contentType string, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		_, _ = w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResponseInfo(t *testing.T) {
+	srv := newInfoServer(t, "text/xml; charset=utf-8", infoResponseBody)
+	client := NewClient(srv.URL)
+
+	var info ResponseInfo
+	resp := &infoResponse{}
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, resp, WithResponseInfo(&info))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, resp.Items)
+	assert.Equal(t, "GetInfo", info.Action)
+	assert.Equal(t, http.StatusOK, info.StatusCode)
+	assert.Equal(t, int64(len(infoResponseBody)), info.BytesRead)
+	// Envelope, Body, GetInfoResponse and two Items
+	assert.Equal(t, 5, info.Elements)
+	assert.Equal(t, 0, info.Attachments)
+}
+
+func TestMetricsHook(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", infoResponseBody)
+	client := NewClient(srv.URL)
+
+	var calls []ResponseInfo
+	err := client.SetOptions(WithMetricsHook(func(ctx context.Context, info *ResponseInfo, err error) {
+		assert.NoError(t, err)
+		calls = append(calls, *info)
+	}))
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		err = client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+		assert.NoError(t, err)
+	}
+	assert.Len(t, calls, 2)
+	assert.Equal(t, 5, calls[1].Elements)
+}
+
+func TestResponseInfoAttachments(t *testing.T) {
+	body := "--boundary\r\n" +
+		"Content-Type: application/xop+xml; charset=utf-8; type=\"text/xml\"\r\n\r\n" +
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<GetFileResponse xmlns="urn:test"><Data><Include xmlns="http://www.w3.org/2004/08/xop/include" href="cid:part1"/></Data></GetFileResponse>` +
+		"</soap:Body></soap:Envelope>\r\n" +
+		"--boundary\r\n" +
+		"Content-ID: <part1>\r\n" +
+		"Content-Type: application/octet-stream\r\n\r\n" +
+		"binary\r\n" +
+		"--boundary--\r\n"
+	srv := newInfoServer(t, `multipart/related; boundary=boundary; type="application/xop+xml"`, body)
+	client := NewClient(srv.URL)
+
+	resp := &struct {
+		XMLName xml.Name `xml:"urn:test GetFileResponse"`
+		Data    []byte   `xml:"Data"`
+	}{}
+	var info ResponseInfo
+	err := client.Do(context.Background(), "GetFile", &infoRequest{}, resp, WithResponseInfo(&info))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("binary"), resp.Data)
+	assert.Equal(t, 1, info.Attachments)
+	assert.Equal(t, int64(len(body)), info.BytesRead)
+}
@@ -0,0 +1,94 @@
+package soap
+
+import (
+	"io"
+	"unicode/utf8"
+)
+
+// Implements the recovery of responses with characters not allowed in XML, such as control bytes or invalid
+// UTF-8 emitted by some legacy backends into text nodes, which fail the whole decoding otherwise.
+
+// WithInvalidCharacterReplacement replaces the characters of responses not allowed in XML with U+FFFD before
+// they are decoded, instead of failing the decoding: control characters other than tab, line feed and carriage
+// return, U+FFFE and U+FFFF, and bytes that are not part of valid UTF-8, each of which is replaced on its own.
+// Valid characters are left unchanged. ResponseInfo.InvalidCharacters is the number of replacements.
+//
+// Character references are left to the decoder, &#3; still fails the decoding.
+func WithInvalidCharacterReplacement() Option {
+	return func(s *settings) error {
+		s.replaceInvalidChars = true
+		return nil
+	}
+}
+
+// replaceInvalidCharacters returns rd with the invalid characters replaced if WithInvalidCharacterReplacement
+// is set, counting the replacements in count.
+func (s *settings) replaceInvalidCharacters(rd io.Reader, count *int) io.Reader {
+	if !s.replaceInvalidChars {
+		return rd
+	}
+	return &invalidCharReader{r: rd, count: count}
+}
+
+// invalidCharReader replaces the characters not allowed in XML with U+FFFD.
+type invalidCharReader struct {
+	r     io.Reader
+	count *int
+	// in holds the input not yet checked, an incomplete UTF-8 sequence at the end of the input read so far
+	in  []byte
+	out []byte
+	err error
+}
+
+var replacementChar = []byte(string(utf8.RuneError))
+
+func (c *invalidCharReader) Read(p []byte) (int, error) {
+	for len(c.out) == 0 {
+		if c.err != nil {
+			return 0, c.err
+		}
+		c.fill()
+	}
+	n := copy(p, c.out)
+	c.out = c.out[n:]
+	return n, nil
+}
+
+// fill reads the next chunk of input and moves its characters to out.
+func (c *invalidCharReader) fill() {
+	if cap(c.in) == 0 {
+		c.in = make([]byte, 0, 32<<10)
+	}
+	n, err := c.r.Read(c.in[len(c.in):cap(c.in)])
+	c.in = c.in[:len(c.in)+n]
+	c.err = err
+	c.out = c.out[:0]
+
+	in := c.in
+	for len(in) > 0 {
+		b := in[0]
+		if b < utf8.RuneSelf {
+			if b < 0x20 && b != '\t' && b != '\n' && b != '\r' {
+				c.out = append(c.out, replacementChar...)
+				*c.count++
+			} else {
+				c.out = append(c.out, b)
+			}
+			in = in[1:]
+			continue
+		}
+		if !utf8.FullRune(in) && c.err == nil {
+			// the rest of the sequence is yet to be read
+			break
+		}
+		r, size := utf8.DecodeRune(in)
+		if r == utf8.RuneError && size == 1 || r == 0xFFFE || r == 0xFFFF {
+			c.out = append(c.out, replacementChar...)
+			*c.count++
+		} else {
+			c.out = append(c.out, in[:size]...)
+		}
+		in = in[size:]
+	}
+	c.in = c.in[:copy(c.in, in)]
+}
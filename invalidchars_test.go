@@ -0,0 +1,62 @@
+package soap
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidCharReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		in    string
+		want  string
+		count int
+	}{
+		{name: "valid", in: "a\tb\r\nc é€😀 �", want: "a\tb\r\nc é€😀 �"},
+		{name: "control byte", in: "a\x03b\x00", want: "a�b�", count: 2},
+		{name: "control byte between multi-byte characters", in: "é\x03€", want: "é�€", count: 1},
+		{name: "invalid bytes", in: "a\xff\xfeb", want: "a��b", count: 2},
+		{name: "invalid continuation", in: "\xe2\x82x€", want: "��x€", count: 2},
+		{name: "truncated at the end", in: "€\xe2\x82", want: "€��", count: 2},
+		{name: "surrogate", in: "\xed\xa0\x80é", want: "���é", count: 3},
+		{name: "noncharacter", in: "a\ufffeb\uffff", want: "a�b�", count: 2},
+	}
+	for _, tt := range tests {
+		for _, oneByte := range []bool{false, true} {
+			t.Run(tt.name, func(t *testing.T) {
+				var rd io.Reader = strings.NewReader(tt.in)
+				if oneByte {
+					rd = iotest.OneByteReader(rd)
+				}
+				count := 0
+				s := settings{replaceInvalidChars: true}
+				out, err := io.ReadAll(s.replaceInvalidCharacters(rd, &count))
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, string(out))
+				assert.Equal(t, tt.count, count)
+			})
+		}
+	}
+}
+
+func TestInvalidCharacterReplacement(t *testing.T) {
+	body := strings.Replace(infoResponseBody, "<Item>a</Item>", "<Item>a\x03ä</Item>", 1)
+	srv := newInfoServer(t, "text/xml; charset=utf-8", body)
+	client := NewClient(srv.URL)
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorContains(t, err, "illegal character code U+0003")
+
+	var info ResponseInfo
+	resp := &infoResponse{}
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, resp,
+		WithInvalidCharacterReplacement(), WithResponseInfo(&info)))
+	assert.Equal(t, []string{"a�ä", "b"}, resp.Items)
+	assert.Equal(t, 1, info.InvalidCharacters)
+}
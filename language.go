@@ -0,0 +1,89 @@
+package soap
+
+import (
+	"strings"
+)
+
+// Implements the selection of the language of fault strings. A SOAP 1.2 fault carries a reason text per
+// language, told apart by xml:lang; SOAP 1.1 faults have a single faultstring, which may carry xml:lang as well.
+
+// FaultReason is a fault string in the language Lang, empty if the server did not name it.
+type FaultReason struct {
+	Lang string
+	Text string
+}
+
+// faultText is the layout of a reason text or faultstring.
+type faultText struct {
+	Lang string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Text string `xml:",chardata"`
+}
+
+// WithPreferredLanguages selects the fault string of faults by the language tags langs, in order of preference,
+// e.g. "de-CH", "de", "en". The string of the first language the server sent is used if none matches, as it
+// is without the option. Fault.Lang is the language of the selected string; see SelectLanguage for the matching.
+//
+// The messages of the errors of the package are in English regardless of the option.
+func WithPreferredLanguages(langs ...string) Option {
+	return func(s *settings) error {
+		s.languages = langs
+		return nil
+	}
+}
+
+// SelectLanguage returns the index of the language tag among available matching the most preferred of the
+// language tags preferred, case-insensitively. A preferred tag matches the same tag, then the tag truncated by
+// its subtags, and then a tag starting with it: "de-CH" matches "de-CH", then "de", then "de-DE". The first
+// available tag matching wins. The result is 0 if none matches and -1 if available is empty.
+func SelectLanguage(available, preferred []string) int {
+	if len(available) == 0 {
+		return -1
+	}
+	find := func(match func(tag string) bool) int {
+		for i, tag := range available {
+			if match(strings.ToLower(tag)) {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, want := range preferred {
+		want = strings.ToLower(want)
+		if want == "" {
+			continue
+		}
+		var prefixes []string
+		for prefix := want; ; {
+			prefixes = append(prefixes, prefix)
+			cut := strings.LastIndexByte(prefix, '-')
+			if cut < 0 {
+				break
+			}
+			prefix = prefix[:cut]
+		}
+		for _, prefix := range prefixes {
+			if i := find(func(tag string) bool { return tag == prefix }); i >= 0 {
+				return i
+			}
+		}
+		for _, prefix := range prefixes {
+			if i := find(func(tag string) bool { return strings.HasPrefix(tag, prefix+"-") }); i >= 0 {
+				return i
+			}
+		}
+	}
+	return 0
+}
+
+// setReasons selects the fault string among the texts by the preferred languages.
+func (f *Fault) setReasons(texts []faultText, preferred []string) {
+	f.Reasons = nil
+	langs := make([]string, len(texts))
+	for i, t := range texts {
+		f.Reasons = append(f.Reasons, FaultReason(t))
+		langs[i] = t.Lang
+	}
+	if i := SelectLanguage(langs, preferred); i >= 0 {
+		f.String, f.Lang = texts[i].Text, texts[i].Lang
+	}
+}
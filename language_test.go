@@ -0,0 +1,70 @@
+package soap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectLanguage(t *testing.T) {
+	tests := []struct {
+		name      string
+		available []string
+		preferred []string
+		want      int
+	}{
+		{name: "exact", available: []string{"en", "de"}, preferred: []string{"de"}, want: 1},
+		{name: "case", available: []string{"en", "DE-de"}, preferred: []string{"de-DE"}, want: 1},
+		{name: "order of preference", available: []string{"en", "fr", "de"}, preferred: []string{"it", "fr", "de"}, want: 1},
+		{name: "truncated", available: []string{"en", "de"}, preferred: []string{"de-CH"}, want: 1},
+		{name: "more specific", available: []string{"en", "de-DE"}, preferred: []string{"de"}, want: 1},
+		{name: "sibling", available: []string{"en", "de-DE"}, preferred: []string{"de-CH"}, want: 1},
+		{name: "truncated before more specific", available: []string{"de-DE", "de"}, preferred: []string{"de-CH"}, want: 1},
+		{name: "no match", available: []string{"en", "fr"}, preferred: []string{"de"}, want: 0},
+		{name: "no preference", available: []string{"en", "fr"}, want: 0},
+		{name: "none available", preferred: []string{"de"}, want: -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, SelectLanguage(tt.available, tt.preferred))
+		})
+	}
+}
+
+func TestPreferredLanguages(t *testing.T) {
+	fault12 := `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><env:Fault>` +
+		`<env:Code><env:Value>env:Sender</env:Value></env:Code><env:Reason>` +
+		`<env:Text xml:lang="en">Invalid account</env:Text><env:Text xml:lang="de-DE">Ungültiges Konto</env:Text>` +
+		`</env:Reason></env:Fault></env:Body></env:Envelope>`
+	fault11 := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+		`<faultcode>soap:Client</faultcode><faultstring xml:lang="fr">Compte invalide</faultstring>` +
+		`</soap:Fault></soap:Body></soap:Envelope>`
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		opts        []Option
+		want        FaultReason
+		reasons     int
+	}{
+		{name: "soap 1.2 default", contentType: "application/soap+xml", body: fault12, opts: []Option{WithVersion(SOAP12)},
+			want: FaultReason{Lang: "en", Text: "Invalid account"}, reasons: 2},
+		{name: "soap 1.2 preferred", contentType: "application/soap+xml", body: fault12,
+			opts: []Option{WithVersion(SOAP12), WithPreferredLanguages("de", "en")},
+			want: FaultReason{Lang: "de-DE", Text: "Ungültiges Konto"}, reasons: 2},
+		{name: "soap 1.1", contentType: "text/xml", body: fault11, opts: []Option{WithPreferredLanguages("de")},
+			want: FaultReason{Lang: "fr", Text: "Compte invalide"}, reasons: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInfoServer(t, tt.contentType, tt.body)
+			err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, tt.opts...)
+			var fault *Fault
+			if assert.ErrorAs(t, err, &fault) {
+				assert.Equal(t, tt.want, FaultReason{Lang: fault.Lang, Text: fault.String})
+				assert.Len(t, fault.Reasons, tt.reasons)
+			}
+		})
+	}
+}
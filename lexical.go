@@ -0,0 +1,115 @@
+package soap
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Implements tolerant lexical forms of simple values for legacy services.
+// The types decode every form seen in the wild and encode a single canonical form, they can be used for
+// elements as well as attributes.
+
+// Bool is a boolean accepting true, false, 1 and 0 (case-insensitive, surrounding whitespace ignored).
+// It is encoded as true or false.
+type Bool bool
+
+// NumericBool is a Bool encoded as 1 or 0, for services rejecting true and false on input.
+type NumericBool bool
+
+// MarshalText implements encoding.TextMarshaler.
+func (b Bool) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatBool(bool(b))), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *Bool) UnmarshalText(text []byte) error {
+	v, err := parseBool(text)
+	*b = Bool(v)
+	return err
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b NumericBool) MarshalText() ([]byte, error) {
+	if b {
+		return []byte("1"), nil
+	}
+	return []byte("0"), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (b *NumericBool) UnmarshalText(text []byte) error {
+	v, err := parseBool(text)
+	*b = NumericBool(v)
+	return err
+}
+
+func parseBool(text []byte) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(string(text))) {
+	case "true", "1":
+		return true, nil
+	case "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", text)
+}
+
+// Float is a float64 also accepting a comma as decimal separator and digit grouping, e.g. 1,5 or 1.234,5 or
+// 1 234.5. If both a comma and a dot occur, the last one is the decimal separator. A single separator is
+// taken as decimal separator unless it occurs repeatedly. It is encoded in the xsd:double form.
+type Float float64
+
+// MarshalText implements encoding.TextMarshaler.
+func (f Float) MarshalText() ([]byte, error) {
+	switch v := float64(f); {
+	case math.IsInf(v, 1):
+		return []byte("INF"), nil
+	case math.IsInf(v, -1):
+		return []byte("-INF"), nil
+	case math.IsNaN(v):
+		return []byte("NaN"), nil
+	}
+	return []byte(strconv.FormatFloat(float64(f), 'g', -1, 64)), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (f *Float) UnmarshalText(text []byte) error {
+	v, err := parseLocaleFloat(string(text))
+	if err != nil {
+		return err
+	}
+	*f = Float(v)
+	return nil
+}
+
+func parseLocaleFloat(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	// digit grouping by spaces, including the no-break and narrow no-break space, or apostrophes
+	s = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", "'", "").Replace(s)
+
+	decimal := strings.LastIndexAny(s, ".,")
+	if decimal >= 0 {
+		sep := s[decimal : decimal+1]
+		other := strings.ContainsAny(s[:decimal], ".,") && !strings.Contains(s[:decimal], sep)
+		if !other && strings.Contains(s[:decimal], sep) {
+			// a single separator occurring repeatedly is grouping, e.g. 1.234.567
+			decimal = -1
+		}
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case i == decimal:
+			b.WriteByte('.')
+		case s[i] == '.' || s[i] == ',':
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	v, err := strconv.ParseFloat(b.String(), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return v, nil
+}
@@ -0,0 +1,93 @@
+package soap
+
+import (
+	"math"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type lexicalRecord struct {
+	XMLName xml.Name    `xml:"Record"`
+	Flag    Bool        `xml:"flag,attr"`
+	Active  Bool        `xml:"Active"`
+	Enabled NumericBool `xml:"Enabled"`
+	Ratio   Float       `xml:"Ratio"`
+}
+
+func TestBoolDecode(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    bool
+		wantErr bool
+	}{
+		{text: "true", want: true},
+		{text: "1", want: true},
+		{text: " TRUE ", want: true},
+		{text: "false"},
+		{text: "0"},
+		{text: "yes", wantErr: true},
+		{text: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		var b Bool
+		err := b.UnmarshalText([]byte(tt.text))
+		if tt.wantErr {
+			assert.Error(t, err, tt.text)
+			continue
+		}
+		assert.NoError(t, err, tt.text)
+		assert.Equal(t, tt.want, bool(b), tt.text)
+
+		var n NumericBool
+		assert.NoError(t, n.UnmarshalText([]byte(tt.text)), tt.text)
+		assert.Equal(t, tt.want, bool(n), tt.text)
+	}
+}
+
+func TestFloatDecode(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    float64
+		wantErr bool
+	}{
+		{text: "1.5", want: 1.5},
+		{text: "1,5", want: 1.5},
+		{text: "-0,25", want: -0.25},
+		{text: "1.234,5", want: 1234.5},
+		{text: "1,234.5", want: 1234.5},
+		{text: "1.234.567", want: 1234567},
+		{text: "1 234,5", want: 1234.5},
+		{text: "1 234,5", want: 1234.5},
+		{text: "2,5E3", want: 2500},
+		{text: "12", want: 12},
+		{text: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		var f Float
+		err := f.UnmarshalText([]byte(tt.text))
+		if tt.wantErr {
+			assert.Error(t, err, tt.text)
+			continue
+		}
+		assert.NoError(t, err, tt.text)
+		assert.Equal(t, tt.want, float64(f), tt.text)
+	}
+}
+
+func TestLexicalRoundTrip(t *testing.T) {
+	var rec lexicalRecord
+	err := xml.Unmarshal([]byte(`<Record flag="0"><Active>1</Active><Enabled>true</Enabled><Ratio>1,5</Ratio></Record>`), &rec)
+	assert.NoError(t, err)
+	assert.Equal(t, lexicalRecord{XMLName: xml.Name{Local: "Record"}, Active: true, Enabled: true, Ratio: 1.5}, rec)
+
+	data, err := xml.Marshal(rec)
+	assert.NoError(t, err)
+	assert.Equal(t, `<Record flag="false"><Active>true</Active><Enabled>1</Enabled><Ratio>1.5</Ratio></Record>`, string(data))
+
+	inf, err := Float(math.Inf(-1)).MarshalText()
+	assert.NoError(t, err)
+	assert.Equal(t, "-INF", string(inf))
+}
@@ -0,0 +1,43 @@
+package soap
+
+import (
+	"context"
+	"log/slog"
+)
+
+// WithLogger logs every completed call to logger. Successful calls are logged at debug level,
+// failed calls at warning level.
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *settings) error {
+		s.logger = logger
+		return nil
+	}
+}
+
+// logCall writes the outcome of the call cl to the configured logger.
+func (cl *call) logCall(ctx context.Context, err error) {
+	logger := cl.settings.logger
+	if logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("action", cl.action),
+		slog.String("endpoint", redactURL(cl.url)),
+		slog.Int("attempts", cl.attempt),
+	}
+	if cl.correlationID != "" {
+		attrs = append(attrs, slog.String("correlation_id", cl.correlationID))
+	}
+	if cl.info != nil && cl.info.StatusCode != 0 {
+		attrs = append(attrs, slog.Int("status", cl.info.StatusCode))
+	}
+	if cl.info != nil {
+		attrs = append(attrs, slog.Duration("duration", cl.info.Duration))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		logger.LogAttrs(ctx, slog.LevelWarn, "soap call failed", attrs...)
+		return
+	}
+	logger.LogAttrs(ctx, slog.LevelDebug, "soap call", attrs...)
+}
@@ -0,0 +1,138 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+)
+
+// Implements writing and reading envelopes without HTTP, e.g. to exchange SOAP messages over a message queue.
+// The envelopes are encoded and decoded by the same code as the requests and responses of the client.
+
+var (
+	// ErrInvalidHeaderReceiver is returned by ReadEnvelope for a header receiver which is neither a
+	// *[]RawHeader nor a pointer to a struct with an XMLName tag.
+	ErrInvalidHeaderReceiver = errors.New("invalid header receiver")
+)
+
+// WriteEnvelope writes the envelope with the body content and the headers to w, the way Client.Do encodes a
+// request with the options: the SOAP version, signing of WSSE headers, header order, sanitizing, formats,
+// encoders and MTOM among them. A HeaderBuilder among the headers is called with the body, like the builders
+// of a client. The headers of the options tied to a call, WS-Addressing, idempotency and correlation headers,
+// are not added.
+//
+// The returned content type is the one the message is sent with over HTTP, which is a multipart content type
+// whose boundary is only known once written if attachments are sent as MIME parts. SOAP 1.2 content types
+// carry no action, Packaging options for actions do not apply.
+func WriteEnvelope(w io.Writer, body any, headers []any, opts ...Option) (string, error) {
+	s, err := settings{}.apply(opts...)
+	if err != nil {
+		return "", err
+	}
+	builders := make([]HeaderBuilder, len(headers))
+	for i, h := range headers {
+		switch h := h.(type) {
+		case HeaderBuilder:
+			builders[i] = h
+		case func(any) (any, error):
+			builders[i] = h
+		default:
+			builders[i] = func(any) (any, error) { return h, nil }
+		}
+	}
+	envelope, err := s.buildEnvelope(context.Background(), body, builders)
+	if err != nil {
+		return "", err
+	}
+	payload, parts, err := s.encodeEnvelope(envelope, "")
+	if err != nil {
+		return "", err
+	}
+	data, contentType, err := s.packageEnvelope(payload, parts, "")
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(data); err != nil {
+		return "", err
+	}
+	return contentType, nil
+}
+
+// ReadEnvelope decodes the envelope read from r into the body content the way Client.Do decodes a response of
+// the content type, a plain XML or a multipart (MTOM) content type. The SOAP version is the one of the content
+// type, application/soap+xml for SOAP 1.2 and text/xml for SOAP 1.1. A SOAP fault in the envelope is returned
+// as *Fault with a nil error; item faults reported by a PartialFaults body are returned as error.
+//
+// The headers of the envelope are decoded into the header receivers: a *[]RawHeader receives all of them, a
+// pointer to a struct with an XMLName tag the first header of that name. Receivers without a matching header
+// are left alone.
+func ReadEnvelope(r io.Reader, contentType string, body any, headerReceivers ...any) (*Fault, error) {
+	for _, receiver := range headerReceivers {
+		if err := checkHeaderReceiver(receiver); err != nil {
+			return nil, err
+		}
+	}
+	mediaType, mediaParams, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	resp := &Response{body: body}
+	if mediaType == "application/soap+xml" || mediaParams["start-info"] == "application/soap+xml" {
+		resp.settings.version = SOAP12
+	}
+	envelope := resp.newEnvelope()
+	if err := resp.readEnvelope(r, mediaType, mediaParams, envelope); err != nil {
+		return nil, err
+	}
+	if err := resp.handleEnvelope(envelope); err != nil {
+		return nil, err
+	}
+	if err := receiveHeaders(envelope.Header, headerReceivers); err != nil {
+		return nil, err
+	}
+	if resp.fault != nil {
+		return resp.fault, nil
+	}
+	if err := afterDecode(context.Background(), body); err != nil {
+		return nil, err
+	}
+	return nil, partialFailure(body)
+}
+
+func checkHeaderReceiver(receiver any) error {
+	if _, ok := receiver.(*[]RawHeader); ok {
+		return nil
+	}
+	v := reflect.ValueOf(receiver)
+	if v.Kind() != reflect.Pointer || v.IsNil() || taggedXMLName(receiver) == nil {
+		return fmt.Errorf("%w: %T", ErrInvalidHeaderReceiver, receiver)
+	}
+	return nil
+}
+
+// receiveHeaders decodes the headers into the receivers, see ReadEnvelope.
+func receiveHeaders(header *Header, receivers []any) error {
+	var headers []RawHeader
+	if header != nil {
+		headers = header.Raw
+	}
+	for _, receiver := range receivers {
+		if list, ok := receiver.(*[]RawHeader); ok {
+			*list = append((*list)[:0], headers...)
+			continue
+		}
+		name := taggedXMLName(receiver)
+		for _, h := range headers {
+			if matchName(*name, h.XMLName) {
+				if err := h.Decode(receiver); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package soap
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteReadEnvelope(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		contentType string
+	}{
+		{name: "soap 1.1", contentType: `text/xml; charset="utf-8"`},
+		{name: "soap 1.2", opts: []Option{WithVersion(SOAP12)}, contentType: "application/soap+xml; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			route := func(any) (any, error) { return routeHeader{Hop: 2}, nil }
+			contentType, err := WriteEnvelope(&buf, &infoResponse{Items: []string{"a", "b"}},
+				[]any{routeHeader{Hop: 1}, HeaderBuilder(route), nil}, tt.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.contentType, contentType)
+
+			resp := &infoResponse{}
+			var header routeHeader
+			var raw []RawHeader
+			fault, err := ReadEnvelope(&buf, contentType, resp, &header, &raw)
+			require.NoError(t, err)
+			assert.Nil(t, fault)
+			assert.Equal(t, []string{"a", "b"}, resp.Items)
+			// the Route header of the builder replaces the first one
+			assert.Equal(t, 2, header.Hop)
+			assert.Len(t, raw, 1)
+		})
+	}
+}
+
+func TestWriteEnvelopeMTOM(t *testing.T) {
+	var buf bytes.Buffer
+	req := &upload{Large: Attachment{Data: bytes.Repeat([]byte{2}, 200), Mode: AttachAlways, ContentID: "large@example"}}
+	contentType, err := WriteEnvelope(&buf, req, nil, WithMTOM(), WithAttachmentDigests(DigestMD5))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(contentType, "multipart/related;"), contentType)
+	assert.Contains(t, buf.String(), "Content-Md5: ")
+
+	resp := &upload{}
+	fault, err := ReadEnvelope(&buf, contentType, resp)
+	require.NoError(t, err)
+	assert.Nil(t, fault)
+	assert.Equal(t, req.Large.Data, resp.Large.Data)
+	assert.Equal(t, "large@example", resp.Large.ContentID)
+}
+
+func TestWriteEnvelopeSigned(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = WriteEnvelope(&buf, &infoRequest{}, []any{wsseInfo.Header()})
+	require.NoError(t, err)
+	pair, err := tls.LoadX509KeyPair(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	require.NoError(t, err)
+	assert.NoError(t, VerifySignature(buf.Bytes(), VerifyOptions{Certificate: cert}))
+}
+
+func TestReadEnvelopeFault(t *testing.T) {
+	envelope := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header>` +
+		`<g:Route xmlns:g="urn:gateway" hop="3"/></soap:Header><soap:Body><soap:Fault>` +
+		`<faultcode>soap:Server</faultcode><faultstring>failed</faultstring></soap:Fault></soap:Body></soap:Envelope>`
+	var header routeHeader
+	fault, err := ReadEnvelope(strings.NewReader(envelope), "text/xml", &infoResponse{}, &header)
+	require.NoError(t, err)
+	if assert.NotNil(t, fault) {
+		assert.Equal(t, "failed", fault.String)
+	}
+	assert.Equal(t, 3, header.Hop)
+
+	_, err = ReadEnvelope(strings.NewReader(envelope), "application/json", &infoResponse{})
+	assert.ErrorIs(t, err, ErrUnsupportedContentType)
+	_, err = ReadEnvelope(strings.NewReader(envelope), "text/xml", &infoResponse{}, routeHeader{})
+	assert.ErrorIs(t, err, ErrInvalidHeaderReceiver)
+	_, err = ReadEnvelope(strings.NewReader(envelope), "text/xml", &infoResponse{}, &struct{ Hop int }{})
+	assert.ErrorIs(t, err, ErrInvalidHeaderReceiver)
+}
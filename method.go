@@ -0,0 +1,68 @@
+package soap
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+var (
+	// ErrRequestWithGet is returned by calls with WithHTTPMethod("GET") passing a request value, a GET request
+	// has no envelope.
+	ErrRequestWithGet = errors.New("GET calls cannot send a request")
+	// ErrInvalidHTTPMethod is returned by WithHTTPMethod for an empty method.
+	ErrInvalidHTTPMethod = errors.New("invalid HTTP method")
+)
+
+// WithHTTPMethod sends the call with method instead of POST. With GET, as in the SOAP 1.2 web method
+// feature, no envelope is sent and the request value passed to Client.Do must be nil; the response envelope
+// is decoded as usual. See WithActionQueryParam for services expecting the action in the URL.
+func WithHTTPMethod(method string) Option {
+	return func(s *settings) error {
+		if method == "" {
+			return ErrInvalidHTTPMethod
+		}
+		s.httpMethod = method
+		return nil
+	}
+}
+
+// WithActionQueryParam adds the SOAP action to the endpoint URL as query parameter name, e.g. for GET calls
+// which cannot carry it in the Content-Type.
+func WithActionQueryParam(name string) Option {
+	return func(s *settings) error {
+		s.actionQueryParam = name
+		return nil
+	}
+}
+
+// method returns the HTTP method of the calls, POST by default.
+func (s *settings) method() string {
+	if s.httpMethod == "" {
+		return http.MethodPost
+	}
+	return s.httpMethod
+}
+
+// checkMethod returns an error if request cannot be sent with the configured method.
+func (s *settings) checkMethod(request any) error {
+	if s.method() == http.MethodGet && request != nil {
+		return ErrRequestWithGet
+	}
+	return nil
+}
+
+// withActionQuery returns endpoint with the action added as query parameter, if configured.
+func (s *settings) withActionQuery(endpoint, action string) (string, error) {
+	if s.actionQueryParam == "" {
+		return endpoint, nil
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set(s.actionQueryParam, action)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,80 @@
+package soap
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPMethod(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/soap+xml")
+		if r.Header.Get("Accept") == "application/soap+xml" {
+			_, _ = w.Write([]byte(strings.Replace(infoResponseBody, soapEnvNS, soap12EnvNS, 1)))
+			return
+		}
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+
+	tests := []struct {
+		name    string
+		opts    []Option
+		method  string
+		query   string
+		accept  string
+		action  string
+		hasBody bool
+	}{
+		{name: "default", method: http.MethodPost, action: "GetInfo", hasBody: true},
+		{name: "put", opts: []Option{WithHTTPMethod(http.MethodPut)}, method: http.MethodPut, action: "GetInfo", hasBody: true},
+		{name: "get soap 1.2", opts: []Option{WithHTTPMethod(http.MethodGet), WithVersion(SOAP12)},
+			method: http.MethodGet, accept: "application/soap+xml"},
+		{name: "get with action query", opts: []Option{WithHTTPMethod(http.MethodGet), WithActionQueryParam("op")},
+			method: http.MethodGet, query: "op=GetInfo", accept: "text/xml", action: "GetInfo"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request any = &infoRequest{}
+			if tt.method == http.MethodGet {
+				request = nil
+			}
+			resp := &infoResponse{}
+			err := NewClient(srv.URL).Do(context.Background(), "GetInfo", request, resp, tt.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a", "b"}, resp.Items)
+			assert.Equal(t, tt.method, got.Method)
+			assert.Equal(t, tt.query, got.URL.RawQuery)
+			assert.Equal(t, tt.accept, got.Header.Get("Accept"))
+			assert.Equal(t, tt.action, got.Header.Get("SOAPAction"))
+			assert.Equal(t, tt.hasBody, len(body) > 0)
+			assert.Equal(t, tt.hasBody, got.Header.Get("Content-Type") != "")
+		})
+	}
+}
+
+func TestHTTPMethodGetWithRequest(t *testing.T) {
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+		WithHTTPMethod(http.MethodGet))
+	assert.ErrorIs(t, err, ErrRequestWithGet)
+	assert.Empty(t, requests)
+
+	err = NewClient(srv.URL).Do(context.Background(), "GetInfo", nil, &infoResponse{}, WithHTTPMethod(""))
+	assert.ErrorIs(t, err, ErrInvalidHTTPMethod)
+}
@@ -0,0 +1,251 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/m29h/xml"
+
+	"github.com/google/uuid"
+)
+
+// Implements MTOM/XOP encoding of requests.
+// Attachment values are written as xop:Include elements referencing separate MIME parts, all other content
+// stays in the root part. Attachments below the threshold are written inline as base64.
+
+const xmimeNS = "http://www.w3.org/2005/05/xmlmime"
+
+// AttachmentMode controls whether an Attachment is sent as separate MIME part.
+type AttachmentMode int
+
+const (
+	// AttachAuto sends the attachment as MIME part if it is at least as large as the MTOMThreshold.
+	AttachAuto AttachmentMode = iota
+	// AttachAlways sends the attachment as MIME part regardless of its size.
+	AttachAlways
+	// AttachNever sends the attachment inline as base64.
+	AttachNever
+)
+
+// Attachment is binary element content, sent inline as base64 or as MIME part with WithMTOM.
+// Decoding accepts both representations.
+type Attachment struct {
+	Data []byte
+	// ContentType is the media type of the MIME part, application/octet-stream if empty.
+	ContentType string
+	// ContentID is the suggested Content-ID of the MIME part without angle brackets. A random id is used if
+	// empty or already taken. Decoded attachments carry the Content-ID they were received with.
+	ContentID string
+	// Mode overrides the MTOMThreshold for the attachment.
+	Mode AttachmentMode
+	// Size is the size of the content of a received MIME part, which is not in Data if Stored.
+	Size int64
+
+	// store holds the content of a received part spilled with WithAttachmentStore
+	store AttachmentStore
+}
+
+// WithMTOM sends requests as MTOM multipart messages if they contain Attachment values to be sent as MIME
+// parts. It requires the default encoder, as the parts are collected while encoding.
+func WithMTOM() Option {
+	return func(s *settings) error {
+		s.mtom = true
+		return nil
+	}
+}
+
+// MTOMThreshold sets the size in bytes below which attachments are sent inline with WithMTOM.
+// By default every non-empty attachment is sent as MIME part.
+func MTOMThreshold(bytes int) Option {
+	return func(s *settings) error {
+		s.mtomThreshold = bytes
+		return nil
+	}
+}
+
+// mtomPart is an attachment collected while encoding.
+type mtomPart struct {
+	id          string
+	contentType string
+	data        []byte
+}
+
+// mtomWriter collects the attachments written as MIME parts by an encoder.
+type mtomWriter struct {
+	threshold int
+	parts     []mtomPart
+	ids       map[string]bool
+	// limit is the maximum number of attachment bytes if positive, size the number added
+	limit int64
+	size  int64
+	// plain rejects the attachments of the action sent as plain XML
+	action string
+	plain  bool
+}
+
+// mtomWriters maps the encoders of requests with MTOM enabled to their writers, as Attachment.MarshalXML
+// only gets to see the encoder.
+var mtomWriters sync.Map
+
+func (w *mtomWriter) externalize(a Attachment) bool {
+	switch a.Mode {
+	case AttachAlways:
+		return true
+	case AttachNever:
+		return false
+	}
+	return len(a.Data) > 0 && len(a.Data) >= w.threshold
+}
+
+// add registers the attachment as MIME part and returns its Content-ID. It fails if the attachments exceed
+// the limit or the request is sent as plain XML.
+func (w *mtomWriter) add(a Attachment) (string, error) {
+	if w.plain {
+		return "", &PackagingError{Action: w.action}
+	}
+	w.size += int64(len(a.Data))
+	if w.limit > 0 && w.size > w.limit {
+		return "", &RequestTooLargeError{Limit: w.limit, Size: w.size, Attachments: true}
+	}
+	id := a.ContentID
+	if id == "" || w.ids[id] {
+		id = uuid.New().String() + "@gosoap"
+	}
+	w.ids[id] = true
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.parts = append(w.parts, mtomPart{id: id, contentType: contentType, data: a.Data})
+	return id, nil
+}
+
+// MarshalXML writes the attachment as base64, or as xop:Include if the encoder sends it as MIME part.
+func (a Attachment) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if w, ok := mtomWriters.Load(e); ok && w.(*mtomWriter).externalize(a) {
+		id, err := w.(*mtomWriter).add(a)
+		if err != nil {
+			var tooLarge *RequestTooLargeError
+			var packaging *PackagingError
+			if errors.As(err, &packaging) {
+				packaging.Element = start.Name.Local
+			} else if errors.As(err, &tooLarge) {
+				// the elements written so far give the path of the attachment
+				tooLarge.Path = start.Name.Local
+				_ = e.Flush()
+			}
+			return err
+		}
+		include := xml.StartElement{
+			Name: xml.Name{Space: xopNS, Local: "Include"},
+			Attr: []xml.Attr{{Name: xml.Name{Local: "href"}, Value: "cid:" + url.PathEscape(id)}},
+		}
+		for _, tok := range []xml.Token{start, include, include.End(), start.End()} {
+			if err := e.EncodeToken(tok); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return e.EncodeElement(base64.StdEncoding.EncodeToString(a.Data), start)
+}
+
+// UnmarshalXML decodes base64 content or records the Content-ID of an xop:Include. The data of an included
+// part is filled in when the part is read.
+func (a *Attachment) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var v struct {
+		Include *struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.w3.org/2004/08/xop/include Include"`
+		Text string `xml:",chardata"`
+	}
+	if err := d.DecodeElement(&v, &start); err != nil {
+		return err
+	}
+	for _, attr := range start.Attr {
+		if attr.Name.Space == xmimeNS && attr.Name.Local == "contentType" {
+			a.ContentType = attr.Value
+		}
+	}
+	if v.Include != nil {
+		id, err := url.PathUnescape(strings.TrimPrefix(v.Include.Href, "cid:"))
+		if err != nil {
+			return err
+		}
+		a.ContentID = id
+		a.Data = nil
+		return nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(v.Text), ""))
+	if err != nil {
+		return err
+	}
+	a.Data = data
+	return nil
+}
+
+// encodeMTOM returns the multipart message carrying the root envelope and the parts, and its content type.
+// soapType is the content type of the envelope in a plain request, digests the digest headers of the parts.
+func encodeMTOM(root []byte, soapType string, parts []mtomPart, digests *digestConfig) ([]byte, string, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	rootID := uuid.New().String() + "@gosoap"
+
+	mediaType, params, err := mime.ParseMediaType(soapType)
+	if err != nil {
+		return nil, "", err
+	}
+	rootType := map[string]string{"charset": "utf-8", "type": mediaType}
+	if action, ok := params["action"]; ok {
+		rootType["action"] = action
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", mime.FormatMediaType("application/xop+xml", rootType))
+	header.Set("Content-Transfer-Encoding", "8bit")
+	header.Set("Content-ID", "<"+rootID+">")
+	digests.setHeaders(header, root)
+	pw, err := mw.CreatePart(header)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := pw.Write(root); err != nil {
+		return nil, "", err
+	}
+
+	for _, part := range parts {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", part.contentType)
+		header.Set("Content-Transfer-Encoding", "binary")
+		header.Set("Content-ID", "<"+part.id+">")
+		digests.setHeaders(header, part.data)
+		pw, err := mw.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		if _, err := pw.Write(part.data); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, "", err
+	}
+
+	contentType := mime.FormatMediaType("multipart/related", map[string]string{
+		"type":       "application/xop+xml",
+		"start":      "<" + rootID + ">",
+		"start-info": mediaType,
+		"boundary":   mw.Boundary(),
+	})
+	if contentType == "" {
+		return nil, "", fmt.Errorf("invalid MTOM content type for %s", soapType)
+	}
+	return buf.Bytes(), contentType, nil
+}
@@ -0,0 +1,96 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type upload struct {
+	XMLName xml.Name   `xml:"urn:test Upload"`
+	Small   Attachment `xml:"Small"`
+	Large   Attachment `xml:"Large"`
+	Forced  Attachment `xml:"Forced"`
+	Inline  Attachment `xml:"Inline"`
+}
+
+// newMTOMEchoServer answers every request with the request body and content type and records the MIME parts.
+func newMTOMEchoServer(t *testing.T) (*httptest.Server, *[][]byte) {
+	t.Helper()
+	var parts [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		parts = nil
+		if mediaType, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/related" {
+			mr := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+			for {
+				part, err := mr.NextPart()
+				if err != nil {
+					break
+				}
+				data, _ := io.ReadAll(part)
+				parts = append(parts, data)
+			}
+		}
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &parts
+}
+
+func TestMTOMThreshold(t *testing.T) {
+	srv, parts := newMTOMEchoServer(t)
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithMTOM(), MTOMThreshold(100)))
+
+	req := &upload{
+		Small:  Attachment{Data: bytes.Repeat([]byte{1}, 40)},
+		Large:  Attachment{Data: bytes.Repeat([]byte{2}, 200)},
+		Forced: Attachment{Data: []byte{3}, Mode: AttachAlways, ContentType: "image/png", ContentID: "forced@example"},
+		Inline: Attachment{Data: bytes.Repeat([]byte{4}, 200), Mode: AttachNever},
+	}
+	resp := &upload{}
+	assert.NoError(t, client.Do(context.Background(), "Upload", req, resp))
+
+	if assert.Len(t, *parts, 3) {
+		root := string((*parts)[0])
+		assert.Equal(t, 2, strings.Count(root, `href="cid:`))
+		assert.Contains(t, root, `href="cid:forced@example"`)
+		assert.Equal(t, req.Large.Data, (*parts)[1])
+		assert.Equal(t, req.Forced.Data, (*parts)[2])
+	}
+	// the echoed message decodes into the same data, regardless of the representation
+	assert.Equal(t, req.Small.Data, resp.Small.Data)
+	assert.Equal(t, req.Large.Data, resp.Large.Data)
+	assert.Equal(t, req.Forced.Data, resp.Forced.Data)
+	assert.Equal(t, req.Inline.Data, resp.Inline.Data)
+	assert.Equal(t, "image/png", resp.Forced.ContentType)
+	assert.Equal(t, "forced@example", resp.Forced.ContentID)
+}
+
+func TestAttachmentInline(t *testing.T) {
+	srv, parts := newMTOMEchoServer(t)
+	client := NewClient(srv.URL)
+
+	req := &upload{Large: Attachment{Data: bytes.Repeat([]byte{2}, 200), Mode: AttachAlways}}
+	resp := &upload{}
+	assert.NoError(t, client.Do(context.Background(), "Upload", req, resp))
+	assert.Empty(t, *parts)
+	assert.Equal(t, req.Large.Data, resp.Large.Data)
+
+	// MTOM without any attachment to externalize sends a plain message
+	assert.NoError(t, client.Do(context.Background(), "Upload", &upload{}, resp, WithMTOM()))
+	assert.Empty(t, *parts)
+}
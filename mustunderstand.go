@@ -0,0 +1,124 @@
+package soap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the check of response headers marked mustUnderstand against the headers the application declared
+// as understood.
+
+// actorNext is the SOAP 1.1 actor of the next SOAP node, the headers targeted at the client.
+const actorNext = "http://schemas.xmlsoap.org/soap/actor/next"
+
+var (
+	// ErrNotUnderstood is returned if the response contains mustUnderstand headers not understood by the
+	// application. The returned error is a *MustUnderstandError.
+	ErrNotUnderstood = errors.New("mustUnderstand headers not understood")
+)
+
+// MustUnderstandPolicy controls the handling of response headers marked mustUnderstand that are not understood.
+type MustUnderstandPolicy int
+
+const (
+	// MustUnderstandIgnore ignores the headers. This is the default.
+	MustUnderstandIgnore MustUnderstandPolicy = iota
+	// MustUnderstandReport lists the headers in ResponseInfo.NotUnderstood.
+	MustUnderstandReport
+	// MustUnderstandReject fails the call with *MustUnderstandError, besides listing the headers in
+	// ResponseInfo.NotUnderstood.
+	MustUnderstandReject
+)
+
+// MustUnderstandError lists the response headers marked mustUnderstand that are not understood.
+type MustUnderstandError struct {
+	Headers []RawHeader
+}
+
+func (e *MustUnderstandError) Error() string {
+	names := make([]string, len(e.Headers))
+	for i, h := range e.Headers {
+		names[i] = qualifiedName(h.XMLName)
+	}
+	return fmt.Sprintf("mustUnderstand headers not understood: %s", strings.Join(names, ", "))
+}
+
+func (e *MustUnderstandError) Unwrap() error {
+	return ErrNotUnderstood
+}
+
+// CheckMustUnderstand sets the handling of response headers marked mustUnderstand that were not declared
+// with UnderstandHeaders. Headers targeted at another actor or role than the next one are exempt.
+// SOAP faults are returned regardless of the headers.
+func CheckMustUnderstand(policy MustUnderstandPolicy) Option {
+	return func(s *settings) error {
+		s.mustUnderstand = policy
+		return nil
+	}
+}
+
+// UnderstandHeaders declares the response headers named names as understood. An empty local name matches
+// all headers of the namespace. The WS-Addressing headers are understood with WithAddressing.
+func UnderstandHeaders(names ...xml.Name) Option {
+	return func(s *settings) error {
+		s.understood = append(s.understood[:len(s.understood):len(s.understood)], names...)
+		return nil
+	}
+}
+
+// notUnderstood returns the headers marked mustUnderstand for the next actor that are not understood.
+func (s *settings) notUnderstood(headers []RawHeader) []RawHeader {
+	var list []RawHeader
+	for _, h := range headers {
+		if s.understands(h.XMLName) || !mustUnderstand(s.version, h) {
+			continue
+		}
+		list = append(list, h)
+	}
+	return list
+}
+
+func (s *settings) understands(name xml.Name) bool {
+	if s.addressing != nil && name.Space == wsaNS {
+		return true
+	}
+	for _, u := range s.understood {
+		if u.Space == name.Space && (u.Local == "" || u.Local == name.Local) {
+			return true
+		}
+	}
+	return false
+}
+
+// mustUnderstand reports whether the header is marked mustUnderstand and targeted at the next actor or role.
+func mustUnderstand(v Version, h RawHeader) bool {
+	token, err := xml.NewDecoder(bytes.NewReader(h.XML)).Token()
+	if err != nil {
+		return false
+	}
+	start, ok := token.(xml.StartElement)
+	if !ok {
+		return false
+	}
+	marked := false
+	for _, attr := range start.Attr {
+		if attr.Name.Space != v.namespace() {
+			continue
+		}
+		switch attr.Name.Local {
+		case "mustUnderstand":
+			marked = attr.Value == "1" || attr.Value == "true"
+		case "actor", "role":
+			switch attr.Value {
+			case "", actorNext, soap12EnvNS + "/role/next", soap12EnvNS + "/role/ultimateReceiver":
+			default:
+				return false
+			}
+		}
+	}
+	return marked
+}
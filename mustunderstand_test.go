@@ -0,0 +1,76 @@
+package soap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const mustUnderstandResponse = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+	<soap:Header>
+		<s:Session xmlns:s="urn:session" soap:mustUnderstand="1">abc</s:Session>
+		<s:Trace xmlns:s="urn:session">t1</s:Trace>
+		<p:Proxy xmlns:p="urn:proxy" soap:mustUnderstand="1" soap:actor="urn:proxy:node">x</p:Proxy>
+		<n:Next xmlns:n="urn:next" soap:mustUnderstand="true" soap:actor="http://schemas.xmlsoap.org/soap/actor/next">y</n:Next>
+	</soap:Header>
+	<soap:Body>
+		<GetInfoResponse xmlns="urn:test"><Item>a</Item></GetInfoResponse>
+	</soap:Body>
+</soap:Envelope>`
+
+func TestCheckMustUnderstand(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []Option
+		notUnderstood []xml.Name
+		err           bool
+	}{
+		{name: "ignored"},
+		{
+			name:          "reported",
+			opts:          []Option{CheckMustUnderstand(MustUnderstandReport)},
+			notUnderstood: []xml.Name{{Space: "urn:session", Local: "Session"}, {Space: "urn:next", Local: "Next"}},
+		},
+		{
+			name:          "rejected",
+			opts:          []Option{CheckMustUnderstand(MustUnderstandReject), UnderstandHeaders(xml.Name{Space: "urn:next", Local: "Next"})},
+			notUnderstood: []xml.Name{{Space: "urn:session", Local: "Session"}},
+			err:           true,
+		},
+		{
+			name: "namespace understood",
+			opts: []Option{CheckMustUnderstand(MustUnderstandReject), UnderstandHeaders(xml.Name{Space: "urn:session"}),
+				UnderstandHeaders(xml.Name{Space: "urn:next", Local: "Next"})},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInfoServer(t, "text/xml", mustUnderstandResponse)
+			var info ResponseInfo
+			resp := &infoResponse{}
+			err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, resp,
+				append(tt.opts, WithResponseInfo(&info))...)
+
+			var names []xml.Name
+			for _, h := range info.NotUnderstood {
+				names = append(names, h.XMLName)
+			}
+			assert.Equal(t, tt.notUnderstood, names)
+			if !tt.err {
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"a"}, resp.Items)
+				return
+			}
+			var muErr *MustUnderstandError
+			if assert.ErrorAs(t, err, &muErr) {
+				assert.ErrorIs(t, err, ErrNotUnderstood)
+				assert.Equal(t, info.NotUnderstood, muErr.Headers)
+				assert.Contains(t, string(muErr.Headers[0].XML), ">abc</")
+				assert.Equal(t, "mustUnderstand headers not understood: {urn:session}Session", err.Error())
+			}
+		})
+	}
+}
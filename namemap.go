@@ -0,0 +1,206 @@
+package soap
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+// WithElementNameMapper renames the elements of response envelopes before they are matched against the
+// struct tags, e.g. with CaseInsensitiveMapper for servers varying the casing of element names. The mapper
+// is called with the namespace and local name of every start element. Mapping an element into another
+// namespace declares it on the element, mapping it into no namespace keeps its namespace.
+//
+// The renaming wraps the byte stream of the envelope, so it applies to custom decoders and any other
+// reader wrappers as well and innerxml fields such as fault details see the renamed elements.
+func WithElementNameMapper(mapper func(xml.Name) xml.Name) Option {
+	return func(s *settings) error {
+		s.elementNameMapper = mapper
+		return nil
+	}
+}
+
+// CaseInsensitiveMapper returns an element name mapper matching the local names of elements
+// case-insensitively against the element names in the struct tags of the given types, including the types of
+// their fields. Elements in another namespace than the tag are not renamed, tags without namespace match
+// elements of any namespace.
+func CaseInsensitiveMapper(types ...any) func(xml.Name) xml.Name {
+	known := map[string][]xml.Name{}
+	seen := map[reflect.Type]bool{}
+	for _, v := range types {
+		collectElementNames(reflect.TypeOf(v), known, seen)
+	}
+	return func(name xml.Name) xml.Name {
+		for _, k := range known[strings.ToLower(name.Local)] {
+			if k.Space == "" || k.Space == name.Space {
+				return xml.Name{Space: name.Space, Local: k.Local}
+			}
+		}
+		return name
+	}
+}
+
+// collectElementNames adds the element names of the struct tags of t to known, by lower-case local name.
+func collectElementNames(t reflect.Type, known map[string][]xml.Name, seen map[reflect.Type]bool) {
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+	add := func(name xml.Name) {
+		key := strings.ToLower(name.Local)
+		known[key] = append(known[key], name)
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("xml")
+		if tag == "-" || !f.IsExported() && !f.Anonymous {
+			continue
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		if strings.Contains(flags, "attr") || strings.Contains(flags, "chardata") ||
+			strings.Contains(flags, "innerxml") || strings.Contains(flags, "comment") {
+			continue
+		}
+		space, local := "", name
+		if parts := strings.Fields(name); len(parts) == 2 {
+			space, local = parts[0], parts[1]
+		}
+		switch {
+		case f.Anonymous && name == "":
+			// the fields of embedded structs are promoted
+		case local != "":
+			for _, l := range strings.Split(local, ">") {
+				if l != "" {
+					add(xml.Name{Space: space, Local: l})
+				}
+			}
+		case f.Name != xmlName && !strings.Contains(flags, "any"):
+			add(xml.Name{Local: f.Name})
+		}
+		collectElementNames(f.Type, known, seen)
+	}
+}
+
+// mapNames wraps rd to rename its elements with the configured element name mapper.
+func (s *settings) mapNames(rd io.Reader) io.Reader {
+	if s.elementNameMapper == nil {
+		return rd
+	}
+	nm := &nameMapReader{src: rd, mapper: s.elementNameMapper}
+	nm.dec = xml.NewDecoder(io.TeeReader(rd, &nm.raw))
+	nm.dec.Entity = s.entities
+	return nm
+}
+
+// nameMapReader rewrites the names in the start and end tags of the XML read from src. The tokens are
+// decoded to resolve the namespaces, the bytes of every tag are copied from the input, so everything besides
+// the renamed tags stays as it was. Input that fails to decode is passed on unchanged from the point of the
+// error, leaving it to the decoder reading the result to report it.
+type nameMapReader struct {
+	src    io.Reader
+	dec    *xml.Decoder
+	mapper func(xml.Name) xml.Name
+	// raw holds the input the decoder read, starting at offset base
+	raw  bytes.Buffer
+	base int64
+	out  bytes.Buffer
+	// ends holds the rewritten end tags of the open elements, empty if an element keeps its name
+	ends     []string
+	prefixes int
+	done     bool
+}
+
+func (r *nameMapReader) Read(p []byte) (int, error) {
+	for r.out.Len() == 0 {
+		if r.done {
+			return r.src.Read(p)
+		}
+		r.next()
+	}
+	return r.out.Read(p)
+}
+
+// next moves the bytes of the next token from raw to out.
+func (r *nameMapReader) next() {
+	tok, err := r.dec.Token()
+	if err != nil {
+		// pass the rest on unchanged, the decoder read everything up to here through raw
+		r.out.Write(r.raw.Bytes())
+		r.raw.Reset()
+		r.done = true
+		return
+	}
+	span := r.raw.Next(int(r.dec.InputOffset() - r.base))
+	r.base = r.dec.InputOffset()
+	switch tok := tok.(type) {
+	case xml.StartElement:
+		mapped := r.mapper(tok.Name)
+		if mapped.Space == "" {
+			mapped.Space = tok.Name.Space
+		}
+		if mapped == tok.Name {
+			r.out.Write(span)
+			r.ends = append(r.ends, "")
+			break
+		}
+		qname, decl := r.qualify(span, tok.Name, mapped)
+		r.out.WriteByte('<')
+		r.out.WriteString(qname + decl)
+		r.out.Write(span[1+tagNameLength(span[1:]):])
+		r.ends = append(r.ends, "</"+qname+">")
+		if len(span) > 1 && span[len(span)-2] == '/' {
+			// a self-closing element has no end tag to rewrite
+			r.ends[len(r.ends)-1] = ""
+		}
+	case xml.EndElement:
+		end := ""
+		if len(r.ends) > 0 {
+			end = r.ends[len(r.ends)-1]
+			r.ends = r.ends[:len(r.ends)-1]
+		}
+		if end != "" && len(span) > 0 {
+			r.out.WriteString(end)
+		} else {
+			r.out.Write(span)
+		}
+	default:
+		r.out.Write(span)
+	}
+}
+
+// qualify returns the qualified name of the renamed element and the declaration of its namespace, if it
+// moved into another one.
+func (r *nameMapReader) qualify(span []byte, name, mapped xml.Name) (string, string) {
+	if mapped.Space == name.Space {
+		qname := string(span[1 : 1+tagNameLength(span[1:])])
+		if i := strings.IndexByte(qname, ':'); i >= 0 {
+			return qname[:i+1] + mapped.Local, ""
+		}
+		return mapped.Local, ""
+	}
+	r.prefixes++
+	prefix := "nm" + strconv.Itoa(r.prefixes)
+	return prefix + ":" + mapped.Local, ` xmlns:` + prefix + `="` + escapeAttr(mapped.Space) + `"`
+}
+
+// tagNameLength returns the length of the name at the start of a tag.
+func tagNameLength(b []byte) int {
+	i := bytes.IndexAny(b, " \t\r\n/>")
+	if i < 0 {
+		return len(b)
+	}
+	return i
+}
+
+func escapeAttr(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
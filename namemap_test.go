@@ -0,0 +1,89 @@
+package soap
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNameMapReader(t *testing.T) {
+	upper := func(name xml.Name) xml.Name {
+		if name.Local == "id" {
+			return xml.Name{Local: "ID"}
+		}
+		if name.Local == "moved" {
+			return xml.Name{Space: "urn:new", Local: "Moved"}
+		}
+		return name
+	}
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "unchanged", input: `<a x="1"><!-- c --><b>t</b></a>`, want: `<a x="1"><!-- c --><b>t</b></a>`},
+		{name: "local name", input: `<a><id>1</id><id/></a>`, want: `<a><ID>1</ID><ID/></a>`},
+		{name: "prefixed", input: `<p:a xmlns:p="urn:p"><p:id  a="1" >1</p:id ></p:a>`, want: `<p:a xmlns:p="urn:p"><p:ID  a="1" >1</p:ID></p:a>`},
+		{name: "namespace", input: `<a><moved>1</moved></a>`, want: `<a><nm1:Moved xmlns:nm1="urn:new">1</nm1:Moved></a>`},
+		{name: "malformed", input: `<a><id>1</b></a>`, want: `<a><ID>1</b></a>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := settings{elementNameMapper: upper}
+			got, err := io.ReadAll(s.mapNames(strings.NewReader(tt.input)))
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+}
+
+type orderResponse struct {
+	XMLName xml.Name `xml:"urn:orders GetOrderResponse"`
+	OrderID string   `xml:"OrderID"`
+	Lines   []struct {
+		ItemNo string `xml:"ItemNo"`
+	} `xml:"Lines>Line"`
+}
+
+func TestCaseInsensitiveMapper(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+		`<o:getOrderResponse xmlns:o="urn:orders"><o:OrderId>42</o:OrderId><o:lines><o:LINE><o:itemNo>7</o:itemNo></o:LINE></o:lines>`+
+		`</o:getOrderResponse></soap:Body></soap:Envelope>`)
+	resp := &orderResponse{}
+	assert.NoError(t, NewClient(srv.URL).Do(context.Background(), "GetOrder", &infoRequest{}, resp,
+		WithElementNameMapper(CaseInsensitiveMapper(resp))))
+	assert.Equal(t, "42", resp.OrderID)
+	if assert.Len(t, resp.Lines, 1) {
+		assert.Equal(t, "7", resp.Lines[0].ItemNo)
+	}
+}
+
+func TestCaseInsensitiveMapperNamespace(t *testing.T) {
+	mapper := CaseInsensitiveMapper(&orderResponse{})
+	assert.Equal(t, xml.Name{Space: "urn:orders", Local: "GetOrderResponse"}, mapper(xml.Name{Space: "urn:orders", Local: "getorderresponse"}))
+	assert.Equal(t, xml.Name{Space: "urn:other", Local: "getorderresponse"}, mapper(xml.Name{Space: "urn:other", Local: "getorderresponse"}))
+	// the fields without namespace match any namespace
+	assert.Equal(t, xml.Name{Space: "urn:other", Local: "OrderID"}, mapper(xml.Name{Space: "urn:other", Local: "orderid"}))
+}
+
+func TestElementNameMapperFaultDetail(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>`+
+		`<faultcode>soap:Server</faultcode><faultstring>failed</faultstring><detail><e:errorCode xmlns:e="urn:err">E1</e:errorCode></detail>`+
+		`</soap:Fault></soap:Body></soap:Envelope>`)
+	err := NewClient(srv.URL).Do(context.Background(), "GetOrder", &infoRequest{}, &orderResponse{},
+		WithElementNameMapper(func(name xml.Name) xml.Name {
+			if name.Local == "errorCode" {
+				name.Local = "ErrorCode"
+			}
+			return name
+		}))
+	var fault *Fault
+	if assert.ErrorAs(t, err, &fault) {
+		assert.Equal(t, `<e:ErrorCode xmlns:e="urn:err">E1</e:ErrorCode>`, fault.Detail())
+	}
+}
@@ -0,0 +1,162 @@
+package soap
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/m29h/xml"
+)
+
+// WithBodyNamespace puts the root element of the request body into the namespace uri if it
+// has none, without requiring changes to the struct tags.
+//
+// Decoding needs no counterpart: unqualified struct tags match response elements of any namespace.
+func WithBodyNamespace(uri string) Option {
+	return func(s *settings) error {
+		s.bodyNamespace = uri
+		s.bodyNamespaceDeep = false
+		return nil
+	}
+}
+
+// WithQualifiedBodyNamespace puts the root element of the request body and all its unqualified
+// descendants into the namespace uri, as required by schemas with elementFormDefault="qualified".
+func WithQualifiedBodyNamespace(uri string) Option {
+	return func(s *settings) error {
+		s.bodyNamespace = uri
+		s.bodyNamespaceDeep = true
+		return nil
+	}
+}
+
+// qualifiedContent marshals content with unqualified elements moved into a namespace.
+type qualifiedContent struct {
+	content any
+	ns      string
+	deep    bool
+}
+
+// MarshalXML re-encodes the marshaled content token by token and assigns the namespace on the way. The
+// content is marshaled with the MTOM, gzip and enum configuration of e. The encoder puts unqualified elements
+// into the namespace of their parent, so elements that have to stay unqualified below a qualified parent get
+// an explicit xmlns="" declaration. The declarations of the prefixes the names of an element use are recreated
+// by the encoder, the other ones are kept for attribute values referring to them, like the ones of xsi:type.
+func (q *qualifiedContent) MarshalXML(e *xml.Encoder, _ xml.StartElement) error {
+	var b bytes.Buffer
+	inner := xml.NewEncoder(&b)
+	defer registerLike(inner, e)()
+	if err := inner.Encode(q.content); err != nil {
+		return err
+	}
+	if err := inner.Flush(); err != nil {
+		return err
+	}
+	d := xml.NewDecoder(&b)
+	var spaces []string
+	var scopes []map[string]string
+	for {
+		t, err := d.RawToken()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			scope := map[string]string{}
+			used := map[string]bool{t.Name.Space: true}
+			for _, a := range t.Attr {
+				if a.Name.Space == "xmlns" {
+					scope[a.Name.Local] = a.Value
+				} else if a.Name.Space == "" && a.Name.Local == "xmlns" {
+					scope[""] = a.Value
+				} else {
+					used[a.Name.Space] = true
+				}
+			}
+			scopes = append(scopes, scope)
+			attrs := make([]xml.Attr, 0, len(t.Attr))
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns" && !used[a.Name.Local]:
+					attrs = append(attrs, xml.Attr{Name: xml.Name{Local: "xmlns:" + a.Name.Local}, Value: a.Value})
+				case a.Name.Space == "xmlns" || (a.Name.Space == "" && a.Name.Local == "xmlns"):
+				case a.Name.Space != "":
+					a.Name.Space = resolvePrefix(scopes, a.Name.Space)
+					attrs = append(attrs, a)
+				default:
+					attrs = append(attrs, a)
+				}
+			}
+			t.Name.Space = resolvePrefix(scopes, t.Name.Space)
+			if t.Name.Space == "" && (len(spaces) == 0 || q.deep) {
+				t.Name.Space = q.ns
+			}
+			if t.Name.Space == "" && len(spaces) > 0 && spaces[len(spaces)-1] != "" {
+				attrs = append([]xml.Attr{{Name: xml.Name{Local: "xmlns"}}}, attrs...)
+			}
+			t.Attr = attrs
+			spaces = append(spaces, t.Name.Space)
+			err = e.EncodeToken(t)
+		case xml.EndElement:
+			t.Name.Space = spaces[len(spaces)-1]
+			spaces = spaces[:len(spaces)-1]
+			scopes = scopes[:len(scopes)-1]
+			err = e.EncodeToken(t)
+		case xml.CharData, xml.Comment:
+			err = e.EncodeToken(t)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// resolvePrefix returns the namespace the prefix is declared for in the innermost of scopes, the default
+// namespace for the empty prefix. Undeclared prefixes are returned as they are.
+func resolvePrefix(scopes []map[string]string, prefix string) string {
+	if prefix == "xml" {
+		return "http://www.w3.org/XML/1998/namespace"
+	}
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if ns, ok := scopes[i][prefix]; ok {
+			return ns
+		}
+	}
+	return prefix
+}
+
+// registerLike makes the MTOM, gzip and enum configuration registered for like apply to enc until the
+// returned function is called.
+func registerLike(enc, like *xml.Encoder) func() {
+	var undo []func()
+	if w, ok := mtomWriters.Load(like); ok {
+		mtomWriters.Store(enc, w)
+		undo = append(undo, func() { mtomWriters.Delete(enc) })
+	}
+	if config, ok := gzipConfigs.Load(like); ok {
+		config := config.(gzipConfig)
+		undo = append(undo, registerGzip(enc, &config))
+	}
+	if config, ok := enumPolicies.Load(like); ok {
+		config := config.(enumConfig)
+		undo = append(undo, registerEnums(enc, &config))
+	}
+	return func() {
+		for _, f := range undo {
+			f()
+		}
+	}
+}
+
+// qualifyBody applies the configured body namespace to the content of the envelope body.
+func (s *settings) qualifyBody(body *Body) {
+	if s.bodyNamespace == "" {
+		return
+	}
+	for i, c := range body.Content {
+		if c != nil {
+			body.Content[i] = &qualifiedContent{content: c, ns: s.bodyNamespace, deep: s.bodyNamespaceDeep}
+		}
+	}
+}
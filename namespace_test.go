@@ -0,0 +1,115 @@
+package soap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type unqualifiedQuote struct {
+	XMLName xml.Name `xml:"GetQuote"`
+	Symbol  string   `xml:"Symbol"`
+	Market  *struct {
+		Name string `xml:"name,attr"`
+	} `xml:"Market"`
+}
+
+func TestBodyNamespace(t *testing.T) {
+	req := &unqualifiedQuote{Symbol: "ACME & Co"}
+	req.Market = &struct {
+		Name string `xml:"name,attr"`
+	}{Name: "NYSE"}
+
+	var tests = []struct {
+		name string
+		opt  Option
+		body string
+	}{
+		{
+			// unqualified elements inherit the namespace of the enclosing Body
+			name: "none",
+			opt:  nil,
+			body: `<soapenv:GetQuote><soapenv:Symbol>ACME &amp; Co</soapenv:Symbol><soapenv:Market name="NYSE"></soapenv:Market></soapenv:GetQuote>`,
+		},
+		{
+			name: "root",
+			opt:  WithBodyNamespace("http://example.com/svc"),
+			body: `<svc:GetQuote xmlns:svc="http://example.com/svc"><Symbol xmlns="">ACME &amp; Co</Symbol><Market xmlns="" name="NYSE"></Market></svc:GetQuote>`,
+		},
+		{
+			name: "qualified",
+			opt:  WithQualifiedBodyNamespace("http://example.com/svc"),
+			body: `<svc:GetQuote xmlns:svc="http://example.com/svc"><svc:Symbol>ACME &amp; Co</svc:Symbol><svc:Market name="NYSE"></svc:Market></svc:GetQuote>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, captured := newCaptureServer(t)
+			err := NewClient(srv.URL).Do(context.Background(), "GetQuote", req, &quirksResponse{}, tt.opt)
+			assert.NoError(t, err)
+			assert.Equal(t, `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body>`+tt.body+`</soapenv:Body></soapenv:Envelope>`, (*captured)[0].body)
+		})
+	}
+}
+
+func TestBodyNamespaceKeepsQualifiedElements(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &quirksResponse{},
+		WithQualifiedBodyNamespace("http://example.com/svc"))
+	assert.NoError(t, err)
+	assert.Contains(t, (*captured)[0].body, `<_:GetInfo xmlns:_="urn:test"></_:GetInfo>`)
+}
+
+func TestUnqualifiedResponseStructs(t *testing.T) {
+	resp := &struct {
+		XMLName xml.Name `xml:"GetQuoteResponse"`
+		Price   string   `xml:"Price"`
+	}{}
+	err := UnmarshalResponse([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><svc:GetQuoteResponse xmlns:svc="http://example.com/svc"><svc:Price>1.5</svc:Price></svc:GetQuoteResponse></soap:Body></soap:Envelope>`), resp)
+	assert.NoError(t, err)
+	assert.Equal(t, "1.5", resp.Price)
+}
+
+type unqualifiedUpload struct {
+	XMLName xml.Name   `xml:"Upload"`
+	Data    Attachment `xml:"Data"`
+}
+
+func TestBodyNamespaceMTOM(t *testing.T) {
+	srv, parts := newMTOMEchoServer(t)
+	client := NewClient(srv.URL)
+	req := &unqualifiedUpload{Data: Attachment{Data: []byte("attached"), Mode: AttachAlways, ContentID: "data@example"}}
+	resp := &unqualifiedUpload{}
+	err := client.Do(context.Background(), "Upload", req, resp, WithBodyNamespace("http://example.com/svc"), WithMTOM())
+	require.NoError(t, err)
+	require.Len(t, *parts, 2)
+	assert.Contains(t, string((*parts)[0]),
+		`<svc:Upload xmlns:svc="http://example.com/svc"><Data xmlns=""><include:Include`)
+	assert.Equal(t, []byte("attached"), (*parts)[1])
+	assert.Equal(t, []byte("attached"), resp.Data.Data)
+}
+
+type typedQuote struct {
+	XMLName xml.Name `xml:"GetQuote"`
+	Price   struct {
+		Types string `xml:"xmlns:tns,attr"`
+		Type  string `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+		Value string `xml:",chardata"`
+	} `xml:"Price"`
+}
+
+func TestBodyNamespaceKeepsPrefixDeclarations(t *testing.T) {
+	req := &typedQuote{}
+	req.Price.Types, req.Price.Type, req.Price.Value = "urn:types", "tns:Decimal", "1.5"
+	srv, captured := newCaptureServer(t)
+	err := NewClient(srv.URL).Do(context.Background(), "GetQuote", req, &quirksResponse{},
+		WithQualifiedBodyNamespace("http://example.com/svc"))
+	require.NoError(t, err)
+	// the prefix of the xsi:type value stays declared
+	assert.Contains(t, (*captured)[0].body, `<svc:Price xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" `+
+		`xmlns:tns="urn:types" xsi:type="tns:Decimal">1.5</svc:Price>`)
+}
@@ -0,0 +1,156 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/m29h/xml"
+)
+
+// Option configures optional client behaviour. Options set via Client.SetOptions apply to every call made
+// with the client, options passed to Client.Do only apply to that single call.
+type Option func(*settings) error
+
+// settings is the collection of optional behaviour configured through Option values.
+type settings struct {
+	info    *ResponseInfo
+	metrics MetricsHook
+
+	urlVars          map[string]string
+	httpMethod       string
+	actionQueryParam string
+
+	actionFormat   func(action string) string
+	actionResolver func(request any) string
+	emptyElements  EmptyElementForm
+	hoistPrefixes  bool
+
+	newDecoder        func(io.Reader) SOAPDecoder
+	elementNameMapper func(xml.Name) xml.Name
+	newEncoder        func(io.Writer) SOAPEncoder
+
+	retry                 *RetryPolicy
+	retryObserver         RetryObserver
+	idempotentActions     map[string]bool
+	isIdempotent          func(action string) bool
+	idempotencyKey        bool
+	idempotencyHeader     string
+	idempotencySOAPHeader func(key string) any
+
+	correlationHeader     string
+	correlationGen        func(ctx context.Context) string
+	correlationSOAPHeader func(id string) any
+
+	uploadProgress   ProgressFunc
+	downloadProgress ProgressFunc
+	progressRate     int
+
+	logger           *slog.Logger
+	sendHooks        []SendHook
+	requestValidator func(action string, request any) error
+	actionPolicies   []ActionPolicy
+	dedup            *dedupGuard
+	dedupModes       map[string]DedupMode
+	defaultDedupMode DedupMode
+
+	bodyNamespace     string
+	bodyNamespaceDeep bool
+
+	continueOnFieldErrors  bool
+	strictSequence         bool
+	formatTags             bool
+	entities               map[string]string
+	replaceUnknownEntities bool
+	replaceInvalidChars    bool
+	responseTee            func(ctx context.Context, action string) io.WriteCloser
+	compressedTee          bool
+	drift                  *DriftDetector
+	flightRecorder         *flightRecorder
+	// decodeBuffer receives the envelope kept by the default decoder instead of a new buffer, see Paginate
+	decodeBuffer *bytes.Buffer
+
+	codec Codec
+
+	maxRequestBytes    int64
+	maxAttachmentBytes int64
+
+	transport    transportSettings
+	hostOverride string
+
+	faultClassifier FaultClassifier
+	circuitBreaker  CircuitBreaker
+	reauthenticate  func(ctx context.Context) error
+	session         *sessionState
+
+	headerBuilders   []ContextHeaderBuilder
+	headerOrder      func(a, b xml.Name) int
+	duplicateHeaders DuplicateHeaderPolicy
+	headerPresence   HeaderPresence
+	addressing       *AddressingOptions
+	messageID        string
+
+	version       Version
+	autoNegotiate bool
+
+	mtom          bool
+	mtomThreshold int
+	// packaging holds the packaging of actions, defaultPackaging the one of the others if set
+	packaging        map[string]Packaging
+	defaultPackaging Packaging
+	attachments      *Attachments
+	digests          *digestConfig
+
+	lenientFaults bool
+	strictFaults  bool
+	languages     []string
+	compiled      compiledDecoder
+
+	responseVerification *VerifyOptions
+	confirmSignatures    bool
+
+	expectBodyElement *xml.Name
+	assertBodyElement bool
+
+	mustUnderstand MustUnderstandPolicy
+	understood     []xml.Name
+
+	clock             Clock
+	serverClockOffset time.Duration
+
+	sanitize SanitizeMode
+
+	retryAfter RetryAfterFunc
+	limiter    RateLimiter
+
+	gzip  *gzipConfig
+	enums *enumConfig
+
+	warmup WarmupMode
+
+	dynamicNamespaces bool
+}
+
+// apply runs all opts against a copy of the settings s and returns the copy.
+func (s settings) apply(opts ...Option) (settings, error) {
+	for _, opt := range opts {
+		if opt == nil {
+			continue
+		}
+		if err := opt(&s); err != nil {
+			return s, err
+		}
+	}
+	if s.responseVerification != nil && s.newDecoder != nil {
+		return s, fmt.Errorf("%w: response verification needs the default decoder", ErrCodecOption)
+	}
+	return s, nil
+}
+
+// instrumented reports whether per-call statistics have to be collected.
+func (s *settings) instrumented() bool {
+	return s.info != nil || s.metrics != nil || s.logger != nil || s.retryObserver != nil
+}
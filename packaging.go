@@ -0,0 +1,78 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrAttachmentPackaging is returned by calls of actions sent as plain XML with attachments to be sent
+	// as MIME parts. The returned error is a *PackagingError.
+	ErrAttachmentPackaging = errors.New("attachment in plain XML request")
+)
+
+// Packaging selects how the requests of an action with Attachment values are sent.
+type Packaging int
+
+const (
+	// PackagePlain sends the requests as plain XML envelopes. Attachments are only allowed inline, with
+	// AttachNever or below the MTOMThreshold, others fail the call with *PackagingError before it is sent.
+	PackagePlain Packaging = iota + 1
+	// PackageMTOM sends the requests as MTOM multipart messages, like WithMTOM.
+	PackageMTOM
+)
+
+// PackagingError reports an attachment that would be sent as MIME part in a request sent as plain XML.
+type PackagingError struct {
+	Action string
+	// Element is the name of the element of the attachment.
+	Element string
+}
+
+func (e *PackagingError) Error() string {
+	return fmt.Sprintf("%s: element %s of action %s needs MTOM; send the action with PackageMTOM or the attachment with AttachNever",
+		ErrAttachmentPackaging, e.Element, e.Action)
+}
+
+func (e *PackagingError) Unwrap() error {
+	return ErrAttachmentPackaging
+}
+
+// WithPackaging sends the requests of the actions with packaging p, for services mixing MTOM and plain XML
+// operations. Without actions p is the default of all actions not given a packaging, taking precedence over
+// WithMTOM. Calls of actions without packaging are sent with MTOM if WithMTOM is set and as plain XML with
+// the attachments inline otherwise. Like WithMTOM it requires the default encoder.
+func WithPackaging(p Packaging, actions ...string) Option {
+	return func(s *settings) error {
+		if p != PackagePlain && p != PackageMTOM {
+			return fmt.Errorf("unknown packaging %d", p)
+		}
+		if len(actions) == 0 {
+			s.defaultPackaging = p
+			return nil
+		}
+		packaging := make(map[string]Packaging, len(s.packaging)+len(actions))
+		for a, p := range s.packaging {
+			packaging[a] = p
+		}
+		for _, a := range actions {
+			packaging[a] = p
+		}
+		s.packaging = packaging
+		return nil
+	}
+}
+
+// packagingOf returns the packaging of the requests of action, 0 for plain XML with inline attachments.
+func (s *settings) packagingOf(action string) Packaging {
+	if p, ok := s.packaging[action]; ok {
+		return p
+	}
+	if s.defaultPackaging != 0 {
+		return s.defaultPackaging
+	}
+	if s.mtom {
+		return PackageMTOM
+	}
+	return 0
+}
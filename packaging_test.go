@@ -0,0 +1,76 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackaging(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 1000)
+	var tests = []struct {
+		name   string
+		opts   []Option
+		action string
+		parts  int
+		err    bool
+	}{
+		{name: "default inline", action: "Upload"},
+		{name: "mtom action", opts: []Option{WithPackaging(PackageMTOM, "Upload")}, action: "Upload", parts: 2},
+		{name: "other action", opts: []Option{WithPackaging(PackageMTOM, "Upload")}, action: "Other"},
+		{name: "plain action", opts: []Option{WithMTOM(), WithPackaging(PackagePlain, "Other")}, action: "Other", err: true},
+		{name: "mtom default", opts: []Option{WithMTOM(), WithPackaging(PackagePlain, "Other")}, action: "Upload", parts: 2},
+		{name: "plain default", opts: []Option{WithMTOM(), WithPackaging(PackagePlain), WithPackaging(PackageMTOM, "Upload")},
+			action: "Other", err: true},
+		{name: "plain default mtom action", opts: []Option{WithPackaging(PackagePlain), WithPackaging(PackageMTOM, "Upload")},
+			action: "Upload", parts: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, parts := newMTOMEchoServer(t)
+			client := NewClient(srv.URL)
+			require.NoError(t, client.SetOptions(tt.opts...))
+
+			req := &upload{Large: Attachment{Data: data}, Forced: Attachment{Data: []byte("f"), Mode: AttachAlways}}
+			resp := &upload{}
+			err := client.Do(context.Background(), tt.action, req, resp)
+			if tt.err {
+				var packagingErr *PackagingError
+				require.ErrorAs(t, err, &packagingErr)
+				assert.ErrorIs(t, err, ErrAttachmentPackaging)
+				assert.Equal(t, tt.action, packagingErr.Action)
+				assert.Equal(t, "Large", packagingErr.Element)
+				assert.Nil(t, *parts, "nothing sent")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, data, resp.Large.Data)
+			if tt.parts == 0 {
+				assert.Empty(t, *parts)
+			} else {
+				// the root part and the attachments
+				assert.Len(t, *parts, tt.parts+1)
+			}
+		})
+	}
+}
+
+func TestPackagingPlainInline(t *testing.T) {
+	srv, parts := newMTOMEchoServer(t)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithPackaging(PackagePlain), MTOMThreshold(100)))
+
+	req := &upload{Small: Attachment{Data: []byte("small")}, Large: Attachment{Data: bytes.Repeat([]byte("x"), 1000), Mode: AttachNever}}
+	resp := &upload{}
+	require.NoError(t, client.Do(context.Background(), "Upload", req, resp))
+	assert.Empty(t, *parts)
+	assert.Equal(t, req.Large.Data, resp.Large.Data)
+	assert.Equal(t, []byte("small"), resp.Small.Data)
+}
+
+func TestPackagingInvalid(t *testing.T) {
+	assert.Error(t, NewClient("http://localhost").SetOptions(WithPackaging(0)))
+}
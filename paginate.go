@@ -0,0 +1,84 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrPageLimit is returned by Paginate if the service still has more pages after the limit set with
+	// MaxPages.
+	ErrPageLimit = errors.New("page limit reached")
+)
+
+// PageOption configures Paginate.
+type PageOption func(*pageSettings)
+
+type pageSettings struct {
+	maxPages int
+	options  []Option
+}
+
+// MaxPages stops the pagination with ErrPageLimit after n pages, to guard against services repeating the
+// same cursor. There is no limit by default.
+func MaxPages(n int) PageOption {
+	return func(s *pageSettings) {
+		s.maxPages = n
+	}
+}
+
+// PageOptions applies opts to the call of every page.
+func PageOptions(opts ...Option) PageOption {
+	return func(s *pageSettings) {
+		s.options = append(s.options, opts...)
+	}
+}
+
+// Paginate calls action with first and then with the requests returned by next for the following pages, until
+// next reports done or returns a nil request. Every page is passed to yield before next is called with it.
+// It returns the number of pages passed to yield.
+//
+// The pagination stops with the error of the call of a page, wrapped with the number of the page, with the
+// error returned by yield and with the error of ctx once it is done. The response value and the buffer the
+// envelope is read into are reused for all pages, so the response passed to yield and next is only valid
+// until they return; copy what is retained.
+func Paginate[Req, Resp any](ctx context.Context, client *Client, action string, first *Req,
+	next func(resp *Resp) (nextReq *Req, done bool), yield func(resp *Resp) error, opts ...PageOption) (int, error) {
+	var s pageSettings
+	for _, opt := range opts {
+		opt(&s)
+	}
+	buf := &bytes.Buffer{}
+	callOpts := append(s.options[:len(s.options):len(s.options)], func(s *settings) error {
+		s.decodeBuffer = buf
+		return nil
+	})
+
+	resp := new(Resp)
+	req := first
+	pages := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return pages, err
+		}
+		if s.maxPages > 0 && pages >= s.maxPages {
+			return pages, ErrPageLimit
+		}
+		var zero Resp
+		*resp = zero
+		if err := client.Do(ctx, action, req, resp, callOpts...); err != nil {
+			return pages, fmt.Errorf("page %d: %w", pages+1, err)
+		}
+		if err := yield(resp); err != nil {
+			return pages, err
+		}
+		pages++
+		nextReq, done := next(resp)
+		if done || nextReq == nil {
+			return pages, nil
+		}
+		req = nextReq
+	}
+}
@@ -0,0 +1,176 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type listRequest struct {
+	XMLName xml.Name `xml:"urn:test ListItems"`
+	Cursor  string   `xml:"Cursor,omitempty"`
+}
+
+type listResponse struct {
+	XMLName       xml.Name `xml:"urn:test ListItemsResponse"`
+	Items         []string `xml:"Item"`
+	MoreAvailable bool     `xml:"MoreAvailable"`
+	Cursor        string   `xml:"Cursor"`
+}
+
+var listCursor = regexp.MustCompile(`Cursor>(\d+)<`)
+
+// newListServer serves pages of two items, the cursor is the number of the next page. The page named by fault
+// is answered with a fault, after the last page MoreAvailable is false. It records the cursors received.
+func newListServer(t *testing.T, last, fault int) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var cursors []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		page := 1
+		if m := listCursor.FindStringSubmatch(string(body)); m != nil {
+			page, _ = strconv.Atoi(m[1])
+			mu.Lock()
+			cursors = append(cursors, m[1])
+			mu.Unlock()
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		if page == fault {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>`+
+				`<faultcode>soap:Server</faultcode><faultstring>cursor expired</faultstring></soap:Fault></soap:Body></soap:Envelope>`)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<ListItemsResponse xmlns="urn:test"><Item>%[1]d-a</Item><Item>%[1]d-b</Item>`+
+			`<MoreAvailable>%[2]t</MoreAvailable><Cursor>%[3]d</Cursor></ListItemsResponse></soap:Body></soap:Envelope>`,
+			page, last == 0 || page < last, page+1)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return cursors
+	}
+}
+
+func nextPage(resp *listResponse) (*listRequest, bool) {
+	return &listRequest{Cursor: resp.Cursor}, !resp.MoreAvailable
+}
+
+func TestPaginate(t *testing.T) {
+	srv, cursors := newListServer(t, 3, 0)
+	var items []string
+	pages, err := Paginate(context.Background(), NewClient(srv.URL), "ListItems", &listRequest{}, nextPage,
+		func(resp *listResponse) error {
+			// the items of the previous page are not kept in the reused response
+			assert.Len(t, resp.Items, 2)
+			items = append(items, resp.Items...)
+			return nil
+		})
+	require.NoError(t, err)
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []string{"1-a", "1-b", "2-a", "2-b", "3-a", "3-b"}, items)
+	assert.Equal(t, []string{"2", "3"}, cursors())
+}
+
+func TestPaginateStops(t *testing.T) {
+	errStop := errors.New("stop")
+	tests := []struct {
+		name  string
+		fault int
+		// stopAt is the page yield fails at
+		stopAt int
+		opts   []PageOption
+		pages  int
+		check  func(t *testing.T, err error)
+	}{
+		{
+			name:  "page limit",
+			opts:  []PageOption{MaxPages(4)},
+			pages: 4,
+			check: func(t *testing.T, err error) { assert.ErrorIs(t, err, ErrPageLimit) },
+		},
+		{
+			name:  "fault",
+			fault: 3,
+			pages: 2,
+			check: func(t *testing.T, err error) {
+				var fault *Fault
+				assert.ErrorAs(t, err, &fault)
+				assert.ErrorContains(t, err, "page 3: ")
+			},
+		},
+		{
+			name:   "yield error",
+			stopAt: 2,
+			pages:  1,
+			check:  func(t *testing.T, err error) { assert.ErrorIs(t, err, errStop) },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newListServer(t, 0, tt.fault)
+			seen := 0
+			pages, err := Paginate(context.Background(), NewClient(srv.URL), "ListItems", &listRequest{}, nextPage,
+				func(resp *listResponse) error {
+					if seen++; seen == tt.stopAt {
+						return errStop
+					}
+					return nil
+				}, tt.opts...)
+			tt.check(t, err)
+			assert.Equal(t, tt.pages, pages)
+		})
+	}
+}
+
+func TestPaginateCanceled(t *testing.T) {
+	srv, cursors := newListServer(t, 0, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pages, err := Paginate(ctx, NewClient(srv.URL), "ListItems", &listRequest{}, nextPage,
+		func(resp *listResponse) error {
+			if resp.Cursor == "3" {
+				cancel()
+			}
+			return nil
+		})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 2, pages)
+	assert.Equal(t, []string{"2"}, cursors())
+}
+
+func TestPaginateOptions(t *testing.T) {
+	srv, _ := newListServer(t, 2, 0)
+	sent := 0
+	pages, err := Paginate(context.Background(), NewClient(srv.URL), "ListItems", &listRequest{}, nextPage,
+		func(resp *listResponse) error { return nil },
+		PageOptions(WithSendHook(func(ctx context.Context, req *OutgoingRequest) error {
+			sent++
+			return nil
+		})))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pages)
+	assert.Equal(t, 2, sent)
+}
+
+func TestPaginateNilRequest(t *testing.T) {
+	srv, _ := newListServer(t, 0, 0)
+	pages, err := Paginate(context.Background(), NewClient(srv.URL), "ListItems", &listRequest{},
+		func(resp *listResponse) (*listRequest, bool) { return nil, false },
+		func(resp *listResponse) error { return nil })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pages)
+}
@@ -0,0 +1,103 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrPartialFailure is returned if the response reports that some items of a batch operation failed.
+	// The returned error is a *PartialFailureError.
+	ErrPartialFailure = errors.New("some items failed")
+	// ErrPartialResponse is returned if the response body holds a fault along with response content. The
+	// returned error is a *PartialResponseError.
+	ErrPartialResponse = errors.New("partial response with fault")
+)
+
+// ItemFault is the failure of one item of a batch operation, reported in the response body instead of a
+// SOAP fault.
+type ItemFault struct {
+	// Index is the position of the item in the request, starting at 0.
+	Index   int
+	Code    string
+	Message string
+	// Detail is the item level error structure of the response, if any.
+	Detail any
+}
+
+func (f ItemFault) String() string {
+	return fmt.Sprintf("item %d: %s (%s)", f.Index, f.Code, f.Message)
+}
+
+// PartialFaults is implemented by responses of batch operations embedding the faults of single items. After
+// the response was decoded the faults it returns are reported as *PartialFailureError.
+type PartialFaults interface {
+	ItemFaults() []ItemFault
+}
+
+// ItemCounter is implemented by PartialFaults responses knowing the number of items, which lets
+// PartialFailureError list the items succeeded.
+type ItemCounter interface {
+	ItemCount() int
+}
+
+// PartialFailureError is returned by calls whose response reports failed items. The response is decoded
+// completely, it holds the results of the items succeeded. Partial failures are never retried.
+type PartialFailureError struct {
+	// Successes holds the indexes of the items succeeded, if the response implements ItemCounter.
+	Successes []int
+	Failures  []ItemFault
+}
+
+func (e *PartialFailureError) Error() string {
+	faults := make([]string, len(e.Failures))
+	for i, f := range e.Failures {
+		faults[i] = f.String()
+	}
+	return fmt.Sprintf("%s: %d failed: %s", ErrPartialFailure, len(e.Failures), strings.Join(faults, "; "))
+}
+
+func (e *PartialFailureError) Unwrap() error {
+	return ErrPartialFailure
+}
+
+// partialFailure returns the error for the item faults reported by the decoded response, nil if it has none.
+func partialFailure(response any) error {
+	pf, ok := response.(PartialFaults)
+	if !ok {
+		return nil
+	}
+	failures := pf.ItemFaults()
+	if len(failures) == 0 {
+		return nil
+	}
+	e := &PartialFailureError{Failures: failures}
+	if counter, ok := response.(ItemCounter); ok {
+		failed := make(map[int]bool, len(failures))
+		for _, f := range failures {
+			failed[f.Index] = true
+		}
+		for i := 0; i < counter.ItemCount(); i++ {
+			if !failed[i] {
+				e.Successes = append(e.Successes, i)
+			}
+		}
+	}
+	return e
+}
+
+// PartialResponseError is returned by calls whose response body holds a fault next to response content, as
+// sent by some non-compliant servers, unless WithStrictFaultBody is set. The content is decoded into the
+// response, the error wraps the fault.
+type PartialResponseError struct {
+	Fault *Fault
+}
+
+func (e *PartialResponseError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrPartialResponse, e.Fault)
+}
+
+func (e *PartialResponseError) Unwrap() []error {
+	return []error{ErrPartialResponse, e.Fault}
+}
@@ -0,0 +1,136 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type batchItemResult struct {
+	ID    string `xml:"ID"`
+	Error *struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Error"`
+}
+
+type batchUpdateResponse struct {
+	XMLName xml.Name          `xml:"urn:test UpdateResponse"`
+	Results []batchItemResult `xml:"ItemResult"`
+}
+
+func (r *batchUpdateResponse) ItemFaults() []ItemFault {
+	var faults []ItemFault
+	for i, res := range r.Results {
+		if res.Error != nil {
+			faults = append(faults, ItemFault{Index: i, Code: res.Error.Code, Message: res.Error.Message, Detail: res.Error})
+		}
+	}
+	return faults
+}
+
+func (r *batchUpdateResponse) ItemCount() int {
+	return len(r.Results)
+}
+
+const partialResponseBody = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>
+<UpdateResponse xmlns="urn:test">
+	<ItemResult><ID>1</ID></ItemResult>
+	<ItemResult><ID>2</ID><Error><Code>NotFound</Code><Message>no item 2</Message></Error></ItemResult>
+	<ItemResult><ID>3</ID></ItemResult>
+</UpdateResponse></soap:Body></soap:Envelope>`
+
+func TestPartialFailure(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", partialResponseBody)
+	resp := &batchUpdateResponse{}
+	err := NewClient(srv.URL).Do(context.Background(), "Update", &infoRequest{}, resp)
+	assert.ErrorIs(t, err, ErrPartialFailure)
+	var partial *PartialFailureError
+	require.ErrorAs(t, err, &partial)
+	assert.Equal(t, []int{0, 2}, partial.Successes)
+	require.Len(t, partial.Failures, 1)
+	assert.Equal(t, 1, partial.Failures[0].Index)
+	assert.Equal(t, "NotFound", partial.Failures[0].Code)
+	assert.EqualError(t, err, "some items failed: 1 failed: item 1: NotFound (no item 2)")
+	// the successes are decoded
+	assert.Len(t, resp.Results, 3)
+	assert.Equal(t, "3", resp.Results[2].ID)
+}
+
+func TestPartialFailureNotRetried(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(partialResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+	err := NewClient(srv.URL).Do(context.Background(), "Update", &infoRequest{}, &batchUpdateResponse{},
+		WithRetry(RetryPolicy{MaxAttempts: 3}), MarkIdempotent("Update"))
+	assert.ErrorIs(t, err, ErrPartialFailure)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestPartialFailureNone(t *testing.T) {
+	body := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<UpdateResponse xmlns="urn:test"><ItemResult><ID>1</ID></ItemResult></UpdateResponse></soap:Body></soap:Envelope>`
+	resp := &batchUpdateResponse{}
+	assert.NoError(t, UnmarshalResponse([]byte(body), resp))
+	assert.ErrorIs(t, UnmarshalResponse([]byte(partialResponseBody), &batchUpdateResponse{}), ErrPartialFailure)
+}
+
+const partialFaultXML = `<soap:Fault><faultcode>soap:Server</faultcode><faultstring>Item b unavailable</faultstring></soap:Fault>`
+
+func TestPartialResponse(t *testing.T) {
+	contentFirst := strings.Replace(infoResponseBody, "</soap:Body>", partialFaultXML+"</soap:Body>", 1)
+	faultFirst := strings.Replace(infoResponseBody, "<soap:Body>", "<soap:Body>"+partialFaultXML, 1)
+	for name, body := range map[string]string{"content first": contentFirst, "fault first": faultFirst} {
+		t.Run(name, func(t *testing.T) {
+			srv := newInfoServer(t, "text/xml", body)
+			resp := &infoResponse{}
+			err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, resp)
+			assert.ErrorIs(t, err, ErrPartialResponse)
+			assert.EqualError(t, err, "partial response with fault: soap fault: soap:Server (Item b unavailable)")
+			var partial *PartialResponseError
+			if assert.ErrorAs(t, err, &partial) {
+				assert.Equal(t, "Item b unavailable", partial.Fault.String)
+			}
+			assert.Equal(t, "soap:Server", ExtractFault(err).Code)
+			assert.Equal(t, []string{"a", "b"}, resp.Items)
+
+			resp = &infoResponse{}
+			assert.ErrorIs(t, UnmarshalResponse([]byte(body), resp), ErrPartialResponse)
+			assert.Equal(t, []string{"a", "b"}, resp.Items)
+		})
+	}
+
+	// a fault alone is no partial response
+	fault := strings.Replace(contentFirst, `<GetInfoResponse xmlns="urn:test"><Item>a</Item><Item>b</Item></GetInfoResponse>`, "", 1)
+	srv := newInfoServer(t, "text/xml", fault)
+	err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.NotErrorIs(t, err, ErrPartialResponse)
+	assert.NotNil(t, ExtractFault(err))
+}
+
+func TestStrictFaultBody(t *testing.T) {
+	contentFirst := strings.Replace(infoResponseBody, "</soap:Body>", partialFaultXML+"</soap:Body>", 1)
+	srv := newInfoServer(t, "text/xml", contentFirst)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithStrictFaultBody()))
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.NotErrorIs(t, err, ErrPartialResponse)
+	assert.NotNil(t, ExtractFault(err))
+
+	faultFirst := strings.Replace(infoResponseBody, "<soap:Body>", "<soap:Body>"+partialFaultXML, 1)
+	srv = newInfoServer(t, "text/xml", faultFirst)
+	client = NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithStrictFaultBody()))
+	err = client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.NotErrorIs(t, err, ErrPartialResponse)
+}
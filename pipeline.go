@@ -0,0 +1,111 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Implements the stages of an attempt of Client.Do as exported methods, for clients with a transport or an
+// authentication of their own that keep the envelope construction, the signing and the fault handling of the
+// client. Client.Do runs through the same stages, adding the call-level features on top: retries, hooks,
+// statistics, WS-Addressing, idempotency and correlation headers.
+
+// Pipeline holds the options of the stages of a call.
+type Pipeline struct {
+	settings settings
+	headers  []HeaderBuilder
+}
+
+// NewPipeline returns the stages of a call with the options.
+func NewPipeline(opts ...Option) (*Pipeline, error) {
+	s, err := settings{}.apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{settings: s}, nil
+}
+
+// Pipeline returns the stages of a call of the client with the opts on top of the options set on the client.
+// The header builders of the client are added to the envelopes built.
+func (c *Client) Pipeline(opts ...Option) (*Pipeline, error) {
+	s, err := c.settings.apply(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Pipeline{settings: s, headers: c.headers}, nil
+}
+
+// BuildEnvelope returns the envelope of a request with the body content, prepared the way of the options, e.g.
+// sanitized and qualified, and with the headers built by the builders of the pipeline, the headers and the
+// context-aware builders of the options. The checks and hooks Client.Do runs once per call before, like the
+// request validator and BeforeEncode, are left to the caller.
+func (p *Pipeline) BuildEnvelope(ctx context.Context, body any, headers ...HeaderBuilder) (*Envelope, error) {
+	builders := append(p.headers[:len(p.headers):len(p.headers)], headers...)
+	return p.settings.buildEnvelope(ctx, body, builders)
+}
+
+// ApplySecurity adds a wsse:Security header signed with cfg to the envelope, like the header of a WSSEAuthInfo.
+// The signature is made by EncodeRequest over the envelope as serialized, see the ApplySecurity function,
+// which signs an envelope serialized otherwise.
+func (p *Pipeline) ApplySecurity(envelope *Envelope, cfg SecurityConfig) {
+	envelope.AddHeaders(&pendingSecurity{config: cfg})
+}
+
+// EncodedRequest is a request encoded by Pipeline.EncodeRequest.
+type EncodedRequest struct {
+	// Envelope is the serialized and signed envelope.
+	Envelope []byte
+	// Body is the message to send: the envelope, or the multipart message carrying it with the attachments
+	// sent as MIME parts, encoded by the codec of WithCodec.
+	Body []byte
+	// Action is the SOAP action as sent, formatted by WithSOAPActionFormatter.
+	Action string
+	// Header holds the HTTP headers of the message: Content-Type and, for SOAP 1.1, SOAPAction.
+	Header http.Header
+
+	settings *settings
+}
+
+// EncodeRequest serializes the envelope of a request for action and signs its Security headers, with the
+// limits, encoders and MTOM packaging of the options.
+func (p *Pipeline) EncodeRequest(envelope *Envelope, action string) (*EncodedRequest, error) {
+	return p.settings.encodeRequest(envelope, action)
+}
+
+// HTTPRequest returns the HTTP request sending the message to url, with the action query of WithActionQuery.
+func (e *EncodedRequest) HTTPRequest(ctx context.Context, url string) (*http.Request, error) {
+	endpoint, err := e.settings.withActionQuery(url, e.Action)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, e.settings.method(), endpoint, bytes.NewReader(e.Body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range e.Header {
+		httpReq.Header[name] = append([]string(nil), values...)
+	}
+	e.settings.overrideHost(httpReq)
+	return httpReq, nil
+}
+
+// DecodeResponse decodes the HTTP response to a request for action into the response content the way of
+// Client.Do. A SOAP fault is returned as *Fault whatever the status code, an error status without fault as
+// *HTTPError; item faults reported by a PartialFaults response are returned as error. The caller has to close
+// the response body.
+func (p *Pipeline) DecodeResponse(ctx context.Context, httpResp *http.Response, action string, response any) error {
+	resp := &Response{Response: httpResp, body: response, settings: p.settings, attempt: 1}
+	return resp.decode(ctx, action)
+}
+
+// ExtractFault returns the SOAP fault of the error returned by a call or by DecodeResponse, nil if it is no
+// fault.
+func ExtractFault(err error) *Fault {
+	var fault *Fault
+	if !errors.As(err, &fault) {
+		return nil
+	}
+	return fault
+}
@@ -0,0 +1,179 @@
+package soap
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stagedClient is a client assembled from the stages of a pipeline, with a transport of its own.
+type stagedClient struct {
+	pipeline  *Pipeline
+	url       string
+	transport http.RoundTripper
+	security  *SecurityConfig
+}
+
+func (c *stagedClient) Do(ctx context.Context, action string, request any, response any) error {
+	envelope, err := c.pipeline.BuildEnvelope(ctx, request)
+	if err != nil {
+		return err
+	}
+	if c.security != nil {
+		c.pipeline.ApplySecurity(envelope, *c.security)
+	}
+	encoded, err := c.pipeline.EncodeRequest(envelope, action)
+	if err != nil {
+		return err
+	}
+	httpReq, err := encoded.HTTPRequest(ctx, c.url)
+	if err != nil {
+		return err
+	}
+	httpResp, err := c.transport.RoundTrip(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	return c.pipeline.DecodeResponse(ctx, httpResp, action, response)
+}
+
+func TestPipeline(t *testing.T) {
+	info12 := `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body>` +
+		`<GetInfoResponse xmlns="urn:test"><Item>c</Item></GetInfoResponse></env:Body></env:Envelope>`
+	fault11 := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+		`<faultcode>soap:Client</faultcode><faultstring>Invalid account</faultstring>` +
+		`</soap:Fault></soap:Body></soap:Envelope>`
+	fault12 := `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><env:Fault>` +
+		`<env:Code><env:Value>env:Sender</env:Value></env:Code><env:Reason>` +
+		`<env:Text xml:lang="en">Invalid account</env:Text></env:Reason></env:Fault></env:Body></env:Envelope>`
+	tests := []struct {
+		name        string
+		opts        []Option
+		signed      bool
+		status      int
+		contentType string
+		body        string
+		want        []string
+		wantFault   string
+		wantErr     error
+		wantStatus  int
+	}{
+		{name: "soap 1.1", status: http.StatusOK, contentType: "text/xml", body: infoResponseBody, want: []string{"a", "b"}},
+		{name: "soap 1.2", opts: []Option{WithVersion(SOAP12)}, status: http.StatusOK,
+			contentType: "application/soap+xml", body: info12, want: []string{"c"}},
+		{name: "action format", opts: []Option{WithSOAPActionFormatter(func(a string) string { return "urn:" + a }),
+			WithActionQueryParam("op")}, status: http.StatusOK, contentType: "text/xml", body: infoResponseBody,
+			want: []string{"a", "b"}},
+		{name: "signed", signed: true, status: http.StatusOK, contentType: "text/xml", body: infoResponseBody,
+			want: []string{"a", "b"}},
+		{name: "soap 1.1 fault", status: http.StatusInternalServerError, contentType: "text/xml", body: fault11,
+			wantFault: "soap:Client"},
+		{name: "soap 1.2 fault", opts: []Option{WithVersion(SOAP12)}, status: http.StatusBadRequest,
+			contentType: "application/soap+xml", body: fault12, wantFault: "env:Sender"},
+		{name: "fault with success status", status: http.StatusOK, contentType: "text/xml", body: fault11,
+			wantFault: "soap:Client"},
+		{name: "error status", status: http.StatusServiceUnavailable, contentType: "text/plain", body: "busy",
+			wantStatus: http.StatusServiceUnavailable},
+		{name: "gateway page", status: http.StatusBadGateway, contentType: "text/html",
+			body: "<html><body>Bad Gateway</body></html>", wantErr: ErrGatewayResponse},
+		{name: "acknowledged", status: http.StatusAccepted, contentType: "text/xml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var captured []capturedRequest
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				captured = append(captured, capturedRequest{header: r.Header.Clone(), body: r.URL.RawQuery + " " + string(b)})
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			t.Cleanup(srv.Close)
+
+			client := NewClient(srv.URL)
+			require.NoError(t, client.SetOptions(tt.opts...))
+			pipeline, err := client.Pipeline()
+			require.NoError(t, err)
+			staged := &stagedClient{pipeline: pipeline, url: srv.URL, transport: http.DefaultTransport}
+			if tt.signed {
+				cfg := securityConfig(t)
+				staged.security = &cfg
+				standardCfg := securityConfig(t)
+				client.headers = append(client.headers, func(any) (any, error) {
+					return &pendingSecurity{config: standardCfg}, nil
+				})
+			}
+
+			standard, assembled := &infoResponse{}, &infoResponse{}
+			errs := []error{
+				client.Do(context.Background(), "GetInfo", &infoRequest{}, standard),
+				staged.Do(context.Background(), "GetInfo", &infoRequest{}, assembled),
+			}
+			require.Len(t, captured, 2)
+			assert.Equal(t, captured[0].body, captured[1].body)
+			for _, name := range []string{"Content-Type", "Soapaction"} {
+				assert.Equal(t, captured[0].header.Values(name), captured[1].header.Values(name), name)
+			}
+			assert.Equal(t, standard, assembled)
+			assert.Equal(t, tt.want, assembled.Items)
+			if tt.signed {
+				_, envelope, _ := strings.Cut(captured[1].body, " ")
+				assert.NoError(t, VerifySignature([]byte(envelope), VerifyOptions{CurrentTime: testSigningTime}))
+			}
+
+			for _, err := range errs {
+				switch {
+				case tt.wantFault != "":
+					if fault := ExtractFault(err); assert.NotNil(t, fault) {
+						assert.Equal(t, tt.wantFault, fault.Code)
+					}
+				case tt.wantStatus != 0:
+					var httpErr *HTTPError
+					if assert.ErrorAs(t, err, &httpErr) {
+						assert.Equal(t, tt.wantStatus, httpErr.StatusCode)
+					}
+					assert.Nil(t, ExtractFault(err))
+				case tt.wantErr != nil:
+					assert.ErrorIs(t, err, tt.wantErr)
+				default:
+					assert.NoError(t, err)
+				}
+			}
+			if errs[0] != nil {
+				assert.EqualError(t, errs[1], errs[0].Error())
+			}
+		})
+	}
+}
+
+func TestNewPipeline(t *testing.T) {
+	pipeline, err := NewPipeline(WithVersion(SOAP12))
+	require.NoError(t, err)
+	token := func(any) (any, error) { return RawHeader{XML: []byte(`<Token xmlns="urn:auth">t-1</Token>`)}, nil }
+	envelope, err := pipeline.BuildEnvelope(context.Background(), &infoRequest{}, token)
+	require.NoError(t, err)
+	encoded, err := pipeline.EncodeRequest(envelope, "GetInfo")
+	require.NoError(t, err)
+	assert.Equal(t, `application/soap+xml; action=GetInfo; charset=utf-8`, encoded.Header.Get("Content-Type"))
+	assert.Empty(t, encoded.Header.Values("SOAPAction"))
+	assert.Equal(t, encoded.Envelope, encoded.Body)
+	assert.Contains(t, string(encoded.Envelope), `<Token xmlns="urn:auth">t-1</Token>`)
+
+	httpResp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": {"application/soap+xml"}},
+		Body: io.NopCloser(strings.NewReader(`<env:Envelope xmlns:env="` + soap12EnvNS + `"><env:Body>` +
+			`<GetInfoResponse xmlns="urn:test"><Item>a</Item></GetInfoResponse></env:Body></env:Envelope>`))}
+	resp := &infoResponse{}
+	require.NoError(t, pipeline.DecodeResponse(context.Background(), httpResp, "GetInfo", resp))
+	assert.Equal(t, []string{"a"}, resp.Items)
+
+	_, err = NewPipeline(WithHeaderPresence(HeaderPresence(9)))
+	assert.Error(t, err)
+	assert.Nil(t, ExtractFault(err))
+}
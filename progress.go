@@ -0,0 +1,113 @@
+package soap
+
+import (
+	"io"
+	"net/http"
+	"time"
+)
+
+// ProgressFunc is called with the number of body bytes transferred so far and the total number, -1 if the
+// length of the body is not known.
+type ProgressFunc func(transferred, total int64)
+
+// defaultProgressRate is the maximum number of progress callbacks per second.
+const defaultProgressRate = 10
+
+// WithProgress reports the progress of sending the request body to upload and of reading the response body
+// to download, either may be nil. The counts are of the bytes on the wire, i.e. of the whole multipart body
+// of MTOM messages, and start from zero for every attempt. The callbacks are throttled to 10 calls per second,
+// see WithProgressRate, the completion of a body is always reported.
+func WithProgress(upload, download ProgressFunc) Option {
+	return func(s *settings) error {
+		s.uploadProgress = upload
+		s.downloadProgress = download
+		return nil
+	}
+}
+
+// WithProgressRate sets the maximum number of progress callbacks per second, n <= 0 reports every read.
+func WithProgressRate(n int) Option {
+	return func(s *settings) error {
+		s.progressRate = n
+		if n <= 0 {
+			s.progressRate = -1
+		}
+		return nil
+	}
+}
+
+// progressInterval returns the minimum time between progress callbacks.
+func (s *settings) progressInterval() time.Duration {
+	switch {
+	case s.progressRate < 0:
+		return 0
+	case s.progressRate == 0:
+		return time.Second / defaultProgressRate
+	}
+	return time.Second / time.Duration(s.progressRate)
+}
+
+// trackUpload wraps the body of httpReq to report the upload progress.
+func (cl *call) trackUpload(httpReq *http.Request) {
+	if cl.settings.uploadProgress == nil || httpReq.Body == nil {
+		return
+	}
+	total := httpReq.ContentLength
+	if total <= 0 {
+		total = -1
+	}
+	body := httpReq.Body
+	httpReq.Body = struct {
+		io.Reader
+		io.Closer
+	}{cl.progressReader(body, total, cl.settings.uploadProgress), body}
+	// the body sent again on redirects is not tracked
+	httpReq.GetBody = nil
+}
+
+// trackDownload wraps the body of httpResp to report the download progress.
+func (cl *call) trackDownload(httpResp *http.Response) {
+	if cl.settings.downloadProgress == nil {
+		return
+	}
+	body := httpResp.Body
+	httpResp.Body = struct {
+		io.Reader
+		io.Closer
+	}{cl.progressReader(body, httpResp.ContentLength, cl.settings.downloadProgress), body}
+}
+
+func (cl *call) progressReader(r io.Reader, total int64, fn ProgressFunc) *progressReader {
+	return &progressReader{r: r, total: total, fn: fn, clock: cl.settings.timeSource(),
+		interval: cl.settings.progressInterval()}
+}
+
+// progressReader reports the bytes read from r to fn, at most once per interval unless r is done.
+type progressReader struct {
+	r        io.Reader
+	n, total int64
+	fn       ProgressFunc
+	clock    Clock
+	interval time.Duration
+	last     time.Time
+	done     bool
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	if p.done {
+		return n, err
+	}
+	complete := err == io.EOF || p.n == p.total
+	if n == 0 && !complete {
+		return n, err
+	}
+	now := p.clock.Now()
+	if complete || p.last.IsZero() || now.Sub(p.last) >= p.interval {
+		p.last = now
+		p.done = complete
+		p.fn(p.n, p.total)
+	}
+	return n, err
+}
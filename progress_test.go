@@ -0,0 +1,89 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type progressCall struct {
+	transferred, total int64
+}
+
+func recordProgress(calls *[]progressCall) ProgressFunc {
+	return func(transferred, total int64) {
+		*calls = append(*calls, progressCall{transferred, total})
+	}
+}
+
+func TestProgress(t *testing.T) {
+	srv, _ := newMTOMEchoServer(t)
+	client := NewClient(srv.URL)
+	var uploads, downloads []progressCall
+	require.NoError(t, client.SetOptions(WithMTOM(), MTOMThreshold(100),
+		WithProgress(recordProgress(&uploads), recordProgress(&downloads))))
+
+	req := &upload{Large: Attachment{Data: bytes.Repeat([]byte{2}, 64<<10)}}
+	var info ResponseInfo
+	require.NoError(t, client.Do(context.Background(), "Upload", req, &upload{}, WithResponseInfo(&info)))
+
+	// the multipart bodies are counted as a whole and their completion is reported
+	require.NotEmpty(t, uploads)
+	last := uploads[len(uploads)-1]
+	assert.Greater(t, last.total, int64(64<<10))
+	assert.Equal(t, last.total, last.transferred)
+	require.NotEmpty(t, downloads)
+	// the echoed body is chunked, its length unknown
+	assert.Equal(t, progressCall{info.BytesRead, -1}, downloads[len(downloads)-1])
+}
+
+func TestProgressRetry(t *testing.T) {
+	srv, requests := newFlakyServer(t, 1, http.StatusServiceUnavailable)
+	client := NewClient(srv.URL)
+	var uploads []progressCall
+	require.NoError(t, client.SetOptions(WithRetry(fastRetry), MarkIdempotent("GetInfo")))
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+		WithProgress(recordProgress(&uploads), nil), WithProgressRate(0))
+	require.NoError(t, err)
+	assert.Len(t, *requests, 2)
+	// the body is sent in one read, every attempt reports it from the start
+	require.NotEmpty(t, uploads)
+	assert.Equal(t, uploads[0].total, uploads[0].transferred)
+	assert.Equal(t, []progressCall{uploads[0], uploads[0]}, uploads)
+}
+
+func TestProgressThrottle(t *testing.T) {
+	clock := &manualClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		name  string
+		opts  []Option
+		total int64
+		calls int
+	}{
+		// the clock does not move, so only the first read and the completion are reported
+		{name: "throttled", total: 100, calls: 2},
+		{name: "unknown length", total: -1, calls: 2},
+		{name: "unthrottled", opts: []Option{WithProgressRate(0)}, total: 100, calls: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := settings{}.apply(append(tt.opts, WithClock(clock))...)
+			require.NoError(t, err)
+			cl := &call{settings: s}
+			var calls []progressCall
+			r := cl.progressReader(iotest.OneByteReader(bytes.NewReader(make([]byte, 100))), tt.total, recordProgress(&calls))
+			_, err = io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Len(t, calls, tt.calls)
+			assert.Equal(t, progressCall{100, tt.total}, calls[len(calls)-1])
+		})
+	}
+}
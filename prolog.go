@@ -0,0 +1,59 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrUTF16Response is returned if a response starts with a UTF-16 byte order mark. Only UTF-8 encoded
+	// envelopes are supported.
+	ErrUTF16Response = errors.New("response is UTF-16 encoded, only UTF-8 is supported")
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+)
+
+// trimProlog strips a UTF-8 byte order mark and any whitespace preceding the XML prolog of r.
+// Some servers emit these, but the XML decoder rejects an XML declaration that is not at the very start.
+func trimProlog(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(len(bomUTF8))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(head, bomUTF8):
+		_, _ = br.Discard(len(bomUTF8))
+	case bytes.HasPrefix(head, bomUTF16BE), bytes.HasPrefix(head, bomUTF16LE):
+		return nil, ErrUTF16Response
+	}
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return br, nil
+		} else if err != nil {
+			return nil, err
+		}
+		if b != ' ' && b != '\t' && b != '\r' && b != '\n' {
+			_ = br.UnreadByte()
+			return br, nil
+		}
+	}
+}
+
+// trimPrologBytes is trimProlog of a response read into data.
+func trimPrologBytes(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		data = data[len(bomUTF8):]
+	case bytes.HasPrefix(data, bomUTF16BE), bytes.HasPrefix(data, bomUTF16LE):
+		return nil, ErrUTF16Response
+	}
+	return bytes.TrimLeft(data, " \t\r\n"), nil
+}
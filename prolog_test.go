@@ -0,0 +1,63 @@
+package soap
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var prologTests = []struct {
+	fixture string
+	items   []string
+	err     error
+	fault   bool
+}{
+	{fixture: "utf8_bom.xml", items: []string{"a"}},
+	{fixture: "utf8_bom_blank_lines.xml", items: []string{"a"}},
+	{fixture: "leading_whitespace.xml", items: []string{"a"}},
+	{fixture: "utf8_bom_fault.xml", fault: true},
+	{fixture: "utf16le_bom.xml", err: ErrUTF16Response},
+	{fixture: "utf16be_bom.xml", err: ErrUTF16Response},
+}
+
+func TestUnmarshalResponseProlog(t *testing.T) {
+	for _, tt := range prologTests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			data, err := os.ReadFile("./testdata/bom/" + tt.fixture)
+			assert.NoError(t, err)
+
+			resp := &infoResponse{}
+			err = UnmarshalResponse(data, resp)
+			checkPrologResult(t, tt.items, tt.err, tt.fault, resp, err)
+		})
+	}
+}
+
+func TestClientProlog(t *testing.T) {
+	for _, tt := range prologTests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			data, err := os.ReadFile("./testdata/bom/" + tt.fixture)
+			assert.NoError(t, err)
+			srv := newInfoServer(t, "text/xml; charset=utf-8", string(data))
+
+			resp := &infoResponse{}
+			err = NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, resp)
+			checkPrologResult(t, tt.items, tt.err, tt.fault, resp, err)
+		})
+	}
+}
+
+func checkPrologResult(t *testing.T, items []string, wantErr error, fault bool, resp *infoResponse, err error) {
+	t.Helper()
+	switch {
+	case wantErr != nil:
+		assert.ErrorIs(t, err, wantErr)
+	case fault:
+		assert.ErrorIs(t, err, ErrSoapFault)
+	default:
+		assert.NoError(t, err)
+		assert.Equal(t, items, resp.Items)
+	}
+}
@@ -0,0 +1,354 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m29h/xml"
+)
+
+// Implements path queries over generic element trees, such as xs:any content and fault details, without an
+// XPath dependency. The paths are a small subset of XPath:
+//
+//	Errors/Error[code=E42]/message
+//	//Error[@severity='fatal'][1]
+//	{urn:vendor}Errors/*/{urn:vendor}Code
+//
+// Steps are separated by "/", "//" selects the descendants at any depth instead of the children. A step is a
+// local name or "*" for any element, optionally preceded by a namespace in braces. Predicates in brackets filter the elements
+// of a step: [name] and [@name] require a child element or an attribute, [name=value] and [@name=value] its
+// trimmed text or value, in quotes if needed, and [n] the n-th element the step selects from one element,
+// counting from 1.
+
+var (
+	// ErrInvalidQuery is returned for a query path that cannot be parsed.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrNoElement is returned by the accessors of a QueryResult if the query found no element.
+	ErrNoElement = errors.New("no element found")
+)
+
+// QueryMode decides how the names of a query path without a namespace in braces match.
+type QueryMode int
+
+const (
+	// MatchLocalName matches the names without a namespace on the local name, in any namespace.
+	MatchLocalName QueryMode = iota
+	// MatchNamespace matches the names without a namespace on elements and attributes without a namespace only;
+	// "*" still matches any element.
+	MatchNamespace
+)
+
+// QueryResult holds the elements found by a query.
+type QueryResult struct {
+	// Elements are the elements found, each once.
+	Elements []*AnyElement
+	// Err is the error of an invalid query path.
+	Err  error
+	path string
+}
+
+// Find returns the elements the path selects from e, matching names without a namespace on their local name.
+func (e *AnyElement) Find(path string) QueryResult {
+	return e.Query(path, MatchLocalName)
+}
+
+// Query returns the elements the path selects from e, matching names as the mode says.
+func (e *AnyElement) Query(path string, mode QueryMode) QueryResult {
+	steps, err := parseQuery(path)
+	if err != nil {
+		return QueryResult{Err: err, path: path}
+	}
+	found := []*AnyElement{e}
+	for _, step := range steps {
+		found = step.apply(found, mode)
+	}
+	return QueryResult{Elements: found, path: path}
+}
+
+// First returns the first element found, or nil.
+func (r QueryResult) First() *AnyElement {
+	if len(r.Elements) == 0 {
+		return nil
+	}
+	return r.Elements[0]
+}
+
+// Text returns the trimmed text of the first element found, "" if there is none.
+func (r QueryResult) Text() string {
+	if el := r.First(); el != nil {
+		return strings.TrimSpace(el.Value)
+	}
+	return ""
+}
+
+// Int returns the text of the first element found as integer.
+func (r QueryResult) Int() (int64, error) {
+	text, err := r.value()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(text, 10, 64)
+}
+
+// Time returns the text of the first element found as time, in any of the formats of ParseTimestamp.
+func (r QueryResult) Time() (time.Time, error) {
+	text, err := r.value()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ParseTimestamp(text)
+}
+
+// value returns the text of the first element found or the error of the query.
+func (r QueryResult) value() (string, error) {
+	if r.Err != nil {
+		return "", r.Err
+	}
+	if len(r.Elements) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrNoElement, r.path)
+	}
+	return r.Text(), nil
+}
+
+// DetailTree returns the detail of the fault as tree, an element named detail with the elements of the detail
+// as children. Namespace prefixes declared outside the detail element are unknown, as with Detail; the names
+// using them keep the prefix as namespace.
+func (f *Fault) DetailTree() (*AnyElement, error) {
+	var tree AnyElement
+	if err := xml.Unmarshal([]byte("<detail>"+f.Detail()+"</detail>"), &tree); err != nil {
+		return nil, err
+	}
+	return &tree, nil
+}
+
+// QueryDetail returns the elements the path selects from the detail of the fault, see DetailTree.
+func (f *Fault) QueryDetail(path string, mode QueryMode) QueryResult {
+	tree, err := f.DetailTree()
+	if err != nil {
+		return QueryResult{Err: err, path: path}
+	}
+	return tree.Query(path, mode)
+}
+
+// queryName is the name of a step or predicate, local is "*" for any name.
+type queryName struct {
+	space    string
+	hasSpace bool
+	local    string
+}
+
+func (n queryName) matches(name xml.Name, mode QueryMode) bool {
+	if n.local != "*" && n.local != name.Local {
+		return false
+	}
+	if n.hasSpace {
+		return n.space == name.Space
+	}
+	return mode == MatchLocalName || n.local == "*" || name.Space == ""
+}
+
+type queryPredicate struct {
+	// index is the position of a [n] predicate, 0 for the others
+	index    int
+	attr     bool
+	name     queryName
+	value    string
+	hasValue bool
+}
+
+func (p queryPredicate) matches(e *AnyElement, mode QueryMode) bool {
+	if p.attr {
+		for _, attr := range e.Attrs {
+			if p.name.matches(attr.Name, mode) && (!p.hasValue || attr.Value == p.value) {
+				return true
+			}
+		}
+		return false
+	}
+	for i := range e.Children {
+		child := &e.Children[i]
+		if p.name.matches(child.XMLName, mode) && (!p.hasValue || strings.TrimSpace(child.Value) == p.value) {
+			return true
+		}
+	}
+	return false
+}
+
+type queryStep struct {
+	descendants bool
+	name        queryName
+	predicates  []queryPredicate
+}
+
+// apply returns the elements the step selects from the elements, each once.
+func (s queryStep) apply(elements []*AnyElement, mode QueryMode) []*AnyElement {
+	var found []*AnyElement
+	seen := make(map[*AnyElement]bool)
+	for _, e := range elements {
+		var candidates []*AnyElement
+		s.collect(e, mode, &candidates)
+		for _, p := range s.predicates {
+			candidates = p.filter(candidates, mode)
+		}
+		for _, c := range candidates {
+			if !seen[c] {
+				seen[c] = true
+				found = append(found, c)
+			}
+		}
+	}
+	return found
+}
+
+// collect adds the children of e matching the step, or its descendants for a "//" step.
+func (s queryStep) collect(e *AnyElement, mode QueryMode, found *[]*AnyElement) {
+	for i := range e.Children {
+		child := &e.Children[i]
+		if s.name.matches(child.XMLName, mode) {
+			*found = append(*found, child)
+		}
+		if s.descendants {
+			s.collect(child, mode, found)
+		}
+	}
+}
+
+func (p queryPredicate) filter(elements []*AnyElement, mode QueryMode) []*AnyElement {
+	if p.index > 0 {
+		if p.index > len(elements) {
+			return nil
+		}
+		return elements[p.index-1 : p.index]
+	}
+	var kept []*AnyElement
+	for _, e := range elements {
+		if p.matches(e, mode) {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
+
+// parseQuery parses the steps of a query path.
+func parseQuery(path string) ([]queryStep, error) {
+	p := queryParser{path: path}
+	var steps []queryStep
+	descendants := p.consume("//")
+	for {
+		step := queryStep{descendants: descendants}
+		var err error
+		if step.name, err = p.name(); err != nil {
+			return nil, err
+		}
+		for p.consume("[") {
+			pred, err := p.predicate()
+			if err != nil {
+				return nil, err
+			}
+			step.predicates = append(step.predicates, pred)
+		}
+		steps = append(steps, step)
+		if p.pos == len(path) {
+			return steps, nil
+		}
+		if descendants = p.consume("//"); !descendants && !p.consume("/") {
+			return nil, p.errorf("unexpected %q", path[p.pos])
+		}
+	}
+}
+
+type queryParser struct {
+	path string
+	pos  int
+}
+
+func (p *queryParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w %q at %d: %s", ErrInvalidQuery, p.path, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *queryParser) consume(s string) bool {
+	if strings.HasPrefix(p.path[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// name parses a name with an optional namespace in braces.
+func (p *queryParser) name() (queryName, error) {
+	var n queryName
+	if p.consume("{") {
+		end := strings.IndexByte(p.path[p.pos:], '}')
+		if end < 0 {
+			return n, p.errorf("unterminated namespace")
+		}
+		n.space, n.hasSpace = p.path[p.pos:p.pos+end], true
+		p.pos += end + 1
+	}
+	start := p.pos
+	for p.pos < len(p.path) && !strings.ContainsRune("/[]=@{}'\"", rune(p.path[p.pos])) {
+		p.pos++
+	}
+	n.local = p.path[start:p.pos]
+	switch {
+	case n.local == "":
+		return n, p.errorf("missing name")
+	case strings.Contains(n.local, ":"):
+		return n, p.errorf("prefix in name %q, use a namespace in braces", n.local)
+	}
+	return n, nil
+}
+
+// predicate parses a predicate after its opening bracket.
+func (p *queryParser) predicate() (queryPredicate, error) {
+	var pred queryPredicate
+	if end := strings.IndexByte(p.path[p.pos:], ']'); end > 0 {
+		if n, err := strconv.Atoi(p.path[p.pos : p.pos+end]); err == nil {
+			if n < 1 {
+				return pred, p.errorf("position %d", n)
+			}
+			pred.index = n
+			p.pos += end + 1
+			return pred, nil
+		}
+	}
+	pred.attr = p.consume("@")
+	var err error
+	if pred.name, err = p.name(); err != nil {
+		return pred, err
+	}
+	if p.consume("=") {
+		pred.hasValue = true
+		if pred.value, err = p.value(); err != nil {
+			return pred, err
+		}
+	}
+	if !p.consume("]") {
+		return pred, p.errorf("unterminated predicate")
+	}
+	return pred, nil
+}
+
+// value parses the value of a predicate, quoted or up to the closing bracket.
+func (p *queryParser) value() (string, error) {
+	if p.pos < len(p.path) && (p.path[p.pos] == '\'' || p.path[p.pos] == '"') {
+		quote := p.path[p.pos]
+		end := strings.IndexByte(p.path[p.pos+1:], quote)
+		if end < 0 {
+			return "", p.errorf("unterminated value")
+		}
+		value := p.path[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return value, nil
+	}
+	end := strings.IndexByte(p.path[p.pos:], ']')
+	if end < 0 {
+		return "", p.errorf("unterminated predicate")
+	}
+	value := p.path[p.pos : p.pos+end]
+	p.pos += end
+	return value, nil
+}
@@ -0,0 +1,125 @@
+package soap
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// vendorFaultDetails are fault details as sent by the services of a few vendors: nested error lists, the
+// same names at several levels and prefixes declared on the envelope only.
+var vendorFaultDetails = map[string]string{
+	"rfc": `<n0:OrderFault xmlns:n0="urn:sap-com:document:sap:rfc:functions"><Errors>` +
+		`<Error severity="warning"><code>E41</code><message>Price outdated</message></Error>` +
+		`<Error severity="fatal"><code>E42</code><message> Material locked </message>` +
+		`<timestamp>2024-03-01T10:00:00.123456Z</timestamp><retries>3</retries></Error>` +
+		`</Errors></n0:OrderFault>`,
+	"adf": `<ns2:ServiceErrorMessage xmlns:ns2="http://xmlns.oracle.com/adf/svc/errors/">` +
+		`<ns2:code>JBO-27024</ns2:code><ns2:message>Validation failed</ns2:message>` +
+		`<ns2:detail><ns2:code>JBO-27014</ns2:code><ns2:detail><ns2:code>JBO-27008</ns2:code>` +
+		`<ns2:message>Attribute Salary is required</ns2:message><ns2:attribute>Salary</ns2:attribute>` +
+		`</ns2:detail></ns2:detail></ns2:ServiceErrorMessage>`,
+	"partner": `<sf:fault xmlns:sf="urn:fault.partner.soap.sforce.com" xsi:type="sf:InvalidIdFault">` +
+		`<sf:exceptionCode>INVALID_ID</sf:exceptionCode><sf:exceptionMessage>malformed id 001</sf:exceptionMessage>` +
+		`<code xmlns="">LOCAL</code></sf:fault>`,
+}
+
+func vendorFault(t *testing.T, vendor string) *Fault {
+	t.Helper()
+	body := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><soap:Body><soap:Fault>` +
+		`<faultcode>soap:Server</faultcode><faultstring>failed</faultstring><detail>` +
+		vendorFaultDetails[vendor] + `</detail></soap:Fault></soap:Body></soap:Envelope>`
+	srv := newInfoServer(t, "text/xml", body)
+	err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	fault := ExtractFault(err)
+	require.NotNil(t, fault)
+	return fault
+}
+
+func TestQueryDetail(t *testing.T) {
+	const adfNS = "{http://xmlns.oracle.com/adf/svc/errors/}"
+	tests := []struct {
+		vendor string
+		path   string
+		mode   QueryMode
+		want   []string
+	}{
+		{vendor: "rfc", path: "OrderFault/Errors/Error[code=E42]/message", want: []string{"Material locked"}},
+		{vendor: "rfc", path: "OrderFault/Errors/Error/code", want: []string{"E41", "E42"}},
+		{vendor: "rfc", path: "//Error[@severity='fatal']/code", want: []string{"E42"}},
+		{vendor: "rfc", path: "//Error[@severity=\"warning\"]/message", want: []string{"Price outdated"}},
+		{vendor: "rfc", path: "//Error[2]/code", want: []string{"E42"}},
+		{vendor: "rfc", path: "//Error[timestamp][1]/code", want: []string{"E42"}},
+		{vendor: "rfc", path: "//Error[3]/code"},
+		{vendor: "rfc", path: "*/*/*[@severity]/code", want: []string{"E41", "E42"}},
+		{vendor: "rfc", path: "OrderFault/Errors", mode: MatchNamespace},
+		{vendor: "rfc", path: "{urn:sap-com:document:sap:rfc:functions}OrderFault/Errors/Error[code=E41]/message",
+			mode: MatchNamespace, want: []string{"Price outdated"}},
+		{vendor: "adf", path: "//code", want: []string{"JBO-27024", "JBO-27014", "JBO-27008"}},
+		{vendor: "adf", path: "ServiceErrorMessage/detail//code", want: []string{"JBO-27014", "JBO-27008"}},
+		{vendor: "adf", path: "//detail[attribute=Salary]/message", want: []string{"Attribute Salary is required"}},
+		{vendor: "adf", path: "//" + adfNS + "detail/" + adfNS + "detail/" + adfNS + "code", mode: MatchNamespace,
+			want: []string{"JBO-27008"}},
+		{vendor: "adf", path: "//{urn:other}code", want: nil},
+		{vendor: "partner", path: "fault[@type='sf:InvalidIdFault']/exceptionCode", want: []string{"INVALID_ID"}},
+		{vendor: "partner", path: "fault[@{xsi}type]/exceptionMessage", mode: MatchNamespace, want: nil},
+		{vendor: "partner", path: "{urn:fault.partner.soap.sforce.com}fault[@{xsi}type]/{urn:fault.partner.soap.sforce.com}exceptionMessage",
+			mode: MatchNamespace, want: []string{"malformed id 001"}},
+		{vendor: "partner", path: "*/code", mode: MatchNamespace, want: []string{"LOCAL"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.vendor+" "+tt.path, func(t *testing.T) {
+			result := vendorFault(t, tt.vendor).QueryDetail(tt.path, tt.mode)
+			require.NoError(t, result.Err)
+			var got []string
+			for _, el := range result.Elements {
+				got = append(got, strings.TrimSpace(el.Value))
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQueryAccessors(t *testing.T) {
+	tree, err := vendorFault(t, "rfc").DetailTree()
+	require.NoError(t, err)
+	assert.Equal(t, xml.Name{Local: "detail"}, tree.XMLName)
+
+	fatal := tree.Find("//Error[code=E42]")
+	assert.Equal(t, "Material locked", fatal.First().Find("message").Text())
+	retries, err := tree.Find("//Error[code=E42]/retries").Int()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), retries)
+	at, err := tree.Find("//timestamp").Time()
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 3, 1, 10, 0, 0, 123456000, time.UTC), at)
+
+	_, err = tree.Find("//Error/message").Int()
+	assert.Error(t, err)
+	_, err = tree.Find("//Error[code=E43]/retries").Int()
+	assert.ErrorIs(t, err, ErrNoElement)
+	assert.EqualError(t, err, "no element found: //Error[code=E43]/retries")
+	assert.Nil(t, tree.Find("//missing").First())
+	assert.Equal(t, "", tree.Find("//missing").Text())
+
+	empty, err := (&Fault{}).DetailTree()
+	require.NoError(t, err)
+	assert.Empty(t, empty.Find("*").Elements)
+}
+
+func TestQueryInvalid(t *testing.T) {
+	tree := &AnyElement{XMLName: xml.Name{Local: "root"}}
+	for _, path := range []string{"", "/a", "a/", "a///b", "a[", "a[b", "a[b='c]", "a[0]", "a]", "{urn:x", "n0:Error",
+		"a[@]", "a[=b]"} {
+		result := tree.Find(path)
+		assert.ErrorIs(t, result.Err, ErrInvalidQuery, path)
+		_, err := result.Time()
+		assert.ErrorIs(t, err, ErrInvalidQuery, path)
+	}
+}
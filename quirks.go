@@ -0,0 +1,269 @@
+package soap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Implements vendor quirks profiles.
+// A profile bundles the encoder and transport options a family of SOAP servers needs to interoperate.
+
+// EmptyElementForm selects how elements without content are written in requests.
+type EmptyElementForm int
+
+const (
+	// EmptyElementsDefault leaves empty elements as the encoder writes them (<a></a>).
+	EmptyElementsDefault EmptyElementForm = iota
+	// EmptyElementsSelfClosing writes empty elements as <a/>.
+	EmptyElementsSelfClosing
+	// EmptyElementsExpanded writes empty elements as <a></a>, also if they were supplied as raw XML.
+	EmptyElementsExpanded
+	// EmptyElementsOmitted leaves out optional elements without content: pointer fields tagged omitempty
+	// pointing to a zero value are omitted like nil pointers. The request value is not modified.
+	EmptyElementsOmitted
+)
+
+var (
+	// ErrInvalidEmptyElementForm is returned if an unknown EmptyElementForm is configured
+	ErrInvalidEmptyElementForm = errors.New("invalid empty element form")
+)
+
+// QuirksProfile is a named set of options working around the peculiarities of a server implementation.
+// Custom profiles are created by simply listing the required options.
+type QuirksProfile struct {
+	Name    string
+	Options []Option
+}
+
+var (
+	// QuirksDynamics targets Microsoft Dynamics NAV/AX endpoints. These expect the full method URI as
+	// quoted SOAPAction and empty elements to be self-closed.
+	// The action passed to Client.Do must therefore be the full method URI, e.g.
+	// "urn:microsoft-dynamics-schemas/page/customer:Read".
+	QuirksDynamics = QuirksProfile{
+		Name: "dynamics",
+		Options: []Option{
+			WithSOAPActionFormatter(QuoteSOAPAction),
+			WithEmptyElements(EmptyElementsSelfClosing),
+		},
+	}
+	// QuirksAxis1 targets classic Apache Axis 1.x endpoints, which require a quoted SOAPAction header
+	// and fail to parse self-closed elements in some deserializers.
+	QuirksAxis1 = QuirksProfile{
+		Name: "axis1",
+		Options: []Option{
+			WithSOAPActionFormatter(QuoteSOAPAction),
+			WithEmptyElements(EmptyElementsExpanded),
+		},
+	}
+)
+
+// WithQuirks applies the options of all given profiles in order.
+func WithQuirks(profiles ...QuirksProfile) Option {
+	return func(s *settings) error {
+		for _, p := range profiles {
+			for _, opt := range p.Options {
+				if err := opt(s); err != nil {
+					return fmt.Errorf("quirks profile %s: %w", p.Name, err)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// WithSOAPActionFormatter sets a function converting the action passed to Client.Do into the
+// value of the SOAPAction HTTP header.
+func WithSOAPActionFormatter(format func(action string) string) Option {
+	return func(s *settings) error {
+		s.actionFormat = format
+		return nil
+	}
+}
+
+// QuoteSOAPAction formats the SOAPAction header as quoted string, as required by the SOAP 1.1 specification.
+func QuoteSOAPAction(action string) string {
+	return strconv.Quote(action)
+}
+
+// WithEmptyElements sets how elements without content are serialized in requests. Signatures are computed
+// over the canonical form, which is the same for self-closing and expanded elements and does not hold omitted
+// elements.
+func WithEmptyElements(form EmptyElementForm) Option {
+	return func(s *settings) error {
+		if form < EmptyElementsDefault || form > EmptyElementsOmitted {
+			return ErrInvalidEmptyElementForm
+		}
+		s.emptyElements = form
+		return nil
+	}
+}
+
+// formatEmptyElements rewrites the empty elements of the serialized document b into the requested form.
+// Comments, CDATA sections and processing instructions are copied unchanged.
+func formatEmptyElements(b []byte, form EmptyElementForm) []byte {
+	if form == EmptyElementsDefault {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); {
+		if b[i] != '<' {
+			out = append(out, b[i])
+			i++
+			continue
+		}
+		end := markupEnd(b, i)
+		if end < 0 {
+			// malformed input, leave the remainder alone
+			return append(out, b[i:]...)
+		}
+		tag := b[i:end]
+		switch {
+		case tag[1] == '!' || tag[1] == '?' || tag[1] == '/':
+			out = append(out, tag...)
+		case form == EmptyElementsSelfClosing && tag[len(tag)-2] != '/':
+			closing := append(append([]byte("</"), elementName(tag)...), '>')
+			if bytes.HasPrefix(b[end:], closing) {
+				out = append(out, tag[:len(tag)-1]...)
+				out = append(out, '/', '>')
+				end += len(closing)
+			} else {
+				out = append(out, tag...)
+			}
+		case form == EmptyElementsExpanded && tag[len(tag)-2] == '/':
+			out = append(out, bytes.TrimRight(tag[:len(tag)-2], " \t\r\n")...)
+			out = append(out, '>', '<', '/')
+			out = append(out, elementName(tag)...)
+			out = append(out, '>')
+		default:
+			out = append(out, tag...)
+		}
+		i = end
+	}
+	return out
+}
+
+// markupEnd returns the index after the markup starting at b[start] or -1 if it is not terminated.
+func markupEnd(b []byte, start int) int {
+	var terminator []byte
+	switch {
+	case bytes.HasPrefix(b[start:], []byte("<!--")):
+		terminator = []byte("-->")
+	case bytes.HasPrefix(b[start:], []byte("<![CDATA[")):
+		terminator = []byte("]]>")
+	case bytes.HasPrefix(b[start:], []byte("<?")):
+		terminator = []byte("?>")
+	}
+	if terminator != nil {
+		if i := bytes.Index(b[start:], terminator); i >= 0 {
+			return start + i + len(terminator)
+		}
+		return -1
+	}
+	// element tags: skip over quoted attribute values which may contain '>'
+	var quote byte
+	for i := start + 1; i < len(b); i++ {
+		switch {
+		case quote != 0:
+			if b[i] == quote {
+				quote = 0
+			}
+		case b[i] == '"' || b[i] == '\'':
+			quote = b[i]
+		case b[i] == '>':
+			return i + 1
+		}
+	}
+	return -1
+}
+
+// elementName returns the qualified name of the start tag.
+func elementName(tag []byte) []byte {
+	name := tag[1:]
+	if i := bytes.IndexAny(name, " \t\r\n/>"); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// omitZeroPointers returns a copy of the request body v without the zero values of optional pointer fields,
+// for EmptyElementsOmitted. v is returned as is if nothing is omitted.
+func omitZeroPointers(v any) any {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return v
+	}
+	if pruned, changed := pruneStruct(rv.Elem()); changed {
+		return pruned.Addr().Interface()
+	}
+	return v
+}
+
+// pruneStruct returns an addressable copy of the struct v with the zero optional pointer fields set to nil,
+// descending into nested structs, and whether anything was changed.
+func pruneStruct(v reflect.Value) (reflect.Value, bool) {
+	t := v.Type()
+	if t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType) {
+		return v, false
+	}
+	out := reflect.New(t).Elem()
+	out.Set(v)
+	changed := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() || f.Tag.Get("xml") == "-" {
+			continue
+		}
+		field := out.Field(i)
+		if pruned, ok := pruneValue(field, strings.Contains(f.Tag.Get("xml"), ",omitempty")); ok {
+			field.Set(pruned)
+			changed = true
+		}
+	}
+	return out, changed
+}
+
+// pruneValue returns the replacement of the field value v and whether it is replaced.
+func pruneValue(v reflect.Value, optional bool) (reflect.Value, bool) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v, false
+		}
+		if optional && v.Elem().IsZero() {
+			return reflect.Zero(v.Type()), true
+		}
+		if v.Elem().Kind() == reflect.Struct {
+			if pruned, ok := pruneStruct(v.Elem()); ok {
+				return pruned.Addr(), true
+			}
+		}
+	case reflect.Struct:
+		return pruneStruct(v)
+	case reflect.Slice:
+		if et := v.Type().Elem(); et.Kind() != reflect.Struct && et.Kind() != reflect.Ptr {
+			return v, false
+		}
+		var out reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			// slice elements are not optional, only their content
+			pruned, ok := pruneValue(v.Index(i), false)
+			if !ok {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+				reflect.Copy(out, v)
+			}
+			out.Index(i).Set(pruned)
+		}
+		if out.IsValid() {
+			return out, true
+		}
+	}
+	return v, false
+}
@@ -0,0 +1,171 @@
+package soap
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type capturedRequest struct {
+	header http.Header
+	body   string
+}
+
+// newCaptureServer records the incoming requests and answers with an empty response envelope.
+func newCaptureServer(t *testing.T) (*httptest.Server, *[]capturedRequest) {
+	t.Helper()
+	var captured []capturedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		captured = append(captured, capturedRequest{header: r.Header.Clone(), body: string(b)})
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><Resp/></soap:Body></soap:Envelope>`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &captured
+}
+
+type quirksRequest struct {
+	XMLName xml.Name `xml:"urn:microsoft-dynamics-schemas/page/customer Read"`
+	No      string   `xml:"No"`
+	Filter  string   `xml:"Filter"`
+	Active  bool     `xml:"Active"`
+}
+
+type quirksResponse struct {
+	XMLName xml.Name `xml:"Resp"`
+}
+
+func TestQuirksProfiles(t *testing.T) {
+	var tests = []struct {
+		name    string
+		profile QuirksProfile
+		action  string
+		body    string
+	}{
+		{
+			name:    "dynamics",
+			profile: QuirksDynamics,
+			action:  `"urn:microsoft-dynamics-schemas/page/customer:Read"`,
+			body:    `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><customer:Read xmlns:customer="urn:microsoft-dynamics-schemas/page/customer"><customer:No>10000</customer:No><customer:Filter/><customer:Active>true</customer:Active></customer:Read></soapenv:Body></soapenv:Envelope>`,
+		},
+		{
+			name:    "axis1",
+			profile: QuirksAxis1,
+			action:  `"urn:microsoft-dynamics-schemas/page/customer:Read"`,
+			body:    `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><customer:Read xmlns:customer="urn:microsoft-dynamics-schemas/page/customer"><customer:No>10000</customer:No><customer:Filter></customer:Filter><customer:Active>true</customer:Active></customer:Read></soapenv:Body></soapenv:Envelope>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, captured := newCaptureServer(t)
+			client := NewClient(srv.URL)
+			assert.NoError(t, client.SetOptions(WithQuirks(tt.profile)))
+
+			req := &quirksRequest{No: "10000", Active: true}
+			err := client.Do(context.Background(), "urn:microsoft-dynamics-schemas/page/customer:Read", req, &quirksResponse{})
+			assert.NoError(t, err)
+			if assert.Len(t, *captured, 1) {
+				assert.Equal(t, tt.action, (*captured)[0].header.Get("SOAPAction"))
+				assert.Equal(t, tt.body, (*captured)[0].body)
+			}
+		})
+	}
+}
+
+func TestCustomQuirksProfile(t *testing.T) {
+	profile := QuirksProfile{
+		Name: "custom",
+		Options: []Option{
+			WithSOAPActionFormatter(func(action string) string { return "urn:svc#" + action }),
+		},
+	}
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithQuirks(profile)))
+	assert.NoError(t, client.Do(context.Background(), "Read", &quirksRequest{}, &quirksResponse{}))
+	assert.Equal(t, "urn:svc#Read", (*captured)[0].header.Get("SOAPAction"))
+
+	err := client.SetOptions(WithQuirks(QuirksProfile{Name: "broken", Options: []Option{WithEmptyElements(42)}}))
+	assert.ErrorIs(t, err, ErrInvalidEmptyElementForm)
+}
+
+func TestFormatEmptyElements(t *testing.T) {
+	var tests = []struct {
+		in   string
+		form EmptyElementForm
+		out  string
+	}{
+		{`<a><b></b></a>`, EmptyElementsDefault, `<a><b></b></a>`},
+		{`<a><b></b></a>`, EmptyElementsSelfClosing, `<a><b/></a>`},
+		{`<a><b x="1>2"></b><c>t</c></a>`, EmptyElementsSelfClosing, `<a><b x="1>2"/><c>t</c></a>`},
+		{`<a><b></bb></a>`, EmptyElementsSelfClosing, `<a><b></bb></a>`},
+		{`<a><![CDATA[<b></b>]]><!-- <c></c> --></a>`, EmptyElementsSelfClosing, `<a><![CDATA[<b></b>]]><!-- <c></c> --></a>`},
+		{`<a><b x="1" /><c/></a>`, EmptyElementsExpanded, `<a><b x="1"></b><c></c></a>`},
+		{`<a><b></b></a>`, EmptyElementsExpanded, `<a><b></b></a>`},
+	}
+	for i, tt := range tests {
+		if res := string(formatEmptyElements([]byte(tt.in), tt.form)); res != tt.out {
+			t.Errorf("#%d: mismatch\nhave: `%s`\nwant: `%s`", i, res, tt.out)
+		}
+	}
+}
+
+type optionalNotes struct {
+	Text string `xml:",chardata"`
+	Lang string `xml:"lang,attr,omitempty"`
+}
+
+type omitRequest struct {
+	XMLName xml.Name       `xml:"urn:test Update"`
+	WsuID   string         `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Id,attr,omitempty"`
+	Name    *string        `xml:"Name,omitempty"`
+	Notes   *optionalNotes `xml:"Notes,omitempty"`
+	Items   []omitItem     `xml:"Item"`
+	Comment string         `xml:"Comment"`
+}
+
+type omitItem struct {
+	Note *string `xml:"Note,omitempty"`
+	Tag  *string `xml:"Tag"`
+}
+
+func TestEmptyElementsOmitted(t *testing.T) {
+	empty, name := "", "n"
+	request := &omitRequest{Name: &name, Notes: &optionalNotes{}, Items: []omitItem{{Note: &empty, Tag: &empty}}}
+	req := NewRequest("Update", "http://localhost", request, nil, nil)
+	var err error
+	req.settings, err = settings{}.apply(WithEmptyElements(EmptyElementsOmitted))
+	assert.NoError(t, err)
+	data, err := req.serialize()
+	assert.NoError(t, err)
+	// pointers without omitempty and other fields keep their elements
+	assert.Contains(t, string(data), `<_:Name>n</_:Name><_:Item><_:Tag></_:Tag></_:Item><_:Comment></_:Comment></_:Update>`)
+	// the request is not modified
+	assert.NotNil(t, request.Notes)
+	assert.Same(t, &empty, request.Items[0].Note)
+}
+
+func TestEmptyElementsSigned(t *testing.T) {
+	for _, form := range []EmptyElementForm{EmptyElementsSelfClosing, EmptyElementsExpanded, EmptyElementsOmitted} {
+		auth, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+		assert.NoError(t, err)
+		auth.SetSigning(SigningOptions{BinarySecurityToken: true})
+		req := NewRequest("Update", "http://localhost", &omitRequest{Notes: &optionalNotes{}}, nil, nil)
+		req.AddHeader(auth.Header())
+		req.settings, err = settings{}.apply(WithEmptyElements(form))
+		assert.NoError(t, err)
+		data, err := req.serialize()
+		assert.NoError(t, err)
+		assert.NoError(t, VerifySignature(data, VerifyOptions{}), form)
+		assert.Equal(t, form == EmptyElementsOmitted, !strings.Contains(string(data), "Notes"), form)
+	}
+}
@@ -0,0 +1,97 @@
+package soap
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/m29h/xml"
+)
+
+var (
+	// ErrRawUnavailable is returned decoding a RawCapture with a decoder which does not keep the bytes it reads,
+	// e.g. one of WithDecoder.
+	ErrRawUnavailable = errors.New("raw response bytes unavailable")
+)
+
+// RawCapture receives an element of a response as the exact bytes received, e.g. an element carrying an
+// enveloped signature that only verifies against the original bytes. The rest of the response is decoded as
+// usual:
+//
+//	type Response struct {
+//		XMLName xml.Name        `xml:"urn:shop OrderResponse"`
+//		ID      string          `xml:"ID"`
+//		Receipt soap.RawCapture `xml:"SignedReceipt"`
+//	}
+//
+// The bytes include the whitespace, comments and namespace prefixes of the element as sent. The declarations
+// of the prefixes on ancestors of the element are not part of them. The bytes are the ones decoded, which
+// differ from the ones sent only if WithElementNameMapper or WithUnknownEntityReplacement rewrote them, or if
+// ContinueOnFieldErrors cut a failing element out of the captured one.
+type RawCapture struct {
+	// Name is the name of the element.
+	Name xml.Name `xml:"-"`
+	// XML is the element as received.
+	XML []byte `xml:"-"`
+
+	// standalone is the element with the namespace declarations in scope, see RawXML
+	standalone RawXML
+}
+
+// Decode decodes the captured element into v.
+func (c RawCapture) Decode(v any) error {
+	return xml.Unmarshal(c.standalone, v)
+}
+
+// UnmarshalXML records the bytes of the element read by d.
+func (c *RawCapture) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	data, ok := rawInputOf(d)
+	if !ok {
+		return ErrRawUnavailable
+	}
+	// the decoder is past the start tag, which begins at the last '<' as it is not allowed in attribute values
+	begin := bytes.LastIndexByte(data.Bytes()[:d.InputOffset()], '<')
+	standalone, err := captureRaw(d, start, nil)
+	if err != nil {
+		return err
+	}
+	if begin < 0 {
+		return ErrRawUnavailable
+	}
+	c.Name = start.Name
+	c.XML = bytes.Clone(data.Bytes()[begin:d.InputOffset()])
+	c.standalone = standalone
+	return nil
+}
+
+// capturesRaw reports whether the response v may hold a RawCapture, which needs the bytes read by the decoder.
+func capturesRaw(v any) bool {
+	return v != nil && hasHooks(reflect.TypeOf(v), reflect.TypeFor[rawCapturer]())
+}
+
+// rawCapturer is implemented by RawCapture only.
+type rawCapturer interface {
+	capturesRaw()
+}
+
+func (*RawCapture) capturesRaw() {}
+
+// rawInputs maps the decoders keeping the bytes they read to the bytes, as UnmarshalXML only gets to see the
+// decoder.
+var rawInputs sync.Map
+
+// registerRawInput makes data the bytes read by the decoder until the returned function is called. The bytes
+// up to the input offset of the decoder are at the start of data.
+func registerRawInput(decoder *xml.Decoder, data *bytes.Buffer) func() {
+	rawInputs.Store(decoder, data)
+	return func() { rawInputs.Delete(decoder) }
+}
+
+func rawInputOf(decoder *xml.Decoder) (*bytes.Buffer, bool) {
+	data, ok := rawInputs.Load(decoder)
+	if !ok {
+		return nil, false
+	}
+	return data.(*bytes.Buffer), true
+}
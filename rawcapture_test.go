@@ -0,0 +1,72 @@
+package soap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type receiptResponse struct {
+	XMLName xml.Name   `xml:"urn:shop OrderResponse"`
+	ID      string     `xml:"ID"`
+	Receipt RawCapture `xml:"urn:shop SignedReceipt"`
+	Status  string     `xml:"Status"`
+}
+
+type signedReceipt struct {
+	XMLName xml.Name `xml:"urn:shop SignedReceipt"`
+	Total   string   `xml:"Total"`
+	Digest  string   `xml:"urn:sig Signature>Digest"`
+}
+
+const signedReceiptXML = `<s:SignedReceipt xmlns:d="urn:sig"  id="r1">
+		<s:Total currency="EUR">12.50</s:Total><!-- audited -->
+		<d:Signature><d:Digest>q1w2==</d:Digest></d:Signature>
+	</s:SignedReceipt>`
+
+func TestRawCapture(t *testing.T) {
+	body := `<?xml version="1.0"?>` + "\n" + `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`xmlns:s="urn:shop"><soap:Body><s:OrderResponse><s:ID>7</s:ID>` + signedReceiptXML +
+		`<s:Status>done</s:Status></s:OrderResponse></soap:Body></soap:Envelope>`
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "default"},
+		{name: "continue on field errors", opts: []Option{ContinueOnFieldErrors()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInfoServer(t, "text/xml; charset=utf-8", body)
+			client := NewClient(srv.URL)
+			require.NoError(t, client.SetOptions(tt.opts...))
+			resp := &receiptResponse{}
+			require.NoError(t, client.Do(context.Background(), "Order", &infoRequest{}, resp))
+			assert.Equal(t, "7", resp.ID)
+			assert.Equal(t, "done", resp.Status)
+			assert.Equal(t, xml.Name{Space: "urn:shop", Local: "SignedReceipt"}, resp.Receipt.Name)
+			assert.Equal(t, signedReceiptXML, string(resp.Receipt.XML))
+
+			receipt := &signedReceipt{}
+			require.NoError(t, resp.Receipt.Decode(receipt))
+			assert.Equal(t, "12.50", receipt.Total)
+			assert.Equal(t, "q1w2==", receipt.Digest)
+		})
+	}
+}
+
+func TestRawCaptureSelfClosing(t *testing.T) {
+	resp := &receiptResponse{}
+	require.NoError(t, UnmarshalResponse([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>`+
+		`<OrderResponse xmlns="urn:shop"><SignedReceipt total="a>b" /></OrderResponse></Body></Envelope>`), resp))
+	assert.Equal(t, `<SignedReceipt total="a>b" />`, string(resp.Receipt.XML))
+}
+
+func TestRawCaptureUnavailable(t *testing.T) {
+	resp := &receiptResponse{}
+	err := xml.Unmarshal([]byte(`<OrderResponse xmlns="urn:shop"><SignedReceipt/></OrderResponse>`), resp)
+	assert.ErrorIs(t, err, ErrRawUnavailable)
+}
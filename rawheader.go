@@ -0,0 +1,354 @@
+package soap
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/m29h/xml"
+)
+
+const xmlNS = "http://www.w3.org/XML/1998/namespace"
+
+// RawHeader is a SOAP header element kept as raw XML, e.g. to relay headers the application does not understand.
+// Decoded envelopes list every received header element in Header.Raw. Passed to AddHeaders, the element is
+// emitted unchanged.
+type RawHeader struct {
+	// XMLName is the name of the header element.
+	XMLName xml.Name
+	// XML is the serialized header element. The namespace declarations in scope of the element in the received
+	// envelope are declared on the element itself, so it stands alone.
+	XML []byte
+}
+
+// Decode decodes the raw header element into v.
+func (h RawHeader) Decode(v any) error {
+	return xml.Unmarshal(h.XML, v)
+}
+
+// RawXML is a serialized XML element. Used as body content or header it is written unchanged, as response
+// body content it receives the decoded element as standalone XML.
+type RawXML []byte
+
+// UnmarshalXML captures the element as raw XML.
+func (r *RawXML) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	raw, err := captureRaw(d, start, nil)
+	if err != nil {
+		return err
+	}
+	*r = raw
+	return nil
+}
+
+// body has the fields of Body without its methods.
+type body Body
+
+// MarshalXML encodes the body. RawXML content is written verbatim, the other content is serialized one by one
+// in that case.
+func (b *Body) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	// marshaled on its own the start element lacks the namespace
+	start.Name = xml.Name{Space: b.version.namespace(), Local: "Body"}
+	hasRaw := false
+	for _, c := range b.Content {
+		switch c.(type) {
+		case RawXML, *RawXML:
+			hasRaw = true
+		}
+	}
+	if !hasRaw || b.Fault != nil {
+		return e.EncodeElement((*body)(b), start)
+	}
+
+	var buf bytes.Buffer
+	for _, c := range b.Content {
+		switch v := c.(type) {
+		case RawXML:
+			buf.Write(v)
+		case *RawXML:
+			buf.Write(*v)
+		default:
+			data, err := xml.Marshal(v)
+			if err != nil {
+				return err
+			}
+			buf.Write(data)
+		}
+	}
+	return e.EncodeElement(struct {
+		WsuID string `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Id,attr,omitempty"`
+		Inner []byte `xml:",innerxml"`
+	}{b.WsuID, buf.Bytes()}, start)
+}
+
+// envelope has the fields of Envelope without its methods.
+type envelope Envelope
+
+// UnmarshalXML decodes the envelope, passing the namespace declarations of the Envelope element on to the Header.
+// A SOAP envelope of another version than expected is reported as *VersionMismatchError.
+func (e *Envelope) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := versionMismatch(e.version, start); err != nil {
+		return err
+	}
+	if e.Body != nil && e.Body.expect != nil && (start.Name.Local != "Envelope" || start.Name.Space != e.version.namespace()) {
+		// not an envelope at all, e.g. an HTML error page
+		return &UnexpectedElementError{Expected: *e.Body.expect, Got: start.Name}
+	}
+	header := e.Header
+	if header == nil {
+		header = &Header{}
+		e.Header = header
+	}
+	header.scope = namespaceDecls(nil, start.Attr)
+	var err error
+	if e.version == SOAP12 {
+		err = e.unmarshalSOAP12(d)
+	} else {
+		err = d.DecodeElement((*envelope)(e), &start)
+	}
+	if err != nil {
+		return err
+	}
+	if e.Header == header && header.XMLName.Local == "" {
+		// there was no Header element
+		e.Header = nil
+	}
+	return nil
+}
+
+// header has the fields of Header without its methods.
+type header Header
+
+// UnmarshalXML captures all header elements as RawHeader.
+func (h *Header) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	h.XMLName = start.Name
+	scope := namespaceDecls(h.scope, start.Attr)
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch elem := token.(type) {
+		case xml.StartElement:
+			raw, err := captureRaw(d, elem, scope)
+			if err != nil {
+				return err
+			}
+			h.Raw = append(h.Raw, RawHeader{XMLName: elem.Name, XML: raw})
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// MarshalXML encodes the header. If it contains raw headers, all headers are serialized one by one and written
+// verbatim, so the raw headers are not altered by the encoder.
+func (h *Header) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Space: h.version.namespace(), Local: "Header"}
+	headers := flattenHeaders(nil, h.Headers)
+	hasRaw := false
+	for _, hdr := range headers {
+		if _, ok := hdr.(RawHeader); ok {
+			hasRaw = true
+			break
+		}
+	}
+	if !hasRaw {
+		return e.EncodeElement((*header)(h), start)
+	}
+
+	var buf bytes.Buffer
+	for _, hdr := range headers {
+		if raw, ok := hdr.(RawHeader); ok {
+			buf.Write(raw.XML)
+			continue
+		}
+		data, err := xml.Marshal(hdr)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+	}
+	return e.EncodeElement(struct {
+		Inner []byte `xml:",innerxml"`
+	}{buf.Bytes()}, start)
+}
+
+// flattenHeaders appends the headers to list, expanding the slices created by AddHeaders and header builders.
+func flattenHeaders(list []any, headers []any) []any {
+	for _, hdr := range headers {
+		switch v := hdr.(type) {
+		case []any:
+			list = flattenHeaders(list, v)
+		case []RawHeader:
+			for _, raw := range v {
+				list = append(list, raw)
+			}
+		case *RawHeader:
+			if v != nil {
+				list = append(list, *v)
+			}
+		case RawXML:
+			list = append(list, RawHeader{XML: v})
+		case *RawXML:
+			if v != nil {
+				list = append(list, RawHeader{XML: *v})
+			}
+		case nil:
+		default:
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// namespaceDecls returns scope extended by the namespace declarations among attrs. A declaration of a prefix
+// replaces any outer declaration of the same prefix, the default namespace has the empty prefix.
+func namespaceDecls(scope []xml.Attr, attrs []xml.Attr) []xml.Attr {
+	decls := append([]xml.Attr(nil), scope...)
+	for _, attr := range attrs {
+		prefix, ok := declaredPrefix(attr)
+		if !ok {
+			continue
+		}
+		replaced := false
+		for i, decl := range decls {
+			if decl.Name.Local == prefix {
+				decls[i].Value = attr.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			decls = append(decls, xml.Attr{Name: xml.Name{Local: prefix}, Value: attr.Value})
+		}
+	}
+	return decls
+}
+
+// declaredPrefix returns the prefix declared by attr if it is a namespace declaration.
+func declaredPrefix(attr xml.Attr) (string, bool) {
+	if attr.Name.Space == "xmlns" {
+		return attr.Name.Local, true
+	}
+	if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+		return "", true
+	}
+	return "", false
+}
+
+// rawWriter serializes a token stream, restoring prefixes from the declarations in scope.
+type rawWriter struct {
+	buf bytes.Buffer
+	// scopes holds the declarations in scope for each open element, as prefix to namespace pairs
+	scopes [][]xml.Attr
+}
+
+// captureRaw serializes the element started by start, consuming its tokens from d. All namespace declarations of
+// scope and of the element are declared on the element.
+func captureRaw(d *xml.Decoder, start xml.StartElement, scope []xml.Attr) ([]byte, error) {
+	w := &rawWriter{}
+	decls := namespaceDecls(scope, start.Attr)
+	w.start(start, decls, decls)
+	for len(w.scopes) > 0 {
+		token, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			outer := w.scopes[len(w.scopes)-1]
+			w.start(t, namespaceDecls(outer, t.Attr), namespaceDecls(nil, t.Attr))
+		case xml.EndElement:
+			w.buf.WriteString("</" + w.qname(t.Name, false, nil) + ">")
+			w.scopes = w.scopes[:len(w.scopes)-1]
+		case xml.CharData:
+			_ = xml.EscapeText(&w.buf, t)
+		case xml.Comment:
+			w.buf.WriteString("<!--" + string(t) + "-->")
+		}
+	}
+	return w.buf.Bytes(), nil
+}
+
+// start writes the start tag of elem with the declarations own, the declarations in scope are decls.
+func (w *rawWriter) start(elem xml.StartElement, decls []xml.Attr, own []xml.Attr) {
+	w.scopes = append(w.scopes, decls)
+	var extra []xml.Attr
+	name := w.qname(elem.Name, false, &extra)
+
+	var attrs bytes.Buffer
+	for _, attr := range elem.Attr {
+		if _, ok := declaredPrefix(attr); ok {
+			continue
+		}
+		attrs.WriteString(" " + w.qname(attr.Name, true, &extra) + `="`)
+		_ = xml.EscapeText(&attrs, []byte(attr.Value))
+		attrs.WriteByte('"')
+	}
+
+	w.buf.WriteString("<" + name)
+	for _, decl := range append(own, extra...) {
+		if decl.Name.Local == "" {
+			w.buf.WriteString(` xmlns="`)
+		} else {
+			w.buf.WriteString(" xmlns:" + decl.Name.Local + `="`)
+		}
+		_ = xml.EscapeText(&w.buf, []byte(decl.Value))
+		w.buf.WriteByte('"')
+	}
+	w.buf.Write(attrs.Bytes())
+	w.buf.WriteByte('>')
+}
+
+// qname returns the prefixed name of n in the current scope. Missing declarations are added to the scope and
+// appended to extra if it is not nil.
+func (w *rawWriter) qname(n xml.Name, attr bool, extra *[]xml.Attr) string {
+	if n.Space == xmlNS {
+		return "xml:" + n.Local
+	}
+	scope := &w.scopes[len(w.scopes)-1]
+	if n.Space == "" {
+		if !attr && extra != nil && lookupPrefix(*scope, "") != "" {
+			w.declare(scope, extra, "", "")
+		}
+		return n.Local
+	}
+	if !attr && lookupPrefix(*scope, "") == n.Space {
+		return n.Local
+	}
+	for i := len(*scope) - 1; i >= 0; i-- {
+		decl := (*scope)[i]
+		if decl.Name.Local != "" && decl.Value == n.Space {
+			return decl.Name.Local + ":" + n.Local
+		}
+	}
+	if extra == nil {
+		// end tags always have a declaration from their start tag
+		return n.Local
+	}
+	prefix := fmt.Sprintf("ns%d", len(*scope))
+	w.declare(scope, extra, prefix, n.Space)
+	return prefix + ":" + n.Local
+}
+
+func (w *rawWriter) declare(scope *[]xml.Attr, extra *[]xml.Attr, prefix, space string) {
+	decl := xml.Attr{Name: xml.Name{Local: prefix}, Value: space}
+	*scope = namespaceDecls(*scope, []xml.Attr{nsAttr(prefix, space)})
+	*extra = append(*extra, decl)
+}
+
+// nsAttr returns the attribute declaring prefix for space.
+func nsAttr(prefix, space string) xml.Attr {
+	if prefix == "" {
+		return xml.Attr{Name: xml.Name{Local: "xmlns"}, Value: space}
+	}
+	return xml.Attr{Name: xml.Name{Space: "xmlns", Local: prefix}, Value: space}
+}
+
+// lookupPrefix returns the namespace bound to prefix in scope.
+func lookupPrefix(scope []xml.Attr, prefix string) string {
+	for _, decl := range scope {
+		if decl.Name.Local == prefix {
+			return decl.Value
+		}
+	}
+	return ""
+}
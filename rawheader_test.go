@@ -0,0 +1,86 @@
+package soap
+
+import (
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const relayEnvelope = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:tr="urn:trace">` +
+	`<soap:Header>` +
+	`<tr:Trace soap:mustUnderstand="1" tr:kind="tr:hop"><tr:Hop at="1">gw&amp;1</tr:Hop><Note>x</Note></tr:Trace>` +
+	`<Plain xmlns="urn:plain"><Value/></Plain>` +
+	`</soap:Header>` +
+	`<soap:Body><GetInfoResponse xmlns="urn:test"><Item>a</Item></GetInfoResponse></soap:Body></soap:Envelope>`
+
+type traceHeader struct {
+	XMLName xml.Name `xml:"urn:trace Trace"`
+	Hop     string   `xml:"urn:trace Hop"`
+	Note    string   `xml:"Note"`
+}
+
+func TestRawHeaderDecode(t *testing.T) {
+	resp := &infoResponse{}
+	env := NewEnvelope(resp)
+	assert.NoError(t, xml.Unmarshal([]byte(relayEnvelope), env))
+	assert.Equal(t, []string{"a"}, resp.Items)
+	if !assert.NotNil(t, env.Header) || !assert.Len(t, env.Header.Raw, 2) {
+		return
+	}
+
+	trace := env.Header.Raw[0]
+	assert.Equal(t, xml.Name{Space: "urn:trace", Local: "Trace"}, trace.XMLName)
+	assert.Equal(t, `<tr:Trace xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:tr="urn:trace" soap:mustUnderstand="1" tr:kind="tr:hop">`+
+		`<tr:Hop at="1">gw&amp;1</tr:Hop><Note>x</Note></tr:Trace>`, string(trace.XML))
+	var decoded traceHeader
+	assert.NoError(t, trace.Decode(&decoded))
+	assert.Equal(t, "gw&1", decoded.Hop)
+	assert.Equal(t, "x", decoded.Note)
+
+	assert.Equal(t, `<Plain xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:tr="urn:trace" xmlns="urn:plain"><Value></Value></Plain>`,
+		string(env.Header.Raw[1].XML))
+}
+
+func TestRawHeaderAbsent(t *testing.T) {
+	env := NewEnvelope(&infoResponse{})
+	assert.NoError(t, xml.Unmarshal([]byte(infoResponseBody), env))
+	assert.Nil(t, env.Header)
+}
+
+func TestRawHeaderRelay(t *testing.T) {
+	in := NewEnvelope(&infoResponse{})
+	assert.NoError(t, xml.Unmarshal([]byte(relayEnvelope), in))
+
+	out := NewEnvelope(&infoRequest{})
+	out.AddHeaders(in.Header.Raw[0], &quirksRequest{})
+	out.AddHeaders(in.Header.Raw[1:])
+	data, err := xml.Marshal(out)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), string(in.Header.Raw[0].XML)+"<")
+	assert.Contains(t, string(data), string(in.Header.Raw[1].XML)+"</soapenv:Header>")
+
+	relayed := NewEnvelope(&infoRequest{})
+	assert.NoError(t, xml.Unmarshal(data, relayed))
+	if assert.Len(t, relayed.Header.Raw, 3) {
+		assert.Equal(t, in.Header.Raw[0].XMLName, relayed.Header.Raw[0].XMLName)
+		var decoded traceHeader
+		assert.NoError(t, relayed.Header.Raw[0].Decode(&decoded))
+		assert.Equal(t, "gw&1", decoded.Hop)
+		assert.Contains(t, string(relayed.Header.Raw[0].XML), `soap:mustUnderstand="1" tr:kind="tr:hop"`)
+		assert.Equal(t, in.Header.Raw[1].XMLName, relayed.Header.Raw[2].XMLName)
+	}
+}
+
+func TestRawXMLBody(t *testing.T) {
+	env := NewEnvelope(RawXML(`<m:Order xmlns:m="urn:orders"><m:Id>1</m:Id></m:Order>`))
+	data, err := xml.Marshal(env)
+	assert.NoError(t, err)
+	assert.Equal(t, `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body>`+
+		`<m:Order xmlns:m="urn:orders"><m:Id>1</m:Id></m:Order></soapenv:Body></soapenv:Envelope>`, string(data))
+
+	var raw RawXML
+	assert.NoError(t, UnmarshalResponse(data, &raw))
+	assert.Equal(t, `<m:Order xmlns:m="urn:orders"><m:Id>1</m:Id></m:Order>`, string(raw))
+}
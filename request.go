@@ -2,10 +2,10 @@ package soap
 
 import (
 	"bytes"
+	"context"
 	"io"
-	"log"
+	"mime"
 	"net/http"
-	"os"
 
 	"github.com/m29h/xml"
 )
@@ -20,6 +20,16 @@ type Request struct {
 	body  interface{}
 	resp  interface{}
 	fault interface{}
+
+	settings       settings
+	idempotencyKey string
+	correlationID  string
+	messageID      string
+	// ctx is the context of the attempt passed to context-aware header builders
+	ctx context.Context
+	// payload is the serialized envelope once the HTTP request was built, message the body sent
+	payload []byte
+	message []byte
 }
 
 // NewRequest creates a SOAP request. This differs from a standard HTTP request in several ways.
@@ -47,43 +57,260 @@ func (r *Request) AddHeader(header ...HeaderBuilder) {
 	r.headers = append(r.headers, header...)
 }
 
-// serialize takes the data supplied in the request and serializes the SOAP data to the returned reader.
-func (r *Request) serialize() (io.Reader, error) {
-	envelope := NewEnvelope(r.body)
+// serialize takes the data supplied in the request and serializes the SOAP data to the returned bytes.
+func (r *Request) serialize() ([]byte, error) {
+	envelope, err := r.envelope()
+	if err != nil {
+		return nil, err
+	}
+	payload, _, err := r.settings.encodeEnvelope(envelope, r.action)
+	return payload, err
+}
 
-	for _, h := range r.headers {
-		header, err := h(envelope.Body)
-		if err != nil {
+// envelope builds the envelope of the request with the headers tied to the call.
+func (r *Request) envelope() (*Envelope, error) {
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	envelope, err := r.settings.buildEnvelope(ctx, r.body, r.headers)
+	if err != nil {
+		return nil, err
+	}
+	if r.messageID != "" {
+		envelope.AddHeaders(r.addressingHeaders()...)
+	}
+	if r.idempotencyKey != "" && r.settings.idempotencySOAPHeader != nil {
+		envelope.AddHeaders(r.settings.idempotencySOAPHeader(r.idempotencyKey))
+	}
+	if r.correlationID != "" && r.settings.correlationSOAPHeader != nil {
+		envelope.AddHeaders(r.settings.correlationSOAPHeader(r.correlationID))
+	}
+	return envelope, nil
+}
+
+// buildEnvelope returns the envelope of body with the headers built by builders and by the options.
+func (s *settings) buildEnvelope(ctx context.Context, body any, builders []HeaderBuilder) (*Envelope, error) {
+	envelope, err := s.requestEnvelope(body)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.buildHeaders(ctx, envelope, builders); err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+// requestEnvelope returns the envelope of the request body, prepared for encoding.
+func (s *settings) requestEnvelope(body any) (*Envelope, error) {
+	if s.emptyElements == EmptyElementsOmitted {
+		body = omitZeroPointers(body)
+	}
+	if s.formatTags {
+		var err error
+		if body, err = formatBody(body); err != nil {
 			return nil, err
 		}
+	}
+	envelope := NewEnvelope(body)
+	envelope.version = s.version
+	if err := s.sanitizeBody(envelope.Body); err != nil {
+		return nil, err
+	}
+	s.qualifyBody(envelope.Body)
+	return envelope, nil
+}
+
+// buildHeaders adds the headers built by builders and by the context-aware builders of the options to the
+// envelope.
+func (s *settings) buildHeaders(ctx context.Context, envelope *Envelope, builders []HeaderBuilder) error {
+	add := func(header any, err error) error {
+		if err != nil {
+			return err
+		}
+		if header, err = s.sanitizeHeader(header); err != nil {
+			return err
+		}
 		envelope.AddHeaders(header)
+		return nil
+	}
+	for _, h := range builders {
+		if err := add(h(envelope.Body)); err != nil {
+			return err
+		}
 	}
+	for _, h := range s.headerBuilders {
+		if err := add(h(ctx, envelope.Body)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	envelopeEnc, err := xml.Marshal(envelope)
+// encodeEnvelope serializes the envelope of a request for action, signing it if it has security headers to be
+// signed. It returns the attachments to be sent as MIME parts along with it.
+func (s *settings) encodeEnvelope(envelope *Envelope, action string) (_ []byte, parts []mtomPart, _ error) {
+	var signatures []*pendingSecurity
+	if envelope.Header != nil {
+		if err := envelope.Header.dedupHeaders(s.duplicateHeaders); err != nil {
+			return nil, nil, err
+		}
+		signatures = envelope.Header.pendingSignatures()
+		if s.headerOrder != nil {
+			if err := envelope.Header.sortHeaders(s.headerOrder); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	envelope = withHeaderPresence(envelope, s.headerPresence)
+
+	buf := new(bytes.Buffer)
+	out := io.Writer(buf)
+	if s.maxRequestBytes > 0 {
+		out = &limitWriter{w: buf, limit: s.maxRequestBytes}
+	}
+	enc, err := s.encoder(out)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if err := s.checkEncoder(enc, action); err != nil {
+		return nil, nil, err
+	}
+	if xmlEnc, ok := enc.(*xml.Encoder); ok {
+		defer registerGzip(xmlEnc, s.gzip)()
+		defer registerEnums(xmlEnc, s.enums)()
 	}
+	if xmlEnc, ok := enc.(*xml.Encoder); ok && s.packagingOf(action) != 0 {
+		w := &mtomWriter{threshold: s.mtomThreshold, ids: make(map[string]bool),
+			limit: s.maxAttachmentBytes, action: action}
+		w.plain = s.packagingOf(action) == PackagePlain
+		mtomWriters.Store(xmlEnc, w)
+		defer func() {
+			mtomWriters.Delete(xmlEnc)
+			parts = w.parts
+		}()
+	}
+	if err := enc.Encode(envelope); err != nil {
+		return nil, nil, tooLarge(err, buf.Bytes())
+	}
+	if err := enc.Flush(); err != nil {
+		return nil, nil, tooLarge(err, buf.Bytes())
+	}
+	payload := buf.Bytes()
+	if s.hoistPrefixes {
+		payload = hoistPrefixes(payload)
+	}
+	for _, sig := range signatures {
+		if payload, err = ApplySecurity(payload, sig.config); err != nil {
+			return nil, nil, err
+		}
+	}
+	payload = formatEmptyElements(payload, s.emptyElements)
+	if limit := s.maxRequestBytes; limit > 0 && int64(len(payload)) > limit {
+		// signing or expanding the empty elements grew the envelope
+		return nil, nil, &RequestTooLargeError{Limit: limit, Size: int64(len(payload))}
+	}
+	return payload, nil, nil
+}
 
-	if err := os.WriteFile("request.xml", envelopeEnc, 0666); err != nil {
-		log.Fatal(err)
+// packageEnvelope returns the message carrying the serialized envelope and the attachments sent as MIME parts,
+// and its content type. action is the action as sent, put into the content type of SOAP 1.2 messages.
+func (s *settings) packageEnvelope(payload []byte, parts []mtomPart, action string) ([]byte, string, error) {
+	contentType := "text/xml; charset=\"utf-8\""
+	if s.version == SOAP12 {
+		params := map[string]string{"charset": "utf-8"}
+		if action != "" {
+			params["action"] = action
+		}
+		contentType = mime.FormatMediaType("application/soap+xml", params)
 	}
+	if len(parts) == 0 {
+		return payload, contentType, nil
+	}
+	return encodeMTOM(payload, contentType, parts, s.digests)
+}
 
-	return bytes.NewBuffer(envelopeEnc), nil
+// encodeRequest encodes the envelope of a request for action, see Pipeline.EncodeRequest.
+func (s *settings) encodeRequest(envelope *Envelope, action string) (*EncodedRequest, error) {
+	payload, parts, err := s.encodeEnvelope(envelope, action)
+	if err != nil {
+		return nil, err
+	}
+	action = s.formatAction(action)
+	body, contentType, err := s.packageEnvelope(payload, parts, action)
+	if err != nil {
+		return nil, err
+	}
+	if body, contentType, err = s.encodeMessage(body, contentType); err != nil {
+		return nil, err
+	}
+	header := http.Header{"Content-Type": {contentType}}
+	if s.version != SOAP12 {
+		header.Set("SOAPAction", action)
+	}
+	return &EncodedRequest{Envelope: payload, Body: body, Action: action, Header: header, settings: s}, nil
+}
+
+// formatAction returns the action as sent, see WithSOAPActionFormatter.
+func (s *settings) formatAction(action string) string {
+	if s.actionFormat != nil {
+		return s.actionFormat(action)
+	}
+	return action
 }
 
 func (r *Request) httpRequest() (*http.Request, error) {
-	buf, err := r.serialize()
+	if r.settings.method() == http.MethodGet {
+		action := r.settings.formatAction(r.action)
+		endpoint, err := r.settings.withActionQuery(r.url, action)
+		if err != nil {
+			return nil, err
+		}
+		return r.getRequest(endpoint, action)
+	}
+
+	envelope, err := r.envelope()
 	if err != nil {
 		return nil, err
 	}
-
-	httpReq, err := http.NewRequest("POST", r.url, buf)
+	encoded, err := r.settings.encodeRequest(envelope, r.action)
 	if err != nil {
 		return nil, err
 	}
+	r.payload, r.message = encoded.Envelope, encoded.Body
+	httpReq, err := encoded.HTTPRequest(context.Background(), r.url)
+	if err != nil {
+		return nil, err
+	}
+	r.addHeaders(httpReq)
+	return httpReq, nil
+}
 
-	httpReq.Header.Add("Content-Type", "text/xml; charset=\"utf-8\"")
-	httpReq.Header.Add("SOAPAction", r.action)
-
+// getRequest returns the HTTP request of a GET call, without envelope. The response media type of the SOAP
+// version is asked for with the Accept header.
+func (r *Request) getRequest(endpoint, action string) (*http.Request, error) {
+	r.payload, r.message = nil, nil
+	httpReq, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.settings.overrideHost(httpReq)
+	if r.settings.version == SOAP12 {
+		httpReq.Header.Add("Accept", "application/soap+xml")
+	} else {
+		httpReq.Header.Add("Accept", "text/xml")
+		httpReq.Header.Add("SOAPAction", action)
+	}
+	r.addHeaders(httpReq)
 	return httpReq, nil
 }
+
+// addHeaders sets the idempotency and correlation headers of the call.
+func (r *Request) addHeaders(httpReq *http.Request) {
+	if r.idempotencyKey != "" && r.settings.idempotencyHeader != "" {
+		httpReq.Header.Set(r.settings.idempotencyHeader, r.idempotencyKey)
+	}
+	if r.correlationID != "" && r.settings.correlationHeader != "" {
+		httpReq.Header.Set(r.settings.correlationHeader, r.correlationID)
+	}
+}
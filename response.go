@@ -1,19 +1,112 @@
 package soap
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"mime"
+	"net"
 	"net/http"
 	"strings"
-
-	"github.com/m29h/xml"
 )
 
+// HTTPError is returned if the server answered with a non-2xx HTTP status and no SOAP fault.
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	// Method and URL identify the request. Passwords in the URL are redacted.
+	Method string
+	URL    string
+	// Header holds the response headers.
+	Header http.Header
+	// Attempt is the number of the attempt that received the response, starting at 1.
+	Attempt int
+	// Err is the transport error that occurred reading the response body, if any.
+	Err error
+}
+
+// newHTTPError returns the error for the response of attempt with an error status. err is the error reading
+// the response, it is kept if it is a transport error.
+func newHTTPError(httpResp *http.Response, attempt int, err error) *HTTPError {
+	e := &HTTPError{StatusCode: httpResp.StatusCode, Status: httpResp.Status, Header: httpResp.Header, Attempt: attempt}
+	if httpResp.Request != nil {
+		e.Method = httpResp.Request.Method
+		e.URL = httpResp.Request.URL.Redacted()
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		e.Err = err
+	}
+	return e
+}
+
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("unexpected HTTP status: %s", e.Status)
+	if e.URL != "" {
+		msg += fmt.Sprintf(" (%s %s, attempt %d)", e.Method, e.URL, e.Attempt)
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the status is a gateway timeout or reading the response timed out.
+func (e *HTTPError) Timeout() bool {
+	return e.StatusCode == http.StatusGatewayTimeout || e.localTimeout()
+}
+
+// Temporary reports whether the status indicates that the call may succeed later: 429, 503 and 504.
+func (e *HTTPError) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// localTimeout reports whether reading the response timed out.
+func (e *HTTPError) localTimeout() bool {
+	return e.Err != nil && timeout(e.Err)
+}
+
 // Response contains the result of the request.
 type Response struct {
 	*http.Response
 
 	body  interface{}
 	fault *Fault
+
+	// info receives the statistics of the response if not nil
+	info *ResponseInfo
+	// raw holds the envelope read by the default decoder if it is kept, see rawBuffer
+	raw *bytes.Buffer
+	// path tracks the elements read by the default decoder
+	path     *pathTracker
+	settings settings
+	// formatted is the shadow value the body is decoded into with WithFormatTags
+	formatted any
+	// attempt is the number of the attempt that received the response
+	attempt int
+	// replaced is the number of characters replaced by WithInvalidCharacterReplacement
+	replaced int
+	// partial is set if the body held response content along with the fault
+	partial bool
+	// partialFault is the fault decoded in part from an envelope failing to decode, decodeErr the error
+	// decoding the response
+	partialFault *Fault
+	decodeErr    error
+	// trailing is the data following the envelope if it is more than whitespace
+	trailing []byte
+	// confirmations are the SignatureValues of the request to be confirmed, see WithSignatureConfirmation
+	confirmations []string
 }
 
 func newResponse(httpResp *http.Response, req *Request) *Response {
@@ -33,32 +126,296 @@ func (r *Response) Fault() *Fault {
 	return r.fault
 }
 
+// newDecoder returns the decoder used for the envelope. Field errors of the default decoder carry the element path.
+func (r *Response) newDecoder(rd io.Reader) SOAPDecoder {
+	if r.settings.newDecoder != nil {
+		return r.settings.newDecoder(rd)
+	}
+	dec := newPathDecoder(rd, r.rawBuffer())
+	dec.gzip = r.settings.gzip
+	dec.enums = r.settings.enums
+	dec.Entity = r.settings.entities
+	r.raw = dec.data
+	r.path = dec.path
+	return dec
+}
+
+// rawBuffer returns the buffer the default decoder keeps the envelope in, nil if nothing needs the envelope as
+// read: the response verification, the drift detector and RawCapture fields of the response.
+func (r *Response) rawBuffer() *bytes.Buffer {
+	s := &r.settings
+	if s.responseVerification == nil && s.drift == nil && !capturesRaw(r.body) && !capturesRaw(r.formatted) {
+		return nil
+	}
+	if s.decodeBuffer != nil {
+		return s.decodeBuffer
+	}
+	return &bytes.Buffer{}
+}
+
+// decoder returns the decoder for rd or an error if a custom factory failed to create one.
+func (r *Response) decoder(rd io.Reader) (SOAPDecoder, error) {
+	dec := r.newDecoder(r.settings.mapNames(rd))
+	if dec == nil {
+		return nil, ErrNilCodec
+	}
+	return dec, nil
+}
+
 func (r *Response) deserialize() error {
+	body := io.Reader(r.Response.Body)
+	var counter *countingReader
+	if r.info != nil {
+		counter = &countingReader{r: body}
+		body = counter
+		defer r.collectInfo(counter)
+	}
+	var err error
+	if r.Response, body, err = r.settings.decodeMessage(r.Response, body); err != nil {
+		return err
+	}
+
+	body, gwErr, err := sniffBody(body, r.Response, r.attempt)
+	if err != nil {
+		return err
+	}
+	if gwErr != nil && !gwErr.markup {
+		return gwErr
+	}
+	if err := wrongEndpoint(body, r.Response, r.attempt); err != nil {
+		return err
+	}
+	if acknowledged(r.Response, body) {
+		return nil
+	}
 	mediaType, mediaParams, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
 	if err != nil {
 		return err
 	}
 
-	envelope := NewEnvelope(r.body)
+	envelope := r.newEnvelope()
+	if err := r.readEnvelope(body, mediaType, mediaParams, envelope); err != nil {
+		if f := envelope.Body.Fault; f != nil && f.Code != "" {
+			r.partialFault = f
+		}
+		return gwErr.decodeError(err)
+	}
+	return r.handleEnvelope(envelope)
+}
 
+// decode decodes the response to a request for action into the response content, see
+// Pipeline.DecodeResponse.
+func (r *Response) decode(ctx context.Context, action string) error {
+	err := r.deserialize()
+	r.decodeErr = err
+	if r.settings.responseTee != nil {
+		// the tee gets the complete body
+		_, _ = io.Copy(io.Discard, r.Response.Body)
+	}
+	if r.Fault() != nil {
+		if r.partial {
+			return &PartialResponseError{Fault: r.fault}
+		}
+		return r.Fault()
+	}
+	if errors.Is(err, ErrVersionMismatch) || errors.Is(err, ErrGatewayResponse) || errors.Is(err, ErrWrongEndpoint) {
+		// a server rejecting the version answers with an error status, report the cause instead; gateway and
+		// wrong endpoint errors wrap the HTTPError of the status
+		return err
+	}
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return newHTTPError(r.Response, r.attempt, err)
+	}
+	if err != nil {
+		return err
+	}
+	if r.settings.responseVerification != nil {
+		if err := r.verifySignature(); err != nil {
+			return err
+		}
+	}
+	if err := afterDecode(ctx, r.body); err != nil {
+		return err
+	}
+	if r.settings.drift != nil && r.raw != nil {
+		r.settings.drift.observe(action, r.raw.Bytes())
+	}
+
+	return partialFailure(r.body)
+}
+
+// readEnvelope decodes the envelope read from body, a message of the media type with its parameters, into
+// envelope.
+func (r *Response) readEnvelope(body io.Reader, mediaType string, mediaParams map[string]string, envelope *Envelope) error {
 	if strings.HasPrefix(mediaType, "multipart/") {
 		// Here we handle any SOAP requests embedded in a MIME multipart response.
-		err = newXopDecoder(r.Response.Body, mediaParams).decode(envelope)
-	} else if strings.Contains(mediaType, "text/xml") {
+		xopDec := newXopDecoder(body, mediaParams)
+		xopDec.newDecoder = func(rd io.Reader) (SOAPDecoder, error) {
+			return r.decoder(r.settings.replaceEntities(rd))
+		}
+		xopDec.store = r.settings.attachments
+		xopDec.digests = r.settings.digests
+		err := xopDec.decode(envelope)
+		if r.info != nil {
+			r.info.Attachments = xopDec.attachments
+		}
+		return err
+	} else if soapMediaType(mediaType) {
 		// This is normal SOAP XML response handling.
-		err = xml.NewDecoder(r.Response.Body).Decode(&envelope)
-	} else {
-		err = ErrUnsupportedContentType
+		return r.decodeXML(body, envelope)
 	}
+	return ErrUnsupportedContentType
+}
 
-	if err != nil {
-		return err
-	}
+// soapMediaType reports whether the media type is the one of a plain SOAP 1.1 or 1.2 envelope.
+func soapMediaType(mediaType string) bool {
+	return strings.Contains(mediaType, "text/xml") || mediaType == "application/soap+xml"
+}
 
+// handleEnvelope takes the fault and the body of the decoded envelope and checks its headers.
+func (r *Response) handleEnvelope(envelope *Envelope) error {
+	if r.info != nil && envelope.Header != nil {
+		r.info.SOAPHeaders = envelope.Header.Raw
+	}
 	// Propagate the changes from parsing the envelope to the response struct
 	if envelope.Body.Fault != nil {
 		r.fault = envelope.Body.Fault
+		r.partial = envelope.Body.partial
+		if r.partial && r.formatted != nil {
+			return r.unformat(r.formatted)
+		}
+		return nil
+	}
+	if r.formatted != nil {
+		if err := r.unformat(r.formatted); err != nil {
+			return err
+		}
 	}
 
+	if r.settings.mustUnderstand != MustUnderstandIgnore && envelope.Header != nil {
+		notUnderstood := r.settings.notUnderstood(envelope.Header.Raw)
+		if r.info != nil {
+			r.info.NotUnderstood = notUnderstood
+		}
+		if len(notUnderstood) > 0 && r.settings.mustUnderstand == MustUnderstandReject {
+			return &MustUnderstandError{Headers: notUnderstood}
+		}
+	}
 	return nil
 }
+
+// acknowledged reports whether the response is a 202 Accepted without content, the acknowledgment of a
+// one-way request or of a request answered asynchronously. Such a response leaves the response body alone.
+func acknowledged(httpResp *http.Response, body io.Reader) bool {
+	br, ok := body.(*bufio.Reader)
+	if httpResp.StatusCode != http.StatusAccepted || !ok {
+		return false
+	}
+	_, err := br.Peek(1)
+	return err == io.EOF
+}
+
+// UnmarshalResponse decodes the serialized SOAP envelope data into the response argument, the same way
+// Client.Do handles a plain XML response. A SOAP fault contained in the envelope is returned as error, as are
+// item faults reported by a PartialFaults response.
+func UnmarshalResponse(data []byte, response any) error {
+	r := &Response{body: response}
+	envelope := NewEnvelope(response)
+	if err := r.decodeXML(bytes.NewReader(data), envelope); err != nil {
+		return err
+	}
+	if envelope.Body.Fault != nil && envelope.Body.partial {
+		return &PartialResponseError{Fault: envelope.Body.Fault}
+	}
+	if envelope.Body.Fault != nil {
+		return envelope.Body.Fault
+	}
+	return partialFailure(response)
+}
+
+// newEnvelope returns the envelope to decode the response into.
+func (r *Response) newEnvelope() *Envelope {
+	body := r.body
+	if r.formatted = r.formatTarget(); r.formatted != nil {
+		body = r.formatted
+	}
+	envelope := NewEnvelope(body)
+	envelope.version = r.settings.version
+	envelope.Body.lenientFaults = r.settings.lenientFaults
+	envelope.Body.strictFaults = r.settings.strictFaults
+	envelope.Body.languages = r.settings.languages
+	envelope.Body.expect = r.settings.expectedBodyElement(r.body)
+	return envelope
+}
+
+// decodeXML decodes the plain XML envelope read from rd.
+func (r *Response) decodeXML(rd io.Reader, envelope *Envelope) error {
+	rd, err := trimProlog(rd)
+	if err != nil {
+		return err
+	}
+	// the data following a body of unknown length is not drained, the server may keep sending
+	doc := newDocumentReader(rd)
+	defer func() { r.trailing = doc.trailing(r.Response == nil || r.Response.ContentLength >= 0) }()
+	rd = r.settings.replaceInvalidCharacters(doc, &r.replaced)
+	if r.compiledApplies(envelope) {
+		data, err := io.ReadAll(rd)
+		if err != nil {
+			return err
+		}
+		r.raw = bytes.NewBuffer(data)
+		if r.settings.compiled.decode(data, r.settings.version, r.settings.entities, r.body) {
+			envelope.Header, envelope.Body.Fault = nil, nil
+			return nil
+		}
+		rd = bytes.NewReader(data)
+	}
+	rd = r.settings.replaceEntities(rd)
+	if r.settings.strictSequence {
+		// the names are mapped by the check here and by the decoding below
+		data, err := io.ReadAll(rd)
+		if err != nil {
+			return err
+		}
+		if err := checkSequence(data, envelope.Body.Content, r.settings.elementNameMapper, r.settings.entities); err != nil {
+			return err
+		}
+		rd = bytes.NewReader(data)
+	}
+	if r.settings.continueOnFieldErrors && r.settings.newDecoder == nil {
+		data, err := io.ReadAll(r.settings.mapNames(rd))
+		if err != nil {
+			return err
+		}
+		r.raw = bytes.NewBuffer(data)
+		return r.decodeTolerant(data, envelope)
+	}
+	dec, err := r.decoder(rd)
+	if err != nil {
+		return err
+	}
+	return dec.Decode(&envelope)
+}
+
+// compiledApplies reports whether the envelope is decoded with the compiled decoder of WithCompiledDecoder,
+// which leaves the options changing the decoding to the regular way.
+func (r *Response) compiledApplies(envelope *Envelope) bool {
+	s := &r.settings
+	return s.compiled != nil && s.newDecoder == nil && s.elementNameMapper == nil && !s.strictSequence &&
+		!s.continueOnFieldErrors && !s.replaceUnknownEntities && envelope.Body.expect == nil && r.formatted == nil
+}
+
+// collectInfo copies the statistics gathered while deserializing into the response info.
+func (r *Response) collectInfo(counter *countingReader) {
+	r.info.StatusCode = r.StatusCode
+	r.info.Header = r.Header
+	r.info.BytesRead = counter.n
+	r.info.InvalidCharacters = r.replaced
+	r.info.TrailingData = r.trailing
+	switch {
+	case r.raw != nil:
+		r.info.Elements = countElements(r.raw.Bytes())
+	case r.path != nil:
+		r.info.Elements = r.path.elements
+	}
+}
@@ -0,0 +1,128 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPError(t *testing.T) {
+	srv, _ := newFlakyServer(t, 3, http.StatusServiceUnavailable)
+	err := NewClient(srv.URL+"/service").Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+		WithRetry(RetryPolicy{MaxAttempts: 2, Backoff: fastRetry.Backoff}), MarkIdempotent("GetInfo"))
+	var httpErr *HTTPError
+	if assert.ErrorAs(t, err, &httpErr) {
+		assert.Equal(t, http.MethodPost, httpErr.Method)
+		assert.Equal(t, srv.URL+"/service", httpErr.URL)
+		assert.Equal(t, 2, httpErr.Attempt)
+		assert.NotNil(t, httpErr.Header)
+		assert.True(t, httpErr.Temporary())
+		assert.False(t, httpErr.Timeout())
+		assert.Nil(t, errors.Unwrap(httpErr))
+		assert.Contains(t, err.Error(), "(POST "+srv.URL+"/service, attempt 2)")
+	}
+}
+
+func TestHTTPErrorClassification(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		err       error
+		temporary bool
+		timeout   bool
+	}{
+		{name: "too many requests", status: http.StatusTooManyRequests, temporary: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, temporary: true},
+		{name: "gateway timeout", status: http.StatusGatewayTimeout, temporary: true, timeout: true},
+		{name: "internal error", status: http.StatusInternalServerError},
+		{name: "read timeout", status: http.StatusBadGateway, err: context.DeadlineExceeded, timeout: true},
+		{name: "syntax error", status: http.StatusBadGateway, err: errors.New("XML syntax error")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpResp := &http.Response{
+				StatusCode: tt.status,
+				Status:     http.StatusText(tt.status),
+				Request:    &http.Request{Method: http.MethodPost, URL: &url.URL{Scheme: "https", Host: "example.org", User: url.UserPassword("u", "secret")}},
+			}
+			httpErr := newHTTPError(httpResp, 1, tt.err)
+			assert.Equal(t, tt.temporary, httpErr.Temporary())
+			assert.Equal(t, tt.timeout, httpErr.Timeout())
+			assert.Equal(t, tt.timeout && tt.status != http.StatusGatewayTimeout, timeout(httpErr))
+			assert.NotContains(t, httpErr.URL, "secret")
+			if tt.err == context.DeadlineExceeded {
+				assert.ErrorIs(t, httpErr, context.DeadlineExceeded)
+			} else {
+				assert.Nil(t, httpErr.Unwrap())
+			}
+		})
+	}
+	assert.ErrorIs(t, newHTTPError(&http.Response{StatusCode: 502}, 1, io.ErrUnexpectedEOF), io.ErrUnexpectedEOF)
+}
+
+type dripResponse struct {
+	XMLName xml.Name `xml:"urn:test DripResponse"`
+	Items   []string `xml:"Item"`
+}
+
+func TestCancelDuringDecode(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<DripResponse xmlns="urn:test">`)
+		// the response drips in until the client gives up
+		for {
+			if _, err := io.WriteString(w, strings.Repeat("<Item>x</Item>", 100)); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err := NewClient(srv.URL).Do(ctx, "Drip", &infoRequest{}, &dripResponse{})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// cancelingElement cancels the call while it is decoded.
+type cancelingElement struct {
+	cancel func()
+}
+
+func (c *cancelingElement) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	c.cancel()
+	return d.Skip()
+}
+
+func TestCancelBufferedBody(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+		`<DripResponse xmlns="urn:test"><First/>`+strings.Repeat("<Item>x</Item>", 20000)+`</DripResponse></soap:Body></soap:Envelope>`)
+	ctx, cancel := context.WithCancel(context.Background())
+	resp := &struct {
+		XMLName xml.Name         `xml:"urn:test DripResponse"`
+		First   cancelingElement `xml:"First"`
+		Items   []string         `xml:"Item"`
+	}{First: cancelingElement{cancel: cancel}}
+	err := NewClient(srv.URL).Do(ctx, "Drip", &infoRequest{}, resp)
+	assert.ErrorIs(t, err, context.Canceled)
+	// the decoding stopped within the buffered part of the body
+	assert.Less(t, len(resp.Items), 1000)
+}
@@ -0,0 +1,60 @@
+package soap
+
+import "errors"
+
+// Implements the verification of the WS-Security signatures of the responses of the client, with the
+// confirmation of the signatures of the requests (WS-Security 1.1 SignatureConfirmation) on demand.
+
+// WithResponseVerification verifies the signature of the envelopes of the responses with VerifySignature and
+// opts, the clock of the client being the default of opts.Clock. Responses failing the verification or
+// unsigned fail the call; faults are returned unverified. The envelope is verified as decoded by the default
+// decoder, combined with WithDecoderFactory the options fail with ErrCodecOption. opts has to set Roots or
+// Certificate, otherwise any key signing the responses would be trusted.
+func WithResponseVerification(opts VerifyOptions) Option {
+	return func(s *settings) error {
+		if opts.Roots == nil && opts.Certificate == nil {
+			return errors.New("response verification without Roots or Certificate trusts any signing key")
+		}
+		s.responseVerification = &opts
+		return nil
+	}
+}
+
+// WithSignatureConfirmation requires the responses to confirm the signatures of the requests with
+// wsse11:SignatureConfirmation elements, see VerifyOptions.SignatureConfirmations, or to confirm the request
+// was sent unsigned. A mismatch fails the call with ErrSignatureConfirmationMismatch. It applies together
+// with WithResponseVerification; DecodeResponse of a Pipeline does not know the request and leaves the
+// confirmations unchecked.
+func WithSignatureConfirmation() Option {
+	return func(s *settings) error {
+		s.confirmSignatures = true
+		return nil
+	}
+}
+
+// requestSignatures returns the SignatureValues the response to the envelope has to confirm.
+func requestSignatures(envelope []byte) ([]string, error) {
+	if envelope == nil {
+		return []string{""}, nil
+	}
+	values, err := SignatureValues(envelope)
+	if err != nil || len(values) > 0 {
+		return values, err
+	}
+	return []string{""}, nil
+}
+
+// verifySignature verifies the signature of the envelope read, see WithResponseVerification.
+func (r *Response) verifySignature() error {
+	if r.raw == nil {
+		return ErrNoSignature
+	}
+	opts := *r.settings.responseVerification
+	if opts.Clock == nil {
+		opts.Clock = r.settings.timeSource()
+	}
+	if r.settings.confirmSignatures && r.confirmations != nil {
+		opts.SignatureConfirmations = r.confirmations
+	}
+	return VerifySignature(r.raw.Bytes(), opts)
+}
@@ -0,0 +1,129 @@
+package soap
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSigningServer answers with the info response signed with cfg, confirming the values returned by confirm
+// for the SignatureValues of the request.
+func newSigningServer(t *testing.T, cfg SecurityConfig, confirm func(values []string) []string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		values, err := SignatureValues(body)
+		require.NoError(t, err)
+		cfg := cfg
+		if confirm != nil {
+			cfg.SignatureConfirmations = confirm(values)
+		}
+		signed, err := ApplySecurity([]byte(infoResponseBody), cfg)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write(signed)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSignatureConfirmation(t *testing.T) {
+	cfg := securityConfig(t)
+	signed := WithHeaderBuilder(func(context.Context, any) (any, error) { return &pendingSecurity{config: cfg}, nil })
+	echo := func(values []string) []string {
+		if len(values) == 0 {
+			return []string{""}
+		}
+		return values
+	}
+	tests := []struct {
+		name    string
+		confirm func(values []string) []string
+		options []Option
+		err     error
+	}{
+		{name: "confirmed", confirm: echo, options: []Option{signed}},
+		{name: "unsigned request", confirm: echo},
+		{name: "not confirmed", options: []Option{signed}, err: ErrSignatureConfirmationMismatch},
+		{name: "other value", confirm: func([]string) []string { return []string{"b3RoZXI="} }, options: []Option{signed},
+			err: ErrSignatureConfirmationMismatch},
+		{name: "unsigned as signed", confirm: func([]string) []string { return []string{""} }, options: []Option{signed},
+			err: ErrSignatureConfirmationMismatch},
+	}
+	verified := WithResponseVerification(VerifyOptions{Certificate: testCertificate(t), CurrentTime: testSigningTime})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newSigningServer(t, cfg, tt.confirm)
+			client := NewClient(srv.URL)
+			require.NoError(t, client.SetOptions(verified, WithSignatureConfirmation()))
+			resp := &infoResponse{}
+			err := client.Do(context.Background(), "GetInfo", &infoRequest{}, resp, tt.options...)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, []string{"a", "b"}, resp.Items)
+		})
+	}
+}
+
+func TestResponseVerification(t *testing.T) {
+	verified := WithResponseVerification(VerifyOptions{Certificate: testCertificate(t), CurrentTime: testSigningTime})
+	// without WithSignatureConfirmation the confirmations are not checked
+	srv := newSigningServer(t, securityConfig(t), nil)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(verified))
+	assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+
+	unsigned := newInfoServer(t, "text/xml", infoResponseBody)
+	client = NewClient(unsigned.URL)
+	require.NoError(t, client.SetOptions(verified))
+	assert.ErrorIs(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}), ErrNoSignature)
+
+	// responses signed with another key are rejected
+	attacker := newSigningServer(t, attackerConfig(t), nil)
+	client = NewClient(attacker.URL)
+	require.NoError(t, client.SetOptions(verified))
+	assert.ErrorIs(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}), ErrInvalidSignature)
+
+	// without a trust anchor any key would verify
+	assert.Error(t, client.SetOptions(WithResponseVerification(VerifyOptions{})))
+}
+
+func TestVerifyConfirmations(t *testing.T) {
+	cfg := securityConfig(t)
+	cfg.SignatureConfirmations = []string{"dmFsdWU="}
+	signed, err := ApplySecurity([]byte(infoResponseBody), cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(signed), `<wsse11:SignatureConfirmation xmlns:wsse11="http://docs.oasis-open.org/wss/oasis-wss-wssecurity-secext-1.1.xsd"`)
+
+	confirming := func(values ...string) VerifyOptions {
+		return VerifyOptions{CurrentTime: testSigningTime, SignatureConfirmations: append([]string{}, values...)}
+	}
+	assert.NoError(t, VerifySignature(signed, confirming("dmFsdWU=")))
+	assert.NoError(t, VerifySignature(signed, VerifyOptions{CurrentTime: testSigningTime}))
+	assert.ErrorIs(t, VerifySignature(signed, confirming()), ErrSignatureConfirmationMismatch)
+	assert.ErrorIs(t, VerifySignature(signed, confirming("dmFsdWU=", "dmFsdWU=")),
+		ErrSignatureConfirmationMismatch)
+
+	// confirmations not signed are rejected
+	tampered := strings.Replace(string(signed), "</wsse:Security>", `<wsse11:SignatureConfirmation `+
+		`xmlns:wsse11="http://docs.oasis-open.org/wss/oasis-wss-wssecurity-secext-1.1.xsd" Value="b3RoZXI="/></wsse:Security>`, 1)
+	err = VerifySignature([]byte(tampered), confirming("dmFsdWU=", "b3RoZXI="))
+	assert.ErrorIs(t, err, ErrSignatureConfirmationMismatch)
+	assert.ErrorContains(t, err, "not signed")
+
+	// the signature values of the request are returned as sent
+	values, err := SignatureValues(signed)
+	require.NoError(t, err)
+	require.Len(t, values, 1)
+	assert.NotEmpty(t, values[0])
+}
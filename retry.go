@@ -0,0 +1,175 @@
+package soap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Implements automatic retries of failed calls.
+// Actions are considered non-idempotent unless marked otherwise, and non-idempotent actions are only retried
+// if the request provably never reached the server or was rejected with a throttled fault.
+
+// RetryPolicy configures automatic retries of failed calls.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one.
+	MaxAttempts int
+	// Backoff returns the delay before the given attempt, starting with 2 for the first retry.
+	// If nil, ExponentialBackoff(100*time.Millisecond, 5*time.Second) is used.
+	Backoff func(attempt int) time.Duration
+}
+
+// ExponentialBackoff returns a backoff doubling the delay starting from base for every attempt, capped at max.
+func ExponentialBackoff(base time.Duration, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		d := base
+		for i := 2; i < attempt && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// WithRetry enables automatic retries of failed calls.
+func WithRetry(policy RetryPolicy) Option {
+	return func(s *settings) error {
+		if policy.Backoff == nil {
+			policy.Backoff = ExponentialBackoff(100*time.Millisecond, 5*time.Second)
+		}
+		s.retry = &policy
+		return nil
+	}
+}
+
+// MarkIdempotent marks the actions as idempotent. Idempotent actions are also retried on timeouts,
+// transport errors after the request was sent, FaultRetryable faults, and on HTTP 429 and 5xx responses.
+func MarkIdempotent(actions ...string) Option {
+	return func(s *settings) error {
+		idempotent := make(map[string]bool, len(s.idempotentActions)+len(actions))
+		for a := range s.idempotentActions {
+			idempotent[a] = true
+		}
+		for _, a := range actions {
+			idempotent[a] = true
+		}
+		s.idempotentActions = idempotent
+		return nil
+	}
+}
+
+// WithIdempotencyClassifier sets a callback deciding if an action is idempotent. It takes precedence over
+// the actions marked with MarkIdempotent.
+func WithIdempotencyClassifier(isIdempotent func(action string) bool) Option {
+	return func(s *settings) error {
+		s.isIdempotent = isIdempotent
+		return nil
+	}
+}
+
+// WithIdempotencyKey generates a key once per call to Client.Do and sends it unchanged with every attempt.
+// The key is sent as HTTP header httpHeader if it is not empty, and as SOAP header element returned by
+// soapHeader if that is not nil. The key is a random UUID.
+func WithIdempotencyKey(httpHeader string, soapHeader func(key string) any) Option {
+	return func(s *settings) error {
+		s.idempotencyHeader = httpHeader
+		s.idempotencySOAPHeader = soapHeader
+		s.idempotencyKey = true
+		return nil
+	}
+}
+
+// idempotent reports whether action may safely be sent more than once.
+func (s *settings) idempotent(action string) bool {
+	if s.isIdempotent != nil {
+		return s.isIdempotent(action)
+	}
+	return s.idempotentActions[action]
+}
+
+// retryable reports whether the call of action failing with err may be attempted again.
+func (s *settings) retryable(action string, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrPartialFailure) {
+		return false
+	}
+	if requestNotSent(err) {
+		return true
+	}
+	// a throttled fault rejects the request before it is processed, any other may come after its effects
+	class, faulted := s.faultClass(err)
+	if faulted && class == FaultThrottled {
+		return true
+	}
+	if !s.idempotent(action) {
+		return false
+	}
+	if faulted {
+		return class == FaultRetryable
+	}
+
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// requestNotSent reports whether err guarantees that the request never reached the server.
+// This is the case for DNS failures, refused connections and failed TLS handshakes, including the
+// verification of the server certificate.
+func requestNotSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var handshakeErr *tlsHandshakeError
+	var certErr *tls.CertificateVerificationError
+	var pinErr *CertificatePinError
+	if errors.As(err, &handshakeErr) || errors.As(err, &certErr) || errors.As(err, &pinErr) {
+		return true
+	}
+	var recordErr tls.RecordHeaderError
+	return errors.As(err, &recordErr)
+}
+
+// tlsHandshakeError marks the error of a request whose connection failed in the TLS handshake, before the
+// request was written. Its message is the one of the error.
+type tlsHandshakeError struct {
+	err error
+}
+
+func (e *tlsHandshakeError) Error() string {
+	return e.err.Error()
+}
+
+func (e *tlsHandshakeError) Unwrap() error {
+	return e.err
+}
+
+// sleep waits for d on clock or until ctx is done.
+func sleep(ctx context.Context, clock Clock, d time.Duration) error {
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
+
+func newIdempotencyKey() string {
+	return uuid.New().String()
+}
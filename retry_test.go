@@ -0,0 +1,177 @@
+package soap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type idempotencyHeader struct {
+	XMLName xml.Name `xml:"urn:test IdempotencyKey"`
+	Value   string   `xml:",chardata"`
+}
+
+// newFlakyServer fails the first failures requests with status and answers successfully afterwards.
+func newFlakyServer(t *testing.T, failures int, status int) (*httptest.Server, *[]*http.Request) {
+	t.Helper()
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if len(requests) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+var fastRetry = RetryPolicy{
+	MaxAttempts: 3,
+	Backoff:     func(int) time.Duration { return time.Millisecond },
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	srv, requests := newFlakyServer(t, 2, http.StatusServiceUnavailable)
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithRetry(fastRetry)))
+
+	err := client.Do(context.Background(), "CreateOrder", &infoRequest{}, &infoResponse{})
+	var httpErr *HTTPError
+	if assert.ErrorAs(t, err, &httpErr) {
+		assert.Equal(t, http.StatusServiceUnavailable, httpErr.StatusCode)
+	}
+	assert.Len(t, *requests, 1)
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	srv, requests := newFlakyServer(t, 2, http.StatusServiceUnavailable)
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithRetry(fastRetry), MarkIdempotent("GetInfo")))
+
+	var info ResponseInfo
+	resp := &infoResponse{}
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, resp, WithResponseInfo(&info))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, resp.Items)
+	assert.Len(t, *requests, 3)
+	assert.Equal(t, 3, info.Attempt)
+
+	// the classifier takes precedence
+	*requests = nil
+	err = client.Do(context.Background(), "GetInfo", &infoRequest{}, resp,
+		WithIdempotencyClassifier(func(action string) bool { return false }))
+	assert.Error(t, err)
+	assert.Len(t, *requests, 1)
+}
+
+func TestRetryRequestNotSent(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	client := NewClient("http://" + addr)
+	var info ResponseInfo
+	err = client.Do(context.Background(), "CreateOrder", &infoRequest{}, &infoResponse{},
+		WithRetry(fastRetry), WithResponseInfo(&info))
+	assert.Error(t, err)
+	assert.True(t, requestNotSent(err))
+	assert.Equal(t, 3, info.Attempt)
+}
+
+func TestRetryTLSHandshake(t *testing.T) {
+	untrusted := newTLSInfoServer(t, false)
+	// a TLS 1.2 server rejects the missing client certificate in the handshake
+	clientAuth := httptest.NewUnstartedServer(http.NotFoundHandler())
+	clientAuth.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MaxVersion: tls.VersionTLS12}
+	clientAuth.StartTLS()
+	t.Cleanup(clientAuth.Close)
+	roots := x509.NewCertPool()
+	roots.AddCert(clientAuth.Certificate())
+	trusted := NewClient(clientAuth.URL)
+	require.NoError(t, trusted.SetOptions(WithRootCAs(roots)))
+
+	for _, client := range []*Client{NewClient(untrusted.URL), trusted} {
+		var info ResponseInfo
+		err := client.Do(context.Background(), "CreateOrder", &infoRequest{}, &infoResponse{},
+			WithRetry(fastRetry), WithResponseInfo(&info))
+		assert.Error(t, err)
+		assert.True(t, requestNotSent(err), err)
+		assert.Equal(t, 3, info.Attempt)
+	}
+}
+
+func TestRetryContextCancel(t *testing.T) {
+	srv, requests := newFlakyServer(t, 5, http.StatusServiceUnavailable)
+	client := NewClient(srv.URL)
+	ctx, cancel := context.WithCancel(context.Background())
+	policy := RetryPolicy{MaxAttempts: 5, Backoff: func(int) time.Duration {
+		cancel()
+		return time.Hour
+	}}
+
+	start := time.Now()
+	err := client.Do(ctx, "GetInfo", &infoRequest{}, &infoResponse{}, WithRetry(policy), MarkIdempotent("GetInfo"))
+	assert.Error(t, err)
+	assert.Len(t, *requests, 1)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	var keys []string
+	var bodies []string
+	srv, _ := newCaptureServer(t)
+	original := srv.Config.Handler
+	attempts := 0
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		original.ServeHTTP(w, r)
+	})
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(
+		WithRetry(fastRetry),
+		MarkIdempotent("CreateOrder"),
+		WithIdempotencyKey("Idempotency-Key", func(key string) any {
+			bodies = append(bodies, key)
+			return idempotencyHeader{Value: key}
+		}),
+	))
+
+	err := client.Do(context.Background(), "CreateOrder", &infoRequest{}, &quirksResponse{})
+	assert.NoError(t, err)
+	if assert.Len(t, keys, 2) {
+		assert.NotEmpty(t, keys[0])
+		assert.Equal(t, keys[0], keys[1])
+		assert.Equal(t, []string{keys[0], keys[0]}, bodies)
+	}
+
+	err = client.Do(context.Background(), "CreateOrder", &infoRequest{}, &quirksResponse{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, keys[0], keys[len(keys)-1])
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(100*time.Millisecond, time.Second)
+	assert.Equal(t, 100*time.Millisecond, backoff(2))
+	assert.Equal(t, 200*time.Millisecond, backoff(3))
+	assert.Equal(t, 400*time.Millisecond, backoff(4))
+	assert.Equal(t, time.Second, backoff(10))
+}
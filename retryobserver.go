@@ -0,0 +1,177 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// RetryReason classifies the failure of an attempt.
+type RetryReason int
+
+const (
+	// RetryReasonOther is any failure not covered by the other reasons.
+	RetryReasonOther RetryReason = iota
+	// RetryReasonNotSent is a failure guaranteeing the request never reached the server, e.g. a refused connection.
+	RetryReasonNotSent
+	// RetryReasonNetwork is a network error after the request may have been sent.
+	RetryReasonNetwork
+	// RetryReasonStatus is an HTTP error status without SOAP fault.
+	RetryReasonStatus
+	// RetryReasonFault is a SOAP fault, AttemptInfo.FaultClass holds its class.
+	RetryReasonFault
+	// RetryReasonVersionMismatch is a SOAP version mismatch, retried with the other version with AutoNegotiate.
+	RetryReasonVersionMismatch
+	// RetryReasonCanceled is the end of the call context.
+	RetryReasonCanceled
+	// RetryReasonCircuitOpen is an attempt rejected by the circuit breaker, see WithCircuitBreaker.
+	RetryReasonCircuitOpen
+)
+
+func (r RetryReason) String() string {
+	switch r {
+	case RetryReasonOther:
+		return "other"
+	case RetryReasonNotSent:
+		return "not sent"
+	case RetryReasonNetwork:
+		return "network"
+	case RetryReasonStatus:
+		return "status"
+	case RetryReasonFault:
+		return "fault"
+	case RetryReasonVersionMismatch:
+		return "version mismatch"
+	case RetryReasonCanceled:
+		return "canceled"
+	case RetryReasonCircuitOpen:
+		return "circuit open"
+	}
+	return fmt.Sprintf("RetryReason(%d)", int(r))
+}
+
+// AttemptInfo describes a failed attempt and what happens next.
+type AttemptInfo struct {
+	Action string
+	// Endpoint is the URL of the service, with passwords redacted.
+	Endpoint string
+	// Attempt is the number of the failed attempt, starting at 1.
+	Attempt int
+	Reason  RetryReason
+	// StatusCode is the HTTP status code of the response, zero if none was received.
+	StatusCode int
+	// FaultClass is the class of the fault if Reason is RetryReasonFault.
+	FaultClass FaultClass
+	// Backoff is the delay before the next attempt. It is zero when giving up.
+	Backoff time.Duration
+	// Exhausted is set when giving up because the retry policy allows no more attempts.
+	Exhausted bool
+	Err       error
+}
+
+// RetryObserver is notified of the retry decisions of calls.
+type RetryObserver interface {
+	// OnAttempt is called after a failed attempt that is going to be retried, before waiting for the backoff.
+	OnAttempt(info AttemptInfo)
+	// OnGiveUp is called when a call fails, after its last attempt.
+	OnGiveUp(info AttemptInfo)
+}
+
+// WithRetryObserver notifies observer of the retry decisions of every call.
+func WithRetryObserver(observer RetryObserver) Option {
+	return func(s *settings) error {
+		s.retryObserver = observer
+		return nil
+	}
+}
+
+// observeAttempt reports the retry of the current attempt failed with err.
+func (cl *call) observeAttempt(err error, endpoint string, backoff time.Duration) {
+	if cl.settings.retryObserver == nil {
+		return
+	}
+	info := cl.attemptInfo(err, endpoint)
+	info.Backoff = backoff
+	cl.settings.retryObserver.OnAttempt(info)
+}
+
+// observeGiveUp reports the failure of the call with err.
+func (cl *call) observeGiveUp(err error, endpoint string) {
+	if cl.settings.retryObserver == nil {
+		return
+	}
+	info := cl.attemptInfo(err, endpoint)
+	info.Exhausted = cl.settings.retry != nil && cl.attempt >= cl.settings.retry.MaxAttempts
+	cl.settings.retryObserver.OnGiveUp(info)
+}
+
+func (cl *call) attemptInfo(err error, endpoint string) AttemptInfo {
+	info := AttemptInfo{Action: cl.action, Endpoint: redactURL(endpoint), Attempt: cl.attempt, Err: err}
+	if cl.info != nil {
+		info.StatusCode = cl.info.StatusCode
+	}
+	var httpErr *HTTPError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrCircuitOpen):
+		info.Reason = RetryReasonCircuitOpen
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		info.Reason = RetryReasonCanceled
+	case requestNotSent(err):
+		info.Reason = RetryReasonNotSent
+	case errors.Is(err, ErrVersionMismatch):
+		info.Reason = RetryReasonVersionMismatch
+	case errors.As(err, &httpErr):
+		info.Reason = RetryReasonStatus
+		info.StatusCode = httpErr.StatusCode
+	case errors.Is(err, ErrSoapFault):
+		info.Reason = RetryReasonFault
+		info.FaultClass, _ = cl.settings.faultClass(err)
+	case errors.As(err, &netErr):
+		info.Reason = RetryReasonNetwork
+	}
+	return info
+}
+
+// RetryLogger is a RetryObserver logging retries at info level and calls giving up at warning level.
+type RetryLogger struct {
+	Logger *slog.Logger
+}
+
+// OnAttempt logs the retry of an attempt.
+func (l RetryLogger) OnAttempt(info AttemptInfo) {
+	l.Logger.LogAttrs(context.Background(), slog.LevelInfo, "soap call retried", info.attrs()...)
+}
+
+// OnGiveUp logs a failed call.
+func (l RetryLogger) OnGiveUp(info AttemptInfo) {
+	l.Logger.LogAttrs(context.Background(), slog.LevelWarn, "soap call gave up", info.attrs()...)
+}
+
+func (info AttemptInfo) attrs() []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("action", info.Action),
+		slog.String("endpoint", info.Endpoint),
+		slog.Int("attempt", info.Attempt),
+		slog.String("reason", info.Reason.String()),
+	}
+	if info.StatusCode != 0 {
+		attrs = append(attrs, slog.Int("status", info.StatusCode))
+	}
+	if info.Reason == RetryReasonFault {
+		attrs = append(attrs, slog.String("fault_class", info.FaultClass.String()))
+	}
+	if info.Backoff > 0 {
+		attrs = append(attrs, slog.Duration("backoff", info.Backoff))
+	}
+	if info.Exhausted {
+		attrs = append(attrs, slog.Bool("exhausted", true))
+	}
+	if info.Err != nil {
+		attrs = append(attrs, slog.String("error", info.Err.Error()))
+	}
+	return attrs
+}
@@ -0,0 +1,95 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingObserver records the retry decisions.
+type recordingObserver struct {
+	attempts []AttemptInfo
+	giveUps  []AttemptInfo
+}
+
+func (o *recordingObserver) OnAttempt(info AttemptInfo) { o.attempts = append(o.attempts, info) }
+func (o *recordingObserver) OnGiveUp(info AttemptInfo)  { o.giveUps = append(o.giveUps, info) }
+
+const busyFault = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+	`<faultcode>soap:Server.Busy</faultcode><faultstring>busy</faultstring></soap:Fault></soap:Body></soap:Envelope>`
+
+func TestRetryObserver(t *testing.T) {
+	t.Run("retried status", func(t *testing.T) {
+		srv, _ := newFlakyServer(t, 2, http.StatusServiceUnavailable)
+		observer := &recordingObserver{}
+		err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+			WithRetry(fastRetry), MarkIdempotent("GetInfo"), WithRetryObserver(observer))
+		assert.NoError(t, err)
+		if assert.Len(t, observer.attempts, 2) {
+			for i, info := range observer.attempts {
+				assert.Equal(t, i+1, info.Attempt)
+				assert.Equal(t, RetryReasonStatus, info.Reason)
+				assert.Equal(t, http.StatusServiceUnavailable, info.StatusCode)
+				assert.Equal(t, time.Millisecond, info.Backoff)
+				assert.Equal(t, srv.URL, info.Endpoint)
+				assert.Equal(t, "GetInfo", info.Action)
+			}
+		}
+		assert.Empty(t, observer.giveUps)
+	})
+
+	t.Run("exhausted fault", func(t *testing.T) {
+		srv := newInfoServer(t, "text/xml", busyFault)
+		observer := &recordingObserver{}
+		err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+			WithRetry(fastRetry), WithRetryObserver(observer))
+		assert.ErrorIs(t, err, ErrSoapFault)
+		assert.Len(t, observer.attempts, 2)
+		if assert.Len(t, observer.giveUps, 1) {
+			info := observer.giveUps[0]
+			assert.Equal(t, 3, info.Attempt)
+			assert.Equal(t, RetryReasonFault, info.Reason)
+			assert.Equal(t, FaultThrottled, info.FaultClass)
+			assert.Equal(t, http.StatusOK, info.StatusCode)
+			assert.True(t, info.Exhausted)
+			assert.Zero(t, info.Backoff)
+		}
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		srv, _ := newFlakyServer(t, 1, http.StatusServiceUnavailable)
+		observer := &recordingObserver{}
+		err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+			WithRetry(fastRetry), WithRetryObserver(observer))
+		assert.Error(t, err)
+		assert.Empty(t, observer.attempts)
+		if assert.Len(t, observer.giveUps, 1) {
+			assert.False(t, observer.giveUps[0].Exhausted)
+			assert.Equal(t, RetryReasonStatus, observer.giveUps[0].Reason)
+		}
+	})
+}
+
+func TestRetryLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := RetryLogger{Logger: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))}
+	logger.OnAttempt(AttemptInfo{Action: "GetInfo", Endpoint: "http://svc", Attempt: 1, Reason: RetryReasonStatus,
+		StatusCode: 503, Backoff: time.Second})
+	logger.OnGiveUp(AttemptInfo{Action: "GetInfo", Endpoint: "http://svc", Attempt: 2, Reason: RetryReasonFault,
+		FaultClass: FaultThrottled, Exhausted: true})
+	assert.Equal(t, `level=INFO msg="soap call retried" action=GetInfo endpoint=http://svc attempt=1 reason=status status=503 backoff=1s
+level=WARN msg="soap call gave up" action=GetInfo endpoint=http://svc attempt=2 reason=fault fault_class=throttled exhausted=true
+`, buf.String())
+}
@@ -0,0 +1,258 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the sanitation of outgoing envelopes from characters not allowed in XML 1.0 and invalid UTF-8.
+// The body content and headers are filtered on their way into the encoder, values are copied where they
+// change, so the caller's structs are left alone and signatures are computed over the sanitized body.
+
+var (
+	// ErrInvalidChar is returned if a request contains a character not allowed in XML or invalid UTF-8 and
+	// sanitation is set to SanitizeError. The returned error is an *InvalidCharError.
+	ErrInvalidChar = errors.New("invalid XML character")
+)
+
+// SanitizeMode selects the handling of characters not allowed in XML 1.0 and invalid UTF-8 in requests.
+type SanitizeMode int
+
+const (
+	// SanitizeError fails the call with *InvalidCharError before it is sent.
+	SanitizeError SanitizeMode = iota + 1
+	// SanitizeStrip removes the characters.
+	SanitizeStrip
+	// SanitizeReplace replaces the characters with U+FFFD.
+	SanitizeReplace
+)
+
+// InvalidCharError reports the first character of a request not allowed in XML.
+type InvalidCharError struct {
+	// Path is the path of the string, starting with the name of the body or header type, e.g.
+	// "CreateOrder.Customer.Name" or "CreateOrder.Items[2]".
+	Path string
+	// Offset is the byte offset of the character in the string.
+	Offset int
+	// Rune is the invalid character, utf8.RuneError for invalid UTF-8.
+	Rune rune
+}
+
+func (e *InvalidCharError) Error() string {
+	if e.Rune == utf8.RuneError {
+		return fmt.Sprintf("invalid UTF-8 at offset %d of %s", e.Offset, e.Path)
+	}
+	return fmt.Sprintf("invalid XML character %U at offset %d of %s", e.Rune, e.Offset, e.Path)
+}
+
+func (e *InvalidCharError) Unwrap() error {
+	return ErrInvalidChar
+}
+
+// WithSanitizer checks all strings of the request body and headers, including RawXML, for characters not
+// allowed in XML 1.0 and invalid UTF-8. Values encoding themselves with MarshalXML are not inspected.
+func WithSanitizer(mode SanitizeMode) Option {
+	return func(s *settings) error {
+		s.sanitize = mode
+		return nil
+	}
+}
+
+// sanitizeBody sanitizes the body content if enabled. The content is replaced, not modified.
+func (s *settings) sanitizeBody(body *Body) error {
+	if s.sanitize == 0 {
+		return nil
+	}
+	content := make([]any, len(body.Content))
+	for i, c := range body.Content {
+		var err error
+		if content[i], err = (sanitizer{s.sanitize}).sanitize(c); err != nil {
+			return err
+		}
+	}
+	body.Content = content
+	return nil
+}
+
+// sanitizeHeader returns the header sanitized if enabled.
+func (s *settings) sanitizeHeader(header any) (any, error) {
+	if s.sanitize == 0 {
+		return header, nil
+	}
+	return (sanitizer{s.sanitize}).sanitize(header)
+}
+
+var marshalerType = reflect.TypeOf((*xml.Marshaler)(nil)).Elem()
+
+// sanitizer filters the values of a request.
+type sanitizer struct {
+	mode SanitizeMode
+}
+
+// sanitize returns v with all strings sanitized. v is returned unchanged if nothing had to be sanitized.
+func (s sanitizer) sanitize(v any) (any, error) {
+	if v == nil {
+		return v, nil
+	}
+	rv := reflect.ValueOf(v)
+	t := rv.Type()
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	out, changed, err := s.value(rv, t.Name())
+	if err != nil || !changed {
+		return v, err
+	}
+	return out.Interface(), nil
+}
+
+// value returns a copy of v with the strings sanitized if any changed.
+func (s sanitizer) value(v reflect.Value, path string) (reflect.Value, bool, error) {
+	if v.Type().Implements(marshalerType) || reflect.PointerTo(v.Type()).Implements(marshalerType) {
+		return v, false, nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		text, changed, err := s.text(v.String(), path)
+		if !changed || err != nil {
+			return v, false, err
+		}
+		out := reflect.New(v.Type()).Elem()
+		out.SetString(text)
+		return out, true, nil
+	case reflect.Slice:
+		if v.IsNil() {
+			return v, false, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			text, changed, err := s.text(string(v.Bytes()), path)
+			if !changed || err != nil {
+				return v, false, err
+			}
+			out := reflect.New(v.Type()).Elem()
+			out.SetBytes([]byte(text))
+			return out, true, nil
+		}
+		var out reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			elem, changed, err := s.value(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return v, false, err
+			}
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+				reflect.Copy(out, v)
+			}
+			out.Index(i).Set(elem)
+		}
+		return s.result(v, out)
+	case reflect.Array:
+		var out reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			elem, changed, err := s.value(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return v, false, err
+			}
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.New(v.Type()).Elem()
+				out.Set(v)
+			}
+			out.Index(i).Set(elem)
+		}
+		return s.result(v, out)
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v, false, nil
+		}
+		elem, changed, err := s.value(v.Elem(), path)
+		if !changed || err != nil {
+			return v, false, err
+		}
+		if v.Kind() == reflect.Interface {
+			out := reflect.New(v.Type()).Elem()
+			out.Set(elem)
+			return out, true, nil
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(elem)
+		return out, true, nil
+	case reflect.Struct:
+		var out reflect.Value
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if !field.IsExported() || strings.Split(field.Tag.Get("xml"), ",")[0] == "-" {
+				continue
+			}
+			elem, changed, err := s.value(v.Field(i), path+"."+field.Name)
+			if err != nil {
+				return v, false, err
+			}
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.New(v.Type()).Elem()
+				out.Set(v)
+			}
+			out.Field(i).Set(elem)
+		}
+		return s.result(v, out)
+	}
+	return v, false, nil
+}
+
+// result returns out if it was created for a change, v otherwise.
+func (s sanitizer) result(v, out reflect.Value) (reflect.Value, bool, error) {
+	if !out.IsValid() {
+		return v, false, nil
+	}
+	return out, true, nil
+}
+
+// text returns text with the characters not allowed in XML sanitized, and whether it changed.
+func (s sanitizer) text(text string, path string) (string, bool, error) {
+	var b strings.Builder
+	changed := false
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		valid := !(r == utf8.RuneError && size == 1) && allowedChar(r)
+		if !valid {
+			if s.mode == SanitizeError {
+				return "", false, &InvalidCharError{Path: path, Offset: i, Rune: r}
+			}
+			if !changed {
+				b.WriteString(text[:i])
+				changed = true
+			}
+			if s.mode == SanitizeReplace {
+				b.WriteRune(utf8.RuneError)
+			}
+		} else if changed {
+			b.WriteString(text[i : i+size])
+		}
+		i += size
+	}
+	if !changed {
+		return text, false, nil
+	}
+	return b.String(), true, nil
+}
+
+// allowedChar reports whether r is a character allowed in XML 1.0.
+func allowedChar(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
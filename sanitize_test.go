@@ -0,0 +1,126 @@
+package soap
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sanitizeCustomer struct {
+	Name string   `xml:"Name"`
+	Tags []string `xml:"Tag"`
+	Note string   `xml:"note,attr,omitempty"`
+}
+
+type sanitizeOrder struct {
+	XMLName  xml.Name          `xml:"urn:test Order"`
+	ID       string            `xml:"ID"`
+	Customer *sanitizeCustomer `xml:"Customer"`
+	Internal string            `xml:"-"`
+}
+
+type sanitizeHeader struct {
+	XMLName xml.Name `xml:"urn:test Trace"`
+	Value   string   `xml:",chardata"`
+}
+
+// encodeRune returns the UTF-8 style encoding of r, which is invalid UTF-8 for surrogates.
+func encodeRune(r rune) string {
+	if r < 0xD800 || r > 0xDFFF {
+		return string(r)
+	}
+	return string([]byte{0xE0 | byte(r>>12), 0x80 | byte(r>>6)&0x3F, 0x80 | byte(r)&0x3F})
+}
+
+// serializeSanitized serializes the order with the sanitation mode.
+func serializeSanitized(t *testing.T, mode SanitizeMode, order *sanitizeOrder) ([]byte, error) {
+	t.Helper()
+	req := NewRequest("Order", "", order, nil, nil)
+	req.AddHeader(func(any) (any, error) { return sanitizeHeader{Value: "h\x01"}, nil })
+	var err error
+	req.settings, err = settings{}.apply(WithSanitizer(mode))
+	assert.NoError(t, err)
+	return req.serialize()
+}
+
+func TestSanitizeIllegalRanges(t *testing.T) {
+	ranges := []struct{ lower, upper rune }{
+		{0x00, 0x08},
+		{0x0B, 0x0C},
+		{0x0E, 0x1F},
+		{0xD800, 0xDFFF},
+		{0xFFFE, 0xFFFF},
+	}
+	for _, rng := range ranges {
+		for _, r := range []rune{rng.lower, (rng.lower + rng.upper) / 2, rng.upper} {
+			t.Run(fmt.Sprintf("%U", r), func(t *testing.T) {
+				name := "a" + encodeRune(r) + "b"
+				order := &sanitizeOrder{ID: "1", Customer: &sanitizeCustomer{Name: "ok", Tags: []string{"x", name}}}
+
+				_, err := serializeSanitized(t, SanitizeError, order)
+				var charErr *InvalidCharError
+				if assert.ErrorAs(t, err, &charErr) {
+					assert.ErrorIs(t, err, ErrInvalidChar)
+					assert.Equal(t, "sanitizeOrder.Customer.Tags[1]", charErr.Path)
+					assert.Equal(t, 1, charErr.Offset)
+					if r >= 0xD800 && r <= 0xDFFF {
+						assert.Equal(t, utf8.RuneError, charErr.Rune)
+					} else {
+						assert.Equal(t, r, charErr.Rune)
+					}
+				}
+
+				for mode, want := range map[SanitizeMode]string{SanitizeStrip: "ab", SanitizeReplace: "a�b"} {
+					data, err := serializeSanitized(t, mode, order)
+					if !assert.NoError(t, err) {
+						continue
+					}
+					decoded := &sanitizeOrder{}
+					assert.NoError(t, UnmarshalResponse(data, decoded))
+					// surrogates are invalid UTF-8 of three bytes, each replaced by its own U+FFFD
+					if mode == SanitizeReplace && r >= 0xD800 && r <= 0xDFFF {
+						want = "a" + strings.Repeat("�", 3) + "b"
+					}
+					assert.Equal(t, []string{"x", want}, decoded.Customer.Tags)
+					assert.Equal(t, "ok", decoded.Customer.Name)
+				}
+				// the caller's value is left alone
+				assert.Equal(t, name, order.Customer.Tags[1])
+			})
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	order := &sanitizeOrder{ID: "1\x0b", Customer: &sanitizeCustomer{Name: "\xffJo", Note: "n\x1f"}, Internal: "\x00"}
+
+	_, err := serializeSanitized(t, SanitizeError, order)
+	assert.EqualError(t, err, "invalid XML character U+000B at offset 1 of sanitizeOrder.ID")
+
+	order.ID = "1"
+	_, err = serializeSanitized(t, SanitizeError, order)
+	assert.EqualError(t, err, "invalid UTF-8 at offset 0 of sanitizeOrder.Customer.Name")
+
+	data, err := serializeSanitized(t, SanitizeStrip, order)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `Name>Jo</`)
+	assert.Contains(t, string(data), `note="n"`)
+	assert.Contains(t, string(data), `>h</`)
+	assert.Equal(t, "\xffJo", order.Customer.Name)
+
+	// raw XML passes the encoder unescaped
+	sanitized, err := (sanitizer{SanitizeReplace}).sanitize(RawXML("<a>\x0c</a>"))
+	assert.NoError(t, err)
+	assert.Equal(t, RawXML("<a>�</a>"), sanitized)
+
+	// values without invalid characters are not copied
+	clean := &sanitizeOrder{ID: "1"}
+	sanitized, err = (sanitizer{SanitizeStrip}).sanitize(clean)
+	assert.NoError(t, err)
+	assert.Same(t, clean, sanitized)
+}
@@ -0,0 +1,515 @@
+package soap
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/m29h/xml"
+)
+
+// Implements the signing of serialized envelopes. The signed elements are located in the envelope bytes, which
+// are kept as they are apart from the wsu:Id attributes added to signed elements lacking one. The Security
+// header is inserted into the bytes as well, so envelopes can be signed apart from sending them. WSSEAuthInfo
+// signs the requests of the client the same way once they are encoded.
+
+// SecurityConfig configures the signature ApplySecurity adds to an envelope.
+type SecurityConfig struct {
+	// Certificate is the signing certificate with its RSA private key, e.g. loaded with tls.LoadX509KeyPair.
+	Certificate tls.Certificate
+	// Header is the placement of the signed Security header.
+	Header SecurityHeaderOptions
+	// Signing selects the elements signed and the layout of the Security header.
+	Signing SigningOptions
+	// Created is the creation time of the wsu:Timestamp. If zero, the current time of Clock is used.
+	Created time.Time
+	// Expires is the expiry time of the wsu:Timestamp. If zero, the timestamp expires 10 seconds after Created.
+	Expires time.Time
+	// Clock is the clock providing the current time. Default is the system clock.
+	Clock Clock
+	// NewID generates the wsu:Id values of the timestamp, the token and the signed elements lacking one.
+	// Default are random UUIDs.
+	NewID func() string
+	// SignatureConfirmations are the SignatureValues of a request confirmed by the signed response with
+	// wsse11:SignatureConfirmation elements, "" for the confirmation of a request sent unsigned. See
+	// SignatureValues.
+	SignatureConfirmations []string
+}
+
+func (c SecurityConfig) newID() string {
+	if c.NewID != nil {
+		return c.NewID()
+	}
+	return getWsuID()
+}
+
+// timestamp returns the wsu:Timestamp of the Security header.
+func (c SecurityConfig) timestamp(id string) timestamp {
+	created := c.Created
+	if created.IsZero() && c.Clock != nil {
+		created = c.Clock.Now()
+	} else if created.IsZero() {
+		created = time.Now()
+	}
+	expires := c.Expires
+	if expires.IsZero() {
+		expires = created.Add(timestampValidity)
+	}
+	return timestamp{
+		WsuID:   id,
+		Created: c.Signing.TimestampPrecision.Format(created),
+		Expires: c.Signing.TimestampPrecision.Format(expires),
+	}
+}
+
+// ApplySecurity signs the serialized envelope with the certificate of cfg and returns it with the signed
+// wsse:Security header. The body, the timestamp and, with Signing.SignHeaders, the headers are signed.
+//
+// The signature elements are inserted at the start of the Security header targeted at the actor of
+// cfg.Header if the envelope has one already, otherwise a new Security header is inserted as the first header.
+// The mustUnderstand and actor or role attributes of a new header use the namespace of the envelope version,
+// cfg.Header.Version is ignored. All bytes outside the Security headers are kept, except for the wsu:Id
+// attributes added to the signed elements lacking one.
+func ApplySecurity(envelope []byte, cfg SecurityConfig) ([]byte, error) {
+	key, ok := cfg.Certificate.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%w: signing key is not RSA", ErrUnsupportedAlgorithm)
+	}
+	layout, err := scanEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+	if layout.body == nil {
+		return nil, ErrUnableToSignEmptyEnvelope
+	}
+
+	// the ids are generated in the order of the elements signed: the headers, the body, the timestamp, the
+	// signature confirmations, then the token
+	var edits []edit
+	var headerIDs []string
+	if cfg.Signing.SignHeaders {
+		for _, h := range layout.headers {
+			if cfg.Signing.excludes(h.name) {
+				continue
+			}
+			id, e := h.ensureID(cfg.newID)
+			edits = append(edits, e...)
+			headerIDs = append(headerIDs, id)
+		}
+	}
+	bodyID, e := layout.body.ensureID(cfg.newID)
+	edits = append(edits, e...)
+
+	// the digests are taken over the elements as sent, with their ids
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(applyEdits(envelope, edits)); err != nil {
+		return nil, err
+	}
+	ids, err := elementsByID(doc.Root())
+	if err != nil {
+		return nil, err
+	}
+	ts := cfg.timestamp(cfg.newID())
+	tsData, err := xml.Marshal(ts)
+	if err != nil {
+		return nil, err
+	}
+	tsCanonical, err := Canonicalize(tsData)
+	if err != nil {
+		return nil, err
+	}
+	refs := []signatureReference{newReference(bodyID, canonicalize(ids[bodyID])), newReference(ts.WsuID, tsCanonical)}
+	for _, id := range headerIDs {
+		refs = append(refs, newReference(id, canonicalize(ids[id])))
+	}
+	confirmations := make([]signatureConfirmation, len(cfg.SignatureConfirmations))
+	for i, value := range cfg.SignatureConfirmations {
+		confirmations[i] = signatureConfirmation{WsuID: cfg.newID(), Value: value}
+		data, err := xml.Marshal(confirmations[i])
+		if err != nil {
+			return nil, err
+		}
+		canonical, err := Canonicalize(data)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, newReference(confirmations[i].WsuID, canonical))
+	}
+
+	info := signedInfo{
+		CanonicalizationMethod: canonicalizationMethod{
+			Algorithm: canonicalizationExclusiveC14N,
+		},
+		SignatureMethod: signatureMethod{
+			Algorithm: rsaSha256Sig,
+		},
+		Reference: refs,
+	}
+	infoData, err := xml.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	infoCanonical, err := Canonicalize(infoData)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(infoCanonical)
+	signatureValue, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	tokenID := cfg.newID()
+	sec := security{
+		Timestamp: ts,
+		Signature: signature{
+			SignedInfo:     info,
+			SignatureValue: base64.StdEncoding.EncodeToString(signatureValue),
+			KeyInfo: keyInfo{
+				SecurityTokenReference: securityTokenReference{
+					Reference: strReference{
+						ValueType: valTypeX509Token,
+						URI:       "#" + tokenID,
+					},
+				},
+			},
+		},
+		Confirmations: confirmations,
+		order:         cfg.Signing.order(),
+	}
+	version := SOAP11
+	if layout.envelope.name.Space == soap12EnvNS {
+		version = SOAP12
+	}
+	placement := cfg.Header
+	placement.Version = version
+
+	if cfg.Signing.BinarySecurityToken {
+		token := newToken(cfg.Certificate, tokenID)
+		if cfg.Signing.TokenHeader == nil {
+			sec.Token = token
+		} else {
+			tokenHeader := *cfg.Signing.TokenHeader
+			tokenHeader.Version = version
+			e, err := layout.insertSecurity(tokenHeader, security{Token: token, order: []SecurityElement{SecurityToken}})
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, e...)
+		}
+	}
+	e, err = layout.insertSecurity(placement, sec)
+	if err != nil {
+		return nil, err
+	}
+	return applyEdits(envelope, append(edits, e...)), nil
+}
+
+// newReference returns the reference to the element with the wsu:Id id and the exclusive canonical form data.
+func newReference(id string, data []byte) signatureReference {
+	digest := sha256.Sum256(data)
+	return signatureReference{
+		URI: "#" + id,
+		Transforms: transforms{
+			Transform: transform{
+				Algorithm: canonicalizationExclusiveC14N,
+			},
+		},
+		DigestMethod: digestMethod{
+			Algorithm: sha256Sig,
+		},
+		DigestValue: digestValue{
+			Value: base64.StdEncoding.EncodeToString(digest[:]),
+		},
+	}
+}
+
+// newToken returns the BinarySecurityToken of the signing certificate.
+func newToken(cert tls.Certificate, id string) *binarySecurityToken {
+	var value string
+	if len(cert.Certificate) > 0 {
+		value = base64.StdEncoding.EncodeToString(cert.Certificate[0])
+	}
+	return &binarySecurityToken{
+		WsuID:        id,
+		EncodingType: encTypeBinary,
+		ValueType:    valTypeX509Token,
+		Value:        value,
+	}
+}
+
+// edit replaces del bytes at pos of the envelope by text.
+type edit struct {
+	pos, del int
+	text     string
+}
+
+// applyEdits returns a copy of data with the edits applied. Edits at the same position are applied in order.
+func applyEdits(data []byte, edits []edit) []byte {
+	edits = slices.Clone(edits)
+	slices.SortStableFunc(edits, func(a, b edit) int { return a.pos - b.pos })
+	out := make([]byte, 0, len(data))
+	pos := 0
+	for _, e := range edits {
+		out = append(out, data[pos:e.pos]...)
+		out = append(out, e.text...)
+		pos = e.pos + e.del
+	}
+	return append(out, data[pos:]...)
+}
+
+// envelopeLayout holds the positions of the elements of a serialized envelope ApplySecurity edits.
+type envelopeLayout struct {
+	envelope *layoutElement
+	header   *layoutElement
+	// headers are the child elements of the header
+	headers []*layoutElement
+	body    *layoutElement
+}
+
+// layoutElement is an element of a serialized envelope.
+type layoutElement struct {
+	name xml.Name
+	// qname is the name as written, with its prefix
+	qname string
+	attrs []xml.Attr
+	// scope holds the namespaces in scope of the element by their prefix, "" for the default namespace
+	scope map[string]string
+	// start is the offset of the start tag, content the one after it, end the one after the end tag
+	start, content, end int
+	selfClosing         bool
+}
+
+// scanEnvelope reads the positions of the envelope, its header, the headers and the body from data.
+func scanEnvelope(data []byte) (*envelopeLayout, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	layout := &envelopeLayout{}
+	var stack []*layoutElement
+	for {
+		offset := int(d.InputOffset())
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			parent := map[string]string{"xml": xmlNS}
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1].scope
+			}
+			el := newLayoutElement(t, parent, offset, int(d.InputOffset()), data)
+			switch {
+			case len(stack) == 0:
+				if el.name.Space != soapEnvNS && el.name.Space != soap12EnvNS {
+					return nil, ErrEnvelopeMisconfigured
+				}
+				layout.envelope = el
+			case len(stack) == 1 && el.name.Space == layout.envelope.name.Space && el.name.Local == "Header":
+				layout.header = el
+			case len(stack) == 1 && el.name.Space == layout.envelope.name.Space && el.name.Local == "Body":
+				layout.body = el
+			case len(stack) == 2 && stack[1] == layout.header:
+				layout.headers = append(layout.headers, el)
+			}
+			stack = append(stack, el)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack[len(stack)-1].end = int(d.InputOffset())
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	if layout.envelope == nil {
+		return nil, ErrEnvelopeMisconfigured
+	}
+	return layout, nil
+}
+
+func newLayoutElement(t xml.StartElement, parent map[string]string, start, content int, data []byte) *layoutElement {
+	scope, copied := parent, false
+	for _, a := range t.Attr {
+		if a.Name.Space != "xmlns" && (a.Name.Space != "" || a.Name.Local != "xmlns") {
+			continue
+		}
+		if !copied {
+			// the scope of the parent is shared by elements declaring no namespaces
+			scope, copied = make(map[string]string, len(parent)+1), true
+			for p, ns := range parent {
+				scope[p] = ns
+			}
+		}
+		prefix := a.Name.Local
+		if a.Name.Space == "" {
+			prefix = ""
+		}
+		scope[prefix] = a.Value
+	}
+	el := &layoutElement{
+		qname:       t.Name.Local,
+		scope:       scope,
+		start:       start,
+		content:     content,
+		selfClosing: content >= 2 && data[content-2] == '/',
+	}
+	if t.Name.Space != "" {
+		el.qname = t.Name.Space + ":" + t.Name.Local
+	}
+	el.name = xml.Name{Space: scope[t.Name.Space], Local: t.Name.Local}
+	for _, a := range t.Attr {
+		if a.Name.Space == "xmlns" || a.Name.Space == "" && a.Name.Local == "xmlns" {
+			continue
+		}
+		name := a.Name
+		if name.Space != "" {
+			name.Space = scope[name.Space]
+		}
+		el.attrs = append(el.attrs, xml.Attr{Name: name, Value: a.Value})
+	}
+	return el
+}
+
+// attr returns the value of the attribute named space and local.
+func (el *layoutElement) attr(space, local string) string {
+	for _, a := range el.attrs {
+		if a.Name.Space == space && a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// ensureID returns the wsu:Id of the element, and the edit adding one generated by newID if it has none.
+func (el *layoutElement) ensureID(newID func() string) (string, []edit) {
+	if id := el.attr(wsuNS, "Id"); id != "" {
+		return id, nil
+	}
+	prefix := "wsu"
+	for n := 1; el.scope[prefix] != "" && el.scope[prefix] != wsuNS; n++ {
+		prefix = fmt.Sprintf("wsu%d", n)
+	}
+	var attrs strings.Builder
+	if el.scope[prefix] == "" {
+		attrs.WriteString(` xmlns:` + prefix + `="` + wsuNS + `"`)
+	}
+	id := newID()
+	attrs.WriteString(` ` + prefix + `:Id="` + escapeCanonicalAttr(id) + `"`)
+	return id, []edit{{pos: el.tagEnd(), text: attrs.String()}}
+}
+
+// tagEnd returns the offset of the closing > or /> of the start tag.
+func (el *layoutElement) tagEnd() int {
+	if el.selfClosing {
+		return el.content - 2
+	}
+	return el.content - 1
+}
+
+// actor returns the actor (SOAP 1.1) or role (SOAP 1.2) the header is targeted at.
+func (el *layoutElement) actor() string {
+	if actor := el.attr(soapEnvNS, "actor"); actor != "" {
+		return actor
+	}
+	return el.attr(soap12EnvNS, "role")
+}
+
+// insertSecurity returns the edits inserting the content of sec into the Security header targeted at the
+// actor of placement, or inserting a new Security header with the attributes of placement if there is none.
+func (l *envelopeLayout) insertSecurity(placement SecurityHeaderOptions, sec security) ([]edit, error) {
+	for _, h := range l.headers {
+		if h.name.Space != wsseNS || h.name.Local != "Security" || h.actor() != placement.Actor {
+			continue
+		}
+		content, err := sec.content(h.scope["wsse"] == wsseNS)
+		if err != nil {
+			return nil, err
+		}
+		if h.selfClosing {
+			return []edit{{pos: h.content - 2, del: 2, text: ">" + string(content) + "</" + h.qname + ">"}}, nil
+		}
+		return []edit{{pos: h.content, text: string(content)}}, nil
+	}
+
+	sec.MustUnderstand, sec.Actor, sec.MustUnderstand12, sec.Role = placement.attributes()
+	data, err := xml.Marshal(sec)
+	if err != nil {
+		return nil, err
+	}
+	return []edit{l.insertHeaders(string(data))}, nil
+}
+
+// insertHeaders returns the edit inserting the serialized headers as the first ones, adding a Header
+// element with the prefix of the body if the envelope has none.
+func (l *envelopeLayout) insertHeaders(headers string) edit {
+	switch {
+	case l.header == nil:
+		prefix, _, _ := strings.Cut(l.body.qname, ":")
+		if prefix == l.body.qname {
+			prefix = ""
+		} else {
+			prefix += ":"
+		}
+		return edit{pos: l.body.start, text: "<" + prefix + "Header>" + headers + "</" + prefix + "Header>"}
+	case l.header.selfClosing:
+		return edit{pos: l.header.content - 2, del: 2, text: ">" + headers + "</" + l.header.qname + ">"}
+	}
+	return edit{pos: l.header.content, text: headers}
+}
+
+// content returns the serialized elements of the header. If inScope, the wsse prefix is bound to the
+// namespace of the header where they are inserted and not declared again.
+func (s security) content(inScope bool) ([]byte, error) {
+	if inScope {
+		data, err := xml.Marshal(security{Signature: s.Signature, Token: s.Token, Timestamp: s.Timestamp,
+			Confirmations: s.Confirmations, order: s.order})
+		if err != nil {
+			return nil, err
+		}
+		start := bytes.IndexByte(data, '>') + 1
+		end := bytes.LastIndex(data, []byte("</"))
+		if start <= 0 || end < start {
+			return nil, errors.New("security header not serialized as element")
+		}
+		return data[start:end], nil
+	}
+	var buf bytes.Buffer
+	for _, el := range s.order {
+		var v any
+		switch {
+		case el == SecuritySignature:
+			v = s.Signature
+		case el == SecurityToken && s.Token != nil:
+			v = s.Token
+		case el == SecurityTimestamp:
+			v = s.Timestamp
+		default:
+			continue
+		}
+		data, err := xml.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	for _, c := range s.Confirmations {
+		data, err := xml.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+	}
+	return buf.Bytes(), nil
+}
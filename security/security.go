@@ -0,0 +1,28 @@
+// Package security signs and verifies serialized SOAP envelopes with WS-Security X.509 signatures apart from
+// sending them, e.g. to sign envelopes in one service and send them hours later from another. The functions are
+// the ones the client signs its requests with, see soap.WSSEAuthInfo.
+package security
+
+import (
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+// SecurityConfig configures the signature added by Apply.
+type SecurityConfig = soap.SecurityConfig
+
+// VerifyConfig configures the verification of Verify.
+type VerifyConfig = soap.VerifyOptions
+
+// Apply signs the serialized envelope and returns it with the wsse:Security header carrying the timestamp, the
+// signature and, if configured, the BinarySecurityToken. All bytes outside the Security headers are kept, except
+// for the wsu:Id attributes added to the signed elements lacking one. See soap.ApplySecurity.
+func Apply(envelope []byte, cfg SecurityConfig) ([]byte, error) {
+	return soap.ApplySecurity(envelope, cfg)
+}
+
+// Verify verifies the WS-Security signature of the serialized envelope: the digests of all referenced elements,
+// the signature value, the validity of the timestamp and, with cfg.Roots, the signing certificate. See
+// soap.VerifySignature.
+func Verify(envelope []byte, cfg VerifyConfig) error {
+	return soap.VerifySignature(envelope, cfg)
+}
@@ -0,0 +1,51 @@
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+const envelope = `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">` +
+	`<soapenv:Header><Trace xmlns="urn:test">t-1</Trace></soapenv:Header>` +
+	`<soapenv:Body><Order xmlns="urn:orders"><Amount>10</Amount></Order></soapenv:Body></soapenv:Envelope>`
+
+func TestApplyVerify(t *testing.T) {
+	cert, err := tls.LoadX509KeyPair("../testdata/cert.pem", "../testdata/key.pem")
+	require.NoError(t, err)
+	created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	signed, err := Apply([]byte(envelope), SecurityConfig{
+		Certificate: cert,
+		Signing:     soap.SigningOptions{SignHeaders: true, BinarySecurityToken: true},
+		Created:     created,
+		Expires:     created.Add(24 * time.Hour),
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(signed), `<Amount>10</Amount>`)
+	assert.Contains(t, string(signed), `<wsu:Expires>2021-01-02T00:00:00.000Z</wsu:Expires>`)
+	assert.NoError(t, Verify(signed, VerifyConfig{CurrentTime: created}))
+
+	// the test certificate has expired since
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	assert.NoError(t, Verify(signed, VerifyConfig{Roots: roots, CurrentTime: created}))
+	var invalidErr x509.CertificateInvalidError
+	assert.ErrorAs(t, Verify(signed, VerifyConfig{Roots: roots}), &invalidErr)
+
+	tampered := strings.Replace(string(signed), "<Amount>10</Amount>", "<Amount>1000</Amount>", 1)
+	assert.ErrorIs(t, Verify([]byte(tampered), VerifyConfig{}), soap.ErrInvalidSignature)
+	tampered = strings.Replace(string(signed), ">t-1<", ">t-2<", 1)
+	assert.ErrorIs(t, Verify([]byte(tampered), VerifyConfig{}), soap.ErrInvalidSignature)
+
+	_, err = Apply([]byte(envelope), SecurityConfig{})
+	assert.ErrorIs(t, err, soap.ErrUnsupportedAlgorithm)
+}
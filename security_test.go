@@ -0,0 +1,185 @@
+package soap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testSigningTime is the time the envelopes of securityConfig are signed at, when the test certificate was valid.
+var testSigningTime = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// securityConfig returns the configuration signing with the test certificate with numbered ids.
+func securityConfig(t *testing.T) SecurityConfig {
+	t.Helper()
+	cert, err := tls.LoadX509KeyPair("./testdata/cert.pem", "./testdata/key.pem")
+	require.NoError(t, err)
+	ids := 0
+	return SecurityConfig{
+		Certificate: cert,
+		Signing:     SigningOptions{BinarySecurityToken: true},
+		Created:     testSigningTime,
+		NewID: func() string {
+			ids++
+			return fmt.Sprintf("id-%d", ids)
+		},
+	}
+}
+
+// withoutSecurity returns the envelope with the content of its Security headers removed.
+func withoutSecurity(t *testing.T, envelope []byte) string {
+	t.Helper()
+	layout, err := scanEnvelope(envelope)
+	require.NoError(t, err)
+	out := string(envelope)
+	for i := len(layout.headers) - 1; i >= 0; i-- {
+		h := layout.headers[i]
+		if h.name.Space != wsseNS || h.name.Local != "Security" || h.selfClosing {
+			continue
+		}
+		end := strings.Index(out[h.content:], "</"+h.qname+">")
+		require.GreaterOrEqual(t, end, 0)
+		out = out[:h.content] + out[h.content+end:]
+	}
+	return out
+}
+
+func TestApplySecurity(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope string
+		// want is the envelope with the signed Security header emptied
+		want string
+	}{
+		{
+			name: "ids and formatting kept",
+			envelope: "<?xml version='1.0'?>\n<s:Envelope xmlns:s='" + soapEnvNS + "' xmlns:u='" + wsuNS + "'>\n" +
+				"  <s:Header><t:Trace xmlns:t='urn:test'>t-1</t:Trace></s:Header>\n" +
+				"  <s:Body u:Id='body'><!-- order --><Order xmlns='urn:orders' >&#65;<Item/></Order></s:Body>\n</s:Envelope>",
+			want: "<?xml version='1.0'?>\n<s:Envelope xmlns:s='" + soapEnvNS + "' xmlns:u='" + wsuNS + "'>\n" +
+				`  <s:Header><wsse:Security xmlns:soapenv="` + soapEnvNS + `" xmlns:wsse="` + wsseNS + `" soapenv:mustUnderstand="1"></wsse:Security>` +
+				"<t:Trace xmlns:t='urn:test'>t-1</t:Trace></s:Header>\n" +
+				"  <s:Body u:Id='body'><!-- order --><Order xmlns='urn:orders' >&#65;<Item/></Order></s:Body>\n</s:Envelope>",
+		},
+		{
+			name:     "id added",
+			envelope: `<soap:Envelope xmlns:soap="` + soapEnvNS + `"><soap:Header/><soap:Body><Order xmlns="urn:orders"/></soap:Body></soap:Envelope>`,
+			want: `<soap:Envelope xmlns:soap="` + soapEnvNS + `"><soap:Header><wsse:Security xmlns:soapenv="` + soapEnvNS + `" xmlns:wsse="` + wsseNS + `" soapenv:mustUnderstand="1"></wsse:Security></soap:Header>` +
+				`<soap:Body xmlns:wsu="` + wsuNS + `" wsu:Id="id-1"><Order xmlns="urn:orders"/></soap:Body></soap:Envelope>`,
+		},
+		{
+			name:     "header added",
+			envelope: `<Envelope xmlns="` + soap12EnvNS + `"><Body><Order xmlns="urn:orders"/></Body></Envelope>`,
+			want: `<Envelope xmlns="` + soap12EnvNS + `"><Header><wsse:Security xmlns:soap-envelope="` + soap12EnvNS + `" xmlns:wsse="` + wsseNS + `" soap-envelope:mustUnderstand="1"></wsse:Security></Header>` +
+				`<Body xmlns:wsu="` + wsuNS + `" wsu:Id="id-1"><Order xmlns="urn:orders"/></Body></Envelope>`,
+		},
+		{
+			name: "existing header filled",
+			envelope: `<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Header><o:Security xmlns:o="` + wsseNS + `"><o:UsernameToken/></o:Security></s:Header>` +
+				`<s:Body><Order xmlns="urn:orders"/></s:Body></s:Envelope>`,
+			want: `<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Header><o:Security xmlns:o="` + wsseNS + `"></o:Security></s:Header>` +
+				`<s:Body xmlns:wsu="` + wsuNS + `" wsu:Id="id-1"><Order xmlns="urn:orders"/></s:Body></s:Envelope>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := ApplySecurity([]byte(tt.envelope), securityConfig(t))
+			require.NoError(t, err)
+			if strings.Contains(tt.envelope, "UsernameToken") {
+				assert.Contains(t, string(signed), "<o:UsernameToken/></o:Security>")
+				assert.Equal(t, tt.want, strings.Replace(withoutSecurity(t, signed), "<o:UsernameToken/>", "", 1))
+			} else {
+				assert.Equal(t, tt.want, withoutSecurity(t, signed))
+			}
+			assert.NoError(t, VerifySignature(signed, VerifyOptions{CurrentTime: testSigningTime}))
+			assert.Equal(t, []string{"Signature", "BinarySecurityToken", "Timestamp"}, securityLayout(t, signed)[""][:3])
+		})
+	}
+}
+
+func TestApplySecurityTimestamp(t *testing.T) {
+	envelope := `<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Body><Order xmlns="urn:orders"/></s:Body></s:Envelope>`
+	cfg := securityConfig(t)
+	cfg.Expires = cfg.Created.Add(6 * time.Hour)
+	signed, err := ApplySecurity([]byte(envelope), cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(signed), "<wsu:Created>2021-01-01T00:00:00.000Z</wsu:Created><wsu:Expires>2021-01-01T06:00:00.000Z</wsu:Expires>")
+
+	cfg = securityConfig(t)
+	cfg.Created = time.Time{}
+	cfg.Clock = &manualClock{now: time.Date(2022, 2, 2, 0, 0, 0, 0, time.UTC)}
+	signed, err = ApplySecurity([]byte(envelope), cfg)
+	require.NoError(t, err)
+	assert.Contains(t, string(signed), "<wsu:Created>2022-02-02T00:00:00.000Z</wsu:Created><wsu:Expires>2022-02-02T00:00:10.000Z</wsu:Expires>")
+}
+
+func TestApplySecuritySignHeaders(t *testing.T) {
+	envelope := `<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Header>` +
+		`<t:Trace xmlns:t="urn:test">t-1</t:Trace><Route xmlns="urn:gateway">backend-1</Route>` +
+		`<o:Security xmlns:o="` + wsseNS + `" s:actor="urn:audit"/>` +
+		`</s:Header><s:Body><Order xmlns="urn:orders"/></s:Body></s:Envelope>`
+	cfg := securityConfig(t)
+	cfg.Signing = SigningOptions{SignHeaders: true, ExcludeHeaders: []xml.Name{{Space: "urn:gateway"}},
+		BinarySecurityToken: true, TokenHeader: &SecurityHeaderOptions{Actor: "urn:audit"}}
+	signed, err := ApplySecurity([]byte(envelope), cfg)
+	require.NoError(t, err)
+	assert.NoError(t, VerifySignature(signed, VerifyOptions{CurrentTime: testSigningTime}))
+	assert.Equal(t, map[string][]string{"urn:audit": {"BinarySecurityToken"}, "": {"Signature", "Timestamp"}},
+		securityLayout(t, signed))
+
+	doc := etree.NewDocument()
+	require.NoError(t, doc.ReadFromBytes(signed))
+	var refs []string
+	for _, ref := range doc.FindElements("//SignedInfo/Reference") {
+		refs = append(refs, ref.SelectAttrValue("URI", ""))
+	}
+	// the header ids are generated first
+	assert.Equal(t, []string{"#id-2", "#id-3", "#id-1"}, refs)
+	assert.Contains(t, string(signed), `<t:Trace xmlns:t="urn:test" xmlns:wsu="`+wsuNS+`" wsu:Id="id-1">t-1</t:Trace><Route xmlns="urn:gateway">`)
+}
+
+func TestApplySecurityErrors(t *testing.T) {
+	cfg := securityConfig(t)
+	_, err := ApplySecurity([]byte(`<Order xmlns="urn:orders"/>`), cfg)
+	assert.ErrorIs(t, err, ErrEnvelopeMisconfigured)
+	_, err = ApplySecurity([]byte(`<s:Envelope xmlns:s="`+soapEnvNS+`"><s:Header/></s:Envelope>`), cfg)
+	assert.ErrorIs(t, err, ErrUnableToSignEmptyEnvelope)
+	_, err = ApplySecurity([]byte(`<s:Envelope xmlns:s="`+soapEnvNS+`"><s:Body>`), cfg)
+	assert.Error(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cfg.Certificate.PrivateKey = key
+	_, err = ApplySecurity([]byte(`<s:Envelope xmlns:s="`+soapEnvNS+`"><s:Body/></s:Envelope>`), cfg)
+	assert.ErrorIs(t, err, ErrUnsupportedAlgorithm)
+}
+
+func TestApplySecurityGolden(t *testing.T) {
+	golden, err := os.ReadFile("./testdata/wsse/golden_request.xml")
+	require.NoError(t, err)
+	// the envelope the client encodes before signing: an empty Security header and a body without id
+	unsigned := strings.Replace(withoutSecurity(t, golden), ` xmlns:wsu="`+wsuNS+`" wsu:Id="WSSE-1"`, "", 1)
+	require.NotContains(t, unsigned, "WSSE-1")
+
+	cfg := securityConfig(t)
+	cfg.Signing = SigningOptions{}
+	ids := 0
+	cfg.NewID = func() string {
+		ids++
+		return fmt.Sprintf("WSSE-%d", ids)
+	}
+	signed, err := ApplySecurity([]byte(unsigned), cfg)
+	require.NoError(t, err)
+	assert.Equal(t, string(golden), string(signed))
+}
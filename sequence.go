@@ -0,0 +1,245 @@
+package soap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+var (
+	// ErrSequenceViolation is returned by calls with WithStrictSequence if the elements of the response body
+	// are not in the order of the fields of the response struct. The returned error is a *SequenceError.
+	ErrSequenceViolation = errors.New("element out of sequence")
+)
+
+// SequenceError reports an element of the response body arriving after an element of a later struct field.
+type SequenceError struct {
+	// Path is the slash separated path of the parent element, starting at the body content element.
+	Path string
+	// Element is the name of the element out of sequence, Position its position among the children of the
+	// parent, starting at 1.
+	Element  string
+	Position int
+	// Preceding is the element of a later field which came first, at PrecedingPosition.
+	Preceding         string
+	PrecedingPosition int
+}
+
+func (e *SequenceError) Error() string {
+	return fmt.Sprintf("%s: element %s at position %d follows %s at position %d",
+		e.Path, e.Element, e.Position, e.Preceding, e.PrecedingPosition)
+}
+
+func (e *SequenceError) Unwrap() error {
+	return ErrSequenceViolation
+}
+
+// WithStrictSequence rejects responses whose body content elements are not in the order of the fields of the
+// response structs, as required by xsd:sequence. Elements without field, e.g. caught by an ",any" field,
+// and the content of types implementing xml.Unmarshaler are not checked. Faults and headers are not affected.
+func WithStrictSequence() Option {
+	return func(s *settings) error {
+		s.strictSequence = true
+		return nil
+	}
+}
+
+// sequenceField is a field of a response struct in sequence order.
+type sequenceField struct {
+	name xml.Name
+	// rank is the position of the field in the struct, fields of embedded structs are ranked in their place
+	rank int
+	typ  reflect.Type
+}
+
+var unmarshalerType = reflect.TypeOf((*xml.Unmarshaler)(nil)).Elem()
+
+// sequenceFields returns the fields of the struct type t matching child elements. It returns nil for types
+// whose content is not checked.
+func sequenceFields(t reflect.Type) []sequenceField {
+	t = sequenceType(t)
+	if t == nil {
+		return nil
+	}
+	var fields []sequenceField
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("xml")
+			if tag == "-" || !f.IsExported() && !f.Anonymous || f.Name == xmlName {
+				continue
+			}
+			name, flags, _ := strings.Cut(tag, ",")
+			if flags != "" && flags != "omitempty" {
+				continue
+			}
+			if f.Anonymous && name == "" {
+				if et := sequenceType(f.Type); et != nil {
+					add(et)
+				}
+				continue
+			}
+			field := sequenceField{rank: len(fields), typ: f.Type}
+			if parts := strings.Fields(name); len(parts) == 2 {
+				field.name = xml.Name{Space: parts[0], Local: parts[1]}
+			} else if name != "" {
+				field.name.Local = name
+			} else {
+				field.name.Local = f.Name
+			}
+			if first, _, path := strings.Cut(field.name.Local, ">"); path {
+				// the content of paths is not checked
+				field.name.Local, field.typ = first, nil
+			}
+			fields = append(fields, field)
+		}
+	}
+	add(t)
+	return fields
+}
+
+// sequenceType returns the struct type of the values of t, or nil if their content is not checked.
+func sequenceType(t reflect.Type) reflect.Type {
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		if t.Kind() != reflect.Ptr && t.Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || reflect.PointerTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+	return t
+}
+
+// checkSequence checks the order of the body content elements of the envelope data against the content
+// types. Element names are mapped with mapper first, if not nil. The decoding accepts the entities.
+func checkSequence(data []byte, content []any, mapper func(xml.Name) xml.Name, entities map[string]string) error {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Entity = entities
+	c := sequenceChecker{mapper: mapper}
+	depth := 0
+	inBody := false
+	used := make([]bool, len(content))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			// decoding reports malformed envelopes
+			return nil
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				inBody = tok.Name.Local == "Body"
+			}
+			if depth < 3 {
+				continue
+			}
+			depth--
+			name := c.name(tok.Name)
+			var t reflect.Type
+			if inBody && !(tok.Name.Local == "Fault" && (tok.Name.Space == soapEnvNS || tok.Name.Space == soap12EnvNS)) {
+				t = contentType(content, used, name)
+			}
+			if t == nil {
+				err = d.Skip()
+			} else {
+				err = c.element(d, name.Local, t)
+			}
+			var seqErr *SequenceError
+			if errors.As(err, &seqErr) {
+				return err
+			} else if err != nil {
+				return nil
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+// contentType returns the type of the first unused body content matching the element name.
+func contentType(content []any, used []bool, name xml.Name) reflect.Type {
+	for i, v := range content {
+		if used[i] || v == nil {
+			continue
+		}
+		if tagged := taggedXMLName(v); tagged != nil && !matchName(*tagged, name) {
+			continue
+		}
+		used[i] = true
+		return reflect.TypeOf(v)
+	}
+	return nil
+}
+
+type sequenceChecker struct {
+	mapper func(xml.Name) xml.Name
+}
+
+func (c *sequenceChecker) name(name xml.Name) xml.Name {
+	if c.mapper != nil {
+		return c.mapper(name)
+	}
+	return name
+}
+
+// element checks the children of the element at path, which was just started, against the fields of t.
+func (c *sequenceChecker) element(d *xml.Decoder, path string, t reflect.Type) error {
+	fields := sequenceFields(t)
+	if fields == nil {
+		return d.Skip()
+	}
+	position := 0
+	var last *sequenceField
+	lastName, lastPosition := "", 0
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			position++
+			name := c.name(tok.Name)
+			field := matchField(fields, name)
+			if field == nil {
+				if err := d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			if last != nil && field.rank < last.rank {
+				return &SequenceError{Path: path, Element: name.Local, Position: position,
+					Preceding: lastName, PrecedingPosition: lastPosition}
+			}
+			last, lastName, lastPosition = field, name.Local, position
+			if field.typ == nil {
+				err = d.Skip()
+			} else {
+				err = c.element(d, path+"/"+name.Local, field.typ)
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// matchField returns the field the element name decodes into, or nil.
+func matchField(fields []sequenceField, name xml.Name) *sequenceField {
+	for i := range fields {
+		if matchName(fields[i].name, name) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
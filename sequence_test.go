@@ -0,0 +1,112 @@
+package soap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sequenceAddress struct {
+	Street string `xml:"Street"`
+	City   string `xml:"City"`
+}
+
+type sequenceResponse struct {
+	XMLName xml.Name         `xml:"urn:test GetInfoResponse"`
+	ID      string           `xml:"ID"`
+	Name    string           `xml:"Name"`
+	Address *sequenceAddress `xml:"Address"`
+	Items   []string         `xml:"Item"`
+}
+
+func sequenceEnvelope(content string) string {
+	return `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<GetInfoResponse xmlns="urn:test">` + content + `</GetInfoResponse></soap:Body></soap:Envelope>`
+}
+
+func TestStrictSequence(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    *SequenceError
+	}{
+		{
+			name:    "in order",
+			content: `<ID>1</ID><Name>a</Name><Address><Street>s</Street><City>c</City></Address><Item>x</Item><Item>y</Item>`,
+		},
+		{
+			name:    "optional elements missing",
+			content: `<ID>1</ID><Item>x</Item>`,
+		},
+		{
+			name:    "unknown elements",
+			content: `<ID>1</ID><Extra><ID>2</ID></Extra><Name>a</Name>`,
+		},
+		{
+			name:    "swapped",
+			content: `<Name>a</Name><ID>1</ID>`,
+			want: &SequenceError{Path: "GetInfoResponse", Element: "ID", Position: 2,
+				Preceding: "Name", PrecedingPosition: 1},
+		},
+		{
+			name:    "nested",
+			content: `<ID>1</ID><Address><City>c</City><Street>s</Street></Address>`,
+			want: &SequenceError{Path: "GetInfoResponse/Address", Element: "Street", Position: 2,
+				Preceding: "City", PrecedingPosition: 1},
+		},
+		{
+			name:    "interleaved repetition",
+			content: `<ID>1</ID><Item>x</Item><Name>a</Name><Item>y</Item>`,
+			want: &SequenceError{Path: "GetInfoResponse", Element: "Name", Position: 3,
+				Preceding: "Item", PrecedingPosition: 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newInfoServer(t, "text/xml", sequenceEnvelope(tt.content))
+			client := NewClient(srv.URL)
+
+			// without strict sequence any order is accepted
+			err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &sequenceResponse{})
+			require.NoError(t, err)
+
+			err = client.Do(context.Background(), "GetInfo", &infoRequest{}, &sequenceResponse{}, WithStrictSequence())
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrSequenceViolation)
+			var seqErr *SequenceError
+			require.ErrorAs(t, err, &seqErr)
+			assert.Equal(t, tt.want, seqErr)
+		})
+	}
+}
+
+func TestStrictSequenceFault(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+		`<soap:Fault><faultstring>boom</faultstring><faultcode>soap:Server</faultcode></soap:Fault></soap:Body></soap:Envelope>`)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithStrictSequence()))
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &sequenceResponse{})
+	var fault *Fault
+	require.ErrorAs(t, err, &fault)
+	assert.Equal(t, "boom", fault.String)
+}
+
+func TestStrictSequenceNameMapper(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", sequenceEnvelope(`<name>a</name><id>1</id>`))
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithStrictSequence(),
+		WithElementNameMapper(CaseInsensitiveMapper(sequenceResponse{}))))
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &sequenceResponse{})
+	var seqErr *SequenceError
+	require.ErrorAs(t, err, &seqErr)
+	assert.Equal(t, "ID", seqErr.Element)
+	assert.Equal(t, "Name", seqErr.Preceding)
+}
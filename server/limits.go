@@ -0,0 +1,195 @@
+// Package server implements building blocks for SOAP services: the protection of handlers against oversized
+// envelopes and slow clients, the publishing of WSDL documents generated from the operations and the signing
+// of responses confirming the signatures of the requests.
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/m29h/xml"
+)
+
+const (
+	soap11NS = "http://schemas.xmlsoap.org/soap/envelope/"
+	soap12NS = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// ViolationKind identifies the limit a request exceeded.
+type ViolationKind int
+
+const (
+	// EnvelopeTooLarge is reported for envelopes larger than Limits.MaxEnvelopeSize.
+	EnvelopeTooLarge ViolationKind = iota + 1
+	// TooManyHeaders is reported for envelopes with more header elements than Limits.MaxHeaders.
+	TooManyHeaders
+	// ReadTimeout is reported if the body is not received within Limits.ReadTimeout.
+	ReadTimeout
+	// LengthRequired is reported for requests without Content-Length if Limits.RequireContentLength is set.
+	LengthRequired
+)
+
+func (k ViolationKind) String() string {
+	switch k {
+	case EnvelopeTooLarge:
+		return "envelope too large"
+	case TooManyHeaders:
+		return "too many headers"
+	case ReadTimeout:
+		return "read timeout"
+	case LengthRequired:
+		return "length required"
+	}
+	return fmt.Sprintf("ViolationKind(%d)", int(k))
+}
+
+// Violation is a request rejected by Limit.
+type Violation struct {
+	Kind    ViolationKind
+	Request *http.Request
+	// Err is the error reading the body, if any.
+	Err error
+}
+
+// Limits configures the limits enforced by Limit. Zero values disable a limit.
+type Limits struct {
+	// MaxEnvelopeSize is the maximum size of the request body in bytes. Larger requests are rejected with
+	// 413 Request Entity Too Large, before reading the body if their Content-Length exceeds it.
+	MaxEnvelopeSize int64
+	// MaxHeaders is the maximum number of SOAP header elements. Envelopes with more are rejected with
+	// 400 Bad Request.
+	MaxHeaders int
+	// ReadTimeout is the time the client has to send the body. Slower requests are rejected with
+	// 408 Request Timeout.
+	ReadTimeout time.Duration
+	// RequireContentLength rejects requests without Content-Length, e.g. chunked ones, with 411 Length Required.
+	RequireContentLength bool
+	// Observe is called with every rejected request, e.g. to count the violations.
+	Observe func(Violation)
+}
+
+// Limit returns a handler enforcing limits before passing requests to h. The body is read completely before
+// h is called, so h only receives envelopes within the limits. Violations are answered with a Client
+// fault (Sender for SOAP 1.2) and the connection is closed.
+func Limit(h http.Handler, limits Limits) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limits.RequireContentLength && r.ContentLength < 0 {
+			limits.reject(w, r, Violation{Kind: LengthRequired}, http.StatusLengthRequired, "Content-Length required")
+			return
+		}
+		if limits.MaxEnvelopeSize > 0 && r.ContentLength > limits.MaxEnvelopeSize {
+			limits.reject(w, r, Violation{Kind: EnvelopeTooLarge}, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("envelope exceeds %d bytes", limits.MaxEnvelopeSize))
+			return
+		}
+
+		rc := http.NewResponseController(w)
+		if limits.ReadTimeout > 0 {
+			_ = rc.SetReadDeadline(time.Now().Add(limits.ReadTimeout))
+		}
+		var body io.Reader = r.Body
+		if limits.MaxEnvelopeSize > 0 {
+			body = http.MaxBytesReader(w, r.Body, limits.MaxEnvelopeSize)
+		}
+		envelope, err := io.ReadAll(body)
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			limits.reject(w, r, Violation{Kind: EnvelopeTooLarge, Err: err}, http.StatusRequestEntityTooLarge,
+				fmt.Sprintf("envelope exceeds %d bytes", limits.MaxEnvelopeSize))
+			return
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			limits.reject(w, r, Violation{Kind: ReadTimeout, Err: err}, http.StatusRequestTimeout, "request body not received in time")
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if limits.ReadTimeout > 0 {
+			// the deadline stays in place for rejected requests, so discarding their body cannot block
+			_ = rc.SetReadDeadline(time.Time{})
+		}
+
+		if limits.MaxHeaders > 0 && countHeaders(envelope, limits.MaxHeaders) > limits.MaxHeaders {
+			limits.reject(w, r, Violation{Kind: TooManyHeaders}, http.StatusBadRequest,
+				fmt.Sprintf("envelope has more than %d headers", limits.MaxHeaders))
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(envelope))
+		r.ContentLength = int64(len(envelope))
+		h.ServeHTTP(w, r)
+	})
+}
+
+// reject answers the request with a fault and reports the violation.
+func (l Limits) reject(w http.ResponseWriter, r *http.Request, v Violation, status int, message string) {
+	v.Request = r
+	if l.Observe != nil {
+		l.Observe(v)
+	}
+	w.Header().Set("Connection", "close")
+	writeFault(w, r, status, message)
+}
+
+// countHeaders returns the number of children of the SOAP Header element, counting stops after max+1.
+// Envelopes which are not well-formed are left to the handler to reject.
+func countHeaders(envelope []byte, max int) int {
+	d := xml.NewDecoder(bytes.NewReader(envelope))
+	depth, count := 0, 0
+	inHeader := false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return count
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch {
+			case depth == 2 && tok.Name.Local == "Header":
+				inHeader = true
+			case depth == 2:
+				// the Body follows the Header
+				return count
+			case depth == 3 && inHeader:
+				count++
+				if count > max {
+					return count
+				}
+			}
+		case xml.EndElement:
+			depth--
+			if depth == 1 && inHeader {
+				return count
+			}
+		}
+	}
+}
+
+// writeFault writes a client fault in the SOAP version of the request.
+func writeFault(w http.ResponseWriter, r *http.Request, status int, message string) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var envelope string
+	if mediaType == "application/soap+xml" {
+		w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+		envelope = `<soap:Envelope xmlns:soap="` + soap12NS + `"><soap:Body><soap:Fault>` +
+			`<soap:Code><soap:Value>soap:Sender</soap:Value></soap:Code>` +
+			`<soap:Reason><soap:Text xml:lang="en">` + html.EscapeString(message) + `</soap:Text></soap:Reason>` +
+			`</soap:Fault></soap:Body></soap:Envelope>`
+	} else {
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		envelope = `<soap:Envelope xmlns:soap="` + soap11NS + `"><soap:Body><soap:Fault>` +
+			`<faultcode>soap:Client</faultcode><faultstring>` + html.EscapeString(message) + `</faultstring>` +
+			`</soap:Fault></soap:Body></soap:Envelope>`
+	}
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, envelope)
+}
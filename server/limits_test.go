@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+type echo struct {
+	XMLName xml.Name `xml:"urn:test Echo"`
+	Value   string   `xml:"Value"`
+}
+
+type echoResponse struct {
+	XMLName xml.Name `xml:"urn:test EchoResponse"`
+	Value   string   `xml:"Value"`
+}
+
+// violations records the violations observed by Limit.
+type violations struct {
+	mu    sync.Mutex
+	kinds []ViolationKind
+}
+
+func (v *violations) observe(violation Violation) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.kinds = append(v.kinds, violation.Kind)
+}
+
+func (v *violations) list() []ViolationKind {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]ViolationKind(nil), v.kinds...)
+}
+
+// newLimitedServer serves an echo handler behind Limit.
+func newLimitedServer(t *testing.T, limits Limits) (*httptest.Server, *violations) {
+	v := &violations{}
+	limits.Observe = v.observe
+	srv := httptest.NewServer(Limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(body)), r.ContentLength)
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = io.WriteString(w, `<soap:Envelope xmlns:soap="`+soap11NS+`"><soap:Body>`+
+			`<EchoResponse xmlns="urn:test"><Value>ok</Value></EchoResponse></soap:Body></soap:Envelope>`)
+	}), limits))
+	t.Cleanup(srv.Close)
+	return srv, v
+}
+
+// headers returns a header builder adding n trace headers.
+func headers(n int) soap.HeaderBuilder {
+	return func(any) (any, error) {
+		list := make([]any, n)
+		for i := range list {
+			list[i] = soap.RawXML(fmt.Sprintf(`<Trace%d xmlns="urn:test"/>`, i))
+		}
+		return list, nil
+	}
+}
+
+func TestLimitPassesRequests(t *testing.T) {
+	srv, v := newLimitedServer(t, Limits{MaxEnvelopeSize: 4096, MaxHeaders: 3, ReadTimeout: time.Second, RequireContentLength: true})
+	var resp echoResponse
+	assert.NoError(t, soap.NewClient(srv.URL).Do(context.Background(), "Echo", &echo{Value: "hi"}, &resp,
+		soap.WithHeaderBuilder(func(ctx context.Context, body any) (any, error) { return headers(3)(body) })))
+	assert.Equal(t, "ok", resp.Value)
+	assert.Empty(t, v.list())
+}
+
+func TestLimitRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		limits  Limits
+		request any
+		headers int
+		status  int
+		kind    ViolationKind
+	}{
+		{name: "envelope too large", limits: Limits{MaxEnvelopeSize: 100},
+			request: &echo{Value: strings.Repeat("x", 200)}, status: http.StatusRequestEntityTooLarge, kind: EnvelopeTooLarge},
+		{name: "too many headers", limits: Limits{MaxHeaders: 2}, request: &echo{}, headers: 3,
+			status: http.StatusBadRequest, kind: TooManyHeaders},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, v := newLimitedServer(t, tt.limits)
+			var info soap.ResponseInfo
+			err := soap.NewClient(srv.URL).Do(context.Background(), "Echo", tt.request, &echoResponse{},
+				soap.WithResponseInfo(&info),
+				soap.WithHeaderBuilder(func(ctx context.Context, body any) (any, error) { return headers(tt.headers)(body) }))
+			var fault *soap.Fault
+			if assert.ErrorAs(t, err, &fault) {
+				assert.Equal(t, "soap:Client", fault.Code)
+			}
+			assert.Equal(t, tt.status, info.StatusCode)
+			assert.Equal(t, []ViolationKind{tt.kind}, v.list())
+		})
+	}
+}
+
+func TestLimitSOAP12Fault(t *testing.T) {
+	srv, _ := newLimitedServer(t, Limits{MaxEnvelopeSize: 100})
+	err := soap.NewClient(srv.URL).Do(context.Background(), "Echo", &echo{Value: strings.Repeat("x", 200)},
+		&echoResponse{}, soap.WithVersion(soap.SOAP12))
+	var fault *soap.Fault
+	if assert.ErrorAs(t, err, &fault) {
+		assert.Equal(t, "soap:Sender", fault.Code)
+	}
+}
+
+func TestLimitLengthRequired(t *testing.T) {
+	srv, v := newLimitedServer(t, Limits{RequireContentLength: true})
+	req, err := http.NewRequest(http.MethodPost, srv.URL, io.MultiReader(strings.NewReader("<Envelope/>")))
+	require.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusLengthRequired, resp.StatusCode)
+	assert.Equal(t, []ViolationKind{LengthRequired}, v.list())
+}
+
+// dial sends the request line and headers of a chunked POST to srv.
+func dial(t *testing.T, srv *httptest.Server, header string) net.Conn {
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\nContent-Type: text/xml\r\n"+header+"\r\n")
+	require.NoError(t, err)
+	return conn
+}
+
+// assertClosed asserts that the response has status and the server closes the connection promptly.
+func assertClosed(t *testing.T, conn net.Conn, status int) {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, status, resp.StatusCode)
+	_, err = r.ReadByte()
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, os.ErrDeadlineExceeded), "connection still open")
+}
+
+func TestLimitOversizedStream(t *testing.T) {
+	srv, v := newLimitedServer(t, Limits{MaxEnvelopeSize: 1024})
+	conn := dial(t, srv, "Transfer-Encoding: chunked\r\n")
+	// the client keeps streaming until the server closes the connection
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		chunk := fmt.Sprintf("%x\r\n%s\r\n", 256, strings.Repeat("x", 256))
+		for {
+			if _, err := io.WriteString(conn, chunk); err != nil {
+				return
+			}
+		}
+	}()
+	assertClosed(t, conn, http.StatusRequestEntityTooLarge)
+	conn.Close()
+	<-done
+	assert.Equal(t, []ViolationKind{EnvelopeTooLarge}, v.list())
+}
+
+func TestLimitOversizedContentLength(t *testing.T) {
+	srv, v := newLimitedServer(t, Limits{MaxEnvelopeSize: 1024})
+	conn := dial(t, srv, "Content-Length: 1000000\r\n")
+	assertClosed(t, conn, http.StatusRequestEntityTooLarge)
+	assert.Equal(t, []ViolationKind{EnvelopeTooLarge}, v.list())
+}
+
+func TestLimitSlowClient(t *testing.T) {
+	srv, v := newLimitedServer(t, Limits{ReadTimeout: 100 * time.Millisecond})
+	conn := dial(t, srv, "Content-Length: 100\r\n")
+	// the client sends part of the body and stalls
+	_, err := io.WriteString(conn, "<soap:Envelope")
+	require.NoError(t, err)
+	start := time.Now()
+	assertClosed(t, conn, http.StatusRequestTimeout)
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, []ViolationKind{ReadTimeout}, v.list())
+}
@@ -0,0 +1,23 @@
+package server
+
+import (
+	"fmt"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+// SignResponse signs the serialized response envelope with cfg like soap.ApplySecurity, confirming the
+// signatures of the serialized request envelope with wsse11:SignatureConfirmation elements (WS-Security 1.1)
+// for clients verifying them, see soap.WithSignatureConfirmation. An unsigned request is confirmed with a
+// confirmation without value.
+func SignResponse(response, request []byte, cfg soap.SecurityConfig) ([]byte, error) {
+	values, err := soap.SignatureValues(request)
+	if err != nil {
+		return nil, fmt.Errorf("signatures of the request: %w", err)
+	}
+	if len(values) == 0 {
+		values = []string{""}
+	}
+	cfg.SignatureConfirmations = values
+	return soap.ApplySecurity(response, cfg)
+}
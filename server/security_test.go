@@ -0,0 +1,44 @@
+package server
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+const (
+	signRequest = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<Echo xmlns="urn:test"><Value>hi</Value></Echo></soap:Body></soap:Envelope>`
+	signResponse = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<EchoResponse xmlns="urn:test"><Value>hi</Value></EchoResponse></soap:Body></soap:Envelope>`
+)
+
+func TestSignResponse(t *testing.T) {
+	cert, err := tls.LoadX509KeyPair("../testdata/cert.pem", "../testdata/key.pem")
+	require.NoError(t, err)
+	cfg := soap.SecurityConfig{Certificate: cert, Signing: soap.SigningOptions{BinarySecurityToken: true}}
+
+	request, err := soap.ApplySecurity([]byte(signRequest), cfg)
+	require.NoError(t, err)
+	values, err := soap.SignatureValues(request)
+	require.NoError(t, err)
+	require.Len(t, values, 1)
+
+	response, err := SignResponse([]byte(signResponse), request, cfg)
+	require.NoError(t, err)
+	assert.NoError(t, soap.VerifySignature(response, soap.VerifyOptions{SignatureConfirmations: values}))
+	assert.ErrorIs(t, soap.VerifySignature(response, soap.VerifyOptions{SignatureConfirmations: []string{""}}),
+		soap.ErrSignatureConfirmationMismatch)
+
+	// an unsigned request is confirmed without value
+	response, err = SignResponse([]byte(signResponse), []byte(signRequest), cfg)
+	require.NoError(t, err)
+	assert.NoError(t, soap.VerifySignature(response, soap.VerifyOptions{SignatureConfirmations: []string{""}}))
+
+	_, err = SignResponse([]byte(signResponse), []byte("<soap:Envelope"), cfg)
+	assert.Error(t, err)
+}
@@ -0,0 +1,590 @@
+package server
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/m29h/xml"
+)
+
+// Implements the generation of WSDL 1.1 documents with document/literal wrapped bindings from the request
+// and response structs of the operations of a service.
+
+const (
+	wsdlNS          = "http://schemas.xmlsoap.org/wsdl/"
+	wsdlSOAPNS      = "http://schemas.xmlsoap.org/wsdl/soap/"
+	wsdlSOAP12NS    = "http://schemas.xmlsoap.org/wsdl/soap12/"
+	xsdNS           = "http://www.w3.org/2001/XMLSchema"
+	httpTransportNS = "http://schemas.xmlsoap.org/soap/http"
+)
+
+var (
+	// ErrInvalidService is returned if a service cannot be described, e.g. for an operation without request
+	// struct or a missing namespace.
+	ErrInvalidService = errors.New("invalid service description")
+)
+
+// Operation is an operation of a service.
+type Operation struct {
+	// Name is the name of the operation, the local name of the request element if empty.
+	Name string
+	// Action is the SOAP action of the operation.
+	Action string
+	// Request and Response are values of the request and response body structs, e.g. &GetOrder{}. An
+	// operation without Response is one-way.
+	Request  any
+	Response any
+}
+
+// Service describes a service and its operations for publishing its WSDL document.
+//
+// The schema types are derived from the xml tags of the structs: elements, attributes and character data, with
+// pointers and omitempty fields being optional and slices unbounded. Named struct types become named complex
+// types, unqualified children are in the namespace of their parent, as the encoder puts them. Elements without
+// namespace are put into the namespace of the service. Types marshaling themselves are published as xs:anyType,
+// other types implementing encoding.TextMarshaler as xs:string.
+//
+// Interoperability with other WSDL consumers, such as the proxies generated by .NET svcutil, is out of scope:
+// the documents are only verified to round-trip through the wsdl package of this module.
+type Service struct {
+	// Name is the name of the service, port types, bindings and ports are named after it.
+	Name string
+	// Namespace is the target namespace of the WSDL document.
+	Namespace string
+	// Address is the address published for the ports. PublishWSDL uses the URL of the WSDL request without
+	// query if empty.
+	Address    string
+	Operations []Operation
+}
+
+// WSDL returns the WSDL document of the service with the SOAP 1.1 and 1.2 ports at address.
+func (s *Service) WSDL(address string) ([]byte, error) {
+	if s.Name == "" || s.Namespace == "" {
+		return nil, fmt.Errorf("%w: service name and namespace are required", ErrInvalidService)
+	}
+	b := newSchemaBuilder(s.Namespace)
+
+	type operation struct {
+		name, action string
+		input        string
+		output       string
+	}
+	var ops []operation
+	names := map[string]bool{}
+	for _, op := range s.Operations {
+		in, err := b.global(op.Request)
+		if err != nil {
+			return nil, fmt.Errorf("%w: operation %s: %v", ErrInvalidService, op.Name, err)
+		}
+		o := operation{name: op.Name, action: op.Action, input: b.qname(in.Space, in.Local)}
+		if o.name == "" {
+			o.name = in.Local
+		}
+		if op.Response != nil {
+			out, err := b.global(op.Response)
+			if err != nil {
+				return nil, fmt.Errorf("%w: operation %s: %v", ErrInvalidService, o.name, err)
+			}
+			o.output = b.qname(out.Space, out.Local)
+		}
+		if names[o.name] {
+			return nil, fmt.Errorf("%w: duplicate operation %s", ErrInvalidService, o.name)
+		}
+		names[o.name] = true
+		ops = append(ops, o)
+	}
+
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	defs := doc.CreateElement("wsdl:definitions")
+	defs.CreateAttr("name", s.Name)
+	defs.CreateAttr("targetNamespace", s.Namespace)
+	defs.CreateAttr("xmlns:wsdl", wsdlNS)
+	defs.CreateAttr("xmlns:soap", wsdlSOAPNS)
+	defs.CreateAttr("xmlns:soap12", wsdlSOAP12NS)
+	defs.CreateAttr("xmlns:xs", xsdNS)
+	for _, ns := range b.spaces {
+		defs.CreateAttr("xmlns:"+b.prefixes[ns], ns)
+	}
+
+	types := defs.CreateElement("wsdl:types")
+	for _, ns := range b.spaces {
+		schema := b.schemas[ns]
+		for _, other := range b.spaces {
+			if other != ns {
+				// imports precede the declarations
+				imp := etree.NewElement("xs:import")
+				imp.CreateAttr("namespace", other)
+				schema.InsertChildAt(0, imp)
+			}
+		}
+		types.AddChild(schema)
+	}
+
+	for _, op := range ops {
+		addMessage(defs, op.name+"Request", op.input)
+		if op.output != "" {
+			addMessage(defs, op.name+"Response", op.output)
+		}
+	}
+
+	portType := defs.CreateElement("wsdl:portType")
+	portType.CreateAttr("name", s.Name+"PortType")
+	for _, op := range ops {
+		el := portType.CreateElement("wsdl:operation")
+		el.CreateAttr("name", op.name)
+		el.CreateElement("wsdl:input").CreateAttr("message", "tns:"+op.name+"Request")
+		if op.output != "" {
+			el.CreateElement("wsdl:output").CreateAttr("message", "tns:"+op.name+"Response")
+		}
+	}
+
+	service := etree.NewElement("wsdl:service")
+	service.CreateAttr("name", s.Name)
+	for _, prefix := range []string{"soap", "soap12"} {
+		name := s.Name + "Soap"
+		if prefix == "soap12" {
+			name += "12"
+		}
+		binding := defs.CreateElement("wsdl:binding")
+		binding.CreateAttr("name", name)
+		binding.CreateAttr("type", "tns:"+s.Name+"PortType")
+		soapBinding := binding.CreateElement(prefix + ":binding")
+		soapBinding.CreateAttr("style", "document")
+		soapBinding.CreateAttr("transport", httpTransportNS)
+		for _, op := range ops {
+			el := binding.CreateElement("wsdl:operation")
+			el.CreateAttr("name", op.name)
+			soapOp := el.CreateElement(prefix + ":operation")
+			soapOp.CreateAttr("soapAction", op.action)
+			soapOp.CreateAttr("style", "document")
+			el.CreateElement("wsdl:input").CreateElement(prefix+":body").CreateAttr("use", "literal")
+			if op.output != "" {
+				el.CreateElement("wsdl:output").CreateElement(prefix+":body").CreateAttr("use", "literal")
+			}
+		}
+		port := service.CreateElement("wsdl:port")
+		port.CreateAttr("name", name)
+		port.CreateAttr("binding", "tns:"+name)
+		port.CreateElement(prefix+":address").CreateAttr("location", address)
+	}
+	defs.AddChild(service)
+
+	// the target namespace has the tns prefix, the messages and bindings refer to it
+	if _, ok := b.prefixes[s.Namespace]; !ok {
+		defs.CreateAttr("xmlns:tns", s.Namespace)
+	}
+	doc.Indent(2)
+	return doc.WriteToBytes()
+}
+
+func addMessage(defs *etree.Element, name, element string) {
+	msg := defs.CreateElement("wsdl:message")
+	msg.CreateAttr("name", name)
+	part := msg.CreateElement("wsdl:part")
+	part.CreateAttr("name", "parameters")
+	part.CreateAttr("element", element)
+}
+
+// PublishWSDL returns a handler answering GET requests with a wsdl query parameter, e.g. /orders?wsdl, with the
+// WSDL document of s, and passing all other requests to h.
+func PublishWSDL(h http.Handler, s *Service) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !wantsWSDL(r) {
+			h.ServeHTTP(w, r)
+			return
+		}
+		address := s.Address
+		if address == "" {
+			scheme := "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+			address = scheme + "://" + r.Host + r.URL.Path
+		}
+		doc, err := s.WSDL(address)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.Itoa(len(doc)))
+		_, _ = w.Write(doc)
+	})
+}
+
+// wantsWSDL reports whether the query of r has a wsdl parameter, in any case.
+func wantsWSDL(r *http.Request) bool {
+	for key := range r.URL.Query() {
+		if strings.EqualFold(key, "wsdl") {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaBuilder collects the schemas of the elements of a service, one per namespace.
+type schemaBuilder struct {
+	tns      string
+	schemas  map[string]*etree.Element
+	spaces   []string
+	prefixes map[string]string
+	// types holds the names of the complex types of the named struct types per namespace
+	types     map[typeKey]string
+	typeNames map[string]bool
+	elements  map[xml.Name]bool
+}
+
+type typeKey struct {
+	t  reflect.Type
+	ns string
+}
+
+func newSchemaBuilder(tns string) *schemaBuilder {
+	return &schemaBuilder{tns: tns, schemas: map[string]*etree.Element{}, prefixes: map[string]string{},
+		types: map[typeKey]string{}, typeNames: map[string]bool{}, elements: map[xml.Name]bool{}}
+}
+
+// schema returns the schema of the namespace ns, the target namespace if empty.
+func (b *schemaBuilder) schema(ns string) *etree.Element {
+	if schema, ok := b.schemas[ns]; ok {
+		return schema
+	}
+	schema := etree.NewElement("xs:schema")
+	schema.CreateAttr("targetNamespace", ns)
+	schema.CreateAttr("elementFormDefault", "qualified")
+	b.schemas[ns] = schema
+	b.spaces = append(b.spaces, ns)
+	if ns == b.tns {
+		b.prefixes[ns] = "tns"
+	} else {
+		b.prefixes[ns] = "ns" + strconv.Itoa(len(b.prefixes)+1)
+	}
+	return schema
+}
+
+func (b *schemaBuilder) qname(ns, local string) string {
+	b.schema(ns)
+	return b.prefixes[ns] + ":" + local
+}
+
+// global declares the element of the body struct v and returns its name.
+func (b *schemaBuilder) global(v any) (xml.Name, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return xml.Name{}, fmt.Errorf("body %v is not a struct", t)
+	}
+	name, ok := typeElementName(t)
+	if !ok {
+		name.Local = t.Name()
+	}
+	if name.Local == "" {
+		return xml.Name{}, fmt.Errorf("body %v has no element name", t)
+	}
+	if name.Space == "" {
+		name.Space = b.tns
+	}
+	b.declare(name, t)
+	return name, nil
+}
+
+// typeElementName returns the name in the tag of the XMLName field of the struct type t.
+func typeElementName(t reflect.Type) (xml.Name, bool) {
+	f, ok := t.FieldByName("XMLName")
+	if !ok || f.Type != reflect.TypeOf(xml.Name{}) {
+		return xml.Name{}, false
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("xml"), ",")
+	if name == "" {
+		return xml.Name{}, false
+	}
+	return splitName(name), true
+}
+
+// splitName splits the name of an xml tag into namespace and local name.
+func splitName(name string) xml.Name {
+	if ns, local, ok := strings.Cut(name, " "); ok {
+		return xml.Name{Space: ns, Local: local}
+	}
+	return xml.Name{Local: name}
+}
+
+// declare adds the global element name with content of type t, unless it was declared before.
+func (b *schemaBuilder) declare(name xml.Name, t reflect.Type) {
+	if b.elements[name] {
+		return
+	}
+	b.elements[name] = true
+	el := b.schema(name.Space).CreateElement("xs:element")
+	el.CreateAttr("name", name.Local)
+	b.setType(el, t, name.Space)
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*xml.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	timeType          = reflect.TypeOf(time.Time{})
+)
+
+// simpleType returns the schema type of values of type t, empty for structs with content of their own.
+func simpleType(t reflect.Type) string {
+	switch {
+	case t.Implements(marshalerType) || reflect.PointerTo(t).Implements(marshalerType):
+		return "xs:anyType"
+	case t == timeType:
+		return "xs:dateTime"
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return "xs:string"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "xs:string"
+	case reflect.Bool:
+		return "xs:boolean"
+	case reflect.Int, reflect.Int64:
+		return "xs:long"
+	case reflect.Int32:
+		return "xs:int"
+	case reflect.Int16:
+		return "xs:short"
+	case reflect.Int8:
+		return "xs:byte"
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return "xs:unsignedLong"
+	case reflect.Uint32:
+		return "xs:unsignedInt"
+	case reflect.Uint16:
+		return "xs:unsignedShort"
+	case reflect.Uint8:
+		return "xs:unsignedByte"
+	case reflect.Float32:
+		return "xs:float"
+	case reflect.Float64:
+		return "xs:double"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "xs:base64Binary"
+		}
+	case reflect.Struct:
+		return ""
+	}
+	return "xs:anyType"
+}
+
+// setType sets the type of the element declaration el for values of type t, with its children in ns.
+func (b *schemaBuilder) setType(el *etree.Element, t reflect.Type, ns string) {
+	if simple := simpleType(t); simple != "" {
+		el.CreateAttr("type", simple)
+		return
+	}
+	if t.Name() == "" {
+		b.content(el.CreateElement("xs:complexType"), t, ns)
+		return
+	}
+	el.CreateAttr("type", b.complexType(t, ns))
+}
+
+// complexType returns the qualified name of the complex type of the named struct type t in ns.
+func (b *schemaBuilder) complexType(t reflect.Type, ns string) string {
+	key := typeKey{t: t, ns: ns}
+	if name, ok := b.types[key]; ok {
+		return b.qname(ns, name)
+	}
+	name := t.Name()
+	for i := 2; b.typeNames[ns+" "+name]; i++ {
+		name = t.Name() + strconv.Itoa(i)
+	}
+	b.typeNames[ns+" "+name] = true
+	b.types[key] = name
+	ct := b.schema(ns).CreateElement("xs:complexType")
+	ct.CreateAttr("name", name)
+	b.content(ct, t, ns)
+	return b.qname(ns, name)
+}
+
+// schemaField is a field of a struct mapped to an element, an attribute or the character data.
+type schemaField struct {
+	field reflect.StructField
+	name  string
+	flags string
+}
+
+func (f schemaField) has(flag string) bool {
+	for _, fl := range strings.Split(f.flags, ",") {
+		if fl == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaFields returns the fields of the struct type t as encoded, with the fields of embedded structs in place.
+func schemaFields(t reflect.Type) []schemaField {
+	var fields []schemaField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("xml")
+		if tag == "-" || !f.IsExported() && !f.Anonymous || f.Name == "XMLName" {
+			continue
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && simpleType(ft) == "" {
+				fields = append(fields, schemaFields(ft)...)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		fields = append(fields, schemaField{field: f, name: name, flags: flags})
+	}
+	return fields
+}
+
+// content adds the content of the struct type t to the complex type ct, with the child elements in ns.
+func (b *schemaBuilder) content(ct *etree.Element, t reflect.Type, ns string) {
+	var elements, attrs []schemaField
+	chardata, open := false, false
+	for _, f := range schemaFields(t) {
+		switch {
+		case f.has("attr"):
+			attrs = append(attrs, f)
+		case f.has("chardata"):
+			chardata = true
+		case f.has("innerxml") || f.has("any"):
+			open = true
+		case f.has("comment"):
+		default:
+			elements = append(elements, f)
+		}
+	}
+
+	if chardata && len(elements) == 0 && !open {
+		ext := ct.CreateElement("xs:simpleContent").CreateElement("xs:extension")
+		ext.CreateAttr("base", "xs:string")
+		b.attributes(ext, attrs)
+		return
+	}
+	if chardata {
+		ct.CreateAttr("mixed", "true")
+	}
+	seq := ct.CreateElement("xs:sequence")
+	// wrappers holds the open elements of the a>b paths of the preceding fields
+	type wrapper struct {
+		name string
+		seq  *etree.Element
+	}
+	var wrappers []wrapper
+	for _, f := range elements {
+		path := strings.Split(f.name, ">")
+		parents, name := path[:len(path)-1], path[len(path)-1]
+		common := 0
+		for common < len(wrappers) && common < len(parents) && wrappers[common].name == parents[common] {
+			common++
+		}
+		wrappers = wrappers[:common]
+		for _, p := range parents[common:] {
+			parent := seq
+			if len(wrappers) > 0 {
+				parent = wrappers[len(wrappers)-1].seq
+			}
+			el := parent.CreateElement("xs:element")
+			el.CreateAttr("name", p)
+			wrappers = append(wrappers, wrapper{name: p, seq: el.CreateElement("xs:complexType").CreateElement("xs:sequence")})
+		}
+		parent := seq
+		if len(wrappers) > 0 {
+			parent = wrappers[len(wrappers)-1].seq
+		}
+		b.element(parent, f, name, ns)
+	}
+	if open {
+		wildcard := seq.CreateElement("xs:any")
+		wildcard.CreateAttr("processContents", "lax")
+		wildcard.CreateAttr("minOccurs", "0")
+		wildcard.CreateAttr("maxOccurs", "unbounded")
+	}
+	b.attributes(ct, attrs)
+}
+
+// element adds the declaration of the child element of field f named name to seq.
+func (b *schemaBuilder) element(seq *etree.Element, f schemaField, name string, ns string) {
+	t := f.field.Type
+	optional := f.has("omitempty")
+	repeated := false
+	if (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8 {
+		repeated = true
+		t = t.Elem()
+	}
+	for t.Kind() == reflect.Ptr {
+		optional = true
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface {
+		optional = true
+	}
+	n := splitName(name)
+	if n.Local == "" {
+		if typeName, ok := typeElementName(t); ok && t.Kind() == reflect.Struct {
+			n = typeName
+		} else {
+			n.Local = f.field.Name
+		}
+	}
+
+	el := seq.CreateElement("xs:element")
+	if n.Space != "" && n.Space != ns {
+		b.declare(n, t)
+		el.CreateAttr("ref", b.qname(n.Space, n.Local))
+	} else {
+		el.CreateAttr("name", n.Local)
+		b.setType(el, t, ns)
+	}
+	if optional || repeated {
+		el.CreateAttr("minOccurs", "0")
+	}
+	if repeated {
+		el.CreateAttr("maxOccurs", "unbounded")
+	}
+}
+
+// attributes adds the declarations of the attribute fields to el.
+func (b *schemaBuilder) attributes(el *etree.Element, attrs []schemaField) {
+	for _, f := range attrs {
+		t := f.field.Type
+		optional := f.has("omitempty")
+		for t.Kind() == reflect.Ptr {
+			optional = true
+			t = t.Elem()
+		}
+		name := splitName(f.name).Local
+		if name == "" {
+			name = f.field.Name
+		}
+		attr := el.CreateElement("xs:attribute")
+		attr.CreateAttr("name", name)
+		simple := simpleType(t)
+		if simple == "" || simple == "xs:anyType" {
+			simple = "xs:string"
+		}
+		attr.CreateAttr("type", simple)
+		if !optional {
+			attr.CreateAttr("use", "required")
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/OmerBerkcanMee/gosoap/wsdl"
+)
+
+type orderLine struct {
+	SKU      string   `xml:"SKU"`
+	Quantity int32    `xml:"Quantity"`
+	Note     *string  `xml:"Note"`
+	Tags     []string `xml:"Tags>Tag"`
+}
+
+type orderAudit struct {
+	Created time.Time `xml:"Created"`
+}
+
+type getOrder struct {
+	XMLName xml.Name `xml:"urn:orders GetOrder"`
+	ID      string   `xml:"ID"`
+	Channel string   `xml:"channel,attr,omitempty"`
+	Comment string   `xml:"Comment,omitempty"`
+}
+
+type getOrderResponse struct {
+	XMLName xml.Name `xml:"urn:orders GetOrderResponse"`
+	orderAudit
+	ID    string      `xml:"ID"`
+	Lines []orderLine `xml:"Line"`
+	Total float64     `xml:"Total"`
+	Paid  bool        `xml:"Paid"`
+	Extra []byte      `xml:"Extra,omitempty"`
+}
+
+type cancelOrder struct {
+	XMLName xml.Name `xml:"urn:orders CancelOrder"`
+	ID      string   `xml:"ID"`
+}
+
+var orderService = &Service{
+	Name:      "OrderService",
+	Namespace: "urn:orders",
+	Operations: []Operation{
+		{Action: "urn:orders/GetOrder", Request: &getOrder{}, Response: &getOrderResponse{}},
+		{Name: "Cancel", Action: "urn:orders/Cancel", Request: &cancelOrder{}},
+	},
+}
+
+// The generated documents are checked with the wsdl package of this module only, interoperability with other
+// consumers such as .NET svcutil is out of scope of the tests.
+func TestWSDLRoundTrip(t *testing.T) {
+	doc, err := orderService.WSDL("http://example.com/orders")
+	require.NoError(t, err)
+	defs, err := wsdl.Parse(strings.NewReader(string(doc)))
+	require.NoError(t, err)
+
+	assert.Equal(t, "urn:orders", defs.TargetNamespace)
+	assert.Equal(t, []wsdl.Operation{
+		{Binding: "OrderServiceSoap", Name: "GetOrder", Action: "urn:orders/GetOrder"},
+		{Binding: "OrderServiceSoap", Name: "Cancel", Action: "urn:orders/Cancel"},
+		{Binding: "OrderServiceSoap12", Name: "GetOrder", Action: "urn:orders/GetOrder", SOAP12: true},
+		{Binding: "OrderServiceSoap12", Name: "Cancel", Action: "urn:orders/Cancel", SOAP12: true},
+	}, defs.Operations())
+	assert.Equal(t, "http://example.com/orders", defs.Endpoint("OrderServiceSoap"))
+	assert.Equal(t, "http://example.com/orders", defs.Endpoint("OrderServiceSoap12"))
+
+	// the required elements of the schema are the ones without pointer or omitempty
+	validate := defs.Validator("OrderServiceSoap")
+	var missing *wsdl.MissingElementsError
+	require.ErrorAs(t, validate("urn:orders/GetOrder", &getOrder{}), &missing)
+	assert.Equal(t, []string{"GetOrder/ID"}, missing.Paths)
+	assert.NoError(t, validate("urn:orders/GetOrder", &getOrder{ID: "1"}))
+
+	text := string(doc)
+	assert.Contains(t, text, `<xs:complexType name="orderLine">`)
+	assert.Contains(t, text, `<xs:element name="Line" type="tns:orderLine" minOccurs="0" maxOccurs="unbounded"/>`)
+	assert.Contains(t, text, `<xs:element name="Note" type="xs:string" minOccurs="0"/>`)
+	assert.Contains(t, text, `<xs:element name="Tag" type="xs:string" minOccurs="0" maxOccurs="unbounded"/>`)
+	assert.Contains(t, text, `<xs:element name="Created" type="xs:dateTime"/>`)
+	assert.Contains(t, text, `<xs:element name="Quantity" type="xs:int"/>`)
+	assert.Contains(t, text, `<xs:element name="Extra" type="xs:base64Binary" minOccurs="0"/>`)
+	assert.Contains(t, text, `<xs:attribute name="channel" type="xs:string"/>`)
+	assert.Contains(t, text, `<wsdl:message name="CancelRequest">`)
+	assert.NotContains(t, text, `CancelResponse`)
+}
+
+func TestWSDLForeignNamespace(t *testing.T) {
+	type item struct {
+		Name string `xml:"Name"`
+	}
+	type lookup struct {
+		XMLName xml.Name `xml:"urn:lookup Lookup"`
+		Item    item     `xml:"urn:items Item"`
+	}
+	svc := &Service{Name: "Lookup", Namespace: "urn:service",
+		Operations: []Operation{{Action: "Lookup", Request: &lookup{}}}}
+	doc, err := svc.WSDL("http://example.com")
+	require.NoError(t, err)
+	defs, err := wsdl.Parse(strings.NewReader(string(doc)))
+	require.NoError(t, err)
+	require.NotNil(t, defs.Types)
+	require.Len(t, defs.Types.Schemas, 2)
+	assert.Equal(t, "urn:lookup", defs.Types.Schemas[0].TargetNamespace)
+	assert.Equal(t, "urn:items", defs.Types.Schemas[1].TargetNamespace)
+	assert.Contains(t, string(doc), `ref="ns2:Item"`)
+	assert.Contains(t, string(doc), `xmlns:tns="urn:service"`)
+}
+
+func TestWSDLInvalidService(t *testing.T) {
+	var tests = []struct {
+		name string
+		svc  *Service
+	}{
+		{"no namespace", &Service{Name: "S"}},
+		{"no struct", &Service{Name: "S", Namespace: "urn:s", Operations: []Operation{{Request: "x"}}}},
+		{"no request", &Service{Name: "S", Namespace: "urn:s", Operations: []Operation{{Name: "Op"}}}},
+		{"duplicate", &Service{Name: "S", Namespace: "urn:s", Operations: []Operation{
+			{Request: &cancelOrder{}}, {Request: &cancelOrder{}},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.svc.WSDL("http://example.com")
+			assert.ErrorIs(t, err, ErrInvalidService)
+		})
+	}
+}
+
+func TestPublishWSDL(t *testing.T) {
+	var called []string
+	h := PublishWSDL(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = append(called, r.Method+" "+r.URL.String())
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<GetOrderResponse xmlns="urn:orders"><ID>1</ID><Total>9.5</Total></GetOrderResponse></soap:Body></soap:Envelope>`)
+	}), orderService)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	for _, query := range []string{"?wsdl", "?WSDL"} {
+		resp, err := http.Get(srv.URL + "/orders" + query)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/xml; charset=utf-8", resp.Header.Get("Content-Type"))
+		defs, err := wsdl.Parse(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, srv.URL+"/orders", defs.Endpoint("OrderServiceSoap"))
+	}
+	assert.Empty(t, called)
+
+	// a client created from the published document calls the service
+	resp, err := http.Get(srv.URL + "/orders?wsdl")
+	require.NoError(t, err)
+	defs, err := wsdl.Parse(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	client, err := wsdl.NewClient(defs, "OrderServiceSoap")
+	require.NoError(t, err)
+
+	var out getOrderResponse
+	require.NoError(t, client.Do(context.Background(), "urn:orders/GetOrder", &getOrder{ID: "1"}, &out))
+	assert.Equal(t, 9.5, out.Total)
+	assert.ErrorIs(t, client.Do(context.Background(), "urn:orders/GetOrder", &getOrder{}, &out), wsdl.ErrMissingElements)
+	assert.Equal(t, []string{"POST /orders"}, called)
+}
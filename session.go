@@ -0,0 +1,320 @@
+package soap
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrNoSessionStore is returned by Client.SetSessionToken if the client has no store set with
+	// WithSessionStore.
+	ErrNoSessionStore = errors.New("client has no session store")
+)
+
+// Session is the state of a login kept across calls and processes: the cookies set by the service and named
+// tokens the application stores with it, e.g. a session id returned in a login response.
+type Session struct {
+	Cookies []SessionCookie  `json:"cookies,omitempty"`
+	Tokens  map[string]Token `json:"tokens,omitempty"`
+}
+
+// SessionCookie is a cookie set by a response to a request for URL.
+type SessionCookie struct {
+	URL      string `json:"url"`
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Domain   string `json:"domain,omitempty"`
+	Path     string `json:"path,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+	HttpOnly bool   `json:"httpOnly,omitempty"`
+	// Expires is the time the cookie expires at, the zero time for a cookie without expiry.
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// Expired reports whether the cookie has expired at now.
+func (c SessionCookie) Expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !now.Before(c.Expires)
+}
+
+// key identifies the cookie, a cookie with the same key replaces it.
+func (c SessionCookie) key() string {
+	domain := c.Domain
+	if domain == "" {
+		if u, err := url.Parse(c.URL); err == nil {
+			domain = u.Hostname()
+		}
+	}
+	return c.Name + ";" + domain + ";" + c.Path
+}
+
+func (c SessionCookie) httpCookie() *http.Cookie {
+	return &http.Cookie{Name: c.Name, Value: c.Value, Domain: c.Domain, Path: c.Path, Secure: c.Secure,
+		HttpOnly: c.HttpOnly, Expires: c.Expires}
+}
+
+// dropExpired removes the cookies and tokens expired at now.
+func (s *Session) dropExpired(now time.Time) {
+	cookies := s.Cookies[:0]
+	for _, c := range s.Cookies {
+		if !c.Expired(now) {
+			cookies = append(cookies, c)
+		}
+	}
+	s.Cookies = cookies
+	for name, token := range s.Tokens {
+		if token.Expired(now) {
+			delete(s.Tokens, name)
+		}
+	}
+}
+
+// SessionStore persists a Session, see WithSessionStore.
+type SessionStore interface {
+	// Load returns the stored session, an empty one if none was saved yet.
+	Load() (*Session, error)
+	// Save replaces the stored session.
+	Save(session *Session) error
+}
+
+// FileSessionStore is a SessionStore keeping the session as JSON in a file readable by its owner only.
+// Processes sharing the file share the session; the file is replaced atomically, so they read the old or the
+// new session and the last one saving wins.
+type FileSessionStore struct {
+	// Encrypt is applied to the file content before it is written if not nil, e.g. to seal it with a key of
+	// the user.
+	Encrypt func(plain []byte) ([]byte, error)
+	// Decrypt reverses Encrypt on the content read.
+	Decrypt func(data []byte) ([]byte, error)
+	// Clock is the source of time to drop expired entries, the system clock if nil.
+	Clock Clock
+
+	path string
+}
+
+// NewFileSessionStore returns a store keeping the session in the file at path. The directory is created if
+// missing once the session is saved.
+func NewFileSessionStore(path string) *FileSessionStore {
+	return &FileSessionStore{path: path}
+}
+
+// Load reads the session from the file, without the cookies and tokens expired since they were saved. A
+// missing file is an empty session.
+func (s *FileSessionStore) Load() (*Session, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Session{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.Decrypt != nil {
+		if data, err = s.Decrypt(data); err != nil {
+			return nil, err
+		}
+	}
+	session := &Session{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	session.dropExpired(clockNow(s.Clock))
+	return session, nil
+}
+
+// Save writes the session to a temporary file with permissions 0600 next to the file and renames it over the
+// file.
+func (s *FileSessionStore) Save(session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if s.Encrypt != nil {
+		if data, err = s.Encrypt(data); err != nil {
+			return err
+		}
+	}
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	// CreateTemp creates the file with permissions 0600
+	f, err := os.CreateTemp(dir, ".session-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// WithSessionStore keeps the cookies set by the service in a session loaded from store on the first call and
+// saved to it whenever a response changes them, so a login survives the process. The cookies are sent with
+// the requests they match like a browser does. Errors saving the session do not fail the call, it is saved
+// again with the next change. Named tokens are stored with Client.SetSessionToken.
+//
+// Do not combine it with a custom http.Client having a Jar, both would add their cookies.
+func WithSessionStore(store SessionStore) Option {
+	state := &sessionState{store: store}
+	return func(s *settings) error {
+		s.session = state
+		return nil
+	}
+}
+
+// sessionState is the session of a store in use by the calls.
+type sessionState struct {
+	store SessionStore
+
+	mu      sync.Mutex
+	loaded  bool
+	session *Session
+	jar     *cookiejar.Jar
+}
+
+// load loads the session from the store once it loaded successfully. The caller holds the lock.
+func (st *sessionState) load(now time.Time) error {
+	if st.loaded {
+		return nil
+	}
+	session, err := st.store.Load()
+	if err != nil {
+		return err
+	}
+	if session.Tokens == nil {
+		session.Tokens = map[string]Token{}
+	}
+	session.dropExpired(now)
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return err
+	}
+	for _, c := range session.Cookies {
+		if u, err := url.Parse(c.URL); err == nil {
+			jar.SetCookies(u, []*http.Cookie{c.httpCookie()})
+		}
+	}
+	st.session, st.jar, st.loaded = session, jar, true
+	return nil
+}
+
+// addCookies adds the cookies of the session matching the request to it.
+func (st *sessionState) addCookies(req *http.Request, now time.Time) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.load(now); err != nil {
+		return err
+	}
+	for _, c := range st.jar.Cookies(req.URL) {
+		req.AddCookie(c)
+	}
+	return nil
+}
+
+// record stores the cookies set by resp in the session and saves it if they changed it.
+func (st *sessionState) record(resp *http.Response, now time.Time) {
+	if resp.Request == nil {
+		return
+	}
+	cookies := resp.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.load(now); err != nil {
+		return
+	}
+	u := resp.Request.URL
+	st.jar.SetCookies(u, cookies)
+	changed := false
+	for _, c := range cookies {
+		sc := SessionCookie{URL: u.Scheme + "://" + u.Host + u.Path, Name: c.Name, Value: c.Value, Domain: c.Domain,
+			Path: c.Path, Secure: c.Secure, HttpOnly: c.HttpOnly, Expires: c.Expires}
+		switch {
+		case c.MaxAge < 0:
+			sc.Expires = now
+		case c.MaxAge > 0:
+			sc.Expires = now.Add(time.Duration(c.MaxAge) * time.Second)
+		}
+		changed = st.put(sc, now) || changed
+	}
+	if changed {
+		_ = st.store.Save(st.session)
+	}
+}
+
+// put replaces the cookie with the key of c, which is removed if expired at now. It reports whether the
+// session changed.
+func (st *sessionState) put(c SessionCookie, now time.Time) bool {
+	key := c.key()
+	for i, old := range st.session.Cookies {
+		if old.key() != key {
+			continue
+		}
+		if c.Expired(now) {
+			st.session.Cookies = append(st.session.Cookies[:i], st.session.Cookies[i+1:]...)
+			return true
+		}
+		st.session.Cookies[i] = c
+		return old != c
+	}
+	if c.Expired(now) {
+		return false
+	}
+	st.session.Cookies = append(st.session.Cookies, c)
+	return true
+}
+
+// SessionToken returns the token stored under name in the session of WithSessionStore, false if there is no
+// such token, it expired or the client has no session store.
+func (c *Client) SessionToken(name string) (Token, bool, error) {
+	st := c.settings.session
+	if st == nil {
+		return Token{}, false, nil
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := c.settings.timeSource().Now()
+	if err := st.load(now); err != nil {
+		return Token{}, false, err
+	}
+	token, ok := st.session.Tokens[name]
+	if !ok || token.Expired(now) {
+		return Token{}, false, nil
+	}
+	return token, true, nil
+}
+
+// SetSessionToken stores token under name in the session of WithSessionStore and saves the session. The zero
+// token removes the token stored under name.
+func (c *Client) SetSessionToken(name string, token Token) error {
+	st := c.settings.session
+	if st == nil {
+		return ErrNoSessionStore
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if err := st.load(c.settings.timeSource().Now()); err != nil {
+		return err
+	}
+	if token == (Token{}) {
+		delete(st.session.Tokens, name)
+	} else {
+		st.session.Tokens[name] = token
+	}
+	return st.store.Save(st.session)
+}
@@ -0,0 +1,214 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sessionRequest struct {
+	XMLName xml.Name `xml:"urn:test Ping"`
+}
+
+type sessionResponse struct {
+	XMLName xml.Name `xml:"urn:test PingResponse"`
+	Message string   `xml:"Message"`
+}
+
+// newSessionServer answers Login by setting the session cookie and every other action with the cookie
+// received, or a fault without it.
+func newSessionServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		login := strings.Contains(r.Header.Get("SOAPAction"), "Login")
+		if login {
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s-1", Path: "/", MaxAge: 3600})
+			http.SetCookie(w, &http.Cookie{Name: "old", Value: "", MaxAge: -1})
+		}
+		c, err := r.Cookie("sid")
+		if err != nil && !login {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = io.WriteString(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>`+
+				`<faultcode>soap:Client</faultcode><faultstring>not logged in</faultstring></soap:Fault></soap:Body></soap:Envelope>`)
+			return
+		}
+		value := ""
+		if c != nil {
+			value = c.Value
+		}
+		_, _ = fmt.Fprintf(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+			`<PingResponse xmlns="urn:test"><Message>%s</Message></PingResponse></soap:Body></soap:Envelope>`, value)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newSessionClient(t *testing.T, url string, opts ...Option) *Client {
+	t.Helper()
+	client := NewClient(url)
+	require.NoError(t, client.SetOptions(opts...))
+	return client
+}
+
+func TestWithSessionStore(t *testing.T) {
+	srv := newSessionServer(t)
+	path := filepath.Join(t.TempDir(), "state", "session.json")
+
+	client := newSessionClient(t, srv.URL, WithSessionStore(NewFileSessionStore(path)))
+	resp := &sessionResponse{}
+	require.NoError(t, client.Do(context.Background(), "Login", &sessionRequest{}, resp))
+	require.NoError(t, client.Do(context.Background(), "Ping", &sessionRequest{}, resp))
+	assert.Equal(t, "s-1", resp.Message)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	// a new process logged in with the stored session
+	restarted := newSessionClient(t, srv.URL, WithSessionStore(NewFileSessionStore(path)))
+	resp = &sessionResponse{}
+	require.NoError(t, restarted.Do(context.Background(), "Ping", &sessionRequest{}, resp))
+	assert.Equal(t, "s-1", resp.Message)
+
+	// without the store the service does not know the client
+	var fault *Fault
+	assert.ErrorAs(t, NewClient(srv.URL).Do(context.Background(), "Ping", &sessionRequest{}, resp), &fault)
+
+	session, err := NewFileSessionStore(path).Load()
+	require.NoError(t, err)
+	require.Len(t, session.Cookies, 1)
+	assert.Equal(t, "sid", session.Cookies[0].Name)
+}
+
+func TestFileSessionStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		store func(path string) *FileSessionStore
+	}{
+		{name: "plain", store: NewFileSessionStore},
+		{
+			name: "encrypted",
+			store: func(path string) *FileSessionStore {
+				s := NewFileSessionStore(path)
+				s.Encrypt = func(plain []byte) ([]byte, error) {
+					return []byte(base64.StdEncoding.EncodeToString(plain)), nil
+				}
+				s.Decrypt = func(data []byte) ([]byte, error) { return base64.StdEncoding.DecodeString(string(data)) }
+				return s
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "session.json")
+			store := tt.store(path)
+			store.Clock = &manualClock{now: now}
+
+			empty, err := store.Load()
+			require.NoError(t, err)
+			assert.Equal(t, &Session{}, empty)
+
+			require.NoError(t, store.Save(&Session{
+				Cookies: []SessionCookie{
+					{URL: "https://example.com/", Name: "sid", Value: "s-1"},
+					{URL: "https://example.com/", Name: "stale", Value: "s-0", Expires: now.Add(-time.Second)},
+				},
+				Tokens: map[string]Token{
+					"session": {Value: "t-1", Expires: now.Add(time.Hour)},
+					"expired": {Value: "t-0", Expires: now},
+				},
+			}))
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, tt.name == "plain", bytes.Contains(data, []byte("t-1")))
+
+			session, err := store.Load()
+			require.NoError(t, err)
+			assert.Equal(t, []SessionCookie{{URL: "https://example.com/", Name: "sid", Value: "s-1"}}, session.Cookies)
+			assert.Equal(t, map[string]Token{"session": {Value: "t-1", Expires: now.Add(time.Hour)}}, session.Tokens)
+		})
+	}
+}
+
+func TestFileSessionStoreErrors(t *testing.T) {
+	errSeal := errors.New("sealed")
+	path := filepath.Join(t.TempDir(), "session.json")
+	store := NewFileSessionStore(path)
+	store.Encrypt = func([]byte) ([]byte, error) { return nil, errSeal }
+	assert.ErrorIs(t, store.Save(&Session{}), errSeal)
+	_, err := os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = NewFileSessionStore(path).Load()
+	assert.Error(t, err)
+}
+
+func TestFileSessionStoreConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.json")
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// every goroutine has its own store like a process sharing the file
+			store := NewFileSessionStore(path)
+			for j := range 20 {
+				session := &Session{Tokens: map[string]Token{"writer": {Value: strings.Repeat(fmt.Sprint(i), 100*(j+1))}}}
+				assert.NoError(t, store.Save(session))
+				_, err := store.Load()
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "temporary files are renamed")
+}
+
+func TestSessionToken(t *testing.T) {
+	// the file store drops expired tokens by the system clock
+	clock := &manualClock{now: time.Now()}
+	path := filepath.Join(t.TempDir(), "session.json")
+	client := newSessionClient(t, "http://localhost", WithSessionStore(NewFileSessionStore(path)), WithClock(clock))
+	_, ok, err := client.SessionToken("session")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	token := Token{Value: "t-1", Expires: clock.now.Add(time.Minute)}
+	require.NoError(t, client.SetSessionToken("session", token))
+	got, ok, err := newSessionClient(t, "http://localhost", WithSessionStore(NewFileSessionStore(path)), WithClock(clock)).SessionToken("session")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, token.Value, got.Value)
+
+	clock.now = clock.now.Add(time.Minute)
+	_, ok, err = client.SessionToken("session")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, client.SetSessionToken("session", Token{}))
+	session, err := NewFileSessionStore(path).Load()
+	require.NoError(t, err)
+	assert.Empty(t, session.Tokens)
+
+	assert.ErrorIs(t, NewClient("http://localhost").SetSessionToken("session", token), ErrNoSessionStore)
+}
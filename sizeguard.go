@@ -0,0 +1,119 @@
+package soap
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+var (
+	// ErrRequestTooLarge is returned if the serialized request exceeds the limit set with WithMaxRequestBytes
+	// or its MTOM attachments exceed the limit set with WithMaxAttachmentBytes. The returned error is a
+	// *RequestTooLargeError.
+	ErrRequestTooLarge = errors.New("request too large")
+)
+
+// RequestTooLargeError reports a request whose encoding was aborted for exceeding a size limit.
+type RequestTooLargeError struct {
+	// Limit is the exceeded limit and Size the number of bytes reached when the encoding was aborted.
+	Limit int64
+	Size  int64
+	// Attachments is set if the limit of the MTOM attachments was exceeded.
+	Attachments bool
+	// Path is the slash separated path of the element being encoded, e.g. "Envelope/Body/Upload/Data",
+	// if known.
+	Path string
+}
+
+func (e *RequestTooLargeError) Error() string {
+	what := "envelope"
+	if e.Attachments {
+		what = "attachments"
+	}
+	msg := fmt.Sprintf("%s: %s reached %d bytes, limit is %d", ErrRequestTooLarge, what, e.Size, e.Limit)
+	if e.Path != "" {
+		msg += " (encoding " + e.Path + ")"
+	}
+	return msg
+}
+
+func (e *RequestTooLargeError) Unwrap() error {
+	return ErrRequestTooLarge
+}
+
+// WithMaxRequestBytes aborts the encoding of requests whose envelope exceeds n bytes, so faulty data cannot
+// grow a request without bound. MTOM attachments are not counted, see WithMaxAttachmentBytes.
+func WithMaxRequestBytes(n int64) Option {
+	return func(s *settings) error {
+		s.maxRequestBytes = n
+		return nil
+	}
+}
+
+// WithMaxAttachmentBytes aborts the encoding of MTOM requests whose attachments sent as MIME parts exceed n
+// bytes in total.
+func WithMaxAttachmentBytes(n int64) Option {
+	return func(s *settings) error {
+		s.maxAttachmentBytes = n
+		return nil
+	}
+}
+
+// limitWriter writes to w until more than limit bytes were written in total.
+type limitWriter struct {
+	w     io.Writer
+	limit int64
+	n     int64
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if l.n+int64(len(p)) > l.limit {
+		n, _ := l.w.Write(p[:l.limit-l.n])
+		l.n += int64(len(p))
+		return n, &RequestTooLargeError{Limit: l.limit, Size: l.n}
+	}
+	n, err := l.w.Write(p)
+	l.n += int64(n)
+	return n, err
+}
+
+// tooLarge adds the path of the element being encoded to a *RequestTooLargeError aborting the encoding of
+// the partial envelope data. The path of an attachment error holds the name of the attachment element, which
+// is not part of data. Other errors are returned as they are.
+func tooLarge(err error, data []byte) error {
+	var e *RequestTooLargeError
+	if !errors.As(err, &e) {
+		return err
+	}
+	switch open := openElements(data); {
+	case !e.Attachments:
+		e.Path = open
+	case open != "":
+		e.Path = open + "/" + e.Path
+	}
+	return err
+}
+
+// openElements returns the path of the elements not closed at the end of the partial document data.
+func openElements(data []byte) string {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []string
+	for {
+		tok, err := d.RawToken()
+		if err != nil {
+			return strings.Join(stack, "/")
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			stack = append(stack, tok.Name.Local)
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
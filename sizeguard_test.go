@@ -0,0 +1,82 @@
+package soap
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sizedRequest struct {
+	XMLName xml.Name `xml:"urn:test Store"`
+	Name    string   `xml:"Name"`
+	Data    string   `xml:"Data"`
+}
+
+func TestMaxRequestBytes(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithMaxRequestBytes(1000)))
+
+	err := client.Do(context.Background(), "Store", &sizedRequest{Name: "n", Data: strings.Repeat("x", 10000)}, &quirksResponse{})
+	require.ErrorIs(t, err, ErrRequestTooLarge)
+	var tooLarge *RequestTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.Equal(t, int64(1000), tooLarge.Limit)
+	assert.Greater(t, tooLarge.Size, int64(1000))
+	assert.False(t, tooLarge.Attachments)
+	assert.Equal(t, "Envelope/Body/Store/Data", tooLarge.Path)
+	assert.Empty(t, *captured, "no request must be sent")
+
+	assert.NoError(t, client.Do(context.Background(), "Store", &sizedRequest{Name: "n", Data: "small"}, &quirksResponse{}))
+	assert.Len(t, *captured, 1)
+}
+
+func TestMaxRequestBytesExpandedElements(t *testing.T) {
+	srv, captured := newCaptureServer(t)
+	client := NewClient(srv.URL)
+	req := &sizedRequest{}
+	payload, err := NewRequest("Store", srv.URL, req, nil, nil).serialize()
+	require.NoError(t, err)
+
+	// the self-closed elements fit, expanded they exceed the limit
+	limit := int64(len(payload))
+	require.NoError(t, client.SetOptions(WithMaxRequestBytes(limit), WithEmptyElements(EmptyElementsExpanded)))
+	err = client.Do(context.Background(), "Store", req, &quirksResponse{})
+	assert.NoError(t, err)
+
+	require.NoError(t, client.SetOptions(WithMaxRequestBytes(limit-1)))
+	err = client.Do(context.Background(), "Store", req, &quirksResponse{})
+	assert.ErrorIs(t, err, ErrRequestTooLarge)
+	assert.Len(t, *captured, 1)
+}
+
+func TestMaxAttachmentBytes(t *testing.T) {
+	srv, parts := newMTOMEchoServer(t)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithMTOM(), MTOMThreshold(100), WithMaxAttachmentBytes(1500)))
+
+	req := &upload{
+		Small:  Attachment{Data: []byte("tiny")},
+		Large:  Attachment{Data: make([]byte, 1000)},
+		Forced: Attachment{Data: make([]byte, 1000)},
+	}
+	err := client.Do(context.Background(), "Upload", req, &upload{})
+	require.ErrorIs(t, err, ErrRequestTooLarge)
+	var tooLarge *RequestTooLargeError
+	require.ErrorAs(t, err, &tooLarge)
+	assert.True(t, tooLarge.Attachments)
+	assert.Equal(t, int64(1500), tooLarge.Limit)
+	assert.Equal(t, int64(2000), tooLarge.Size)
+	assert.Equal(t, "Envelope/Body/Upload/Forced", tooLarge.Path)
+	assert.Empty(t, *parts)
+
+	// the envelope limit does not count the attachments
+	require.NoError(t, client.SetOptions(WithMaxAttachmentBytes(0), WithMaxRequestBytes(1500)))
+	assert.NoError(t, client.Do(context.Background(), "Upload", req, &upload{}))
+	assert.Len(t, *parts, 3)
+}
@@ -0,0 +1,320 @@
+package soaptest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ChaosEnv is the environment variable which must be set to 1 for NewChaos to inject failures outside tests.
+const ChaosEnv = "GOSOAP_CHAOS"
+
+var (
+	// ErrChaosDisabled is returned by NewChaos if failure injection is not enabled with ChaosEnv.
+	ErrChaosDisabled = errors.New("chaos transport not enabled, set " + ChaosEnv + "=1")
+	// ErrConnectionDropped is the error of reading a response whose connection was dropped by ChaosDrop.
+	ErrConnectionDropped = errors.New("chaos: connection dropped")
+)
+
+// ChaosKind is a failure injected by a Chaos transport.
+type ChaosKind int
+
+const (
+	// ChaosLatency delays the request by ChaosRule.Latency.
+	ChaosLatency ChaosKind = iota + 1
+	// ChaosDrop sends the request and breaks off the response after half of its body with ErrConnectionDropped.
+	ChaosDrop
+	// ChaosFault answers without sending the request with a SOAP 1.1 fault of ChaosRule.FaultCode, soap:Server
+	// by default, and ChaosRule.FaultString and status 500.
+	ChaosFault
+	// ChaosUnavailable answers without sending the request with status 503, and a Retry-After header if
+	// ChaosRule.RetryAfter is set.
+	ChaosUnavailable
+	// ChaosCorrupt sends the request and changes ChaosRule.Bytes random bytes of the response body.
+	ChaosCorrupt
+)
+
+var chaosKindNames = map[ChaosKind]string{
+	ChaosLatency:     "latency",
+	ChaosDrop:        "drop",
+	ChaosFault:       "fault",
+	ChaosUnavailable: "unavailable",
+	ChaosCorrupt:     "corrupt",
+}
+
+func (k ChaosKind) String() string {
+	if name, ok := chaosKindNames[k]; ok {
+		return name
+	}
+	return "ChaosKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// ChaosRule injects a failure into a share of the requests.
+type ChaosRule struct {
+	Kind ChaosKind
+	// Probability is the chance of the rule firing for a request, between 0 and 1.
+	Probability float64
+	// Actions restricts the rule to requests for the SOAP actions, it applies to all requests if empty.
+	Actions []string
+	// After lets the rule fire only once it matched this many requests, e.g. to fail a call sequence midway.
+	After int
+
+	Latency     time.Duration
+	FaultCode   string
+	FaultString string
+	RetryAfter  time.Duration
+	Bytes       int
+}
+
+func (r ChaosRule) validate() error {
+	if _, ok := chaosKindNames[r.Kind]; !ok {
+		return fmt.Errorf("unknown chaos kind %d", r.Kind)
+	}
+	if r.Probability < 0 || r.Probability > 1 {
+		return fmt.Errorf("%s: probability %v not between 0 and 1", r.Kind, r.Probability)
+	}
+	if r.Kind == ChaosCorrupt && r.Bytes <= 0 {
+		return fmt.Errorf("%s: no bytes to corrupt", r.Kind)
+	}
+	return nil
+}
+
+// ChaosEvent is a failure injected by a Chaos transport.
+type ChaosEvent struct {
+	Kind   ChaosKind
+	Action string
+	// Rule is the index of the rule which fired.
+	Rule int
+}
+
+// Chaos is an http.RoundTripper injecting failures into the exchanges of a client, to test the resilience of
+// an application to a failing service. Every rule matching a request fires with its probability, drawn from
+// a random source seeded on construction, so a sequence of requests meets the same failures in every run.
+// Latency rules delay the request; of the other rules only the first firing one applies. Every injected
+// failure is logged and passed to OnInject, so failing tests can be attributed to it.
+type Chaos struct {
+	// Transport sends the requests, http.DefaultTransport if nil.
+	Transport http.RoundTripper
+	// Logger logs the injected failures at info level, slog.Default() if nil.
+	Logger *slog.Logger
+	// OnInject is called for every injected failure if set, e.g. to count them as metric.
+	OnInject func(ChaosEvent)
+
+	rules []ChaosRule
+
+	mu      sync.Mutex
+	rand    *rand.Rand
+	matched []int
+	events  []ChaosEvent
+}
+
+// NewChaos returns a Chaos transport applying the rules with the random source seeded with seed. Failure
+// injection must be enabled explicitly by setting the environment variable ChaosEnv to 1, so it is not
+// enabled in production by accident; ErrChaosDisabled is returned otherwise.
+func NewChaos(seed uint64, transport http.RoundTripper, rules ...ChaosRule) (*Chaos, error) {
+	if os.Getenv(ChaosEnv) != "1" {
+		return nil, ErrChaosDisabled
+	}
+	return newChaos(seed, transport, rules)
+}
+
+// NewTestChaos returns a Chaos transport for the test, enabled regardless of ChaosEnv. Invalid rules fail the
+// test.
+func NewTestChaos(t testing.TB, seed uint64, transport http.RoundTripper, rules ...ChaosRule) *Chaos {
+	t.Helper()
+	c, err := newChaos(seed, transport, rules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func newChaos(seed uint64, transport http.RoundTripper, rules []ChaosRule) (*Chaos, error) {
+	for i, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("chaos rule %d: %w", i, err)
+		}
+	}
+	return &Chaos{
+		Transport: transport,
+		rules:     rules,
+		rand:      rand.New(rand.NewPCG(seed, seed)),
+		matched:   make([]int, len(rules)),
+	}, nil
+}
+
+// Events returns the failures injected so far.
+func (c *Chaos) Events() []ChaosEvent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ChaosEvent(nil), c.events...)
+}
+
+// RoundTrip sends the request, injecting the failures of the rules firing for it.
+func (c *Chaos) RoundTrip(req *http.Request) (*http.Response, error) {
+	action := chaosAction(req)
+	var latency time.Duration
+	var failure *ChaosRule
+	var events []ChaosEvent
+	c.mu.Lock()
+	for i := range c.rules {
+		r := &c.rules[i]
+		if len(r.Actions) > 0 && !slices.Contains(r.Actions, action) {
+			continue
+		}
+		c.matched[i]++
+		if c.matched[i] <= r.After || r.Kind != ChaosLatency && failure != nil {
+			continue
+		}
+		if c.rand.Float64() >= r.Probability {
+			continue
+		}
+		events = append(events, ChaosEvent{Kind: r.Kind, Action: action, Rule: i})
+		if r.Kind == ChaosLatency {
+			latency += r.Latency
+		} else {
+			failure = r
+		}
+	}
+	// drawn while locked, so the bytes corrupted do not depend on the order of concurrent requests
+	var corruptSeed uint64
+	if failure != nil && failure.Kind == ChaosCorrupt {
+		corruptSeed = c.rand.Uint64()
+	}
+	c.events = append(c.events, events...)
+	c.mu.Unlock()
+	for _, e := range events {
+		c.report(req.Context(), e)
+	}
+
+	if latency > 0 {
+		if err := sleep(req.Context(), latency); err != nil {
+			return nil, err
+		}
+	}
+	if failure != nil {
+		switch failure.Kind {
+		case ChaosFault:
+			code := failure.FaultCode
+			if code == "" {
+				code = "soap:Server"
+			}
+			return chaosResponse(req, http.StatusInternalServerError, "text/xml; charset=utf-8",
+				FaultEnvelope(code, failure.FaultString)), nil
+		case ChaosUnavailable:
+			resp := chaosResponse(req, http.StatusServiceUnavailable, "text/plain; charset=utf-8", "service unavailable")
+			if failure.RetryAfter > 0 {
+				resp.Header.Set("Retry-After", strconv.Itoa(int(failure.RetryAfter.Round(time.Second)/time.Second)))
+			}
+			return resp, nil
+		}
+	}
+
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil || failure == nil {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	switch failure.Kind {
+	case ChaosDrop:
+		resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body[:len(body)/2]), errReader{ErrConnectionDropped}))
+		return resp, nil
+	case ChaosCorrupt:
+		corrupt(body, failure.Bytes, corruptSeed)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+// corrupt changes n distinct random bytes of data, all of them if it has fewer.
+func corrupt(data []byte, n int, seed uint64) {
+	r := rand.New(rand.NewPCG(seed, seed))
+	for _, i := range r.Perm(len(data))[:min(n, len(data))] {
+		// xor with a non-zero value, so the byte always changes
+		data[i] ^= byte(r.IntN(255) + 1)
+	}
+}
+
+func (c *Chaos) report(ctx context.Context, e ChaosEvent) {
+	logger := c.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	logger.LogAttrs(ctx, slog.LevelInfo, "soap chaos injected",
+		slog.String("kind", e.Kind.String()), slog.String("action", e.Action), slog.Int("rule", e.Rule))
+	if c.OnInject != nil {
+		c.OnInject(e)
+	}
+}
+
+// chaosAction returns the SOAP action of a request, taken from the content type for SOAP 1.2.
+func chaosAction(r *http.Request) string {
+	if action := actionOf(r); action != "" {
+		return action
+	}
+	if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil {
+		return params["action"]
+	}
+	return ""
+}
+
+// chaosResponse returns a synthetic response to req.
+func chaosResponse(req *http.Request, status int, contentType, body string) *http.Response {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	return &http.Response{
+		Status:        strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {contentType}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
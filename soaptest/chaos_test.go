@@ -0,0 +1,194 @@
+package soaptest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+type pingRequest struct {
+	XMLName xml.Name `xml:"urn:test Ping"`
+}
+
+type pingResponse struct {
+	XMLName xml.Name `xml:"urn:test PingResponse"`
+	Value   string   `xml:"Value"`
+}
+
+const pingBody = `<PingResponse xmlns="urn:test"><Value>pong</Value></PingResponse>`
+
+// newChaosClient returns a client of a server answering Ping, sending through a Chaos transport with the rules.
+func newChaosClient(t *testing.T, rules ...ChaosRule) (*soap.Client, *Chaos, *Server) {
+	srv := NewServer(t)
+	srv.Respond("Ping", pingBody)
+	chaos := NewTestChaos(t, 1, nil, rules...)
+	chaos.Logger = slog.New(slog.DiscardHandler)
+	client := soap.NewClient(srv.URL)
+	client.SettHTTPClient(&http.Client{Transport: chaos})
+	return client, chaos, srv
+}
+
+func TestChaos(t *testing.T) {
+	tests := []struct {
+		name string
+		rule ChaosRule
+		// sent reports whether the request reaches the server
+		sent  bool
+		check func(t *testing.T, err error)
+	}{
+		{
+			name: "fault",
+			rule: ChaosRule{Kind: ChaosFault, Probability: 1, FaultCode: "soap:Client", FaultString: "injected"},
+			check: func(t *testing.T, err error) {
+				var fault *soap.Fault
+				if assert.ErrorAs(t, err, &fault) {
+					assert.Equal(t, "soap:Client", fault.Code)
+					assert.Equal(t, "injected", fault.String)
+				}
+			},
+		},
+		{
+			name: "unavailable",
+			rule: ChaosRule{Kind: ChaosUnavailable, Probability: 1},
+			check: func(t *testing.T, err error) {
+				assert.ErrorContains(t, err, "503")
+			},
+		},
+		{
+			name: "drop",
+			rule: ChaosRule{Kind: ChaosDrop, Probability: 1},
+			sent: true,
+			check: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, ErrConnectionDropped)
+			},
+		},
+		{
+			name:  "corrupt",
+			rule:  ChaosRule{Kind: ChaosCorrupt, Probability: 1, Bytes: 20},
+			sent:  true,
+			check: func(t *testing.T, err error) { assert.Error(t, err) },
+		},
+		{
+			name: "not firing",
+			rule: ChaosRule{Kind: ChaosFault, Probability: 0},
+			sent: true,
+			check: func(t *testing.T, err error) {
+				assert.NoError(t, err)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, chaos, srv := newChaosClient(t, tt.rule)
+			var injected []ChaosEvent
+			chaos.OnInject = func(e ChaosEvent) { injected = append(injected, e) }
+			err := client.Do(context.Background(), "Ping", &pingRequest{}, &pingResponse{})
+			tt.check(t, err)
+			assert.Equal(t, tt.sent, len(srv.Requests()) == 1)
+			assert.Equal(t, injected, chaos.Events())
+			if tt.rule.Probability > 0 {
+				assert.Equal(t, []ChaosEvent{{Kind: tt.rule.Kind, Action: "Ping"}}, chaos.Events())
+			}
+		})
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	client, _, _ := newChaosClient(t, ChaosRule{Kind: ChaosLatency, Probability: 1, Latency: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, client.Do(ctx, "Ping", &pingRequest{}, &pingResponse{}), context.DeadlineExceeded)
+}
+
+func TestChaosCorrupt(t *testing.T) {
+	srv := NewServer(t)
+	srv.Respond("Ping", pingBody)
+	chaos := NewTestChaos(t, 7, nil, ChaosRule{Kind: ChaosCorrupt, Probability: 1, Bytes: 5},
+		ChaosRule{Kind: ChaosUnavailable, Probability: 1})
+	req, err := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(""))
+	require.NoError(t, err)
+	req.Header.Set("SOAPAction", "Ping")
+	resp, err := chaos.RoundTrip(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	want := []byte(Envelope(pingBody))
+	require.Len(t, body, len(want))
+	changed := 0
+	for i := range body {
+		if body[i] != want[i] {
+			changed++
+		}
+	}
+	assert.Equal(t, 5, changed)
+	assert.Equal(t, int64(len(want)), resp.ContentLength)
+	// only the first failure applies
+	assert.Equal(t, []ChaosEvent{{Kind: ChaosCorrupt, Action: "Ping"}}, chaos.Events())
+}
+
+func TestChaosReproducible(t *testing.T) {
+	rules := []ChaosRule{
+		{Kind: ChaosFault, Probability: 0.5, Actions: []string{"Ping"}},
+		{Kind: ChaosUnavailable, Probability: 1, After: 15},
+	}
+	var runs [][]ChaosEvent
+	for range 2 {
+		client, chaos, _ := newChaosClient(t, rules...)
+		for range 20 {
+			_ = client.Do(context.Background(), "Ping", &pingRequest{}, &pingResponse{})
+			_ = client.Do(context.Background(), "Other", &pingRequest{}, &pingResponse{})
+		}
+		runs = append(runs, chaos.Events())
+	}
+	assert.Equal(t, runs[0], runs[1])
+	var faults, unavailable int
+	for _, e := range runs[0] {
+		switch e.Kind {
+		case ChaosFault:
+			faults++
+			assert.Equal(t, "Ping", e.Action)
+		case ChaosUnavailable:
+			unavailable++
+		}
+	}
+	assert.Greater(t, faults, 0)
+	assert.Less(t, faults, 20)
+	assert.Positive(t, unavailable)
+	assert.LessOrEqual(t, unavailable, 40-15)
+}
+
+func TestNewChaos(t *testing.T) {
+	t.Setenv(ChaosEnv, "")
+	_, err := NewChaos(1, nil)
+	assert.ErrorIs(t, err, ErrChaosDisabled)
+
+	t.Setenv(ChaosEnv, "1")
+	var logs bytes.Buffer
+	chaos, err := NewChaos(1, nil, ChaosRule{Kind: ChaosUnavailable, Probability: 1, RetryAfter: 2 * time.Second})
+	require.NoError(t, err)
+	chaos.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:0", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", `application/soap+xml; charset=utf-8; action="urn:Ping"`)
+	resp, err := chaos.RoundTrip(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+	assert.Contains(t, logs.String(), `msg="soap chaos injected" kind=unavailable action=urn:Ping rule=0`)
+
+	_, err = NewChaos(1, nil, ChaosRule{Kind: ChaosCorrupt, Probability: 1})
+	assert.Error(t, err)
+	_, err = NewChaos(1, nil, ChaosRule{Kind: ChaosFault, Probability: 2})
+	assert.Error(t, err)
+}
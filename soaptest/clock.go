@@ -0,0 +1,97 @@
+package soaptest
+
+import (
+	"sync"
+	"time"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+// Clock is a fake soap.Clock for deterministic tests. Time only passes when the clock is advanced, timers
+// fire once the clock reaches their deadline.
+type Clock struct {
+	mu     sync.Mutex
+	now    time.Time
+	auto   bool
+	timers []*timer
+}
+
+// NewClock returns a Clock set to now.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a timer firing once the clock was advanced by d. With AutoAdvance the clock is advanced
+// right away.
+func (c *Clock) NewTimer(d time.Duration) soap.Timer {
+	c.mu.Lock()
+	t := &timer{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	auto := c.auto
+	c.mu.Unlock()
+	if auto {
+		c.Advance(d)
+	} else {
+		c.Advance(0)
+	}
+	return t
+}
+
+// Advance moves the clock forward by d and fires the timers due.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.deadline.After(c.now) {
+			pending = append(pending, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.timers = pending
+}
+
+// AutoAdvance makes new timers advance the clock to their deadline, so waiting for them takes no real time.
+func (c *Clock) AutoAdvance(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.auto = enabled
+}
+
+// Timers returns the number of timers that did not fire yet and were not stopped.
+func (c *Clock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+type timer struct {
+	clock    *Clock
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (t *timer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *timer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	for i, pending := range t.clock.timers {
+		if pending == t {
+			t.clock.timers = append(t.clock.timers[:i], t.clock.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
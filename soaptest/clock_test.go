@@ -0,0 +1,62 @@
+package soaptest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewClock(start)
+	first := clock.NewTimer(time.Second)
+	second := clock.NewTimer(2 * time.Second)
+	stopped := clock.NewTimer(time.Second)
+	assert.Equal(t, 3, clock.Timers())
+	assert.True(t, stopped.Stop())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(time.Second), clock.Now())
+	assert.Equal(t, start.Add(time.Second), <-first.C())
+	assert.Len(t, second.C(), 0)
+	assert.Len(t, stopped.C(), 0)
+	assert.Equal(t, 1, clock.Timers())
+	assert.False(t, first.Stop())
+
+	clock.Advance(time.Second)
+	assert.Equal(t, start.Add(2*time.Second), <-second.C())
+	assert.Equal(t, 0, clock.Timers())
+
+	clock.AutoAdvance(true)
+	auto := clock.NewTimer(time.Minute)
+	assert.Equal(t, start.Add(time.Minute+2*time.Second), <-auto.C())
+}
+
+func TestClockRetry(t *testing.T) {
+	srv := NewServer(t)
+	calls := 0
+	srv.Handle("Echo", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(Envelope(`<EchoResponse xmlns="urn:echo"><Text>hi</Text></EchoResponse>`)))
+	})
+	clock := NewClock(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	clock.AutoAdvance(true)
+
+	var info soap.ResponseInfo
+	policy := soap.RetryPolicy{MaxAttempts: 3, Backoff: func(attempt int) time.Duration { return time.Duration(attempt) * time.Hour }}
+	err := soap.NewClient(srv.URL).Do(context.Background(), "Echo", &echoRequest{}, &echoResponse{},
+		soap.WithClock(clock), soap.WithRetry(policy), soap.MarkIdempotent("Echo"), soap.WithResponseInfo(&info))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	// backoff before the second and third attempt
+	assert.Equal(t, 5*time.Hour, info.Duration)
+}
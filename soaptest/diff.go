@@ -0,0 +1,179 @@
+package soaptest
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Selector selects elements or attributes of documents compared by DiffXML. It is a path of the local names
+// of the elements from the root element, separated by slashes, with "*" matching any element. A path starting
+// with "//" matches at any depth. A last segment "@name" selects the attribute of the elements, e.g.
+// "//Timestamp/Created" or "Envelope/Body/*/@id".
+type Selector string
+
+// VolatileSelectors select the values differing between calls: the timestamps, nonces and message ids of
+// the security and addressing headers. They are ignored by the assertions and replaced with placeholders in
+// recorded fixtures.
+var VolatileSelectors = []Selector{"//Created", "//Expires", "//MessageID", "//Nonce"}
+
+// match reports whether the selector selects the element at path, the local names from the root element,
+// or its attribute attr if not empty.
+func (s Selector) match(path []string, attr string) bool {
+	p, anywhere := strings.CutPrefix(string(s), "//")
+	segments := strings.Split(p, "/")
+	if last := segments[len(segments)-1]; strings.HasPrefix(last, "@") {
+		if last[1:] != attr {
+			return false
+		}
+		segments = segments[:len(segments)-1]
+	} else if attr != "" {
+		return false
+	}
+	if len(segments) > len(path) || !anywhere && len(segments) != len(path) {
+		return false
+	}
+	path = path[len(path)-len(segments):]
+	for i, seg := range segments {
+		if seg != "*" && seg != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// selected reports whether one of the selectors selects the element at path or its attribute attr.
+func selected(selectors []Selector, path []string, attr string) bool {
+	return slices.ContainsFunc(selectors, func(s Selector) bool { return s.match(path, attr) })
+}
+
+// DiffXML compares the documents want and got structurally and returns their differences, each prefixed with
+// the path of the element. Elements and attributes are compared by namespace and local name, children in order;
+// namespace declarations, prefixes and whitespace around text are ignored. The values of want may contain the
+// placeholders of fixture request templates, AnyValue, UUIDValue and TimestampValue. The elements and
+// attributes selected by ignore are not compared.
+func DiffXML(want, got []byte, ignore ...Selector) ([]string, error) {
+	wantRoot, err := readRoot(want)
+	if err != nil {
+		return nil, fmt.Errorf("want: %w", err)
+	}
+	gotRoot, err := readRoot(got)
+	if err != nil {
+		return nil, fmt.Errorf("got: %w", err)
+	}
+	var diffs []string
+	diffElement(wantRoot, gotRoot, nil, "/"+wantRoot.Tag, ignore, &diffs)
+	return diffs, nil
+}
+
+// readRoot returns the root element of the document.
+func readRoot(data []byte) (*etree.Element, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+	if doc.Root() == nil {
+		return nil, fmt.Errorf("no root element")
+	}
+	return doc.Root(), nil
+}
+
+// diffElement appends the differences of the element got to want to diffs. path holds the local names of the
+// ancestors, location is the path of the element as reported.
+func diffElement(want, got *etree.Element, path []string, location string, ignore []Selector, diffs *[]string) {
+	path = append(path, want.Tag)
+	report := func(format string, args ...any) {
+		*diffs = append(*diffs, location+": "+fmt.Sprintf(format, args...))
+	}
+	if want.Tag != got.Tag || want.NamespaceURI() != got.NamespaceURI() {
+		report("element {%s}%s, want {%s}%s", got.NamespaceURI(), got.Tag, want.NamespaceURI(), want.Tag)
+		return
+	}
+	if selected(ignore, path, "") || len(want.ChildElements()) == 0 && strings.TrimSpace(want.Text()) == AnyValue {
+		return
+	}
+
+	wantAttrs, gotAttrs := attributes(want), attributes(got)
+	var names []string
+	for name := range wantAttrs {
+		names = append(names, name)
+	}
+	for name := range gotAttrs {
+		if _, ok := wantAttrs[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w, inWant := wantAttrs[name]
+		g, inGot := gotAttrs[name]
+		key := w.Key
+		if !inWant {
+			key = g.Key
+		}
+		if selected(ignore, path, key) {
+			continue
+		}
+		switch {
+		case !inGot:
+			report("attribute %s missing, want %q", name, w.Value)
+		case !inWant:
+			report("unexpected attribute %s=%q", name, g.Value)
+		case !matchValue(w.Value, g.Value):
+			report("attribute %s=%q, want %q", name, g.Value, w.Value)
+		}
+	}
+
+	if w, g := strings.TrimSpace(want.Text()), strings.TrimSpace(got.Text()); !matchValue(w, g) {
+		report("text %q, want %q", g, w)
+	}
+
+	wantChildren, gotChildren := want.ChildElements(), got.ChildElements()
+	for i := range max(len(wantChildren), len(gotChildren)) {
+		switch {
+		case i >= len(gotChildren):
+			report("missing element %s", childLocation(wantChildren, i))
+		case i >= len(wantChildren):
+			report("unexpected element %s", childLocation(gotChildren, i))
+		default:
+			diffElement(wantChildren[i], gotChildren[i], path, location+"/"+childLocation(wantChildren, i), ignore, diffs)
+		}
+	}
+}
+
+// childLocation returns the name of the child i of an element, with its position among the children of its
+// name if there are several.
+func childLocation(children []*etree.Element, i int) string {
+	n, pos := 0, 0
+	for j, c := range children {
+		if c.Tag == children[i].Tag && c.NamespaceURI() == children[i].NamespaceURI() {
+			n++
+			if j <= i {
+				pos = n
+			}
+		}
+	}
+	if n == 1 {
+		return children[i].Tag
+	}
+	return fmt.Sprintf("%s[%d]", children[i].Tag, pos)
+}
+
+// attributes returns the attributes of the element without namespace declarations, by namespace and name.
+func attributes(el *etree.Element) map[string]etree.Attr {
+	attrs := map[string]etree.Attr{}
+	for _, a := range el.Attr {
+		if isNamespaceDecl(a) {
+			continue
+		}
+		name := a.Key
+		if ns := a.NamespaceURI(); ns != "" {
+			name = "{" + ns + "}" + a.Key
+		}
+		attrs[name] = a
+	}
+	return attrs
+}
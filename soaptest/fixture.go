@@ -0,0 +1,369 @@
+package soaptest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/beevik/etree"
+)
+
+// Placeholders used in the request templates of fixtures. A placeholder matches any value of its kind, it
+// may be part of a longer value, e.g. "#WSSE{{uuid}}".
+const (
+	AnyValue       = "{{any}}"
+	UUIDValue      = "{{uuid}}"
+	TimestampValue = "{{timestamp}}"
+)
+
+// redacted replaces credentials in recorded responses.
+const redacted = "REDACTED"
+
+var (
+	uuidPattern      = `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`
+	timestampPattern = `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:\d{2})?`
+	uuidRe           = regexp.MustCompile(uuidPattern)
+	timestampRe      = regexp.MustCompile(timestampPattern)
+	placeholderRe    = regexp.MustCompile(`\{\{(any|uuid|timestamp)\}\}`)
+)
+
+// volatile reports whether the value of el at path differs between calls: it is selected by
+// VolatileSelectors or is the WS-Addressing To header, which holds the URL of the recorded service.
+func volatile(el *etree.Element, path []string) bool {
+	return selected(VolatileSelectors, path, "") || el.Tag == "To" && strings.Contains(el.NamespaceURI(), "addressing")
+}
+
+// credentialElements are elements with secrets, matched by local name. They are scrubbed from fixtures.
+var credentialElements = map[string]bool{
+	"Password":            true,
+	"BinarySecurityToken": true,
+	"SignatureValue":      true,
+	"DigestValue":         true,
+	"X509Certificate":     true,
+	"Assertion":           true,
+}
+
+// Fixture is a recorded exchange, stored as JSON by the Recorder and loaded with Server.LoadFixtures.
+type Fixture struct {
+	Action string `json:"action"`
+	// Request is the envelope template requests must match. Elements and attributes are compared by
+	// namespace and local name, the values may contain the placeholders AnyValue, UUIDValue and TimestampValue.
+	Request     string `json:"request"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Response    string `json:"response"`
+
+	template *etree.Element
+}
+
+// Recorder is an http.RoundTripper writing the exchanges of a real service into fixture files, to bootstrap
+// offline tests with Server.LoadFixtures. Volatile values such as timestamps, nonces and message ids are
+// replaced with placeholders, credentials are removed. HTTP headers other than the SOAP action and the
+// content type are not recorded. Only uncompressed XML envelopes can be recorded, multipart (MTOM) messages
+// are not supported.
+type Recorder struct {
+	// Transport sends the requests, http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	dir   string
+	mu    sync.Mutex
+	count map[string]int
+}
+
+// NewRecorder returns a Recorder writing the fixtures into dir, one file per exchange named after the action.
+func NewRecorder(dir string, transport http.RoundTripper) *Recorder {
+	return &Recorder{Transport: transport, dir: dir, count: map[string]int{}}
+}
+
+// RoundTrip sends the request and records the exchange. Failing to record it fails the request.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	if err := r.record(actionOf(req), body, resp, respBody); err != nil {
+		return nil, fmt.Errorf("recording fixture: %w", err)
+	}
+	return resp, nil
+}
+
+// record writes the fixture of an exchange.
+func (r *Recorder) record(action string, request []byte, resp *http.Response, response []byte) error {
+	if enc := resp.Header.Get("Content-Encoding"); enc != "" {
+		return fmt.Errorf("compressed response (%s)", enc)
+	}
+	f := Fixture{Action: action, Status: resp.StatusCode, ContentType: resp.Header.Get("Content-Type")}
+	var err error
+	if f.Request, err = scrub(request, true); err != nil {
+		return fmt.Errorf("request: %w", err)
+	}
+	if f.Response, err = scrub(response, false); err != nil {
+		return fmt.Errorf("response: %w", err)
+	}
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.count[action]++
+	name := fmt.Sprintf("%s-%03d.json", fileName(action), r.count[action])
+	r.mu.Unlock()
+	return os.WriteFile(filepath.Join(r.dir, name), data.Bytes(), 0o644)
+}
+
+// scrub removes the credentials of an envelope. In requests their elements are replaced with AnyValue, like
+// the volatile elements, and timestamps and UUIDs within other values with placeholders. In responses the
+// credentials are replaced with REDACTED and the remaining values are kept.
+func scrub(envelope []byte, request bool) (string, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(envelope); err != nil {
+		return "", err
+	}
+	if doc.Root() == nil {
+		return "", fmt.Errorf("no envelope")
+	}
+	scrubElement(doc.Root(), nil, request)
+	return doc.WriteToString()
+}
+
+// scrubElement scrubs el, path holding the local names of its ancestors.
+func scrubElement(el *etree.Element, path []string, request bool) {
+	path = append(path, el.Tag)
+	if credentialElements[el.Tag] || request && volatile(el, path) {
+		el.Child = nil
+		attrs := el.Attr[:0]
+		for _, a := range el.Attr {
+			if isNamespaceDecl(a) {
+				attrs = append(attrs, a)
+			}
+		}
+		el.Attr = attrs
+		if request {
+			el.SetText(AnyValue)
+		} else {
+			el.SetText(redacted)
+		}
+		return
+	}
+	if request {
+		for i := range el.Attr {
+			if !isNamespaceDecl(el.Attr[i]) {
+				el.Attr[i].Value = placeholders(el.Attr[i].Value)
+			}
+		}
+	}
+	for _, tok := range el.Child {
+		switch tok := tok.(type) {
+		case *etree.Element:
+			scrubElement(tok, path, request)
+		case *etree.CharData:
+			if request {
+				tok.Data = placeholders(tok.Data)
+			}
+		}
+	}
+}
+
+// placeholders replaces the timestamps and UUIDs within s.
+func placeholders(s string) string {
+	s = timestampRe.ReplaceAllLiteralString(s, TimestampValue)
+	return uuidRe.ReplaceAllLiteralString(s, UUIDValue)
+}
+
+// fileName returns the last segment of an action URI, with the characters unsafe in file names replaced.
+func fileName(action string) string {
+	if i := strings.LastIndexAny(action, "/:#"); i >= 0 && i < len(action)-1 {
+		action = action[i+1:]
+	}
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, action)
+	if name == "" {
+		return "fixture"
+	}
+	return name
+}
+
+// LoadFixtures loads the fixture files (*.json) in dir, as written by a Recorder. Requests for the action of a
+// fixture are answered with the response of the first fixture of that action, in file name order, whose
+// request template matches the envelope. Requests matching none are answered with a client fault.
+func (s *Server) LoadFixtures(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	fixtures := map[string][]*Fixture{}
+	var actions []string
+	for _, file := range files {
+		f, err := loadFixture(file)
+		if err != nil {
+			return fmt.Errorf("loading fixture %s: %w", filepath.Base(file), err)
+		}
+		if _, ok := fixtures[f.Action]; !ok {
+			actions = append(actions, f.Action)
+		}
+		fixtures[f.Action] = append(fixtures[f.Action], f)
+	}
+	for _, action := range actions {
+		s.Handle(action, serveFixtures(fixtures[action]))
+	}
+	return nil
+}
+
+func loadFixture(file string) (*Fixture, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	f := &Fixture{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(f.Request); err != nil {
+		return nil, fmt.Errorf("request: %w", err)
+	}
+	if f.template = doc.Root(); f.template == nil {
+		return nil, fmt.Errorf("request: no envelope")
+	}
+	if f.Status == 0 {
+		f.Status = http.StatusOK
+	}
+	return f, nil
+}
+
+// serveFixtures answers requests with the first matching fixture.
+func serveFixtures(fixtures []*Fixture) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		doc := etree.NewDocument()
+		if _, err := doc.ReadFrom(r.Body); err != nil || doc.Root() == nil {
+			writeFault(w, "soap:Client", "request is not an envelope")
+			return
+		}
+		for _, f := range fixtures {
+			if matchElement(f.template, doc.Root()) {
+				if f.ContentType != "" {
+					w.Header().Set("Content-Type", f.ContentType)
+				}
+				w.WriteHeader(f.Status)
+				_, _ = io.WriteString(w, f.Response)
+				return
+			}
+		}
+		writeFault(w, "soap:Client", fmt.Sprintf("no fixture matches the request for action %q", fixtures[0].Action))
+	}
+}
+
+// matchElement reports whether el matches the template element: same name, attributes and children, with
+// values matching the placeholders of the template. A template element with just AnyValue as content matches
+// any element of its name. Namespace declarations and surrounding whitespace are ignored.
+func matchElement(template, el *etree.Element) bool {
+	if template.Tag != el.Tag || template.NamespaceURI() != el.NamespaceURI() {
+		return false
+	}
+	if len(template.ChildElements()) == 0 && strings.TrimSpace(template.Text()) == AnyValue {
+		return true
+	}
+	attrs := func(e *etree.Element) map[string]string {
+		m := map[string]string{}
+		for _, a := range e.Attr {
+			if !isNamespaceDecl(a) {
+				m[a.NamespaceURI()+" "+a.Key] = a.Value
+			}
+		}
+		return m
+	}
+	want, got := attrs(template), attrs(el)
+	if len(want) != len(got) {
+		return false
+	}
+	for name, value := range want {
+		v, ok := got[name]
+		if !ok || !matchValue(value, v) {
+			return false
+		}
+	}
+	if !matchValue(strings.TrimSpace(template.Text()), strings.TrimSpace(el.Text())) {
+		return false
+	}
+	wantChildren, gotChildren := template.ChildElements(), el.ChildElements()
+	if len(wantChildren) != len(gotChildren) {
+		return false
+	}
+	for i := range wantChildren {
+		if !matchElement(wantChildren[i], gotChildren[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchValue reports whether value matches the template value with placeholders.
+func matchValue(template, value string) bool {
+	if !strings.Contains(template, "{{") {
+		return template == value
+	}
+	var pattern strings.Builder
+	pattern.WriteString(`(?s)^`)
+	last := 0
+	for _, loc := range placeholderRe.FindAllStringSubmatchIndex(template, -1) {
+		pattern.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		switch template[loc[2]:loc[3]] {
+		case "any":
+			pattern.WriteString(`.*`)
+		case "uuid":
+			pattern.WriteString(uuidPattern)
+		case "timestamp":
+			pattern.WriteString(timestampPattern)
+		}
+		last = loc[1]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template[last:]) + `$`)
+	return regexp.MustCompile(pattern.String()).MatchString(value)
+}
+
+func isNamespaceDecl(a etree.Attr) bool {
+	return a.Space == "xmlns" || a.Space == "" && a.Key == "xmlns"
+}
+
+// actionOf returns the SOAP action of a request with surrounding quotes removed.
+func actionOf(r *http.Request) string {
+	return strings.Trim(r.Header.Get("SOAPAction"), `"`)
+}
@@ -0,0 +1,113 @@
+package soaptest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+const password = "s3cr3t-password"
+
+type usernameToken struct {
+	XMLName  xml.Name `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd UsernameToken"`
+	Username string   `xml:"Username"`
+	Password string   `xml:"Password"`
+}
+
+// credentials returns a header builder adding a username token.
+func credentials() soap.HeaderBuilder {
+	return soap.SecurityHeader(soap.SecurityHeaderOptions{Actor: "urn:gateway"},
+		&usernameToken{Username: "alice", Password: password})
+}
+
+// recordingClient returns a client calling url with the signed headers of a live integration.
+func recordingClient(t *testing.T, url string, transport http.RoundTripper) *soap.Client {
+	auth, err := soap.NewWSSEAuthInfo("../testdata/cert.pem", "../testdata/key.pem")
+	require.NoError(t, err)
+	client := soap.NewClient(url, auth.Header(), credentials())
+	if transport != nil {
+		client.SettHTTPClient(&http.Client{Transport: transport})
+	}
+	require.NoError(t, client.SetOptions(soap.WithAddressing(soap.AddressingOptions{})))
+	return client
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	live := NewServer(t)
+	live.Respond("Echo", `<EchoResponse xmlns="urn:echo"><Text>recorded</Text></EchoResponse>`)
+	dir := t.TempDir()
+	rec := NewRecorder(dir, nil)
+	resp := &echoResponse{}
+	require.NoError(t, recordingClient(t, live.URL, rec).Do(context.Background(), "Echo", &echoRequest{Text: "hi"}, resp))
+	assert.Equal(t, "recorded", resp.Text)
+
+	data, err := os.ReadFile(filepath.Join(dir, "Echo-001.json"))
+	require.NoError(t, err)
+	fixture := string(data)
+	assert.NotContains(t, fixture, password)
+	assert.NotContains(t, fixture, live.URL)
+	assert.Contains(t, fixture, AnyValue)
+	assert.Contains(t, fixture, "WSSE"+UUIDValue)
+
+	replay := NewServer(t)
+	require.NoError(t, replay.LoadFixtures(dir))
+	client := recordingClient(t, replay.URL, nil)
+
+	// the ids, timestamps and signature of the new call differ from the recorded ones
+	resp = &echoResponse{}
+	assert.NoError(t, client.Do(context.Background(), "Echo", &echoRequest{Text: "hi"}, resp))
+	assert.Equal(t, "recorded", resp.Text)
+
+	err = client.Do(context.Background(), "Echo", &echoRequest{Text: "other"}, &echoResponse{})
+	var fault *soap.Fault
+	if assert.True(t, errors.As(err, &fault)) {
+		assert.Equal(t, "soap:Client", fault.Code)
+	}
+}
+
+func TestRecordFault(t *testing.T) {
+	live := NewServer(t)
+	live.Fault("Echo", "soap:Server", "down")
+	dir := t.TempDir()
+	_ = recordingClient(t, live.URL, NewRecorder(dir, nil)).Do(context.Background(), "Echo", &echoRequest{}, &echoResponse{})
+
+	replay := NewServer(t)
+	require.NoError(t, replay.LoadFixtures(dir))
+	var info soap.ResponseInfo
+	err := recordingClient(t, replay.URL, nil).Do(context.Background(), "Echo", &echoRequest{}, &echoResponse{},
+		soap.WithResponseInfo(&info))
+	var fault *soap.Fault
+	if assert.True(t, errors.As(err, &fault)) {
+		assert.Equal(t, "down", fault.String)
+	}
+	assert.Equal(t, http.StatusInternalServerError, info.StatusCode)
+}
+
+func TestMatchValue(t *testing.T) {
+	tests := []struct {
+		template string
+		value    string
+		want     bool
+	}{
+		{template: "hi", value: "hi", want: true},
+		{template: "hi", value: "ho"},
+		{template: AnyValue, value: "anything\ngoes", want: true},
+		{template: "#WSSE" + UUIDValue, value: "#WSSE6ba7b810-9dad-11d1-80b4-00c04fd430c8", want: true},
+		{template: "#WSSE" + UUIDValue, value: "#WSSE42"},
+		{template: TimestampValue, value: "2024-05-01T10:00:00.123Z", want: true},
+		{template: TimestampValue, value: "yesterday"},
+		{template: "a.b" + AnyValue, value: "axb1"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchValue(tt.template, tt.value), "%q ~ %q", tt.template, tt.value)
+	}
+}
@@ -0,0 +1,186 @@
+package soaptest
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+// Update makes AssertEncodesTo regenerate the golden files instead of comparing with them. They are also
+// regenerated if the test binary has a boolean -update flag and it is set; soaptest does not define the flag, so
+// test packages can define their own, e.g. for golden files of their own, and regenerate all of them at once.
+var Update bool
+
+// updating reports whether the golden files are regenerated, with Update or the -update flag.
+func updating() bool {
+	if Update {
+		return true
+	}
+	f := flag.Lookup("update")
+	if f == nil {
+		return false
+	}
+	getter, ok := f.Value.(flag.Getter)
+	if !ok {
+		return false
+	}
+	set, ok := getter.Get().(bool)
+	return ok && set
+}
+
+// AssertDecodesTo asserts that the XML fixture at fixturePath decodes into a value equal to want. The target
+// returned by newTarget is decoded like a response of Client.Do if the fixture is an envelope, with
+// xml.Unmarshal otherwise; recorded fixtures are decoded from their response. want may be the target or the
+// value it points to. Differences are reported by the path of their element in the XML of the values.
+func AssertDecodesTo(t testing.TB, fixturePath string, newTarget func() any, want any) bool {
+	t.Helper()
+	data, err := readFixture(fixturePath)
+	if err != nil {
+		t.Errorf("fixture %s: %v", fixturePath, err)
+		return false
+	}
+	target := newTarget()
+	root, err := readRoot(data)
+	if err != nil {
+		t.Errorf("fixture %s: %v", fixturePath, err)
+		return false
+	}
+	if root.Tag == "Envelope" {
+		err = soap.UnmarshalResponse(data, target)
+	} else {
+		err = xml.Unmarshal(data, target)
+	}
+	if err != nil {
+		t.Errorf("decode %s: %v", fixturePath, err)
+		return false
+	}
+	got := target
+	if v := reflect.ValueOf(target); v.Kind() == reflect.Pointer && reflect.TypeOf(want) != v.Type() {
+		got = v.Elem().Interface()
+	}
+	if reflect.DeepEqual(want, got) {
+		return true
+	}
+	if wantXML, err := xml.Marshal(want); err == nil {
+		if gotXML, err := xml.Marshal(got); err == nil {
+			if diffs, err := DiffXML(wantXML, gotXML); err == nil && len(diffs) > 0 {
+				t.Errorf("decode %s:\n%s", fixturePath, strings.Join(diffs, "\n"))
+				return false
+			}
+		}
+	}
+	// the values differ outside of their XML, e.g. in unexported or omitted fields
+	return assert.Equal(t, want, got, "decode %s", fixturePath)
+}
+
+// AssertEncodesTo asserts that the XML of value matches the golden file at fixturePath, compared with DiffXML.
+// value is marshaled with xml.Marshal unless it is already encoded as []byte or string, e.g. a request of
+// Server.Requests. The volatile values selected by VolatileSelectors and the values selected by ignore are
+// not compared. With Update or the -update flag the golden file is written from value instead, with the
+// selected values replaced with AnyValue.
+func AssertEncodesTo(t testing.TB, value any, fixturePath string, ignore ...Selector) bool {
+	t.Helper()
+	var got []byte
+	switch v := value.(type) {
+	case []byte:
+		got = v
+	case string:
+		got = []byte(v)
+	default:
+		var err error
+		if got, err = xml.Marshal(value); err != nil {
+			t.Errorf("encode %s: %v", fixturePath, err)
+			return false
+		}
+	}
+	ignore = append(append([]Selector{}, VolatileSelectors...), ignore...)
+	if updating() {
+		if err := writeGolden(fixturePath, got, ignore); err != nil {
+			t.Errorf("update %s: %v", fixturePath, err)
+			return false
+		}
+	}
+	want, err := os.ReadFile(fixturePath)
+	if err != nil {
+		t.Errorf("golden file %s: %v (set soaptest.Update or run the tests with -update to create it)", fixturePath, err)
+		return false
+	}
+	diffs, err := DiffXML(want, got, ignore...)
+	if err != nil {
+		t.Errorf("encode %s: %v", fixturePath, err)
+		return false
+	}
+	if len(diffs) > 0 {
+		t.Errorf("encode %s:\n%s", fixturePath, strings.Join(diffs, "\n"))
+		return false
+	}
+	return true
+}
+
+// readFixture returns the XML of the fixture file, the response of a recorded fixture.
+func readFixture(file string) ([]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil || filepath.Ext(file) != ".json" {
+		return data, err
+	}
+	f := &Fixture{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, err
+	}
+	return []byte(f.Response), nil
+}
+
+// writeGolden writes the document data indented to the golden file, with the elements and attributes
+// selected by selectors replaced with AnyValue.
+func writeGolden(file string, data []byte, selectors []Selector) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return err
+	}
+	if doc.Root() == nil {
+		return fmt.Errorf("no root element")
+	}
+	normalize(doc.Root(), nil, selectors)
+	doc.Indent(2)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return doc.WriteToFile(file)
+}
+
+// normalize replaces the values of el and its descendants selected by selectors with AnyValue, path holding
+// the local names of the ancestors of el.
+func normalize(el *etree.Element, path []string, selectors []Selector) {
+	path = append(path, el.Tag)
+	if selected(selectors, path, "") {
+		el.Child = nil
+		attrs := el.Attr[:0]
+		for _, a := range el.Attr {
+			if isNamespaceDecl(a) {
+				attrs = append(attrs, a)
+			}
+		}
+		el.Attr = attrs
+		el.SetText(AnyValue)
+		return
+	}
+	for i, a := range el.Attr {
+		if !isNamespaceDecl(a) && selected(selectors, path, a.Key) {
+			el.Attr[i].Value = AnyValue
+		}
+	}
+	for _, child := range el.ChildElements() {
+		normalize(child, path, selectors)
+	}
+}
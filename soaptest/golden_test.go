@@ -0,0 +1,178 @@
+package soaptest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failures records the errors reported by assertions instead of failing the test.
+type failures struct {
+	testing.TB
+	errors []string
+}
+
+func (f *failures) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestSelector(t *testing.T) {
+	path := []string{"Envelope", "Header", "Security", "Timestamp", "Created"}
+	tests := []struct {
+		selector Selector
+		attr     string
+		want     bool
+	}{
+		{selector: "//Created", want: true},
+		{selector: "//Timestamp/Created", want: true},
+		{selector: "Envelope/Header/*/Timestamp/Created", want: true},
+		{selector: "Envelope/*/Created"},
+		{selector: "//Expires"},
+		{selector: "//Created", attr: "Id"},
+		{selector: "//Created/@Id", attr: "Id", want: true},
+		{selector: "//@Id", attr: "Id", want: true},
+		{selector: "//Created/@Id"},
+		{selector: "//Created/@Id", attr: "URI"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.selector.match(path, tt.attr), "%s %s", tt.selector, tt.attr)
+	}
+}
+
+func TestDiffXML(t *testing.T) {
+	const want = `<a:Order xmlns:a="urn:orders" id="1"><a:Item>x</a:Item><a:Item>y</a:Item><a:Note>{{any}}</a:Note>` +
+		`<a:Created>{{timestamp}}</a:Created></a:Order>`
+	tests := []struct {
+		name   string
+		got    string
+		ignore []Selector
+		diffs  []string
+	}{
+		{name: "equal", got: `<Order xmlns="urn:orders" id="1">
+  <Item> x </Item><Item>y</Item><Note><b>any</b></Note><Created>2024-01-02T03:04:05Z</Created>
+</Order>`},
+		{name: "text", got: `<Order xmlns="urn:orders" id="1"><Item>x</Item><Item>z</Item><Note/>` +
+			`<Created>yesterday</Created></Order>`,
+			diffs: []string{`/Order/Item[2]: text "z", want "y"`, `/Order/Created: text "yesterday", want "{{timestamp}}"`}},
+		{name: "attributes", got: `<Order xmlns="urn:orders" xmlns:x="urn:x" id="2" x:extra="e"><Item>x</Item>` +
+			`<Item>y</Item><Note/><Created>2024-01-02T03:04:05Z</Created></Order>`,
+			diffs: []string{`/Order: attribute id="2", want "1"`, `/Order: unexpected attribute {urn:x}extra="e"`}},
+		{name: "ignored attributes", got: `<Order xmlns="urn:orders" xmlns:x="urn:x" id="2" x:extra="e"><Item>x</Item>` +
+			`<Item>y</Item><Note/><Created>2024-01-02T03:04:05Z</Created></Order>`, ignore: []Selector{"Order/@id", "//@extra"}},
+		{name: "elements", got: `<Order xmlns="urn:orders" id="1"><Item>x</Item><Line>y</Line></Order>`,
+			diffs: []string{`/Order/Item[2]: element {urn:orders}Line, want {urn:orders}Item`,
+				`/Order: missing element Note`, `/Order: missing element Created`}},
+		{name: "ignored elements", got: `<Order xmlns="urn:orders" id="1"><Item>x</Item><Item>y</Item><Note/>` +
+			`<Created>yesterday</Created></Order>`, ignore: []Selector{"//Created"}},
+		{name: "namespace", got: `<Order xmlns="urn:other" id="1"/>`,
+			diffs: []string{`/Order: element {urn:other}Order, want {urn:orders}Order`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, err := DiffXML([]byte(want), []byte(tt.got), tt.ignore...)
+			require.NoError(t, err)
+			assert.Equal(t, tt.diffs, diffs)
+		})
+	}
+
+	_, err := DiffXML([]byte(want), []byte("<Order"))
+	assert.ErrorContains(t, err, "got:")
+}
+
+func TestAssertDecodesTo(t *testing.T) {
+	newTarget := func() any { return &echoResponse{} }
+	want := echoResponse{XMLName: xml.Name{Space: "urn:echo", Local: "EchoResponse"}, Text: "recorded"}
+	AssertDecodesTo(t, "testdata/echo-response.xml", newTarget, want)
+	AssertDecodesTo(t, "testdata/echo-response.xml", newTarget, &want)
+	AssertDecodesTo(t, "testdata/echo.xml", func() any { return &echoRequest{} },
+		&echoRequest{XMLName: xml.Name{Space: "urn:echo", Local: "Echo"}, Text: "hi"})
+
+	f := &failures{TB: t}
+	assert.False(t, AssertDecodesTo(f, "testdata/echo-response.xml", newTarget, &echoResponse{Text: "live"}))
+	require.Len(t, f.errors, 1)
+	assert.Contains(t, f.errors[0], `/EchoResponse/Text: text "recorded", want "live"`)
+
+	f = &failures{TB: t}
+	assert.False(t, AssertDecodesTo(f, "testdata/missing.xml", newTarget, want))
+	assert.Len(t, f.errors, 1)
+}
+
+func TestAssertDecodesRecordedFixture(t *testing.T) {
+	live := NewServer(t)
+	live.Respond("Echo", `<EchoResponse xmlns="urn:echo"><Text>recorded</Text></EchoResponse>`)
+	dir := t.TempDir()
+	require.NoError(t, recordingClient(t, live.URL, NewRecorder(dir, nil)).Do(context.Background(), "Echo",
+		&echoRequest{Text: "hi"}, &echoResponse{}))
+	AssertDecodesTo(t, filepath.Join(dir, "Echo-001.json"), func() any { return &echoResponse{} },
+		&echoResponse{XMLName: xml.Name{Space: "urn:echo", Local: "EchoResponse"}, Text: "recorded"})
+}
+
+// updateFlag is the -update flag of a test package using the assertions.
+var updateFlag = flag.Bool("update", false, "regenerate the golden files")
+
+// setUpdate sets Update for the test.
+func setUpdate(t *testing.T, value bool) {
+	previous := Update
+	Update = value
+	t.Cleanup(func() { Update = previous })
+}
+
+func TestUpdateFlag(t *testing.T) {
+	setUpdate(t, false)
+	assert.False(t, updating())
+	*updateFlag = true
+	t.Cleanup(func() { *updateFlag = false })
+	assert.True(t, updating())
+}
+
+func TestAssertEncodesTo(t *testing.T) {
+	// the assertions of mismatches would rewrite the golden file
+	setUpdate(t, false)
+	AssertEncodesTo(t, &echoRequest{Text: "hi"}, "testdata/echo.xml")
+
+	f := &failures{TB: t}
+	assert.False(t, AssertEncodesTo(f, &echoRequest{Text: "hello"}, "testdata/echo.xml"))
+	require.Len(t, f.errors, 1)
+	assert.Contains(t, f.errors[0], `/Echo/Text: text "hello", want "hi"`)
+
+	f = &failures{TB: t}
+	assert.False(t, AssertEncodesTo(f, &echoRequest{Text: "hi"}, filepath.Join(t.TempDir(), "missing.xml")))
+	require.Len(t, f.errors, 1)
+	assert.Contains(t, f.errors[0], "-update")
+}
+
+func TestAssertEncodesToUpdate(t *testing.T) {
+	srv := NewServer(t)
+	srv.Respond("Echo", `<EchoResponse xmlns="urn:echo"><Text>hi</Text></EchoResponse>`)
+	client := recordingClient(t, srv.URL, nil)
+	// the signatures and the ids they reference differ with the timestamps
+	ignore := []Selector{"//SignatureValue", "//DigestValue", "//Reference/@URI", "//@Id"}
+	golden := filepath.Join(t.TempDir(), "golden", "echo-request.xml")
+
+	setUpdate(t, true)
+	require.NoError(t, client.Do(context.Background(), "Echo", &echoRequest{Text: "hi"}, &echoResponse{}))
+	require.True(t, AssertEncodesTo(t, srv.Requests()[0].Body, golden, ignore...))
+	data, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	for _, name := range []string{"Created", "Expires", "MessageID", "SignatureValue"} {
+		assert.Regexp(t, `:`+name+`[^>]*>\{\{any\}\}<`, string(data), name)
+	}
+
+	Update = false
+	require.NoError(t, client.Do(context.Background(), "Echo", &echoRequest{Text: "hi"}, &echoResponse{}))
+	// the golden file matches the values ignored while updating
+	AssertEncodesTo(t, string(srv.Requests()[1].Body), golden)
+
+	require.NoError(t, client.Do(context.Background(), "Echo", &echoRequest{Text: "hello"}, &echoResponse{}))
+	f := &failures{TB: t}
+	assert.False(t, AssertEncodesTo(f, srv.Requests()[2].Body, golden, ignore...))
+	require.Len(t, f.errors, 1)
+	assert.Contains(t, f.errors[0], `/Envelope/Body/Echo/Text: text "hello", want "hi"`)
+}
@@ -0,0 +1,109 @@
+// Package soaptest provides a stub SOAP service for testing SOAP clients.
+package soaptest
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const envelopeNS = "http://schemas.xmlsoap.org/soap/envelope/"
+
+// Request is a request received by the Server.
+type Request struct {
+	// Action is the SOAP action with surrounding quotes removed.
+	Action string
+	Header http.Header
+	// Body is the received envelope.
+	Body []byte
+}
+
+// Server is an HTTP server answering SOAP actions with canned responses. Actions without response
+// are answered with a client fault.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	handlers map[string]http.HandlerFunc
+	requests []Request
+}
+
+// NewServer starts a Server which is closed at the end of the test.
+func NewServer(t testing.TB) *Server {
+	s := &Server{handlers: map[string]http.HandlerFunc{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Envelope wraps the serialized body content into a SOAP envelope.
+func Envelope(body string) string {
+	return `<soap:Envelope xmlns:soap="` + envelopeNS + `"><soap:Body>` + body + `</soap:Body></soap:Envelope>`
+}
+
+// FaultEnvelope returns a SOAP envelope containing a fault.
+func FaultEnvelope(code, message string) string {
+	return Envelope(fmt.Sprintf(`<soap:Fault><faultcode>%s</faultcode><faultstring>%s</faultstring></soap:Fault>`,
+		html.EscapeString(code), html.EscapeString(message)))
+}
+
+// Handle answers requests for action with handler.
+func (s *Server) Handle(action string, handler http.HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[action] = handler
+}
+
+// Respond answers requests for action with an envelope containing the serialized body content.
+func (s *Server) Respond(action string, body string) {
+	s.Handle(action, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		_, _ = io.WriteString(w, Envelope(body))
+	})
+}
+
+// Fault answers requests for action with a SOAP fault.
+func (s *Server) Fault(action string, code, message string) {
+	s.Handle(action, func(w http.ResponseWriter, r *http.Request) {
+		writeFault(w, code, message)
+	})
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	action := actionOf(r)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{Action: action, Header: r.Header.Clone(), Body: body})
+	handler := s.handlers[action]
+	s.mu.Unlock()
+
+	if handler == nil {
+		writeFault(w, "soap:Client", fmt.Sprintf("no response for action %q", action))
+		return
+	}
+	r.Body = io.NopCloser(strings.NewReader(string(body)))
+	handler(w, r)
+}
+
+func writeFault(w http.ResponseWriter, code, message string) {
+	w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	_, _ = io.WriteString(w, FaultEnvelope(code, message))
+}
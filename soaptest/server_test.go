@@ -0,0 +1,60 @@
+package soaptest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/m29h/xml"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+	"github.com/stretchr/testify/assert"
+)
+
+type echoRequest struct {
+	XMLName xml.Name `xml:"urn:echo Echo"`
+	Text    string   `xml:"Text"`
+}
+
+type echoResponse struct {
+	XMLName xml.Name `xml:"urn:echo EchoResponse"`
+	Text    string   `xml:"Text"`
+}
+
+func TestServerRespond(t *testing.T) {
+	srv := NewServer(t)
+	srv.Respond("Echo", `<EchoResponse xmlns="urn:echo"><Text>hi</Text></EchoResponse>`)
+
+	client := soap.NewClient(srv.URL)
+	resp := &echoResponse{}
+	assert.NoError(t, client.Do(context.Background(), "Echo", &echoRequest{Text: "hi"}, resp))
+	assert.Equal(t, "hi", resp.Text)
+
+	requests := srv.Requests()
+	if assert.Len(t, requests, 1) {
+		assert.Equal(t, "Echo", requests[0].Action)
+		assert.Contains(t, string(requests[0].Body), ">hi</")
+	}
+}
+
+func TestServerFault(t *testing.T) {
+	srv := NewServer(t)
+	srv.Fault("Echo", "soap:Server", "broken & down")
+
+	err := soap.NewClient(srv.URL).Do(context.Background(), "Echo", &echoRequest{}, &echoResponse{})
+	var fault *soap.Fault
+	if assert.True(t, errors.As(err, &fault)) {
+		assert.Equal(t, "soap:Server", fault.Code)
+		assert.Equal(t, "broken & down", fault.String)
+	}
+}
+
+func TestServerUnknownAction(t *testing.T) {
+	srv := NewServer(t)
+
+	err := soap.NewClient(srv.URL).Do(context.Background(), "Missing", &echoRequest{}, &echoResponse{})
+	var fault *soap.Fault
+	if assert.True(t, errors.As(err, &fault)) {
+		assert.Equal(t, "soap:Client", fault.Code)
+	}
+}
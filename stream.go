@@ -0,0 +1,239 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+
+	"github.com/m29h/xml"
+)
+
+// Implements streaming decoding of response bodies.
+// Instead of decoding the whole body into a response struct, the body elements are handed one by one to a
+// callback, which allows to process result sets that do not fit into memory.
+
+var (
+	// ErrDescend is returned by a StreamFunc to receive the children of the element instead of the element itself.
+	ErrDescend = errors.New("descend into element")
+	// ErrStreamUnsupported is returned by DoStream for responses or settings it cannot stream.
+	ErrStreamUnsupported = errors.New("streaming decode not supported")
+)
+
+// StreamFunc is called by Client.DoStream for each element of the response body, with dec positioned at start.
+// The function must consume the element, e.g. with dec.DecodeElement or dec.Skip, or return ErrDescend
+// to get called for each child element of start instead. Any other error aborts the stream and is returned.
+type StreamFunc func(dec *xml.Decoder, start xml.StartElement) error
+
+// DoStream invokes the SOAP request like Do, but passes the elements of the response body to fn as they
+// are read instead of decoding them into a response struct. A SOAP fault is returned as error. Like Do, failed
+// calls return a *CallError wrapping the error, including the one returned by fn.
+// Streamed calls are never retried and multipart responses are not supported. An envelope in the other SOAP
+// version than the request fails with ErrVersionMismatch, also with AutoNegotiate.
+func (c *Client) DoStream(ctx context.Context, action string, request any, fn StreamFunc, opts ...Option) error {
+	cl, err := c.newCall(ctx, action, request, nil, opts)
+	if err != nil {
+		return &CallError{Action: action, Endpoint: redactURL(c.url), Err: err}
+	}
+	return newCallError(cl, c.stream(ctx, cl, fn))
+}
+
+// stream makes the single attempt of a streamed call.
+func (c *Client) stream(ctx context.Context, cl *call, fn StreamFunc) error {
+	if cl.settings.newDecoder != nil {
+		return errors.Join(ErrStreamUnsupported, errors.New("custom decoder factories cannot be used with DoStream"))
+	}
+
+	done, err := cl.settings.allowAttempt()
+	if err != nil {
+		cl.observeGiveUp(err, cl.url)
+		cl.finish(ctx, err)
+		return err
+	}
+	if err = cl.settings.waitLimiter(ctx); err != nil {
+		done(err)
+		cl.finish(ctx, err)
+		return err
+	}
+	cl.startTimer()
+	err = cl.stopTimer(c.doStream(ctx, cl, fn))
+	done(err)
+	cl.settings.throttle(err)
+	if err != nil {
+		cl.observeGiveUp(err, cl.url)
+	}
+	cl.finish(ctx, err)
+	return err
+}
+
+func (c *Client) doStream(ctx context.Context, cl *call, fn StreamFunc) (err error) {
+	cl.startFlight()
+	defer func() { cl.flight.end(err) }()
+	_, httpResp, err := c.send(ctx, cl)
+	if err != nil {
+		return err
+	}
+	// Closing an unread body closes the connection, which is what we want if the stream is aborted.
+	defer httpResp.Body.Close()
+	finishTee, err := cl.teeResponse(ctx, httpResp)
+	if err != nil {
+		return err
+	}
+	defer func() { finishTee(err) }()
+	cl.flight.response(httpResp)
+
+	var counter *countingReader
+	body := io.Reader(&ctxReader{ctx: ctx, r: httpResp.Body})
+	if cl.info != nil {
+		counter = &countingReader{r: body}
+		body = counter
+	}
+	if httpResp, body, err = cl.settings.decodeMessage(httpResp, body); err != nil {
+		return err
+	}
+	mediaType, _, err := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	if !soapMediaType(mediaType) {
+		return ErrStreamUnsupported
+	}
+
+	statusOK := httpResp.StatusCode >= 200 && httpResp.StatusCode <= 299
+	if !statusOK {
+		// only look for a fault, the content of an error response is not handed out
+		fn = func(dec *xml.Decoder, start xml.StartElement) error {
+			return dec.Skip()
+		}
+	}
+
+	body, gwErr, err := sniffBody(body, httpResp, cl.attempt)
+	if err != nil {
+		return err
+	}
+	if gwErr != nil && !gwErr.markup {
+		return gwErr
+	}
+	if err := wrongEndpoint(body, httpResp, cl.attempt); err != nil {
+		return err
+	}
+	body, err = trimProlog(body)
+	if err != nil {
+		return err
+	}
+
+	var tokens *countingTokenReader
+	dec := xml.NewDecoder(cl.settings.mapNames(cl.settings.replaceEntities(body)))
+	dec.Entity = cl.settings.entities
+	if cl.info != nil {
+		tokens = &countingTokenReader{t: dec}
+		dec = xml.NewTokenDecoder(tokens)
+	}
+	defer registerGzip(dec, cl.settings.gzip)()
+	defer registerEnums(dec, cl.settings.enums)()
+	faultBody := &Body{version: cl.settings.version, languages: cl.settings.languages}
+	fault, err := streamEnvelope(ctx, dec, faultBody, fn)
+
+	if cl.info != nil {
+		cl.info.StatusCode = httpResp.StatusCode
+		cl.info.Header = httpResp.Header
+		cl.info.BytesRead = counter.n
+		cl.info.Elements = tokens.elements
+	}
+	if fault != nil {
+		return fault
+	}
+	if err = gwErr.decodeError(err); errors.Is(err, ErrGatewayResponse) {
+		return err
+	}
+	if !statusOK {
+		return newHTTPError(httpResp, cl.attempt, err)
+	}
+	return err
+}
+
+// streamEnvelope reads the envelope from dec and passes the body elements to fn. The envelope is expected in
+// the SOAP version of body, which decodes the fault.
+func streamEnvelope(ctx context.Context, dec *xml.Decoder, body *Body, fn StreamFunc) (*Fault, error) {
+	envelope := true
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if envelope {
+			if err := versionMismatch(body.version, start); err != nil {
+				return nil, err
+			}
+			envelope = false
+		}
+		if start.Name.Space != body.version.namespace() {
+			continue
+		}
+		switch start.Name.Local {
+		case "Header":
+			if err := dec.Skip(); err != nil {
+				return nil, err
+			}
+		case "Body":
+			return streamChildren(ctx, dec, body, fn, true)
+		}
+	}
+}
+
+// streamChildren passes the child elements of the current element to fn until its end element is reached.
+func streamChildren(ctx context.Context, dec *xml.Decoder, body *Body, fn StreamFunc, inBody bool) (*Fault, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		token, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch elem := token.(type) {
+		case xml.StartElement:
+			if inBody && elem.Name.Space == body.version.namespace() && elem.Name.Local == "Fault" {
+				if err := body.decodeFault(dec, elem, false); err != nil {
+					return nil, err
+				}
+				return body.Fault, nil
+			}
+			err := fn(dec, elem)
+			if errors.Is(err, ErrDescend) {
+				var fault *Fault
+				fault, err = streamChildren(ctx, dec, body, fn, false)
+				if fault != nil {
+					return fault, nil
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+		case xml.EndElement:
+			return nil, nil
+		}
+	}
+}
+
+// ctxReader fails reads with the context error once ctx is done. A read failing because the transport
+// aborted the body on cancellation reports the context error as well.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	if err != nil && err != io.EOF && c.ctx.Err() != nil {
+		return n, c.ctx.Err()
+	}
+	return n, err
+}
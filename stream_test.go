@@ -0,0 +1,179 @@
+package soap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type streamRow struct {
+	ID   int    `xml:"id,attr"`
+	Name string `xml:"Name"`
+}
+
+func newRowServer(t *testing.T, rows int, delay time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header><Session>x</Session></soap:Header><soap:Body><ReportResponse xmlns="urn:test">`)
+		for i := 0; i < rows; i++ {
+			if _, err := fmt.Fprintf(w, `<Row id="%d"><Name>row %d</Name></Row>`, i, i); err != nil {
+				return
+			}
+			if delay > 0 {
+				w.(http.Flusher).Flush()
+				select {
+				case <-r.Context().Done():
+					return
+				case <-time.After(delay):
+				}
+			}
+		}
+		fmt.Fprint(w, `</ReportResponse></soap:Body></soap:Envelope>`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// rowCollector descends into the wrapper element and decodes each row.
+func rowCollector(rows *[]streamRow) StreamFunc {
+	return func(dec *xml.Decoder, start xml.StartElement) error {
+		if start.Name.Local == "ReportResponse" {
+			return ErrDescend
+		}
+		var row streamRow
+		if err := dec.DecodeElement(&row, &start); err != nil {
+			return err
+		}
+		*rows = append(*rows, row)
+		return nil
+	}
+}
+
+func TestDoStream(t *testing.T) {
+	srv := newRowServer(t, 1000, 0)
+	client := NewClient(srv.URL)
+
+	var rows []streamRow
+	var info ResponseInfo
+	err := client.DoStream(context.Background(), "Report", &infoRequest{}, rowCollector(&rows), WithResponseInfo(&info))
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 1000) {
+		assert.Equal(t, streamRow{ID: 999, Name: "row 999"}, rows[999])
+	}
+	// Envelope, Header, Session, Body, ReportResponse and the rows with their names
+	assert.Equal(t, 5+2000, info.Elements)
+}
+
+func TestDoStreamFault(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>report failed</faultstring></soap:Fault></soap:Body></soap:Envelope>`)
+	client := NewClient(srv.URL)
+
+	var rows []streamRow
+	err := client.DoStream(context.Background(), "Report", &infoRequest{}, rowCollector(&rows))
+	var fault *Fault
+	if assert.ErrorAs(t, err, &fault) {
+		assert.Equal(t, "report failed", fault.String)
+	}
+	assert.Empty(t, rows)
+}
+
+func TestDoStreamCancel(t *testing.T) {
+	srv := newRowServer(t, 1000000, time.Millisecond)
+	client := NewClient(srv.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var rows []streamRow
+	collect := rowCollector(&rows)
+
+	start := time.Now()
+	err := client.DoStream(ctx, "Report", &infoRequest{}, func(dec *xml.Decoder, start xml.StartElement) error {
+		if len(rows) == 10 {
+			cancel()
+		}
+		return collect(dec, start)
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, len(rows), 20)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestDoStreamCallbackError(t *testing.T) {
+	srv := newRowServer(t, 10, 0)
+	client := NewClient(srv.URL)
+
+	stop := fmt.Errorf("stop")
+	err := client.DoStream(context.Background(), "Report", &infoRequest{}, func(dec *xml.Decoder, start xml.StartElement) error {
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+
+	err = client.DoStream(context.Background(), "Report", &infoRequest{}, collectNothing,
+		WithDecoderFactory(func(r io.Reader) SOAPDecoder { return xml.NewDecoder(r) }))
+	assert.ErrorIs(t, err, ErrStreamUnsupported)
+}
+
+func TestDoStreamSOAP12(t *testing.T) {
+	srv := newInfoServer(t, "application/soap+xml; charset=utf-8",
+		`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Header><Session>x</Session></env:Header>`+
+			`<env:Body><ReportResponse xmlns="urn:test"><Row id="1"><Name>one</Name></Row><Row id="2"><Name>two</Name></Row>`+
+			`</ReportResponse></env:Body></env:Envelope>`)
+	client := NewClient(srv.URL)
+
+	var rows []streamRow
+	soap12 := WithVersion(SOAP12)
+	require.NoError(t, client.DoStream(context.Background(), "Report", &infoRequest{}, rowCollector(&rows), soap12))
+	assert.Equal(t, []streamRow{{ID: 1, Name: "one"}, {ID: 2, Name: "two"}}, rows)
+
+	// the other version is rejected like by Do
+	err := client.DoStream(context.Background(), "Report", &infoRequest{}, rowCollector(&rows))
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+
+	srv = newInfoServer(t, "application/soap+xml", `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">`+
+		`<env:Body><env:Fault><env:Code><env:Value>env:Receiver</env:Value></env:Code>`+
+		`<env:Reason><env:Text xml:lang="en">report failed</env:Text></env:Reason></env:Fault></env:Body></env:Envelope>`)
+	err = NewClient(srv.URL).DoStream(context.Background(), "Report", &infoRequest{}, rowCollector(&rows), soap12)
+	var fault *Fault
+	if assert.ErrorAs(t, err, &fault) {
+		assert.Equal(t, "report failed", fault.String)
+	}
+}
+
+func TestDoStreamCallError(t *testing.T) {
+	srv := newRowServer(t, 10, 0)
+	client := NewClient(srv.URL)
+
+	stop := func(dec *xml.Decoder, start xml.StartElement) error { return fmt.Errorf("stop") }
+	err := client.DoStream(context.Background(), "Report", &infoRequest{}, stop)
+	var callErr *CallError
+	if assert.ErrorAs(t, err, &callErr) {
+		assert.Equal(t, "Report", callErr.Action)
+		assert.Equal(t, srv.URL, callErr.Endpoint)
+		assert.Equal(t, 1, callErr.Attempts)
+	}
+
+	invalid := func(s *settings) error { return fmt.Errorf("invalid option") }
+	err = client.DoStream(context.Background(), "Report", &infoRequest{}, collectNothing, invalid)
+	if assert.ErrorAs(t, err, &callErr) {
+		assert.Equal(t, 0, callErr.Attempts)
+		assert.EqualError(t, callErr.Err, "invalid option")
+	}
+
+	srv.Close()
+	err = client.DoStream(context.Background(), "Report", &infoRequest{}, collectNothing)
+	assert.ErrorAs(t, err, &callErr)
+}
+
+func collectNothing(dec *xml.Decoder, start xml.StartElement) error {
+	return dec.Skip()
+}
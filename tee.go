@@ -0,0 +1,89 @@
+package soap
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// TeeCloser is implemented by tee writers that are told the outcome of the attempt when closed, like
+// *io.PipeWriter. CloseWithError is called instead of Close, with nil if the attempt succeeded.
+type TeeCloser interface {
+	io.WriteCloser
+	CloseWithError(err error) error
+}
+
+// WithResponseTee copies the bytes of every response body to the writer open returns for the attempt, while
+// the response is decoded, e.g. to archive the responses. No copy is made if open returns nil. The rest of
+// the body not read by the decoder is copied before the writer is closed, except for aborted streams of
+// Client.DoStream. The writer is closed when the attempt finishes, see TeeCloser to receive its error. A
+// failing write fails the attempt.
+//
+// The copy holds the bytes as read from the transport: MTOM responses are copied with all their parts, gzip
+// compressed responses decompressed by the transport, unless WithCompressedTee is set.
+func WithResponseTee(open func(ctx context.Context, action string) io.WriteCloser) Option {
+	return func(s *settings) error {
+		s.responseTee = open
+		return nil
+	}
+}
+
+// WithCompressedTee makes WithResponseTee copy gzip compressed responses as received. The requests accept
+// gzip explicitly, so the responses are decompressed by the client instead of the transport.
+func WithCompressedTee() Option {
+	return func(s *settings) error {
+		s.compressedTee = true
+		return nil
+	}
+}
+
+// acceptGzip asks for compressed responses to tee, unless the request already states what it accepts.
+func (cl *call) acceptGzip(httpReq *http.Request) {
+	if cl.settings.responseTee != nil && cl.settings.compressedTee && httpReq.Header.Get("Accept-Encoding") == "" {
+		httpReq.Header.Set("Accept-Encoding", "gzip")
+	}
+}
+
+// teeResponse wraps the body of httpResp to copy it to the tee writer of the attempt. The returned function
+// closes the writer with the error of the attempt.
+func (cl *call) teeResponse(ctx context.Context, httpResp *http.Response) (func(err error), error) {
+	if cl.settings.responseTee == nil {
+		return func(error) {}, nil
+	}
+	w := cl.settings.responseTee(ctx, cl.action)
+	if w == nil {
+		return func(error) {}, nil
+	}
+	finish := func(err error) {
+		if tc, ok := w.(TeeCloser); ok {
+			_ = tc.CloseWithError(err)
+			return
+		}
+		_ = w.Close()
+	}
+	body := httpResp.Body
+	httpResp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(body, w), body}
+
+	if cl.settings.compressedTee && strings.EqualFold(httpResp.Header.Get("Content-Encoding"), "gzip") {
+		zr, err := gzip.NewReader(httpResp.Body)
+		if err != nil {
+			finish(err)
+			return nil, err
+		}
+		httpResp.Body = struct {
+			io.Reader
+			io.Closer
+		}{zr, body}
+		// like the transport decompressing a response
+		httpResp.Header.Del("Content-Encoding")
+		httpResp.Header.Del("Content-Length")
+		httpResp.ContentLength = -1
+		httpResp.Uncompressed = true
+	}
+	return finish, nil
+}
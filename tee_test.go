@@ -0,0 +1,143 @@
+package soap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// teeRecorder records the teed bytes and the error it was closed with.
+type teeRecorder struct {
+	bytes.Buffer
+	action string
+	closed bool
+	err    error
+}
+
+func (r *teeRecorder) Close() error {
+	return r.CloseWithError(nil)
+}
+
+func (r *teeRecorder) CloseWithError(err error) error {
+	r.closed, r.err = true, err
+	return nil
+}
+
+func recordTees(tees *[]*teeRecorder) Option {
+	return WithResponseTee(func(_ context.Context, action string) io.WriteCloser {
+		r := &teeRecorder{action: action}
+		*tees = append(*tees, r)
+		return r
+	})
+}
+
+// newGzipServer answers with body, gzip compressed if the request accepts it. It records the compressed bytes.
+func newGzipServer(t *testing.T, body string) (*httptest.Server, *[]byte) {
+	t.Helper()
+	var sent []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			_, _ = io.WriteString(w, body)
+			return
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, _ = io.WriteString(zw, body)
+		_ = zw.Close()
+		sent = buf.Bytes()
+		w.Header().Set("Content-Encoding", "gzip")
+		_, _ = w.Write(sent)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &sent
+}
+
+func TestResponseTee(t *testing.T) {
+	// the trailing comment is not read by the decoder
+	body := infoResponseBody + "\n<!-- trailer -->\n"
+	srv := newInfoServer(t, "text/xml", body)
+	client := NewClient(srv.URL)
+	var tees []*teeRecorder
+	require.NoError(t, client.SetOptions(recordTees(&tees)))
+
+	resp := &infoResponse{}
+	require.NoError(t, client.Do(context.Background(), "Info", &infoRequest{}, resp))
+	require.Len(t, tees, 1)
+	assert.Equal(t, body, tees[0].String())
+	assert.Equal(t, "Info", tees[0].action)
+	assert.True(t, tees[0].closed)
+	assert.NoError(t, tees[0].err)
+}
+
+func TestResponseTeeFault(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>`+
+		`<soap:Fault><faultcode>soap:Server</faultcode><faultstring>boom</faultstring></soap:Fault></soap:Body></soap:Envelope>`)
+	client := NewClient(srv.URL)
+	var tees []*teeRecorder
+	require.NoError(t, client.SetOptions(recordTees(&tees)))
+
+	err := client.Do(context.Background(), "Info", &infoRequest{}, &infoResponse{})
+	var fault *Fault
+	require.ErrorAs(t, err, &fault)
+	require.Len(t, tees, 1)
+	assert.Contains(t, tees[0].String(), "boom")
+	assert.ErrorAs(t, tees[0].err, &fault)
+}
+
+func TestResponseTeeGzip(t *testing.T) {
+	srv, sent := newGzipServer(t, infoResponseBody)
+	client := NewClient(srv.URL)
+	var tees []*teeRecorder
+	require.NoError(t, client.SetOptions(recordTees(&tees)))
+
+	// decompressed by the transport
+	require.NoError(t, client.Do(context.Background(), "Info", &infoRequest{}, &infoResponse{}))
+	require.Len(t, tees, 1)
+	assert.Equal(t, infoResponseBody, tees[0].String())
+
+	require.NoError(t, client.SetOptions(WithCompressedTee()))
+	require.NoError(t, client.Do(context.Background(), "Info", &infoRequest{}, &infoResponse{}))
+	require.Len(t, tees, 2)
+	assert.NotEmpty(t, *sent)
+	assert.Equal(t, *sent, tees[1].Bytes())
+	assert.NoError(t, tees[1].err)
+}
+
+func TestResponseTeeMTOM(t *testing.T) {
+	srv, _ := newMTOMEchoServer(t)
+	client := NewClient(srv.URL)
+	var tees []*teeRecorder
+	require.NoError(t, client.SetOptions(WithMTOM(), MTOMThreshold(100), recordTees(&tees)))
+
+	req := &upload{Large: Attachment{Data: bytes.Repeat([]byte("x"), 1000)}}
+	resp := &upload{}
+	require.NoError(t, client.Do(context.Background(), "Upload", req, resp))
+	assert.Equal(t, req.Large.Data, resp.Large.Data)
+	require.Len(t, tees, 1)
+	assert.Contains(t, tees[0].String(), "Content-Type: application/xop+xml")
+	assert.Contains(t, tees[0].String(), strings.Repeat("x", 1000))
+}
+
+func TestResponseTeeWriteError(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", infoResponseBody)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithResponseTee(func(context.Context, string) io.WriteCloser {
+		return failingWriter{}
+	})))
+	err := client.Do(context.Background(), "Info", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, io.ErrShortWrite)
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, io.ErrShortWrite }
+func (failingWriter) Close() error              { return nil }
@@ -0,0 +1,138 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the cooperation with servers throttling their clients: the time a fault asks to wait before
+// the next call replaces the retry backoff and pauses all calls sharing the rate limiter.
+
+// RetryAfterFunc returns the time the server asked to wait before the next call in the fault f, 0 if none.
+type RetryAfterFunc func(f *Fault) time.Duration
+
+// WithRetryAfter sets the extraction of the retry-after duration of faults. The duration is stored in
+// Fault.RetryAfter, used instead of the backoff of the retry policy and passed to the rate limiter.
+func WithRetryAfter(retryAfter RetryAfterFunc) Option {
+	return func(s *settings) error {
+		s.retryAfter = retryAfter
+		return nil
+	}
+}
+
+// RetryAfterDetailAttr returns a RetryAfterFunc reading the number of seconds from the attribute attr of the
+// first element in the fault detail carrying it, e.g. retryAfterSeconds for
+// <ThrottleInfo retryAfterSeconds="30"/>.
+func RetryAfterDetailAttr(attr string) RetryAfterFunc {
+	return func(f *Fault) time.Duration {
+		if f.DetailInternal == nil {
+			return 0
+		}
+		dec := xml.NewDecoder(strings.NewReader(f.DetailInternal.Content))
+		for {
+			token, err := dec.Token()
+			if err != nil {
+				return 0
+			}
+			start, ok := token.(xml.StartElement)
+			if !ok {
+				continue
+			}
+			for _, a := range start.Attr {
+				if a.Name.Local != attr {
+					continue
+				}
+				seconds, err := strconv.ParseFloat(strings.TrimSpace(a.Value), 64)
+				if err != nil || seconds <= 0 {
+					return 0
+				}
+				return time.Duration(seconds * float64(time.Second))
+			}
+		}
+	}
+}
+
+// RateLimiter paces the attempts of the calls it is shared by.
+type RateLimiter interface {
+	// Wait blocks until an attempt may be sent or ctx is done.
+	Wait(ctx context.Context) error
+	// Pause holds back all attempts until the time until, as the server asked to wait.
+	Pause(until time.Time)
+}
+
+// WithRateLimiter makes every attempt wait for the limiter, and pauses it when a fault carries a
+// retry-after duration, see WithRetryAfter.
+func WithRateLimiter(limiter RateLimiter) Option {
+	return func(s *settings) error {
+		s.limiter = limiter
+		return nil
+	}
+}
+
+// Cooldown is a RateLimiter that does not limit the rate, but holds back all attempts while paused.
+type Cooldown struct {
+	clock Clock
+
+	mu    sync.Mutex
+	until time.Time
+}
+
+// NewCooldown returns a Cooldown using clock, the system clock if nil.
+func NewCooldown(clock Clock) *Cooldown {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &Cooldown{clock: clock}
+}
+
+// Wait blocks while the cooldown is paused.
+func (c *Cooldown) Wait(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		d := c.until.Sub(c.clock.Now())
+		c.mu.Unlock()
+		if d <= 0 {
+			return nil
+		}
+		if err := sleep(ctx, c.clock, d); err != nil {
+			return err
+		}
+	}
+}
+
+// Pause holds back all attempts until the time until. An earlier time does not shorten a pause.
+func (c *Cooldown) Pause(until time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if until.After(c.until) {
+		c.until = until
+	}
+}
+
+// waitLimiter waits for the rate limiter before an attempt.
+func (s *settings) waitLimiter(ctx context.Context) error {
+	if s.limiter == nil {
+		return nil
+	}
+	return s.limiter.Wait(ctx)
+}
+
+// throttle records the retry-after duration of the fault in err and pauses the rate limiter. It returns the
+// duration, 0 if there is none.
+func (s *settings) throttle(err error) time.Duration {
+	var fault *Fault
+	if s.retryAfter == nil || !errors.As(err, &fault) {
+		return 0
+	}
+	fault.RetryAfter = s.retryAfter(fault)
+	if fault.RetryAfter > 0 && s.limiter != nil {
+		s.limiter.Pause(s.timeSource().Now().Add(fault.RetryAfter))
+	}
+	return fault.RetryAfter
+}
@@ -0,0 +1,104 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const throttleFaultBody = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>
+<faultcode>soap:Client.RateLimited</faultcode><faultstring>slow down</faultstring>
+<detail><p:ThrottleInfo xmlns:p="urn:provider" retryAfterSeconds="30"/></detail>
+</soap:Fault></soap:Body></soap:Envelope>`
+
+// newThrottlingServer answers the first throttled requests with a throttling fault.
+func newThrottlingServer(t *testing.T, throttled int) (*httptest.Server, *int) {
+	t.Helper()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/xml")
+		if requests <= throttled {
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(throttleFaultBody))
+			return
+		}
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestRetryAfterDetailAttr(t *testing.T) {
+	tests := []struct {
+		name   string
+		detail string
+		want   time.Duration
+	}{
+		{name: "nested", detail: `<a><p:ThrottleInfo xmlns:p="urn:p" retryAfterSeconds="30"/></a>`, want: 30 * time.Second},
+		{name: "fraction", detail: `<ThrottleInfo retryAfterSeconds=" 1.5 "/>`, want: 1500 * time.Millisecond},
+		{name: "missing", detail: `<ThrottleInfo/>`},
+		{name: "invalid", detail: `<ThrottleInfo retryAfterSeconds="soon"/>`},
+		{name: "negative", detail: `<ThrottleInfo retryAfterSeconds="-1"/>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &Fault{DetailInternal: &faultDetail{Content: tt.detail}}
+			assert.Equal(t, tt.want, RetryAfterDetailAttr("retryAfterSeconds")(f))
+		})
+	}
+	assert.Zero(t, RetryAfterDetailAttr("retryAfterSeconds")(&Fault{}))
+}
+
+func TestRetryAfterReplacesBackoff(t *testing.T) {
+	srv, requests := newThrottlingServer(t, 1)
+	clock := &manualClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	policy := RetryPolicy{MaxAttempts: 2, Backoff: func(int) time.Duration { return time.Hour }}
+
+	var info ResponseInfo
+	err := NewClient(srv.URL).Do(context.Background(), "CreateOrder", &infoRequest{}, &infoResponse{}, WithClock(clock),
+		WithRetry(policy), WithRetryAfter(RetryAfterDetailAttr("retryAfterSeconds")), WithResponseInfo(&info))
+	assert.NoError(t, err)
+	// retried although neither idempotent nor classified as throttled
+	assert.Equal(t, 2, *requests)
+	assert.Equal(t, 30*time.Second, info.Duration)
+}
+
+func TestRetryAfterPausesLimiter(t *testing.T) {
+	srv, requests := newThrottlingServer(t, 1)
+	clock := &manualClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+	cooldown := NewCooldown(clock)
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithClock(clock), WithRateLimiter(cooldown),
+		WithRetryAfter(RetryAfterDetailAttr("retryAfterSeconds"))))
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	var fault *Fault
+	if assert.ErrorAs(t, err, &fault) {
+		assert.Equal(t, 30*time.Second, fault.RetryAfter)
+	}
+
+	// the next call waits for the cooldown
+	assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, 2, *requests)
+	assert.Equal(t, time.Date(2021, 1, 1, 0, 0, 30, 0, time.UTC), clock.Now())
+}
+
+func TestCooldown(t *testing.T) {
+	cooldown := NewCooldown(nil)
+	assert.NoError(t, cooldown.Wait(context.Background()))
+
+	// a shorter pause does not shorten the cooldown
+	until := time.Now().Add(time.Hour)
+	cooldown.Pause(until)
+	cooldown.Pause(time.Now().Add(time.Second))
+	assert.Equal(t, until, cooldown.until)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, cooldown.Wait(ctx), context.DeadlineExceeded)
+}
@@ -0,0 +1,44 @@
+package soap
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimestampPrecision is the number of fractional second digits of the times of WS-Security headers, for
+// validators insisting on one: wsu:Created and wsu:Expires of the wsu:Timestamp, see SigningOptions.
+type TimestampPrecision int
+
+const (
+	// TimestampMilliseconds writes three fractional digits, 2024-01-02T03:04:05.123Z. It is the default.
+	TimestampMilliseconds TimestampPrecision = iota
+	// TimestampSeconds writes no fractional digits, 2024-01-02T03:04:05Z.
+	TimestampSeconds
+	// TimestampMicroseconds writes six fractional digits, 2024-01-02T03:04:05.123456Z.
+	TimestampMicroseconds
+)
+
+// Format formats t in UTC with the precision, truncating the digits beyond it. It is meant for the times of
+// headers built by the application, e.g. the wsu:Created of a UsernameToken, to match the wsu:Timestamp.
+func (p TimestampPrecision) Format(t time.Time) string {
+	layout := "2006-01-02T15:04:05.000Z"
+	switch p {
+	case TimestampSeconds:
+		layout = "2006-01-02T15:04:05Z"
+	case TimestampMicroseconds:
+		layout = "2006-01-02T15:04:05.000000Z"
+	}
+	return t.UTC().Format(layout)
+}
+
+// ParseTimestamp parses the time of a WS-Security header, e.g. the wsu:Created of a timestamp received, in any
+// of the precisions of the vendors: with or without fractional digits, up to nanoseconds, and with a trailing
+// Z, a time zone offset or none, which is taken as UTC.
+func ParseTimestamp(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
@@ -0,0 +1,56 @@
+package soap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimestampPrecision(t *testing.T) {
+	envelope := `<s:Envelope xmlns:s="` + soapEnvNS + `"><s:Body><Order xmlns="urn:orders"/></s:Body></s:Envelope>`
+	tests := []struct {
+		precision TimestampPrecision
+		want      string
+	}{
+		{TimestampMilliseconds, "<wsu:Created>2021-01-01T00:00:00.123Z</wsu:Created><wsu:Expires>2021-01-01T00:00:10.123Z</wsu:Expires>"},
+		{TimestampSeconds, "<wsu:Created>2021-01-01T00:00:00Z</wsu:Created><wsu:Expires>2021-01-01T00:00:10Z</wsu:Expires>"},
+		{TimestampMicroseconds, "<wsu:Created>2021-01-01T00:00:00.123456Z</wsu:Created><wsu:Expires>2021-01-01T00:00:10.123456Z</wsu:Expires>"},
+	}
+	for _, tt := range tests {
+		cfg := securityConfig(t)
+		cfg.Created = time.Date(2021, 1, 1, 1, 0, 0, 123456789, time.FixedZone("CET", 3600))
+		cfg.Signing.TimestampPrecision = tt.precision
+		signed, err := ApplySecurity([]byte(envelope), cfg)
+		require.NoError(t, err)
+		assert.Contains(t, string(signed), tt.want)
+		assert.NoError(t, VerifySignature(signed, VerifyOptions{CurrentTime: cfg.Created}))
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	want := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2021-01-01T00:00:00Z", want},
+		{"2021-01-01T00:00:00.123Z", want.Add(123 * time.Millisecond)},
+		{"2021-01-01T00:00:00.123456Z", want.Add(123456 * time.Microsecond)},
+		{"2021-01-01T00:00:00.123456789Z", want.Add(123456789)},
+		{"2021-01-01T01:00:00.5+01:00", want.Add(500 * time.Millisecond)},
+		{"2021-01-01T00:00:00.000", want},
+		{"2021-01-01T00:00:00", want},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimestamp(tt.in)
+		if assert.NoError(t, err, tt.in) {
+			assert.True(t, tt.want.Equal(got), "%s: %s", tt.in, got)
+		}
+	}
+	for _, in := range []string{"", "2021-01-01", "2021-01-01 00:00:00Z", "2021-01-01T00:00:00.Z"} {
+		_, err := ParseTimestamp(in)
+		assert.Error(t, err, in)
+	}
+}
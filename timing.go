@@ -0,0 +1,162 @@
+package soap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Implements the per-phase timing of attempts using httptrace.
+// Timings are only recorded if the call collects statistics, otherwise no trace hooks are installed.
+
+// Timings holds the durations of the phases of a single attempt. Phases that did not take place, like DNS
+// and connecting on a reused connection, are zero.
+type Timings struct {
+	// DNS is the duration of the DNS lookup.
+	DNS time.Duration
+	// Connect is the duration of establishing the TCP connection.
+	Connect time.Duration
+	// TLSHandshake is the duration of the TLS handshake.
+	TLSHandshake time.Duration
+	// TimeToFirstByte is the time from writing the request until the first response byte arrived.
+	TimeToFirstByte time.Duration
+	// Download is the time from the first response byte until the response was read.
+	Download time.Duration
+	// Total is the duration of the attempt.
+	Total time.Duration
+	// Reused is set if the attempt was sent on a reused connection.
+	Reused bool
+}
+
+// TimeoutError is returned if an attempt timed out. It names the phase that was in progress.
+type TimeoutError struct {
+	Err error
+	// Phase is the phase in progress when the attempt timed out, e.g. "TLS handshake".
+	Phase string
+	// Elapsed is the time spent in Phase.
+	Elapsed time.Duration
+	// Timings are the timings of the attempt.
+	Timings Timings
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%v (%s took %s)", e.Err, e.Phase, e.Elapsed.Round(time.Millisecond))
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// attemptTimer records the timings of an attempt. The trace hooks may run concurrently.
+type attemptTimer struct {
+	mu         sync.Mutex
+	clock      Clock
+	start      time.Time
+	phase      string
+	phaseStart time.Time
+	firstByte  time.Time
+	timings    Timings
+}
+
+func newAttemptTimer(clock Clock) *attemptTimer {
+	now := clock.Now()
+	return &attemptTimer{clock: clock, start: now, phase: "sending request", phaseStart: now}
+}
+
+// begin marks the start of phase.
+func (t *attemptTimer) begin(phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.phase, t.phaseStart = phase, t.clock.Now()
+}
+
+// end records the duration of the phase started last into d.
+func (t *attemptTimer) end(d *time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.clock.Now()
+	*d = now.Sub(t.phaseStart)
+	t.phase, t.phaseStart = "sending request", now
+}
+
+// trace returns the client trace feeding the timer.
+func (t *attemptTimer) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:          func(httptrace.DNSStartInfo) { t.begin("DNS lookup") },
+		DNSDone:           func(httptrace.DNSDoneInfo) { t.end(&t.timings.DNS) },
+		ConnectStart:      func(string, string) { t.begin("connect") },
+		ConnectDone:       func(string, string, error) { t.end(&t.timings.Connect) },
+		TLSHandshakeStart: func() { t.begin("TLS handshake") },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { t.end(&t.timings.TLSHandshake) },
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.timings.Reused = info.Reused
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { t.begin("waiting for response") },
+		GotFirstResponseByte: func() {
+			t.end(&t.timings.TimeToFirstByte)
+			t.begin("download")
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			t.firstByte = t.phaseStart
+		},
+	}
+}
+
+// stop finishes the attempt and returns its timings. A timeout err is wrapped into a *TimeoutError.
+func (t *attemptTimer) stop(err error) (Timings, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.clock.Now()
+	if !t.firstByte.IsZero() {
+		t.timings.Download = now.Sub(t.firstByte)
+	}
+	t.timings.Total = now.Sub(t.start)
+	if timeout(err) {
+		err = &TimeoutError{Err: err, Phase: t.phase, Elapsed: now.Sub(t.phaseStart), Timings: t.timings}
+	}
+	return t.timings, err
+}
+
+// timeout reports whether err is a deadline or network timeout.
+func timeout(err error) bool {
+	if err == nil {
+		return false
+	}
+	// an HTTPError reports gateway timeouts of the server as well
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.localTimeout()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// startTimer starts recording the timings of the current attempt if the call collects statistics.
+func (cl *call) startTimer() {
+	cl.timer = nil
+	if cl.info != nil {
+		cl.timer = newAttemptTimer(cl.settings.timeSource())
+	}
+}
+
+// stopTimer records the timings of the current attempt, which returned err, and returns err, wrapped into a
+// *TimeoutError on timeouts.
+func (cl *call) stopTimer(err error) error {
+	if cl.timer == nil {
+		return err
+	}
+	timings, err := cl.timer.stop(err)
+	cl.info.Timings = append(cl.info.Timings, timings)
+	cl.timer = nil
+	return err
+}
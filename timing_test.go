@@ -0,0 +1,115 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSlowServer(t *testing.T, delay time.Duration) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server only notices the client going away once the body was read
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestTimings(t *testing.T) {
+	srv := newSlowServer(t, 20*time.Millisecond)
+	client := NewClient(srv.URL)
+
+	var info ResponseInfo
+	var hooked []Timings
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithResponseInfo(&info),
+		WithMetricsHook(func(ctx context.Context, info *ResponseInfo, err error) { hooked = info.Timings }))
+	assert.NoError(t, err)
+	if assert.Len(t, info.Timings, 1) {
+		timings := info.Timings[0]
+		assert.GreaterOrEqual(t, timings.TimeToFirstByte, 20*time.Millisecond)
+		assert.GreaterOrEqual(t, timings.Total, timings.TimeToFirstByte+timings.Download)
+		assert.GreaterOrEqual(t, info.Duration, timings.Total)
+		assert.Zero(t, timings.TLSHandshake)
+	}
+	assert.Equal(t, info.Timings, hooked)
+}
+
+func TestTimingsPerAttempt(t *testing.T) {
+	srv, _ := newFlakyServer(t, 1, http.StatusServiceUnavailable)
+	client := NewClient(srv.URL)
+
+	var info ResponseInfo
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+		WithRetry(fastRetry), MarkIdempotent("GetInfo"), WithResponseInfo(&info))
+	assert.NoError(t, err)
+	if assert.Len(t, info.Timings, 2) {
+		assert.False(t, info.Timings[0].Reused)
+		assert.True(t, info.Timings[1].Reused)
+		assert.Zero(t, info.Timings[1].Connect)
+	}
+}
+
+func TestTimeoutPhase(t *testing.T) {
+	srv := newSlowServer(t, time.Second)
+
+	// a listener accepting connections but never completing the TLS handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	tests := []struct {
+		name  string
+		url   string
+		phase string
+	}{
+		{name: "server", url: srv.URL, phase: "waiting for response"},
+		{name: "tls", url: "https://" + l.Addr().String(), phase: "TLS handshake"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			var info ResponseInfo
+			err := NewClient(tt.url).Do(ctx, "GetInfo", &infoRequest{}, &infoResponse{}, WithResponseInfo(&info))
+			assert.ErrorIs(t, err, context.DeadlineExceeded)
+			var timeoutErr *TimeoutError
+			if assert.True(t, errors.As(err, &timeoutErr)) {
+				assert.Equal(t, tt.phase, timeoutErr.Phase)
+				assert.Contains(t, err.Error(), tt.phase+" took ")
+				assert.GreaterOrEqual(t, timeoutErr.Elapsed, 40*time.Millisecond)
+			}
+		})
+	}
+
+	// without statistics there is no tracing
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = NewClient(srv.URL).Do(ctx, "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	var timeoutErr *TimeoutError
+	assert.False(t, errors.As(err, &timeoutErr))
+}
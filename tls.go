@@ -0,0 +1,173 @@
+package soap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Implements the TLS settings of the transport: trusted roots, client certificates for mutual TLS and
+// pinning of the server certificate by the SHA-256 hash of its public key (SPKI). Pinning is checked against
+// the chains built by the regular verification, so the pins restrict the trusted certificates further and
+// certificates presented by the server outside of them are not considered. The options only apply to the
+// transport created by Client.SetOptions, with a custom http.Client or passed to a single call they fail with
+// ErrTransportOption instead of being ignored.
+
+var (
+	// ErrCertificatePinMismatch is returned if no certificate presented by the server matches a pin.
+	ErrCertificatePinMismatch = errors.New("certificate pin mismatch")
+)
+
+// CertificatePinError is returned if no certificate presented by the server matches a pin of
+// WithCertificatePinning. It carries the hashes of the presented chain, e.g. to diagnose a certificate rotation.
+type CertificatePinError struct {
+	// Observed are the SHA-256 hashes of the public keys of the certificates of the verified chains, leaf first.
+	Observed [][]byte
+}
+
+func (e *CertificatePinError) Error() string {
+	observed := make([]string, len(e.Observed))
+	for i, h := range e.Observed {
+		observed[i] = "sha256/" + base64.StdEncoding.EncodeToString(h)
+	}
+	return fmt.Sprintf("%s: observed %s", ErrCertificatePinMismatch, strings.Join(observed, ", "))
+}
+
+func (e *CertificatePinError) Unwrap() error {
+	return ErrCertificatePinMismatch
+}
+
+// tlsSettings configures the TLS client of the transport.
+type tlsSettings struct {
+	rootCAs      *x509.CertPool
+	certificates []tls.Certificate
+	pins         [][]byte
+	leafPins     [][]byte
+	serverName   string
+}
+
+// equal reports whether t and o configure TLS clients the same. Client certificates are compared by their
+// chains.
+func (t tlsSettings) equal(o tlsSettings) bool {
+	sameRoots := t.rootCAs == o.rootCAs || t.rootCAs != nil && o.rootCAs != nil && t.rootCAs.Equal(o.rootCAs)
+	sameCertificates := slices.EqualFunc(t.certificates, o.certificates, func(a, b tls.Certificate) bool {
+		return slices.EqualFunc(a.Certificate, b.Certificate, bytes.Equal)
+	})
+	return sameRoots && sameCertificates && slices.EqualFunc(t.pins, o.pins, bytes.Equal) &&
+		slices.EqualFunc(t.leafPins, o.leafPins, bytes.Equal) && t.serverName == o.serverName
+}
+
+// WithRootCAs verifies the server certificate against roots instead of the system roots.
+func WithRootCAs(roots *x509.CertPool) Option {
+	return func(s *settings) error {
+		s.transport.set = true
+		s.transport.tls.rootCAs = roots
+		return nil
+	}
+}
+
+// WithClientCertificate presents cert to servers requesting a client certificate (mutual TLS).
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(s *settings) error {
+		s.transport.set = true
+		s.transport.tls.certificates = append(s.transport.tls.certificates[:len(s.transport.tls.certificates):len(s.transport.tls.certificates)], cert)
+		return nil
+	}
+}
+
+// WithTLSServerName sends name as server name (SNI) in the TLS handshake and verifies the server certificate
+// against it instead of the host of the URL, e.g. to call a service by IP address with the certificate of its
+// public host name. Use it with WithHostOverride for servers routing on the Host header. Unlike the host override
+// it cannot be passed to a single call, the handshake is made by the pooled transport of the client.
+func WithTLSServerName(name string) Option {
+	return func(s *settings) error {
+		s.transport.set = true
+		s.transport.tls.serverName = name
+		return nil
+	}
+}
+
+// WithCertificatePinning accepts servers only if a certificate of the verified chain has the public key hash
+// of one of the pins, the SHA-256 hash of the DER-encoded SubjectPublicKeyInfo. Pinning the leaf and a spare key
+// allows to rotate the certificate. A mismatch fails the connection with a *CertificatePinError.
+func WithCertificatePinning(spkiSHA256 ...[]byte) Option {
+	return func(s *settings) error {
+		for _, pin := range spkiSHA256 {
+			if len(pin) != sha256.Size {
+				return fmt.Errorf("certificate pin of %d bytes is not a SHA-256 hash", len(pin))
+			}
+		}
+		s.transport.set = true
+		s.transport.tls.pins = append(s.transport.tls.pins[:len(s.transport.tls.pins):len(s.transport.tls.pins)], spkiSHA256...)
+		return nil
+	}
+}
+
+// WithLeafCertificatePinning is like WithCertificatePinning, but only the leaf certificate of the server can
+// match the pins, not the intermediate or root certificates of its chain.
+func WithLeafCertificatePinning(spkiSHA256 ...[]byte) Option {
+	return func(s *settings) error {
+		for _, pin := range spkiSHA256 {
+			if len(pin) != sha256.Size {
+				return fmt.Errorf("certificate pin of %d bytes is not a SHA-256 hash", len(pin))
+			}
+		}
+		s.transport.set = true
+		s.transport.tls.leafPins = append(s.transport.tls.leafPins[:len(s.transport.tls.leafPins):len(s.transport.tls.leafPins)],
+			spkiSHA256...)
+		return nil
+	}
+}
+
+// SPKIHash returns the SHA-256 hash of the public key of cert as used by WithCertificatePinning.
+func SPKIHash(cert *x509.Certificate) []byte {
+	h := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return h[:]
+}
+
+// config returns the TLS client configuration, nil if the defaults apply.
+func (t tlsSettings) config() *tls.Config {
+	pinned := len(t.pins) > 0 || len(t.leafPins) > 0
+	if t.rootCAs == nil && len(t.certificates) == 0 && !pinned && t.serverName == "" {
+		return nil
+	}
+	cfg := &tls.Config{RootCAs: t.rootCAs, Certificates: t.certificates, ServerName: t.serverName}
+	if pinned {
+		cfg.VerifyPeerCertificate = t.verifyPins
+	}
+	return cfg
+}
+
+// verifyPins checks the verified chains against the pins. The certificates the server presented are not used,
+// a server could add any certificate with a pinned key.
+func (t tlsSettings) verifyPins(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+	var observed [][]byte
+	for _, chain := range verifiedChains {
+		for i, cert := range chain {
+			hash := SPKIHash(cert)
+			if containsPin(t.pins, hash) || i == 0 && containsPin(t.leafPins, hash) {
+				return nil
+			}
+			if !containsPin(observed, hash) {
+				observed = append(observed, hash)
+			}
+		}
+	}
+	return &CertificatePinError{Observed: observed}
+}
+
+// containsPin reports whether hash is one of pins.
+func containsPin(pins [][]byte, hash []byte) bool {
+	for _, pin := range pins {
+		if bytes.Equal(pin, hash) {
+			return true
+		}
+	}
+	return false
+}
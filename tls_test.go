@@ -0,0 +1,294 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTLSInfoServer answers with the info response over TLS, requiring a client certificate if clientAuth is set.
+func newTLSInfoServer(t *testing.T, clientAuth bool) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	if clientAuth {
+		srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCertificatePinning(t *testing.T) {
+	srv := newTLSInfoServer(t, false)
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	pin := SPKIHash(srv.Certificate())
+	other := bytes.Repeat([]byte{1}, 32)
+
+	tests := []struct {
+		name    string
+		options []Option
+		err     error
+	}{
+		{name: "roots only", options: []Option{WithRootCAs(roots)}},
+		{name: "pinned", options: []Option{WithRootCAs(roots), WithCertificatePinning(pin)}},
+		{name: "spare pin", options: []Option{WithRootCAs(roots), WithCertificatePinning(other, pin)}},
+		{name: "mismatch", options: []Option{WithRootCAs(roots), WithCertificatePinning(other)}, err: ErrCertificatePinMismatch},
+		{name: "untrusted root", options: []Option{WithCertificatePinning(pin)}, err: &tls.CertificateVerificationError{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(srv.URL)
+			assert.NoError(t, client.SetOptions(tt.options...))
+			err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+			switch want := tt.err.(type) {
+			case nil:
+				assert.NoError(t, err)
+			case *tls.CertificateVerificationError:
+				assert.ErrorAs(t, err, &want)
+			default:
+				assert.ErrorIs(t, err, want)
+			}
+		})
+	}
+}
+
+func TestCertificatePinError(t *testing.T) {
+	srv := newTLSInfoServer(t, false)
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithRootCAs(roots), WithCertificatePinning(bytes.Repeat([]byte{1}, 32))))
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	var pinErr *CertificatePinError
+	if assert.ErrorAs(t, err, &pinErr) {
+		assert.Equal(t, [][]byte{SPKIHash(srv.Certificate())}, pinErr.Observed)
+		assert.Contains(t, err.Error(), "sha256/")
+	}
+
+	assert.Error(t, client.SetOptions(WithCertificatePinning([]byte("short"))))
+}
+
+func TestCertificatePinningNotApplied(t *testing.T) {
+	srv := newTLSInfoServer(t, false)
+	bogus := WithCertificatePinning(bytes.Repeat([]byte{1}, 32))
+
+	client := NewClient(srv.URL)
+	client.SettHTTPClient(srv.Client())
+	assert.ErrorIs(t, client.SetOptions(bogus), ErrTransportOption)
+	assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+
+	// set before the client
+	client = NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(bogus))
+	client.SettHTTPClient(srv.Client())
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, ErrTransportOption)
+
+	// passed to a single call
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	client = NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithRootCAs(roots)))
+	err = client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, bogus)
+	assert.ErrorIs(t, err, ErrTransportOption)
+	assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	// closing the connection applies to a single request
+	assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithConnectionPerRequest()))
+}
+
+func TestClientCertificatePinning(t *testing.T) {
+	srv := newTLSInfoServer(t, true)
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	cert, err := tls.LoadX509KeyPair("./testdata/cert.pem", "./testdata/key.pem")
+	assert.NoError(t, err)
+
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithRootCAs(roots), WithCertificatePinning(SPKIHash(srv.Certificate()))))
+	assert.Error(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+
+	assert.NoError(t, client.SetOptions(WithClientCertificate(cert)))
+	assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+}
+
+// newChainTLSServer answers with the info response over TLS with a leaf certificate for 127.0.0.1 issued by a
+// generated root, followed by the extra certificates. It returns the roots trusting it, the leaf and the root.
+func newChainTLSServer(t *testing.T, extra ...[]byte) (*httptest.Server, *x509.CertPool, *x509.Certificate,
+	*x509.Certificate) {
+	t.Helper()
+	rootKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rootTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	rootDER, err := x509.CreateCertificate(rand.Reader, rootTemplate, rootTemplate, &rootKey.PublicKey, rootKey)
+	require.NoError(t, err)
+	root, err := x509.ParseCertificate(rootDER)
+	require.NoError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, root, &key.PublicKey, rootKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: append([][]byte{der}, extra...), PrivateKey: key}}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, roots, leaf, root
+}
+
+func TestCertificatePinningVerifiedChain(t *testing.T) {
+	// an unrelated certificate with the pinned key, sent along with the chain
+	pinned, _, _, _ := newChainTLSServer(t)
+	srv, roots, leaf, root := newChainTLSServer(t, pinned.TLS.Certificates[0].Certificate[0])
+	pin := SPKIHash(pinned.Certificate())
+
+	tests := []struct {
+		name    string
+		options []Option
+		err     bool
+	}{
+		{name: "extra certificate", options: []Option{WithCertificatePinning(pin)}, err: true},
+		{name: "extra certificate as leaf", options: []Option{WithLeafCertificatePinning(pin)}, err: true},
+		{name: "root", options: []Option{WithCertificatePinning(SPKIHash(root))}},
+		{name: "leaf", options: []Option{WithCertificatePinning(SPKIHash(leaf))}},
+		{name: "leaf only", options: []Option{WithLeafCertificatePinning(SPKIHash(leaf))}},
+		{name: "root as leaf", options: []Option{WithLeafCertificatePinning(SPKIHash(root))}, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(srv.URL)
+			require.NoError(t, client.SetOptions(append(tt.options, WithRootCAs(roots))...))
+			err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+			if !tt.err {
+				assert.NoError(t, err)
+				return
+			}
+			var pinErr *CertificatePinError
+			if assert.ErrorAs(t, err, &pinErr) {
+				assert.Equal(t, [][]byte{SPKIHash(leaf), SPKIHash(root)}, pinErr.Observed)
+			}
+		})
+	}
+	assert.Error(t, NewClient(srv.URL).SetOptions(WithLeafCertificatePinning([]byte("short"))))
+}
+
+// newNamedTLSServer answers with the info response over TLS with a self-signed certificate for name only, and
+// returns the roots trusting it and the Host headers and server names of the requests.
+func newNamedTLSServer(t *testing.T, name string) (*httptest.Server, *x509.CertPool, *[]string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	var seen []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = append(seen, r.Host+" "+r.TLS.ServerName)
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv, roots, &seen
+}
+
+func TestTLSServerName(t *testing.T) {
+	srv, roots, seen := newNamedTLSServer(t, "soap.example.com")
+
+	// the certificate is not valid for the address dialed
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithRootCAs(roots), WithHostOverride("soap.example.com")))
+	var verifyErr *tls.CertificateVerificationError
+	assert.ErrorAs(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}), &verifyErr)
+	assert.Empty(t, *seen)
+
+	client = NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithRootCAs(roots), WithTLSServerName("soap.example.com")))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+		WithHostOverride("soap.example.com:8443")))
+	assert.Equal(t, []string{srv.Listener.Addr().String() + " soap.example.com", "soap.example.com:8443 soap.example.com"}, *seen)
+
+	// the certificate is verified against the name
+	client = NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithRootCAs(roots), WithTLSServerName("other.example.com")))
+	assert.ErrorAs(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}), &verifyErr)
+}
+
+func TestTLSServerNameNotApplied(t *testing.T) {
+	srv, roots, seen := newNamedTLSServer(t, "soap.example.com")
+
+	// a per call server name would not change the handshake of the pooled transport
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithRootCAs(roots)))
+	serverName := WithTLSServerName("soap.example.com")
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, serverName)
+	assert.ErrorIs(t, err, ErrTransportOption)
+	err = client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithRootCAs(x509.NewCertPool()))
+	assert.ErrorIs(t, err, ErrTransportOption)
+
+	// nor the one of a custom http.Client
+	client = NewClient(srv.URL)
+	client.SettHTTPClient(&http.Client{})
+	assert.ErrorIs(t, client.SetOptions(WithTLSServerName("soap.example.com")), ErrTransportOption)
+	assert.ErrorIs(t, client.SetOptions(WithRootCAs(roots)), ErrTransportOption)
+	assert.ErrorIs(t, client.SetOptions(WithClientCertificate(tls.Certificate{})), ErrTransportOption)
+	assert.Empty(t, *seen)
+}
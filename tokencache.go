@@ -0,0 +1,265 @@
+package soap
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Implements caches for security tokens and login sessions, so short-lived processes and the replicas of a
+// service can share a token instead of fetching their own.
+
+var (
+	// ErrInvalidCacheKey is returned by NewFileTokenCache if the encryption key is not 16, 24 or 32 bytes long.
+	ErrInvalidCacheKey = errors.New("token cache key must be 16, 24 or 32 bytes")
+)
+
+// Token is a cached security token or session.
+type Token struct {
+	// Value is the token, e.g. the serialized SAML assertion issued by an STS or a session id.
+	Value string `json:"value"`
+	// Expires is the time the token expires at, the zero time if it does not expire.
+	Expires time.Time `json:"expires"`
+}
+
+// Expired reports whether the token has expired at now.
+func (t Token) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && !now.Before(t.Expires)
+}
+
+// TokenCache stores tokens by key. Get never returns expired tokens, implementations prune them. A cache is
+// used concurrently.
+type TokenCache interface {
+	Get(key string) (Token, bool)
+	Put(key string, token Token)
+	Delete(key string)
+}
+
+// TokenCacheKey returns the cache key of the token of username at endpoint, with optional further scope
+// such as the applies-to address of an issued token. Keys of different endpoints or users never collide.
+func TokenCacheKey(endpoint, username string, scope ...string) string {
+	h := sha256.New()
+	for _, part := range append([]string{endpoint, username}, scope...) {
+		// quoted, so the parts cannot run into each other
+		_ = json.NewEncoder(h).Encode(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CachedToken returns the token cached under key, or calls fetch and caches the token it returns. Wire the
+// token into WithReauthenticate by deleting it from the cache there, so the next call fetches a new one.
+func CachedToken(ctx context.Context, cache TokenCache, key string, fetch func(ctx context.Context) (Token, error)) (Token, error) {
+	if token, ok := cache.Get(key); ok {
+		return token, nil
+	}
+	token, err := fetch(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	cache.Put(key, token)
+	return token, nil
+}
+
+// MemoryTokenCache is a TokenCache in memory. The zero value is an empty cache.
+type MemoryTokenCache struct {
+	// Clock is the source of time to expire tokens, the system clock if nil.
+	Clock Clock
+
+	mu     sync.Mutex
+	tokens map[string]Token
+}
+
+// NewMemoryTokenCache returns an empty in-memory cache.
+func NewMemoryTokenCache() *MemoryTokenCache {
+	return &MemoryTokenCache{tokens: map[string]Token{}}
+}
+
+func (c *MemoryTokenCache) Get(key string) (Token, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	token, ok := c.tokens[key]
+	if ok && token.Expired(clockNow(c.Clock)) {
+		delete(c.tokens, key)
+		return Token{}, false
+	}
+	return token, ok
+}
+
+// Put stores token under key, pruning all expired tokens.
+func (c *MemoryTokenCache) Put(key string, token Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := clockNow(c.Clock)
+	for k, t := range c.tokens {
+		if t.Expired(now) {
+			delete(c.tokens, k)
+		}
+	}
+	if token.Expired(now) {
+		delete(c.tokens, key)
+		return
+	}
+	if c.tokens == nil {
+		c.tokens = map[string]Token{}
+	}
+	c.tokens[key] = token
+}
+
+func (c *MemoryTokenCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.tokens, key)
+}
+
+// FileTokenCache is a TokenCache storing every token in a file of a directory, encrypted with AES-GCM. The
+// file names are hashes of the keys, so neither keys nor tokens can be read from the directory. Processes
+// sharing the directory and the encryption key share the tokens. Files failing to decrypt are ignored.
+type FileTokenCache struct {
+	// Clock is the source of time to expire tokens, the system clock if nil.
+	Clock Clock
+
+	dir  string
+	aead cipher.AEAD
+}
+
+// NewFileTokenCache returns a cache storing the tokens in dir, which is created if missing, encrypted with
+// key of 16, 24 or 32 bytes for AES-128, AES-192 or AES-256.
+func NewFileTokenCache(dir string, key []byte) (*FileTokenCache, error) {
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return nil, ErrInvalidCacheKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileTokenCache{dir: dir, aead: aead}, nil
+}
+
+// path returns the file of the token stored under key.
+func (c *FileTokenCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".token")
+}
+
+func (c *FileTokenCache) Get(key string) (Token, bool) {
+	path := c.path(key)
+	token, ok := c.read(path)
+	if ok && token.Expired(clockNow(c.Clock)) {
+		_ = os.Remove(path)
+		return Token{}, false
+	}
+	return token, ok
+}
+
+// read decrypts the token in the file at path. The file name is authenticated as additional data, so a file
+// cannot be moved to another key.
+func (c *FileTokenCache) read(path string) (Token, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil || len(data) < c.aead.NonceSize() {
+		return Token{}, false
+	}
+	nonce, sealed := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+	plain, err := c.aead.Open(nil, nonce, sealed, []byte(filepath.Base(path)))
+	if err != nil {
+		return Token{}, false
+	}
+	var token Token
+	if err := json.Unmarshal(plain, &token); err != nil {
+		return Token{}, false
+	}
+	return token, true
+}
+
+// Put stores token under key. The file is replaced atomically, so concurrent readers see the old or the new
+// token. Errors writing the file are ignored, the token is fetched again by the next process.
+func (c *FileTokenCache) Put(key string, token Token) {
+	if token.Expired(clockNow(c.Clock)) {
+		c.Delete(key)
+		return
+	}
+	plain, err := json.Marshal(token)
+	if err != nil {
+		return
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return
+	}
+	path := c.path(key)
+	data := c.aead.Seal(nonce, nonce, plain, []byte(filepath.Base(path)))
+	f, err := os.CreateTemp(c.dir, ".token-*")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+}
+
+func (c *FileTokenCache) Delete(key string) {
+	_ = os.Remove(c.path(key))
+}
+
+// Prune removes the files of expired tokens. The files of tokens stored with another encryption key are
+// removed only if olderThan is positive and they were not modified for that long.
+func (c *FileTokenCache) Prune(olderThan time.Duration) error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	now := clockNow(c.Clock)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".token") {
+			continue
+		}
+		path := filepath.Join(c.dir, e.Name())
+		token, ok := c.read(path)
+		if ok && !token.Expired(now) {
+			continue
+		}
+		if !ok {
+			info, err := e.Info()
+			if err != nil || olderThan <= 0 || now.Sub(info.ModTime()) < olderThan {
+				continue
+			}
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// clockNow returns the time of clock, or of the system clock if nil.
+func clockNow(clock Clock) time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+	return clock.Now()
+}
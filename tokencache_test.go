@@ -0,0 +1,139 @@
+package soap
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenCacheKey(t *testing.T) {
+	key := TokenCacheKey("https://sts.example.com", "alice")
+	assert.Equal(t, key, TokenCacheKey("https://sts.example.com", "alice"))
+	assert.NotEqual(t, key, TokenCacheKey("https://sts.example.com", "bob"))
+	assert.NotEqual(t, key, TokenCacheKey("https://other.example.com", "alice"))
+	assert.NotEqual(t, key, TokenCacheKey("https://sts.example.com", "alice", "urn:orders"))
+	// the parts cannot be shifted into each other
+	assert.NotEqual(t, TokenCacheKey("a", "bc"), TokenCacheKey("ab", "c"))
+}
+
+func TestTokenCache(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	caches := map[string]func(t *testing.T, clock Clock) TokenCache{
+		"memory": func(t *testing.T, clock Clock) TokenCache {
+			return &MemoryTokenCache{Clock: clock}
+		},
+		"file": func(t *testing.T, clock Clock) TokenCache {
+			c, err := NewFileTokenCache(filepath.Join(t.TempDir(), "tokens"), make([]byte, 32))
+			require.NoError(t, err)
+			c.Clock = clock
+			return c
+		},
+	}
+	for name, newCache := range caches {
+		t.Run(name, func(t *testing.T) {
+			clock := &manualClock{now: start}
+			cache := newCache(t, clock)
+
+			_, ok := cache.Get("a")
+			assert.False(t, ok)
+
+			cache.Put("a", Token{Value: "token-a", Expires: start.Add(time.Hour)})
+			cache.Put("b", Token{Value: "token-b"})
+			token, ok := cache.Get("a")
+			assert.True(t, ok)
+			assert.Equal(t, "token-a", token.Value)
+			assert.True(t, token.Expires.Equal(start.Add(time.Hour)))
+
+			// expired tokens are ignored, tokens without expiry are kept
+			clock.NewTimer(time.Hour)
+			_, ok = cache.Get("a")
+			assert.False(t, ok)
+			token, ok = cache.Get("b")
+			assert.True(t, ok)
+			assert.Equal(t, "token-b", token.Value)
+
+			cache.Delete("b")
+			_, ok = cache.Get("b")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestFileTokenCacheShared(t *testing.T) {
+	dir := t.TempDir()
+	key := []byte("0123456789abcdef")
+	first, err := NewFileTokenCache(dir, key)
+	require.NoError(t, err)
+	first.Put("session", Token{Value: "secret-session"})
+
+	// another process with the same key reads the token
+	second, err := NewFileTokenCache(dir, key)
+	require.NoError(t, err)
+	token, ok := second.Get("session")
+	assert.True(t, ok)
+	assert.Equal(t, "secret-session", token.Value)
+
+	// the files hold neither keys nor tokens in the clear
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.NotContains(t, entries[0].Name(), "session")
+	data, err := os.ReadFile(filepath.Join(dir, entries[0].Name()))
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret-session")
+
+	other, err := NewFileTokenCache(dir, []byte("fedcba9876543210"))
+	require.NoError(t, err)
+	_, ok = other.Get("session")
+	assert.False(t, ok)
+
+	_, err = NewFileTokenCache(dir, []byte("short"))
+	assert.ErrorIs(t, err, ErrInvalidCacheKey)
+}
+
+func TestFileTokenCachePrune(t *testing.T) {
+	start := time.Now()
+	clock := &manualClock{now: start}
+	dir := t.TempDir()
+	cache, err := NewFileTokenCache(dir, make([]byte, 16))
+	require.NoError(t, err)
+	cache.Clock = clock
+	cache.Put("expiring", Token{Value: "a", Expires: start.Add(time.Minute)})
+	cache.Put("lasting", Token{Value: "b", Expires: start.Add(2 * time.Hour)})
+	other, err := NewFileTokenCache(dir, make([]byte, 24))
+	require.NoError(t, err)
+	other.Put("foreign", Token{Value: "c"})
+
+	clock.NewTimer(time.Hour)
+	require.NoError(t, cache.Prune(0))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+
+	require.NoError(t, cache.Prune(time.Minute))
+	entries, err = os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+	_, ok := cache.Get("lasting")
+	assert.True(t, ok)
+}
+
+func TestCachedToken(t *testing.T) {
+	cache := NewMemoryTokenCache()
+	fetches := 0
+	fetch := func(ctx context.Context) (Token, error) {
+		fetches++
+		return Token{Value: "issued"}, nil
+	}
+	for i := 0; i < 2; i++ {
+		token, err := CachedToken(context.Background(), cache, "k", fetch)
+		require.NoError(t, err)
+		assert.Equal(t, "issued", token.Value)
+	}
+	assert.Equal(t, 1, fetches)
+}
@@ -0,0 +1,176 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// Implements the end of the decoding of an XML response at the end element of the envelope, for servers
+// appending debug output to the envelope or keeping the connection open. The decoder is given the envelope
+// only, so no decoding waits for the end of the body, and the data following it is drained up to a limit, so
+// the connection is reused.
+
+// maxTrailingData is the number of bytes following the envelope read to drain the body.
+const maxTrailingData = 64 << 10
+
+// documentState is the state of the scan of a documentReader.
+type documentState int
+
+const (
+	docText documentState = iota
+	docOpen
+	docStartTag
+	docEndTag
+	docBang
+	docProcInst
+	docComment
+	docCDATA
+	docDeclaration
+)
+
+// documentReader reads an XML document up to the end element of its root element. The markup is only
+// scanned as far as needed to find the end, the document is checked by its decoder.
+type documentReader struct {
+	br    *bufio.Reader
+	state documentState
+	depth int
+	done  bool
+	// quote is the quote of the attribute value being read, 0 outside of values
+	quote byte
+	// prev and prev2 are the bytes read before the current one
+	prev, prev2 byte
+	// marker holds the bytes following "<!" until the kind of markup is known
+	marker []byte
+	// subset is set within the internal subset of a document type declaration
+	subset bool
+}
+
+func newDocumentReader(rd io.Reader) *documentReader {
+	br, ok := rd.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(rd)
+	}
+	return &documentReader{br: br}
+}
+
+func (d *documentReader) Read(p []byte) (int, error) {
+	if d.done {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if d.br.Buffered() == 0 {
+		if _, err := d.br.Peek(1); err != nil {
+			return 0, err
+		}
+	}
+	data, _ := d.br.Peek(min(d.br.Buffered(), len(p)))
+	n := 0
+	for n < len(data) && !d.done {
+		d.scan(data[n])
+		n++
+	}
+	copy(p, data[:n])
+	_, _ = d.br.Discard(n)
+	return n, nil
+}
+
+// scan advances the state by the byte c.
+func (d *documentReader) scan(c byte) {
+	switch d.state {
+	case docText:
+		if c == '<' {
+			d.state = docOpen
+		}
+	case docOpen:
+		switch c {
+		case '/':
+			d.state = docEndTag
+		case '?':
+			d.state = docProcInst
+		case '!':
+			d.state, d.marker = docBang, d.marker[:0]
+		default:
+			d.state = docStartTag
+		}
+	case docStartTag:
+		switch {
+		case d.quote != 0:
+			if c == d.quote {
+				d.quote = 0
+			}
+		case c == '"' || c == '\'':
+			d.quote = c
+		case c == '>':
+			d.state = docText
+			if d.prev != '/' {
+				d.depth++
+			} else if d.depth == 0 {
+				d.done = true
+			}
+		}
+	case docEndTag:
+		if c == '>' {
+			d.state = docText
+			d.depth--
+			d.done = d.depth <= 0
+		}
+	case docBang:
+		d.marker = append(d.marker, c)
+		switch m := string(d.marker); {
+		case m == "--":
+			d.state = docComment
+		case m == "[CDATA[":
+			d.state = docCDATA
+		case len(m) <= 2 && m == "--"[:len(m)], len(m) <= 7 && m == "[CDATA["[:len(m)]:
+		default:
+			d.state = docDeclaration
+			d.subset = c == '['
+			if c == '>' {
+				d.state = docText
+			}
+		}
+	case docProcInst:
+		if c == '>' && d.prev == '?' {
+			d.state = docText
+		}
+	case docComment:
+		if c == '>' && d.prev == '-' && d.prev2 == '-' {
+			d.state = docText
+		}
+	case docCDATA:
+		if c == '>' && d.prev == ']' && d.prev2 == ']' {
+			d.state = docText
+		}
+	case docDeclaration:
+		switch {
+		case c == '[':
+			d.subset = true
+		case c == ']':
+			d.subset = false
+		case c == '>' && !d.subset:
+			d.state = docText
+		}
+	}
+	d.prev2, d.prev = d.prev, c
+}
+
+// trailing returns the data following the document if it is more than whitespace. If drain is set, the data
+// is read up to maxTrailingData, otherwise only the data read ahead already.
+func (d *documentReader) trailing(drain bool) []byte {
+	if !d.done {
+		return nil
+	}
+	var data []byte
+	if drain {
+		data, _ = io.ReadAll(io.LimitReader(d.br, maxTrailingData))
+	} else {
+		data, _ = d.br.Peek(d.br.Buffered())
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	return bytes.Clone(data)
+}
@@ -0,0 +1,106 @@
+package soap
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrailingData(t *testing.T) {
+	tests := []struct {
+		name     string
+		trailing string
+		want     string
+	}{
+		{name: "newline", trailing: "\r\n"},
+		{name: "text", trailing: "\nDEBUG took 12ms\n", want: "\nDEBUG took 12ms\n"},
+		{name: "second document", trailing: infoResponseBody, want: infoResponseBody},
+		{name: "beyond read-ahead", trailing: strings.Repeat("DEBUG\n", 4000), want: strings.Repeat("DEBUG\n", 4000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := infoResponseBody + tt.trailing
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+				_, _ = w.Write([]byte(body))
+			}))
+			t.Cleanup(srv.Close)
+			client := NewClient(srv.URL)
+			for _, opts := range [][]Option{nil, {WithStrictSequence()}} {
+				var info ResponseInfo
+				resp := &infoResponse{}
+				require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, resp,
+					append(opts, WithResponseInfo(&info))...))
+				assert.Equal(t, []string{"a", "b"}, resp.Items)
+				assert.Equal(t, tt.want, string(info.TrailingData))
+			}
+			// the trailing data was drained, so the connection is reused
+			var info ResponseInfo
+			require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithResponseInfo(&info)))
+			require.NotEmpty(t, info.Timings)
+			assert.True(t, info.Timings[len(info.Timings)-1].Reused)
+
+			resp := &infoResponse{}
+			require.NoError(t, UnmarshalResponse([]byte(infoResponseBody+tt.trailing), resp))
+			assert.Equal(t, []string{"a", "b"}, resp.Items)
+		})
+	}
+}
+
+func TestTrailingKeepAlive(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+		for {
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+			if _, err := w.Write([]byte(" ")); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	// the body never ends, the decoding stops at the end of the envelope
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, opts := range [][]Option{nil, {WithStrictSequence()}} {
+		var info ResponseInfo
+		resp := &infoResponse{}
+		require.NoError(t, NewClient(srv.URL).Do(ctx, "GetInfo", &infoRequest{}, resp, append(opts, WithResponseInfo(&info))...))
+		assert.Equal(t, []string{"a", "b"}, resp.Items)
+		assert.Empty(t, info.TrailingData)
+	}
+}
+
+func TestDocumentReader(t *testing.T) {
+	doc := `<?xml version="1.0"?><!DOCTYPE e [<!ENTITY x "<a>">]><!-- <b> -- > --><e a='>' b="/>">` +
+		`<![CDATA[</e>]]><f/><g x="1"/><?pi </e> ?><h>text > </h></e>`
+	data, err := io.ReadAll(newDocumentReader(strings.NewReader(doc + "<e></e>")))
+	require.NoError(t, err)
+	assert.Equal(t, doc, string(data))
+
+	data, err = io.ReadAll(newDocumentReader(strings.NewReader(`<e/> <f/>`)))
+	require.NoError(t, err)
+	assert.Equal(t, `<e/>`, string(data))
+
+	// truncated documents end at the end of the input
+	d := newDocumentReader(strings.NewReader(`<e><f>`))
+	data, err = io.ReadAll(d)
+	require.NoError(t, err)
+	assert.Equal(t, `<e><f>`, string(data))
+	assert.Nil(t, d.trailing(true))
+}
@@ -0,0 +1,244 @@
+package soap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var (
+	// ErrSharedHTTPClient is returned by clients with WithConnectionPerRequest and a custom http.Client, whose
+	// transport may be shared with other clients and is left alone.
+	ErrSharedHTTPClient = errors.New("connection per request needs a dedicated http.Client")
+	// ErrTransportOption is returned for transport options which cannot take effect: the TLS options of a client
+	// with a custom http.Client and transport options passed to a single call instead of Client.SetOptions.
+	ErrTransportOption = errors.New("transport option cannot be applied")
+)
+
+// transportSettings configures the HTTP transport created for clients without a custom http.Client.
+type transportSettings struct {
+	set               bool
+	h2c               bool
+	idleConnTimeout   time.Duration
+	disableKeepAlives bool
+	// connectionPerRequest closes the connection of every request
+	connectionPerRequest bool
+	tcpKeepAlive         time.Duration
+	tls                  tlsSettings
+}
+
+// equal reports whether the transports built for t and o would be configured the same.
+func (t transportSettings) equal(o transportSettings) bool {
+	return t.set == o.set && t.h2c == o.h2c && t.idleConnTimeout == o.idleConnTimeout &&
+		t.disableKeepAlives == o.disableKeepAlives && t.connectionPerRequest == o.connectionPerRequest &&
+		t.tcpKeepAlive == o.tcpKeepAlive && t.tls.equal(o.tls)
+}
+
+// WithH2C speaks HTTP/2 with prior knowledge (h2c) to http:// URLs instead of HTTP/1.1.
+// Like all transport options it is only effective with Client.SetOptions and without a custom http.Client;
+// passed to a single call it fails the call with ErrTransportOption.
+func WithH2C() Option {
+	return func(s *settings) error {
+		s.transport.set = true
+		s.transport.h2c = true
+		return nil
+	}
+}
+
+// WithIdleConnTimeout closes idle connections after d, which should be shorter than the idle timeout
+// of the server or any proxy in between.
+func WithIdleConnTimeout(d time.Duration) Option {
+	return func(s *settings) error {
+		s.transport.set = true
+		s.transport.idleConnTimeout = d
+		return nil
+	}
+}
+
+// WithDisableKeepAlives uses a new connection for every request.
+func WithDisableKeepAlives() Option {
+	return func(s *settings) error {
+		s.transport.set = true
+		s.transport.disableKeepAlives = true
+		return nil
+	}
+}
+
+// WithConnectionPerRequest sends every request on a new connection closed after the response, like HTTP/1.0
+// clients, for services or proxies mixing up the responses of reused connections. The requests are sent with
+// Connection: close and the keep-alives of the transport of the client are disabled. Clients with a custom
+// http.Client fail with ErrSharedHTTPClient, as its transport may be shared; disable the keep-alives of a
+// dedicated http.Client instead.
+func WithConnectionPerRequest() Option {
+	return func(s *settings) error {
+		s.transport.set = true
+		s.transport.disableKeepAlives = true
+		s.transport.connectionPerRequest = true
+		return nil
+	}
+}
+
+// WithHostOverride sends host as Host header of the requests instead of the host of the URL, e.g. to call a
+// service by IP address through a load balancer routing on the host name. The TLS server name is set with
+// WithTLSServerName.
+func WithHostOverride(host string) Option {
+	return func(s *settings) error {
+		s.hostOverride = host
+		return nil
+	}
+}
+
+// overrideHost sets the Host header of httpReq of WithHostOverride.
+func (s *settings) overrideHost(httpReq *http.Request) {
+	if s.hostOverride != "" {
+		httpReq.Host = s.hostOverride
+	}
+}
+
+// checkSharedClient fails if the connections of requests must be closed or the TLS settings apply and the
+// http.Client was provided by the user, as they are not applied to its transport.
+func (c *Client) checkSharedClient(s *settings) error {
+	if !c.customHTTP {
+		return nil
+	}
+	if s.transport.connectionPerRequest {
+		return fmt.Errorf("%w: disable the keep-alives of the transport of a client used by this client only", ErrSharedHTTPClient)
+	}
+	if s.transport.tls.config() != nil {
+		return fmt.Errorf("%w: TLS options are not applied to a custom http.Client, configure its transport", ErrTransportOption)
+	}
+	return nil
+}
+
+// checkCallTransport fails if the options of a single call changed the transport settings of the client, which
+// only apply to the transport created by Client.SetOptions. WithConnectionPerRequest takes effect for a single
+// call by closing its connection.
+func (c *Client) checkCallTransport(s *settings) error {
+	t, client := s.transport, c.settings.transport
+	if t.connectionPerRequest && !client.connectionPerRequest {
+		t.connectionPerRequest, t.disableKeepAlives = false, client.disableKeepAlives
+	}
+	t.set = client.set
+	if !t.equal(client) {
+		return fmt.Errorf("%w: transport options of a call are not applied, set them with Client.SetOptions", ErrTransportOption)
+	}
+	return nil
+}
+
+// WithTCPKeepAlive sets the interval of TCP keep-alive probes on new connections.
+func WithTCPKeepAlive(d time.Duration) Option {
+	return func(s *settings) error {
+		s.transport.set = true
+		s.transport.tcpKeepAlive = d
+		return nil
+	}
+}
+
+// newTransport creates a transport based on http.DefaultTransport with the configured settings applied.
+func (t transportSettings) newTransport() *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if t.idleConnTimeout > 0 {
+		tr.IdleConnTimeout = t.idleConnTimeout
+	}
+	tr.DisableKeepAlives = t.disableKeepAlives
+	if cfg := t.tls.config(); cfg != nil {
+		tr.TLSClientConfig = cfg
+	}
+	if t.tcpKeepAlive != 0 {
+		dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: t.tcpKeepAlive}
+		tr.DialContext = dialer.DialContext
+	}
+	if t.h2c {
+		var protocols http.Protocols
+		protocols.SetUnencryptedHTTP2(true)
+		protocols.SetHTTP2(true)
+		tr.Protocols = &protocols
+	}
+	return tr
+}
+
+// roundTrip sends httpReq. If it failed on a reused connection before any response was received, the
+// connection was most likely closed by the server while idle and the request is sent once more.
+// The timer receives the timings of the request if not nil.
+func (c *Client) roundTrip(ctx context.Context, httpReq *http.Request, timer *attemptTimer) (*http.Response, error) {
+	var reused bool
+	trace := &httptrace.ClientTrace{}
+	if timer != nil {
+		trace = timer.trace()
+	}
+	var handshakeErr atomic.Bool
+	handshakeDone := trace.TLSHandshakeDone
+	trace.TLSHandshakeDone = func(state tls.ConnectionState, err error) {
+		if err != nil {
+			handshakeErr.Store(true)
+		}
+		if handshakeDone != nil {
+			handshakeDone(state, err)
+		}
+	}
+	gotConn := trace.GotConn
+	trace.GotConn = func(info httptrace.GotConnInfo) {
+		reused = info.Reused
+		if reused {
+			c.pool.reused.Add(1)
+		} else {
+			c.pool.dialed.Add(1)
+		}
+		if gotConn != nil {
+			gotConn(info)
+		}
+	}
+	tracedCtx := httptrace.WithClientTrace(ctx, trace)
+	httpResp, err := c.httpDo(httpReq.WithContext(tracedCtx))
+	if err == nil || handshakeErr.Load() || !reused || !staleConnection(err) || ctx.Err() != nil ||
+		httpReq.GetBody == nil {
+		return httpResp, handshakeError(err, handshakeErr.Load())
+	}
+
+	body, bodyErr := httpReq.GetBody()
+	if bodyErr != nil {
+		return nil, err
+	}
+	// the retry is traced as well, its connection replaces the stale one in the timings
+	retry := httpReq.Clone(tracedCtx)
+	retry.Body = body
+	httpResp, err = c.httpDo(retry)
+	return httpResp, handshakeError(err, handshakeErr.Load())
+}
+
+// handshakeError returns err marked as *tlsHandshakeError if it is the error of a failed TLS handshake.
+func handshakeError(err error, handshakeFailed bool) error {
+	if err != nil && handshakeFailed {
+		return &tlsHandshakeError{err: err}
+	}
+	return err
+}
+
+// httpDo sends req with the HTTP client, counting it as active until its response body is closed.
+func (c *Client) httpDo(req *http.Request) (*http.Response, error) {
+	if c.closed.Load() {
+		return nil, ErrClientClosed
+	}
+	c.pool.active.Add(1)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.pool.active.Add(-1)
+		return nil, err
+	}
+	resp.Body = &activeBody{ReadCloser: resp.Body, active: &c.pool.active, done: c.drain}
+	return resp, nil
+}
+
+// staleConnection reports whether err is a connection closed or reset by the peer.
+func staleConnection(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,178 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportOptions(t *testing.T) {
+	client := NewClient("http://localhost")
+	err := client.SetOptions(WithIdleConnTimeout(30*time.Second), WithDisableKeepAlives(), WithTCPKeepAlive(15*time.Second))
+	assert.NoError(t, err)
+	tr, ok := client.http.Transport.(*http.Transport)
+	if assert.True(t, ok) {
+		assert.Equal(t, 30*time.Second, tr.IdleConnTimeout)
+		assert.True(t, tr.DisableKeepAlives)
+	}
+	assert.NotSame(t, http.DefaultClient, client.http)
+}
+
+func TestTransportOptionsCustomClient(t *testing.T) {
+	custom := &http.Client{}
+	client := NewClient("http://localhost")
+	client.SettHTTPClient(custom)
+	assert.NoError(t, client.SetOptions(WithIdleConnTimeout(time.Second)))
+	assert.Same(t, custom, client.http)
+}
+
+type paddedRequest struct {
+	XMLName xml.Name `xml:"urn:test GetInfo"`
+	Padding string   `xml:"Padding"`
+}
+
+func TestConnectionPerRequest(t *testing.T) {
+	var mu sync.Mutex
+	var headers []string
+	remotes := map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Get("Connection"))
+		remotes[r.RemoteAddr] = true
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithConnectionPerRequest()))
+	// differently sized requests, as sent to the service corrupting responses
+	for _, n := range []int{1, 1000, 10} {
+		resp := &infoResponse{}
+		require.NoError(t, client.Do(context.Background(), "GetInfo", &paddedRequest{Padding: strings.Repeat("x", n)}, resp))
+		assert.Equal(t, []string{"a", "b"}, resp.Items)
+	}
+	assert.Equal(t, []string{"close", "close", "close"}, headers)
+	assert.Len(t, remotes, 3)
+	tr, ok := client.http.Transport.(*http.Transport)
+	require.True(t, ok)
+	assert.True(t, tr.DisableKeepAlives)
+	assert.NotSame(t, http.DefaultClient, client.http)
+}
+
+func TestConnectionPerRequestCustomClient(t *testing.T) {
+	client := NewClient("http://localhost")
+	client.SettHTTPClient(&http.Client{})
+	assert.ErrorIs(t, client.SetOptions(WithConnectionPerRequest()), ErrSharedHTTPClient)
+
+	// set before the client
+	client = NewClient("http://localhost")
+	require.NoError(t, client.SetOptions(WithConnectionPerRequest()))
+	client.SettHTTPClient(&http.Client{})
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, ErrSharedHTTPClient)
+}
+
+func TestH2C(t *testing.T) {
+	var proto atomic.Value
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto.Store(r.Proto)
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	srv.Config.Protocols = &http.Protocols{}
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(WithH2C()))
+	resp := &infoResponse{}
+	assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, resp))
+	assert.Equal(t, "HTTP/2.0", proto.Load())
+	assert.Equal(t, []string{"a", "b"}, resp.Items)
+}
+
+func TestStaleConnectionRetry(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 2 {
+			// drop the kept-alive connection without answering, like a gateway closing idle connections
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if assert.NoError(t, err) {
+				_ = conn.Close()
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewClient(srv.URL)
+	client.SettHTTPClient(&http.Client{Transport: &http.Transport{}})
+	assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	resp := &infoResponse{}
+	assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, resp))
+	assert.Equal(t, []string{"a", "b"}, resp.Items)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestSetOptionsKeepsTransport(t *testing.T) {
+	srv := newInfoServer(t, "text/xml", infoResponseBody)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithIdleConnTimeout(time.Minute)))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	transport := client.http.Transport
+	assert.Equal(t, 1, client.PoolStats().Idle)
+
+	// options other than transport options, or the same transport options, keep the warmed pool
+	require.NoError(t, client.SetOptions(MarkIdempotent("GetInfo")))
+	require.NoError(t, client.SetOptions(WithIdleConnTimeout(time.Minute)))
+	assert.Same(t, transport, client.http.Transport)
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, PoolStats{Open: 1, Idle: 1, Counted: true, Dialed: 1, Reused: 1}, client.PoolStats())
+
+	// the replaced transport closes its idle connections
+	require.NoError(t, client.SetOptions(WithIdleConnTimeout(2*time.Minute)))
+	assert.NotSame(t, transport, client.http.Transport)
+	assert.Eventually(t, func() bool { return client.PoolStats().Open == 0 }, time.Second, time.Millisecond)
+}
+
+func TestStaleConnectionRetryTimings(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 2 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if assert.NoError(t, err) {
+				_ = conn.Close()
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithIdleConnTimeout(time.Minute)))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	var info ResponseInfo
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithResponseInfo(&info)))
+	require.Len(t, info.Timings, 1)
+	// the timings are the ones of the retry on a new connection
+	assert.False(t, info.Timings[0].Reused)
+	assert.Positive(t, info.Timings[0].Connect)
+	assert.Equal(t, PoolStats{Open: 1, Idle: 1, Counted: true, Dialed: 2, Reused: 1}, client.PoolStats())
+}
@@ -0,0 +1,113 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrUnresolvedURLVars is returned, before anything is sent, by calls whose endpoint URL holds placeholders
+	// without value. The returned error is an *UnresolvedURLVarsError.
+	ErrUnresolvedURLVars = errors.New("unresolved placeholders in endpoint URL")
+)
+
+// UnresolvedURLVarsError lists the placeholders of the endpoint URL without value.
+type UnresolvedURLVarsError struct {
+	Vars []string
+}
+
+func (e *UnresolvedURLVarsError) Error() string {
+	return ErrUnresolvedURLVars.Error() + ": " + strings.Join(e.Vars, ", ")
+}
+
+func (e *UnresolvedURLVarsError) Unwrap() error {
+	return ErrUnresolvedURLVars
+}
+
+// WithURLVars sets the values of the {name} placeholders in the endpoint URL of the client, e.g. of
+// "https://{env}.example.com/services/{tenant}/OrderService". Values set for a call are merged with the ones
+// of the client, replacing values of the same name. The values are percent-encoded for the part of the URL
+// they are placed in, so a value never adds path segments or query parameters.
+func WithURLVars(vars map[string]string) Option {
+	return func(s *settings) error {
+		merged := make(map[string]string, len(s.urlVars)+len(vars))
+		for name, value := range s.urlVars {
+			merged[name] = value
+		}
+		for name, value := range vars {
+			merged[name] = value
+		}
+		s.urlVars = merged
+		return nil
+	}
+}
+
+// resolveURL replaces the placeholders of the URL template with the percent-encoded values of vars.
+func resolveURL(template string, vars map[string]string) (string, error) {
+	if !strings.Contains(template, "{") {
+		return template, nil
+	}
+	var b strings.Builder
+	var unresolved []string
+	// the authority ends at the first slash after the scheme, the path at the query
+	authority := strings.Index(template, "://") + 3
+	inQuery := false
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		switch {
+		case c == '?' || c == '#':
+			inQuery = true
+		case c == '{':
+			end := strings.IndexByte(template[i:], '}')
+			if end < 0 {
+				break
+			}
+			name := template[i+1 : i+end]
+			value, ok := vars[name]
+			if !ok {
+				unresolved = append(unresolved, name)
+				b.WriteString(template[i : i+end+1])
+			} else if inQuery {
+				b.WriteString(url.QueryEscape(value))
+			} else if i < authority || !strings.Contains(template[authority:i], "/") {
+				// the host and port stay as they are but cannot hold escapes
+				b.WriteString(hostEscape(value))
+			} else {
+				b.WriteString(url.PathEscape(value))
+			}
+			i += end
+			continue
+		}
+		b.WriteByte(c)
+	}
+	if len(unresolved) > 0 {
+		sort.Strings(unresolved)
+		return "", &UnresolvedURLVarsError{Vars: unresolved}
+	}
+	return b.String(), nil
+}
+
+// redactURL returns the URL with its password redacted.
+func redactURL(endpoint string) string {
+	if u, err := url.Parse(endpoint); err == nil {
+		return u.Redacted()
+	}
+	return endpoint
+}
+
+// hostEscape percent-encodes everything but the characters of host names and ports.
+func hostEscape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == ':' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
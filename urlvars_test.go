@@ -0,0 +1,119 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		vars     map[string]string
+		want     string
+		wantErr  []string
+	}{
+		{
+			name:     "no placeholders",
+			template: "https://example.com/OrderService",
+			want:     "https://example.com/OrderService",
+		},
+		{
+			name:     "host and path",
+			template: "https://{env}.example.com/services/{tenant}/OrderService",
+			vars:     map[string]string{"env": "stage", "tenant": "acme"},
+			want:     "https://stage.example.com/services/acme/OrderService",
+		},
+		{
+			name:     "path value escaped",
+			template: "https://example.com/services/{tenant}/OrderService",
+			vars:     map[string]string{"tenant": "a/b c?d"},
+			want:     "https://example.com/services/a%2Fb%20c%3Fd/OrderService",
+		},
+		{
+			name:     "query value escaped",
+			template: "https://example.com/OrderService?tenant={tenant}",
+			vars:     map[string]string{"tenant": "a&b=c"},
+			want:     "https://example.com/OrderService?tenant=a%26b%3Dc",
+		},
+		{
+			name:     "host value escaped",
+			template: "https://{env}.example.com/OrderService",
+			vars:     map[string]string{"env": "a/b"},
+			want:     "https://a%2Fb.example.com/OrderService",
+		},
+		{
+			name:     "port",
+			template: "http://localhost:{port}/OrderService",
+			vars:     map[string]string{"port": "8080"},
+			want:     "http://localhost:8080/OrderService",
+		},
+		{
+			name:     "unresolved",
+			template: "https://{env}.example.com/services/{tenant}/{region}",
+			vars:     map[string]string{"env": "prod"},
+			wantErr:  []string{"region", "tenant"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveURL(tt.template, tt.vars)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, ErrUnresolvedURLVars)
+				var varsErr *UnresolvedURLVarsError
+				require.ErrorAs(t, err, &varsErr)
+				assert.Equal(t, tt.wantErr, varsErr.Vars)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestURLVars(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewClient(srv.URL + "/services/{tenant}/{service}")
+	require.NoError(t, client.SetOptions(WithURLVars(map[string]string{"tenant": "acme", "service": "OrderService"})))
+
+	var info ResponseInfo
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithResponseInfo(&info))
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/services/acme/OrderService", info.Endpoint)
+
+	// values of the call replace the ones of the client
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	err = client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+		WithURLVars(map[string]string{"tenant": "other tenant"}), WithLogger(logger))
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "endpoint="+srv.URL+"/services/other%20tenant/OrderService")
+	assert.Equal(t, []string{"/services/acme/OrderService", "/services/other%20tenant/OrderService"}, paths)
+}
+
+func TestURLVarsUnresolved(t *testing.T) {
+	var requests []*http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewClient(srv.URL + "/services/{tenant}/OrderService")
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, ErrUnresolvedURLVars)
+	assert.Empty(t, requests)
+}
@@ -0,0 +1,449 @@
+package soap
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Implements the verification of WS-Security X.509 signatures of received envelopes.
+// Only the algorithms used for signing are supported: exclusive canonicalization, RSA with SHA-1 or SHA-256.
+
+const (
+	dsigNS = "http://www.w3.org/2000/09/xmldsig#"
+	wsseNS = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	wsuNS  = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	// wsse11NS is the namespace of the WS-Security 1.1 extensions
+	wsse11NS = "http://docs.oasis-open.org/wss/oasis-wss-wssecurity-secext-1.1.xsd"
+)
+
+var (
+	// ErrNoSignature is returned if the envelope to verify carries no WS-Security signature.
+	ErrNoSignature = errors.New("no WS-Security signature found")
+	// ErrInvalidSignature is returned if the signature or the digest of a signed element does not match.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrUnsupportedAlgorithm is returned if the signature uses an algorithm not supported by the verifier.
+	ErrUnsupportedAlgorithm = errors.New("unsupported signature algorithm")
+	// ErrSignatureConfirmationMismatch is returned if the signed wsse11:SignatureConfirmation elements of the
+	// envelope do not confirm the SignatureValues of VerifyOptions.SignatureConfirmations.
+	ErrSignatureConfirmationMismatch = errors.New("signature confirmation mismatch")
+	// ErrInvalidTimestamp is returned if the signed wsu:Timestamp of the envelope expired, was created in the
+	// future or cannot be parsed.
+	ErrInvalidTimestamp = errors.New("invalid timestamp")
+)
+
+// VerifyOptions configures VerifySignature.
+type VerifyOptions struct {
+	// Roots are the trusted CAs the signing certificate has to chain to. If nil, the certificate is not verified.
+	Roots *x509.CertPool
+	// Certificate is the signing certificate. If set, a certificate included in the envelope, e.g. as
+	// BinarySecurityToken, has to be this one. If nil, the included certificate is used.
+	Certificate *x509.Certificate
+	// CurrentTime is the time the certificate and the timestamp have to be valid at, e.g. when the envelope was
+	// received. If zero, the current time of Clock is used.
+	CurrentTime time.Time
+	// Clock is the clock providing the current time. Default is the system clock.
+	Clock Clock
+	// MaxClockSkew is the difference tolerated between the current time and the clock of the sender: the
+	// timestamp may be created up to MaxClockSkew after the current time and expire up to MaxClockSkew before it.
+	MaxClockSkew time.Duration
+	// Actor selects the wsse:Security header by its actor (SOAP 1.1) or role (SOAP 1.2) if the envelope carries
+	// several. If empty, the header without actor is used.
+	Actor string
+	// SignatureConfirmations are the SignatureValues of the request the envelope responds to, as returned by
+	// SignatureValues, "" for a request sent unsigned. If not nil, the Security header has to carry a signed
+	// wsse11:SignatureConfirmation element for each of them and no others.
+	SignatureConfirmations []string
+}
+
+// VerifySignature verifies the WS-Security signature of the serialized envelope: the digests of all
+// referenced elements, the signature value and the signing certificate. The Body of the envelope and the
+// Timestamp of the Security header have to be signed, and the Ids of the envelope unique. The timestamp must
+// not be created after the current time nor have expired, see VerifyOptions.MaxClockSkew. Without Roots and
+// Certificate in opts any certificate included in the envelope is trusted, which only checks its integrity.
+func VerifySignature(envelope []byte, opts VerifyOptions) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(envelope); err != nil {
+		return err
+	}
+	root := doc.Root()
+	if root == nil {
+		return ErrNoSignature
+	}
+	header := securityHeader(root, opts.Actor)
+	sig := findElement(header, dsigNS, "Signature")
+	if sig == nil {
+		return ErrNoSignature
+	}
+	signedInfo := childElement(sig, dsigNS, "SignedInfo")
+	if signedInfo == nil {
+		return fmt.Errorf("%w: missing SignedInfo", ErrInvalidSignature)
+	}
+	ids, err := elementsByID(root)
+	if err != nil {
+		return err
+	}
+
+	method := childElement(signedInfo, dsigNS, "CanonicalizationMethod")
+	if algorithm(method) != canonicalizationExclusiveC14N {
+		return fmt.Errorf("%w: canonicalization", ErrUnsupportedAlgorithm)
+	}
+	references := childElements(signedInfo, dsigNS, "Reference")
+	if len(references) == 0 {
+		return fmt.Errorf("%w: no signed references", ErrInvalidSignature)
+	}
+	signed := make(map[*etree.Element]bool, len(references))
+	for _, ref := range references {
+		el, err := verifyReference(ref, ids)
+		if err != nil {
+			return err
+		}
+		signed[el] = true
+	}
+	if err := verifyCoverage(root, header, signed); err != nil {
+		return err
+	}
+	if opts.SignatureConfirmations != nil {
+		if err := verifyConfirmations(header, references, opts.SignatureConfirmations); err != nil {
+			return err
+		}
+	}
+
+	cert, err := signingCertificate(sig, ids, opts)
+	if err != nil {
+		return err
+	}
+	if opts.CurrentTime.IsZero() {
+		opts.CurrentTime = clockNow(opts.Clock)
+	}
+	if opts.Roots != nil {
+		if _, err := cert.Verify(x509.VerifyOptions{
+			Roots:       opts.Roots,
+			CurrentTime: opts.CurrentTime,
+			KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return err
+		}
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("%w: certificate key is not RSA", ErrUnsupportedAlgorithm)
+	}
+
+	var hash crypto.Hash
+	switch algorithm(childElement(signedInfo, dsigNS, "SignatureMethod")) {
+	case rsaSha256Sig:
+		hash = crypto.SHA256
+	case rsaSha1Sig:
+		hash = crypto.SHA1
+	default:
+		return fmt.Errorf("%w: signature method", ErrUnsupportedAlgorithm)
+	}
+	value := childElement(sig, dsigNS, "SignatureValue")
+	if value == nil {
+		return fmt.Errorf("%w: missing SignatureValue", ErrInvalidSignature)
+	}
+	signatureValue, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value.Text()))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	h := hash.New()
+	h.Write(canonicalize(signedInfo, inclusivePrefixes(method)...))
+	if err := rsa.VerifyPKCS1v15(pub, hash, h.Sum(nil), signatureValue); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if header == root {
+		return nil
+	}
+	return verifyTimestamps(header, opts.CurrentTime, opts.MaxClockSkew)
+}
+
+// verifyTimestamps checks the wsu:Created and wsu:Expires of the timestamps of the Security header against now,
+// tolerating skew.
+func verifyTimestamps(header *etree.Element, now time.Time, skew time.Duration) error {
+	for _, ts := range childElements(header, wsuNS, "Timestamp") {
+		if el := childElement(ts, wsuNS, "Created"); el != nil {
+			created, err := ParseTimestamp(strings.TrimSpace(el.Text()))
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidTimestamp, err)
+			}
+			if created.After(now.Add(skew)) {
+				return fmt.Errorf("%w: created at %s, after %s", ErrInvalidTimestamp, created.Format(time.RFC3339),
+					now.Format(time.RFC3339))
+			}
+		}
+		if el := childElement(ts, wsuNS, "Expires"); el != nil {
+			expires, err := ParseTimestamp(strings.TrimSpace(el.Text()))
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidTimestamp, err)
+			}
+			if !now.Add(-skew).Before(expires) {
+				return fmt.Errorf("%w: expired at %s", ErrInvalidTimestamp, expires.Format(time.RFC3339))
+			}
+		}
+	}
+	return nil
+}
+
+// verifyReference compares the digest of the element referenced by ref with its digest value and returns
+// the element.
+func verifyReference(ref *etree.Element, ids map[string]*etree.Element) (*etree.Element, error) {
+	uri := ref.SelectAttrValue("URI", "")
+	el, ok := ids[strings.TrimPrefix(uri, "#")]
+	if !strings.HasPrefix(uri, "#") || !ok {
+		return nil, fmt.Errorf("%w: reference %q not found", ErrInvalidSignature, uri)
+	}
+	var inclusive []string
+	if trs := childElement(ref, dsigNS, "Transforms"); trs != nil {
+		for _, tr := range childElements(trs, dsigNS, "Transform") {
+			if algorithm(tr) != canonicalizationExclusiveC14N {
+				return nil, fmt.Errorf("%w: transform %s", ErrUnsupportedAlgorithm, algorithm(tr))
+			}
+			inclusive = append(inclusive, inclusivePrefixes(tr)...)
+		}
+	}
+
+	var digest []byte
+	data := canonicalize(el, inclusive...)
+	switch algorithm(childElement(ref, dsigNS, "DigestMethod")) {
+	case sha256Sig:
+		sum := sha256.Sum256(data)
+		digest = sum[:]
+	case sha1Sig:
+		sum := sha1.Sum(data)
+		digest = sum[:]
+	default:
+		return nil, fmt.Errorf("%w: digest method", ErrUnsupportedAlgorithm)
+	}
+	value := childElement(ref, dsigNS, "DigestValue")
+	if value == nil || strings.TrimSpace(value.Text()) != base64.StdEncoding.EncodeToString(digest) {
+		return nil, fmt.Errorf("%w: digest of %s does not match", ErrInvalidSignature, uri)
+	}
+	return el, nil
+}
+
+// verifyCoverage checks that the signed elements include the Body of the envelope root, the one decoded,
+// and the wsu:Timestamp of the Security header if it has one. Envelopes with several Body or Header
+// elements are rejected, as a signed element may be moved next to the decoded one.
+func verifyCoverage(root, header *etree.Element, signed map[*etree.Element]bool) error {
+	if len(childElements(root, root.NamespaceURI(), "Header")) > 1 {
+		return fmt.Errorf("%w: several Header elements", ErrInvalidSignature)
+	}
+	switch bodies := childElements(root, root.NamespaceURI(), "Body"); {
+	case len(bodies) > 1:
+		return fmt.Errorf("%w: several Body elements", ErrInvalidSignature)
+	case len(bodies) == 1 && !signed[bodies[0]]:
+		return fmt.Errorf("%w: Body not signed", ErrInvalidSignature)
+	}
+	if header == root {
+		return nil
+	}
+	for _, ts := range childElements(header, wsuNS, "Timestamp") {
+		if !signed[ts] {
+			return fmt.Errorf("%w: Timestamp not signed", ErrInvalidSignature)
+		}
+	}
+	return nil
+}
+
+// verifyConfirmations checks that the signature confirmations of the Security header are signed by one of
+// the references and confirm the values, in any order.
+func verifyConfirmations(header *etree.Element, references []*etree.Element, values []string) error {
+	signed := make(map[string]bool, len(references))
+	for _, ref := range references {
+		signed[ref.SelectAttrValue("URI", "")] = true
+	}
+	missing := slices.Clone(values)
+	for _, c := range childElements(header, wsse11NS, "SignatureConfirmation") {
+		id := ""
+		for _, a := range c.Attr {
+			if a.Key == "Id" && (a.Space == "" || a.NamespaceURI() == wsuNS) {
+				id = a.Value
+			}
+		}
+		if !signed["#"+id] {
+			return fmt.Errorf("%w: confirmation %q not signed", ErrSignatureConfirmationMismatch, id)
+		}
+		value := c.SelectAttrValue("Value", "")
+		i := slices.Index(missing, value)
+		if i < 0 {
+			return fmt.Errorf("%w: unexpected confirmation of %q", ErrSignatureConfirmationMismatch, value)
+		}
+		missing = slices.Delete(missing, i, i+1)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %d signatures not confirmed", ErrSignatureConfirmationMismatch, len(missing))
+	}
+	return nil
+}
+
+// SignatureValues returns the SignatureValues of the WS-Security signatures of the serialized envelope, in
+// the order of its Security headers, e.g. to confirm them in the response with
+// SecurityConfig.SignatureConfirmations.
+func SignatureValues(envelope []byte) ([]string, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(envelope); err != nil {
+		return nil, err
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, nil
+	}
+	var values []string
+	for _, h := range childElements(childElement(root, root.NamespaceURI(), "Header"), wsseNS, "Security") {
+		for _, sig := range childElements(h, dsigNS, "Signature") {
+			if value := childElement(sig, dsigNS, "SignatureValue"); value != nil {
+				values = append(values, strings.Join(strings.Fields(value.Text()), ""))
+			}
+		}
+	}
+	return values, nil
+}
+
+// signingCertificate returns the certificate of the options, or else the one referenced by the key info of
+// sig. A certificate in the key info has to be the one of the options if set.
+func signingCertificate(sig *etree.Element, ids map[string]*etree.Element, opts VerifyOptions) (*x509.Certificate, error) {
+	cert, err := keyInfoCertificate(sig, ids)
+	switch {
+	case err != nil:
+		return nil, err
+	case opts.Certificate == nil && cert == nil:
+		return nil, fmt.Errorf("%w: no signing certificate", ErrInvalidSignature)
+	case opts.Certificate == nil:
+		return cert, nil
+	case cert != nil && !cert.Equal(opts.Certificate):
+		return nil, fmt.Errorf("%w: signed with another certificate", ErrInvalidSignature)
+	}
+	return opts.Certificate, nil
+}
+
+// keyInfoCertificate returns the certificate referenced by the key info of sig, nil if there is none.
+func keyInfoCertificate(sig *etree.Element, ids map[string]*etree.Element) (*x509.Certificate, error) {
+	keyInfo := childElement(sig, dsigNS, "KeyInfo")
+	if keyInfo == nil {
+		return nil, nil
+	}
+	if str := childElement(keyInfo, wsseNS, "SecurityTokenReference"); str != nil {
+		if ref := childElement(str, wsseNS, "Reference"); ref != nil {
+			if token, ok := ids[strings.TrimPrefix(ref.SelectAttrValue("URI", ""), "#")]; ok {
+				return parseCertificate(token.Text())
+			}
+		}
+	}
+	if data := childElement(keyInfo, dsigNS, "X509Data"); data != nil {
+		if cert := childElement(data, dsigNS, "X509Certificate"); cert != nil {
+			return parseCertificate(cert.Text())
+		}
+	}
+	return nil, nil
+}
+
+func parseCertificate(text string) (*x509.Certificate, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParseCertificate(der)
+}
+
+// elementsByID indexes all elements below root by their wsu:Id or Id attribute. Ids appearing more than once
+// are rejected, a reference would be ambiguous.
+func elementsByID(root *etree.Element) (map[string]*etree.Element, error) {
+	ids := map[string]*etree.Element{}
+	var walk func(el *etree.Element) error
+	walk = func(el *etree.Element) error {
+		for _, a := range el.Attr {
+			if a.Key == "Id" && (a.Space == "" || a.NamespaceURI() == wsuNS) {
+				if _, ok := ids[a.Value]; ok {
+					return fmt.Errorf("%w: duplicate Id %q", ErrInvalidSignature, a.Value)
+				}
+				ids[a.Value] = el
+			}
+		}
+		for _, c := range el.ChildElements() {
+			if err := walk(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ids, walk(root)
+}
+
+// securityHeader returns the wsse:Security header of the envelope root targeted at actor. If the envelope has
+// no Security header at all, root is returned.
+func securityHeader(root *etree.Element, actor string) *etree.Element {
+	headers := childElements(childElement(root, root.NamespaceURI(), "Header"), wsseNS, "Security")
+	if len(headers) == 0 {
+		return root
+	}
+	for _, h := range headers {
+		target := ""
+		for _, attr := range h.Attr {
+			if (attr.Key == "actor" && attr.NamespaceURI() == soapEnvNS) || (attr.Key == "role" && attr.NamespaceURI() == soap12EnvNS) {
+				target = attr.Value
+			}
+		}
+		if target == actor {
+			return h
+		}
+	}
+	return nil
+}
+
+// findElement returns the first element named space and local in the subtree of el.
+func findElement(el *etree.Element, space, local string) *etree.Element {
+	if el == nil {
+		return nil
+	}
+	if el.Tag == local && el.NamespaceURI() == space {
+		return el
+	}
+	for _, c := range el.ChildElements() {
+		if found := findElement(c, space, local); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func childElement(el *etree.Element, space, local string) *etree.Element {
+	if el == nil {
+		return nil
+	}
+	if children := childElements(el, space, local); len(children) > 0 {
+		return children[0]
+	}
+	return nil
+}
+
+func childElements(el *etree.Element, space, local string) []*etree.Element {
+	if el == nil {
+		return nil
+	}
+	var children []*etree.Element
+	for _, c := range el.ChildElements() {
+		if c.Tag == local && c.NamespaceURI() == space {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+// algorithm returns the Algorithm attribute of el.
+func algorithm(el *etree.Element) string {
+	if el == nil {
+		return ""
+	}
+	return el.SelectAttrValue("Algorithm", "")
+}
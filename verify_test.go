@@ -0,0 +1,209 @@
+package soap
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signedEnvelope returns a request envelope signed with the test certificate and the certificate.
+func signedEnvelope(t *testing.T, request any) (string, *x509.Certificate) {
+	t.Helper()
+	auth, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	req := NewRequest("Sign", "http://localhost", request, nil, nil)
+	req.AddHeader(auth.Header())
+	data, err := req.serialize()
+	assert.NoError(t, err)
+
+	pair, err := tls.LoadX509KeyPair("./testdata/cert.pem", "./testdata/key.pem")
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	assert.NoError(t, err)
+	return string(data), cert
+}
+
+// testCertificate returns the certificate of the test key pair.
+func testCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	pair, err := tls.LoadX509KeyPair("./testdata/cert.pem", "./testdata/key.pem")
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	require.NoError(t, err)
+	return cert
+}
+
+// attackerConfig returns the security config of securityConfig with a freshly generated self-signed key pair.
+func attackerConfig(t *testing.T) SecurityConfig {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "test.textnow"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cfg := securityConfig(t)
+	cfg.Certificate = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return cfg
+}
+
+func TestVerifySignature(t *testing.T) {
+	envelope, cert := signedEnvelope(t, &infoRequest{})
+	assert.NoError(t, VerifySignature([]byte(envelope), VerifyOptions{Certificate: cert}))
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	// the test certificate has expired
+	err := VerifySignature([]byte(envelope), VerifyOptions{Certificate: cert, Roots: roots})
+	var invalidErr x509.CertificateInvalidError
+	assert.True(t, errors.As(err, &invalidErr))
+	signed, err := ApplySecurity([]byte(infoResponseBody), securityConfig(t))
+	require.NoError(t, err)
+	assert.NoError(t, VerifySignature(signed, VerifyOptions{Certificate: cert, Roots: roots,
+		CurrentTime: testSigningTime}))
+}
+
+func TestVerifySignatureTimestamp(t *testing.T) {
+	// the timestamp is valid for 10 seconds from testSigningTime
+	signed, err := ApplySecurity([]byte(infoResponseBody), securityConfig(t))
+	require.NoError(t, err)
+	tests := []struct {
+		name string
+		opts VerifyOptions
+		err  error
+	}{
+		{name: "valid", opts: VerifyOptions{CurrentTime: testSigningTime.Add(9 * time.Second)}},
+		{name: "expired", opts: VerifyOptions{CurrentTime: testSigningTime.Add(10 * time.Second)}, err: ErrInvalidTimestamp},
+		{name: "expired within skew", opts: VerifyOptions{CurrentTime: testSigningTime.Add(time.Minute),
+			MaxClockSkew: time.Minute}},
+		{name: "created in the future", opts: VerifyOptions{CurrentTime: testSigningTime.Add(-time.Second)},
+			err: ErrInvalidTimestamp},
+		{name: "created within skew", opts: VerifyOptions{CurrentTime: testSigningTime.Add(-time.Second),
+			MaxClockSkew: time.Second}},
+		{name: "clock", opts: VerifyOptions{Clock: &manualClock{now: testSigningTime.Add(time.Hour)}},
+			err: ErrInvalidTimestamp},
+		{name: "system clock", err: ErrInvalidTimestamp},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifySignature(signed, tt.opts)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestVerifySignatureRawBody(t *testing.T) {
+	envelope, cert := signedEnvelope(t, RawXML(`<Order xmlns="urn:orders"><Amount>10</Amount></Order>`))
+	assert.NoError(t, VerifySignature([]byte(envelope), VerifyOptions{Certificate: cert}))
+}
+
+func TestVerifySignatureTampered(t *testing.T) {
+	envelope, cert := signedEnvelope(t, RawXML(`<Order xmlns="urn:orders"><Amount>10</Amount></Order>`))
+
+	tampered := strings.Replace(envelope, "<Amount>10</Amount>", "<Amount>1000</Amount>", 1)
+	assert.ErrorIs(t, VerifySignature([]byte(tampered), VerifyOptions{Certificate: cert}), ErrInvalidSignature)
+
+	start := strings.Index(envelope, "<ds:SignatureValue>") + len("<ds:SignatureValue>")
+	forged := envelope[:start] + "AAAA" + envelope[start+4:]
+	assert.ErrorIs(t, VerifySignature([]byte(forged), VerifyOptions{Certificate: cert}), ErrInvalidSignature)
+}
+
+func TestVerifySignatureOtherCertificate(t *testing.T) {
+	// an envelope signed with the key of the BinarySecurityToken it carries
+	signed, err := ApplySecurity([]byte(infoResponseBody), attackerConfig(t))
+	require.NoError(t, err)
+	assert.NoError(t, VerifySignature(signed, VerifyOptions{CurrentTime: testSigningTime}))
+	err = VerifySignature(signed, VerifyOptions{Certificate: testCertificate(t)})
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	assert.ErrorContains(t, err, "another certificate")
+
+	signed, err = ApplySecurity([]byte(infoResponseBody), securityConfig(t))
+	require.NoError(t, err)
+	assert.NoError(t, VerifySignature(signed, VerifyOptions{Certificate: testCertificate(t),
+		CurrentTime: testSigningTime}))
+}
+
+func TestVerifySignatureWrapping(t *testing.T) {
+	const order = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<Order xmlns="urn:orders"><Amount>10</Amount></Order></soap:Body></soap:Envelope>`
+	signed, err := ApplySecurity([]byte(order), securityConfig(t))
+	require.NoError(t, err)
+	envelope := string(signed)
+	start, end := strings.Index(envelope, "<soap:Body "), strings.Index(envelope, "</soap:Body>")+len("</soap:Body>")
+	body := envelope[start:end]
+	tamperedBody := strings.Replace(body, "<Amount>10</Amount>", "<Amount>1000</Amount>", 1)
+	// the signed body is moved into a header, next to the tampered body decoded
+	wrap := func(tamperedBody string) []byte {
+		wrapped := strings.Replace(envelope[:start]+tamperedBody+envelope[end:], "</soap:Header>",
+			`<Wrap xmlns="urn:attack">`+body+`</Wrap></soap:Header>`, 1)
+		return []byte(wrapped)
+	}
+	opts := VerifyOptions{Certificate: testCertificate(t)}
+
+	err = VerifySignature(wrap(tamperedBody), opts)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	assert.ErrorContains(t, err, "duplicate Id")
+
+	err = VerifySignature(wrap(strings.Replace(tamperedBody, ` wsu:Id="id-1"`, "", 1)), opts)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	assert.ErrorContains(t, err, "Body not signed")
+
+	twoBodies := []byte(envelope[:end] + tamperedBody + envelope[end:])
+	assert.ErrorIs(t, VerifySignature(twoBodies, opts), ErrInvalidSignature)
+
+	refStart := strings.Index(envelope, `<ds:Reference URI="#id-2">`)
+	refEnd := refStart + strings.Index(envelope[refStart:], "</ds:Reference>") + len("</ds:Reference>")
+	err = VerifySignature([]byte(envelope[:refStart]+envelope[refEnd:]), opts)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	assert.ErrorContains(t, err, "Timestamp not signed")
+}
+
+func TestVerifySignatureMissing(t *testing.T) {
+	assert.ErrorIs(t, VerifySignature([]byte(infoResponseBody), VerifyOptions{}), ErrNoSignature)
+
+	envelope, _ := signedEnvelope(t, &infoRequest{})
+	assert.ErrorIs(t, VerifySignature([]byte(envelope), VerifyOptions{}), ErrInvalidSignature)
+}
+
+func TestVerifySignatureLayouts(t *testing.T) {
+	// hand-built envelopes in the layouts of other WS-Security stacks, not captured from them; the
+	// interoperability with the stacks is out of scope, see testdata/wsse/README.md
+	fixtures, err := filepath.Glob("./testdata/wsse/layouts/*.xml")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, fixtures)
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			envelope, err := os.ReadFile(fixture)
+			assert.NoError(t, err)
+			// the signing certificate is taken from the BinarySecurityToken, the timestamps are from the time of
+			// the signing
+			assert.NoError(t, VerifySignature(envelope, VerifyOptions{CurrentTime: testSigningTime}))
+
+			tampered := strings.Replace(string(envelope), "<ord:Sku>978-0<", "<ord:Sku>978-1<", 1)
+			tampered = strings.Replace(tampered, "<Sku>978-0<", "<Sku>978-1<", 1)
+			assert.ErrorIs(t, VerifySignature([]byte(tampered), VerifyOptions{}), ErrInvalidSignature)
+		})
+	}
+}
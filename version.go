@@ -0,0 +1,141 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/m29h/xml"
+)
+
+// Implements the choice between SOAP 1.1 and SOAP 1.2 envelopes and the detection of responses in the other
+// version than the request.
+
+const soap12EnvNS = "http://www.w3.org/2003/05/soap-envelope"
+
+var (
+	// ErrVersionMismatch is returned if the response envelope uses another SOAP version than the request.
+	// The returned error is a *VersionMismatchError.
+	ErrVersionMismatch = errors.New("soap version mismatch")
+)
+
+// Version is a SOAP protocol version. The zero value is SOAP 1.1.
+type Version int
+
+const (
+	// SOAP11 is SOAP 1.1, sent as text/xml with a SOAPAction header.
+	SOAP11 Version = iota
+	// SOAP12 is SOAP 1.2, sent as application/soap+xml with the action as media type parameter.
+	SOAP12
+)
+
+func (v Version) String() string {
+	if v == SOAP12 {
+		return "SOAP 1.2"
+	}
+	return "SOAP 1.1"
+}
+
+// namespace returns the envelope namespace of the version.
+func (v Version) namespace() string {
+	if v == SOAP12 {
+		return soap12EnvNS
+	}
+	return soapEnvNS
+}
+
+// other returns the version to switch to on a mismatch.
+func (v Version) other() Version {
+	if v == SOAP12 {
+		return SOAP11
+	}
+	return SOAP12
+}
+
+// VersionMismatchError reports the envelope namespaces of a request and its response in different SOAP versions.
+type VersionMismatchError struct {
+	// Sent is the envelope namespace of the request.
+	Sent string
+	// Received is the envelope namespace of the response.
+	Received string
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("soap version mismatch: sent envelope %s, received %s", e.Sent, e.Received)
+}
+
+func (e *VersionMismatchError) Unwrap() error {
+	return ErrVersionMismatch
+}
+
+// WithVersion sets the SOAP version of the requests. Default is SOAP11.
+func WithVersion(v Version) Option {
+	return func(s *settings) error {
+		s.version = v
+		return nil
+	}
+}
+
+// AutoNegotiate retries a call once in the other SOAP version if the response was in another version than the
+// request. The client remembers the version of the last successful call and uses it for subsequent calls
+// with AutoNegotiate.
+func AutoNegotiate() Option {
+	return func(s *settings) error {
+		s.autoNegotiate = true
+		return nil
+	}
+}
+
+// versionMismatch returns the mismatch error if the envelope start element is a SOAP envelope of another
+// version than v.
+func versionMismatch(v Version, start xml.StartElement) error {
+	if start.Name.Local != "Envelope" || start.Name.Space == v.namespace() {
+		return nil
+	}
+	if start.Name.Space != soapEnvNS && start.Name.Space != soap12EnvNS {
+		return nil
+	}
+	return &VersionMismatchError{Sent: v.namespace(), Received: start.Name.Space}
+}
+
+// MarshalXML encodes the envelope in its SOAP version.
+func (e *Envelope) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Space: e.version.namespace(), Local: "Envelope"}
+	if e.Header != nil {
+		e.Header.version = e.version
+	}
+	if e.Body != nil {
+		e.Body.version = e.version
+	}
+	return enc.EncodeElement((*envelope)(e), start)
+}
+
+// unmarshalSOAP12 decodes the Header and Body elements of a SOAP 1.2 envelope, whose names do not match the
+// SOAP 1.1 names of the Envelope fields.
+func (e *Envelope) unmarshalSOAP12(d *xml.Decoder) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch elem := token.(type) {
+		case xml.StartElement:
+			switch {
+			case elem.Name.Space == soap12EnvNS && elem.Name.Local == "Header" && e.Header != nil:
+				err = e.Header.UnmarshalXML(d, elem)
+			case elem.Name.Space == soap12EnvNS && elem.Name.Local == "Body":
+				if e.Body == nil {
+					e.Body = &Body{}
+				}
+				e.Body.version = SOAP12
+				err = e.Body.UnmarshalXML(d, elem)
+			default:
+				err = d.Skip()
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
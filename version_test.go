@@ -0,0 +1,118 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newVersionedServer answers requests in version v with the fixture response and all others with mismatch.
+func newVersionedServer(t *testing.T, v Version, response string, mismatch string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var contentTypes []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		fixture := mismatch
+		if (mediaType == "application/soap+xml") == (v == SOAP12) {
+			fixture = response
+		}
+		data, err := os.ReadFile("./testdata/version/" + fixture)
+		assert.NoError(t, err)
+		if v == SOAP12 {
+			w.Header().Set("Content-Type", "application/soap+xml; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		}
+		if fixture != response {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &contentTypes
+}
+
+func TestVersionMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		sent     Version
+		server   Version
+		fixture  string
+		received string
+	}{
+		{name: "1.1 request, 1.2 response", sent: SOAP11, server: SOAP12, fixture: "soap12_mismatch.xml", received: soap12EnvNS},
+		{name: "1.2 request, 1.1 response", sent: SOAP12, server: SOAP11, fixture: "soap11_mismatch.xml", received: soapEnvNS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := newVersionedServer(t, tt.server, "", tt.fixture)
+			client := NewClient(srv.URL)
+
+			err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithVersion(tt.sent))
+			assert.ErrorIs(t, err, ErrVersionMismatch)
+			var mismatch *VersionMismatchError
+			if assert.True(t, errors.As(err, &mismatch)) {
+				assert.Equal(t, tt.sent.namespace(), mismatch.Sent)
+				assert.Equal(t, tt.received, mismatch.Received)
+			}
+		})
+	}
+}
+
+func TestAutoNegotiate(t *testing.T) {
+	srv, contentTypes := newVersionedServer(t, SOAP12, "soap12_response.xml", "soap12_mismatch.xml")
+	client := NewClient(srv.URL)
+	assert.NoError(t, client.SetOptions(AutoNegotiate()))
+
+	resp := &infoResponse{}
+	assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, resp))
+	assert.Equal(t, []string{"a", "b"}, resp.Items)
+	if assert.Len(t, *contentTypes, 2) {
+		assert.True(t, strings.HasPrefix((*contentTypes)[0], "text/xml"))
+		assert.Equal(t, `application/soap+xml; action=GetInfo; charset=utf-8`, (*contentTypes)[1])
+	}
+
+	// the working version is remembered
+	*contentTypes = nil
+	assert.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Len(t, *contentTypes, 1)
+
+	// without negotiation the mismatch is reported
+	err := NewClient(srv.URL).Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, ErrVersionMismatch)
+}
+
+func TestSOAP12Fault(t *testing.T) {
+	srv, _ := newVersionedServer(t, SOAP12, "soap12_fault.xml", "soap12_mismatch.xml")
+	client := NewClient(srv.URL)
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}, WithVersion(SOAP12))
+	var fault *Fault
+	if assert.ErrorAs(t, err, &fault) {
+		assert.Equal(t, "env:Receiver", fault.Code)
+		assert.Equal(t, "app:Busy", fault.Subcode)
+		assert.Equal(t, "Try again later", fault.String)
+		assert.Contains(t, fault.DetailInternal.Content, ">5</Retry>")
+	}
+}
+
+func TestSOAP12Envelope(t *testing.T) {
+	req := NewRequest("GetInfo", "http://localhost", &infoRequest{}, nil, nil)
+	req.settings.version = SOAP12
+	req.AddHeader(func(body any) (any, error) { return &idempotencyHeader{Value: "k"}, nil })
+	data, err := req.serialize()
+	assert.NoError(t, err)
+	s := string(data)
+	assert.Contains(t, s, `Envelope xmlns:soap-envelope="http://www.w3.org/2003/05/soap-envelope"`)
+	assert.Contains(t, s, `<soap-envelope:Header>`)
+	assert.Contains(t, s, `<soap-envelope:Body>`)
+	assert.NotContains(t, s, soapEnvNS)
+}
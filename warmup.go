@@ -0,0 +1,221 @@
+package soap
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Implements warming up the connections of a client before its first call, and the statistics of the
+// connections it uses.
+
+// WarmupMode is the way Client.Warmup connects to the endpoint.
+type WarmupMode int
+
+const (
+	// WarmupHead sends a HEAD request to the endpoint, leaving an idle connection in the pool.
+	WarmupHead WarmupMode = iota
+	// WarmupOptions sends an OPTIONS request to the endpoint, for services rejecting HEAD requests.
+	WarmupOptions
+	// WarmupDial only dials the endpoint and completes the TLS handshake without sending any request, for
+	// services logging or rejecting requests without envelope. The connection is closed again and not pooled,
+	// it only warms the DNS cache and the TLS session cache of the client if it has one. Endpoints reached through a proxy and clients with a
+	// transport other than *http.Transport are warmed up with a HEAD request instead.
+	WarmupDial
+)
+
+// WithWarmup sets the way Client.Warmup connects, WarmupHead by default.
+func WithWarmup(mode WarmupMode) Option {
+	return func(s *settings) error {
+		s.warmup = mode
+		return nil
+	}
+}
+
+// Warmup connects to the endpoint of the client without sending an envelope, so the first call does not pay
+// for the DNS lookup and the TLS handshake, see WithWarmup. The connection is made to the endpoint resolved with
+// the URL variables of the client, with its transport, through its proxy and with its client certificates. The
+// status code of the response is ignored. Warmup may be called concurrently with calls, e.g. periodically so
+// idle connections are kept open.
+func (c *Client) Warmup(ctx context.Context) error {
+	if c.closed.Load() {
+		return ErrClientClosed
+	}
+	endpoint, err := resolveURL(c.url, c.settings.urlVars)
+	if err != nil {
+		return err
+	}
+	if c.settings.warmup == WarmupDial {
+		if tr, ok := c.transport(); ok {
+			req, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+			if err != nil {
+				return err
+			}
+			proxied, err := usesProxy(tr, req)
+			if err != nil {
+				return err
+			}
+			if !proxied {
+				return dialEndpoint(ctx, tr, req)
+			}
+		}
+	}
+	method := http.MethodHead
+	if c.settings.warmup == WarmupOptions {
+		method = http.MethodOptions
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	c.settings.overrideHost(req)
+	resp, err := c.roundTrip(ctx, req, nil)
+	if err != nil {
+		return err
+	}
+	// read to the end, so the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.Body.Close()
+}
+
+// transport returns the transport of the HTTP client if it is an *http.Transport.
+func (c *Client) transport() (*http.Transport, bool) {
+	switch tr := c.http.Transport.(type) {
+	case nil:
+		tr2, ok := http.DefaultTransport.(*http.Transport)
+		return tr2, ok
+	case *http.Transport:
+		return tr, true
+	}
+	return nil, false
+}
+
+// usesProxy reports whether tr sends req through a proxy.
+func usesProxy(tr *http.Transport, req *http.Request) (bool, error) {
+	if tr.Proxy == nil {
+		return false, nil
+	}
+	proxy, err := tr.Proxy(req)
+	return proxy != nil, err
+}
+
+// dialEndpoint dials the host of req with the dialer and TLS configuration of tr and closes the connection.
+func dialEndpoint(ctx context.Context, tr *http.Transport, req *http.Request) error {
+	host := req.URL.Host
+	if req.URL.Port() == "" {
+		port := "80"
+		if req.URL.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(req.URL.Hostname(), port)
+	}
+	dial := tr.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, "tcp", host)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if req.URL.Scheme != "https" {
+		return nil
+	}
+	cfg := &tls.Config{}
+	if tr.TLSClientConfig != nil {
+		cfg = tr.TLSClientConfig.Clone()
+	}
+	if cfg.ServerName == "" {
+		cfg.ServerName = req.URL.Hostname()
+	}
+	return tls.Client(conn, cfg).HandshakeContext(ctx)
+}
+
+// PoolStats are statistics of the connections of a client.
+type PoolStats struct {
+	// Open is the number of open connections, Active the number of requests being sent or read over them and
+	// Idle the number of connections without request. They are only counted for the transport created by the
+	// client for transport options, Counted is false otherwise. Requests sharing an HTTP/2 connection count
+	// as active each.
+	Open, Active, Idle int
+	Counted            bool
+	// Dialed is the number of connections made for requests and Reused the number of requests sent on an
+	// existing connection, for every transport.
+	Dialed, Reused int64
+}
+
+// PoolStats returns the statistics of the connections of the client.
+func (c *Client) PoolStats() PoolStats {
+	stats := PoolStats{
+		Active: int(c.pool.active.Load()),
+		Dialed: c.pool.dialed.Load(),
+		Reused: c.pool.reused.Load(),
+	}
+	if tr, ok := c.http.Transport.(*http.Transport); ok && tr == c.pool.tracked && !c.customHTTP {
+		stats.Counted = true
+		stats.Open = int(c.pool.open.Load())
+		stats.Idle = max(stats.Open-stats.Active, 0)
+	}
+	return stats
+}
+
+// poolCounters counts the connections and requests of a client.
+type poolCounters struct {
+	open, active   atomic.Int64
+	dialed, reused atomic.Int64
+	// tracked is the transport created for the transport options, whose open connections are counted
+	tracked *http.Transport
+}
+
+// track wraps the dialer of tr to count its open connections in c.
+func (c *poolCounters) track(tr *http.Transport) *http.Transport {
+	dial := tr.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		c.open.Add(1)
+		return &countedConn{Conn: conn, open: &c.open}, nil
+	}
+	c.tracked = tr
+	return tr
+}
+
+// countedConn decrements open once closed.
+type countedConn struct {
+	net.Conn
+	open *atomic.Int64
+	once sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() { c.open.Add(-1) })
+	return c.Conn.Close()
+}
+
+// activeBody decrements the active requests once the body of their response is closed, then calls done.
+type activeBody struct {
+	io.ReadCloser
+	active *atomic.Int64
+	done   func()
+	once   sync.Once
+}
+
+func (b *activeBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.active.Add(-1)
+		if b.done != nil {
+			b.done()
+		}
+	})
+	return err
+}
@@ -0,0 +1,115 @@
+package soap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMethodServer answers with the info response, recording the methods of the requests.
+func newMethodServer(t *testing.T, tls bool) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var methods []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		methods = append(methods, r.Method)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	if tls {
+		srv.StartTLS()
+	} else {
+		srv.Start()
+	}
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), methods...)
+	}
+}
+
+func TestWarmup(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    WarmupMode
+		methods []string
+	}{
+		{name: "head", mode: WarmupHead, methods: []string{http.MethodHead, http.MethodPost}},
+		{name: "options", mode: WarmupOptions, methods: []string{http.MethodOptions, http.MethodPost}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, methods := newMethodServer(t, false)
+			client := NewClient(srv.URL)
+			require.NoError(t, client.SetOptions(WithWarmup(tt.mode), WithIdleConnTimeout(time.Minute)))
+			require.NoError(t, client.Warmup(context.Background()))
+			assert.Equal(t, PoolStats{Open: 1, Idle: 1, Counted: true, Dialed: 1}, client.PoolStats())
+
+			require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+			assert.Equal(t, PoolStats{Open: 1, Idle: 1, Counted: true, Dialed: 1, Reused: 1}, client.PoolStats())
+			assert.Equal(t, tt.methods, methods())
+		})
+	}
+}
+
+func TestWarmupDial(t *testing.T) {
+	srv, methods := newMethodServer(t, true)
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithWarmup(WarmupDial), WithRootCAs(roots)))
+	require.NoError(t, client.Warmup(context.Background()))
+	assert.Empty(t, methods())
+	assert.Equal(t, PoolStats{Counted: true}, client.PoolStats())
+
+	// the handshake fails without the roots of the client
+	client = NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithWarmup(WarmupDial), WithIdleConnTimeout(time.Minute)))
+	var certErr *tls.CertificateVerificationError
+	assert.ErrorAs(t, client.Warmup(context.Background()), &certErr)
+}
+
+func TestPoolStatsUncounted(t *testing.T) {
+	srv, _ := newMethodServer(t, false)
+	client := NewClient(srv.URL)
+	client.SettHTTPClient(&http.Client{Transport: &http.Transport{}})
+	require.NoError(t, client.Warmup(context.Background()))
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{}))
+	assert.Equal(t, PoolStats{Dialed: 1, Reused: 1}, client.PoolStats())
+
+	// an unread body counts as active
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	require.NoError(t, err)
+	resp, err := client.roundTrip(context.Background(), req, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, client.PoolStats().Active)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, 0, client.PoolStats().Active)
+}
+
+func TestWarmupURLVars(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+	}))
+	t.Cleanup(srv.Close)
+
+	client := NewClient(srv.URL + "/services/{tenant}/Svc")
+	require.NoError(t, client.SetOptions(WithURLVars(map[string]string{"tenant": "acme"})))
+	require.NoError(t, client.Warmup(context.Background()))
+	assert.Equal(t, []string{"HEAD /services/acme/Svc"}, paths)
+
+	assert.ErrorIs(t, NewClient(srv.URL+"/services/{tenant}/Svc").Warmup(context.Background()), ErrUnresolvedURLVars)
+	assert.Len(t, paths, 1)
+}
@@ -0,0 +1,140 @@
+package soap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// Implements serializations of the messages on the wire other than XML, e.g. Fast Infoset negotiated by a
+// gateway or compressed XML over a bridge. The envelopes are built, signed and decoded as XML regardless, the
+// codec only converts the serialized messages, so the header and fault handling works with any codec.
+
+// Codec converts the serialized messages of a client to and from their serialization on the wire.
+type Codec interface {
+	// Encode returns the request message to send for the XML message with the content type, and the
+	// content type to send it with.
+	Encode(message []byte, contentType string) ([]byte, string, error)
+	// Decode returns the XML message of the response body received with the content type, and its content
+	// type as XML message. Bodies of other content types, such as the error pages of a gateway, are to be
+	// returned unchanged.
+	Decode(body io.Reader, contentType string) (io.Reader, string, error)
+}
+
+// XMLCodec sends and receives the messages as XML. It is the default codec.
+var XMLCodec Codec = xmlCodec{}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Encode(message []byte, contentType string) ([]byte, string, error) {
+	return message, contentType, nil
+}
+
+func (xmlCodec) Decode(body io.Reader, contentType string) (io.Reader, string, error) {
+	return body, contentType, nil
+}
+
+// WithCodec sends the requests and decodes the responses of the calls with codec, XMLCodec if nil. It applies
+// to the messages as a whole, multipart messages with attachments included. The content type of the decoded
+// message is the one of the response in ResponseInfo.Header and the errors of the call.
+func WithCodec(codec Codec) Option {
+	return func(s *settings) error {
+		s.codec = codec
+		return nil
+	}
+}
+
+// gzipMediaType is the content type of the messages of GzipCodec.
+const gzipMediaType = "application/gzip"
+
+// GzipCodec sends the messages gzip-compressed with the content type application/gzip; its type parameter
+// is the content type of the compressed message. Responses of other content types are decoded as XML.
+type GzipCodec struct {
+	// Level is the compression level of requests, gzip.DefaultCompression if 0.
+	Level int
+	// MaxSize is the maximum size of a decompressed response, DefaultGzipMaxSize if 0. Larger responses fail
+	// to decode with ErrDecompressedTooLarge.
+	MaxSize int64
+}
+
+func (c GzipCodec) Encode(message []byte, contentType string) ([]byte, string, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, "", err
+	}
+	if _, err := zw.Write(message); err != nil {
+		return nil, "", err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), mime.FormatMediaType(gzipMediaType, map[string]string{"type": contentType}), nil
+}
+
+func (c GzipCodec) Decode(body io.Reader, contentType string) (io.Reader, string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != gzipMediaType {
+		return body, contentType, nil
+	}
+	zr, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, "", fmt.Errorf("gzip message: %w", err)
+	}
+	inner := params["type"]
+	if inner == "" {
+		inner = "text/xml"
+	}
+	maxSize := c.MaxSize
+	if maxSize == 0 {
+		maxSize = DefaultGzipMaxSize
+	}
+	return &sizeLimitedReader{r: zr, limit: maxSize}, inner, nil
+}
+
+// sizeLimitedReader fails with ErrDecompressedTooLarge once more than limit bytes were read.
+type sizeLimitedReader struct {
+	r     io.Reader
+	limit int64
+	n     int64
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.limit {
+		return 0, fmt.Errorf("%w of %d bytes in gzip message", ErrDecompressedTooLarge, l.limit)
+	}
+	return n, err
+}
+
+// encodeMessage returns the message to send for the XML message with the content type, see WithCodec.
+func (s *settings) encodeMessage(message []byte, contentType string) ([]byte, string, error) {
+	if s.codec == nil {
+		return message, contentType, nil
+	}
+	return s.codec.Encode(message, contentType)
+}
+
+// decodeMessage returns the reader of the XML message of the body of httpResp read from body and a copy of
+// httpResp with the content type of the XML message, see WithCodec.
+func (s *settings) decodeMessage(httpResp *http.Response, body io.Reader) (*http.Response, io.Reader, error) {
+	if s.codec == nil {
+		return httpResp, body, nil
+	}
+	decoded, contentType, err := s.codec.Decode(body, httpResp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, err
+	}
+	resp := *httpResp
+	resp.Header = httpResp.Header.Clone()
+	resp.Header.Set("Content-Type", contentType)
+	return &resp, decoded, nil
+}
@@ -0,0 +1,153 @@
+package soap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+// newGzipCodecServer returns a server answering gzip-compressed with the body, and the decompressed requests.
+func newGzipCodecServer(t *testing.T, status int, body string) (*httptest.Server, *[]capturedRequest) {
+	t.Helper()
+	var captured []capturedRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		require.NoError(t, err)
+		b, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		captured = append(captured, capturedRequest{header: r.Header.Clone(), body: string(b)})
+		w.Header().Set("Content-Type", `application/gzip; type="text/xml; charset=utf-8"`)
+		w.WriteHeader(status)
+		_, _ = w.Write(gzipped(t, body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &captured
+}
+
+func TestGzipCodec(t *testing.T) {
+	body := strings.Replace(infoResponseBody, "<soap:Body>",
+		`<soap:Header><Session xmlns="urn:test">s-1</Session></soap:Header><soap:Body>`, 1)
+	srv, captured := newGzipCodecServer(t, http.StatusOK, body)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithCodec(GzipCodec{})))
+
+	var info ResponseInfo
+	resp := &infoResponse{}
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, resp, WithResponseInfo(&info)))
+	assert.Equal(t, []string{"a", "b"}, resp.Items)
+	if assert.Len(t, info.SOAPHeaders, 1) {
+		assert.Equal(t, xml.Name{Space: "urn:test", Local: "Session"}, info.SOAPHeaders[0].XMLName)
+	}
+	assert.Equal(t, "text/xml; charset=utf-8", info.Header.Get("Content-Type"))
+	assert.Equal(t, int64(len(gzipped(t, body))), info.BytesRead)
+
+	require.Len(t, *captured, 1)
+	req := (*captured)[0]
+	mediaType, params, err := mime.ParseMediaType(req.header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "application/gzip", mediaType)
+	assert.Equal(t, `text/xml; charset="utf-8"`, params["type"])
+	assert.Equal(t, "GetInfo", req.header.Get("SOAPAction"))
+	assert.Contains(t, req.body, `<_:GetInfo xmlns:_="urn:test"></_:GetInfo>`)
+
+	// the envelope is signed before it is compressed
+	cfg := securityConfig(t)
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{},
+		WithHeaderBuilder(func(context.Context, any) (any, error) { return &pendingSecurity{config: cfg}, nil })))
+	assert.NoError(t, VerifySignature([]byte((*captured)[1].body), VerifyOptions{CurrentTime: testSigningTime}))
+}
+
+func TestGzipCodecFault(t *testing.T) {
+	fault := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+		`<faultcode>soap:Client</faultcode><faultstring>Invalid account</faultstring>` +
+		`<detail><Errors><Error><code>E42</code></Error></Errors></detail></soap:Fault></soap:Body></soap:Envelope>`
+	srv, _ := newGzipCodecServer(t, http.StatusInternalServerError, fault)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithCodec(GzipCodec{})))
+
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	if f := ExtractFault(err); assert.NotNil(t, f) {
+		assert.Equal(t, "soap:Client", f.Code)
+		assert.Equal(t, "E42", f.QueryDetail("Errors/Error/code", MatchLocalName).Text())
+	}
+
+	err = client.DoStream(context.Background(), "GetInfo", &infoRequest{}, func(dec *xml.Decoder, start xml.StartElement) error {
+		return dec.Skip()
+	})
+	assert.Equal(t, "soap:Client", ExtractFault(err).Code)
+}
+
+func TestGzipCodecPassThrough(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.Header().Set("Content-Type", "text/plain")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("maintenance"))
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(infoResponseBody))
+	}))
+	t.Cleanup(srv.Close)
+
+	// responses not compressed are decoded as XML
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithCodec(GzipCodec{})))
+	resp := &infoResponse{}
+	require.NoError(t, client.Do(context.Background(), "GetInfo", &infoRequest{}, resp))
+	assert.Equal(t, []string{"a", "b"}, resp.Items)
+
+	down := NewClient(srv.URL + "/down")
+	require.NoError(t, down.SetOptions(WithCodec(GzipCodec{})))
+	err := down.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	var httpErr *HTTPError
+	if assert.ErrorAs(t, err, &httpErr) {
+		assert.Equal(t, http.StatusServiceUnavailable, httpErr.StatusCode)
+	}
+}
+
+func TestGzipCodecMaxSize(t *testing.T) {
+	srv, _ := newGzipCodecServer(t, http.StatusOK, infoResponseBody)
+	client := NewClient(srv.URL)
+	require.NoError(t, client.SetOptions(WithCodec(GzipCodec{MaxSize: 64})))
+	err := client.Do(context.Background(), "GetInfo", &infoRequest{}, &infoResponse{})
+	assert.ErrorIs(t, err, ErrDecompressedTooLarge)
+}
+
+func TestCodecs(t *testing.T) {
+	for _, codec := range []Codec{XMLCodec, GzipCodec{Level: gzip.BestSpeed}} {
+		pipeline, err := NewPipeline(WithVersion(SOAP12), WithCodec(codec))
+		require.NoError(t, err)
+		envelope, err := pipeline.BuildEnvelope(context.Background(), &infoRequest{})
+		require.NoError(t, err)
+		encoded, err := pipeline.EncodeRequest(envelope, "GetInfo")
+		require.NoError(t, err)
+
+		decoded, contentType, err := codec.Decode(bytes.NewReader(encoded.Body), encoded.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		data, err := io.ReadAll(decoded)
+		require.NoError(t, err)
+		assert.Equal(t, encoded.Envelope, data)
+		assert.Equal(t, "application/soap+xml; action=GetInfo; charset=utf-8", contentType)
+	}
+}
@@ -0,0 +1,69 @@
+package wsdl
+
+import (
+	"errors"
+	"fmt"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+var (
+	// ErrPortNotFound is returned by NewClient if the definitions have no SOAP port of the name.
+	ErrPortNotFound = errors.New("port not found")
+)
+
+// ClientOption configures a client created with NewClient.
+type ClientOption func(*clientSettings)
+
+type clientSettings struct {
+	allowZero []string
+	validate  bool
+}
+
+// AllowZero accepts zero values for the required elements at the paths, e.g. "GetOrder/Comment", see
+// Definitions.Validator.
+func AllowZero(paths ...string) ClientOption {
+	return func(s *clientSettings) {
+		s.allowZero = append(s.allowZero, paths...)
+	}
+}
+
+// WithoutValidation disables the check of the requests for missing required elements.
+func WithoutValidation() ClientOption {
+	return func(s *clientSettings) {
+		s.validate = false
+	}
+}
+
+// NewClient returns a client of the port named port, calling its address with the SOAP version of its
+// binding. Requests are checked for missing required elements before anything is sent, see
+// Definitions.Validator.
+func NewClient(defs *Definitions, port string, opts ...ClientOption) (*soap.Client, error) {
+	s := clientSettings{validate: true}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	for _, svc := range defs.Services {
+		for _, p := range svc.Ports {
+			if p.Name != port || p.Address == nil && p.Address12 == nil {
+				continue
+			}
+			binding := localName(p.Binding)
+			var options []soap.Option
+			address := p.Address
+			if p.Address12 != nil {
+				address = p.Address12
+				options = append(options, soap.WithVersion(soap.SOAP12))
+			}
+			if s.validate {
+				options = append(options, soap.WithRequestValidator(defs.Validator(binding, s.allowZero...)))
+			}
+			client := soap.NewClient(address.Location)
+			if err := client.SetOptions(options...); err != nil {
+				return nil, err
+			}
+			return client, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrPortNotFound, port)
+}
@@ -0,0 +1,369 @@
+package wsdl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m29h/xml"
+)
+
+const (
+	// DefaultMaxImports is the number of documents a Fetcher imports at most if its MaxImports is 0.
+	DefaultMaxImports = 50
+	// DefaultMaxDocumentSize is the size of the documents a Fetcher reads at most if its MaxDocumentSize is 0.
+	DefaultMaxDocumentSize = 10 << 20
+)
+
+const (
+	wsdlNS = "http://schemas.xmlsoap.org/wsdl/"
+	xsdNS  = "http://www.w3.org/2001/XMLSchema"
+)
+
+var (
+	// ErrImportNotAllowed is returned by Fetcher.Fetch for imports from hosts not allowed and of schemes other
+	// than http and https.
+	ErrImportNotAllowed = errors.New("import not allowed")
+	// ErrTooManyImports is returned by Fetcher.Fetch if the documents import more than MaxImports documents.
+	ErrTooManyImports = errors.New("too many imports")
+	// ErrDocumentTooLarge is returned by Fetcher.Fetch for documents larger than MaxDocumentSize.
+	ErrDocumentTooLarge = errors.New("document too large")
+	// ErrDocumentUnavailable is returned by Fetcher.Fetch for documents answered with an HTTP error, and for
+	// documents missing in the Documents of an offline Fetcher.
+	ErrDocumentUnavailable = errors.New("document not available")
+	// ErrNotWSDL is returned by Fetcher.Fetch for documents which are neither WSDL definitions nor schemas.
+	ErrNotWSDL = errors.New("not a WSDL document")
+)
+
+// ImportError is returned by Fetcher.Fetch for a document which failed to load. Chain holds the locations of
+// the documents from the one fetched to the failed one, each importing the next.
+type ImportError struct {
+	Chain []string
+	Err   error
+}
+
+func (e *ImportError) Error() string {
+	return strings.Join(e.Chain, " -> ") + ": " + e.Err.Error()
+}
+
+func (e *ImportError) Unwrap() error {
+	return e.Err
+}
+
+// Fetcher loads WSDL documents from URLs with the documents they import: the wsdl:import elements, and the
+// xsd:import and xsd:include elements with a schemaLocation of the schemas. The imported definitions and
+// schemas are added to the ones of the fetched document. Each document is loaded once. The zero value
+// fetches with http.DefaultClient and the default limits, importing from the host of the fetched document.
+//
+// WSDL documents are often served by the services they describe, so their imports are not to be trusted:
+// AllowedHosts keeps them from making the Fetcher request internal URLs, including through redirects.
+type Fetcher struct {
+	// Client is the client of the requests, http.DefaultClient if nil.
+	Client *http.Client
+	// Timeout bounds the fetch of all documents, ImportTimeout the one of each document. No limit applies if
+	// they are 0, besides the ones of the context and Client.
+	Timeout       time.Duration
+	ImportTimeout time.Duration
+	// MaxImports is the number of documents imported at most, DefaultMaxImports if 0.
+	MaxImports int
+	// MaxDocumentSize is the size of each document read at most, DefaultMaxDocumentSize if 0.
+	MaxDocumentSize int64
+	// AllowedHosts are the hosts, with or without port, documents are fetched from. If empty, documents are
+	// fetched from the host of the location given to Fetch only.
+	AllowedHosts []string
+	// Documents holds documents fetched already by their absolute URL, used instead of requesting them.
+	Documents map[string][]byte
+	// Offline resolves all documents from Documents, nothing is requested.
+	Offline bool
+	// Cache holds the documents requested with an ETag, revalidated instead of requested again, if not nil.
+	Cache *Cache
+}
+
+// Fetch loads the WSDL document at the absolute URL location with its imports.
+func (f *Fetcher) Fetch(ctx context.Context, location string) (*Definitions, error) {
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	u, err := url.Parse(location)
+	if err != nil || !u.IsAbs() {
+		err := fmt.Errorf("%w: location is not an absolute URL", ErrImportNotAllowed)
+		return nil, &ImportError{Chain: []string{location}, Err: err}
+	}
+	allowed := f.AllowedHosts
+	if len(allowed) == 0 {
+		allowed = []string{u.Host}
+	}
+	ft := &fetch{Fetcher: f, allowed: allowed, seen: map[string]bool{u.String(): true}}
+	ft.client = ft.httpClient()
+	if err := ft.load(ctx, []string{u.String()}); err != nil {
+		return nil, err
+	}
+	return ft.defs, nil
+}
+
+// fetch is the state of a Fetcher.Fetch call.
+type fetch struct {
+	*Fetcher
+	client  *http.Client
+	allowed []string
+	defs    *Definitions
+	seen    map[string]bool
+	imports int
+}
+
+// httpClient returns the client of the requests, checking the locations of redirects against the allowed hosts.
+func (ft *fetch) httpClient() *http.Client {
+	client := http.DefaultClient
+	if ft.Client != nil {
+		client = ft.Client
+	}
+	c := *client
+	c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if err := ft.checkHost(req.URL); err != nil {
+			return fmt.Errorf("redirect to %s: %w", req.URL, err)
+		}
+		if client.CheckRedirect != nil {
+			return client.CheckRedirect(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &c
+}
+
+// checkHost returns ErrImportNotAllowed if documents are not requested from u.
+func (ft *fetch) checkHost(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: scheme %s", ErrImportNotAllowed, u.Scheme)
+	}
+	if !slices.Contains(ft.allowed, u.Host) && !slices.Contains(ft.allowed, u.Hostname()) {
+		return fmt.Errorf("%w: host %s", ErrImportNotAllowed, u.Host)
+	}
+	return nil
+}
+
+// load loads the last document of chain and the documents it imports.
+func (ft *fetch) load(ctx context.Context, chain []string) error {
+	location := chain[len(chain)-1]
+	data, err := ft.read(ctx, location)
+	if err != nil {
+		return &ImportError{Chain: chain, Err: err}
+	}
+	defs, schema, err := parseDocument(data)
+	if err == nil && ft.defs == nil && defs == nil {
+		err = fmt.Errorf("%w: schema document", ErrNotWSDL)
+	}
+	if err != nil {
+		return &ImportError{Chain: chain, Err: err}
+	}
+	var refs []string
+	switch {
+	case ft.defs == nil:
+		ft.defs = defs
+		refs = defs.importLocations()
+	case defs != nil:
+		ft.defs.merge(defs)
+		refs = defs.importLocations()
+	default:
+		if ft.defs.Types == nil {
+			ft.defs.Types = &Types{}
+		}
+		ft.defs.Types.Schemas = append(ft.defs.Types.Schemas, *schema)
+		refs = schema.importLocations()
+	}
+
+	base, _ := url.Parse(location)
+	for _, ref := range refs {
+		u, err := base.Parse(ref)
+		if err != nil {
+			return &ImportError{Chain: append(slices.Clone(chain), ref), Err: err}
+		}
+		if ft.seen[u.String()] {
+			continue
+		}
+		ft.seen[u.String()] = true
+		next := append(slices.Clone(chain), u.String())
+		limit := ft.MaxImports
+		if limit == 0 {
+			limit = DefaultMaxImports
+		}
+		if ft.imports++; ft.imports > limit {
+			return &ImportError{Chain: next, Err: ErrTooManyImports}
+		}
+		if err := ft.load(ctx, next); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read returns the document at location, from Documents or requested.
+func (ft *fetch) read(ctx context.Context, location string) ([]byte, error) {
+	limit := ft.MaxDocumentSize
+	if limit == 0 {
+		limit = DefaultMaxDocumentSize
+	}
+	if data, ok := ft.Documents[location]; ok {
+		if int64(len(data)) > limit {
+			return nil, ErrDocumentTooLarge
+		}
+		return data, nil
+	}
+	if ft.Offline {
+		return nil, fmt.Errorf("%w: offline", ErrDocumentUnavailable)
+	}
+	u, _ := url.Parse(location)
+	if err := ft.checkHost(u); err != nil {
+		return nil, err
+	}
+	if ft.ImportTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ft.ImportTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	cached, hasCached := ft.Cache.get(location)
+	if hasCached {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+	resp, err := ft.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotModified && hasCached:
+		return cached.data, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%w: %s", ErrDocumentUnavailable, resp.Status)
+	case resp.ContentLength > limit:
+		return nil, ErrDocumentTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, ErrDocumentTooLarge
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		ft.Cache.put(location, cacheEntry{etag: etag, data: data})
+	}
+	return data, nil
+}
+
+// parseDocument reads a WSDL document or a schema, setting defs or schema by the document element.
+func parseDocument(data []byte) (defs *Definitions, schema *Schema, err error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name {
+		case xml.Name{Space: wsdlNS, Local: "definitions"}:
+			defs = &Definitions{}
+			return defs, nil, dec.DecodeElement(defs, &start)
+		case xml.Name{Space: xsdNS, Local: "schema"}:
+			schema = &Schema{}
+			return nil, schema, dec.DecodeElement(schema, &start)
+		}
+		return nil, nil, fmt.Errorf("%w: document element %s", ErrNotWSDL, start.Name.Local)
+	}
+}
+
+// importLocations returns the locations of the documents imported by the definitions and their schemas.
+func (d *Definitions) importLocations() []string {
+	var locations []string
+	for _, imp := range d.Imports {
+		if imp.Location != "" {
+			locations = append(locations, imp.Location)
+		}
+	}
+	if d.Types != nil {
+		for i := range d.Types.Schemas {
+			locations = append(locations, d.Types.Schemas[i].importLocations()...)
+		}
+	}
+	return locations
+}
+
+// importLocations returns the locations of the schemas imported and included by the schema.
+func (s *Schema) importLocations() []string {
+	var locations []string
+	for _, ref := range slices.Concat(s.Imports, s.Includes) {
+		if ref.SchemaLocation != "" {
+			locations = append(locations, ref.SchemaLocation)
+		}
+	}
+	return locations
+}
+
+// merge adds the definitions imported to d.
+func (d *Definitions) merge(imported *Definitions) {
+	d.Messages = append(d.Messages, imported.Messages...)
+	d.PortTypes = append(d.PortTypes, imported.PortTypes...)
+	d.Bindings = append(d.Bindings, imported.Bindings...)
+	d.Services = append(d.Services, imported.Services...)
+	if imported.Types != nil {
+		if d.Types == nil {
+			d.Types = &Types{}
+		}
+		d.Types.Schemas = append(d.Types.Schemas, imported.Types.Schemas...)
+	}
+}
+
+// Cache holds the documents requested by Fetchers which were served with an ETag, by their URL. Cached
+// documents are requested with If-None-Match, and used if they were not modified. A Cache is safe for
+// concurrent use, the zero value is empty.
+type Cache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	etag string
+	data []byte
+}
+
+// get returns the cached document at location, ok is false if there is none or c is nil.
+func (c *Cache) get(location string) (_ cacheEntry, ok bool) {
+	if c == nil {
+		return cacheEntry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[location]
+	return e, ok
+}
+
+func (c *Cache) put(location string, e cacheEntry) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]cacheEntry)
+	}
+	c.entries[location] = e
+}
@@ -0,0 +1,209 @@
+package wsdl
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	fetchService = `<definitions xmlns="http://schemas.xmlsoap.org/wsdl/" xmlns:xs="http://www.w3.org/2001/XMLSchema"
+    targetNamespace="urn:orders">
+  <import namespace="urn:orders" location="binding.wsdl"/>
+  <types><xs:schema targetNamespace="urn:orders"><xs:import namespace="urn:types" schemaLocation="xsd/types.xsd"/>
+  </xs:schema></types>
+</definitions>`
+	fetchBinding = `<definitions xmlns="http://schemas.xmlsoap.org/wsdl/"
+    xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/" targetNamespace="urn:orders">
+  <import namespace="urn:orders" location="service.wsdl"/>
+  <binding name="OrdersBinding" type="tns:Orders"><soap:binding style="document"/>
+    <operation name="GetOrder"><soap:operation soapAction="urn:GetOrder"/></operation>
+  </binding>
+</definitions>`
+	fetchTypes = `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" targetNamespace="urn:types">
+  <xs:include schemaLocation="order.xsd"/>
+</xs:schema>`
+	fetchOrder = `<xs:schema xmlns:xs="http://www.w3.org/2001/XMLSchema" targetNamespace="urn:types">
+  <xs:element name="GetOrder"/>
+</xs:schema>`
+)
+
+// newDocumentServer serves the documents by path, with an ETag, and counts the requests by path.
+func newDocumentServer(t *testing.T, docs map[string]string) (*httptest.Server, func(path string) int) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(doc))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return requests[path]
+	}
+}
+
+var fetchDocuments = map[string]string{
+	"/service.wsdl":   fetchService,
+	"/binding.wsdl":   fetchBinding,
+	"/xsd/types.xsd":  fetchTypes,
+	"/xsd/order.xsd":  fetchOrder,
+	"/external.wsdl":  strings.Replace(fetchService, "binding.wsdl", "http://169.254.169.254/latest/meta-data", 1),
+	"/unknown.wsdl":   strings.Replace(fetchService, "binding.wsdl", "missing.wsdl", 1),
+	"/file.wsdl":      strings.Replace(fetchService, "binding.wsdl", "file:///etc/passwd", 1),
+	"/not-wsdl.wsdl":  strings.Replace(fetchService, "binding.wsdl", "page.html", 1),
+	"/page.html":      "<html><body>Orders</body></html>",
+	"/schema-root.xs": fetchOrder,
+}
+
+func TestFetch(t *testing.T) {
+	srv, requests := newDocumentServer(t, fetchDocuments)
+	defs, err := (&Fetcher{}).Fetch(context.Background(), srv.URL+"/service.wsdl")
+	require.NoError(t, err)
+	assert.Equal(t, []Operation{{Binding: "OrdersBinding", Name: "GetOrder", Action: "urn:GetOrder"}}, defs.Operations())
+	require.NotNil(t, defs.element("GetOrder"))
+	assert.Len(t, defs.Types.Schemas, 3)
+	// the import of the service by the binding is not followed again
+	assert.Equal(t, 1, requests("/service.wsdl"))
+}
+
+func TestFetchErrors(t *testing.T) {
+	srv, _ := newDocumentServer(t, fetchDocuments)
+	tests := []struct {
+		name    string
+		fetcher Fetcher
+		path    string
+		chain   []string
+		err     error
+	}{
+		{name: "host not allowed", path: "/external.wsdl",
+			chain: []string{"/external.wsdl", "http://169.254.169.254/latest/meta-data"}, err: ErrImportNotAllowed},
+		{name: "scheme not allowed", path: "/file.wsdl", chain: []string{"/file.wsdl", "file:///etc/passwd"},
+			err: ErrImportNotAllowed},
+		{name: "fetched host not allowed", fetcher: Fetcher{AllowedHosts: []string{"example.com"}}, path: "/service.wsdl",
+			chain: []string{"/service.wsdl"}, err: ErrImportNotAllowed},
+		{name: "missing", path: "/unknown.wsdl", chain: []string{"/unknown.wsdl", "/missing.wsdl"},
+			err: ErrDocumentUnavailable},
+		{name: "not wsdl", path: "/not-wsdl.wsdl", chain: []string{"/not-wsdl.wsdl", "/page.html"}, err: ErrNotWSDL},
+		{name: "schema", path: "/schema-root.xs", chain: []string{"/schema-root.xs"}, err: ErrNotWSDL},
+		{name: "too many imports", fetcher: Fetcher{MaxImports: 2}, path: "/service.wsdl",
+			chain: []string{"/service.wsdl", "/xsd/types.xsd", "/xsd/order.xsd"}, err: ErrTooManyImports},
+		{name: "too large", fetcher: Fetcher{MaxDocumentSize: int64(len(fetchService))}, path: "/service.wsdl",
+			chain: []string{"/service.wsdl", "/binding.wsdl"}, err: ErrDocumentTooLarge},
+		{name: "offline", fetcher: Fetcher{Offline: true, Documents: map[string][]byte{
+			srv.URL + "/service.wsdl": []byte(fetchService),
+		}}, path: "/service.wsdl", chain: []string{"/service.wsdl", "/binding.wsdl"}, err: ErrDocumentUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.fetcher.Fetch(context.Background(), srv.URL+tt.path)
+			assert.ErrorIs(t, err, tt.err)
+			var importErr *ImportError
+			if assert.ErrorAs(t, err, &importErr) {
+				var chain []string
+				for _, location := range importErr.Chain {
+					chain = append(chain, strings.TrimPrefix(location, srv.URL))
+				}
+				assert.Equal(t, tt.chain, chain)
+			}
+		})
+	}
+}
+
+func TestFetchRedirect(t *testing.T) {
+	internal := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(fetchBinding))
+	}))
+	t.Cleanup(internal.Close)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/binding.wsdl" {
+			http.Redirect(w, r, internal.URL+"/binding.wsdl", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte(strings.Replace(fetchService, `schemaLocation="xsd/types.xsd"`, "", 1)))
+	}))
+	t.Cleanup(srv.Close)
+
+	_, err := (&Fetcher{}).Fetch(context.Background(), srv.URL+"/service.wsdl")
+	assert.ErrorIs(t, err, ErrImportNotAllowed)
+	assert.ErrorContains(t, err, "redirect to "+internal.URL)
+
+	// redirects to allowed hosts are followed
+	fetcher := &Fetcher{AllowedHosts: []string{srv.Listener.Addr().String(), internal.Listener.Addr().String()}}
+	defs, err := fetcher.Fetch(context.Background(), srv.URL+"/service.wsdl")
+	require.NoError(t, err)
+	assert.Len(t, defs.Operations(), 1)
+}
+
+func TestFetchTimeouts(t *testing.T) {
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/binding.wsdl" {
+			select {
+			case <-block:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		_, _ = w.Write([]byte(fetchService))
+	}))
+	t.Cleanup(srv.Close)
+
+	for _, fetcher := range []*Fetcher{{ImportTimeout: 50 * time.Millisecond}, {Timeout: 50 * time.Millisecond}} {
+		_, err := fetcher.Fetch(context.Background(), srv.URL+"/service.wsdl")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		var importErr *ImportError
+		if assert.ErrorAs(t, err, &importErr) {
+			assert.Equal(t, []string{srv.URL + "/service.wsdl", srv.URL + "/binding.wsdl"}, importErr.Chain)
+		}
+	}
+}
+
+func TestFetchOffline(t *testing.T) {
+	docs := map[string][]byte{}
+	for path, doc := range fetchDocuments {
+		docs["https://orders.example.com"+path] = []byte(doc)
+	}
+	fetcher := &Fetcher{Offline: true, Documents: docs}
+	defs, err := fetcher.Fetch(context.Background(), "https://orders.example.com/service.wsdl")
+	require.NoError(t, err)
+	assert.Len(t, defs.Operations(), 1)
+	assert.NotNil(t, defs.element("GetOrder"))
+}
+
+func TestFetchCache(t *testing.T) {
+	srv, requests := newDocumentServer(t, fetchDocuments)
+	cache := &Cache{}
+	for range 2 {
+		defs, err := (&Fetcher{Cache: cache}).Fetch(context.Background(), srv.URL+"/service.wsdl")
+		require.NoError(t, err)
+		assert.Len(t, defs.Operations(), 1)
+		assert.NotNil(t, defs.element("GetOrder"))
+	}
+	assert.Equal(t, 2, requests("/binding.wsdl"))
+	cached, ok := cache.get(srv.URL + "/binding.wsdl")
+	require.True(t, ok)
+	assert.Equal(t, fetchBinding, string(cached.data))
+}
@@ -0,0 +1,153 @@
+package wsdl
+
+// Types holds the XML schemas embedded in a WSDL document. Only the element structure is read: elements,
+// complex types with sequence, all and choice groups, and complex content extensions.
+type Types struct {
+	Schemas []Schema `xml:"http://www.w3.org/2001/XMLSchema schema"`
+}
+
+// Schema is an embedded XML schema.
+type Schema struct {
+	TargetNamespace string        `xml:"targetNamespace,attr"`
+	Imports         []SchemaRef   `xml:"http://www.w3.org/2001/XMLSchema import"`
+	Includes        []SchemaRef   `xml:"http://www.w3.org/2001/XMLSchema include"`
+	Elements        []Element     `xml:"http://www.w3.org/2001/XMLSchema element"`
+	ComplexTypes    []ComplexType `xml:"http://www.w3.org/2001/XMLSchema complexType"`
+}
+
+// SchemaRef is an import or include of another schema, resolved by a Fetcher if it has a location.
+type SchemaRef struct {
+	Namespace      string `xml:"namespace,attr"`
+	SchemaLocation string `xml:"schemaLocation,attr"`
+}
+
+// Element is an element declaration, global or local to a complex type.
+type Element struct {
+	Name string `xml:"name,attr"`
+	// Type is the qualified name of the type, Ref the one of the referenced global element.
+	Type        string       `xml:"type,attr"`
+	Ref         string       `xml:"ref,attr"`
+	MinOccurs   string       `xml:"minOccurs,attr"`
+	Nillable    bool         `xml:"nillable,attr"`
+	ComplexType *ComplexType `xml:"http://www.w3.org/2001/XMLSchema complexType"`
+}
+
+// Required reports whether the element has to occur at least once.
+func (e *Element) Required() bool {
+	return e.MinOccurs != "0"
+}
+
+// ComplexType is a complex type definition, named or anonymous.
+type ComplexType struct {
+	Name           string          `xml:"name,attr"`
+	Sequence       *Group          `xml:"http://www.w3.org/2001/XMLSchema sequence"`
+	All            *Group          `xml:"http://www.w3.org/2001/XMLSchema all"`
+	Choice         *Group          `xml:"http://www.w3.org/2001/XMLSchema choice"`
+	ComplexContent *ComplexContent `xml:"http://www.w3.org/2001/XMLSchema complexContent"`
+}
+
+// Group is a sequence, all or choice model group.
+type Group struct {
+	MinOccurs string    `xml:"minOccurs,attr"`
+	Elements  []Element `xml:"http://www.w3.org/2001/XMLSchema element"`
+	Sequences []Group   `xml:"http://www.w3.org/2001/XMLSchema sequence"`
+	Choices   []Group   `xml:"http://www.w3.org/2001/XMLSchema choice"`
+}
+
+// ComplexContent is the complex content of a type derived from another one.
+type ComplexContent struct {
+	Extension *Extension `xml:"http://www.w3.org/2001/XMLSchema extension"`
+}
+
+// Extension extends the content of its base type.
+type Extension struct {
+	Base     string `xml:"base,attr"`
+	Sequence *Group `xml:"http://www.w3.org/2001/XMLSchema sequence"`
+	All      *Group `xml:"http://www.w3.org/2001/XMLSchema all"`
+	Choice   *Group `xml:"http://www.w3.org/2001/XMLSchema choice"`
+}
+
+// element returns the global element named by the qualified name, or nil.
+func (d *Definitions) element(qname string) *Element {
+	if d.Types == nil {
+		return nil
+	}
+	name := localName(qname)
+	for i := range d.Types.Schemas {
+		for j := range d.Types.Schemas[i].Elements {
+			if e := &d.Types.Schemas[i].Elements[j]; e.Name == name {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+// complexType returns the named complex type, or nil.
+func (d *Definitions) complexType(qname string) *ComplexType {
+	if d.Types == nil || qname == "" {
+		return nil
+	}
+	name := localName(qname)
+	for i := range d.Types.Schemas {
+		for j := range d.Types.Schemas[i].ComplexTypes {
+			if t := &d.Types.Schemas[i].ComplexTypes[j]; t.Name == name {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// resolve returns the declaration holding the content of e, following element references.
+func (d *Definitions) resolve(e *Element) *Element {
+	if e.Ref == "" {
+		return e
+	}
+	if ref := d.element(e.Ref); ref != nil {
+		return ref
+	}
+	return e
+}
+
+// contentType returns the complex type of the resolved element e, nil for simple types.
+func (d *Definitions) contentType(e *Element) *ComplexType {
+	if e.ComplexType != nil {
+		return e.ComplexType
+	}
+	return d.complexType(e.Type)
+}
+
+// requiredChildren returns the child elements of t that have to occur, including the ones of base types.
+// The elements of choices are never required.
+func (d *Definitions) requiredChildren(t *ComplexType, seen map[*ComplexType]bool) []*Element {
+	if t == nil || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	defer delete(seen, t)
+	var required []*Element
+	if ext := t.ComplexContent; ext != nil && ext.Extension != nil {
+		required = append(required, d.requiredChildren(d.complexType(ext.Extension.Base), seen)...)
+		required = append(required, requiredInGroup(ext.Extension.Sequence)...)
+		required = append(required, requiredInGroup(ext.Extension.All)...)
+	}
+	required = append(required, requiredInGroup(t.Sequence)...)
+	return append(required, requiredInGroup(t.All)...)
+}
+
+func requiredInGroup(g *Group) []*Element {
+	if g == nil || g.MinOccurs == "0" {
+		return nil
+	}
+	var required []*Element
+	for i := range g.Elements {
+		if g.Elements[i].Required() {
+			required = append(required, &g.Elements[i])
+		}
+	}
+	for i := range g.Sequences {
+		required = append(required, requiredInGroup(&g.Sequences[i])...)
+	}
+	return required
+}
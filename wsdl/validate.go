@@ -0,0 +1,258 @@
+package wsdl
+
+import (
+	"encoding"
+	"errors"
+	"reflect"
+	"strings"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+	"github.com/m29h/xml"
+)
+
+var (
+	// ErrMissingElements is returned for requests lacking required elements.
+	// The returned error is a *MissingElementsError.
+	ErrMissingElements = errors.New("missing required elements")
+)
+
+// MissingElementsError lists the required elements missing in a request, as slash separated paths starting
+// at the request element, e.g. "GetOrder/Customer/ID".
+type MissingElementsError struct {
+	Paths []string
+}
+
+func (e *MissingElementsError) Error() string {
+	return ErrMissingElements.Error() + ": " + strings.Join(e.Paths, ", ")
+}
+
+func (e *MissingElementsError) Unwrap() error {
+	return ErrMissingElements
+}
+
+// Validator returns a request validator for soap.WithRequestValidator, checking request structs for required
+// elements of the schema which are missing. The request element is the input element of the operation of the
+// action on the binding, or the global element named like the request if the action is unknown. Requests
+// without element declaration are not checked.
+//
+// Struct fields are matched by the local name of their xml tag or the field name. Nil pointers, interfaces,
+// maps and empty slices count as missing, as do empty strings and zero values of types marshaling themselves,
+// such as time.Time, unless their path is in allowZero. Numbers and booleans always count as present. Tags with
+// paths (a>b) are not supported, structs with an ",any" or ",innerxml" field are assumed to hold the elements
+// not matched by a field.
+//
+// The soap.Enum values of all requests are checked with soap.ValidateEnums as well, the error then joins the
+// *MissingElementsError and the *soap.EnumValueError of every invalid value.
+func (d *Definitions) Validator(binding string, allowZero ...string) func(action string, request any) error {
+	allowed := make(map[string]bool, len(allowZero))
+	for _, p := range allowZero {
+		allowed[p] = true
+	}
+	return func(action string, request any) error {
+		enumErr := soap.ValidateEnums(request)
+		name := requestName(request)
+		el := d.inputElement(binding, action, name)
+		if el == nil {
+			return enumErr
+		}
+		v := &validation{defs: d, allowed: allowed}
+		v.check(el.Name, reflect.ValueOf(request), el)
+		if len(v.missing) == 0 {
+			return enumErr
+		}
+		if enumErr != nil {
+			return errors.Join(&MissingElementsError{Paths: v.missing}, enumErr)
+		}
+		return &MissingElementsError{Paths: v.missing}
+	}
+}
+
+type validation struct {
+	defs    *Definitions
+	allowed map[string]bool
+	missing []string
+}
+
+// check records the missing required children of the element el below path, with val holding its content.
+func (v *validation) check(path string, val reflect.Value, el *Element) {
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return
+		}
+		val = val.Elem()
+	}
+	if val.Kind() == reflect.Slice || val.Kind() == reflect.Array {
+		if val.Type().Elem().Kind() != reflect.Uint8 {
+			for i := 0; i < val.Len(); i++ {
+				v.check(path, val.Index(i), el)
+			}
+		}
+		return
+	}
+	if val.Kind() != reflect.Struct {
+		return
+	}
+	required := v.defs.requiredChildren(v.defs.contentType(v.defs.resolve(el)), map[*ComplexType]bool{})
+	if len(required) == 0 {
+		return
+	}
+	fields, open := elementFields(val.Type())
+	for _, child := range required {
+		name := child.Name
+		if child.Ref != "" {
+			name = localName(child.Ref)
+		}
+		childPath := path + "/" + name
+		index, ok := fields[name]
+		if !ok {
+			if !open {
+				v.missing = append(v.missing, childPath)
+			}
+			continue
+		}
+		field := val.FieldByIndex(index)
+		if !present(field) && !v.allowed[childPath] {
+			v.missing = append(v.missing, childPath)
+			continue
+		}
+		v.check(childPath, field, child)
+	}
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*xml.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// present reports whether the field value is sent as element with content.
+func present(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map:
+		return !v.IsNil()
+	case reflect.Slice:
+		return v.Len() > 0
+	case reflect.String:
+		return v.Len() > 0
+	case reflect.Struct:
+		t := v.Type()
+		if t.Implements(marshalerType) || t.Implements(textMarshalerType) ||
+			reflect.PointerTo(t).Implements(marshalerType) || reflect.PointerTo(t).Implements(textMarshalerType) {
+			return !v.IsZero()
+		}
+	}
+	return true
+}
+
+// elementFields maps the local element names of the fields of the struct type t to their index. It reports
+// whether t has a field catching any other elements.
+func elementFields(t reflect.Type) (map[string][]int, bool) {
+	fields := map[string][]int{}
+	open := false
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("xml")
+		if tag == "-" || !f.IsExported() && !f.Anonymous || f.Name == "XMLName" {
+			continue
+		}
+		name, flags, _ := strings.Cut(tag, ",")
+		if strings.Contains(flags, "any") || strings.Contains(flags, "innerxml") {
+			open = true
+			continue
+		}
+		if strings.Contains(flags, "attr") || strings.Contains(flags, "chardata") || strings.Contains(flags, "comment") {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded, embeddedOpen := elementFields(ft)
+				for n, index := range embedded {
+					if _, ok := fields[n]; !ok {
+						fields[n] = append([]int{i}, index...)
+					}
+				}
+				open = open || embeddedOpen
+				continue
+			}
+		}
+		if parts := strings.Fields(name); len(parts) == 2 {
+			name = parts[1]
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Index
+	}
+	return fields, open
+}
+
+// requestName returns the local name of the element request is serialized to.
+func requestName(request any) string {
+	t := reflect.TypeOf(request)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return ""
+	}
+	if f, ok := t.FieldByName("XMLName"); ok {
+		if parts := strings.Fields(strings.Split(f.Tag.Get("xml"), ",")[0]); len(parts) > 0 {
+			return parts[len(parts)-1]
+		}
+	}
+	return t.Name()
+}
+
+// inputElement returns the element of the input of the operation with action on binding, or the global element
+// named name if no operation has the action.
+func (d *Definitions) inputElement(binding, action, name string) *Element {
+	if op := d.operation(binding, action); op != nil {
+		for _, m := range d.Messages {
+			if m.Name != localName(op.Input.Message) {
+				continue
+			}
+			for _, p := range m.Parts {
+				if p.Element != "" && (len(m.Parts) == 1 || localName(p.Element) == name) {
+					return d.element(p.Element)
+				}
+			}
+		}
+	}
+	if name == "" {
+		return nil
+	}
+	return d.element(name)
+}
+
+// operation returns the port type operation bound with action on binding, or nil. Operations are also
+// matched by name.
+func (d *Definitions) operation(binding, action string) *PortTypeOperation {
+	if action == "" {
+		return nil
+	}
+	for _, b := range d.Bindings {
+		if b.Name != binding {
+			continue
+		}
+		for _, op := range b.Operations {
+			if op.Name != action && (op.SOAP == nil || op.SOAP.SOAPAction != action) &&
+				(op.SOAP12 == nil || op.SOAP12.SOAPAction != action) {
+				continue
+			}
+			for i := range d.PortTypes {
+				if d.PortTypes[i].Name != localName(b.Type) {
+					continue
+				}
+				for j := range d.PortTypes[i].Operations {
+					if pt := &d.PortTypes[i].Operations[j]; pt.Name == op.Name {
+						return pt
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
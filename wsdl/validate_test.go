@@ -0,0 +1,153 @@
+package wsdl
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type party struct {
+	ID   string `xml:"ID"`
+	Name string `xml:"Name,omitempty"`
+}
+
+type customer struct {
+	party
+	Segment string `xml:"Segment"`
+}
+
+type orderLine struct {
+	ItemNo   string `xml:"ItemNo"`
+	Quantity int    `xml:"Quantity"`
+}
+
+type placeOrder struct {
+	XMLName  xml.Name    `xml:"http://example.com/orders PlaceOrder"`
+	Customer *customer   `xml:"Customer"`
+	Lines    []orderLine `xml:"Line"`
+	Delivery *time.Time  `xml:"Delivery"`
+	Comment  string      `xml:"Comment"`
+	Express  bool        `xml:"Express,omitempty"`
+}
+
+func loadOrders(t *testing.T) *Definitions {
+	f, err := os.Open("testdata/orders.wsdl")
+	require.NoError(t, err)
+	defer f.Close()
+	defs, err := Parse(f)
+	require.NoError(t, err)
+	return defs
+}
+
+func completeOrder() *placeOrder {
+	delivery := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	return &placeOrder{
+		Customer: &customer{party: party{ID: "C1"}, Segment: "retail"},
+		Lines:    []orderLine{{ItemNo: "I1", Quantity: 0}},
+		Delivery: &delivery,
+		Comment:  "none",
+	}
+}
+
+func TestValidator(t *testing.T) {
+	validate := loadOrders(t).Validator("OrdersSoapBinding")
+	tests := []struct {
+		name    string
+		action  string
+		request func(o *placeOrder)
+		missing []string
+	}{
+		{name: "complete", action: "http://example.com/orders/PlaceOrder", request: func(*placeOrder) {}},
+		{name: "by operation name", action: "PlaceOrder", request: func(o *placeOrder) { o.Comment = "" },
+			missing: []string{"PlaceOrder/Comment"}},
+		{name: "by element name", request: func(o *placeOrder) { o.Comment = "" }, missing: []string{"PlaceOrder/Comment"}},
+		{name: "nil pointers and empty slices", action: "PlaceOrder", request: func(o *placeOrder) {
+			o.Customer, o.Lines, o.Delivery = nil, nil, nil
+		}, missing: []string{"PlaceOrder/Customer", "PlaceOrder/Line", "PlaceOrder/Delivery"}},
+		{name: "nested and base type", action: "PlaceOrder", request: func(o *placeOrder) {
+			o.Customer.ID, o.Customer.Segment = "", ""
+			o.Lines = append(o.Lines, orderLine{Quantity: 2})
+		}, missing: []string{"PlaceOrder/Customer/ID", "PlaceOrder/Customer/Segment", "PlaceOrder/Line/ItemNo"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := completeOrder()
+			tt.request(o)
+			err := validate(tt.action, o)
+			if tt.missing == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var missing *MissingElementsError
+			if assert.ErrorAs(t, err, &missing) {
+				assert.Equal(t, tt.missing, missing.Paths)
+			}
+			assert.ErrorIs(t, err, ErrMissingElements)
+		})
+	}
+}
+
+func TestValidatorAllowZero(t *testing.T) {
+	o := completeOrder()
+	o.Comment = ""
+	assert.NoError(t, loadOrders(t).Validator("OrdersSoapBinding", "PlaceOrder/Comment")("PlaceOrder", o))
+}
+
+func TestValidatorUnknownRequest(t *testing.T) {
+	validate := loadOrders(t).Validator("OrdersSoapBinding")
+	assert.NoError(t, validate("Other", &struct {
+		XMLName xml.Name `xml:"urn:other Other"`
+	}{}))
+}
+
+type priority string
+
+func (priority) Values() []priority { return []priority{"LOW", "HIGH"} }
+
+type prioritizedOrder struct {
+	placeOrder
+	Priority soap.Enum[priority] `xml:"Priority"`
+}
+
+func TestValidatorEnums(t *testing.T) {
+	validate := loadOrders(t).Validator("OrdersSoapBinding")
+	o := &prioritizedOrder{placeOrder: *completeOrder(), Priority: soap.NewEnum[priority]("HIGH")}
+	assert.NoError(t, validate("PlaceOrder", o))
+
+	o.Priority = soap.NewEnum[priority]("URGENT")
+	o.Customer = nil
+	err := validate("PlaceOrder", o)
+	var missing *MissingElementsError
+	assert.ErrorAs(t, err, &missing)
+	var enumErr *soap.EnumValueError
+	if assert.ErrorAs(t, err, &enumErr) {
+		assert.Equal(t, "prioritizedOrder.Priority", enumErr.Field)
+	}
+
+	// the enums of requests without element declaration are checked as well
+	assert.ErrorIs(t, validate("Other", &struct {
+		XMLName  xml.Name            `xml:"urn:other Other"`
+		Priority soap.Enum[priority] `xml:"Priority"`
+	}{}), soap.ErrInvalidEnum)
+}
+
+func TestNewClient(t *testing.T) {
+	defs := loadOrders(t)
+	client, err := NewClient(defs, "OrdersPort")
+	require.NoError(t, err)
+	o := completeOrder()
+	o.Customer.ID = ""
+	// the request is rejected before connecting to the address of the port
+	err = client.Do(context.Background(), "http://example.com/orders/PlaceOrder", o, &struct{}{})
+	assert.ErrorIs(t, err, ErrMissingElements)
+
+	_, err = NewClient(defs, "Missing")
+	assert.True(t, errors.Is(err, ErrPortNotFound))
+}
@@ -0,0 +1,172 @@
+// Package wsdl reads the operations of WSDL 1.1 service descriptions.
+package wsdl
+
+import (
+	"io"
+	"strings"
+
+	"github.com/m29h/xml"
+)
+
+// Definitions is the root of a WSDL 1.1 document.
+type Definitions struct {
+	XMLName         xml.Name   `xml:"http://schemas.xmlsoap.org/wsdl/ definitions"`
+	Name            string     `xml:"name,attr"`
+	TargetNamespace string     `xml:"targetNamespace,attr"`
+	Imports         []Import   `xml:"http://schemas.xmlsoap.org/wsdl/ import"`
+	Types           *Types     `xml:"http://schemas.xmlsoap.org/wsdl/ types"`
+	Messages        []Message  `xml:"http://schemas.xmlsoap.org/wsdl/ message"`
+	PortTypes       []PortType `xml:"http://schemas.xmlsoap.org/wsdl/ portType"`
+	Bindings        []Binding  `xml:"http://schemas.xmlsoap.org/wsdl/ binding"`
+	Services        []Service  `xml:"http://schemas.xmlsoap.org/wsdl/ service"`
+}
+
+// Import is a wsdl:import of the definitions of a namespace from another document, resolved by a Fetcher.
+type Import struct {
+	Namespace string `xml:"namespace,attr"`
+	Location  string `xml:"location,attr"`
+}
+
+// Message is an abstract message with its parts.
+type Message struct {
+	Name  string `xml:"name,attr"`
+	Parts []Part `xml:"http://schemas.xmlsoap.org/wsdl/ part"`
+}
+
+// Part is a part of a message, referencing a schema element for document/literal services.
+type Part struct {
+	Name    string `xml:"name,attr"`
+	Element string `xml:"element,attr"`
+	Type    string `xml:"type,attr"`
+}
+
+// PortType is an abstract set of operations.
+type PortType struct {
+	Name       string              `xml:"name,attr"`
+	Operations []PortTypeOperation `xml:"http://schemas.xmlsoap.org/wsdl/ operation"`
+}
+
+// PortTypeOperation is an abstract operation with its messages.
+type PortTypeOperation struct {
+	Name   string     `xml:"name,attr"`
+	Input  MessageRef `xml:"http://schemas.xmlsoap.org/wsdl/ input"`
+	Output MessageRef `xml:"http://schemas.xmlsoap.org/wsdl/ output"`
+}
+
+// MessageRef references a message by its qualified name.
+type MessageRef struct {
+	Message string `xml:"message,attr"`
+}
+
+// Binding binds a port type to SOAP.
+type Binding struct {
+	Name       string             `xml:"name,attr"`
+	Type       string             `xml:"type,attr"`
+	SOAP       *SOAPBinding       `xml:"http://schemas.xmlsoap.org/wsdl/soap/ binding"`
+	SOAP12     *SOAPBinding       `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ binding"`
+	Operations []BindingOperation `xml:"http://schemas.xmlsoap.org/wsdl/ operation"`
+}
+
+// SOAPBinding is the soap:binding extension element of a binding.
+type SOAPBinding struct {
+	Style     string `xml:"style,attr"`
+	Transport string `xml:"transport,attr"`
+}
+
+// BindingOperation is the SOAP binding of an operation.
+type BindingOperation struct {
+	Name   string         `xml:"name,attr"`
+	SOAP   *SOAPOperation `xml:"http://schemas.xmlsoap.org/wsdl/soap/ operation"`
+	SOAP12 *SOAPOperation `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ operation"`
+}
+
+// SOAPOperation is the soap:operation extension element of a binding operation.
+type SOAPOperation struct {
+	SOAPAction string `xml:"soapAction,attr"`
+	Style      string `xml:"style,attr"`
+}
+
+// Service lists the ports of a service.
+type Service struct {
+	Name  string `xml:"name,attr"`
+	Ports []Port `xml:"http://schemas.xmlsoap.org/wsdl/ port"`
+}
+
+// Port is an endpoint of a binding.
+type Port struct {
+	Name    string       `xml:"name,attr"`
+	Binding string       `xml:"binding,attr"`
+	Address *SOAPAddress `xml:"http://schemas.xmlsoap.org/wsdl/soap/ address"`
+	// Address12 is the address of a SOAP 1.2 port.
+	Address12 *SOAPAddress `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ address"`
+}
+
+// SOAPAddress is the soap:address extension element of a port.
+type SOAPAddress struct {
+	Location string `xml:"location,attr"`
+}
+
+// Operation is an operation as exposed by a SOAP binding.
+type Operation struct {
+	Binding string
+	Name    string
+	// Action is the SOAP action of the operation, it may be empty.
+	Action string
+	// SOAP12 is set for operations of a SOAP 1.2 binding.
+	SOAP12 bool
+}
+
+// Parse reads a WSDL 1.1 document.
+func Parse(r io.Reader) (*Definitions, error) {
+	var defs Definitions
+	if err := xml.NewDecoder(r).Decode(&defs); err != nil {
+		return nil, err
+	}
+	return &defs, nil
+}
+
+// Operations returns the operations of all SOAP bindings in document order.
+func (d *Definitions) Operations() []Operation {
+	var ops []Operation
+	for _, b := range d.Bindings {
+		if b.SOAP == nil && b.SOAP12 == nil {
+			continue
+		}
+		for _, op := range b.Operations {
+			o := Operation{Binding: b.Name, Name: op.Name, SOAP12: b.SOAP12 != nil}
+			if op.SOAP != nil {
+				o.Action = op.SOAP.SOAPAction
+			} else if op.SOAP12 != nil {
+				o.Action = op.SOAP12.SOAPAction
+			}
+			ops = append(ops, o)
+		}
+	}
+	return ops
+}
+
+// Endpoint returns the address of the first port using binding, or the empty string.
+func (d *Definitions) Endpoint(binding string) string {
+	for _, s := range d.Services {
+		for _, p := range s.Ports {
+			if localName(p.Binding) != binding {
+				continue
+			}
+			if p.Address != nil {
+				return p.Address.Location
+			}
+			if p.Address12 != nil {
+				return p.Address12.Location
+			}
+		}
+	}
+	return ""
+}
+
+// localName strips the prefix of a qualified name.
+func localName(qname string) string {
+	if i := strings.LastIndexByte(qname, ':'); i >= 0 {
+		return qname[i+1:]
+	}
+	return qname
+}
@@ -0,0 +1,34 @@
+package wsdl
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperations(t *testing.T) {
+	f, err := os.Open("testdata/stockquote.wsdl")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+
+	defs, err := Parse(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com/stockquote.wsdl", defs.TargetNamespace)
+	assert.Equal(t, []Operation{
+		{Binding: "StockQuoteSoapBinding", Name: "GetLastTradePrice", Action: "http://example.com/GetLastTradePrice"},
+		{Binding: "StockQuoteSoapBinding", Name: "GetHistory"},
+		{Binding: "StockQuoteSoap12Binding", Name: "GetLastTradePrice", Action: "http://example.com/GetLastTradePrice", SOAP12: true},
+	}, defs.Operations())
+	assert.Equal(t, "http://example.com/stockquote", defs.Endpoint("StockQuoteSoapBinding"))
+	assert.Equal(t, "http://example.com/stockquote12", defs.Endpoint("StockQuoteSoap12Binding"))
+	assert.Equal(t, "", defs.Endpoint("Missing"))
+}
+
+func TestParseNotWSDL(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<html><body>Not found</body></html>`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,80 @@
+package wsrm
+
+import (
+	"context"
+	"sync"
+)
+
+// Sequence is the state of a reliable messaging sequence.
+type Sequence struct {
+	// ID is the sequence identifier assigned by the service.
+	ID string
+	// LastMessageNumber is the number of the last message sent in the sequence.
+	LastMessageNumber uint64
+	// Acknowledged are the message number ranges last acknowledged by the service.
+	Acknowledged []Range
+}
+
+// Range is an inclusive range of message numbers.
+type Range struct {
+	Lower, Upper uint64
+}
+
+// acknowledged reports whether message number is within the acknowledged ranges.
+func (s *Sequence) acknowledged(number uint64) bool {
+	for _, r := range s.Acknowledged {
+		if r.Lower <= number && number <= r.Upper {
+			return true
+		}
+	}
+	return false
+}
+
+// Store persists the sequence of a Client, e.g. to continue a sequence after a restart.
+// Load returns nil without error if there is no sequence.
+type Store interface {
+	Load(ctx context.Context) (*Sequence, error)
+	Save(ctx context.Context, seq *Sequence) error
+	Delete(ctx context.Context) error
+}
+
+// MemoryStore keeps the sequence in memory.
+type MemoryStore struct {
+	mu  sync.Mutex
+	seq *Sequence
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+// Load returns a copy of the stored sequence.
+func (m *MemoryStore) Load(context.Context) (*Sequence, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.seq == nil {
+		return nil, nil
+	}
+	seq := *m.seq
+	seq.Acknowledged = append([]Range(nil), m.seq.Acknowledged...)
+	return &seq, nil
+}
+
+// Save stores a copy of seq.
+func (m *MemoryStore) Save(_ context.Context, seq *Sequence) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *seq
+	stored.Acknowledged = append([]Range(nil), seq.Acknowledged...)
+	m.seq = &stored
+	return nil
+}
+
+// Delete removes the stored sequence.
+func (m *MemoryStore) Delete(context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq = nil
+	return nil
+}
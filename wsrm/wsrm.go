@@ -0,0 +1,264 @@
+// Package wsrm provides minimal WS-ReliableMessaging 1.1 support for SOAP clients: a sequence is created on
+// the first call, every call carries a wsrm:Sequence header with an incrementing message number, and messages
+// not acknowledged by the service are sent again. It covers what is needed for request-reply sessions like
+// the default WCF reliable session binding, not the full specification.
+package wsrm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/m29h/xml"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+)
+
+const (
+	// Namespace is the WS-ReliableMessaging 1.1 namespace.
+	Namespace = "http://docs.oasis-open.org/ws-rx/wsrm/200702"
+
+	// ActionCreateSequence is the action of the CreateSequence request.
+	ActionCreateSequence = Namespace + "/CreateSequence"
+	// ActionTerminateSequence is the action of the TerminateSequence request.
+	ActionTerminateSequence = Namespace + "/TerminateSequence"
+
+	anonymous = "http://www.w3.org/2005/08/addressing/anonymous"
+
+	defaultRetransmissionInterval = time.Second
+	// maxRetransmissionInterval stops the doubling of the retransmission interval
+	maxRetransmissionInterval = time.Minute
+)
+
+var (
+	// ErrNotAcknowledged is returned if a message was not acknowledged after all retransmissions.
+	ErrNotAcknowledged = errors.New("wsrm: message not acknowledged")
+	// ErrClosed is returned by calls on a closed Client.
+	ErrClosed = errors.New("wsrm: client closed")
+)
+
+// Options configures a Client.
+type Options struct {
+	// MaxRetransmissions is the number of times an unacknowledged message is sent again. Default is 3.
+	MaxRetransmissions int
+	// RetransmissionInterval is the time waited before the first retransmission of a message, doubled for every
+	// further one up to a minute. Default is 1 second.
+	RetransmissionInterval time.Duration
+	// Clock is the source of time of the waits between the retransmissions. Default is the system clock.
+	Clock soap.Clock
+	// Store persists the sequence. Default is a MemoryStore.
+	Store Store
+}
+
+// Client sends calls over a reliable messaging sequence. It is safe for concurrent use.
+type Client struct {
+	client *soap.Client
+	opts   Options
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// New returns a Client sending calls with client. The client must not send WS-Addressing headers itself,
+// they are added to every call.
+func New(client *soap.Client, opts Options) *Client {
+	if opts.MaxRetransmissions <= 0 {
+		opts.MaxRetransmissions = 3
+	}
+	if opts.RetransmissionInterval <= 0 {
+		opts.RetransmissionInterval = defaultRetransmissionInterval
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	return &Client{client: client, opts: opts}
+}
+
+type createSequence struct {
+	XMLName xml.Name `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 CreateSequence"`
+	AcksTo  endpoint `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 AcksTo"`
+}
+
+type endpoint struct {
+	Address string `xml:"http://www.w3.org/2005/08/addressing Address"`
+}
+
+type createSequenceResponse struct {
+	XMLName    xml.Name `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 CreateSequenceResponse"`
+	Identifier string   `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 Identifier"`
+}
+
+type terminateSequence struct {
+	XMLName       xml.Name `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 TerminateSequence"`
+	Identifier    string   `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 Identifier"`
+	LastMsgNumber uint64   `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 LastMsgNumber"`
+}
+
+type terminateSequenceResponse struct {
+	XMLName    xml.Name `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 TerminateSequenceResponse"`
+	Identifier string   `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 Identifier"`
+}
+
+type sequenceHeader struct {
+	XMLName        xml.Name `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 Sequence"`
+	MustUnderstand int      `xml:"http://schemas.xmlsoap.org/soap/envelope/ mustUnderstand,attr"`
+	Identifier     string   `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 Identifier"`
+	MessageNumber  uint64   `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 MessageNumber"`
+}
+
+type sequenceAcknowledgement struct {
+	XMLName    xml.Name `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 SequenceAcknowledgement"`
+	Identifier string   `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 Identifier"`
+	Ranges     []struct {
+		Lower uint64 `xml:"Lower,attr"`
+		Upper uint64 `xml:"Upper,attr"`
+	} `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 AcknowledgementRange"`
+}
+
+// Do sends the call as the next message of the sequence, creating the sequence first if there is none.
+// The message is sent again with the same message number until the service acknowledged it, at most
+// MaxRetransmissions times after waiting for the RetransmissionInterval. SOAP faults are returned without
+// retransmission, and ctx done while waiting fails the call with ErrNotAcknowledged and the error of ctx.
+func (c *Client) Do(ctx context.Context, action string, request any, response any, opts ...soap.Option) error {
+	seq, number, err := c.next(ctx)
+	if err != nil {
+		return err
+	}
+
+	header := soap.WithHeaderBuilder(func(ctx context.Context, body any) (any, error) {
+		return sequenceHeader{MustUnderstand: 1, Identifier: seq, MessageNumber: number}, nil
+	})
+	opts = append(opts[:len(opts):len(opts)], header, soap.WithAddressing(soap.AddressingOptions{ReuseMessageID: true}),
+		soap.UnderstandHeaders(xml.Name{Space: Namespace}))
+	for attempt := 0; ; attempt++ {
+		var info soap.ResponseInfo
+		err = c.client.Do(ctx, action, request, response, append(opts, soap.WithResponseInfo(&info))...)
+		acked, ackErr := c.acknowledge(ctx, seq, number, info.SOAPHeaders)
+		if ackErr != nil {
+			return ackErr
+		}
+		var fault *soap.Fault
+		if errors.As(err, &fault) || ctx.Err() != nil {
+			return err
+		}
+		if err == nil && acked {
+			return nil
+		}
+		if attempt >= c.opts.MaxRetransmissions {
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrNotAcknowledged, err)
+			}
+			return ErrNotAcknowledged
+		}
+		if waitErr := c.wait(ctx, attempt); waitErr != nil {
+			return fmt.Errorf("%w: %w", ErrNotAcknowledged, waitErr)
+		}
+	}
+}
+
+// wait blocks for the interval before the retransmission following attempt, or until ctx is done.
+func (c *Client) wait(ctx context.Context, attempt int) error {
+	d := c.opts.RetransmissionInterval
+	for i := 0; i < attempt && d < maxRetransmissionInterval; i++ {
+		d = min(2*d, maxRetransmissionInterval)
+	}
+	var fired <-chan time.Time
+	if c.opts.Clock != nil {
+		timer := c.opts.Clock.NewTimer(d)
+		defer timer.Stop()
+		fired = timer.C()
+	} else {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		fired = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-fired:
+		return nil
+	}
+}
+
+// next returns the sequence identifier and the number of the next message, creating the sequence if needed.
+func (c *Client) next(ctx context.Context) (string, uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return "", 0, ErrClosed
+	}
+	seq, err := c.opts.Store.Load(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	if seq == nil {
+		var resp createSequenceResponse
+		req := &createSequence{AcksTo: endpoint{Address: anonymous}}
+		if err := c.client.Do(ctx, ActionCreateSequence, req, &resp, soap.WithAddressing(soap.AddressingOptions{})); err != nil {
+			return "", 0, fmt.Errorf("creating sequence: %w", err)
+		}
+		seq = &Sequence{ID: resp.Identifier}
+	}
+	seq.LastMessageNumber++
+	if err := c.opts.Store.Save(ctx, seq); err != nil {
+		return "", 0, err
+	}
+	return seq.ID, seq.LastMessageNumber, nil
+}
+
+// acknowledge records the acknowledgements among the response headers and reports whether message number of
+// the sequence id is acknowledged. A reply without acknowledgement of the sequence counts as acknowledgement.
+func (c *Client) acknowledge(ctx context.Context, id string, number uint64, headers []soap.RawHeader) (bool, error) {
+	var ack *sequenceAcknowledgement
+	for _, h := range headers {
+		if h.XMLName.Space != Namespace || h.XMLName.Local != "SequenceAcknowledgement" {
+			continue
+		}
+		var v sequenceAcknowledgement
+		if err := h.Decode(&v); err != nil {
+			return false, err
+		}
+		if v.Identifier == id {
+			ack = &v
+		}
+	}
+	if ack == nil {
+		return true, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	seq, err := c.opts.Store.Load(ctx)
+	if err != nil || seq == nil || seq.ID != id {
+		return false, err
+	}
+	seq.Acknowledged = seq.Acknowledged[:0]
+	for _, r := range ack.Ranges {
+		seq.Acknowledged = append(seq.Acknowledged, Range{Lower: r.Lower, Upper: r.Upper})
+	}
+	if err := c.opts.Store.Save(ctx, seq); err != nil {
+		return false, err
+	}
+	return seq.acknowledged(number), nil
+}
+
+// Close terminates the sequence, if one was created. The client cannot be used afterwards.
+func (c *Client) Close(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	seq, err := c.opts.Store.Load(ctx)
+	if err != nil || seq == nil {
+		return err
+	}
+	req := &terminateSequence{Identifier: seq.ID, LastMsgNumber: seq.LastMessageNumber}
+	if err := c.client.Do(ctx, ActionTerminateSequence, req, &terminateSequenceResponse{}, soap.WithAddressing(soap.AddressingOptions{})); err != nil {
+		return fmt.Errorf("terminating sequence: %w", err)
+	}
+	return c.opts.Store.Delete(ctx)
+}
@@ -0,0 +1,147 @@
+package wsrm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m29h/xml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	soap "github.com/OmerBerkcanMee/gosoap"
+	"github.com/OmerBerkcanMee/gosoap/soaptest"
+)
+
+type echo struct {
+	XMLName xml.Name `xml:"urn:test Echo"`
+	Value   string   `xml:"Value"`
+}
+
+type echoResponse struct {
+	XMLName xml.Name `xml:"urn:test EchoResponse"`
+	Value   string   `xml:"Value"`
+}
+
+var messageNumber = regexp.MustCompile(`MessageNumber[^>]*>(\d+)<`)
+
+// newReliableServer answers like a WCF reliable session endpoint. The first drop deliveries of every message
+// are not acknowledged.
+func newReliableServer(t *testing.T, drop int) (*soaptest.Server, *[]uint64) {
+	srv := soaptest.NewServer(t)
+	var mu sync.Mutex
+	var received []uint64
+	deliveries := map[uint64]int{}
+	srv.Respond(ActionCreateSequence, `<wsrm:CreateSequenceResponse xmlns:wsrm="`+Namespace+`">`+
+		`<wsrm:Identifier>urn:uuid:seq-1</wsrm:Identifier></wsrm:CreateSequenceResponse>`)
+	srv.Respond(ActionTerminateSequence, `<wsrm:TerminateSequenceResponse xmlns:wsrm="`+Namespace+`">`+
+		`<wsrm:Identifier>urn:uuid:seq-1</wsrm:Identifier></wsrm:TerminateSequenceResponse>`)
+	srv.Handle("urn:test:Echo", func(w http.ResponseWriter, r *http.Request) {
+		reqs := srv.Requests()
+		m := messageNumber.FindSubmatch(reqs[len(reqs)-1].Body)
+		require.NotNil(t, m)
+		number, _ := strconv.ParseUint(string(m[1]), 10, 64)
+
+		mu.Lock()
+		received = append(received, number)
+		deliveries[number]++
+		var ranges string
+		for n := uint64(1); deliveries[n] > drop; n++ {
+			ranges = fmt.Sprintf(`<wsrm:AcknowledgementRange Lower="1" Upper="%d"/>`, n)
+		}
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Header>`+
+			`<wsrm:SequenceAcknowledgement xmlns:wsrm="%s"><wsrm:Identifier>urn:uuid:seq-1</wsrm:Identifier>%s`+
+			`</wsrm:SequenceAcknowledgement></s:Header><s:Body>`+
+			`<EchoResponse xmlns="urn:test"><Value>%d</Value></EchoResponse></s:Body></s:Envelope>`, Namespace, ranges, number)
+	})
+	return srv, &received
+}
+
+func TestClient(t *testing.T) {
+	tests := []struct {
+		name     string
+		drop     int
+		limit    int
+		received []uint64
+		// waited is the time waited for the retransmissions
+		waited time.Duration
+		err    error
+	}{
+		{name: "acknowledged", received: []uint64{1, 2}},
+		{name: "resent", drop: 1, received: []uint64{1, 1, 2, 2}, waited: 2 * time.Second},
+		{name: "limit", drop: 3, limit: 2, received: []uint64{1, 1, 1}, waited: 3 * time.Second, err: ErrNotAcknowledged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, received := newReliableServer(t, tt.drop)
+			store := NewMemoryStore()
+			start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			clock := soaptest.NewClock(start)
+			clock.AutoAdvance(true)
+			client := New(soap.NewClient(srv.URL), Options{MaxRetransmissions: tt.limit, Store: store, Clock: clock})
+
+			for i := 0; i < 2; i++ {
+				var resp echoResponse
+				err := client.Do(context.Background(), "urn:test:Echo", &echo{Value: "x"}, &resp)
+				if tt.err != nil {
+					assert.ErrorIs(t, err, tt.err)
+					break
+				}
+				require.NoError(t, err)
+				assert.Equal(t, strconv.Itoa(i+1), resp.Value)
+			}
+			assert.Equal(t, tt.received, *received)
+			assert.Equal(t, tt.waited, clock.Now().Sub(start))
+
+			seq, err := store.Load(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, "urn:uuid:seq-1", seq.ID)
+
+			require.NoError(t, client.Close(context.Background()))
+			seq, err = store.Load(context.Background())
+			require.NoError(t, err)
+			assert.Nil(t, seq)
+			assert.ErrorIs(t, client.Do(context.Background(), "urn:test:Echo", &echo{}, &echoResponse{}), ErrClosed)
+
+			reqs := srv.Requests()
+			assert.Equal(t, ActionCreateSequence, reqs[0].Action)
+			assert.Contains(t, string(reqs[0].Body), "anonymous</")
+			assert.Equal(t, ActionTerminateSequence, reqs[len(reqs)-1].Action)
+			assert.Contains(t, string(reqs[len(reqs)-1].Body), fmt.Sprintf(`LastMsgNumber>%d<`, lastNumber(tt.received)))
+			for _, req := range reqs[1 : len(reqs)-1] {
+				assert.Contains(t, string(req.Body), `mustUnderstand="1"`)
+				assert.Contains(t, string(req.Body), "urn:uuid:seq-1</")
+			}
+		})
+	}
+}
+
+// lastNumber returns the highest message number in received.
+func lastNumber(received []uint64) uint64 {
+	var last uint64
+	for _, n := range received {
+		last = max(last, n)
+	}
+	return last
+}
+
+func TestRetransmissionWait(t *testing.T) {
+	srv, received := newReliableServer(t, 3)
+	client := New(soap.NewClient(srv.URL), Options{RetransmissionInterval: time.Hour})
+
+	// the retransmission is not waited for once ctx is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := client.Do(ctx, "urn:test:Echo", &echo{Value: "x"}, &echoResponse{})
+	assert.ErrorIs(t, err, ErrNotAcknowledged)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, []uint64{1}, *received)
+}
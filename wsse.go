@@ -1,15 +1,10 @@
 package soap
 
 import (
-	"crypto"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/sha256"
+	"context"
 	"crypto/tls"
-	"encoding/base64"
 	"errors"
-	"reflect"
-	"strings"
+	"time"
 
 	"github.com/m29h/xml"
 
@@ -29,18 +24,29 @@ const (
 	rsaSha256Sig = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
 	sha1Sig      = "http://www.w3.org/2000/09/xmldsig#sha1"
 	sha256Sig    = "http://www.w3.org/2001/04/xmlenc#sha256"
+
+	// timestampValidity is the time from wsu:Created to wsu:Expires
+	timestampValidity = 10 * time.Second
 )
 
 var (
 	// ErrUnableToSignEmptyEnvelope is returned if the envelope to be signed is empty. This is not valid.
 	ErrUnableToSignEmptyEnvelope = errors.New("unable to sign, envelope is empty")
+
+	// errUnsignedHeaders is returned if the placeholder of a signed Security header is serialized outside of
+	// a request, e.g. a builder of ContextHeader called directly.
+	errUnsignedHeaders = errors.New("security header not signed")
 )
 
 // WSSEAuthInfo contains the information required to use WS-Security X.509 signing.
 type WSSEAuthInfo struct {
 	certDER tls.Certificate
-	key     crypto.PrivateKey
-	sigRef  []signatureReference
+
+	expireAtDeadline bool
+	placement        SecurityHeaderOptions
+	signing          SigningOptions
+	// newID generates the wsu:Id values, getWsuID if nil. Tests set it to get reproducible envelopes.
+	newID func() string
 }
 
 // NewWSSEAuthInfo retrieves the supplied certificate path and key path for signing SOAP requests.
@@ -54,8 +60,6 @@ func NewWSSEAuthInfo(certPath string, keyPath string) (*WSSEAuthInfo, error) {
 
 	return &WSSEAuthInfo{
 		certDER: cert,
-		key:     cert.PrivateKey,
-		sigRef:  make([]signatureReference, 0),
 	}, nil
 }
 
@@ -133,6 +137,19 @@ type timestamp struct {
 	Expires string   `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Expires"`
 }
 
+func init() {
+	// the WS-Security 1.1 elements get their usual prefix, the xml package knows the prefixes of 1.0 only
+	_ = xml.NameSpaceBinding.Add(wsse11NS, "wsse11")
+}
+
+// signatureConfirmation confirms the SignatureValue of a request in the Security header of the response
+// (WS-Security 1.1).
+type signatureConfirmation struct {
+	XMLName xml.Name `xml:"http://docs.oasis-open.org/wss/oasis-wss-wssecurity-secext-1.1.xsd SignatureConfirmation"`
+	WsuID   string   `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Id,attr"`
+	Value   string   `xml:"Value,attr,omitempty"`
+}
+
 type strReference struct {
 	XMLName   xml.Name `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd Reference"`
 	ValueType string   `xml:"ValueType,attr"`
@@ -160,127 +177,195 @@ type signature struct {
 }
 
 type security struct {
-	XMLName        xml.Name `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd Security"`
-	MustUnderstand int      `xml:"http://schemas.xmlsoap.org/soap/envelope/ mustUnderstand,attr"`
+	XMLName          xml.Name `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd Security"`
+	MustUnderstand   int      `xml:"http://schemas.xmlsoap.org/soap/envelope/ mustUnderstand,attr,omitempty"`
+	Actor            string   `xml:"http://schemas.xmlsoap.org/soap/envelope/ actor,attr,omitempty"`
+	MustUnderstand12 int      `xml:"http://www.w3.org/2003/05/soap-envelope mustUnderstand,attr,omitempty"`
+	Role             string   `xml:"http://www.w3.org/2003/05/soap-envelope role,attr,omitempty"`
+
+	Signature     signature
+	Token         *binarySecurityToken
+	Timestamp     timestamp
+	Confirmations []signatureConfirmation
+
+	order []SecurityElement
+}
 
-	Signature signature
-	Timestamp timestamp
+// MarshalXML encodes the header with its content in the configured order.
+func (s security) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	order := s.order
+	if order == nil {
+		order = SigningOptions{}.order()
+	}
+	content := make([]any, 0, len(order))
+	for _, el := range order {
+		switch {
+		case el == SecuritySignature:
+			content = append(content, s.Signature)
+		case el == SecurityToken && s.Token != nil:
+			content = append(content, s.Token)
+		case el == SecurityTimestamp:
+			content = append(content, s.Timestamp)
+		}
+	}
+	for _, c := range s.Confirmations {
+		content = append(content, c)
+	}
+	return e.Encode(unsignedSecurity{
+		MustUnderstand:   s.MustUnderstand,
+		Actor:            s.Actor,
+		MustUnderstand12: s.MustUnderstand12,
+		Role:             s.Role,
+		Content:          content,
+	})
 }
 
-func getWsuID() string {
-	return "WSSE" + uuid.New().String()
+// unsignedSecurity is a wsse:Security header with arbitrary content.
+type unsignedSecurity struct {
+	XMLName          xml.Name `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd Security"`
+	MustUnderstand   int      `xml:"http://schemas.xmlsoap.org/soap/envelope/ mustUnderstand,attr,omitempty"`
+	Actor            string   `xml:"http://schemas.xmlsoap.org/soap/envelope/ actor,attr,omitempty"`
+	MustUnderstand12 int      `xml:"http://www.w3.org/2003/05/soap-envelope mustUnderstand,attr,omitempty"`
+	Role             string   `xml:"http://www.w3.org/2003/05/soap-envelope role,attr,omitempty"`
+
+	Content []any
 }
-func (w *WSSEAuthInfo) addSignature(element any) error {
-	// 0. We create the id value and assign it to the incoming body.WsuID via reflect
-	id := getWsuID()
-	val := reflect.ValueOf(element)
 
-	if val.Kind().String() != "ptr" {
-		return errors.New("addSignature: body must be pointer")
-	}
+// SecurityHeaderOptions configures the placement of a wsse:Security header. An envelope may carry several
+// Security headers as long as their actors differ.
+type SecurityHeaderOptions struct {
+	// Actor is the URI of the actor (SOAP 1.1) or role (SOAP 1.2) the header is targeted at.
+	// If empty, the header is targeted at the ultimate receiver.
+	Actor string
+	// OmitMustUnderstand omits the mustUnderstand="1" attribute.
+	OmitMustUnderstand bool
+	// Version selects the namespace of the mustUnderstand and actor or role attributes.
+	Version Version
+}
 
-	if val.Elem().Kind().String() != "struct" {
-		return errors.New("addSignature: body must point to struct")
+// attributes returns the mustUnderstand and actor attributes of SOAP 1.1 and SOAP 1.2, only the ones of
+// the configured version are set.
+func (o SecurityHeaderOptions) attributes() (mustUnderstand int, actor string, mustUnderstand12 int, role string) {
+	if !o.OmitMustUnderstand {
+		mustUnderstand = 1
 	}
-
-	found := false
-	for i := 0; i < val.Elem().NumField(); i++ {
-		if strings.ToLower(val.Elem().Type().Field(i).Name) == "wsuid" {
-			val.Elem().Field(i).SetString(id)
-			found = true
-		}
+	if o.Version == SOAP12 {
+		return 0, "", mustUnderstand, o.Actor
 	}
-	if !found {
-		return errors.New("addSignature: body did not contain a WsuID struct field")
+	return mustUnderstand, o.Actor, 0, ""
+}
+
+// SecurityHeader returns the builder of an unsigned wsse:Security header containing elems, e.g. to pass a
+// token to an actor other than the one of the signed header.
+func SecurityHeader(opts SecurityHeaderOptions, elems ...any) HeaderBuilder {
+	return func(body any) (any, error) {
+		sec := unsignedSecurity{Content: elems}
+		sec.MustUnderstand, sec.Actor, sec.MustUnderstand12, sec.Role = opts.attributes()
+		return sec, nil
 	}
+}
 
-	// 1. We create the DigestValue of the body.
+func getWsuID() string {
+	return "WSSE" + uuid.New().String()
+}
 
-	// We make some changes to canonicalize things.
-	// Since we have a copy, this is ok
-	bodyEnc, err := xml.Marshal(element)
-	if err != nil {
-		return err
+func (w *WSSEAuthInfo) wsuID() string {
+	if w.newID != nil {
+		return w.newID()
 	}
-
-	//bodyHasher := sha1.New()
-	bodyHasher := sha256.New()
-	bodyHasher.Write(bodyEnc)
-	encodedBodyDigest := base64.StdEncoding.EncodeToString(bodyHasher.Sum(nil))
-	w.sigRef = append(w.sigRef, signatureReference{
-		URI: "#" + id,
-		Transforms: transforms{
-			Transform: transform{
-				Algorithm: canonicalizationExclusiveC14N,
-			},
-		},
-		DigestMethod: digestMethod{
-			Algorithm: sha256Sig, //sha1Sig,
-		},
-		DigestValue: digestValue{
-			Value: encodedBodyDigest,
-		},
-	})
-	return nil
+	return getWsuID()
 }
+
+// Header returns the builder of the signed wsse:Security header. The request signs the envelope with
+// ApplySecurity once it is encoded, the header cannot be serialized on its own.
 func (w *WSSEAuthInfo) Header() HeaderBuilder {
 	return func(body any) (any, error) {
-		return w.securityHeader(body)
+		return w.build(context.Background(), body)
 	}
 }
 
-func (w *WSSEAuthInfo) securityHeader(body any) (security, error) {
-	if body == nil {
-		return security{}, ErrUnableToSignEmptyEnvelope
+// ContextHeader returns the builder of the signed wsse:Security header for use with WithHeaderBuilder.
+// Unlike Header it can take the deadline of the call into account, see ExpireAtDeadline.
+func (w *WSSEAuthInfo) ContextHeader() ContextHeaderBuilder {
+	return func(ctx context.Context, body any) (any, error) {
+		return w.build(ctx, body)
 	}
+}
 
-	if err := w.addSignature(body); err != nil {
-		return security{}, err
-	}
+// SetSecurityHeader sets the placement of the signed wsse:Security header. By default it carries
+// mustUnderstand="1" and no actor.
+func (w *WSSEAuthInfo) SetSecurityHeader(opts SecurityHeaderOptions) {
+	w.placement = opts
+}
+
+// ExpireAtDeadline lets the wsu:Timestamp built by ContextHeader expire at the deadline of the call context,
+// so the server can drop requests the client gave up on. Without a deadline it expires 10 seconds after creation.
+func (w *WSSEAuthInfo) ExpireAtDeadline(enabled bool) {
+	w.expireAtDeadline = enabled
+}
 
-	// 2. Set the DigestValue then sign the 'SignedInfo' struct
-	signedInfo := signedInfo{
-		CanonicalizationMethod: canonicalizationMethod{
-			Algorithm: canonicalizationExclusiveC14N,
-		},
-		SignatureMethod: signatureMethod{
-			Algorithm: rsaSha256Sig,
-		},
-		Reference: w.sigRef,
+// config returns the configuration of the signature of a request sent with ctx.
+func (w *WSSEAuthInfo) config(ctx context.Context) SecurityConfig {
+	created := ServerTime(ctx).UTC()
+	expires := created.Add(timestampValidity)
+	if deadline, ok := ctx.Deadline(); ok && w.expireAtDeadline {
+		expires = deadline.Add(serverClockOffset(ctx)).UTC()
+	}
+	return SecurityConfig{
+		Certificate: w.certDER,
+		Header:      w.placement,
+		Signing:     w.signing,
+		Created:     created,
+		Expires:     expires,
+		NewID:       w.wsuID,
 	}
+}
 
-	signedInfoEnc, err := xml.Marshal(signedInfo)
-	if err != nil {
-		return security{}, err
+// build returns the placeholder of the signed Security header, preceded by the empty Security header of the
+// token if it is separate.
+func (w *WSSEAuthInfo) build(ctx context.Context, body any) (any, error) {
+	if body == nil {
+		return nil, ErrUnableToSignEmptyEnvelope
+	}
+	sec := &pendingSecurity{config: w.config(ctx)}
+	if !w.signing.BinarySecurityToken || w.signing.TokenHeader == nil {
+		return sec, nil
 	}
-	signedInfoHasher := sha256.New()
-	signedInfoHasher.Write(signedInfoEnc)
-	signedInfoDigest := signedInfoHasher.Sum(nil)
+	var tokenHeader unsignedSecurity
+	tokenHeader.MustUnderstand, tokenHeader.Actor, tokenHeader.MustUnderstand12, tokenHeader.Role = w.signing.TokenHeader.attributes()
+	return []any{tokenHeader, sec}, nil
+}
 
-	privateKey := w.key.(*rsa.PrivateKey)
+// pendingSecurity is the placeholder of a signed Security header. The request serializes it as an empty
+// Security header, filled by ApplySecurity once the envelope is encoded.
+type pendingSecurity struct {
+	config SecurityConfig
+	// inRequest is set by the request serializing the placeholder
+	inRequest bool
+	// merged is set if the signature goes into another Security header of the actor, see DuplicateHeaderPolicy
+	merged bool
+}
 
-	signatureValue, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, signedInfoDigest)
-	if err != nil {
-		return security{}, err
+func (p *pendingSecurity) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if !p.inRequest {
+		return errUnsignedHeaders
 	}
+	if p.merged {
+		return nil
+	}
+	var sec unsignedSecurity
+	sec.MustUnderstand, sec.Actor, sec.MustUnderstand12, sec.Role = p.config.Header.attributes()
+	return e.Encode(sec)
+}
 
-	encodedSignatureValue := base64.StdEncoding.EncodeToString(signatureValue)
-	securityTokenID := getWsuID()
-	secHeader := security{
-		MustUnderstand: 1,
-		Signature: signature{
-			SignedInfo:     signedInfo,
-			SignatureValue: encodedSignatureValue,
-			KeyInfo: keyInfo{
-				SecurityTokenReference: securityTokenReference{
-					Reference: strReference{
-						ValueType: valTypeX509Token,
-						URI:       "#" + securityTokenID,
-					},
-				},
-			},
-		},
+// pendingSignatures returns the placeholders of the signed Security headers among the headers, in order.
+func (h *Header) pendingSignatures() []*pendingSecurity {
+	var pending []*pendingSecurity
+	for _, hdr := range flattenHeaders(nil, h.Headers) {
+		if sec, ok := hdr.(*pendingSecurity); ok {
+			sec.inRequest = true
+			pending = append(pending, sec)
+		}
 	}
-	w.sigRef = make([]signatureReference, 0)
-	return secHeader, nil
+	return pending
 }
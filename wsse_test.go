@@ -1,9 +1,16 @@
 package soap
 
 import (
+	"context"
 	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/beevik/etree"
 	"github.com/m29h/xml"
 
 	"github.com/stretchr/testify/assert"
@@ -43,43 +50,177 @@ func TestNewWSSEAuthInfo(t *testing.T) {
 	}
 }
 
-func TestAddSignature(t *testing.T) {
-	wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
-	assert.NoError(t, err)
-	body := &timestamp{
-		WsuID:   "",
-		Created: "_",
-		Expires: "_",
+// pendingTimestamp returns the wsu:Timestamp the placeholder built by a WSSEAuthInfo is signed with.
+func pendingTimestamp(t *testing.T, header any) timestamp {
+	t.Helper()
+	sec, ok := header.(*pendingSecurity)
+	if !assert.True(t, ok) {
+		t.FailNow()
 	}
-	err = wsseInfo.addSignature(body)
-	assert.NoError(t, err)
-	//there must be
-	assert.NotEqual(t, len(body.WsuID), 0)
-	assert.Equal(t, len(wsseInfo.sigRef), 1)
+	return sec.config.timestamp("")
 }
 
 func TestSecurityHeader(t *testing.T) {
 	wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
 	assert.NoError(t, err)
-	body := &timestamp{
-		WsuID: "",
-	}
-	secHeader, err := wsseInfo.securityHeader(body)
+	req := NewRequest("Sign", "http://localhost", &infoRequest{}, nil, nil)
+	req.AddHeader(wsseInfo.Header())
+	data, err := req.serialize()
 	assert.NoError(t, err)
-	//there must be the WsuID set to a string of a length larger than 0 for body and timestamp
-	assert.NotEqual(t, len(body.WsuID), 0)
-	assert.NotEqual(t, len(secHeader.Timestamp.WsuID), 0)
+	doc := etree.NewDocument()
+	assert.NoError(t, doc.ReadFromBytes(data))
+	sec := doc.FindElement("//Header/Security")
+	if !assert.NotNil(t, sec) {
+		return
+	}
+	//there must be the wsu:Id set to a string of a length larger than 0 for body and timestamp
+	assert.NotEmpty(t, doc.FindElement("//Body").SelectAttrValue("Id", ""))
+	assert.NotEmpty(t, sec.FindElement("Timestamp").SelectAttrValue("Id", ""))
 	//timestamp must be autoset to some value
-	assert.NotEqual(t, len(secHeader.Timestamp.Created), 0)
-	assert.NotEqual(t, len(secHeader.Timestamp.Expires), 0)
-	//the sigRef must be cleared after generating the header
-	assert.Equal(t, len(wsseInfo.sigRef), 0)
+	assert.NotEmpty(t, sec.FindElement("Timestamp/Created").Text())
+	assert.NotEmpty(t, sec.FindElement("Timestamp/Expires").Text())
 	//the length of signed references in the header must be 2 (body+timestamp)
-	assert.Len(t, secHeader.Signature.SignedInfo.Reference, 2)
-	assert.Equal(t, secHeader.MustUnderstand, 1)
-	bodyEnc, err := xml.MarshalIndent(&secHeader, "", "  ")
-	b := string(bodyEnc)
+	assert.Len(t, sec.FindElements("Signature/SignedInfo/Reference"), 2)
+	assert.Equal(t, "1", sec.SelectAttrValue("mustUnderstand", ""))
+	assert.Contains(t, string(data), "</wsu:Expires>")
+}
+
+func TestSecurityHeaderExpireAtDeadline(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	assert.NoError(t, err)
+	deadline := time.Now().Add(time.Hour)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	secHeader, err := wsseInfo.ContextHeader()(ctx, &timestamp{})
+	assert.NoError(t, err)
+	assert.NotEqual(t, TimestampMilliseconds.Format(deadline), pendingTimestamp(t, secHeader).Expires)
+
+	wsseInfo.ExpireAtDeadline(true)
+	secHeader, err = wsseInfo.ContextHeader()(ctx, &timestamp{})
 	assert.NoError(t, err)
-	//fmt.Println(b)
-	assert.Contains(t, b, "</wsu:Expires>")
+	assert.Equal(t, TimestampMilliseconds.Format(deadline), pendingTimestamp(t, secHeader).Expires)
+
+	// without a deadline the default validity applies
+	secHeader, err = wsseInfo.ContextHeader()(context.Background(), &timestamp{})
+	assert.NoError(t, err)
+	created, err := ParseTimestamp(pendingTimestamp(t, secHeader).Created)
+	assert.NoError(t, err)
+	expires, err := ParseTimestamp(pendingTimestamp(t, secHeader).Expires)
+	assert.NoError(t, err)
+	assert.Equal(t, timestampValidity, expires.Sub(created))
+}
+
+func TestMultipleSecurityHeaders(t *testing.T) {
+	gateway, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	assert.NoError(t, err)
+	gateway.SetSecurityHeader(SecurityHeaderOptions{Actor: "urn:gateway"})
+	backend, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	assert.NoError(t, err)
+	backend.SetSecurityHeader(SecurityHeaderOptions{OmitMustUnderstand: true})
+
+	req := NewRequest("Sign", "http://localhost", &infoRequest{}, nil, nil)
+	req.AddHeader(gateway.Header(), backend.Header(),
+		SecurityHeader(SecurityHeaderOptions{Actor: "urn:audit"}, &idempotencyHeader{Value: "k"}))
+	data, err := req.serialize()
+	assert.NoError(t, err)
+	s := string(data)
+	assert.Contains(t, s, `soapenv:actor="urn:gateway" soapenv:mustUnderstand="1"`)
+	assert.Contains(t, s, `soapenv:actor="urn:audit" soapenv:mustUnderstand="1"`)
+	assert.Equal(t, 2, strings.Count(s, "mustUnderstand="))
+
+	envelope := []byte(s)
+	_, cert := signedEnvelope(t, &infoRequest{})
+	assert.NoError(t, VerifySignature(envelope, VerifyOptions{Certificate: cert, Actor: "urn:gateway"}))
+	assert.NoError(t, VerifySignature(envelope, VerifyOptions{Certificate: cert}))
+	assert.ErrorIs(t, VerifySignature(envelope, VerifyOptions{Certificate: cert, Actor: "urn:audit"}), ErrNoSignature)
+	assert.ErrorIs(t, VerifySignature(envelope, VerifyOptions{Certificate: cert, Actor: "urn:other"}), ErrNoSignature)
+}
+
+func TestSecurityHeaderSOAP12(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+	assert.NoError(t, err)
+	wsseInfo.SetSecurityHeader(SecurityHeaderOptions{Actor: "urn:gateway", Version: SOAP12})
+	req := NewRequest("Sign", "http://localhost", &infoRequest{}, nil, nil)
+	req.AddHeader(wsseInfo.Header())
+	req.settings, err = settings{}.apply(WithVersion(SOAP12))
+	assert.NoError(t, err)
+	data, err := req.serialize()
+	assert.NoError(t, err)
+
+	doc := etree.NewDocument()
+	assert.NoError(t, doc.ReadFromBytes(data))
+	sec := doc.FindElement("//Header/Security")
+	if !assert.NotNil(t, sec) {
+		return
+	}
+	for _, a := range sec.Attr {
+		if a.Key == "mustUnderstand" || a.Key == "role" || a.Key == "actor" {
+			assert.Equal(t, soap12EnvNS, a.NamespaceURI(), a.Key)
+		}
+	}
+	assert.Equal(t, "1", sec.SelectAttrValue("mustUnderstand", ""))
+	assert.Equal(t, "urn:gateway", sec.SelectAttrValue("role", ""))
+	assert.Empty(t, sec.SelectAttrValue("actor", ""))
+	_, cert := signedEnvelope(t, &infoRequest{})
+	assert.NoError(t, VerifySignature(data, VerifyOptions{Certificate: cert, Actor: "urn:gateway"}))
+}
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+type goldenOrder struct {
+	XMLName xml.Name `xml:"urn:example:orders CreateOrder"`
+	Sku     string   `xml:"Item>Sku"`
+	Amount  int      `xml:"Item>Amount"`
+}
+
+func TestSignedEnvelopeGolden(t *testing.T) {
+	trace := func(ctx context.Context, body any) (any, error) {
+		return &signedTraceHeader{Value: "t-1"}, nil
+	}
+	tests := []struct {
+		name    string
+		golden  string
+		signing SigningOptions
+		options []Option
+	}{
+		{name: "default order", golden: "./testdata/wsse/golden_request.xml"},
+		{
+			name:   "custom order",
+			golden: "./testdata/wsse/golden_request_ordered.xml",
+			signing: SigningOptions{BinarySecurityToken: true,
+				Order: []SecurityElement{SecurityTimestamp, SecurityToken, SecuritySignature}},
+			options: []Option{WithHeaderBuilder(trace), WithHeaderOrder(xml.Name{Space: "urn:test", Local: "Trace"})},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wsseInfo, err := NewWSSEAuthInfo(newWsseAuthInfoTests[0].inCertPath, newWsseAuthInfoTests[0].inKeyPath)
+			assert.NoError(t, err)
+			wsseInfo.SetSigning(tt.signing)
+			ids := 0
+			wsseInfo.newID = func() string {
+				ids++
+				return fmt.Sprintf("WSSE-%d", ids)
+			}
+			clock := &manualClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+			req := NewRequest("CreateOrder", "http://localhost", &goldenOrder{Sku: "978-0", Amount: 2}, nil, nil)
+			opts := append([]Option{WithClock(clock), WithHeaderBuilder(wsseInfo.ContextHeader())}, tt.options...)
+			req.settings, err = settings{}.apply(opts...)
+			assert.NoError(t, err)
+			req.ctx = contextWithClock(context.Background(), &req.settings)
+			data, err := req.serialize()
+			assert.NoError(t, err)
+
+			if *updateGolden {
+				assert.NoError(t, os.WriteFile(tt.golden, data, 0o644))
+			}
+			want, err := os.ReadFile(tt.golden)
+			assert.NoError(t, err)
+			assert.Equal(t, string(want), string(data))
+
+			assert.NoError(t, VerifySignature(data, VerifyOptions{Certificate: testCertificate(t), CurrentTime: clock.Now()}))
+		})
+	}
 }
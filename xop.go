@@ -39,6 +39,12 @@ type xopDecoder struct {
 	reader      io.Reader
 	mediaParams map[string]string
 	includes    map[string][]string
+	newDecoder  func(io.Reader) (SOAPDecoder, error)
+	attachments int
+	// store receives the attachments spilled to an attachment store, nil to read them into memory
+	store *Attachments
+	// digests verifies the digest headers of the parts if set
+	digests *digestConfig
 }
 
 func newXopDecoder(r io.Reader, mediaParams map[string]string) *xopDecoder {
@@ -46,6 +52,9 @@ func newXopDecoder(r io.Reader, mediaParams map[string]string) *xopDecoder {
 		includes:    make(map[string][]string),
 		reader:      r,
 		mediaParams: mediaParams,
+		newDecoder: func(r io.Reader) (SOAPDecoder, error) {
+			return xml.NewDecoder(r), nil
+		},
 	}
 	return d
 }
@@ -54,13 +63,11 @@ func (d *xopDecoder) getXopContentIDIncludePath(element *etree.Element, path []s
 	for _, token := range element.Child {
 		switch token := token.(type) {
 		case *etree.Element:
-			ns := token.Space
+			ns := token.NamespaceURI()
 			href := ""
 
 			for _, attr := range token.Attr {
-				if attr.Key == "xmlns" {
-					ns = attr.Value
-				} else if attr.Key == "href" {
+				if attr.Key == "href" {
 					href = attr.Value
 				}
 			}
@@ -234,7 +241,14 @@ func getExplicitXMLName(val reflect.Value) string {
 	return ""
 }
 
-func (d *xopDecoder) decode(respEnvelope *Envelope) error {
+func (d *xopDecoder) decode(respEnvelope *Envelope) (err error) {
+	// the attachments stored by a failing decode are of no use
+	mark := d.store.mark()
+	defer func() {
+		if err != nil {
+			_ = d.store.removeFrom(mark)
+		}
+	}()
 	parts := multipart.NewReader(d.reader, d.mediaParams["boundary"])
 	parsedXOPHeader := false
 	partNumber := 0
@@ -257,15 +271,22 @@ func (d *xopDecoder) decode(respEnvelope *Envelope) error {
 		// Find the include paths in it, store them, and then we'll proceed to the rest of the parts to put them into this document.
 		if strings.Contains(part.Header.Get("Content-Type"), "application/xop+xml") {
 			parsedXOPHeader = true
+			content := d.digests.verify(part.Header, part)
+			root, err := trimProlog(content)
+			if err != nil {
+				return err
+			}
 			doc := etree.NewDocument()
-			_, err = doc.ReadFrom(part)
+			_, err = doc.ReadFrom(root)
 			if err != nil {
 				return err
 			}
+			// the digest is checked at the end of the part
+			if _, err := io.Copy(io.Discard, content); err != nil {
+				return err
+			}
 
-			root := doc.Root()
-
-			d.getXopContentIDIncludePath(root, nil)
+			d.getXopContentIDIncludePath(doc.Root(), nil)
 
 			pipeReader, pipeWriter := io.Pipe()
 
@@ -275,7 +296,12 @@ func (d *xopDecoder) decode(respEnvelope *Envelope) error {
 				defer pipeWriter.Close()
 			}()
 
-			err = xml.NewDecoder(pipeReader).Decode(&respEnvelope)
+			dec, err := d.newDecoder(pipeReader)
+			if err != nil {
+				pipeReader.Close()
+				return err
+			}
+			err = dec.Decode(&respEnvelope)
 			if err != nil {
 				return err
 			}
@@ -302,18 +328,33 @@ func (d *xopDecoder) decode(respEnvelope *Envelope) error {
 				return ErrCannotSetBytesElement
 			}
 
+			// an Attachment receives the content type along with the data
+			if field.Type() == reflect.TypeOf(Attachment{}) {
+				attachment := field.Addr().Interface().(*Attachment)
+				if attachment.ContentID == "" {
+					attachment.ContentID = partContentID(part.Header.Get("Content-ID"))
+				}
+				if err := d.store.receive(attachment, d.digests.verify(part.Header, part)); err != nil {
+					return err
+				}
+				attachment.ContentType = part.Header.Get("Content-Type")
+				d.attachments++
+				continue
+			}
+
 			// double check field is a slice of bytes
 			if field.Type().String() != "[]uint8" {
 				return errFieldNotArray
 			}
 
 			// We don't read the content until we know we're able to save it (no point reading something we'll never store).
-			partBytes, err := ioutil.ReadAll(part)
+			partBytes, err := ioutil.ReadAll(d.digests.verify(part.Header, part))
 			if err != nil {
 				return err
 			}
 
 			field.SetBytes(partBytes)
+			d.attachments++
 		}
 	}
 